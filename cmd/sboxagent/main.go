@@ -2,25 +2,148 @@ package main
 
 import (
 	"context"
+	"encoding/json"
 	"flag"
+	"fmt"
 	"log"
 	"os"
 	"os/signal"
 	"syscall"
 
+	"github.com/kpblcaoo/sboxagent/internal/agent"
+	"github.com/kpblcaoo/sboxagent/internal/config"
+	"github.com/kpblcaoo/sboxagent/internal/lsm"
 	"github.com/kpblcaoo/sboxagent/internal/socket"
 )
 
 func main() {
 	// Parse command line flags
-	socketPath := flag.String("socket", "/tmp/sboxagent.sock", "Unix socket path")
+	socketPath := flag.String("socket", defaultSocketPath(), "Unix socket path, or host:port with -socket-network tcp")
+	socketNetwork := flag.String("socket-network", "unix", "Socket network: unix, or tcp to accept clients allowed by security.allowed_hosts")
+	configPath := flag.String("config", "", "Path to agent.yaml")
+	debug := flag.Bool("debug", false, "Enable debug logging")
+	strictConfig := flag.Bool("strict-config", false, "Reject unknown configuration keys")
+	printConfig := flag.String("print-config", "", "Print the effective configuration as yaml or json and exit")
+	dryRun := flag.Bool("dry-run", false, "Print what an update of the import client's config would change and exit")
+	profile := flag.String("profile", "", "Profile from the profiles section to apply (default $"+config.ProfileEnv+")")
+	generateUnit := flag.String("generate-unit", "", "Write the systemd unit (launchd plist on macOS) of the agent to a path, or - for stdout, print what changed and exit")
+	diffUnit := flag.Bool("diff-unit", false, "With -generate-unit, only print how the existing unit differs and exit 1 if it does")
+	repairUnits := flag.Bool("repair-units", false, "Rewrite the unit files that drifted from the generated units, reload systemd and exit")
+	uninstall := flag.Bool("uninstall", false, "Disable and remove the agent unit, delete the socket and state directories, print what was removed and exit")
+	restoreBackups := flag.Bool("restore-backups", false, "With -uninstall, put back the client configs from before the agent replaced them")
+	serviceAction := flag.String("service", "", "Install, uninstall, start or stop the Windows service of the agent and exit")
 	flag.Parse()
 
 	// Create logger
 	logger := log.New(os.Stdout, "[sboxagent] ", log.LstdFlags)
 
+	// Load configuration
+	cfg, err := config.LoadWithOptions(*configPath, config.LoadOptions{
+		Strict:      *strictConfig,
+		Profile:     *profile,
+		FetchRemote: true,
+	})
+	if err != nil {
+		logger.Fatalf("Failed to load configuration: %v", err)
+	}
+	if *debug {
+		cfg.Agent.LogLevel = "debug"
+	}
+
+	// Print the effective configuration instead of running
+	if *printConfig != "" {
+		if err := config.Print(os.Stdout, cfg, *printConfig); err != nil {
+			logger.Fatalf("Failed to print configuration: %v", err)
+		}
+		return
+	}
+
+	// Generate the systemd unit instead of running
+	if *generateUnit != "" {
+		changed, err := writeUnit(cfg, *generateUnit, *socketPath, *diffUnit)
+		if err != nil {
+			logger.Fatalf("Failed to generate unit: %v", err)
+		}
+		if *diffUnit && changed {
+			os.Exit(1)
+		}
+		return
+	}
+
+	// Control the Windows service instead of running
+	if *serviceAction != "" {
+		if err := controlService(cfg, *serviceAction, *socketPath); err != nil {
+			logger.Fatalf("Failed to %s service: %v", *serviceAction, err)
+		}
+		return
+	}
+
+	// Create agent
+	a, err := agent.New(cfg)
+	if err != nil {
+		logger.Fatalf("Failed to create agent: %v", err)
+	}
+
+	// Preview an update instead of running
+	if *dryRun {
+		preview, err := a.DryRunUpdate(context.Background(), "")
+		if err != nil {
+			logger.Fatalf("Dry run failed: %v", err)
+		}
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		if err := encoder.Encode(preview); err != nil {
+			logger.Fatalf("Failed to print dry run: %v", err)
+		}
+		return
+	}
+
 	// Create server
+	if *socketNetwork != "unix" && *socketNetwork != "tcp" {
+		logger.Fatalf("Unsupported socket network: %s", *socketNetwork)
+	}
 	server := socket.NewServer(*socketPath, logger)
+	server.Network = *socketNetwork
+	a.AttachSocket(server)
+
+	// Repair drifted units instead of running
+	if *repairUnits {
+		repaired, err := a.RepairUnits(context.Background())
+		if err != nil {
+			logger.Fatalf("Failed to repair units: %v", err)
+		}
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		if err := encoder.Encode(repaired); err != nil {
+			logger.Fatalf("Failed to print repaired units: %v", err)
+		}
+		return
+	}
+
+	// Remove the agent instead of running
+	if *uninstall {
+		result, err := a.Uninstall(context.Background(), agent.UninstallOptions{RestoreBackups: *restoreBackups})
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		if err := encoder.Encode(result); err != nil {
+			logger.Fatalf("Failed to print uninstall result: %v", err)
+		}
+		if err != nil {
+			logger.Fatalf("Uninstall incomplete: %v", err)
+		}
+		return
+	}
+	run := func(ctx context.Context) error {
+		return serve(ctx, a, server, *socketPath, logger)
+	}
+
+	// Run under the Windows service control manager when started by it
+	if isService() {
+		if err := runService(cfg.Agent.Name, run, logger); err != nil {
+			logger.Fatalf("Service error: %v", err)
+		}
+		return
+	}
 
 	// Create context for graceful shutdown
 	ctx, cancel := context.WithCancel(context.Background())
@@ -36,11 +159,66 @@ func main() {
 		cancel()
 	}()
 
-	// Start server
-	logger.Printf("Starting sboxagent server on socket: %s", *socketPath)
-	if err := server.Start(ctx); err != nil {
-		logger.Fatalf("Server error: %v", err)
+	// Run agent until shutdown
+	if err := run(ctx); err != nil {
+		logger.Fatalf("Agent error: %v", err)
 	}
 
 	logger.Println("Server stopped")
 }
+
+// serve runs the socket server and the agent until ctx is done or the
+// server fails
+func serve(ctx context.Context, a *agent.Agent, server *socket.Server, socketPath string, logger *log.Logger) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	logger.Printf("Starting sboxagent server on socket: %s", socketPath)
+	if err := server.Listen(); err != nil {
+		return fmt.Errorf("failed to open socket: %w", lsm.Explain(err))
+	}
+	go func() {
+		if err := server.Start(ctx); err != nil {
+			logger.Printf("Server error: %v", err)
+			cancel()
+		}
+	}()
+	return a.Start(ctx)
+}
+
+// writeUnit renders the agent unit, or plist on macOS, from agent.unit and
+// writes it to path, printing the settings that differ from the existing
+// one. With diffOnly the unit is not written. It reports whether the unit
+// changed.
+func writeUnit(cfg *config.Config, path, socketPath string, diffOnly bool) (bool, error) {
+	vars, err := config.NewUnitVars(cfg, socketPath)
+	if err != nil {
+		return false, err
+	}
+	unit, err := renderUnit(cfg, vars)
+	if err != nil {
+		return false, err
+	}
+	if path == "-" {
+		_, err := os.Stdout.Write(unit)
+		return true, err
+	}
+
+	existing, err := os.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		return false, err
+	}
+	changes := diffUnit(existing, unit)
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(changes); err != nil {
+		return false, err
+	}
+	if diffOnly || len(changes) == 0 {
+		return len(changes) > 0, nil
+	}
+	if err := os.WriteFile(path, unit, 0644); err != nil {
+		return false, fmt.Errorf("failed to write unit: %w", err)
+	}
+	return true, nil
+}
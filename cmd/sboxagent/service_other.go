@@ -0,0 +1,32 @@
+//go:build !windows
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+
+	"github.com/kpblcaoo/sboxagent/internal/config"
+)
+
+// defaultSocketPath returns the default path of the agent's socket
+func defaultSocketPath() string {
+	return "/tmp/sboxagent.sock"
+}
+
+// isService reports whether the agent was started by the Windows service
+// control manager, which is never the case here
+func isService() bool {
+	return false
+}
+
+// runService is only supported on Windows
+func runService(name string, run func(context.Context) error, logger *log.Logger) error {
+	return fmt.Errorf("windows services are not supported on this platform")
+}
+
+// controlService is only supported on Windows
+func controlService(cfg *config.Config, action, socketPath string) error {
+	return fmt.Errorf("windows services are not supported on this platform")
+}
@@ -0,0 +1,143 @@
+//go:build windows
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"path/filepath"
+	"time"
+
+	"github.com/kpblcaoo/sboxagent/internal/config"
+	"golang.org/x/sys/windows/svc"
+	"golang.org/x/sys/windows/svc/mgr"
+)
+
+// defaultSocketPath returns the default path of the agent's socket, next
+// to its configuration
+func defaultSocketPath() string {
+	return filepath.Join(config.DefaultConfigDir, "sboxagent.sock")
+}
+
+// isService reports whether the agent was started by the service control
+// manager
+func isService() bool {
+	ok, err := svc.IsWindowsService()
+	return err == nil && ok
+}
+
+// runService runs the agent as the named Windows service until the service
+// control manager stops it
+func runService(name string, run func(context.Context) error, logger *log.Logger) error {
+	return svc.Run(name, &agentService{run: run, logger: logger})
+}
+
+// agentService runs the agent for the service control manager
+type agentService struct {
+	run    func(context.Context) error
+	logger *log.Logger
+}
+
+// Execute reports the agent running and stops it on stop and shutdown
+// requests. Agent errors end the service with exit code 1, which triggers
+// its recovery actions.
+func (s *agentService) Execute(args []string, requests <-chan svc.ChangeRequest, status chan<- svc.Status) (bool, uint32) {
+	status <- svc.Status{State: svc.StartPending}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	done := make(chan error, 1)
+	go func() {
+		done <- s.run(ctx)
+	}()
+	status <- svc.Status{State: svc.Running, Accepts: svc.AcceptStop | svc.AcceptShutdown}
+
+	for {
+		select {
+		case err := <-done:
+			if err != nil {
+				s.logger.Printf("Agent error: %v", err)
+				return true, 1
+			}
+			return false, 0
+		case request := <-requests:
+			switch request.Cmd {
+			case svc.Interrogate:
+				status <- request.CurrentStatus
+			case svc.Stop, svc.Shutdown:
+				s.logger.Printf("Received service request: %v", request.Cmd)
+				status <- svc.Status{State: svc.StopPending}
+				cancel()
+			}
+		}
+	}
+}
+
+// controlService installs, uninstalls, starts or stops the Windows service
+// of the agent, named by agent.name. The service runs agent.unit.exec_start
+// and is restarted on failure unless agent.unit.restart is "no".
+func controlService(cfg *config.Config, action, socketPath string) error {
+	m, err := mgr.Connect()
+	if err != nil {
+		return fmt.Errorf("failed to connect to the service control manager: %w", err)
+	}
+	defer m.Disconnect()
+	name := cfg.Agent.Name
+
+	if action == "install" {
+		return installService(m, cfg, socketPath)
+	}
+	s, err := m.OpenService(name)
+	if err != nil {
+		return err
+	}
+	defer s.Close()
+	switch action {
+	case "uninstall":
+		return s.Delete()
+	case "start":
+		return s.Start()
+	case "stop":
+		_, err := s.Control(svc.Stop)
+		return err
+	default:
+		return fmt.Errorf("unknown service action %q", action)
+	}
+}
+
+// installService creates the service of the agent
+func installService(m *mgr.Mgr, cfg *config.Config, socketPath string) error {
+	vars, err := config.NewUnitVars(cfg, socketPath)
+	if err != nil {
+		return err
+	}
+	args, err := cfg.Agent.Unit.Command(vars)
+	if err != nil {
+		return err
+	}
+	unit := cfg.Agent.Unit
+	s, err := m.CreateService(cfg.Agent.Name, args[0], mgr.Config{
+		DisplayName: "SboxAgent",
+		Description: unit.Description,
+		StartType:   mgr.StartAutomatic,
+	}, args[1:]...)
+	if err != nil {
+		return err
+	}
+	defer s.Close()
+
+	if unit.Restart == "" || unit.Restart == "no" {
+		return nil
+	}
+	delay := unit.RestartSec
+	if delay <= 0 {
+		delay = time.Second
+	}
+	actions := []mgr.RecoveryAction{{Type: mgr.ServiceRestart, Delay: delay}}
+	if err := s.SetRecoveryActions(actions, uint32((24 * time.Hour).Seconds())); err != nil {
+		return fmt.Errorf("failed to set recovery actions: %w", err)
+	}
+	// Exit code 1 from Execute counts as a failure, not only crashes
+	return s.SetRecoveryActionsOnNonCrashFailures(true)
+}
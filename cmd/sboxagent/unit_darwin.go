@@ -0,0 +1,19 @@
+//go:build darwin
+
+package main
+
+import (
+	"github.com/kpblcaoo/sboxagent/internal/config"
+	"github.com/kpblcaoo/sboxagent/internal/initsys"
+)
+
+// renderUnit generates the launchd property list of the agent, logging to
+// ~/Library/Logs/sboxagent
+func renderUnit(cfg *config.Config, vars config.UnitVars) ([]byte, error) {
+	return initsys.RenderPlist(cfg.Agent.Unit, vars, config.DefaultLogDir)
+}
+
+// diffUnit compares an installed property list with a generated one
+func diffUnit(old, new []byte) []initsys.Change {
+	return initsys.DiffPlist(old, new)
+}
@@ -0,0 +1,18 @@
+//go:build !darwin
+
+package main
+
+import (
+	"github.com/kpblcaoo/sboxagent/internal/config"
+	"github.com/kpblcaoo/sboxagent/internal/systemd"
+)
+
+// renderUnit generates the systemd unit of the agent
+func renderUnit(cfg *config.Config, vars config.UnitVars) ([]byte, error) {
+	return systemd.RenderUnit(cfg.Agent.Unit, vars)
+}
+
+// diffUnit compares an installed unit with a generated one
+func diffUnit(old, new []byte) []systemd.UnitChange {
+	return systemd.DiffUnit(old, new)
+}
@@ -4,29 +4,155 @@ import (
 	"context"
 	"fmt"
 	"sync"
+	"syscall"
 	"time"
 
+	"github.com/kpblcaoo/sboxagent/internal/aggregator"
+	"github.com/kpblcaoo/sboxagent/internal/api"
 	"github.com/kpblcaoo/sboxagent/internal/config"
+	"github.com/kpblcaoo/sboxagent/internal/dispatcher"
+	"github.com/kpblcaoo/sboxagent/internal/health"
+	"github.com/kpblcaoo/sboxagent/internal/importer"
+	"github.com/kpblcaoo/sboxagent/internal/initsys"
 	"github.com/kpblcaoo/sboxagent/internal/logger"
+	"github.com/kpblcaoo/sboxagent/internal/lsm"
+	"github.com/kpblcaoo/sboxagent/internal/netloc"
+	"github.com/kpblcaoo/sboxagent/internal/notify"
+	"github.com/kpblcaoo/sboxagent/internal/process"
+	"github.com/kpblcaoo/sboxagent/internal/sdnotify"
+	"github.com/kpblcaoo/sboxagent/internal/security"
 	"github.com/kpblcaoo/sboxagent/internal/services"
+	"github.com/kpblcaoo/sboxagent/internal/socket"
+	"github.com/kpblcaoo/sboxagent/internal/standby"
+	"github.com/kpblcaoo/sboxagent/internal/supervisor"
+	"github.com/kpblcaoo/sboxagent/internal/telemetry"
+	"github.com/kpblcaoo/sboxagent/internal/tunnel"
+	"github.com/kpblcaoo/sboxagent/internal/upgrade"
 )
 
+// reapInterval is how often orphans are reaped when no SIGCHLD arrives
+const reapInterval = 30 * time.Second
+
 // Agent represents the main agent instance
 type Agent struct {
 	config *config.Config
 	logger *logger.Logger
-	
+
 	// Services
 	sboxctlService *services.SboxctlService
-	
+	apiServer      *api.Server
+	tunnelClient   *tunnel.Client
+	remoteSource   *config.RemoteSource
+	socketServer   *socket.Server
+	importer       *importer.Importer
+
+	// acl filters the remote peers of the API and of a TCP socket
+	acl *security.AccessList
+
+	// sboxctlInstances are the named sboxctl services, ordered by name
+	sboxctlInstances []*sboxctlInstance
+
+	// elector decides whether this agent is active when paired with a standby
+	elector *standby.Elector
+
+	// notifier sends selected agent events to operators
+	notifier *notify.Notifier
+
+	// aggregator keeps recent agent log messages when logging.aggregation is on
+	aggregator *aggregator.MemoryAggregator
+
+	// dispatcher hands sboxctl events to their handlers
+	dispatcher *dispatcher.Dispatcher
+
+	// events counts forwarded sboxctl events for the metrics snapshot
+	events eventRate
+
+	// labels identify this agent's metrics, logs and events
+	labels telemetry.Labels
+
 	// State
-	mu       sync.RWMutex
-	running  bool
+	mu        sync.RWMutex
+	state     State
 	startTime time.Time
-	
+
+	// lastShutdown reports how services stopped on the last shutdown
+	lastShutdown *ShutdownReport
+
+	// configAudit records config keys changed at runtime
+	configAudit []ConfigAuditEntry
+
+	// clientsStop is set while managed clients are stopped on demand
+	clientsStop *ClientsStop
+
+	// clientVersions are the detected versions of the client binaries
+	clientVersions map[string]ClientVersion
+
+	// clientProbes are the last liveness probes of the clients
+	clientProbes map[string]ClientProbe
+	// connectivity keeps the last end-to-end probes through the clients
+	connectivity *connectivityWindow
+	// securityModules is the last SELinux and AppArmor check
+	securityModules lsm.Status
+	// unitDrift are the drifted units of the last check, nil until checked
+	unitDrift []UnitDrift
+	// startupBlocked are the steps held back at startup with the reason
+	startupBlocked map[string]string
+	// fallbacks are the clients that fell back to their previous config
+	// since their last applied config
+	fallbacks map[string]bool
+	// certificateAlerts are the alerted expiry statuses by certificate path
+	certificateAlerts map[string]health.HealthStatus
+
+	// upgrader installs client releases; upgradeMu serializes upgrades
+	upgrader  *upgrade.Upgrader
+	upgradeMu sync.Mutex
+
+	// configMu serializes changes of the running config, from reading the
+	// current one to persisting and storing the update
+	configMu sync.Mutex
+
+	// units manages the client unit once connected; unitState is its last
+	// state reported by the init system
+	unitsMu   sync.Mutex
+	units     initsys.Manager
+	unitState *initsys.UnitState
+	// clientUnits controls the units of the enabled clients
+	clientUnits *ClientUnitManager
+	// supervisor runs the clients as children of the agent where no
+	// service manager does
+	supervisor *supervisor.Supervisor
+
+	// leases are held by external tools writing client configs
+	leases configLeases
+
+	// commands bounds concurrently running helper commands and sboxmgr
+	commands *process.Pool
+	// runs records recent sboxctl and sboxmgr runs
+	runs *process.History
+
+	// clientLogs tracks the client journal entries read
+	clientLogs clientLogs
+
+	// health runs the health checks, pinging the systemd watchdog when the
+	// unit has one
+	health *health.HealthChecker
+
+	// audit records spawned commands and socket commands while running
+	audit *auditLog
+
+	// Users sboxctl and sboxmgr run as; nil keeps the agent's
+	sboxctlUser *process.Credential
+	cliUser     *process.Credential
+
+	// detector finds the network for location based profile switching;
+	// network is the last one detected
+	detector *netloc.Detector
+	network  *netloc.Network
+
 	// Context for graceful shutdown
 	ctx    context.Context
 	cancel context.CancelFunc
+	wg     sync.WaitGroup
 }
 
 // New creates a new agent instance
@@ -41,6 +167,31 @@ func New(cfg *config.Config) (*Agent, error) {
 	agent := &Agent{
 		config: cfg,
 		logger: log,
+		state:  StateStopped,
+		labels: telemetry.New(cfg.Agent.Name, cfg.Agent.Profile, cfg.Import.ClientType),
+	}
+	if cli := cfg.Services.CLI; cli.MaxConcurrent > 0 {
+		agent.commands = process.NewPool(cli.MaxConcurrent, cli.QueueTimeout)
+	}
+	if cfg.Services.RunHistory > 0 {
+		agent.runs = process.NewHistory(cfg.Services.RunHistory)
+	}
+	if supervised(cfg.Services.Supervisor) {
+		agent.supervisor = newSupervisor(cfg, log)
+	}
+	if cfg.Services.Systemd.Enabled || agent.supervisor != nil {
+		agent.clientUnits = newClientUnitManager(agent)
+	}
+	if connectivity := cfg.Services.Monitoring.Connectivity; connectivity.Enabled {
+		agent.connectivity = newConnectivityWindow(connectivity.URL, connectivity.Window)
+	}
+	log.SetFields(agent.labels.Fields())
+
+	// Capture the agent's own log messages
+	if cfg.Logging.Aggregation {
+		retention := time.Duration(cfg.Logging.RetentionDays) * 24 * time.Hour
+		agent.aggregator = aggregator.NewMemoryAggregator(log, cfg.Logging.MaxEntries, retention)
+		log.AddHook(agent.aggregator.LoggerHook("agent"))
 	}
 
 	// Initialize services
@@ -61,16 +212,125 @@ func (a *Agent) initializeServices() error {
 		}
 		a.sboxctlService = sboxctlService
 	}
+	if err := a.initializeSboxctlInstances(); err != nil {
+		return err
+	}
+	if a.sboxctlService != nil || len(a.sboxctlInstances) > 0 {
+		// Log events of sboxctl are kept with the agent's own logs
+		a.dispatcher = dispatcher.NewDispatcher(a.logger, a.config.Services.Dispatcher.BufferSize)
+		if a.aggregator != nil {
+			if err := a.dispatcher.RegisterHandler(dispatcher.NewAggregatorHandler(a.aggregator)); err != nil {
+				return fmt.Errorf("failed to register aggregator handler: %w", err)
+			}
+		}
+	}
+
+	acl, err := a.accessList()
+	if err != nil {
+		return fmt.Errorf("failed to create access list: %w", err)
+	}
+	a.acl = acl
+
+	// Initialize HTTP API server if enabled
+	if a.config.Server.Enabled {
+		apiServer, err := api.NewServer(a.config.Server, a.logger)
+		if err != nil {
+			return fmt.Errorf("failed to create api server: %w", err)
+		}
+		auth, err := api.NewAuthenticatorFromConfig(a.config.Security, a.logger)
+		if err != nil {
+			return fmt.Errorf("failed to create api authenticator: %w", err)
+		}
+		apiServer.SetAuthenticator(auth)
+		apiServer.SetAccessList(a.acl)
+		apiServer.GetMetrics().SetLabels(a.labels.With(telemetry.LabelService, "api"))
+		apiServer.GetMetrics().AddCollector(a.writeQueueMetrics)
+		apiServer.GetMetrics().AddCollector(a.writeConnectivityMetrics)
+		apiServer.HandleFunc("GET /clients/{client}/config", a.handleClientConfig)
+		apiServer.HandleFunc("POST /update", a.handleTriggerUpdate)
+		a.apiServer = apiServer
+	}
+
+	// Initialize management tunnel if enabled
+	if a.apiServer != nil && a.config.Server.Tunnel.Enabled {
+		tunnelConfig := a.config.Server.Tunnel
+		if tunnelConfig.AgentID == "" {
+			tunnelConfig.AgentID = a.config.Agent.Name
+		}
+		tunnelClient, err := tunnel.NewClient(tunnelConfig, a.apiServer.Handler(), a.logger)
+		if err != nil {
+			return fmt.Errorf("failed to create management tunnel: %w", err)
+		}
+		a.tunnelClient = tunnelClient
+	}
+
+	// Initialize remote config source if enabled
+	if a.config.Remote.Enabled {
+		remoteSource, err := config.NewRemoteSource(a.config.Remote)
+		if err != nil {
+			return fmt.Errorf("failed to create remote config source: %w", err)
+		}
+		a.remoteSource = remoteSource
+	}
+
+	// Initialize client upgrades if enabled
+	if a.config.Clients.Upgrade.Enabled {
+		upgrader, err := a.newUpgrader()
+		if err != nil {
+			return fmt.Errorf("failed to create client upgrader: %w", err)
+		}
+		a.upgrader = upgrader
+	}
+
+	// Initialize scheduled import if enabled
+	if a.config.Import.Enabled {
+		for _, client := range append([]string{a.config.Import.ClientType}, a.config.Import.Clients...) {
+			if len(a.config.Import.Sources) > 0 && !importer.CanMerge(client) {
+				return fmt.Errorf("import sources cannot be merged for %s", client)
+			}
+		}
+		a.importer = importer.NewImporter(a.config.Import, a.logger)
+	}
+	if err := a.lookupSubprocessUsers(); err != nil {
+		return err
+	}
+	a.configureSubprocesses()
+
+	// Initialize standby pairing if enabled
+	a.elector = a.newElector()
+
+	// Initialize network location detection if enabled
+	if a.config.Location.Enabled {
+		a.detector = netloc.NewDetector()
+	}
+
+	// Initialize notifications if enabled
+	if a.config.Notifications.Enabled {
+		notifier, err := notify.New(a.config.Notifications, a.logger)
+		if err != nil {
+			return fmt.Errorf("failed to create notifier: %w", err)
+		}
+		a.notifier = notifier
+	}
 
 	return nil
 }
 
-// Start starts the agent
+// accessList builds the remote access list. Only loopback clients are
+// allowed unless the remote API is enabled.
+func (a *Agent) accessList() (*security.AccessList, error) {
+	allowed := a.config.Security.AllowedHosts
+	if !a.config.Security.AllowRemoteAPI {
+		allowed = security.LoopbackNetworks
+	}
+	return security.NewAccessList(allowed, a.config.Security.DeniedHosts)
+}
+
+// Start starts the agent and blocks until ctx is cancelled or Stop is called
 func (a *Agent) Start(ctx context.Context) error {
 	a.mu.Lock()
-	defer a.mu.Unlock()
-
-	if a.running {
+	if a.state != StateStopped {
+		a.mu.Unlock()
 		return fmt.Errorf("agent is already running")
 	}
 
@@ -78,27 +338,54 @@ func (a *Agent) Start(ctx context.Context) error {
 	a.ctx, a.cancel = context.WithCancel(ctx)
 	defer a.cancel()
 
-	a.running = true
 	a.startTime = time.Now()
+	a.mu.Unlock()
+	a.transition(StateInitializing, "agent starting")
 
+	cfg := a.GetConfig()
 	a.logger.Info("Agent starting", map[string]interface{}{
-		"name":    a.config.Agent.Name,
-		"version": a.config.Agent.Version,
+		"name":    cfg.Agent.Name,
+		"version": cfg.Agent.Version,
 	})
 
+	// Audit everything the services run from the start
+	if err := a.openAudit(); err != nil {
+		a.transition(StateStopping, "failed to open audit log")
+		a.transition(StateStopped, "")
+		return err
+	}
+	defer a.closeAudit()
+
 	// Start services
 	if err := a.startServices(); err != nil {
-		a.running = false
+		a.transition(StateStopping, "failed to start services")
+		a.transition(StateStopped, "")
 		return fmt.Errorf("failed to start services: %w", err)
 	}
+	a.warnSecurityModules()
+	if err := a.dropPrivileges(); err != nil {
+		a.transition(StateStopping, "failed to drop privileges")
+		a.stopServices()
+		a.transition(StateStopped, "")
+		return err
+	}
+
+	// Without sboxctl there is nothing to sync
+	if a.State() == StateInitializing {
+		a.transition(StateReady, "services started")
+	}
+	// systemd considers the agent started once all services are, even if
+	// the first sync is still running
+	a.notifyStatus(a.State(), sdnotify.Ready)
 
 	// Wait for context cancellation
 	<-a.ctx.Done()
 
 	// Stop services
+	a.transition(StateStopping, "shutdown requested")
 	a.stopServices()
 
-	a.running = false
+	a.transition(StateStopped, "")
 	a.logger.Info("Agent stopped", map[string]interface{}{})
 
 	return nil
@@ -106,24 +393,270 @@ func (a *Agent) Start(ctx context.Context) error {
 
 // startServices starts all enabled services
 func (a *Agent) startServices() error {
-	// Start sboxctl service
+	cfg := a.GetConfig()
+	// goroutine returns a step running loop in the background
+	goroutine := func(loop func()) func() error {
+		return func() error {
+			a.wg.Add(1)
+			go loop()
+			return nil
+		}
+	}
+	// when returns start if the step is enabled
+	when := func(enabled bool, start func() error) func() error {
+		if !enabled {
+			return nil
+		}
+		return start
+	}
+
+	steps := []startStep{
+		// Run the health checks from the start, keeping systemd's watchdog
+		// fed; the same reports back the API's /readyz
+		{name: "health", start: func() error {
+			if err := a.startHealth(); err != nil {
+				return fmt.Errorf("failed to start health checks: %w", err)
+			}
+			return nil
+		}},
+		// Deliver notifications, including those spooled before a restart
+		{name: "notifier", start: when(a.notifier != nil, goroutine(func() {
+			defer a.wg.Done()
+			a.notifier.Run(a.ctx)
+		}))},
+		// Start handling sboxctl events before sboxctl produces any
+		{name: "dispatcher", start: when(a.dispatcher != nil, func() error {
+			if err := a.dispatcher.Start(a.ctx); err != nil {
+				return fmt.Errorf("failed to start event dispatcher: %w", err)
+			}
+			if a.sboxctlService != nil {
+				a.wg.Add(1)
+				go a.forwardEvents("", a.sboxctlService.GetEventChannel())
+			}
+			for _, instance := range a.sboxctlInstances {
+				a.wg.Add(1)
+				go a.forwardEvents(instance.name, instance.service.GetEventChannel())
+			}
+			return nil
+		})},
+		// Read client logs once the dispatcher takes events
+		{name: "journal", start: func() error {
+			a.startJournal()
+			return nil
+		}},
+		// Start sboxctl service; a standby pair starts it on the active agent only
+		{name: "sboxctl", start: a.startSboxctl},
+		{name: "api", start: when(a.apiServer != nil, func() error {
+			if err := a.apiServer.Start(a.ctx); err != nil {
+				return fmt.Errorf("failed to start api server: %w", err)
+			}
+			return nil
+		})},
+		{name: "tunnel", start: when(a.tunnelClient != nil, func() error {
+			if err := a.tunnelClient.Start(a.ctx); err != nil {
+				return fmt.Errorf("failed to start management tunnel: %w", err)
+			}
+			return nil
+		})},
+		// Detect the client versions imported configs are checked against
+		{name: "version-check", start: when(cfg.Clients.VersionCheck.Enabled, goroutine(a.watchClientVersions))},
+		// Upgrade the clients on schedule
+		{name: "upgrades", start: when(a.upgrader != nil && cfg.Clients.Upgrade.Schedule > 0, goroutine(a.pollUpgrades))},
+		// Compare the installed units with the generated ones
+		{name: "unit-drift", start: when(cfg.Services.Systemd.Drift.Enabled, goroutine(a.watchUnitDrift))},
+		// Switch profiles as the host moves between networks
+		{name: "location", start: when(a.detector != nil, goroutine(a.watchLocation))},
+		// Publish heartbeats to socket clients
+		{name: "heartbeat", start: when(a.socketServer != nil && cfg.Agent.HeartbeatInterval > 0, goroutine(func() {
+			a.sendHeartbeats(cfg.Agent.HeartbeatInterval)
+		}))},
+		// Reap orphaned descendants of child processes, and zombies left to
+		// the agent running as a container's init
+		{name: "reaper", start: when(cfg.Agent.ReapOrphans || a.supervisor != nil, func() error {
+			if err := process.EnableSubreaper(); err != nil {
+				a.logger.Warn("Failed to become child subreaper", map[string]interface{}{
+					"error": err.Error(),
+				})
+			}
+			a.wg.Add(1)
+			go func() {
+				defer a.wg.Done()
+				process.RunReaper(a.ctx, reapInterval, a.logReapedOrphan)
+			}()
+			return nil
+		})},
+		// Start remote config polling
+		{name: "remote-config", start: when(a.remoteSource != nil, goroutine(a.pollRemoteConfig))},
+		// Clients and imports wait for the network, and clients for their
+		// configs to pass the clients' checkers
+		{name: "network-online", gate: true, start: when(a.supervisor != nil || a.importer != nil, a.waitNetworkOnline)},
+		{name: "configs-validated", gate: true, start: when(a.supervisor != nil && cfg.Import.CheckConfig, a.validateClientConfigs)},
+		// Run the clients where no service manager does
+		{name: "clients", start: when(a.supervisor != nil, func() error {
+			a.startSupervisor()
+			return nil
+		})},
+		// Follow the client unit's state
+		{name: "unit-watch", start: when(cfg.Services.Systemd.Enabled || a.supervisor != nil, goroutine(a.watchUnit))},
+		// Probe that the clients run and listen
+		{name: "probes", start: when(cfg.Services.Monitoring.Enabled, goroutine(a.watchClientProbes))},
+		// Probe connectivity through the clients end to end
+		{name: "connectivity", start: when(a.connectivity != nil, goroutine(a.watchConnectivity))},
+		// Start scheduled imports once sboxmgr is known to be supported
+		{name: "imports", start: when(a.importer != nil, func() error {
+			if err := a.probeSboxmgr(); err != nil {
+				return err
+			}
+			a.wg.Add(1)
+			go a.pollImports()
+			return nil
+		})},
+	}
+
+	blocked, err := a.runStartup(steps)
+	a.mu.Lock()
+	a.startupBlocked = blocked
+	a.mu.Unlock()
+	return err
+}
+
+// startSboxctl starts the sboxctl service and instances, or the standby
+// election that starts them on the active agent
+func (a *Agent) startSboxctl() error {
+	if a.elector != nil {
+		if err := a.startStandby(); err != nil {
+			return fmt.Errorf("failed to start sboxctl service: %w", err)
+		}
+		return nil
+	}
 	if a.sboxctlService != nil {
+		a.transition(StateSyncing, "waiting for first sboxctl run")
 		if err := a.sboxctlService.Start(a.ctx); err != nil {
 			return fmt.Errorf("failed to start sboxctl service: %w", err)
 		}
 		a.logger.Info("Sboxctl service started", map[string]interface{}{})
 	}
-
-	return nil
+	return a.startSboxctlInstances()
 }
 
-// stopServices stops all running services
+// stopServices stops all running services, each within its stop deadline
 func (a *Agent) stopServices() {
-	// Stop sboxctl service
+	cfg := a.GetConfig()
+	var steps []stopStep
+
+	// Background loops exit on context cancellation
+	steps = append(steps, stopStep{name: "background", stop: a.wg.Wait})
+
+	if a.health != nil {
+		steps = append(steps, stopStep{name: "health", stop: a.health.Stop})
+	}
+
+	if a.tunnelClient != nil {
+		steps = append(steps, stopStep{name: "tunnel", stop: a.tunnelClient.Stop})
+	}
+
+	if a.apiServer != nil {
+		steps = append(steps, stopStep{name: "api", stop: a.apiServer.Stop})
+	}
+
 	if a.sboxctlService != nil {
-		a.sboxctlService.Stop()
-		a.logger.Info("Sboxctl service stopped", map[string]interface{}{})
+		steps = append(steps, stopStep{
+			name:  "sboxctl",
+			stop:  a.sboxctlService.Stop,
+			force: a.sboxctlService.Kill,
+		})
+	}
+	for _, instance := range a.sboxctlInstances {
+		steps = append(steps, stopStep{
+			name:  sboxctlName(instance.name),
+			stop:  instance.service.Stop,
+			force: instance.service.Kill,
+		})
+	}
+
+	if a.importer != nil {
+		steps = append(steps, stopStep{name: "sboxmgr", stop: a.importer.Close})
 	}
+
+	if a.dispatcher != nil {
+		steps = append(steps, stopStep{name: "dispatcher", stop: a.dispatcher.Stop})
+	}
+
+	if a.supervisor != nil {
+		steps = append(steps, stopStep{
+			name:  "supervisor",
+			stop:  a.supervisor.StopAll,
+			force: a.supervisor.Kill,
+		})
+	}
+
+	if cfg.Services.Systemd.Enabled {
+		steps = append(steps, stopStep{name: "systemd", stop: a.closeUnits})
+	}
+
+	report := a.runStopSteps(steps)
+
+	a.mu.Lock()
+	a.lastShutdown = report
+	a.mu.Unlock()
+}
+
+// logReapedOrphan logs an orphaned process reaped by the agent
+func (a *Agent) logReapedOrphan(pid int, status syscall.WaitStatus) {
+	a.logger.Debug("Reaped orphaned process", map[string]interface{}{
+		"pid":      pid,
+		"exitCode": status.ExitStatus(),
+	})
+}
+
+// pollRemoteConfig periodically fetches the remote config and caches new
+// verified versions. Cached changes are applied on the next start.
+func (a *Agent) pollRemoteConfig() {
+	defer a.wg.Done()
+
+	ticker := time.NewTicker(a.remoteSource.PollInterval())
+	defer ticker.Stop()
+
+	for {
+		a.fetchRemoteConfig()
+
+		select {
+		case <-a.ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// fetchRemoteConfig performs a single remote config fetch
+func (a *Agent) fetchRemoteConfig() {
+	doc, err := a.remoteSource.Fetch(a.ctx)
+	if err != nil {
+		if a.ctx.Err() == nil {
+			a.logger.Warn("Failed to fetch remote configuration", map[string]interface{}{
+				"url":   a.GetConfig().Remote.URL,
+				"error": err.Error(),
+			})
+		}
+		return
+	}
+	if doc == nil {
+		a.logger.Debug("Remote configuration not modified", map[string]interface{}{})
+		return
+	}
+
+	if err := a.remoteSource.SaveCache(doc); err != nil {
+		a.logger.Error("Failed to cache remote configuration", map[string]interface{}{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	a.logger.Info("Remote configuration updated, restart to apply", map[string]interface{}{
+		"url":   a.GetConfig().Remote.URL,
+		"etag":  doc.ETag,
+		"bytes": len(doc.Data),
+	})
 }
 
 // Stop stops the agent gracefully
@@ -131,7 +664,7 @@ func (a *Agent) Stop() {
 	a.mu.Lock()
 	defer a.mu.Unlock()
 
-	if !a.running {
+	if a.state == StateStopped || a.state == StateStopping {
 		return
 	}
 
@@ -143,7 +676,7 @@ func (a *Agent) Stop() {
 func (a *Agent) IsRunning() bool {
 	a.mu.RLock()
 	defer a.mu.RUnlock()
-	return a.running
+	return a.state != StateStopped
 }
 
 // GetStatus returns the current agent status
@@ -152,7 +685,8 @@ func (a *Agent) GetStatus() map[string]interface{} {
 	defer a.mu.RUnlock()
 
 	status := map[string]interface{}{
-		"running":   a.running,
+		"running":   a.state != StateStopped,
+		"state":     a.state,
 		"startTime": a.startTime,
 		"uptime":    time.Since(a.startTime).String(),
 	}
@@ -160,11 +694,123 @@ func (a *Agent) GetStatus() map[string]interface{} {
 	if a.sboxctlService != nil {
 		status["sboxctl"] = a.sboxctlService.GetStatus()
 	}
+	if len(a.sboxctlInstances) > 0 {
+		status["sboxctl_instances"] = a.instancesStatus()
+	}
+
+	if a.tunnelClient != nil {
+		status["tunnel"] = a.tunnelClient.GetStatus()
+	}
+
+	if a.elector != nil {
+		status["standby"] = a.standbyStatus()
+	}
+
+	if a.clientsStop != nil {
+		status["clients_stopped"] = a.clientsStop
+	}
+
+	if a.unitState != nil {
+		status["client_unit"] = a.unitState
+	}
+	if a.clientUnits != nil {
+		if units := a.clientUnits.Status(); len(units) > 0 {
+			status["client_units"] = units
+		}
+	}
+	if a.supervisor != nil {
+		status["supervisor"] = a.supervisor.Status()
+	}
+	if len(a.clientVersions) > 0 {
+		versions := make(map[string]ClientVersion, len(a.clientVersions))
+		for client, version := range a.clientVersions {
+			versions[client] = version
+		}
+		status["client_versions"] = versions
+	}
+
+	if len(a.clientProbes) > 0 {
+		probes := make(map[string]ClientProbe, len(a.clientProbes))
+		for client, probe := range a.clientProbes {
+			probes[client] = probe
+		}
+		status["client_probes"] = probes
+	}
+	if stats, ok := a.Connectivity(); ok {
+		status["connectivity"] = stats
+	}
+	if len(a.startupBlocked) > 0 {
+		blocked := make(map[string]string, len(a.startupBlocked))
+		for step, reason := range a.startupBlocked {
+			blocked[step] = reason
+		}
+		status["startup_blocked"] = blocked
+	}
+	if a.unitDrift != nil {
+		status["unit_drift"] = append([]UnitDrift{}, a.unitDrift...)
+	}
+	if a.securityModules.Active() {
+		status["security_modules"] = a.securityModules
+	}
+	if privileges, ok := a.privilegeStatus(); ok {
+		status["privileges"] = privileges
+	}
+
+	if a.detector != nil {
+		status["location"] = a.locationStatus()
+	}
+
+	if a.notifier != nil {
+		if pending, err := a.notifier.Pending(); err == nil {
+			status["notifications"] = map[string]interface{}{"pending": pending}
+		}
+	}
+
+	if a.commands != nil {
+		status["commands"] = a.commands.Stats()
+	}
+
+	if a.health != nil {
+		status["health"] = a.health.GetStatus()
+	}
+
+	if a.config.Logging.Journal.Enabled {
+		if logs := a.clientLogs.snapshot(); len(logs) > 0 {
+			status["client_logs"] = logs
+		}
+	}
+
+	if runs := a.runsStatus(); len(runs) > 0 {
+		status["runs"] = runs
+	}
+
+	if a.importer != nil {
+		if version, ok := a.importer.SboxmgrVersion(); ok {
+			status["sboxmgr"] = map[string]interface{}{"version": version.String()}
+		}
+	}
+
+	status["metrics"] = a.metricsSnapshot(a.state)
 
 	return status
 }
 
+// GetShutdownReport returns the report of the last shutdown, or nil if the
+// agent has not stopped yet
+func (a *Agent) GetShutdownReport() *ShutdownReport {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	return a.lastShutdown
+}
+
+// GetAPIServer returns the HTTP API server, or nil if it is disabled
+func (a *Agent) GetAPIServer() *api.Server {
+	return a.apiServer
+}
+
 // GetConfig returns the current configuration
 func (a *Agent) GetConfig() *config.Config {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
 	return a.config
-} 
\ No newline at end of file
+}
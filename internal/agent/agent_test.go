@@ -28,8 +28,8 @@ func TestNew(t *testing.T) {
 					Sboxctl: config.SboxctlConfig{
 						Enabled: true,
 						Command: []string{"echo", "test"},
-						Interval: "1m",
-						Timeout: "30s",
+						Interval: time.Minute,
+						Timeout: 30 * time.Second,
 					},
 				},
 			},
@@ -78,6 +78,22 @@ func TestNew(t *testing.T) {
 			},
 			wantErr: false,
 		},
+		{
+			name: "unknown sboxmgr user",
+			cfg: &config.Config{
+				Agent: config.AgentConfig{
+					Name:    "test-agent",
+					Version: "1.0.0",
+					LogLevel: "info",
+				},
+				Services: config.ServicesConfig{
+					CLI: config.CLIConfig{
+						SubprocessConfig: config.SubprocessConfig{User: "sboxagent-no-such-user"},
+					},
+				},
+			},
+			wantErr: true,
+		},
 	}
 
 	for _, tt := range tests {
@@ -195,12 +211,18 @@ func TestAgent_GetStatus(t *testing.T) {
 	ctx, cancel := context.WithTimeout(context.Background(), 1*time.Second)
 	defer cancel()
 
+	done := make(chan struct{})
 	go func() {
 		agent.Start(ctx)
+		close(done)
 	}()
 
-	// Give time for agent to start and then stop
-	time.Sleep(1 * time.Second)
+	// Wait for agent to start and then stop
+	select {
+	case <-done:
+	case <-time.After(3 * time.Second):
+		t.Fatal("agent did not stop after context timeout")
+	}
 
 	// Get status after stopping
 	status = agent.GetStatus()
@@ -255,12 +277,18 @@ func TestAgent_IsRunning(t *testing.T) {
 	ctx, cancel := context.WithTimeout(context.Background(), 1*time.Second)
 	defer cancel()
 
+	done := make(chan struct{})
 	go func() {
 		agent.Start(ctx)
+		close(done)
 	}()
 
-	// Give time for agent to start and then stop
-	time.Sleep(1 * time.Second)
+	// Wait for agent to start and then stop
+	select {
+	case <-done:
+	case <-time.After(3 * time.Second):
+		t.Fatal("agent did not stop after context timeout")
+	}
 
 	// After stopping, should not be running
 	assert.False(t, agent.IsRunning())
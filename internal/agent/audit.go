@@ -0,0 +1,184 @@
+package agent
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/kpblcaoo/sboxagent/internal/aggregator"
+	"github.com/kpblcaoo/sboxagent/internal/config"
+	"github.com/kpblcaoo/sboxagent/internal/process"
+)
+
+// maskedParam replaces credentials in audited command parameters
+const maskedParam = "********"
+
+// AuditEntry is one entry of the audit log: an external command the agent
+// ran (kind "exec") or a command received over the socket (kind "admin")
+type AuditEntry struct {
+	Time time.Time `json:"time"`
+	Kind string    `json:"kind"`
+	// Exec is set for spawned commands
+	Exec *process.Execution `json:"exec,omitempty"`
+	// Peer, Command and Params are set for socket commands
+	Peer    string                 `json:"peer,omitempty"`
+	Command string                 `json:"command,omitempty"`
+	Params  map[string]interface{} `json:"params,omitempty"`
+	Error   string                 `json:"error,omitempty"`
+}
+
+// auditLog appends audit entries to a file and the log aggregator
+type auditLog struct {
+	mu         sync.Mutex
+	file       *os.File
+	aggregator *aggregator.MemoryAggregator
+}
+
+// openAudit starts the audit log if enabled. The file is opened for
+// appending only and readable by its owner.
+func (a *Agent) openAudit() error {
+	cfg := a.GetConfig().Logging.Audit
+	if !cfg.Enabled {
+		return nil
+	}
+
+	audit := &auditLog{aggregator: a.aggregator}
+	if cfg.File != "" {
+		if err := os.MkdirAll(filepath.Dir(cfg.File), 0750); err != nil {
+			return fmt.Errorf("failed to create audit log directory: %w", err)
+		}
+		file, err := os.OpenFile(cfg.File, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+		if err != nil {
+			return fmt.Errorf("failed to open audit log: %w", err)
+		}
+		audit.file = file
+	}
+
+	a.mu.Lock()
+	a.audit = audit
+	a.mu.Unlock()
+	process.SetAuditHook(a.auditExec)
+	return nil
+}
+
+// closeAudit stops auditing and closes the audit file
+func (a *Agent) closeAudit() {
+	a.mu.Lock()
+	audit := a.audit
+	a.audit = nil
+	a.mu.Unlock()
+	if audit == nil {
+		return
+	}
+
+	process.SetAuditHook(nil)
+	audit.mu.Lock()
+	defer audit.mu.Unlock()
+	if audit.file != nil {
+		audit.file.Close()
+		audit.file = nil
+	}
+}
+
+// auditExec records a command the agent spawned
+func (a *Agent) auditExec(execution process.Execution) {
+	a.writeAudit(AuditEntry{
+		Time:  time.Now(),
+		Kind:  "exec",
+		Exec:  &execution,
+		Error: execution.Error,
+	})
+}
+
+// auditCommand records a command received over the socket
+func (a *Agent) auditCommand(peer, command string, params map[string]interface{}, err error) {
+	entry := AuditEntry{
+		Time:    time.Now(),
+		Kind:    "admin",
+		Peer:    peer,
+		Command: command,
+		Params:  maskParams(params),
+	}
+	if err != nil {
+		entry.Error = err.Error()
+	}
+	a.writeAudit(entry)
+}
+
+// writeAudit appends an entry to the audit file and aggregator. A write
+// failure is logged and does not stop the agent.
+func (a *Agent) writeAudit(entry AuditEntry) {
+	a.mu.RLock()
+	audit := a.audit
+	a.mu.RUnlock()
+	if audit == nil {
+		return
+	}
+
+	audit.mu.Lock()
+	defer audit.mu.Unlock()
+	if audit.file != nil {
+		line, err := json.Marshal(entry)
+		if err == nil {
+			_, err = audit.file.Write(append(line, '\n'))
+		}
+		if err != nil {
+			a.logger.Error("Failed to write audit log", map[string]interface{}{
+				"error": err.Error(),
+			})
+		}
+	}
+	if audit.aggregator != nil {
+		audit.aggregator.Add(auditLogEntry(entry))
+	}
+}
+
+// auditLogEntry converts an audit entry for the log aggregator
+func auditLogEntry(entry AuditEntry) aggregator.LogEntry {
+	level := aggregator.LogLevelInfo
+	if entry.Error != "" {
+		level = aggregator.LogLevelWarn
+	}
+	log := aggregator.LogEntry{
+		Timestamp: entry.Time,
+		Level:     level,
+		Source:    "audit",
+		Metadata:  map[string]interface{}{"kind": entry.Kind},
+	}
+	if entry.Exec != nil {
+		log.Message = "exec " + strings.Join(entry.Exec.Args, " ")
+		log.Metadata["uid"] = entry.Exec.UID
+		log.Metadata["gid"] = entry.Exec.GID
+		log.Metadata["duration"] = entry.Exec.Duration
+		log.Metadata["exitCode"] = entry.Exec.ExitCode
+	} else {
+		log.Message = "admin " + entry.Command
+		log.Metadata["peer"] = entry.Peer
+		log.Metadata["params"] = entry.Params
+	}
+	if entry.Error != "" {
+		log.Metadata["error"] = entry.Error
+	}
+	return log
+}
+
+// maskParams copies command parameters, masking credentials: parameters
+// named like one and the value set for a sensitive config key
+func maskParams(params map[string]interface{}) map[string]interface{} {
+	if len(params) == 0 {
+		return nil
+	}
+	key, _ := params["key"].(string)
+	masked := make(map[string]interface{}, len(params))
+	for name, value := range params {
+		if config.IsSensitiveKey(name) || (name == "value" && config.IsSensitiveKey(key)) {
+			value = maskedParam
+		}
+		masked[name] = value
+	}
+	return masked
+}
@@ -0,0 +1,74 @@
+package agent
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/kpblcaoo/sboxagent/internal/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAgent_AuditLog(t *testing.T) {
+	auditFile := filepath.Join(t.TempDir(), "audit", "audit.log")
+	agent, err := New(&config.Config{
+		Agent: config.AgentConfig{Name: "audit-test", LogLevel: "error"},
+		Logging: config.LoggingConfig{
+			Aggregation: true,
+			MaxEntries:  100,
+			Audit:       config.AuditConfig{Enabled: true, File: auditFile},
+		},
+	})
+	require.NoError(t, err)
+
+	require.NoError(t, agent.openAudit())
+	require.Error(t, agent.runCommand(context.Background(), 5*time.Second, []string{"sh", "-c", "exit 3"}))
+	agent.auditCommand("unix", "config_set", map[string]interface{}{"key": "security.api_token", "value": "hunter2"}, nil)
+	agent.auditCommand("unix", "restore_backup", map[string]interface{}{}, errors.New("name is required"))
+	agent.closeAudit()
+
+	// Nothing is recorded once closed
+	require.NoError(t, agent.runCommand(context.Background(), 5*time.Second, []string{"true"}))
+
+	info, err := os.Stat(auditFile)
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0600), info.Mode().Perm())
+
+	file, err := os.Open(auditFile)
+	require.NoError(t, err)
+	defer file.Close()
+	var entries []AuditEntry
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		var entry AuditEntry
+		require.NoError(t, json.Unmarshal(scanner.Bytes(), &entry))
+		entries = append(entries, entry)
+	}
+	require.Len(t, entries, 3)
+
+	assert.Equal(t, "exec", entries[0].Kind)
+	assert.Equal(t, []string{"sh", "-c", "exit 3"}, entries[0].Exec.Args)
+	assert.Equal(t, 3, entries[0].Exec.ExitCode)
+	assert.Equal(t, os.Getuid(), entries[0].Exec.UID)
+
+	assert.Equal(t, "admin", entries[1].Kind)
+	assert.Equal(t, "config_set", entries[1].Command)
+	assert.Equal(t, maskedParam, entries[1].Params["value"])
+	assert.Equal(t, "name is required", entries[2].Error)
+
+	logs, err := agent.GetLogs(10, "")
+	require.NoError(t, err)
+	audited := 0
+	for _, entry := range logs {
+		if entry.Source == "audit" {
+			audited++
+		}
+	}
+	assert.Equal(t, 3, audited)
+}
@@ -0,0 +1,197 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/kpblcaoo/sboxagent/internal/config"
+	"github.com/kpblcaoo/sboxagent/internal/health"
+)
+
+// certificateCheck checks the expiry of the certificates in use and alerts
+// when one crosses the warning or critical threshold
+type certificateCheck struct {
+	agent *Agent
+	check *health.CertificateCheck
+}
+
+func newCertificateCheck(a *Agent) certificateCheck {
+	cfg := a.GetConfig().Health.Certificates
+	return certificateCheck{
+		agent: a,
+		check: health.NewCertificateCheck("certificates", a.certificatePaths, cfg.Warning, cfg.Critical),
+	}
+}
+
+func (c certificateCheck) Name() string {
+	return c.check.Name()
+}
+
+func (c certificateCheck) Check(ctx context.Context) health.ComponentHealth {
+	result := c.check.Check(ctx)
+	certificates, _ := result.Data["certificates"].([]health.CertificateExpiry)
+	c.agent.alertCertificates(certificates)
+	return result
+}
+
+// alertCertificates publishes CERTIFICATE_EXPIRING once per certificate
+// and threshold crossed. A renewed certificate is alerted again when it
+// nears its new expiry.
+func (a *Agent) alertCertificates(certificates []health.CertificateExpiry) {
+	for _, cert := range certificates {
+		a.mu.Lock()
+		previous := a.certificateAlerts[cert.Path]
+		if cert.Status == health.HealthStatusHealthy {
+			delete(a.certificateAlerts, cert.Path)
+		} else if cert.Status != previous {
+			if a.certificateAlerts == nil {
+				a.certificateAlerts = make(map[string]health.HealthStatus)
+			}
+			a.certificateAlerts[cert.Path] = cert.Status
+		}
+		a.mu.Unlock()
+		if cert.Status == health.HealthStatusHealthy || cert.Status == previous {
+			continue
+		}
+
+		severity := "warning"
+		if cert.Status == health.HealthStatusUnhealthy {
+			severity = "critical"
+		}
+		a.logger.Warn("Certificate expiring", map[string]interface{}{
+			"path":     cert.Path,
+			"subject":  cert.Subject,
+			"notAfter": cert.NotAfter,
+			"daysLeft": cert.DaysLeft,
+		})
+		a.publishEvent("CERTIFICATE_EXPIRING", map[string]interface{}{
+			"severity":    severity,
+			"certificate": cert,
+		})
+	}
+}
+
+// certificatePaths returns the certificates to check: the API's when TLS
+// is enabled, those referenced by the enabled clients' configs and the
+// configured extra paths
+func (a *Agent) certificatePaths() []string {
+	cfg := a.GetConfig()
+	var candidates []string
+	if cfg.Security.TLSEnabled {
+		candidates = append(candidates, cfg.Security.TLSCertFile)
+	}
+	for _, name := range config.ClientNames {
+		if !cfg.Clients.Enabled(name) {
+			continue
+		}
+		path, _ := cfg.Clients.ConfigPath(name)
+		if path == "" {
+			continue
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			continue
+		}
+		for _, cert := range clientCertificates(name, data) {
+			// Relative paths are resolved against the config's directory
+			if !filepath.IsAbs(cert) {
+				cert = filepath.Join(filepath.Dir(path), cert)
+			}
+			candidates = append(candidates, cert)
+		}
+	}
+	candidates = append(candidates, cfg.Health.Certificates.Paths...)
+
+	var paths []string
+	seen := make(map[string]bool, len(candidates))
+	for _, path := range candidates {
+		if path == "" {
+			continue
+		}
+		path = filepath.Clean(path)
+		if !seen[path] {
+			seen[path] = true
+			paths = append(paths, path)
+		}
+	}
+	return paths
+}
+
+// clientCertificates returns the certificate files referenced by a client
+// config. Inline certificates and unparsable configs yield none.
+func clientCertificates(clientType string, data []byte) []string {
+	var paths []string
+	switch clientType {
+	case "sing-box":
+		type bound struct {
+			TLS struct {
+				CertificatePath string `json:"certificate_path"`
+			} `json:"tls"`
+		}
+		var doc struct {
+			Inbounds  []bound `json:"inbounds"`
+			Outbounds []bound `json:"outbounds"`
+		}
+		if json.Unmarshal(data, &doc) != nil {
+			return nil
+		}
+		for _, entry := range append(doc.Inbounds, doc.Outbounds...) {
+			paths = append(paths, entry.TLS.CertificatePath)
+		}
+	case "xray":
+		type bound struct {
+			StreamSettings struct {
+				TLSSettings struct {
+					Certificates []struct {
+						CertificateFile string `json:"certificateFile"`
+					} `json:"certificates"`
+				} `json:"tlsSettings"`
+			} `json:"streamSettings"`
+		}
+		var doc struct {
+			Inbounds  []bound `json:"inbounds"`
+			Outbounds []bound `json:"outbounds"`
+		}
+		if json.Unmarshal(data, &doc) != nil {
+			return nil
+		}
+		for _, entry := range append(doc.Inbounds, doc.Outbounds...) {
+			for _, cert := range entry.StreamSettings.TLSSettings.Certificates {
+				paths = append(paths, cert.CertificateFile)
+			}
+		}
+	case "clash":
+		var doc struct {
+			TLS struct {
+				Certificate string `json:"certificate"`
+			} `json:"tls"`
+		}
+		if json.Unmarshal(data, &doc) != nil {
+			return nil
+		}
+		paths = append(paths, doc.TLS.Certificate)
+	case "hysteria":
+		var doc struct {
+			TLS struct {
+				// Cert is set on servers, CA on clients pinning their server
+				Cert string `json:"cert"`
+				CA   string `json:"ca"`
+			} `json:"tls"`
+		}
+		if json.Unmarshal(data, &doc) != nil {
+			return nil
+		}
+		paths = append(paths, doc.TLS.Cert, doc.TLS.CA)
+	}
+
+	var files []string
+	for _, path := range paths {
+		if path != "" && !strings.HasPrefix(path, "-----BEGIN") {
+			files = append(files, path)
+		}
+	}
+	return files
+}
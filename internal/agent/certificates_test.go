@@ -0,0 +1,79 @@
+package agent
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/kpblcaoo/sboxagent/internal/config"
+	"github.com/kpblcaoo/sboxagent/internal/health"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestClientCertificates(t *testing.T) {
+	tests := []struct {
+		client string
+		config string
+		want   []string
+	}{
+		{"sing-box", `{"inbounds":[{"type":"vless","tls":{"certificate_path":"/etc/ssl/server.pem"}},{"type":"socks"}],
+			"outbounds":[{"type":"vless","tls":{"certificate_path":"ca.pem"}}]}`, []string{"/etc/ssl/server.pem", "ca.pem"}},
+		{"xray", `{"inbounds":[{"streamSettings":{"tlsSettings":{"certificates":[{"certificateFile":"/etc/xray/cert.pem"}]}}}]}`,
+			[]string{"/etc/xray/cert.pem"}},
+		{"clash", `{"tls":{"certificate":"-----BEGIN CERTIFICATE-----\n..."}}`, nil},
+		{"hysteria", `{"tls":{"cert":"/etc/hysteria/cert.pem"}}`, []string{"/etc/hysteria/cert.pem"}},
+		{"sing-box", `not json`, nil},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, tt.want, clientCertificates(tt.client, []byte(tt.config)), tt.client)
+	}
+}
+
+func TestAgent_CertificatePaths(t *testing.T) {
+	dir := t.TempDir()
+	clientConfig := filepath.Join(dir, "config.json")
+	require.NoError(t, os.WriteFile(clientConfig,
+		[]byte(`{"inbounds":[{"tls":{"certificate_path":"certs/server.pem"}}]}`), 0644))
+
+	agent, err := New(&config.Config{
+		Agent:    config.AgentConfig{Name: "certificate-test", LogLevel: "error"},
+		Security: config.SecurityConfig{TLSEnabled: true, TLSCertFile: "/etc/sboxagent/tls.pem"},
+		Clients: config.ClientsConfig{
+			SingBox: config.SingBoxConfig{Enabled: true, ConfigPath: clientConfig},
+			Xray:    config.XrayConfig{ConfigPath: filepath.Join(dir, "xray.json")},
+		},
+		Health: config.HealthConfig{Certificates: config.CertificateCheckConfig{Paths: []string{"/etc/sboxagent/tls.pem", "/srv/ca.pem"}}},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, []string{
+		filepath.Clean("/etc/sboxagent/tls.pem"),
+		filepath.Join(dir, "certs", "server.pem"),
+		filepath.Clean("/srv/ca.pem"),
+	}, agent.certificatePaths())
+}
+
+func TestAgent_AlertCertificates(t *testing.T) {
+	agent, err := New(&config.Config{
+		Agent: config.AgentConfig{Name: "certificate-test", LogLevel: "error"},
+	})
+	require.NoError(t, err)
+
+	cert := health.CertificateExpiry{Path: "/etc/ssl/server.pem", NotAfter: time.Now().Add(20 * 24 * time.Hour), DaysLeft: 20}
+	alerted := func() health.HealthStatus {
+		agent.mu.RLock()
+		defer agent.mu.RUnlock()
+		return agent.certificateAlerts[cert.Path]
+	}
+
+	// Each threshold is alerted once, renewal resets the alerts
+	for _, status := range []health.HealthStatus{health.HealthStatusDegraded, health.HealthStatusDegraded, health.HealthStatusUnhealthy} {
+		cert.Status = status
+		agent.alertCertificates([]health.CertificateExpiry{cert})
+		assert.Equal(t, status, alerted())
+	}
+	cert.Status = health.HealthStatusHealthy
+	agent.alertCertificates([]health.CertificateExpiry{cert})
+	assert.NotContains(t, agent.certificateAlerts, cert.Path)
+}
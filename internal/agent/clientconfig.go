@@ -0,0 +1,83 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/kpblcaoo/sboxagent/internal/clientapi"
+)
+
+// clientAPITimeout bounds a query of a client's controller API
+const clientAPITimeout = 5 * time.Second
+
+// ClientConfigView is a client's config file next to the settings the
+// running client reports, with the settings that differ
+type ClientConfigView struct {
+	Client string                 `json:"client"`
+	Path   string                 `json:"path"`
+	Disk   map[string]interface{} `json:"disk"`
+	// API is the controller the runtime settings were read from
+	API          string                 `json:"api,omitempty"`
+	Runtime      map[string]interface{} `json:"runtime,omitempty"`
+	RuntimeError string                 `json:"runtimeError,omitempty"`
+	Differences  []clientapi.Difference `json:"differences,omitempty"`
+	Diverged     bool                   `json:"diverged"`
+}
+
+// ClientConfig reads a client's config file and the configuration the
+// running client reports through its controller API. An empty client
+// selects the import client type. A client that cannot be queried is
+// reported in RuntimeError rather than failing the call.
+func (a *Agent) ClientConfig(ctx context.Context, client string) (*ClientConfigView, error) {
+	client, path, err := a.clientConfigPath(client)
+	if err != nil {
+		return nil, err
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s config: %w", client, err)
+	}
+	disk, err := clientapi.ParseConfig(data)
+	if err != nil {
+		return nil, err
+	}
+
+	view := &ClientConfigView{Client: client, Path: path, Disk: disk}
+	endpoint, err := clientapi.Discover(client, disk)
+	if err != nil {
+		view.RuntimeError = err.Error()
+		return view, nil
+	}
+	view.API = endpoint.URL
+
+	ctx, cancel := context.WithTimeout(ctx, clientAPITimeout)
+	defer cancel()
+	runtime, err := clientapi.FetchConfig(ctx, http.DefaultClient, endpoint)
+	if err != nil {
+		view.RuntimeError = err.Error()
+		return view, nil
+	}
+	view.Runtime = runtime
+	view.Differences = clientapi.Compare(clientapi.Expected(client, disk), runtime)
+	view.Diverged = len(view.Differences) > 0
+	return view, nil
+}
+
+// handleClientConfig serves ClientConfig for the client in the path
+func (a *Agent) handleClientConfig(w http.ResponseWriter, r *http.Request) {
+	view, err := a.ClientConfig(r.Context(), r.PathValue("client"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(view); err != nil {
+		a.logger.Warn("Failed to write client config", map[string]interface{}{
+			"error": err.Error(),
+		})
+	}
+}
@@ -0,0 +1,49 @@
+package agent
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/kpblcaoo/sboxagent/internal/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAgent_ClientConfig(t *testing.T) {
+	controller := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"mixed-port":7890,"mode":"rule","log-level":"info"}`))
+	}))
+	defer controller.Close()
+
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	require.NoError(t, os.WriteFile(path, []byte("mixed-port: 7891\nmode: rule\nexternal-controller: "+
+		strings.TrimPrefix(controller.URL, "http://")+"\n"), 0644))
+	agent, err := New(&config.Config{
+		Agent:   config.AgentConfig{Name: "client-config-test", LogLevel: "error"},
+		Clients: config.ClientsConfig{Clash: config.ClashConfig{ConfigPath: path}},
+		Import:  config.ImportConfig{ClientType: "clash"},
+	})
+	require.NoError(t, err)
+
+	view, err := agent.ClientConfig(context.Background(), "")
+	require.NoError(t, err)
+	assert.Equal(t, "clash", view.Client)
+	assert.Equal(t, controller.URL, view.API)
+	assert.Empty(t, view.RuntimeError)
+	assert.True(t, view.Diverged)
+	require.Len(t, view.Differences, 1)
+	assert.Equal(t, "mixed-port", view.Differences[0].Key)
+
+	// A client that is not running is reported, not an error
+	controller.Close()
+	view, err = agent.ClientConfig(context.Background(), "clash")
+	require.NoError(t, err)
+	assert.NotEmpty(t, view.RuntimeError)
+	assert.False(t, view.Diverged)
+	assert.Equal(t, 7891, view.Disk["mixed-port"])
+}
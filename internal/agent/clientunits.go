@@ -0,0 +1,184 @@
+package agent
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/kpblcaoo/sboxagent/internal/config"
+	"github.com/kpblcaoo/sboxagent/internal/initsys"
+)
+
+// Client unit actions
+const (
+	UnitStart   = "start"
+	UnitStop    = "stop"
+	UnitRestart = "restart"
+	UnitReload  = "reload"
+)
+
+// ClientUnitState is the init system state of the unit running a client
+type ClientUnitState struct {
+	Client      string    `json:"client"`
+	Unit        string    `json:"unit"`
+	ActiveState string    `json:"activeState,omitempty"`
+	SubState    string    `json:"subState,omitempty"`
+	Error       string    `json:"error,omitempty"`
+	UpdatedAt   time.Time `json:"updatedAt"`
+}
+
+// ClientUnitManager controls the units of the enabled clients,
+// mapped by clients.<name>.unit, and keeps their last known state
+type ClientUnitManager struct {
+	agent *Agent
+
+	mu     sync.RWMutex
+	states map[string]ClientUnitState
+}
+
+// newClientUnitManager creates the unit manager of an agent
+func newClientUnitManager(agent *Agent) *ClientUnitManager {
+	return &ClientUnitManager{agent: agent, states: make(map[string]ClientUnitState)}
+}
+
+// Units returns the unit of each enabled client by client name, named the
+// way the init system names it once connected
+func (m *ClientUnitManager) Units() map[string]string {
+	clients := m.agent.GetConfig().Clients
+	manager, err := m.agent.initSystem()
+	units := make(map[string]string)
+	for _, name := range config.ClientNames {
+		if !clients.Enabled(name) {
+			continue
+		}
+		unit, _ := clients.Unit(name)
+		if err == nil {
+			unit = manager.Name(unit)
+		}
+		units[name] = unit
+	}
+	return units
+}
+
+// Control runs action on the unit of an enabled client and returns the
+// unit's state afterwards
+func (m *ClientUnitManager) Control(ctx context.Context, client, action string) (ClientUnitState, error) {
+	unit, ok := m.Units()[client]
+	if !ok {
+		return ClientUnitState{}, fmt.Errorf("client %q is not enabled", client)
+	}
+	units, err := m.agent.initSystem()
+	if err != nil {
+		return ClientUnitState{}, err
+	}
+
+	cfg := m.agent.GetConfig().Services
+	actionCtx, cancel := context.WithTimeout(ctx, cfg.CLI.ActionTimeout("systemctl", cfg.Systemd.Timeout))
+	defer cancel()
+	switch action {
+	case UnitStart:
+		err = units.Start(actionCtx, unit)
+	case UnitStop:
+		err = units.Stop(actionCtx, unit)
+	case UnitRestart:
+		err = units.Restart(actionCtx, unit)
+	case UnitReload:
+		err = units.Reload(actionCtx, unit)
+	default:
+		return ClientUnitState{}, fmt.Errorf("unknown unit action %q", action)
+	}
+	if err != nil {
+		m.record(client, initsys.UnitState{Unit: unit}, err)
+		return m.state(client), err
+	}
+
+	m.agent.logger.Info("Controlled client unit", map[string]interface{}{
+		"client": client,
+		"unit":   unit,
+		"action": action,
+	})
+	m.agent.publishEvent("CLIENT_UNIT_CONTROLLED", map[string]interface{}{
+		"client": client,
+		"unit":   unit,
+		"action": action,
+	})
+	m.refresh(ctx, units, client, unit)
+	return m.state(client), nil
+}
+
+// Refresh reads the state of every enabled client's unit
+func (m *ClientUnitManager) Refresh(ctx context.Context) {
+	units, err := m.agent.initSystem()
+	if err != nil {
+		return
+	}
+	for client, unit := range m.Units() {
+		m.refresh(ctx, units, client, unit)
+	}
+}
+
+// refresh reads the state of one client's unit
+func (m *ClientUnitManager) refresh(ctx context.Context, units initsys.Manager, client, unit string) {
+	cfg := m.agent.GetConfig().Services
+	ctx, cancel := context.WithTimeout(ctx, cfg.CLI.ActionTimeout("systemctl", cfg.Systemd.Timeout))
+	defer cancel()
+	state, err := units.State(ctx, unit)
+	if err != nil {
+		state.Unit = unit
+	}
+	m.record(client, state, err)
+}
+
+// update records a state change reported by the init system for a
+// client's unit
+func (m *ClientUnitManager) update(state initsys.UnitState) {
+	for client, unit := range m.Units() {
+		if unit == state.Unit {
+			m.record(client, state, nil)
+		}
+	}
+}
+
+// record stores the state of a client's unit, keeping the last known state
+// when reading it failed
+func (m *ClientUnitManager) record(client string, state initsys.UnitState, err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	current := m.states[client]
+	current.Client = client
+	current.Unit = state.Unit
+	current.UpdatedAt = time.Now()
+	current.Error = ""
+	if err != nil {
+		current.Error = err.Error()
+	} else {
+		current.ActiveState = state.ActiveState
+		current.SubState = state.SubState
+	}
+	m.states[client] = current
+}
+
+// state returns the last known state of a client's unit
+func (m *ClientUnitManager) state(client string) ClientUnitState {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.states[client]
+}
+
+// Status returns the last known state of the client units by client name
+func (m *ClientUnitManager) Status() map[string]ClientUnitState {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	status := make(map[string]ClientUnitState, len(m.states))
+	for client, state := range m.states {
+		status[client] = state
+	}
+	return status
+}
+
+// ClientUnits returns the manager of the client units, or nil unless
+// services.systemd is enabled or the agent supervises the clients
+func (a *Agent) ClientUnits() *ClientUnitManager {
+	return a.clientUnits
+}
@@ -0,0 +1,145 @@
+package agent
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/kpblcaoo/sboxagent/internal/config"
+	"github.com/kpblcaoo/sboxagent/internal/supervisor"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestClientUnitManager(t *testing.T) {
+	// A fake systemctl records the calls made to it and reports units active
+	dir := t.TempDir()
+	calls := filepath.Join(dir, "calls")
+	script := "#!/bin/sh\necho \"systemctl $*\" >> " + calls + "\n" +
+		"case \"$1\" in show) echo ActiveState=active; echo SubState=running ;; esac\n"
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "systemctl"), []byte(script), 0755))
+	t.Setenv("PATH", dir+string(os.PathListSeparator)+os.Getenv("PATH"))
+
+	cfg := &config.Config{
+		Agent: config.AgentConfig{Name: "units-test", LogLevel: "error"},
+		Services: config.ServicesConfig{
+			Systemd: config.SystemdConfig{Enabled: true, ServiceName: "sing-box", Timeout: 5 * time.Second, Backend: "systemctl", InitSystem: "systemd"},
+		},
+		Clients: config.ClientsConfig{
+			SingBox: config.SingBoxConfig{Enabled: true},
+			Xray:    config.XrayConfig{Enabled: true, ClientOverrides: config.ClientOverrides{Unit: "xray@main"}},
+		},
+	}
+	agent, err := New(cfg)
+	require.NoError(t, err)
+	manager := agent.ClientUnits()
+	require.NotNil(t, manager)
+	assert.Equal(t, map[string]string{"sing-box": "sing-box.service", "xray": "xray@main.service"}, manager.Units())
+
+	state, err := manager.Control(context.Background(), "xray", UnitRestart)
+	require.NoError(t, err)
+	assert.Equal(t, "xray@main.service", state.Unit)
+	assert.Equal(t, "active", state.ActiveState)
+	assert.Equal(t, "running", state.SubState)
+	assert.Equal(t, map[string]ClientUnitState{"xray": state}, agent.GetStatus()["client_units"])
+
+	_, err = manager.Control(context.Background(), "clash", UnitStart)
+	assert.EqualError(t, err, `client "clash" is not enabled`)
+	_, err = manager.Control(context.Background(), "xray", "kill")
+	assert.EqualError(t, err, `unknown unit action "kill"`)
+
+	data, err := os.ReadFile(calls)
+	require.NoError(t, err)
+	assert.Equal(t, "systemctl restart xray@main.service\nsystemctl show --property=ActiveState,SubState xray@main.service\n", string(data))
+}
+
+func TestClientUnitManager_Supervised(t *testing.T) {
+	// A fake sing-box records its arguments and runs until stopped
+	dir := t.TempDir()
+	args := filepath.Join(dir, "args")
+	script := "#!/bin/sh\necho \"$* $CLIENT_ENV\" > " + args + "\nexec sleep 30\n"
+	binary := filepath.Join(dir, "sing-box")
+	require.NoError(t, os.WriteFile(binary, []byte(script), 0755))
+
+	cfg := &config.Config{
+		Agent: config.AgentConfig{Name: "supervised-test", LogLevel: "error"},
+		Services: config.ServicesConfig{
+			Systemd:    config.SystemdConfig{Timeout: 10 * time.Second},
+			Supervisor: config.SupervisorConfig{Mode: config.SupervisorOn, RestartDelay: time.Second, MaxRestartDelay: time.Minute, StopTimeout: 5 * time.Second},
+		},
+		Clients: config.ClientsConfig{
+			SingBox: config.SingBoxConfig{Enabled: true, BinaryPath: binary, ConfigPath: "/etc/sing-box/config.json",
+				ClientOverrides: config.ClientOverrides{Env: []string{"CLIENT_ENV=set"}}},
+		},
+	}
+	agent, err := New(cfg)
+	require.NoError(t, err)
+	manager := agent.ClientUnits()
+	require.NotNil(t, manager)
+	t.Cleanup(agent.supervisor.StopAll)
+	assert.Equal(t, map[string]string{"sing-box": "sing-box"}, manager.Units())
+
+	state, err := manager.Control(context.Background(), "sing-box", UnitStart)
+	require.NoError(t, err)
+	assert.Equal(t, "active", state.ActiveState)
+	assert.Equal(t, "running", state.SubState)
+	require.Eventually(t, func() bool {
+		data, _ := os.ReadFile(args)
+		return string(data) == "run -c /etc/sing-box/config.json set\n"
+	}, 5*time.Second, 10*time.Millisecond)
+	status := agent.GetStatus()["supervisor"].(map[string]supervisor.ProgramStatus)["sing-box"]
+	assert.NotZero(t, status.PID)
+	assert.Zero(t, status.Restarts)
+
+	state, err = manager.Control(context.Background(), "sing-box", UnitStop)
+	require.NoError(t, err)
+	assert.Equal(t, "inactive", state.ActiveState)
+}
+
+func TestAgent_HotReload(t *testing.T) {
+	// sing-box reloads on SIGHUP, hysteria has to be restarted
+	dir := t.TempDir()
+	log := filepath.Join(dir, "log")
+	singBox := filepath.Join(dir, "sing-box")
+	require.NoError(t, os.WriteFile(singBox, []byte("#!/bin/sh\ntrap 'echo sing-box reloaded >> "+log+"' HUP\necho sing-box started >> "+log+"\nwhile :; do sleep 0.1; done\n"), 0755))
+	hysteria := filepath.Join(dir, "hysteria")
+	require.NoError(t, os.WriteFile(hysteria, []byte("#!/bin/sh\necho hysteria started >> "+log+"\nexec sleep 30\n"), 0755))
+
+	agent, err := New(&config.Config{
+		Agent: config.AgentConfig{Name: "hot-reload-test", LogLevel: "error"},
+		Services: config.ServicesConfig{
+			Systemd:    config.SystemdConfig{Timeout: 10 * time.Second},
+			Supervisor: config.SupervisorConfig{Mode: config.SupervisorOn, RestartDelay: time.Second, MaxRestartDelay: time.Minute, StopTimeout: 5 * time.Second},
+		},
+		Clients: config.ClientsConfig{
+			SingBox:  config.SingBoxConfig{Enabled: true, BinaryPath: singBox, ConfigPath: filepath.Join(dir, "sing-box.json")},
+			Hysteria: config.HysteriaConfig{Enabled: true, BinaryPath: hysteria, ConfigPath: filepath.Join(dir, "hysteria.json")},
+		},
+		Import: config.ImportConfig{HotReload: true},
+	})
+	require.NoError(t, err)
+	t.Cleanup(agent.supervisor.StopAll)
+	ctx := context.Background()
+	require.NoError(t, agent.supervisor.StartAll(ctx))
+	require.Eventually(t, func() bool {
+		data, _ := os.ReadFile(log)
+		return strings.Count(string(data), "started") == 2
+	}, 5*time.Second, 10*time.Millisecond)
+
+	assert.True(t, agent.canReload("sing-box"))
+	require.NoError(t, agent.reloadClient(ctx, "sing-box"))
+	require.NoError(t, agent.reloadClient(ctx, "hysteria"))
+	require.Eventually(t, func() bool {
+		data, _ := os.ReadFile(log)
+		return strings.Contains(string(data), "sing-box reloaded") && strings.Count(string(data), "hysteria started") == 2
+	}, 5*time.Second, 10*time.Millisecond)
+	data, err := os.ReadFile(log)
+	require.NoError(t, err)
+	assert.Equal(t, 1, strings.Count(string(data), "sing-box started"), "sing-box is not restarted")
+
+	agent.config.Import.HotReload = false
+	assert.False(t, agent.canReload("sing-box"))
+}
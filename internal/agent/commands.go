@@ -0,0 +1,415 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/kpblcaoo/sboxagent/internal/aggregator"
+	"github.com/kpblcaoo/sboxagent/internal/config"
+	"github.com/kpblcaoo/sboxagent/internal/dispatcher"
+	"github.com/kpblcaoo/sboxagent/internal/process"
+	"github.com/kpblcaoo/sboxagent/internal/services"
+	"github.com/kpblcaoo/sboxagent/internal/socket"
+	"github.com/kpblcaoo/sboxagent/internal/telemetry"
+)
+
+// ConfigDiff describes pending changes between the running configuration and
+// the configuration on disk
+type ConfigDiff struct {
+	Path       string          `json:"path"`
+	HasChanges bool            `json:"has_changes"`
+	Changes    []config.Change `json:"changes"`
+}
+
+// GetConfigDiff compares the in-memory configuration with the on-disk file,
+// including drop-ins and the cached remote config
+func (a *Agent) GetConfigDiff() (*ConfigDiff, error) {
+	onDisk, err := a.GetConfig().Reload()
+	if err != nil {
+		return nil, fmt.Errorf("failed to load on-disk config: %w", err)
+	}
+
+	changes := config.Diff(a.GetConfig(), onDisk)
+	return &ConfigDiff{
+		Path:       onDisk.Path(),
+		HasChanges: len(changes) > 0,
+		Changes:    changes,
+	}, nil
+}
+
+// GetLogs returns up to limit of the most recent aggregated log entries,
+// newest first, optionally filtered by level. It fails if log aggregation is
+// disabled.
+func (a *Agent) GetLogs(limit int, level string) ([]aggregator.LogEntry, error) {
+	if a.aggregator == nil {
+		return nil, fmt.Errorf("log aggregation is disabled")
+	}
+	return a.aggregator.GetEntriesByLevel(aggregator.LogLevel(level), limit), nil
+}
+
+// GetRuns returns up to limit recent runs of service, sboxctl or sboxmgr,
+// newest first; an empty service returns runs of both. It fails if the run
+// history is disabled.
+func (a *Agent) GetRuns(service string, limit int) ([]process.Run, error) {
+	if a.runs == nil {
+		return nil, fmt.Errorf("run history is disabled")
+	}
+	return a.runs.Runs(service, limit), nil
+}
+
+// runsStatus reports the last run and the last successful run of each
+// service; it is empty until something ran
+func (a *Agent) runsStatus() map[string]interface{} {
+	status := map[string]interface{}{}
+	for _, service := range []string{"sboxctl", "sboxmgr"} {
+		if run, ok := a.runs.LastSuccess(service); ok {
+			status[service] = map[string]interface{}{"lastSuccess": run.Start}
+		}
+	}
+	if runs := a.runs.Runs("", 1); len(runs) > 0 {
+		status["last"] = runs[0]
+	}
+	return status
+}
+
+// defaultSboxctlCommandTimeout bounds the wait for a response to a command
+// sent to an interactive sboxctl run
+const defaultSboxctlCommandTimeout = 30 * time.Second
+
+// SendSboxctlCommand sends a command to the running interactive sboxctl and
+// returns its response. It fails if sboxctl is disabled or not interactive.
+func (a *Agent) SendSboxctlCommand(command string, params map[string]interface{}, timeout time.Duration) (*services.SboxctlEvent, error) {
+	if a.sboxctlService == nil {
+		return nil, fmt.Errorf("sboxctl is disabled")
+	}
+	if timeout <= 0 {
+		timeout = defaultSboxctlCommandTimeout
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	return a.sboxctlService.SendCommand(ctx, command, params)
+}
+
+// TriggerUpdate runs sboxctl now, outside of its schedule, and returns the
+// run ID. Progress is published to socket clients as sboxctl events with
+// that run_id, from RUN_STARTED to RUN_FINISHED.
+func (a *Agent) TriggerUpdate() (string, error) {
+	if a.sboxctlService == nil {
+		return "", fmt.Errorf("sboxctl is disabled")
+	}
+	return a.sboxctlService.TriggerRun()
+}
+
+// handleTriggerUpdate serves TriggerUpdate
+func (a *Agent) handleTriggerUpdate(w http.ResponseWriter, r *http.Request) {
+	id, err := a.TriggerUpdate()
+	if err != nil {
+		status := http.StatusServiceUnavailable
+		if errors.Is(err, services.ErrRunPending) {
+			status = http.StatusConflict
+		}
+		http.Error(w, err.Error(), status)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	if err := json.NewEncoder(w).Encode(map[string]string{"run_id": id}); err != nil {
+		a.logger.Warn("Failed to write update trigger response", map[string]interface{}{
+			"error": err.Error(),
+		})
+	}
+}
+
+// AttachSocket registers the agent's socket commands on server and forwards
+// sboxctl events to its clients. It must be called before Start.
+func (a *Agent) AttachSocket(server *socket.Server) {
+	a.socketServer = server
+	// Peers of a TCP socket are filtered like those of the API
+	if server.Network == "tcp" {
+		server.AccessList = a.acl
+	}
+	server.CommandHook = a.auditCommand
+	a.RegisterCommands(server)
+
+	// Let subprocesses find the agent socket
+	a.configureSubprocesses()
+}
+
+// RegisterCommands registers the agent's socket commands on server
+func (a *Agent) RegisterCommands(server *socket.Server) {
+	server.RegisterCommand("status", func(params map[string]interface{}) (map[string]interface{}, error) {
+		return a.GetStatus(), nil
+	})
+
+	server.RegisterCommand("config_diff", func(params map[string]interface{}) (map[string]interface{}, error) {
+		diff, err := a.GetConfigDiff()
+		if err != nil {
+			return nil, err
+		}
+		return map[string]interface{}{
+			"path":        diff.Path,
+			"has_changes": diff.HasChanges,
+			"changes":     diff.Changes,
+		}, nil
+	})
+
+	server.RegisterCommand("maintenance", func(params map[string]interface{}) (map[string]interface{}, error) {
+		enabled, ok := params["enabled"].(bool)
+		if !ok {
+			return nil, &socket.CommandError{Code: "invalid_params", Message: "enabled must be a boolean"}
+		}
+		if err := a.SetMaintenance(enabled); err != nil {
+			return nil, err
+		}
+		return map[string]interface{}{"state": a.State()}, nil
+	})
+
+	server.RegisterCommand("logs", func(params map[string]interface{}) (map[string]interface{}, error) {
+		limit, _ := params["limit"].(float64)
+		level, _ := params["level"].(string)
+		entries, err := a.GetLogs(int(limit), level)
+		if err != nil {
+			return nil, err
+		}
+		return map[string]interface{}{"entries": entries}, nil
+	})
+
+	server.RegisterCommand("get_runs", func(params map[string]interface{}) (map[string]interface{}, error) {
+		service, _ := params["service"].(string)
+		limit, _ := params["limit"].(float64)
+		runs, err := a.GetRuns(service, int(limit))
+		if err != nil {
+			return nil, err
+		}
+		return map[string]interface{}{"runs": runs}, nil
+	})
+
+	server.RegisterCommand("backups", func(params map[string]interface{}) (map[string]interface{}, error) {
+		client, _ := params["client"].(string)
+		backups, err := a.ListBackups(client)
+		if err != nil {
+			return nil, err
+		}
+		return map[string]interface{}{"backups": backups}, nil
+	})
+
+	server.RegisterCommand("restore_backup", func(params map[string]interface{}) (map[string]interface{}, error) {
+		client, _ := params["client"].(string)
+		name, _ := params["name"].(string)
+		if name == "" {
+			return nil, &socket.CommandError{Code: "invalid_params", Message: "name is required"}
+		}
+		backup, err := a.RestoreBackup(client, name)
+		if err != nil {
+			return nil, err
+		}
+		return map[string]interface{}{"restored": name, "backup": backup}, nil
+	})
+
+	server.RegisterCommand("client_config", func(params map[string]interface{}) (map[string]interface{}, error) {
+		client, _ := params["client"].(string)
+		view, err := a.ClientConfig(a.runContext(), client)
+		if err != nil {
+			return nil, err
+		}
+		return map[string]interface{}{"config": view}, nil
+	})
+
+	server.RegisterCommand("stop_clients", func(params map[string]interface{}) (map[string]interface{}, error) {
+		reason, _ := params["reason"].(string)
+		stop, err := a.StopClients(reason)
+		if err != nil {
+			return nil, err
+		}
+		return map[string]interface{}{"stopped": stop}, nil
+	})
+
+	server.RegisterCommand("start_clients", func(params map[string]interface{}) (map[string]interface{}, error) {
+		if err := a.StartClients(); err != nil {
+			return nil, err
+		}
+		return map[string]interface{}{"state": a.State()}, nil
+	})
+
+	server.RegisterCommand("client_unit", func(params map[string]interface{}) (map[string]interface{}, error) {
+		if a.clientUnits == nil {
+			return nil, fmt.Errorf("client units require services.systemd or the supervisor to be enabled")
+		}
+		client, _ := params["client"].(string)
+		action, _ := params["action"].(string)
+		if client == "" || action == "" {
+			return nil, &socket.CommandError{Code: "invalid_params", Message: "client and action are required"}
+		}
+		state, err := a.clientUnits.Control(a.runContext(), client, action)
+		if err != nil {
+			return nil, err
+		}
+		return map[string]interface{}{"unit": state}, nil
+	})
+
+	server.RegisterCommand("upgrade_client", func(params map[string]interface{}) (map[string]interface{}, error) {
+		client, _ := params["client"].(string)
+		if client == "" {
+			return nil, &socket.CommandError{Code: "invalid_params", Message: "client is required"}
+		}
+		version, _ := params["version"].(string)
+		force, _ := params["force"].(bool)
+		result, err := a.UpgradeClient(a.runContext(), client, version, force)
+		if err != nil {
+			return nil, err
+		}
+		return map[string]interface{}{"upgrade": result}, nil
+	})
+
+	server.RegisterCommand("repair_units", func(params map[string]interface{}) (map[string]interface{}, error) {
+		repaired, err := a.RepairUnits(a.runContext())
+		if err != nil {
+			return nil, err
+		}
+		return map[string]interface{}{"repaired": repaired}, nil
+	})
+
+	server.RegisterCommand("config_get", func(params map[string]interface{}) (map[string]interface{}, error) {
+		key, _ := params["key"].(string)
+		if key == "" {
+			return nil, &socket.CommandError{Code: "invalid_params", Message: "key is required"}
+		}
+		value, err := a.GetConfigValue(key)
+		if err != nil {
+			return nil, err
+		}
+		return map[string]interface{}{"key": key, "value": value}, nil
+	})
+
+	server.RegisterCommand("config_set", func(params map[string]interface{}) (map[string]interface{}, error) {
+		key, _ := params["key"].(string)
+		value, ok := params["value"]
+		if key == "" || !ok {
+			return nil, &socket.CommandError{Code: "invalid_params", Message: "key and value are required"}
+		}
+		persist, _ := params["persist"].(bool)
+		actor, _ := params["actor"].(string)
+		entry, err := a.SetConfigValue(key, value, persist, actor)
+		if err != nil {
+			return nil, err
+		}
+		return map[string]interface{}{"change": entry, "restart_required": entry.RestartRequired}, nil
+	})
+
+	server.RegisterCommand("config_audit", func(params map[string]interface{}) (map[string]interface{}, error) {
+		return map[string]interface{}{"entries": a.ConfigAudit()}, nil
+	})
+
+	server.RegisterCommand("config_lease_acquire", func(params map[string]interface{}) (map[string]interface{}, error) {
+		client, _ := params["client"].(string)
+		holder, _ := params["holder"].(string)
+		if holder == "" {
+			return nil, &socket.CommandError{Code: "invalid_params", Message: "holder is required"}
+		}
+		ttl, _ := params["ttl"].(float64)
+		lease, err := a.AcquireConfigLease(client, holder, time.Duration(ttl*float64(time.Second)))
+		if err != nil {
+			return nil, err
+		}
+		return map[string]interface{}{"lease": lease}, nil
+	})
+
+	server.RegisterCommand("config_lease_renew", func(params map[string]interface{}) (map[string]interface{}, error) {
+		id, _ := params["id"].(string)
+		if id == "" {
+			return nil, &socket.CommandError{Code: "invalid_params", Message: "id is required"}
+		}
+		ttl, _ := params["ttl"].(float64)
+		lease, err := a.RenewConfigLease(id, time.Duration(ttl*float64(time.Second)))
+		if err != nil {
+			return nil, err
+		}
+		return map[string]interface{}{"lease": lease}, nil
+	})
+
+	server.RegisterCommand("config_lease_release", func(params map[string]interface{}) (map[string]interface{}, error) {
+		id, _ := params["id"].(string)
+		if id == "" {
+			return nil, &socket.CommandError{Code: "invalid_params", Message: "id is required"}
+		}
+		if err := a.ReleaseConfigLease(id); err != nil {
+			return nil, err
+		}
+		return map[string]interface{}{"released": id}, nil
+	})
+
+	server.RegisterCommand("config_leases", func(params map[string]interface{}) (map[string]interface{}, error) {
+		return map[string]interface{}{"leases": a.ConfigLeases()}, nil
+	})
+
+	server.RegisterCommand("trigger_update", func(params map[string]interface{}) (map[string]interface{}, error) {
+		id, err := a.TriggerUpdate()
+		if err != nil {
+			return nil, err
+		}
+		return map[string]interface{}{"run_id": id}, nil
+	})
+
+	server.RegisterCommand("update_dry_run", func(params map[string]interface{}) (map[string]interface{}, error) {
+		client, _ := params["client"].(string)
+		preview, err := a.DryRunUpdate(a.runContext(), client)
+		if err != nil {
+			return nil, err
+		}
+		return map[string]interface{}{"preview": preview}, nil
+	})
+
+	server.RegisterCommand("sboxctl_command", func(params map[string]interface{}) (map[string]interface{}, error) {
+		command, _ := params["command"].(string)
+		if command == "" {
+			return nil, &socket.CommandError{Code: "invalid_params", Message: "command is required"}
+		}
+		commandParams, _ := params["params"].(map[string]interface{})
+		timeout, _ := params["timeout"].(float64)
+		response, err := a.SendSboxctlCommand(command, commandParams, time.Duration(timeout*float64(time.Second)))
+		if err != nil {
+			return nil, err
+		}
+		return map[string]interface{}{"response": response.Data, "timestamp": response.Timestamp}, nil
+	})
+}
+
+// forwardEvents dispatches the events of sboxctl or one of its instances
+// to their handlers and publishes them to socket clients until shutdown
+func (a *Agent) forwardEvents(instance string, events <-chan services.SboxctlEvent) {
+	defer a.wg.Done()
+
+	source := sboxctlName(instance)
+	for {
+		select {
+		case <-a.ctx.Done():
+			return
+		case event := <-events:
+			a.events.add(time.Now())
+			// A full dispatcher queue drops the event and logs it
+			_ = a.dispatcher.Dispatch(dispatcher.ConvertSboxctlEvent(event))
+			if a.socketServer == nil {
+				continue
+			}
+			msg := socket.NewEventMessage(map[string]interface{}{
+				"source":    source,
+				"type":      event.Type,
+				"data":      event.Data,
+				"timestamp": event.Timestamp,
+				"version":   event.Version,
+				"run_id":    event.RunID,
+				"labels":    a.labels.With(telemetry.LabelService, source),
+			})
+			if err := a.socketServer.Publish(msg); err != nil {
+				a.logger.Warn("Failed to publish event", map[string]interface{}{
+					"type":  event.Type,
+					"error": err.Error(),
+				})
+			}
+		}
+	}
+}
@@ -0,0 +1,385 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/kpblcaoo/sboxagent/internal/aggregator"
+	"github.com/kpblcaoo/sboxagent/internal/config"
+	"github.com/kpblcaoo/sboxagent/internal/logger"
+	"github.com/kpblcaoo/sboxagent/internal/socket"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAgent_GetConfigDiff(t *testing.T) {
+	configPath := filepath.Join(t.TempDir(), "agent.yaml")
+	require.NoError(t, os.WriteFile(configPath, []byte(`
+agent:
+  name: "diff-test"
+  log_level: "info"
+services:
+  sboxctl:
+    enabled: false
+`), 0644))
+
+	cfg, err := config.Load(configPath)
+	require.NoError(t, err)
+	agent, err := New(cfg)
+	require.NoError(t, err)
+
+	diff, err := agent.GetConfigDiff()
+	require.NoError(t, err)
+	assert.Equal(t, configPath, diff.Path)
+	assert.False(t, diff.HasChanges)
+	assert.Empty(t, diff.Changes)
+
+	// Edit the file on disk without reloading
+	require.NoError(t, os.WriteFile(configPath, []byte(`
+agent:
+  name: "diff-test"
+  log_level: "warn"
+services:
+  sboxctl:
+    enabled: false
+`), 0644))
+
+	diff, err = agent.GetConfigDiff()
+	require.NoError(t, err)
+	assert.True(t, diff.HasChanges)
+	assert.Equal(t, []config.Change{{Key: "agent.log_level", Old: "info", New: "warn"}}, diff.Changes)
+}
+
+func TestAgent_GetLogs(t *testing.T) {
+	cfg := &config.Config{
+		Agent:   config.AgentConfig{Name: "logs-test", LogLevel: "info"},
+		Logging: config.LoggingConfig{Aggregation: true, MaxEntries: 10},
+	}
+	agent, err := New(cfg)
+	require.NoError(t, err)
+
+	agent.logger.Info("Agent message", map[string]interface{}{"key": "value"})
+	agent.logger.Warn("Agent warning", nil)
+
+	entries, err := agent.GetLogs(10, "")
+	require.NoError(t, err)
+	require.Len(t, entries, 2)
+	assert.Equal(t, "Agent warning", entries[0].Message)
+	assert.Equal(t, "agent", entries[0].Source)
+	assert.Equal(t, "value", entries[1].Metadata["key"])
+
+	entries, err = agent.GetLogs(10, "warn")
+	require.NoError(t, err)
+	assert.Len(t, entries, 1)
+
+	// sboxctl stderr lines are kept with their class
+	agent.onSboxctlStderr("error", "error: subscription unreachable")
+	entries, err = agent.GetLogs(10, "error")
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+	assert.Equal(t, "sboxctl", entries[0].Source)
+	assert.Equal(t, "stderr", entries[0].Metadata["stream"])
+
+	// Without aggregation the command fails
+	agent, err = New(&config.Config{Agent: config.AgentConfig{LogLevel: "info"}})
+	require.NoError(t, err)
+	_, err = agent.GetLogs(10, "")
+	assert.ErrorContains(t, err, "disabled")
+}
+
+func TestAgent_SetConfigValue(t *testing.T) {
+	configPath := filepath.Join(t.TempDir(), "agent.yaml")
+	require.NoError(t, os.WriteFile(configPath, []byte(`
+agent:
+  name: "runtime-test"
+  log_level: "info"
+services:
+  sboxctl:
+    enabled: false
+`), 0644))
+
+	cfg, err := config.Load(configPath)
+	require.NoError(t, err)
+	agent, err := New(cfg)
+	require.NoError(t, err)
+
+	// The log level applies live and is persisted
+	entry, err := agent.SetConfigValue("agent.log_level", "debug", true, "admin")
+	require.NoError(t, err)
+	assert.Equal(t, "info", entry.Old)
+	assert.Equal(t, "debug", entry.New)
+	assert.False(t, entry.RestartRequired)
+	assert.Equal(t, logger.DebugLevel, agent.logger.GetLevel())
+
+	value, err := agent.GetConfigValue("agent.log_level")
+	require.NoError(t, err)
+	assert.Equal(t, "debug", value)
+
+	reloaded, err := config.Load(configPath)
+	require.NoError(t, err)
+	assert.Equal(t, "debug", reloaded.Agent.LogLevel)
+
+	// Other keys need a restart; secrets are masked in the audit trail
+	entry, err = agent.SetConfigValue("security.api_token", "new-token", false, "admin")
+	require.NoError(t, err)
+	assert.True(t, entry.RestartRequired)
+	assert.Equal(t, "********", entry.New)
+	assert.Equal(t, "new-token", agent.GetConfig().Security.APIToken)
+
+	// Invalid values leave the configuration unchanged
+	_, err = agent.SetConfigValue("server.port", "http", false, "admin")
+	assert.Error(t, err)
+	_, err = agent.SetConfigValue("agent.nickname", "x", false, "admin")
+	assert.ErrorContains(t, err, "unknown configuration key")
+
+	audit := agent.ConfigAudit()
+	require.Len(t, audit, 2)
+	assert.Equal(t, "agent.log_level", audit[0].Key)
+	assert.True(t, audit[0].Persisted)
+	assert.Equal(t, "admin", audit[1].Actor)
+}
+
+func TestAgent_SetConfigValueConcurrent(t *testing.T) {
+	configPath := filepath.Join(t.TempDir(), "agent.yaml")
+	require.NoError(t, os.WriteFile(configPath, []byte(`
+agent:
+  name: "runtime-test"
+  log_level: "error"
+services:
+  sboxctl:
+    enabled: false
+`), 0644))
+	cfg, err := config.Load(configPath)
+	require.NoError(t, err)
+	agent, err := New(cfg)
+	require.NoError(t, err)
+
+	// Concurrent changes of different keys all survive, in memory and on disk
+	var wg sync.WaitGroup
+	for _, key := range []string{"server.port", "services.run_history"} {
+		wg.Add(1)
+		go func(key string) {
+			defer wg.Done()
+			for i := 1; i <= 20; i++ {
+				_, err := agent.SetConfigValue(key, 9000+i, true, "admin")
+				assert.NoError(t, err)
+			}
+		}(key)
+	}
+	wg.Wait()
+
+	assert.Equal(t, 9020, agent.GetConfig().Server.Port)
+	assert.Equal(t, 9020, agent.GetConfig().Services.RunHistory)
+	reloaded, err := config.Load(configPath)
+	require.NoError(t, err)
+	assert.Equal(t, 9020, reloaded.Server.Port)
+	assert.Equal(t, 9020, reloaded.Services.RunHistory)
+}
+
+func TestAgent_SetConfigValueWhileRunning(t *testing.T) {
+	configPath := filepath.Join(t.TempDir(), "agent.yaml")
+	require.NoError(t, os.WriteFile(configPath, []byte(`
+agent:
+  name: "runtime-test"
+  log_level: "error"
+services:
+  sboxctl:
+    enabled: false
+`), 0644))
+	cfg, err := config.Load(configPath)
+	require.NoError(t, err)
+	agent, err := New(cfg)
+	require.NoError(t, err)
+
+	// Background paths read a snapshot of the config while it is replaced
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 1; i <= 20; i++ {
+			_, err := agent.SetConfigValue("server.port", 9000+i, false, "admin")
+			assert.NoError(t, err)
+		}
+	}()
+	for {
+		select {
+		case <-done:
+			assert.Equal(t, 9020, agent.GetConfig().Server.Port)
+			return
+		default:
+			agent.subprocessEnv()
+			agent.canReload("sing-box")
+			agent.stopTimeout("sboxctl")
+			agent.publishEvent("CONFIG_CHANGED", map[string]interface{}{})
+		}
+	}
+}
+
+func TestAgent_SendSboxctlCommand(t *testing.T) {
+	agent, err := New(&config.Config{
+		Agent: config.AgentConfig{Name: "command-test", LogLevel: "error"},
+	})
+	require.NoError(t, err)
+
+	_, err = agent.SendSboxctlCommand("refresh", nil, 0)
+	assert.ErrorContains(t, err, "sboxctl is disabled")
+}
+
+func TestAgent_ForwardEventsToAggregator(t *testing.T) {
+	event := `{"type":"LOG","data":{"level":"warn","message":"rule set outdated"},"timestamp":"2025-06-27T16:30:00Z","version":"1.0"}`
+	agent, err := New(&config.Config{
+		Agent: config.AgentConfig{Name: "events-test", LogLevel: "error"},
+		Services: config.ServicesConfig{
+			Sboxctl: config.SboxctlConfig{
+				Enabled:       true,
+				Command:       []string{"echo", event},
+				Interval:      time.Minute,
+				Timeout:       5 * time.Second,
+				StdoutCapture: true,
+			},
+		},
+		Logging: config.LoggingConfig{Aggregation: true, MaxEntries: 100},
+	})
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- agent.Start(ctx) }()
+
+	// The captured event is queryable along with the agent's own logs
+	require.Eventually(t, func() bool {
+		for _, entry := range agent.aggregator.GetEntriesByLevel(aggregator.LogLevelWarn, 10) {
+			if entry.Source == "sboxctl" && entry.Message == "rule set outdated" {
+				return true
+			}
+		}
+		return false
+	}, 5*time.Second, 20*time.Millisecond)
+	assert.Contains(t, agent.eventQueues(), "dispatcher")
+
+	cancel()
+	require.NoError(t, <-done)
+}
+
+func TestAgent_RetainsFailureEvents(t *testing.T) {
+	events := `{"type":"LOG","data":{"level":"info","message":"started"}}
+{"type":"LOG","data":{"level":"error","message":"subscription unreachable"}}`
+	agent, err := New(&config.Config{
+		Agent: config.AgentConfig{Name: "ack-test", LogLevel: "error"},
+		Services: config.ServicesConfig{
+			Sboxctl: config.SboxctlConfig{
+				Enabled:       true,
+				Command:       []string{"echo", events},
+				Interval:      time.Minute,
+				Timeout:       5 * time.Second,
+				StdoutCapture: true,
+			},
+		},
+	})
+	require.NoError(t, err)
+	server := socket.NewServer(filepath.Join(t.TempDir(), "agent.sock"), nil)
+	agent.AttachSocket(server)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- agent.Start(ctx) }()
+	defer func() {
+		cancel()
+		<-done
+	}()
+
+	// Only the error log of sboxctl waits for an ack
+	require.Eventually(t, func() bool { return server.Delivery.Len() > 0 }, 5*time.Second, 20*time.Millisecond)
+	pending := server.Delivery.Pending()
+	require.Len(t, pending, 1)
+	assert.Equal(t, "subscription unreachable", pending[0].Event.Event["data"].(map[string]interface{})["message"])
+
+	// Agent failures carry their severity in the event data
+	agent.publishEvent("IMPORT_COMPLETED", map[string]interface{}{"clientType": "sing-box"})
+	agent.publishEvent("IMPORT_FAILED", importFailure("sing-box", errors.New("sboxmgr failed")))
+	pending = server.Delivery.Pending()
+	require.Len(t, pending, 2)
+	assert.Equal(t, "IMPORT_FAILED", pending[1].Event.Event["type"])
+}
+
+func TestAgent_TCPSocketAccessList(t *testing.T) {
+	for _, tc := range []struct {
+		name    string
+		denied  []string
+		allowed bool
+	}{
+		{"loopback", nil, true},
+		{"denied", []string{"127.0.0.0/8"}, false},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			agent, err := New(&config.Config{
+				Agent:    config.AgentConfig{Name: "tcp-test", LogLevel: "error"},
+				Security: config.SecurityConfig{DeniedHosts: tc.denied},
+			})
+			require.NoError(t, err)
+			server := socket.NewServer("127.0.0.1:0", nil)
+			server.Network = "tcp"
+			agent.AttachSocket(server)
+			require.NotNil(t, server.AccessList)
+
+			require.NoError(t, server.Listen())
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			go func() { _ = server.Start(ctx) }()
+
+			conn, err := net.Dial("tcp", server.Addr().String())
+			require.NoError(t, err)
+			defer conn.Close()
+			require.NoError(t, conn.SetDeadline(time.Now().Add(2*time.Second)))
+			// A denied peer is disconnected without a reply
+			err = socket.WriteMessage(conn, socket.NewCommandMessage("status", nil))
+			if err == nil {
+				_, err = socket.ReadMessage(conn)
+			}
+			assert.Equal(t, tc.allowed, err == nil)
+		})
+	}
+}
+
+func TestAgent_TriggerUpdate(t *testing.T) {
+	disabled, err := New(&config.Config{Agent: config.AgentConfig{Name: "trigger-test", LogLevel: "error"}})
+	require.NoError(t, err)
+	recorder := httptest.NewRecorder()
+	disabled.handleTriggerUpdate(recorder, httptest.NewRequest(http.MethodPost, "/update", nil))
+	assert.Equal(t, http.StatusServiceUnavailable, recorder.Code)
+
+	agent, err := New(&config.Config{
+		Agent: config.AgentConfig{Name: "trigger-test", LogLevel: "error"},
+		Services: config.ServicesConfig{
+			Sboxctl: config.SboxctlConfig{
+				Enabled:  true,
+				Command:  []string{"true"},
+				Interval: time.Hour,
+				Timeout:  5 * time.Second,
+			},
+		},
+	})
+	require.NoError(t, err)
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- agent.Start(ctx) }()
+	require.Eventually(t, func() bool { return agent.State() == StateReady }, 5*time.Second, 10*time.Millisecond)
+
+	recorder = httptest.NewRecorder()
+	agent.handleTriggerUpdate(recorder, httptest.NewRequest(http.MethodPost, "/update", nil))
+	assert.Equal(t, http.StatusAccepted, recorder.Code)
+	var body map[string]string
+	require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &body))
+	assert.NotEmpty(t, body["run_id"])
+
+	cancel()
+	require.NoError(t, <-done)
+}
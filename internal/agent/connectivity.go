@@ -0,0 +1,245 @@
+package agent
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/kpblcaoo/sboxagent/internal/health"
+	"github.com/kpblcaoo/sboxagent/internal/telemetry"
+)
+
+// maxConnectivityBody bounds the response body read by connectivity probes
+const maxConnectivityBody = 64 << 10
+
+// connectivitySample is one connectivity probe
+type connectivitySample struct {
+	at      time.Time
+	latency time.Duration
+	err     error
+}
+
+// connectivityWindow keeps the last connectivity probes
+type connectivityWindow struct {
+	mu       sync.Mutex
+	url      string
+	size     int
+	samples  []connectivitySample
+	total    int64
+	failures int64
+}
+
+// ConnectivityStats summarizes the connectivity probes in the window
+type ConnectivityStats struct {
+	URL     string `json:"url"`
+	Samples int    `json:"samples"`
+	// SuccessRate is the percentage of successful probes in the window
+	SuccessRate float64 `json:"successRate"`
+	// AverageLatency is the mean latency of the successful probes
+	AverageLatency time.Duration `json:"averageLatency"`
+	LastLatency    time.Duration `json:"lastLatency,omitempty"`
+	LastError      string        `json:"lastError,omitempty"`
+	LastCheck      time.Time     `json:"lastCheck"`
+	// Total and Failures count all probes since the agent started
+	Total    int64 `json:"total"`
+	Failures int64 `json:"failures"`
+}
+
+// newConnectivityWindow creates a window of the last size probes of url
+func newConnectivityWindow(url string, size int) *connectivityWindow {
+	return &connectivityWindow{url: url, size: size}
+}
+
+// add records a probe, dropping the oldest one beyond the window
+func (w *connectivityWindow) add(sample connectivitySample) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.samples = append(w.samples, sample)
+	if len(w.samples) > w.size {
+		w.samples = w.samples[len(w.samples)-w.size:]
+	}
+	w.total++
+	if sample.err != nil {
+		w.failures++
+	}
+}
+
+// stats summarizes the window; it is false before the first probe
+func (w *connectivityWindow) stats() (ConnectivityStats, bool) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if len(w.samples) == 0 {
+		return ConnectivityStats{}, false
+	}
+	stats := ConnectivityStats{
+		URL:      w.url,
+		Samples:  len(w.samples),
+		Total:    w.total,
+		Failures: w.failures,
+	}
+	var succeeded int
+	var latency time.Duration
+	for _, sample := range w.samples {
+		if sample.err == nil {
+			succeeded++
+			latency += sample.latency
+		}
+	}
+	stats.SuccessRate = float64(succeeded) / float64(len(w.samples)) * 100
+	if succeeded > 0 {
+		stats.AverageLatency = latency / time.Duration(succeeded)
+	}
+	last := w.samples[len(w.samples)-1]
+	stats.LastCheck = last.at
+	if last.err != nil {
+		stats.LastError = last.err.Error()
+	} else {
+		stats.LastLatency = last.latency
+	}
+	return stats, true
+}
+
+// watchConnectivity probes connectivity on its interval while the clients
+// run
+func (a *Agent) watchConnectivity() {
+	defer a.wg.Done()
+
+	ticker := time.NewTicker(a.GetConfig().Services.Monitoring.Connectivity.Interval)
+	defer ticker.Stop()
+	for {
+		if a.ClientsStopped() == nil {
+			a.probeConnectivity(a.ctx)
+		}
+		select {
+		case <-a.ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// probeConnectivity fetches the probe URL through the proxy and records
+// the result
+func (a *Agent) probeConnectivity(ctx context.Context) {
+	cfg := a.GetConfig().Services.Monitoring.Connectivity
+	ctx, cancel := context.WithTimeout(ctx, cfg.Timeout)
+	defer cancel()
+
+	started := time.Now()
+	err := fetchThrough(ctx, cfg.URL, cfg.Proxy)
+	sample := connectivitySample{at: started, latency: time.Since(started), err: err}
+	if err != nil && a.runContext().Err() != nil {
+		// Stopping, not a failed probe
+		return
+	}
+	a.connectivity.add(sample)
+	if err != nil {
+		a.logger.Debug("Connectivity probe failed", map[string]interface{}{
+			"url":   cfg.URL,
+			"error": err.Error(),
+		})
+	}
+}
+
+// fetchThrough gets a URL, through a proxy URL when set, and fails on
+// error statuses
+func fetchThrough(ctx context.Context, target, proxy string) error {
+	transport := &http.Transport{DisableKeepAlives: true}
+	if proxy != "" {
+		proxyURL, err := url.Parse(proxy)
+		if err != nil {
+			return fmt.Errorf("invalid proxy: %w", err)
+		}
+		transport.Proxy = http.ProxyURL(proxyURL)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, target, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := (&http.Client{Transport: transport}).Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, maxConnectivityBody))
+	if resp.StatusCode >= 400 {
+		return fmt.Errorf("status %s", resp.Status)
+	}
+	return nil
+}
+
+// Connectivity returns the connectivity probe stats; it is false while the
+// probe is disabled or has not run yet. It does not lock the agent.
+func (a *Agent) Connectivity() (ConnectivityStats, bool) {
+	if a.connectivity == nil {
+		return ConnectivityStats{}, false
+	}
+	return a.connectivity.stats()
+}
+
+// connectivityCheck reports the connectivity probes as a health component:
+// unhealthy when every probe in the window failed, degraded below the
+// minimum success rate or above the maximum average latency
+type connectivityCheck struct {
+	agent *Agent
+}
+
+func (c connectivityCheck) Name() string {
+	return "connectivity"
+}
+
+func (c connectivityCheck) Check(ctx context.Context) health.ComponentHealth {
+	result := health.ComponentHealth{
+		Name:      c.Name(),
+		Status:    health.HealthStatusUnknown,
+		Message:   "no connectivity probe yet",
+		Timestamp: time.Now(),
+	}
+	stats, ok := c.agent.Connectivity()
+	if !ok {
+		return result
+	}
+	cfg := c.agent.GetConfig().Services.Monitoring.Connectivity
+	result.Data = map[string]interface{}{"connectivity": stats}
+	switch {
+	case stats.SuccessRate == 0:
+		result.Status = health.HealthStatusUnhealthy
+		result.Message = fmt.Sprintf("all %d probes of %s failed: %s", stats.Samples, stats.URL, stats.LastError)
+	case stats.SuccessRate < cfg.MinSuccessRate:
+		result.Status = health.HealthStatusDegraded
+		result.Message = fmt.Sprintf("%.0f%% of probes of %s succeeded", stats.SuccessRate, stats.URL)
+	case cfg.MaxLatency > 0 && stats.AverageLatency > cfg.MaxLatency:
+		result.Status = health.HealthStatusDegraded
+		result.Message = fmt.Sprintf("average latency to %s is %s", stats.URL, stats.AverageLatency.Round(time.Millisecond))
+	default:
+		result.Status = health.HealthStatusHealthy
+		result.Message = fmt.Sprintf("%s reachable in %s on average", stats.URL, stats.AverageLatency.Round(time.Millisecond))
+	}
+	return result
+}
+
+// writeConnectivityMetrics writes the connectivity probe stats in
+// Prometheus text format
+func (a *Agent) writeConnectivityMetrics(w io.Writer) {
+	stats, ok := a.Connectivity()
+	if !ok {
+		return
+	}
+	labels := a.labels.With(telemetry.LabelService, "connectivity").Prefix()
+	fmt.Fprintln(w, "# HELP sboxagent_connectivity_success_ratio Share of successful connectivity probes in the window.")
+	fmt.Fprintln(w, "# TYPE sboxagent_connectivity_success_ratio gauge")
+	fmt.Fprintf(w, "sboxagent_connectivity_success_ratio{%surl=%q} %g\n", labels, stats.URL, stats.SuccessRate/100)
+	fmt.Fprintln(w, "# HELP sboxagent_connectivity_latency_seconds Average latency of successful connectivity probes in the window.")
+	fmt.Fprintln(w, "# TYPE sboxagent_connectivity_latency_seconds gauge")
+	fmt.Fprintf(w, "sboxagent_connectivity_latency_seconds{%surl=%q} %g\n", labels, stats.URL, stats.AverageLatency.Seconds())
+	fmt.Fprintln(w, "# HELP sboxagent_connectivity_probes_total Connectivity probes run.")
+	fmt.Fprintln(w, "# TYPE sboxagent_connectivity_probes_total counter")
+	fmt.Fprintf(w, "sboxagent_connectivity_probes_total{%surl=%q} %d\n", labels, stats.URL, stats.Total)
+	fmt.Fprintln(w, "# HELP sboxagent_connectivity_failures_total Connectivity probes that failed.")
+	fmt.Fprintln(w, "# TYPE sboxagent_connectivity_failures_total counter")
+	fmt.Fprintf(w, "sboxagent_connectivity_failures_total{%surl=%q} %d\n", labels, stats.URL, stats.Failures)
+}
@@ -0,0 +1,95 @@
+package agent
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/kpblcaoo/sboxagent/internal/config"
+	"github.com/kpblcaoo/sboxagent/internal/health"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAgent_Connectivity(t *testing.T) {
+	failing := false
+	target := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if failing {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer target.Close()
+	// The client's HTTP inbound forwards requests to the target
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		resp, err := http.Get(r.URL.String())
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadGateway)
+			return
+		}
+		resp.Body.Close()
+		w.WriteHeader(resp.StatusCode)
+	}))
+	defer proxy.Close()
+
+	agent, err := New(&config.Config{
+		Agent: config.AgentConfig{Name: "connectivity-test", LogLevel: "error"},
+		Services: config.ServicesConfig{
+			Monitoring: config.MonitorConfig{Connectivity: config.ConnectivityConfig{
+				Enabled:        true,
+				URL:            target.URL + "/generate_204",
+				Proxy:          proxy.URL,
+				Interval:       time.Minute,
+				Timeout:        5 * time.Second,
+				Window:         4,
+				MinSuccessRate: 75,
+				MaxLatency:     5 * time.Second,
+			}},
+		},
+	})
+	require.NoError(t, err)
+	check := connectivityCheck{agent: agent}
+	ctx := context.Background()
+
+	_, ok := agent.Connectivity()
+	assert.False(t, ok)
+	assert.Equal(t, health.HealthStatusUnknown, check.Check(ctx).Status)
+	assert.NotContains(t, agent.GetStatus(), "connectivity")
+
+	for i := 0; i < 4; i++ {
+		agent.probeConnectivity(ctx)
+	}
+	stats, ok := agent.Connectivity()
+	require.True(t, ok)
+	assert.Equal(t, 4, stats.Samples)
+	assert.Equal(t, float64(100), stats.SuccessRate)
+	assert.Positive(t, stats.AverageLatency)
+	assert.Equal(t, health.HealthStatusHealthy, check.Check(ctx).Status)
+	assert.Contains(t, agent.GetStatus(), "connectivity")
+	assert.NotNil(t, agent.GetMetrics().Connectivity)
+
+	// One failure in four is still at the minimum success rate, two are not
+	failing = true
+	agent.probeConnectivity(ctx)
+	assert.Equal(t, health.HealthStatusHealthy, check.Check(ctx).Status)
+	agent.probeConnectivity(ctx)
+	stats, _ = agent.Connectivity()
+	assert.Equal(t, float64(50), stats.SuccessRate)
+	assert.Equal(t, "status 502 Bad Gateway", stats.LastError)
+	assert.Equal(t, health.HealthStatusDegraded, check.Check(ctx).Status)
+
+	// Every probe in the window failed
+	agent.probeConnectivity(ctx)
+	agent.probeConnectivity(ctx)
+	assert.Equal(t, health.HealthStatusUnhealthy, check.Check(ctx).Status)
+
+	var metrics strings.Builder
+	agent.writeConnectivityMetrics(&metrics)
+	assert.Contains(t, metrics.String(), `sboxagent_connectivity_success_ratio{agent_id="connectivity-test",service="connectivity",url="`+target.URL+`/generate_204"} 0`)
+	assert.Contains(t, metrics.String(), `sboxagent_connectivity_probes_total{agent_id="connectivity-test",service="connectivity",url="`+target.URL+`/generate_204"} 8`)
+	assert.Contains(t, metrics.String(), `sboxagent_connectivity_failures_total{agent_id="connectivity-test",service="connectivity",url="`+target.URL+`/generate_204"} 4`)
+}
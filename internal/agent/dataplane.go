@@ -0,0 +1,102 @@
+package agent
+
+import (
+	"fmt"
+	"time"
+)
+
+// ClientsStop describes managed clients stopped on demand
+type ClientsStop struct {
+	Unit       string    `json:"unit"`
+	KillSwitch bool      `json:"kill_switch"`
+	Reason     string    `json:"reason,omitempty"`
+	At         time.Time `json:"at"`
+}
+
+// StopClients stops the managed VPN clients while the agent's control plane
+// (API, socket, monitoring) keeps running. The kill switch, if enabled,
+// blocks traffic before the clients go down. sboxctl runs and scheduled
+// imports are paused until StartClients so they do not bring the clients
+// back.
+func (a *Agent) StopClients(reason string) (*ClientsStop, error) {
+	cfg := a.GetConfig()
+	if !cfg.Services.Systemd.Enabled {
+		return nil, fmt.Errorf("stopping clients requires services.systemd to be enabled")
+	}
+	if stop := a.ClientsStopped(); stop != nil {
+		return stop, nil
+	}
+
+	stop := &ClientsStop{
+		Unit:       cfg.Services.Systemd.ServiceName,
+		KillSwitch: cfg.Clients.KillSwitch.Enabled,
+		Reason:     reason,
+		At:         time.Now(),
+	}
+	a.mu.Lock()
+	a.clientsStop = stop
+	a.mu.Unlock()
+	a.pauseSboxctl(true)
+
+	// Block traffic first so nothing leaks while the clients go down
+	ctx := a.runContext()
+	timeout := cfg.Services.Systemd.Timeout
+	if stop.KillSwitch {
+		if err := a.runCommand(ctx, cfg.Services.CLI.ActionTimeout("kill_switch", timeout), cfg.Clients.KillSwitch.Command); err != nil {
+			return stop, fmt.Errorf("failed to apply kill switch: %w", err)
+		}
+	}
+	if err := a.controlUnit(ctx, "stop"); err != nil {
+		return stop, fmt.Errorf("failed to stop %s: %w", stop.Unit, err)
+	}
+
+	a.logger.Info("Stopped clients", map[string]interface{}{
+		"unit":       stop.Unit,
+		"killSwitch": stop.KillSwitch,
+		"reason":     reason,
+	})
+	a.publishEvent("CLIENTS_STOPPED", stop)
+	return stop, nil
+}
+
+// StartClients starts clients stopped by StopClients, lifts the kill switch
+// and resumes sboxctl runs and scheduled imports
+func (a *Agent) StartClients() error {
+	stop := a.ClientsStopped()
+	if stop == nil {
+		return nil
+	}
+
+	cfg := a.GetConfig()
+	ctx := a.runContext()
+	timeout := cfg.Services.Systemd.Timeout
+	if err := a.controlUnit(ctx, "start"); err != nil {
+		return fmt.Errorf("failed to start %s: %w", stop.Unit, err)
+	}
+	if stop.KillSwitch {
+		if err := a.runCommand(ctx, cfg.Services.CLI.ActionTimeout("kill_switch", timeout), cfg.Clients.KillSwitch.ReleaseCommand); err != nil {
+			return fmt.Errorf("failed to release kill switch: %w", err)
+		}
+	}
+
+	a.mu.Lock()
+	a.clientsStop = nil
+	a.mu.Unlock()
+	a.pauseSboxctl(false)
+
+	a.logger.Info("Started clients", map[string]interface{}{
+		"unit": stop.Unit,
+	})
+	a.publishEvent("CLIENTS_STARTED", map[string]interface{}{
+		"unit": stop.Unit,
+	})
+	return nil
+}
+
+// ClientsStopped returns the current on-demand stop of the clients, or nil
+// if they are running
+func (a *Agent) ClientsStopped() *ClientsStop {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	return a.clientsStop
+}
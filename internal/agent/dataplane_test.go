@@ -0,0 +1,66 @@
+package agent
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/kpblcaoo/sboxagent/internal/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAgent_StopStartClients(t *testing.T) {
+	// A fake systemctl records the calls made to it
+	dir := t.TempDir()
+	calls := filepath.Join(dir, "calls")
+	script := "#!/bin/sh\necho \"systemctl $*\" >> " + calls + "\n"
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "systemctl"), []byte(script), 0755))
+	t.Setenv("PATH", dir+string(os.PathListSeparator)+os.Getenv("PATH"))
+
+	cfg := &config.Config{
+		Agent: config.AgentConfig{Name: "dataplane-test", LogLevel: "error"},
+		Services: config.ServicesConfig{
+			Systemd: config.SystemdConfig{Enabled: true, ServiceName: "sing-box", UserMode: true, Timeout: 5 * time.Second, Backend: "systemctl", InitSystem: "systemd"},
+		},
+		Clients: config.ClientsConfig{
+			KillSwitch: config.KillSwitchConfig{
+				Enabled:        true,
+				Command:        []string{"sh", "-c", "echo block >> " + calls},
+				ReleaseCommand: []string{"sh", "-c", "echo release >> " + calls},
+			},
+		},
+	}
+	agent, err := New(cfg)
+	require.NoError(t, err)
+	assert.Nil(t, agent.ClientsStopped())
+
+	stop, err := agent.StopClients("disconnect from UI")
+	require.NoError(t, err)
+	assert.Equal(t, "sing-box", stop.Unit)
+	assert.True(t, stop.KillSwitch)
+	assert.Equal(t, stop, agent.ClientsStopped())
+	assert.Equal(t, stop, agent.GetStatus()["clients_stopped"])
+
+	// Stopping again is a no-op
+	_, err = agent.StopClients("again")
+	require.NoError(t, err)
+
+	require.NoError(t, agent.StartClients())
+	assert.Nil(t, agent.ClientsStopped())
+	assert.NotContains(t, agent.GetStatus(), "clients_stopped")
+
+	data, err := os.ReadFile(calls)
+	require.NoError(t, err)
+	assert.Equal(t, "block\nsystemctl --user stop sing-box\nsystemctl --user start sing-box\nrelease\n", string(data))
+}
+
+func TestAgent_StopClientsRequiresSystemd(t *testing.T) {
+	agent, err := New(&config.Config{Agent: config.AgentConfig{Name: "dataplane-test", LogLevel: "error"}})
+	require.NoError(t, err)
+
+	_, err = agent.StopClients("")
+	assert.ErrorContains(t, err, "requires services.systemd")
+	assert.Nil(t, agent.ClientsStopped())
+}
@@ -0,0 +1,112 @@
+package agent
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/kpblcaoo/sboxagent/internal/config"
+	"github.com/kpblcaoo/sboxagent/internal/process"
+	"github.com/kpblcaoo/sboxagent/internal/services"
+)
+
+// configureSubprocesses passes the agent's environment, with each service's
+// own variables, working directory, user and limits, to services that run
+// subprocesses, along with the sboxctl command template variables and hooks
+func (a *Agent) configureSubprocesses() {
+	cfg := a.GetConfig()
+	env := a.subprocessEnv()
+	if a.importer != nil {
+		cli := cfg.Services.CLI
+		a.importer.SetEnv(cli.Environ(env))
+		a.importer.SetDir(cli.WorkDir)
+		a.importer.SetCredential(a.cliUser)
+		a.importer.SetLimits(processLimits(cli.Limits))
+		a.importer.SetPool(a.commands)
+		a.importer.SetHistory(a.runs)
+	}
+	a.configureInstances(env)
+	if a.supervisor != nil {
+		a.supervisor.SetEnv(env)
+	}
+	if a.sboxctlService == nil {
+		return
+	}
+	a.sboxctlService.SetEnv(cfg.Services.Sboxctl.Environ(env))
+	a.sboxctlService.SetCredential(a.sboxctlUser)
+	a.sboxctlService.SetLimits(processLimits(cfg.Services.Sboxctl.Limits))
+	a.sboxctlService.SetHistory(a.runs)
+	a.sboxctlService.SetCommandVars(a.commandVars())
+	a.sboxctlService.SetRunHook(a.onSboxctlRun)
+	a.sboxctlService.SetCircuitHook(a.onSboxctlCircuit)
+	a.sboxctlService.SetStderrHook(a.onSboxctlStderr)
+}
+
+// lookupSubprocessUsers resolves the users sboxctl and sboxmgr run as.
+// They are resolved once, so changing them takes a restart.
+func (a *Agent) lookupSubprocessUsers() error {
+	var err error
+	if a.sboxctlUser, err = lookupUser(a.config.Services.Sboxctl.SubprocessConfig); err != nil {
+		return fmt.Errorf("failed to resolve sboxctl user: %w", err)
+	}
+	if a.cliUser, err = lookupUser(a.config.Services.CLI.SubprocessConfig); err != nil {
+		return fmt.Errorf("failed to resolve sboxmgr user: %w", err)
+	}
+	return a.lookupInstanceUsers()
+}
+
+// lookupUser returns the credential of a service's configured user, or nil
+// if it runs as the agent's user
+func lookupUser(cfg config.SubprocessConfig) (*process.Credential, error) {
+	if cfg.User == "" {
+		return nil, nil
+	}
+	return process.LookupCredential(cfg.User, cfg.Group)
+}
+
+// processLimits converts configured limits, returning nil if none are set
+func processLimits(cfg config.ResourceLimits) *process.Limits {
+	limits := &process.Limits{
+		CPUTime:   cfg.CPUTime,
+		Memory:    uint64(cfg.MemoryMB) << 20,
+		OpenFiles: uint64(cfg.OpenFiles),
+	}
+	if limits.IsZero() {
+		return nil
+	}
+	return limits
+}
+
+// onSboxctlStderr adds a stderr line of sboxctl to the log aggregator
+func (a *Agent) onSboxctlStderr(level, line string) {
+	a.addStderr("sboxctl", level, line)
+}
+
+// commandVars returns the variables available to command templates
+func (a *Agent) commandVars() services.CommandVars {
+	cfg := a.GetConfig()
+	vars := services.CommandVars{
+		ConfigPath: cfg.Path(),
+		Profile:    cfg.Agent.Profile,
+		AgentName:  cfg.Agent.Name,
+	}
+	if a.socketServer != nil {
+		vars.SocketPath = a.socketServer.SocketPath
+	}
+	return vars
+}
+
+// subprocessEnv returns the sanitized environment for subprocesses, with
+// variables describing the agent injected
+func (a *Agent) subprocessEnv() []string {
+	cfg := a.GetConfig()
+	injected := map[string]string{
+		"SBOX_AGENT_NAME": cfg.Agent.Name,
+	}
+	if path := cfg.Path(); path != "" {
+		injected["SBOX_AGENT_CONFIG"] = path
+	}
+	if a.socketServer != nil {
+		injected["SBOX_AGENT_SOCKET"] = a.socketServer.SocketPath
+	}
+	return cfg.Services.Environment.Environ(os.Environ(), injected)
+}
@@ -0,0 +1,120 @@
+package agent
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/kpblcaoo/sboxagent/internal/importer"
+	"github.com/kpblcaoo/sboxagent/internal/initsys"
+)
+
+// startLimitHit is the sub-state of a client unit the supervisor gave up
+// restarting
+const startLimitHit = "start-limit-hit"
+
+// escalateClientFailure raises a critical alert when the supervisor gave up
+// restarting a client that kept crashing. With
+// services.supervisor.fallback_config the client's previous config is then
+// restored and the client started again, once until a new config is
+// applied, so a bad config does not leave the host without a proxy.
+func (a *Agent) escalateClientFailure(state initsys.UnitState) {
+	if state.SubState != startLimitHit {
+		return
+	}
+	client := ""
+	for name, unit := range a.clientUnits.Units() {
+		if unit == state.Unit {
+			client = name
+		}
+	}
+	if client == "" {
+		return
+	}
+
+	cfg := a.GetConfig().Services.Supervisor
+	a.logger.Error("Client keeps crashing, restarts stopped", map[string]interface{}{
+		"client":        client,
+		"unit":          state.Unit,
+		"maxRestarts":   cfg.MaxRestarts,
+		"restartWindow": cfg.RestartWindow.String(),
+	})
+	a.publishEvent("CLIENT_RESTARTS_EXHAUSTED", map[string]interface{}{
+		"severity":      "critical",
+		"client":        client,
+		"unit":          state.Unit,
+		"maxRestarts":   cfg.MaxRestarts,
+		"restartWindow": cfg.RestartWindow.String(),
+		"fallback":      cfg.FallbackConfig,
+	})
+	if !cfg.FallbackConfig {
+		return
+	}
+
+	a.mu.Lock()
+	done := a.fallbacks[client]
+	if a.fallbacks == nil {
+		a.fallbacks = make(map[string]bool)
+	}
+	a.fallbacks[client] = true
+	a.mu.Unlock()
+	if done {
+		a.logger.Warn("Client already fell back to its previous config", map[string]interface{}{
+			"client": client,
+		})
+		return
+	}
+
+	backup, err := a.fallBack(a.runContext(), client)
+	if err != nil {
+		a.logger.Error("Failed to fall back to the previous config", map[string]interface{}{
+			"client": client,
+			"error":  err.Error(),
+		})
+		a.publishEvent("CLIENT_FALLBACK_FAILED", map[string]interface{}{
+			"severity": "critical",
+			"client":   client,
+			"error":    err.Error(),
+		})
+		return
+	}
+	a.logger.Warn("Client fell back to its previous config", map[string]interface{}{
+		"client": client,
+		"backup": backup,
+	})
+	a.publishEvent("CLIENT_FALLBACK", map[string]interface{}{
+		"client": client,
+		"backup": backup,
+	})
+}
+
+// fallBack restores the newest backup of a client's config, the config it
+// ran before the last one was applied, and starts the client again. It
+// returns the name of the restored backup.
+func (a *Agent) fallBack(ctx context.Context, client string) (string, error) {
+	_, path, err := a.clientConfigPath(client)
+	if err != nil {
+		return "", err
+	}
+	backups, err := importer.ListBackups(path)
+	if err != nil {
+		return "", err
+	}
+	if len(backups) == 0 {
+		return "", fmt.Errorf("no previous config of %s to fall back to", client)
+	}
+	if _, err := importer.RestoreBackup(path, backups[0].Name); err != nil {
+		return "", err
+	}
+	if _, err := a.clientUnits.Control(ctx, client, UnitStart); err != nil {
+		return backups[0].Name, fmt.Errorf("failed to start %s: %w", client, err)
+	}
+	return backups[0].Name, nil
+}
+
+// clearFallback allows a client to fall back again once a new config is
+// applied
+func (a *Agent) clearFallback(client string) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	delete(a.fallbacks, client)
+}
@@ -0,0 +1,66 @@
+package agent
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/kpblcaoo/sboxagent/internal/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAgent_ClientFailureFallback(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("requires sh")
+	}
+	// A fake sing-box crashes unless its config is the good one
+	dir := t.TempDir()
+	clientConfig := filepath.Join(dir, "config.json")
+	binary := filepath.Join(dir, "sing-box")
+	require.NoError(t, os.WriteFile(binary, []byte("#!/bin/sh\ngrep -q good "+clientConfig+" || exit 1\nexec sleep 30\n"), 0755))
+	require.NoError(t, os.WriteFile(clientConfig, []byte(`{"bad":true}`), 0644))
+	stamp := time.Now().Add(-time.Minute).Format("20060102-150405")
+	require.NoError(t, os.WriteFile(clientConfig+"."+stamp+".bak", []byte(`{"good":true}`), 0644))
+
+	agent, err := New(&config.Config{
+		Agent: config.AgentConfig{Name: "fallback-test", LogLevel: "error"},
+		Services: config.ServicesConfig{
+			Systemd: config.SystemdConfig{Timeout: 10 * time.Second},
+			Supervisor: config.SupervisorConfig{Mode: config.SupervisorOn, RestartDelay: 10 * time.Millisecond, MaxRestartDelay: 10 * time.Millisecond,
+				MaxRestarts: 1, RestartWindow: time.Minute, StopTimeout: 5 * time.Second, FallbackConfig: true},
+		},
+		Clients: config.ClientsConfig{
+			SingBox: config.SingBoxConfig{Enabled: true, BinaryPath: binary, ConfigPath: clientConfig},
+		},
+	})
+	require.NoError(t, err)
+	t.Cleanup(agent.supervisor.StopAll)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go agent.supervisor.Watch(ctx, []string{"sing-box"}, agent.escalateClientFailure)
+	_, err = agent.ClientUnits().Control(ctx, "sing-box", UnitStart)
+	require.NoError(t, err)
+
+	// Once restarts are exhausted the previous config is restored and the
+	// client started again
+	require.Eventually(t, func() bool {
+		data, _ := os.ReadFile(clientConfig)
+		return string(data) == `{"good":true}`
+	}, 10*time.Second, 10*time.Millisecond)
+	require.Eventually(t, func() bool {
+		status, ok := agent.supervisor.Status()["sing-box"]
+		return ok && status.PID != 0
+	}, 5*time.Second, 10*time.Millisecond)
+
+	// Falling back happens once until a new config is applied
+	agent.mu.RLock()
+	assert.True(t, agent.fallbacks["sing-box"])
+	agent.mu.RUnlock()
+	agent.clearFallback("sing-box")
+	assert.NotContains(t, agent.fallbacks, "sing-box")
+}
@@ -0,0 +1,141 @@
+package agent
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/kpblcaoo/sboxagent/internal/config"
+	"github.com/kpblcaoo/sboxagent/internal/health"
+	"github.com/kpblcaoo/sboxagent/internal/process"
+)
+
+// execCheckStatus maps the exit codes of exec health checks to statuses
+var execCheckStatus = map[int]health.HealthStatus{
+	0: health.HealthStatusHealthy,
+	1: health.HealthStatusDegraded,
+	2: health.HealthStatusUnhealthy,
+}
+
+// execCheck runs an operator-provided command as a health check
+type execCheck struct {
+	agent  *Agent
+	config config.ExecCheckConfig
+}
+
+func (c execCheck) Name() string {
+	return c.config.Name
+}
+
+func (c execCheck) Check(ctx context.Context) health.ComponentHealth {
+	result := health.ComponentHealth{
+		Name:      c.config.Name,
+		Status:    health.HealthStatusUnhealthy,
+		Timestamp: time.Now(),
+	}
+	if c.config.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, c.config.Timeout)
+		defer cancel()
+	}
+
+	started := time.Now()
+	output, code, err := c.agent.runCheck(ctx, c.config.Command)
+	result.Data = map[string]interface{}{
+		"command":  c.config.Command,
+		"duration": time.Since(started).String(),
+	}
+	if code >= 0 {
+		result.Data["exitCode"] = code
+	}
+	switch {
+	case ctx.Err() != nil:
+		result.Message = "check timed out"
+	case code < 0:
+		result.Message = err.Error()
+	default:
+		if status, ok := execCheckStatus[code]; ok {
+			result.Status = status
+		}
+		result.Message = output
+		if output == "" && err != nil {
+			result.Message = err.Error()
+		}
+	}
+	return result
+}
+
+// runCheck runs a check command, returning the first line of its output and
+// its exit code, which is -1 when the command did not run to completion
+func (a *Agent) runCheck(ctx context.Context, command []string) (string, int, error) {
+	release, err := a.commands.Acquire(ctx)
+	if err != nil {
+		return "", -1, err
+	}
+	defer release()
+
+	var output bytes.Buffer
+	cmd := exec.CommandContext(ctx, command[0], command[1:]...)
+	cmd.Env = a.subprocessEnv()
+	cmd.Stdout = &output
+	cmd.Stderr = &output
+	process.Prepare(cmd)
+	if err := process.Start(cmd); err != nil {
+		return "", -1, err
+	}
+	err = process.Wait(cmd)
+	line, _, _ := strings.Cut(strings.TrimSpace(output.String()), "\n")
+	var exitErr *exec.ExitError
+	switch {
+	case err == nil:
+		return line, 0, nil
+	case errors.As(err, &exitErr) && exitErr.ExitCode() >= 0:
+		return line, exitErr.ExitCode(), err
+	default:
+		return line, -1, err
+	}
+}
+
+// diskPaths returns the paths the agent writes to, for the disk check:
+// its config directory, data and spool directories, the directories of the
+// enabled clients' configs, which hold their backups, the audit log and
+// the configured extra paths
+func (a *Agent) diskPaths() []string {
+	cfg := a.GetConfig()
+	candidates := []string{config.DefaultDataDir, cfg.Notifications.SpoolDir, cfg.Services.Sboxctl.Record.Dir}
+	if path := cfg.Path(); path != "" {
+		candidates = append(candidates, filepath.Dir(path))
+	}
+	for _, file := range []string{cfg.Remote.CacheFile, cfg.Logging.Audit.File} {
+		if file != "" {
+			candidates = append(candidates, filepath.Dir(file))
+		}
+	}
+	for _, name := range config.ClientNames {
+		if !cfg.Clients.Enabled(name) {
+			continue
+		}
+		if path, _ := cfg.Clients.ConfigPath(name); path != "" {
+			candidates = append(candidates, filepath.Dir(path))
+		}
+	}
+	candidates = append(candidates, cfg.Health.Disk.Paths...)
+
+	var paths []string
+	seen := make(map[string]bool, len(candidates))
+	for _, path := range candidates {
+		if path == "" {
+			continue
+		}
+		path = filepath.Clean(path)
+		if !seen[path] {
+			seen[path] = true
+			paths = append(paths, path)
+		}
+	}
+	return paths
+}
@@ -0,0 +1,84 @@
+package agent
+
+import (
+	"context"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/kpblcaoo/sboxagent/internal/config"
+	"github.com/kpblcaoo/sboxagent/internal/health"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestExecCheck(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("requires sh")
+	}
+	agent, err := New(&config.Config{
+		Agent: config.AgentConfig{Name: "exec-check-test", LogLevel: "error"},
+	})
+	require.NoError(t, err)
+
+	tests := []struct {
+		name    string
+		script  string
+		timeout time.Duration
+		status  health.HealthStatus
+		message string
+	}{
+		{"healthy", "echo route ok", 0, health.HealthStatusHealthy, "route ok"},
+		{"degraded", "echo slow; echo details; exit 1", 0, health.HealthStatusDegraded, "slow"},
+		{"unhealthy", "echo down >&2; exit 2", 0, health.HealthStatusUnhealthy, "down"},
+		{"unknown code", "exit 3", 0, health.HealthStatusUnhealthy, "exit status 3"},
+		{"timeout", "sleep 5", 100 * time.Millisecond, health.HealthStatusUnhealthy, "check timed out"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			check := execCheck{agent: agent, config: config.ExecCheckConfig{
+				Name:    "custom",
+				Command: []string{"sh", "-c", tt.script},
+				Timeout: tt.timeout,
+			}}
+			result := check.Check(context.Background())
+			assert.Equal(t, "custom", result.Name)
+			assert.Equal(t, tt.status, result.Status)
+			assert.Equal(t, tt.message, result.Message)
+		})
+	}
+
+	check := execCheck{agent: agent, config: config.ExecCheckConfig{Name: "missing", Command: []string{"/nonexistent/check"}}}
+	result := check.Check(context.Background())
+	assert.Equal(t, health.HealthStatusUnhealthy, result.Status)
+	assert.NotEmpty(t, result.Message)
+}
+
+func TestAgent_DiskPaths(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("uses unix paths")
+	}
+	original := config.DefaultDataDir
+	config.DefaultDataDir = "/var/lib/sboxagent"
+	defer func() { config.DefaultDataDir = original }()
+
+	agent, err := New(&config.Config{
+		Agent:         config.AgentConfig{Name: "disk-test", LogLevel: "error"},
+		Notifications: config.NotificationsConfig{SpoolDir: "/var/lib/sboxagent/spool"},
+		Remote:        config.RemoteConfig{CacheFile: "/var/lib/sboxagent/remote-config.yaml"},
+		Logging:       config.LoggingConfig{Audit: config.AuditConfig{File: "/var/log/sboxagent/audit.log"}},
+		Clients: config.ClientsConfig{
+			SingBox: config.SingBoxConfig{Enabled: true, ConfigPath: "/etc/sing-box/config.json"},
+			Xray:    config.XrayConfig{ConfigPath: "/etc/xray/config.json"},
+		},
+		Health: config.HealthConfig{Disk: config.DiskCheckConfig{Paths: []string{"/srv/backups/", "/etc/sing-box"}}},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, []string{
+		"/var/lib/sboxagent",
+		"/var/lib/sboxagent/spool",
+		"/var/log/sboxagent",
+		"/etc/sing-box",
+		"/srv/backups",
+	}, agent.diskPaths())
+}
@@ -0,0 +1,407 @@
+package agent
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/kpblcaoo/sboxagent/internal/importer"
+	"github.com/kpblcaoo/sboxagent/internal/ports"
+	"github.com/kpblcaoo/sboxagent/internal/process"
+	"github.com/kpblcaoo/sboxagent/internal/socket"
+	"github.com/kpblcaoo/sboxagent/internal/telemetry"
+)
+
+// ImportResult describes a completed scheduled import
+type ImportResult struct {
+	ClientType string `json:"clientType"`
+	Source     string `json:"source,omitempty"`
+	ConfigPath string `json:"configPath"`
+	BackupPath string `json:"backupPath,omitempty"`
+	Checksum   string `json:"checksum"`
+	Reloaded   bool   `json:"reloaded"`
+	Verified   bool   `json:"verified"`
+	// Warnings name config features the installed client is too old for
+	Warnings []string `json:"warnings,omitempty"`
+}
+
+// pollImports runs the import pipeline on its schedule
+func (a *Agent) pollImports() {
+	defer a.wg.Done()
+
+	ticker := time.NewTicker(a.GetConfig().Import.Schedule)
+	defer ticker.Stop()
+
+	for {
+		if !a.isActive() {
+			a.logger.Debug("Skipping scheduled import on passive agent", map[string]interface{}{})
+		} else if a.ClientsStopped() != nil {
+			a.logger.Debug("Skipping scheduled import while clients are stopped", map[string]interface{}{})
+		} else if _, err := a.runImports(a.ctx); err != nil && a.ctx.Err() == nil {
+			a.logger.Error("Scheduled import failed", map[string]interface{}{
+				"client": a.importClients(),
+				"error":  err.Error(),
+			})
+			a.publishEvent("IMPORT_FAILED", importFailure(a.importClients(), err))
+		}
+
+		select {
+		case <-a.ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// probeSboxmgr detects the sboxmgr version so imports use its flags.
+// Unsupported versions fail the start; a failed probe only warns, leaving
+// imports to report sboxmgr errors.
+func (a *Agent) probeSboxmgr() error {
+	version, err := a.importer.Probe(a.runContext())
+	switch {
+	case errors.Is(err, importer.ErrUnsupportedVersion):
+		return fmt.Errorf("refusing to import with sboxmgr: %w", err)
+	case err != nil:
+		a.logger.Warn("Failed to detect sboxmgr version", map[string]interface{}{
+			"error": err.Error(),
+		})
+	default:
+		a.logger.Info("Detected sboxmgr", map[string]interface{}{
+			"version": version.String(),
+		})
+	}
+	return nil
+}
+
+// runImport runs the update pipeline of the import client
+func (a *Agent) runImport(ctx context.Context) (*ImportResult, error) {
+	pipeline, err := a.NewUpdatePipeline(a.GetConfig().Import.ClientType)
+	if err != nil {
+		return nil, err
+	}
+	return pipeline.Run(ctx)
+}
+
+// runImports runs the update of import.clients as one transaction, or the
+// pipeline of the import client when no clients are listed
+func (a *Agent) runImports(ctx context.Context) ([]*ImportResult, error) {
+	clients := a.GetConfig().Import.Clients
+	if len(clients) == 0 {
+		result, err := a.runImport(ctx)
+		if err != nil {
+			return nil, err
+		}
+		return []*ImportResult{result}, nil
+	}
+	update, err := a.NewMultiUpdate(clients)
+	if err != nil {
+		return nil, err
+	}
+	return update.Run(ctx)
+}
+
+// importClients names the clients imports apply to, for logs and events
+func (a *Agent) importClients() string {
+	cfg := a.GetConfig().Import
+	if len(cfg.Clients) == 0 {
+		return cfg.ClientType
+	}
+	return strings.Join(cfg.Clients, ",")
+}
+
+// DryRunUpdate reports what an update of a client's config would change,
+// defaulting to the import client type
+func (a *Agent) DryRunUpdate(ctx context.Context, client string) (*UpdatePreview, error) {
+	if a.importer == nil {
+		return nil, fmt.Errorf("config import is disabled")
+	}
+	pipeline, err := a.NewUpdatePipeline(client)
+	if err != nil {
+		return nil, err
+	}
+	return pipeline.DryRun(ctx)
+}
+
+// importFailure describes a failed import for the IMPORT_FAILED event,
+// including the exit code and stderr of a failed sboxmgr run and the owner
+// of a conflicting port
+func importFailure(clientType string, err error) map[string]interface{} {
+	data := map[string]interface{}{
+		"clientType": clientType,
+		"error":      err.Error(),
+		"severity":   "error",
+	}
+	var sboxmgrErr *importer.SboxmgrError
+	if errors.As(err, &sboxmgrErr) {
+		data["attempts"] = sboxmgrErr.Attempts
+		data["exitCode"] = sboxmgrErr.ExitCode
+		data["timedOut"] = sboxmgrErr.TimedOut
+		data["stderr"] = sboxmgrErr.Stderr
+		data["transient"] = sboxmgrErr.Transient
+	}
+	var inUse *ports.InUseError
+	if errors.As(err, &inUse) {
+		data["port"] = inUse.Listener.Port
+		data["network"] = inUse.Listener.Network
+		if inUse.PID != 0 {
+			data["pid"] = inUse.PID
+			data["process"] = inUse.Process
+		}
+	}
+	return data
+}
+
+// checkPorts fails if an inbound port of a client config is taken by a
+// process other than the client itself
+func (a *Agent) checkPorts(clientType string, data []byte) error {
+	listeners, err := ports.Listeners(clientType, data)
+	if err != nil || len(listeners) == 0 {
+		return err
+	}
+	binary, _ := a.GetConfig().Clients.BinaryPath(clientType)
+	if binary == "" {
+		binary = clientType
+	}
+	return ports.NewChecker().Check(listeners, binary)
+}
+
+// checkClientConfig writes a client config, with its secrets, to a private
+// temporary file and runs the client's own checker on it. Configs the
+// client rejects fail with the checker's output. Clients without a checker
+// or whose binary is not installed are not checked.
+func (a *Agent) checkClientConfig(ctx context.Context, clientType, path string, data []byte) error {
+	cfg := a.GetConfig()
+	command, ok := cfg.Clients.CheckCommand(clientType, "")
+	if !ok {
+		return nil
+	}
+	if _, err := exec.LookPath(command[0]); err != nil {
+		a.logger.Debug("Client binary not installed, config not checked", map[string]interface{}{
+			"client": clientType,
+			"binary": command[0],
+		})
+		return nil
+	}
+	data, err := importer.InjectSecrets(data, cfg.Import.Secrets)
+	if err != nil {
+		return fmt.Errorf("failed to inject secrets: %w", err)
+	}
+
+	// Keep the extension, clients pick the config format by it
+	tmp, err := os.CreateTemp("", "sboxagent-check-*"+filepath.Ext(path))
+	if err != nil {
+		return fmt.Errorf("failed to write config to check: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write config to check: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to write config to check: %w", err)
+	}
+
+	command, _ = cfg.Clients.CheckCommand(clientType, tmp.Name())
+	output, err := a.combinedOutput(ctx, cfg.Services.CLI.ActionTimeout("check", cfg.Import.Timeout), command)
+	if err != nil {
+		if message := strings.TrimSpace(string(output)); message != "" {
+			return fmt.Errorf("%s rejected the config: %w: %s", clientType, err, message)
+		}
+		return fmt.Errorf("%s rejected the config: %w", clientType, err)
+	}
+	return nil
+}
+
+// combinedOutput runs a command like runCommand, returning its stdout and
+// stderr together
+func (a *Agent) combinedOutput(ctx context.Context, timeout time.Duration, command []string) ([]byte, error) {
+	release, err := a.commands.Acquire(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	var output bytes.Buffer
+	cmd := exec.CommandContext(ctx, command[0], command[1:]...)
+	cmd.Env = a.subprocessEnv()
+	cmd.Stdout = &output
+	cmd.Stderr = &output
+	process.Prepare(cmd)
+	if err := process.Start(cmd); err != nil {
+		return nil, err
+	}
+	err = process.Wait(cmd)
+	return output.Bytes(), err
+}
+
+// hotReloadable are the clients that reload their config in place, on
+// SIGHUP or their unit's reload, without dropping connections
+var hotReloadable = map[string]bool{"sing-box": true, "xray": true, "clash": true}
+
+// canReload tells whether a client's new config can be picked up: by the
+// import reload_command for the import client, or by hot reloading the
+// client's unit
+func (a *Agent) canReload(client string) bool {
+	cfg := a.GetConfig().Import
+	if len(cfg.ReloadCommand) > 0 && client == cfg.ClientType {
+		return true
+	}
+	if !cfg.HotReload || a.clientUnits == nil {
+		return false
+	}
+	_, ok := a.clientUnits.Units()[client]
+	return ok
+}
+
+// reloadClient makes a client pick up its new config, see canReload
+func (a *Agent) reloadClient(ctx context.Context, client string) error {
+	cfg := a.GetConfig()
+	if command := cfg.Import.ReloadCommand; len(command) > 0 && client == cfg.Import.ClientType {
+		return a.runCommand(ctx, cfg.Services.CLI.ActionTimeout("reload", cfg.Import.Timeout), command)
+	}
+	return a.hotReload(ctx, client)
+}
+
+// hotReload reloads a client's unit so it keeps its connections, falling
+// back to a restart for clients that cannot reload or fail to
+func (a *Agent) hotReload(ctx context.Context, client string) error {
+	if hotReloadable[client] {
+		_, err := a.clientUnits.Control(ctx, client, UnitReload)
+		if err == nil {
+			return nil
+		}
+		a.logger.Warn("Failed to reload client, restarting it", map[string]interface{}{
+			"client": client,
+			"error":  err.Error(),
+		})
+	}
+	_, err := a.clientUnits.Control(ctx, client, UnitRestart)
+	return err
+}
+
+// runCommand runs a command with the subprocess environment in its own
+// process group, killing it after timeout. It waits for a slot in the
+// command pool first.
+func (a *Agent) runCommand(ctx context.Context, timeout time.Duration, command []string) error {
+	release, err := a.commands.Acquire(ctx)
+	if err != nil {
+		return err
+	}
+	defer release()
+
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	cmd := exec.CommandContext(ctx, command[0], command[1:]...)
+	cmd.Env = a.subprocessEnv()
+	process.Prepare(cmd)
+	if err := process.Start(cmd); err != nil {
+		return err
+	}
+	return process.Wait(cmd)
+}
+
+// clientConfigPath returns the config path of a client, defaulting to the
+// import client type
+func (a *Agent) clientConfigPath(client string) (string, string, error) {
+	cfg := a.GetConfig()
+	if client == "" {
+		client = cfg.Import.ClientType
+	}
+	path, ok := cfg.Clients.ConfigPath(client)
+	if !ok {
+		return "", "", fmt.Errorf("unknown client %q", client)
+	}
+	if path == "" {
+		return "", "", fmt.Errorf("client %s has no config_path", client)
+	}
+	return client, path, nil
+}
+
+// ListBackups returns the config backups of a client, newest first. An
+// empty client selects the import client type.
+func (a *Agent) ListBackups(client string) ([]importer.Backup, error) {
+	_, path, err := a.clientConfigPath(client)
+	if err != nil {
+		return nil, err
+	}
+	return importer.ListBackups(path)
+}
+
+// RestoreBackup restores the named config backup of a client and reloads it
+// if it is the import client. The replaced config is backed up in turn. It
+// fails while the config is leased.
+func (a *Agent) RestoreBackup(client, name string) (string, error) {
+	client, path, err := a.clientConfigPath(client)
+	if err != nil {
+		return "", err
+	}
+	if lease, ok := a.leases.active(client, time.Now()); ok {
+		return "", fmt.Errorf("%w by %s until %s", ErrConfigLeased, lease.Holder, lease.ExpiresAt.Format(time.RFC3339))
+	}
+	backup, err := importer.RestoreBackup(path, name)
+	if err != nil {
+		return "", err
+	}
+
+	if a.canReload(client) {
+		if err := a.reloadClient(a.runContext(), client); err != nil {
+			return backup, fmt.Errorf("failed to reload %s: %w", client, err)
+		}
+	}
+
+	a.logger.Info("Restored client configuration", map[string]interface{}{
+		"client": client,
+		"backup": name,
+		"path":   path,
+	})
+	a.publishEvent("BACKUP_RESTORED", map[string]interface{}{
+		"clientType": client,
+		"backup":     name,
+		"configPath": path,
+	})
+	return backup, nil
+}
+
+// runContext returns the agent context, or a background context before the
+// agent has started
+func (a *Agent) runContext() context.Context {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	if a.ctx == nil {
+		return context.Background()
+	}
+	return a.ctx
+}
+
+// publishEvent sends an agent event to socket clients and notification
+// channels
+func (a *Agent) publishEvent(eventType string, data interface{}) {
+	a.notifyEvent(eventType, data)
+
+	if a.socketServer == nil {
+		return
+	}
+	msg := socket.NewEventMessage(map[string]interface{}{
+		"source":    "agent",
+		"type":      eventType,
+		"data":      data,
+		"timestamp": time.Now().UTC().Format(time.RFC3339),
+		"labels":    a.labels.With(telemetry.LabelService, "agent"),
+	})
+	if err := a.socketServer.Publish(msg); err != nil {
+		a.logger.Warn("Failed to publish agent event", map[string]interface{}{
+			"type":  eventType,
+			"error": err.Error(),
+		})
+	}
+}
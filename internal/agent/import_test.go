@@ -0,0 +1,220 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/kpblcaoo/sboxagent/internal/config"
+	"github.com/kpblcaoo/sboxagent/internal/importer"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeSboxmgr writes a sboxmgr script to dir that prints payload as a
+// sing-box config and returns the script and the payload checksum
+func fakeSboxmgr(t *testing.T, dir, payload string) (string, string) {
+	checksum, err := importer.Checksum([]byte(payload))
+	require.NoError(t, err)
+	output, err := json.Marshal(map[string]interface{}{
+		"config":   json.RawMessage(payload),
+		"metadata": map[string]interface{}{"client_type": "sing-box", "checksum": checksum},
+	})
+	require.NoError(t, err)
+	outputFile := filepath.Join(dir, "output.json")
+	require.NoError(t, os.WriteFile(outputFile, output, 0644))
+	script := filepath.Join(dir, "sboxmgr")
+	require.NoError(t, os.WriteFile(script, []byte("#!/bin/sh\ncat "+outputFile+"\n"), 0755))
+	return script, checksum
+}
+
+func TestAgent_RunImport(t *testing.T) {
+	dir := t.TempDir()
+	payload := `{"outbounds":[{"type":"direct"}]}`
+	script, checksum := fakeSboxmgr(t, dir, payload)
+
+	clientConfig := filepath.Join(dir, "sing-box.json")
+	reloaded := filepath.Join(dir, "reloaded")
+	cfg := &config.Config{
+		Agent:   config.AgentConfig{Name: "import-test", LogLevel: "error"},
+		Clients: config.ClientsConfig{SingBox: config.SingBoxConfig{ConfigPath: clientConfig}},
+		Import: config.ImportConfig{
+			Enabled:         true,
+			SubscriptionURL: "https://sub.example.com/list",
+			ClientType:      "sing-box",
+			Schedule:        time.Hour,
+			Timeout:         5 * time.Second,
+			Command:         []string{script},
+			ReloadCommand:   []string{"touch", reloaded},
+		},
+	}
+	agent, err := New(cfg)
+	require.NoError(t, err)
+
+	result, err := agent.runImport(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, clientConfig, result.ConfigPath)
+	assert.Equal(t, checksum, result.Checksum)
+	assert.True(t, result.Reloaded)
+	assert.FileExists(t, reloaded)
+
+	saved, err := os.ReadFile(clientConfig)
+	require.NoError(t, err)
+	assert.JSONEq(t, payload, string(saved))
+}
+
+func TestAgent_RunImportPortConflict(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer listener.Close()
+	port := listener.Addr().(*net.TCPAddr).Port
+
+	dir := t.TempDir()
+	payload := fmt.Sprintf(`{"inbounds":[{"type":"mixed","listen":"127.0.0.1","listen_port":%d}]}`, port)
+	script, _ := fakeSboxmgr(t, dir, payload)
+	clientConfig := filepath.Join(dir, "sing-box.json")
+	agent, err := New(&config.Config{
+		Agent: config.AgentConfig{Name: "ports-test", LogLevel: "error"},
+		Clients: config.ClientsConfig{SingBox: config.SingBoxConfig{
+			BinaryPath: "/usr/local/bin/sing-box",
+			ConfigPath: clientConfig,
+		}},
+		Import: config.ImportConfig{
+			Enabled:         true,
+			SubscriptionURL: "https://sub.example.com/list",
+			ClientType:      "sing-box",
+			Schedule:        time.Hour,
+			Timeout:         5 * time.Second,
+			Command:         []string{script},
+			CheckPorts:      true,
+		},
+	})
+	require.NoError(t, err)
+
+	_, err = agent.runImport(context.Background())
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), fmt.Sprintf("port %d in use", port))
+	assert.NoFileExists(t, clientConfig)
+
+	data := importFailure("sing-box", err)
+	assert.Equal(t, port, data["port"])
+	assert.Equal(t, "tcp", data["network"])
+}
+
+func TestAgent_RestoreBackup(t *testing.T) {
+	dir := t.TempDir()
+	clientConfig := filepath.Join(dir, "xray.json")
+	require.NoError(t, os.WriteFile(clientConfig, []byte(`{"version":2}`), 0640))
+	backupName := "xray.json." + time.Now().Add(-time.Hour).Format("20060102-150405") + ".bak"
+	require.NoError(t, os.WriteFile(filepath.Join(dir, backupName), []byte(`{"version":1}`), 0640))
+
+	agent, err := New(&config.Config{
+		Agent:   config.AgentConfig{Name: "backup-test", LogLevel: "error"},
+		Clients: config.ClientsConfig{Xray: config.XrayConfig{ConfigPath: clientConfig}},
+		Import:  config.ImportConfig{ClientType: "xray"},
+	})
+	require.NoError(t, err)
+
+	backups, err := agent.ListBackups("")
+	require.NoError(t, err)
+	require.Len(t, backups, 1)
+	assert.Equal(t, backupName, backups[0].Name)
+
+	replaced, err := agent.RestoreBackup("xray", backupName)
+	require.NoError(t, err)
+	assert.FileExists(t, replaced)
+	data, err := os.ReadFile(clientConfig)
+	require.NoError(t, err)
+	assert.Equal(t, `{"version":1}`, string(data))
+
+	_, err = agent.ListBackups("wireguard")
+	assert.ErrorContains(t, err, `unknown client "wireguard"`)
+}
+
+func TestImportFailure(t *testing.T) {
+	err := fmt.Errorf("import failed: %w", &importer.SboxmgrError{
+		Attempts: 2,
+		ExitCode: 3,
+		Stderr:   "error: subscription unreachable\n",
+		Err:      errors.New("exit status 3"),
+	})
+
+	data := importFailure("sing-box", err)
+	assert.Equal(t, "sing-box", data["clientType"])
+	assert.Equal(t, 2, data["attempts"])
+	assert.Equal(t, 3, data["exitCode"])
+	assert.Equal(t, "error: subscription unreachable\n", data["stderr"])
+
+	data = importFailure("sing-box", errors.New("checksum mismatch"))
+	assert.NotContains(t, data, "exitCode")
+}
+
+func TestAgent_ProbeSboxmgr(t *testing.T) {
+	script := filepath.Join(t.TempDir(), "sboxmgr")
+	newAgent := func(version string) *Agent {
+		require.NoError(t, os.WriteFile(script, []byte("#!/bin/sh\necho 'sboxmgr, version "+version+"'\n"), 0755))
+		agent, err := New(&config.Config{
+			Agent:   config.AgentConfig{Name: "probe-test", LogLevel: "error"},
+			Clients: config.ClientsConfig{SingBox: config.SingBoxConfig{ConfigPath: filepath.Join(t.TempDir(), "sing-box.json")}},
+			Import: config.ImportConfig{
+				Enabled:    true,
+				ClientType: "sing-box",
+				Schedule:   time.Hour,
+				Timeout:    5 * time.Second,
+				Command:    []string{script, "export"},
+			},
+		})
+		require.NoError(t, err)
+		return agent
+	}
+
+	agent := newAgent("1.4.2")
+	require.NoError(t, agent.probeSboxmgr())
+	assert.Equal(t, map[string]interface{}{"version": "1.4.2"}, agent.GetStatus()["sboxmgr"])
+
+	err := newAgent("0.0.1").probeSboxmgr()
+	require.ErrorIs(t, err, importer.ErrUnsupportedVersion)
+	assert.Contains(t, err.Error(), "refusing to import with sboxmgr")
+}
+
+func TestAgent_GetRuns(t *testing.T) {
+	dir := t.TempDir()
+	payload := `{"outbounds":[{"type":"direct"}]}`
+	script, _ := fakeSboxmgr(t, dir, payload)
+	agent, err := New(&config.Config{
+		Agent:    config.AgentConfig{Name: "runs-test", LogLevel: "error"},
+		Clients:  config.ClientsConfig{SingBox: config.SingBoxConfig{ConfigPath: filepath.Join(dir, "sing-box.json")}},
+		Services: config.ServicesConfig{RunHistory: 10},
+		Import: config.ImportConfig{
+			Enabled:         true,
+			SubscriptionURL: "https://sub.example.com/secret-token",
+			ClientType:      "sing-box",
+			Schedule:        time.Hour,
+			Timeout:         5 * time.Second,
+			Command:         []string{script},
+		},
+	})
+	require.NoError(t, err)
+
+	_, err = agent.runImport(context.Background())
+	require.NoError(t, err)
+
+	runs, err := agent.GetRuns("sboxmgr", 0)
+	require.NoError(t, err)
+	require.Len(t, runs, 1)
+	assert.True(t, runs[0].Succeeded())
+	assert.Positive(t, runs[0].OutputBytes)
+	assert.NotContains(t, runs[0].Command, "https://sub.example.com/secret-token")
+	assert.Contains(t, agent.GetStatus()["runs"], "sboxmgr")
+
+	disabled, err := New(&config.Config{Agent: config.AgentConfig{Name: "runs-test", LogLevel: "error"}})
+	require.NoError(t, err)
+	_, err = disabled.GetRuns("", 0)
+	assert.ErrorContains(t, err, "run history is disabled")
+}
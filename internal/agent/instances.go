@@ -0,0 +1,163 @@
+package agent
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/kpblcaoo/sboxagent/internal/aggregator"
+	"github.com/kpblcaoo/sboxagent/internal/config"
+	"github.com/kpblcaoo/sboxagent/internal/process"
+	"github.com/kpblcaoo/sboxagent/internal/services"
+)
+
+// sboxctlInstance is a named sboxctl service from services.sboxctl.instances.
+// Instances run beside the main service with their own schedule, status and
+// health check; their runs do not change the agent state.
+type sboxctlInstance struct {
+	name    string
+	config  config.SboxctlConfig
+	service *services.SboxctlService
+	// user is the user the instance runs as; nil keeps the agent's
+	user *process.Credential
+}
+
+// sboxctlName names the main sboxctl service or one of its instances in
+// events, logs, run history and queue stats
+func sboxctlName(instance string) string {
+	if instance == "" {
+		return "sboxctl"
+	}
+	return "sboxctl/" + instance
+}
+
+// initializeSboxctlInstances creates the enabled sboxctl instances, ordered
+// by name
+func (a *Agent) initializeSboxctlInstances() error {
+	names := make([]string, 0, len(a.config.Services.Sboxctl.Instances))
+	for name, cfg := range a.config.Services.Sboxctl.Instances {
+		if cfg.Enabled {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		cfg := a.config.Services.Sboxctl.Instances[name]
+		service, err := services.NewSboxctlService(cfg, a.logger)
+		if err != nil {
+			return fmt.Errorf("failed to create sboxctl instance %s: %w", name, err)
+		}
+		service.SetName(name)
+		a.sboxctlInstances = append(a.sboxctlInstances, &sboxctlInstance{
+			name:    name,
+			config:  cfg,
+			service: service,
+		})
+	}
+	return nil
+}
+
+// lookupInstanceUsers resolves the users sboxctl instances run as
+func (a *Agent) lookupInstanceUsers() error {
+	for _, instance := range a.sboxctlInstances {
+		user, err := lookupUser(instance.config.SubprocessConfig)
+		if err != nil {
+			return fmt.Errorf("failed to resolve user of sboxctl instance %s: %w", instance.name, err)
+		}
+		instance.user = user
+	}
+	return nil
+}
+
+// configureInstances passes each sboxctl instance its environment, user,
+// limits and hooks, like the main service
+func (a *Agent) configureInstances(env []string) {
+	instances := a.GetConfig().Services.Sboxctl.Instances
+	for _, instance := range a.sboxctlInstances {
+		cfg := instance.config
+		if current, ok := instances[instance.name]; ok {
+			cfg = current
+		}
+		name := instance.name
+		instance.service.SetEnv(cfg.Environ(env))
+		instance.service.SetCredential(instance.user)
+		instance.service.SetLimits(processLimits(cfg.Limits))
+		instance.service.SetHistory(a.runs)
+		instance.service.SetCommandVars(a.commandVars())
+		instance.service.SetCircuitHook(func(open bool, failures int, err error) {
+			a.onInstanceCircuit(name, open, failures, err)
+		})
+		instance.service.SetStderrHook(func(level, line string) {
+			a.addStderr(sboxctlName(name), level, line)
+		})
+	}
+}
+
+// startSboxctlInstances starts the sboxctl instances
+func (a *Agent) startSboxctlInstances() error {
+	for _, instance := range a.sboxctlInstances {
+		if err := instance.service.Start(a.ctx); err != nil {
+			return fmt.Errorf("failed to start sboxctl instance %s: %w", instance.name, err)
+		}
+		a.logger.Info("Sboxctl instance started", map[string]interface{}{
+			"instance": instance.name,
+		})
+	}
+	return nil
+}
+
+// stopSboxctlInstances stops the sboxctl instances
+func (a *Agent) stopSboxctlInstances() {
+	for _, instance := range a.sboxctlInstances {
+		instance.service.Stop()
+	}
+}
+
+// pauseSboxctl pauses or resumes the runs of sboxctl and its instances
+func (a *Agent) pauseSboxctl(paused bool) {
+	if a.sboxctlService != nil {
+		a.sboxctlService.SetPaused(paused)
+	}
+	for _, instance := range a.sboxctlInstances {
+		instance.service.SetPaused(paused)
+	}
+}
+
+// instancesStatus returns the status of each sboxctl instance by name
+func (a *Agent) instancesStatus() map[string]interface{} {
+	status := make(map[string]interface{}, len(a.sboxctlInstances))
+	for _, instance := range a.sboxctlInstances {
+		status[instance.name] = instance.service.GetStatus()
+	}
+	return status
+}
+
+// onInstanceCircuit raises the circuit alerts of a sboxctl instance
+func (a *Agent) onInstanceCircuit(name string, open bool, failures int, err error) {
+	if !open {
+		a.publishEvent("SBOXCTL_CIRCUIT_CLOSED", map[string]interface{}{
+			"instance": name,
+		})
+		return
+	}
+	a.publishEvent("SBOXCTL_CIRCUIT_OPENED", map[string]interface{}{
+		"severity": "critical",
+		"instance": name,
+		"failures": failures,
+		"cooldown": a.GetConfig().Services.Sboxctl.Instances[name].CircuitBreaker.Cooldown.String(),
+		"error":    err.Error(),
+	})
+}
+
+// addStderr adds a stderr line of a sboxctl service to the log aggregator
+func (a *Agent) addStderr(source, level, line string) {
+	if a.aggregator == nil {
+		return
+	}
+	a.aggregator.Add(aggregator.LogEntry{
+		Level:    aggregator.LogLevel(level),
+		Message:  line,
+		Source:   source,
+		Metadata: map[string]interface{}{"stream": "stderr"},
+	})
+}
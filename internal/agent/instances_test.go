@@ -0,0 +1,51 @@
+package agent
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/kpblcaoo/sboxagent/internal/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAgent_SboxctlInstances(t *testing.T) {
+	agent, err := New(&config.Config{
+		Agent: config.AgentConfig{Name: "instances-test", LogLevel: "error"},
+		Services: config.ServicesConfig{
+			RunHistory: 10,
+			Sboxctl: config.SboxctlConfig{
+				Instances: map[string]config.SboxctlConfig{
+					"work": {Enabled: true, Command: []string{"true"}, Interval: time.Minute, Timeout: time.Second},
+					"home": {Command: []string{"true"}, Interval: time.Minute},
+				},
+			},
+		},
+	})
+	require.NoError(t, err)
+	assert.Nil(t, agent.sboxctlService)
+	require.Len(t, agent.sboxctlInstances, 1)
+	assert.NotNil(t, agent.dispatcher)
+
+	status := agent.GetStatus()
+	assert.NotContains(t, status, "sboxctl")
+	instances := status["sboxctl_instances"].(map[string]interface{})
+	assert.Contains(t, instances, "work")
+	assert.NotContains(t, instances, "home")
+	assert.Contains(t, agent.GetMetrics().EventQueues, "sboxctl/work")
+
+	// Runs of an instance are recorded under its own name
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	require.NoError(t, agent.sboxctlInstances[0].service.Start(ctx))
+	defer agent.sboxctlInstances[0].service.Stop()
+	require.Eventually(t, func() bool {
+		runs, err := agent.GetRuns("sboxctl/work", 1)
+		return err == nil && len(runs) == 1 && runs[0].Succeeded()
+	}, 5*time.Second, 10*time.Millisecond)
+
+	runs, err := agent.GetRuns("sboxctl", 0)
+	require.NoError(t, err)
+	assert.Empty(t, runs)
+}
@@ -0,0 +1,171 @@
+package agent
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/kpblcaoo/sboxagent/internal/aggregator"
+	"github.com/kpblcaoo/sboxagent/internal/dispatcher"
+	"github.com/kpblcaoo/sboxagent/internal/health"
+	"github.com/kpblcaoo/sboxagent/internal/journal"
+)
+
+// Journal errors of a unit are alerted at most once per clientLogAlertInterval,
+// and keep the client logs degraded for clientLogErrorWindow
+const (
+	clientLogAlertInterval = time.Minute
+	clientLogErrorWindow   = 5 * time.Minute
+)
+
+// clientLogs tracks the journal entries read for each client unit
+type clientLogs struct {
+	mu    sync.Mutex
+	units map[string]*unitLog
+}
+
+// unitLog counts the warnings and errors a unit logged
+type unitLog struct {
+	Errors      int64     `json:"errors"`
+	Warnings    int64     `json:"warnings"`
+	LastError   string    `json:"lastError,omitempty"`
+	LastErrorAt time.Time `json:"lastErrorAt,omitempty"`
+
+	lastAlert time.Time
+}
+
+// record counts an entry and reports whether an error should be alerted
+func (c *clientLogs) record(entry journal.Entry) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.units == nil {
+		c.units = make(map[string]*unitLog)
+	}
+	log, ok := c.units[entry.Unit]
+	if !ok {
+		log = &unitLog{}
+		c.units[entry.Unit] = log
+	}
+
+	switch entry.Level() {
+	case "warn":
+		log.Warnings++
+	case "error":
+		log.Errors++
+		log.LastError = entry.Message
+		log.LastErrorAt = entry.Time
+		if entry.Time.Sub(log.lastAlert) >= clientLogAlertInterval {
+			log.lastAlert = entry.Time
+			return true
+		}
+	}
+	return false
+}
+
+// snapshot returns a copy of the unit logs
+func (c *clientLogs) snapshot() map[string]unitLog {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	units := make(map[string]unitLog, len(c.units))
+	for unit, log := range c.units {
+		units[unit] = *log
+	}
+	return units
+}
+
+// startJournal follows the journal of the client units while the agent runs
+func (a *Agent) startJournal() {
+	agentCfg := a.GetConfig()
+	cfg := agentCfg.Logging.Journal
+	if !cfg.Enabled {
+		return
+	}
+	reader := journal.NewReader(cfg.Units, agentCfg.Services.Systemd.UserMode, cfg.RestartDelay, a.logger)
+	reader.SetEnv(a.subprocessEnv())
+	a.logger.Info("Following client journal", map[string]interface{}{
+		"command": reader.Command(),
+	})
+
+	a.wg.Add(1)
+	go func() {
+		defer a.wg.Done()
+		reader.Run(a.ctx, a.handleJournalEntry)
+	}()
+}
+
+// handleJournalEntry passes a client log entry to the aggregator and the
+// dispatcher, and raises an alert for errors
+func (a *Agent) handleJournalEntry(entry journal.Entry) {
+	source := "journal/" + strings.TrimSuffix(entry.Unit, ".service")
+	level := entry.Level()
+
+	if a.aggregator != nil {
+		a.aggregator.Add(aggregator.LogEntry{
+			Timestamp: entry.Time,
+			Level:     aggregator.LogLevel(level),
+			Message:   entry.Message,
+			Source:    source,
+			Metadata:  map[string]interface{}{"unit": entry.Unit, "pid": entry.PID},
+		})
+	}
+
+	data := map[string]interface{}{
+		"level":   level,
+		"message": entry.Message,
+		"unit":    entry.Unit,
+		"pid":     entry.PID,
+	}
+	if a.dispatcher != nil {
+		eventType := dispatcher.EventTypeLog
+		if level == "error" {
+			eventType = dispatcher.EventTypeError
+		}
+		// A full dispatcher queue drops the event and logs it
+		_ = a.dispatcher.Dispatch(dispatcher.Event{
+			Type:      eventType,
+			Data:      data,
+			Timestamp: entry.Time,
+			Source:    source,
+		})
+	}
+
+	if a.clientLogs.record(entry) {
+		a.publishEvent("CLIENT_LOG_ERROR", map[string]interface{}{
+			"severity": "warning",
+			"unit":     entry.Unit,
+			"error":    entry.Message,
+		})
+	}
+}
+
+// clientLogCheck reports client units that logged errors recently
+type clientLogCheck struct {
+	logs *clientLogs
+}
+
+func (c clientLogCheck) Name() string {
+	return "client_logs"
+}
+
+func (c clientLogCheck) Check(ctx context.Context) health.ComponentHealth {
+	result := health.ComponentHealth{
+		Name:      c.Name(),
+		Status:    health.HealthStatusHealthy,
+		Message:   "No recent client errors",
+		Timestamp: time.Now(),
+	}
+	var failing []string
+	for unit, log := range c.logs.snapshot() {
+		if time.Since(log.LastErrorAt) < clientLogErrorWindow {
+			failing = append(failing, unit)
+		}
+	}
+	if len(failing) > 0 {
+		sort.Strings(failing)
+		result.Status = health.HealthStatusDegraded
+		result.Message = "Recent errors from " + strings.Join(failing, ", ")
+	}
+	return result
+}
@@ -0,0 +1,57 @@
+package agent
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/kpblcaoo/sboxagent/internal/config"
+	"github.com/kpblcaoo/sboxagent/internal/health"
+	"github.com/kpblcaoo/sboxagent/internal/journal"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAgent_HandleJournalEntry(t *testing.T) {
+	agent, err := New(&config.Config{
+		Agent:   config.AgentConfig{Name: "journal-test", LogLevel: "error"},
+		Logging: config.LoggingConfig{Aggregation: true, MaxEntries: 100, Journal: config.JournalConfig{Enabled: true}},
+	})
+	require.NoError(t, err)
+
+	now := time.Now()
+	agent.handleJournalEntry(journal.Entry{Time: now, Unit: "sing-box.service", Priority: 3, Message: "dial tcp: timeout"})
+	agent.handleJournalEntry(journal.Entry{Time: now.Add(time.Second), Unit: "sing-box.service", Priority: 2, Message: "fatal"})
+	agent.handleJournalEntry(journal.Entry{Time: now, Unit: "xray.service", Priority: 4, Message: "slow"})
+
+	var entries []string
+	for _, entry := range agent.aggregator.GetEntries(100, "", time.Time{}) {
+		if entry.Source == "journal/sing-box" {
+			entries = append(entries, entry.Message)
+		}
+	}
+	assert.ElementsMatch(t, []string{"dial tcp: timeout", "fatal"}, entries)
+
+	logs := agent.GetStatus()["client_logs"].(map[string]unitLog)
+	assert.EqualValues(t, 2, logs["sing-box.service"].Errors)
+	assert.Equal(t, "fatal", logs["sing-box.service"].LastError)
+	assert.EqualValues(t, 1, logs["xray.service"].Warnings)
+
+	result := clientLogCheck{logs: &agent.clientLogs}.Check(context.Background())
+	assert.Equal(t, health.HealthStatusDegraded, result.Status)
+	assert.Equal(t, "Recent errors from sing-box.service", result.Message)
+}
+
+func TestClientLogs_AlertInterval(t *testing.T) {
+	var logs clientLogs
+	now := time.Now()
+	entry := journal.Entry{Time: now, Unit: "sing-box.service", Priority: 3}
+	assert.True(t, logs.record(entry))
+
+	// Further errors within the alert interval are only counted
+	entry.Time = now.Add(time.Second)
+	assert.False(t, logs.record(entry))
+	entry.Time = now.Add(clientLogAlertInterval)
+	assert.True(t, logs.record(entry))
+	assert.EqualValues(t, 3, logs.snapshot()["sing-box.service"].Errors)
+}
@@ -0,0 +1,252 @@
+package agent
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Lease durations for client config leases
+const (
+	defaultConfigLeaseTTL = time.Minute
+	maxConfigLeaseTTL     = 10 * time.Minute
+)
+
+// ErrConfigLeased is returned when a client config is leased by someone else
+var ErrConfigLeased = errors.New("client config is leased")
+
+// ConfigLease is an advisory lease on a client config held by an external
+// tool. While it is held the agent does not write that config itself.
+type ConfigLease struct {
+	ID         string    `json:"id"`
+	Client     string    `json:"client"`
+	Holder     string    `json:"holder"`
+	AcquiredAt time.Time `json:"acquiredAt"`
+	ExpiresAt  time.Time `json:"expiresAt"`
+}
+
+// configLeases tracks the leases by client. The zero value has no leases.
+type configLeases struct {
+	mu     sync.Mutex
+	leases map[string]ConfigLease
+	// changed is closed and replaced whenever a lease is released or renewed
+	changed chan struct{}
+}
+
+// active returns the unexpired lease on a client config, if any
+func (l *configLeases) active(client string, now time.Time) (ConfigLease, bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	lease, ok := l.leases[client]
+	if !ok || !now.Before(lease.ExpiresAt) {
+		return ConfigLease{}, false
+	}
+	return lease, true
+}
+
+// acquire leases a client config to holder. A holder acquiring its own
+// lease again extends it.
+func (l *configLeases) acquire(client, holder string, ttl time.Duration, now time.Time) (ConfigLease, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if lease, ok := l.leases[client]; ok && now.Before(lease.ExpiresAt) {
+		if lease.Holder != holder {
+			return ConfigLease{}, fmt.Errorf("%w by %s until %s", ErrConfigLeased, lease.Holder, lease.ExpiresAt.Format(time.RFC3339))
+		}
+		lease.ExpiresAt = now.Add(ttl)
+		l.leases[client] = lease
+		l.notify()
+		return lease, nil
+	}
+
+	if l.leases == nil {
+		l.leases = make(map[string]ConfigLease)
+	}
+	lease := ConfigLease{
+		ID:         uuid.NewString(),
+		Client:     client,
+		Holder:     holder,
+		AcquiredAt: now,
+		ExpiresAt:  now.Add(ttl),
+	}
+	l.leases[client] = lease
+	return lease, nil
+}
+
+// renew extends an unexpired lease by ttl from now
+func (l *configLeases) renew(id string, ttl time.Duration, now time.Time) (ConfigLease, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for client, lease := range l.leases {
+		if lease.ID != id {
+			continue
+		}
+		if !now.Before(lease.ExpiresAt) {
+			break
+		}
+		lease.ExpiresAt = now.Add(ttl)
+		l.leases[client] = lease
+		l.notify()
+		return lease, nil
+	}
+	return ConfigLease{}, fmt.Errorf("no active lease %q", id)
+}
+
+// release drops a lease
+func (l *configLeases) release(id string) (ConfigLease, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for client, lease := range l.leases {
+		if lease.ID == id {
+			delete(l.leases, client)
+			l.notify()
+			return lease, nil
+		}
+	}
+	return ConfigLease{}, fmt.Errorf("no active lease %q", id)
+}
+
+// list returns the unexpired leases ordered by client, dropping expired ones
+func (l *configLeases) list(now time.Time) []ConfigLease {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	leases := make([]ConfigLease, 0, len(l.leases))
+	for client, lease := range l.leases {
+		if !now.Before(lease.ExpiresAt) {
+			delete(l.leases, client)
+			continue
+		}
+		leases = append(leases, lease)
+	}
+	sort.Slice(leases, func(i, j int) bool { return leases[i].Client < leases[j].Client })
+	return leases
+}
+
+// wait blocks until no lease is held on a client config
+func (l *configLeases) wait(ctx context.Context, client string) error {
+	for {
+		l.mu.Lock()
+		lease, ok := l.leases[client]
+		now := time.Now()
+		if !ok || !now.Before(lease.ExpiresAt) {
+			l.mu.Unlock()
+			return nil
+		}
+		if l.changed == nil {
+			l.changed = make(chan struct{})
+		}
+		changed := l.changed
+		l.mu.Unlock()
+
+		timer := time.NewTimer(lease.ExpiresAt.Sub(now))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		case <-changed:
+			timer.Stop()
+		case <-timer.C:
+		}
+	}
+}
+
+// notify wakes the waiters; l.mu must be held
+func (l *configLeases) notify() {
+	if l.changed != nil {
+		close(l.changed)
+		l.changed = nil
+	}
+}
+
+// leaseTTL returns the requested lease duration, defaulted and capped
+func leaseTTL(ttl time.Duration) (time.Duration, error) {
+	switch {
+	case ttl == 0:
+		return defaultConfigLeaseTTL, nil
+	case ttl < 0 || ttl > maxConfigLeaseTTL:
+		return 0, fmt.Errorf("lease ttl must be between 0 and %s", maxConfigLeaseTTL)
+	}
+	return ttl, nil
+}
+
+// AcquireConfigLease leases a client config to an external tool for ttl, or
+// a minute if zero. An empty client selects the import client type. While
+// the lease is held, imports wait before writing the config and backups
+// are not restored.
+func (a *Agent) AcquireConfigLease(client, holder string, ttl time.Duration) (*ConfigLease, error) {
+	if holder == "" {
+		return nil, fmt.Errorf("lease holder is required")
+	}
+	client, _, err := a.clientConfigPath(client)
+	if err != nil {
+		return nil, err
+	}
+	ttl, err = leaseTTL(ttl)
+	if err != nil {
+		return nil, err
+	}
+
+	lease, err := a.leases.acquire(client, holder, ttl, time.Now())
+	if err != nil {
+		return nil, err
+	}
+	a.logger.Info("Client config leased", map[string]interface{}{
+		"client":    client,
+		"holder":    holder,
+		"expiresAt": lease.ExpiresAt,
+	})
+	a.publishEvent("CONFIG_LEASE_ACQUIRED", lease)
+	return &lease, nil
+}
+
+// RenewConfigLease extends an active lease by ttl from now
+func (a *Agent) RenewConfigLease(id string, ttl time.Duration) (*ConfigLease, error) {
+	ttl, err := leaseTTL(ttl)
+	if err != nil {
+		return nil, err
+	}
+	lease, err := a.leases.renew(id, ttl, time.Now())
+	if err != nil {
+		return nil, err
+	}
+	return &lease, nil
+}
+
+// ReleaseConfigLease releases a lease, letting deferred imports proceed
+func (a *Agent) ReleaseConfigLease(id string) error {
+	lease, err := a.leases.release(id)
+	if err != nil {
+		return err
+	}
+	a.logger.Info("Client config lease released", map[string]interface{}{
+		"client": lease.Client,
+		"holder": lease.Holder,
+	})
+	a.publishEvent("CONFIG_LEASE_RELEASED", lease)
+	return nil
+}
+
+// ConfigLeases returns the active client config leases
+func (a *Agent) ConfigLeases() []ConfigLease {
+	return a.leases.list(time.Now())
+}
+
+// waitConfigLease defers writing a client config while it is leased
+func (a *Agent) waitConfigLease(ctx context.Context, client string) error {
+	lease, ok := a.leases.active(client, time.Now())
+	if !ok {
+		return nil
+	}
+	a.logger.Info("Deferring config write while leased", map[string]interface{}{
+		"client":    client,
+		"holder":    lease.Holder,
+		"expiresAt": lease.ExpiresAt,
+	})
+	return a.leases.wait(ctx, client)
+}
@@ -0,0 +1,109 @@
+package agent
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/kpblcaoo/sboxagent/internal/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAgent_ConfigLease(t *testing.T) {
+	agent, err := New(&config.Config{
+		Agent:   config.AgentConfig{Name: "lease-test", LogLevel: "error"},
+		Clients: config.ClientsConfig{Xray: config.XrayConfig{ConfigPath: filepath.Join(t.TempDir(), "xray.json")}},
+		Import:  config.ImportConfig{ClientType: "xray"},
+	})
+	require.NoError(t, err)
+
+	lease, err := agent.AcquireConfigLease("", "provisioner", 0)
+	require.NoError(t, err)
+	assert.Equal(t, "xray", lease.Client)
+	assert.WithinDuration(t, time.Now().Add(time.Minute), lease.ExpiresAt, time.Second)
+
+	// Another holder is refused, the same one extends its lease
+	_, err = agent.AcquireConfigLease("xray", "other-tool", 0)
+	assert.True(t, errors.Is(err, ErrConfigLeased))
+	again, err := agent.AcquireConfigLease("xray", "provisioner", 5*time.Minute)
+	require.NoError(t, err)
+	assert.Equal(t, lease.ID, again.ID)
+
+	_, err = agent.RestoreBackup("xray", "xray.json.20250101-000000.bak")
+	assert.True(t, errors.Is(err, ErrConfigLeased))
+
+	renewed, err := agent.RenewConfigLease(lease.ID, 2*time.Minute)
+	require.NoError(t, err)
+	assert.WithinDuration(t, time.Now().Add(2*time.Minute), renewed.ExpiresAt, time.Second)
+	assert.Len(t, agent.ConfigLeases(), 1)
+
+	require.NoError(t, agent.ReleaseConfigLease(lease.ID))
+	assert.Empty(t, agent.ConfigLeases())
+	assert.Error(t, agent.ReleaseConfigLease(lease.ID))
+
+	_, err = agent.AcquireConfigLease("xray", "", 0)
+	assert.ErrorContains(t, err, "holder is required")
+	_, err = agent.AcquireConfigLease("xray", "provisioner", time.Hour)
+	assert.ErrorContains(t, err, "lease ttl must be between")
+	_, err = agent.AcquireConfigLease("wireguard", "provisioner", 0)
+	assert.ErrorContains(t, err, `unknown client "wireguard"`)
+}
+
+func TestAgent_RunImportWaitsForLease(t *testing.T) {
+	dir := t.TempDir()
+	payload := `{"outbounds":[{"type":"direct"}]}`
+	script, _ := fakeSboxmgr(t, dir, payload)
+	clientConfig := filepath.Join(dir, "sing-box.json")
+	agent, err := New(&config.Config{
+		Agent:   config.AgentConfig{Name: "lease-import-test", LogLevel: "error"},
+		Clients: config.ClientsConfig{SingBox: config.SingBoxConfig{ConfigPath: clientConfig}},
+		Import: config.ImportConfig{
+			Enabled:         true,
+			SubscriptionURL: "https://sub.example.com/list",
+			ClientType:      "sing-box",
+			Schedule:        time.Hour,
+			Timeout:         5 * time.Second,
+			Command:         []string{script},
+		},
+	})
+	require.NoError(t, err)
+
+	lease, err := agent.AcquireConfigLease("sing-box", "provisioner", 0)
+	require.NoError(t, err)
+
+	done := make(chan error, 1)
+	go func() {
+		_, err := agent.runImport(context.Background())
+		done <- err
+	}()
+
+	select {
+	case err := <-done:
+		t.Fatalf("import finished while leased: %v", err)
+	case <-time.After(200 * time.Millisecond):
+	}
+	assert.NoFileExists(t, clientConfig)
+
+	require.NoError(t, agent.ReleaseConfigLease(lease.ID))
+	select {
+	case err := <-done:
+		require.NoError(t, err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("import still deferred after release")
+	}
+	saved, err := os.ReadFile(clientConfig)
+	require.NoError(t, err)
+	assert.JSONEq(t, payload, string(saved))
+
+	// A cancelled import gives up waiting
+	_, err = agent.AcquireConfigLease("sing-box", "provisioner", 0)
+	require.NoError(t, err)
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	_, err = agent.runImport(ctx)
+	assert.ErrorContains(t, err, "deferred while sing-box config is leased")
+}
@@ -0,0 +1,111 @@
+package agent
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/kpblcaoo/sboxagent/internal/netloc"
+)
+
+// watchLocation checks the network the host is on and switches profiles
+// when it changes, until shutdown
+func (a *Agent) watchLocation() {
+	defer a.wg.Done()
+
+	ticker := time.NewTicker(a.GetConfig().Location.Interval)
+	defer ticker.Stop()
+
+	for {
+		a.checkLocation(a.ctx)
+
+		select {
+		case <-a.ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// checkLocation detects the network and switches to the profile its rules
+// select, falling back to the default profile
+func (a *Agent) checkLocation(ctx context.Context) {
+	network, err := a.detector.Detect(ctx)
+	if err != nil {
+		a.logger.Warn("Failed to detect network", map[string]interface{}{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	cfg := a.GetConfig()
+	a.mu.Lock()
+	a.network = &network
+	a.mu.Unlock()
+
+	profile, ok := netloc.Match(cfg.Location.Rules, network)
+	if !ok {
+		profile = cfg.Location.DefaultProfile
+	}
+	if profile == "" || profile == cfg.Profile() {
+		return
+	}
+	if err := a.SwitchProfile(ctx, profile, network); err != nil {
+		a.logger.Error("Failed to switch profile", map[string]interface{}{
+			"profile": profile,
+			"error":   err.Error(),
+		})
+	}
+}
+
+// SwitchProfile reloads the configuration with another profile and applies
+// it: subprocesses see the new profile and, if imports are enabled, the
+// client config is regenerated from the profile's subscription settings.
+// Settings that need new services, such as enabling imports, take effect
+// after a restart.
+func (a *Agent) SwitchProfile(ctx context.Context, profile string, network netloc.Network) error {
+	a.configMu.Lock()
+	current := a.GetConfig()
+	updated, err := current.WithProfile(profile)
+	if err != nil {
+		a.configMu.Unlock()
+		return fmt.Errorf("failed to load profile %s: %w", profile, err)
+	}
+
+	a.mu.Lock()
+	a.config = updated
+	a.mu.Unlock()
+	a.configureSubprocesses()
+	a.configMu.Unlock()
+
+	a.logger.Info("Switched profile", map[string]interface{}{
+		"from":    current.Profile(),
+		"to":      profile,
+		"ssid":    network.SSID,
+		"gateway": network.Gateway,
+	})
+	a.publishEvent("PROFILE_SWITCHED", map[string]interface{}{
+		"from":    current.Profile(),
+		"to":      profile,
+		"network": network,
+	})
+
+	if a.importer == nil || !updated.Import.Enabled || !a.isActive() || a.ClientsStopped() != nil {
+		return nil
+	}
+	if _, err := a.runImports(ctx); err != nil {
+		a.publishEvent("IMPORT_FAILED", importFailure(a.importClients(), err))
+		return err
+	}
+	return nil
+}
+
+// locationStatus reports the detected network and selected profile; it must
+// be called with a.mu held
+func (a *Agent) locationStatus() map[string]interface{} {
+	status := map[string]interface{}{"profile": a.config.Profile()}
+	if a.network != nil {
+		status["network"] = *a.network
+	}
+	return status
+}
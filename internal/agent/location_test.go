@@ -0,0 +1,64 @@
+package agent
+
+import (
+	"context"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/kpblcaoo/sboxagent/internal/config"
+	"github.com/kpblcaoo/sboxagent/internal/netloc"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAgent_CheckLocation(t *testing.T) {
+	configPath := filepath.Join(t.TempDir(), "agent.yaml")
+	require.NoError(t, os.WriteFile(configPath, []byte(`
+agent:
+  name: "location-test"
+  log_level: "error"
+services:
+  sboxctl:
+    enabled: false
+location:
+  enabled: true
+  default_profile: "roaming"
+  rules:
+    - profile: "home"
+      ssids: ["HomeWiFi"]
+profiles:
+  home:
+    services:
+      sboxctl:
+        timeout: 1m
+  roaming:
+    services:
+      sboxctl:
+        timeout: 2m
+`), 0644))
+
+	cfg, err := config.Load(configPath)
+	require.NoError(t, err)
+	agent, err := New(cfg)
+	require.NoError(t, err)
+	require.NotNil(t, agent.detector)
+
+	noAddrs := func() ([]net.Addr, error) { return nil, nil }
+	agent.detector = &netloc.Detector{SSIDCommand: []string{"echo", "HomeWiFi"}, Addrs: noAddrs}
+	agent.checkLocation(context.Background())
+	assert.Equal(t, "home", agent.GetConfig().Profile())
+	assert.Equal(t, "home", agent.GetConfig().Agent.Profile)
+	assert.Equal(t, "home", agent.commandVars().Profile)
+
+	status := agent.GetStatus()["location"].(map[string]interface{})
+	assert.Equal(t, "home", status["profile"])
+	assert.Equal(t, "HomeWiFi", status["network"].(netloc.Network).SSID)
+
+	// Unknown networks fall back to the default profile
+	agent.detector.SSIDCommand = []string{"echo", "Cafe"}
+	agent.checkLocation(context.Background())
+	assert.Equal(t, "roaming", agent.GetConfig().Profile())
+	assert.Equal(t, "2m0s", agent.GetConfig().Services.Sboxctl.Timeout.String())
+}
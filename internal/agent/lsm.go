@@ -0,0 +1,106 @@
+package agent
+
+import (
+	"context"
+	"os/exec"
+	"strings"
+	"time"
+
+	"github.com/kpblcaoo/sboxagent/internal/config"
+	"github.com/kpblcaoo/sboxagent/internal/health"
+	"github.com/kpblcaoo/sboxagent/internal/lsm"
+)
+
+// securityTargets returns the paths the agent and its clients need: the
+// socket, the agent config, and the configs and binaries of the enabled
+// clients
+func (a *Agent) securityTargets() []lsm.Target {
+	cfg := a.GetConfig()
+	var targets []lsm.Target
+	if a.socketServer != nil && (a.socketServer.Network == "" || a.socketServer.Network == "unix") {
+		targets = append(targets, lsm.Target{Kind: lsm.KindSocket, Path: a.socketServer.SocketPath})
+	}
+	if path := cfg.Path(); path != "" {
+		targets = append(targets, lsm.Target{Kind: lsm.KindConfig, Path: path})
+	}
+	for _, name := range config.ClientNames {
+		if !cfg.Clients.Enabled(name) {
+			continue
+		}
+		if path, _ := cfg.Clients.ConfigPath(name); path != "" {
+			targets = append(targets, lsm.Target{Kind: lsm.KindConfig, Client: name, Path: path})
+		}
+		binary, _ := cfg.Clients.BinaryPath(name)
+		if binary == "" {
+			binary = name
+		}
+		if path, err := exec.LookPath(binary); err == nil {
+			targets = append(targets, lsm.Target{Kind: lsm.KindBinary, Client: name, Path: path})
+		}
+	}
+	return targets
+}
+
+// checkSecurityModules checks the targets against SELinux and AppArmor and
+// stores the result for the status
+func (a *Agent) checkSecurityModules() lsm.Status {
+	status := lsm.Check(a.securityTargets())
+	a.mu.Lock()
+	a.securityModules = status
+	a.mu.Unlock()
+	return status
+}
+
+// warnSecurityModules logs what an enforcing security module is likely to
+// deny, so it does not surface later as a bare permission denied error
+func (a *Agent) warnSecurityModules() {
+	status := a.checkSecurityModules()
+	if !status.Active() {
+		return
+	}
+	a.logger.Info("Security modules active", map[string]interface{}{
+		"selinux":     status.SELinux,
+		"apparmor":    status.AppArmor,
+		"confinement": status.Confinement,
+	})
+	for _, finding := range status.Findings {
+		a.logger.Warn("Security module may deny access", map[string]interface{}{
+			"module":  finding.Module,
+			"kind":    finding.Kind,
+			"client":  finding.Client,
+			"path":    finding.Path,
+			"context": finding.Context,
+			"problem": finding.Problem,
+			"hint":    finding.Hint,
+		})
+	}
+}
+
+// securityModuleCheck reports the security module findings as a health
+// component: degraded while any target is likely to be denied
+type securityModuleCheck struct {
+	agent *Agent
+}
+
+func (c securityModuleCheck) Name() string {
+	return "security_modules"
+}
+
+func (c securityModuleCheck) Check(ctx context.Context) health.ComponentHealth {
+	status := c.agent.checkSecurityModules()
+	result := health.ComponentHealth{
+		Name:      c.Name(),
+		Status:    health.HealthStatusHealthy,
+		Message:   "No access problems expected from security modules",
+		Timestamp: time.Now(),
+	}
+	if len(status.Findings) > 0 {
+		problems := make([]string, 0, len(status.Findings))
+		for _, finding := range status.Findings {
+			problems = append(problems, finding.String())
+		}
+		result.Status = health.HealthStatusDegraded
+		result.Message = strings.Join(problems, "; ")
+	}
+	return result
+}
@@ -0,0 +1,210 @@
+package agent
+
+import (
+	"fmt"
+	"io"
+	"runtime"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/kpblcaoo/sboxagent/internal/services"
+	"github.com/kpblcaoo/sboxagent/internal/socket"
+	"github.com/kpblcaoo/sboxagent/internal/telemetry"
+)
+
+// rateWindow is the number of one-second buckets the event rate is averaged
+// over
+const rateWindow = 60
+
+// Health summaries reported in metrics snapshots and heartbeats
+const (
+	HealthHealthy  = "healthy"
+	HealthDegraded = "degraded"
+	HealthStopped  = "stopped"
+)
+
+// MetricsSnapshot holds the key numbers of a running agent, for clients that
+// do not scrape the Prometheus endpoint
+type MetricsSnapshot struct {
+	EventsPerSecond   float64 `json:"events_per_second"`
+	EventsTotal       int64   `json:"events_total"`
+	MemoryBytes       uint64  `json:"memory_bytes"`
+	Goroutines        int     `json:"goroutines"`
+	LastApplyDuration string  `json:"last_apply_duration,omitempty"`
+	Health            string  `json:"health"`
+	// EventQueues reports the fill level and drops of each event queue
+	EventQueues map[string]services.QueueStats `json:"event_queues,omitempty"`
+	// Connectivity summarizes the end-to-end probes through the clients
+	Connectivity *ConnectivityStats `json:"connectivity,omitempty"`
+	// Labels identify the agent the snapshot belongs to
+	Labels telemetry.Labels `json:"labels,omitempty"`
+}
+
+// eventRate counts events in one-second buckets over a sliding window
+type eventRate struct {
+	mu      sync.Mutex
+	total   int64
+	buckets [rateWindow]int64
+	last    int64
+}
+
+// add records one event at now
+func (r *eventRate) add(now time.Time) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.advance(now.Unix())
+	r.buckets[r.last%rateWindow]++
+	r.total++
+}
+
+// snapshot returns the average events per second over the window and the
+// total number of events
+func (r *eventRate) snapshot(now time.Time) (float64, int64) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.advance(now.Unix())
+	var sum int64
+	for _, count := range r.buckets {
+		sum += count
+	}
+	return float64(sum) / rateWindow, r.total
+}
+
+// advance clears buckets that fell out of the window since the last event
+func (r *eventRate) advance(sec int64) {
+	if sec <= r.last {
+		return
+	}
+	if sec-r.last >= rateWindow {
+		r.buckets = [rateWindow]int64{}
+	} else {
+		for s := r.last + 1; s <= sec; s++ {
+			r.buckets[s%rateWindow] = 0
+		}
+	}
+	r.last = sec
+}
+
+// GetMetrics returns a metrics snapshot of the agent
+func (a *Agent) GetMetrics() MetricsSnapshot {
+	return a.metricsSnapshot(a.State())
+}
+
+// metricsSnapshot builds a metrics snapshot; callers pass the state so it can
+// be used while a.mu is held
+func (a *Agent) metricsSnapshot(state State) MetricsSnapshot {
+	var mem runtime.MemStats
+	runtime.ReadMemStats(&mem)
+
+	snapshot := MetricsSnapshot{
+		MemoryBytes: mem.Alloc,
+		Goroutines:  runtime.NumGoroutine(),
+		Health:      healthSummary(state),
+		Labels:      a.labels,
+	}
+	snapshot.EventsPerSecond, snapshot.EventsTotal = a.events.snapshot(time.Now())
+	if a.sboxctlService != nil {
+		if d := a.sboxctlService.LastRunDuration(); d > 0 {
+			snapshot.LastApplyDuration = d.String()
+		}
+	}
+	if queues := a.eventQueues(); len(queues) > 0 {
+		snapshot.EventQueues = queues
+	}
+	if stats, ok := a.Connectivity(); ok {
+		snapshot.Connectivity = &stats
+	}
+	return snapshot
+}
+
+// eventQueues returns the stats of the agent's event queues by name
+func (a *Agent) eventQueues() map[string]services.QueueStats {
+	queues := make(map[string]services.QueueStats)
+	if a.sboxctlService != nil {
+		queues["sboxctl"] = a.sboxctlService.EventQueueStats()
+	}
+	for _, instance := range a.sboxctlInstances {
+		queues[sboxctlName(instance.name)] = instance.service.EventQueueStats()
+	}
+	if a.dispatcher != nil {
+		queues["dispatcher"] = a.dispatcher.QueueStats()
+	}
+	return queues
+}
+
+// writeQueueMetrics writes the event queue stats in Prometheus text format
+func (a *Agent) writeQueueMetrics(w io.Writer) {
+	queues := a.eventQueues()
+	names := make([]string, 0, len(queues))
+	for name := range queues {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	fmt.Fprintln(w, "# HELP sboxagent_event_queue_length Events waiting in the queue.")
+	fmt.Fprintln(w, "# TYPE sboxagent_event_queue_length gauge")
+	for _, name := range names {
+		fmt.Fprintf(w, "sboxagent_event_queue_length{%squeue=%q} %d\n", a.queueLabels(name), name, queues[name].Length)
+	}
+	fmt.Fprintln(w, "# HELP sboxagent_event_queue_capacity Maximum number of events the queue holds.")
+	fmt.Fprintln(w, "# TYPE sboxagent_event_queue_capacity gauge")
+	for _, name := range names {
+		fmt.Fprintf(w, "sboxagent_event_queue_capacity{%squeue=%q} %d\n", a.queueLabels(name), name, queues[name].Capacity)
+	}
+	fmt.Fprintln(w, "# HELP sboxagent_event_queue_dropped_total Events dropped because the queue was full.")
+	fmt.Fprintln(w, "# TYPE sboxagent_event_queue_dropped_total counter")
+	for _, name := range names {
+		fmt.Fprintf(w, "sboxagent_event_queue_dropped_total{%squeue=%q} %d\n", a.queueLabels(name), name, queues[name].Dropped)
+	}
+}
+
+// queueLabels returns the telemetry label prefix for an event queue, which
+// is named after the service feeding it
+func (a *Agent) queueLabels(name string) string {
+	return a.labels.With(telemetry.LabelService, name).Prefix()
+}
+
+// healthSummary reduces the lifecycle state to a single health value
+func healthSummary(state State) string {
+	switch state {
+	case StateStopped, StateStopping:
+		return HealthStopped
+	case StateDegraded:
+		return HealthDegraded
+	}
+	return HealthHealthy
+}
+
+// sendHeartbeats publishes a heartbeat with a metrics snapshot to socket
+// clients until shutdown
+func (a *Agent) sendHeartbeats(interval time.Duration) {
+	defer a.wg.Done()
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-a.ctx.Done():
+			return
+		case <-ticker.C:
+			a.mu.RLock()
+			uptime := time.Since(a.startTime).Seconds()
+			state := a.state
+			cfg := a.config.Agent
+			a.mu.RUnlock()
+
+			metrics := a.metricsSnapshot(state)
+			msg := socket.NewHeartbeatMessage(cfg.Name, string(state), uptime, cfg.Version)
+			msg.Metadata = map[string]interface{}{"metrics": metrics}
+			if err := a.socketServer.Publish(msg); err != nil {
+				a.logger.Warn("Failed to publish heartbeat", map[string]interface{}{
+					"error": err.Error(),
+				})
+			}
+		}
+	}
+}
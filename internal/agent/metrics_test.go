@@ -0,0 +1,89 @@
+package agent
+
+import (
+	"bytes"
+	"context"
+	"testing"
+	"time"
+
+	"github.com/kpblcaoo/sboxagent/internal/config"
+	"github.com/kpblcaoo/sboxagent/internal/services"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEventRate(t *testing.T) {
+	var rate eventRate
+	now := time.Unix(1000, 0)
+
+	for i := 0; i < 30; i++ {
+		rate.add(now)
+	}
+	rate.add(now.Add(time.Second))
+
+	perSecond, total := rate.snapshot(now.Add(time.Second))
+	assert.InDelta(t, 31.0/rateWindow, perSecond, 0.001)
+	assert.Equal(t, int64(31), total)
+
+	// Old buckets fall out of the window, the total is kept
+	perSecond, total = rate.snapshot(now.Add(2 * rateWindow * time.Second))
+	assert.Zero(t, perSecond)
+	assert.Equal(t, int64(31), total)
+}
+
+func TestAgent_GetMetrics(t *testing.T) {
+	agent, err := New(&config.Config{
+		Agent: config.AgentConfig{Name: "metrics-test", LogLevel: "error"},
+		Services: config.ServicesConfig{
+			Sboxctl: config.SboxctlConfig{
+				Enabled:  true,
+				Command:  []string{"false"},
+				Interval: time.Minute,
+				Timeout:  time.Second,
+			},
+		},
+	})
+	require.NoError(t, err)
+
+	metrics := agent.GetMetrics()
+	assert.Equal(t, HealthStopped, metrics.Health)
+	assert.NotZero(t, metrics.MemoryBytes)
+	assert.Empty(t, metrics.LastApplyDuration)
+	assert.Equal(t, services.DefaultEventBuffer, metrics.EventQueues["sboxctl"].Capacity)
+
+	agent.state = StateReady
+	assert.Equal(t, HealthHealthy, agent.GetMetrics().Health)
+	assert.Equal(t, HealthHealthy, agent.GetStatus()["metrics"].(MetricsSnapshot).Health)
+
+	// A failed sboxctl run degrades health
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	require.NoError(t, agent.sboxctlService.Start(ctx))
+	defer agent.sboxctlService.Stop()
+	require.Eventually(t, func() bool {
+		return agent.GetMetrics().Health == HealthDegraded
+	}, 5*time.Second, 10*time.Millisecond)
+	assert.NotEmpty(t, agent.GetMetrics().LastApplyDuration)
+}
+
+func TestAgent_WriteQueueMetrics(t *testing.T) {
+	agent, err := New(&config.Config{
+		Agent: config.AgentConfig{Name: "metrics-test", LogLevel: "error"},
+		Services: config.ServicesConfig{
+			Sboxctl: config.SboxctlConfig{
+				Enabled:     true,
+				Command:     []string{"true"},
+				Interval:    time.Minute,
+				EventBuffer: 5,
+			},
+		},
+	})
+	require.NoError(t, err)
+
+	var buf bytes.Buffer
+	agent.writeQueueMetrics(&buf)
+	output := buf.String()
+	assert.Contains(t, output, `sboxagent_event_queue_length{agent_id="metrics-test",service="sboxctl",queue="sboxctl"} 0`)
+	assert.Contains(t, output, `sboxagent_event_queue_capacity{agent_id="metrics-test",service="sboxctl",queue="sboxctl"} 5`)
+	assert.Contains(t, output, `sboxagent_event_queue_dropped_total{agent_id="metrics-test",service="sboxctl",queue="sboxctl"} 0`)
+}
@@ -0,0 +1,101 @@
+package agent
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/google/uuid"
+)
+
+// MultiUpdate applies a subscription to several clients as one
+// transaction: every config is generated and validated before any is
+// written, then all are swapped in and the clients reloaded. When a swap,
+// reload or verify fails, every client already swapped is rolled back to
+// its previous config, and the new config of a client that had none is
+// removed. The client pipelines share one pipeline ID in their
+// UPDATE_STEP events.
+type MultiUpdate struct {
+	agent     *Agent
+	id        string
+	pipelines []*UpdatePipeline
+}
+
+// NewMultiUpdate creates the update of several clients
+func (a *Agent) NewMultiUpdate(clients []string) (*MultiUpdate, error) {
+	m := &MultiUpdate{agent: a, id: uuid.NewString()}
+	for _, client := range clients {
+		pipeline, err := a.NewUpdatePipeline(client)
+		if err != nil {
+			return nil, err
+		}
+		pipeline.id = m.id
+		m.pipelines = append(m.pipelines, pipeline)
+	}
+	return m, nil
+}
+
+// Run applies the new configs of all clients, or none of them
+func (m *MultiUpdate) Run(ctx context.Context) ([]*ImportResult, error) {
+	for _, p := range m.pipelines {
+		if err := p.prepare(ctx); err != nil {
+			return nil, err
+		}
+	}
+	for _, p := range m.pipelines {
+		if err := m.agent.waitConfigLease(ctx, p.client); err != nil {
+			return nil, fmt.Errorf("deferred while %s config is leased: %w", p.client, err)
+		}
+	}
+
+	for i, p := range m.pipelines {
+		if err := p.swap(); err != nil {
+			return nil, m.rollback(ctx, m.pipelines[:i], err)
+		}
+	}
+	results := make([]*ImportResult, 0, len(m.pipelines))
+	for _, p := range m.pipelines {
+		result := p.result()
+		if err := p.activate(ctx, result); err != nil {
+			return nil, m.rollback(ctx, m.pipelines, err)
+		}
+		results = append(results, result)
+	}
+
+	for i, p := range m.pipelines {
+		p.complete(results[i])
+	}
+	return results, nil
+}
+
+// rollback restores the previous configs of the applied pipelines,
+// removing those of clients that had none, and returns cause, noting how
+// each client was rolled back
+func (m *MultiUpdate) rollback(ctx context.Context, applied []*UpdatePipeline, cause error) error {
+	if len(applied) == 0 {
+		return cause
+	}
+	notes := make([]string, 0, len(applied))
+	for _, p := range applied {
+		switch {
+		case !p.previous:
+			// The client had no config, so the new one is removed
+			if err := p.discard(ctx, cause); err != nil {
+				notes = append(notes, fmt.Sprintf("%s rollback failed: %v", p.client, err))
+			} else {
+				notes = append(notes, fmt.Sprintf("%s new config removed", p.client))
+			}
+		case p.backup == "":
+			p.skip(StepRollback)
+			notes = append(notes, fmt.Sprintf("%s has no previous config to roll back to", p.client))
+		default:
+			if err := p.restore(ctx, cause); err != nil {
+				notes = append(notes, fmt.Sprintf("%s rollback failed: %v", p.client, err))
+			} else {
+				notes = append(notes, fmt.Sprintf("%s rolled back to %s", p.client, filepath.Base(p.backup)))
+			}
+		}
+	}
+	return fmt.Errorf("%w; %s", cause, strings.Join(notes, "; "))
+}
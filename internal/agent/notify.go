@@ -0,0 +1,45 @@
+package agent
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// notifyEvent spools a notification for an agent event if its type is
+// configured
+func (a *Agent) notifyEvent(eventType string, data interface{}) {
+	if a.notifier == nil || !a.notifier.Wants(eventType) {
+		return
+	}
+
+	fields := eventFields(data)
+	message := fmt.Sprintf("%s: %s", a.GetConfig().Agent.Name, eventType)
+	for _, key := range []string{"to", "clientType", "reason", "error"} {
+		if value, ok := fields[key]; ok && value != "" {
+			message += fmt.Sprintf(" %s=%v", key, value)
+		}
+	}
+
+	if err := a.notifier.Notify(eventType, message, fields); err != nil {
+		a.logger.Error("Failed to queue notification", map[string]interface{}{
+			"type":  eventType,
+			"error": err.Error(),
+		})
+	}
+}
+
+// eventFields converts event data to a generic map for notifications
+func eventFields(data interface{}) map[string]interface{} {
+	if fields, ok := data.(map[string]interface{}); ok {
+		return fields
+	}
+	encoded, err := json.Marshal(data)
+	if err != nil {
+		return nil
+	}
+	var fields map[string]interface{}
+	if err := json.Unmarshal(encoded, &fields); err != nil {
+		return nil
+	}
+	return fields
+}
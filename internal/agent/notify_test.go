@@ -0,0 +1,51 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/kpblcaoo/sboxagent/internal/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAgent_NotifiesConfiguredEvents(t *testing.T) {
+	messages := make(chan string, 10)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body map[string]interface{}
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&body))
+		messages <- body["message"].(string)
+	}))
+	defer server.Close()
+
+	agent, err := New(&config.Config{
+		Agent: config.AgentConfig{Name: "notify-test", LogLevel: "error"},
+		Notifications: config.NotificationsConfig{
+			Enabled:          true,
+			Events:           []string{"IMPORT_FAILED"},
+			SpoolDir:         t.TempDir(),
+			RetryInterval:    time.Minute,
+			MaxRetryInterval: time.Minute,
+			Expiry:           time.Hour,
+			Webhook:          config.WebhookConfig{Enabled: true, URL: server.URL},
+		},
+	})
+	require.NoError(t, err)
+
+	agent.publishEvent("IMPORT_COMPLETED", map[string]interface{}{"clientType": "sing-box"})
+	agent.publishEvent("IMPORT_FAILED", map[string]interface{}{"clientType": "sing-box", "error": "sboxmgr failed"})
+	assert.Equal(t, 1, agent.GetStatus()["notifications"].(map[string]interface{})["pending"])
+
+	agent.notifier.Deliver(context.Background(), time.Now())
+	select {
+	case message := <-messages:
+		assert.Equal(t, "notify-test: IMPORT_FAILED clientType=sing-box error=sboxmgr failed", message)
+	default:
+		t.Fatal("notification was not delivered")
+	}
+	assert.Empty(t, messages)
+}
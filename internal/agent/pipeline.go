@@ -0,0 +1,444 @@
+package agent
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/kpblcaoo/sboxagent/internal/config"
+	"github.com/kpblcaoo/sboxagent/internal/importer"
+	"github.com/kpblcaoo/sboxagent/internal/lsm"
+)
+
+// Timing of the verify step, which waits for a reloaded client to report
+// the saved config through its controller API
+const (
+	verifyTimeout  = 10 * time.Second
+	verifyInterval = 500 * time.Millisecond
+)
+
+// PipelineStep names a step of the update pipeline
+type PipelineStep string
+
+// Steps of the update pipeline, in order. Rollback runs only when reload
+// or verify fail after a new config was applied.
+const (
+	StepGenerate PipelineStep = "generate"
+	StepValidate PipelineStep = "validate"
+	StepBackup   PipelineStep = "backup"
+	StepApply    PipelineStep = "apply"
+	StepReload   PipelineStep = "reload"
+	StepVerify   PipelineStep = "verify"
+	StepRollback PipelineStep = "rollback"
+)
+
+// UpdatePipeline updates the config of one client: sboxmgr generates it,
+// it is validated, the current config is backed up and replaced, and the
+// client is reloaded and verified. A client that fails to reload or verify
+// is rolled back to the backup. Each step publishes an UPDATE_STEP event.
+type UpdatePipeline struct {
+	agent  *Agent
+	id     string
+	client string
+	path   string
+	// config is the agent config when the pipeline was created, so a
+	// runtime config change does not affect a running update
+	config *config.Config
+
+	imported *importer.ImportedConfig
+	// previous tells whether a config existed to back up; backup is its
+	// backup file once the new config is applied
+	previous bool
+	backup   string
+	// reloaded is set once the client was reloaded on the new config
+	reloaded bool
+	// warnings name features the installed client is too old for
+	warnings []string
+}
+
+// UpdateStepEvent is the data of an UPDATE_STEP event
+type UpdateStepEvent struct {
+	PipelineID string       `json:"pipelineId"`
+	ClientType string       `json:"clientType"`
+	Step       PipelineStep `json:"step"`
+	// Status is started, completed, skipped or failed
+	Status string `json:"status"`
+	Error  string `json:"error,omitempty"`
+}
+
+// UpdatePreview is what an update would change, found by a dry run
+type UpdatePreview struct {
+	ClientType string                  `json:"clientType"`
+	Source     string                  `json:"source,omitempty"`
+	ConfigPath string                  `json:"configPath"`
+	Checksum   string                  `json:"checksum"`
+	HasChanges bool                    `json:"hasChanges"`
+	Changes    []importer.ConfigChange `json:"changes"`
+	Warnings   []string                `json:"warnings,omitempty"`
+}
+
+// NewUpdatePipeline creates the update pipeline of a client, defaulting
+// to the import client type
+func (a *Agent) NewUpdatePipeline(client string) (*UpdatePipeline, error) {
+	client, path, err := a.clientConfigPath(client)
+	if err != nil {
+		return nil, err
+	}
+	return &UpdatePipeline{
+		agent:  a,
+		id:     uuid.NewString(),
+		client: client,
+		path:   path,
+		config: a.GetConfig(),
+	}, nil
+}
+
+// Run runs the pipeline and returns the applied update. When reload or
+// verify fail the previous config is restored and the error says so.
+func (p *UpdatePipeline) Run(ctx context.Context) (*ImportResult, error) {
+	if err := p.prepare(ctx); err != nil {
+		return nil, err
+	}
+	if err := p.agent.waitConfigLease(ctx, p.client); err != nil {
+		return nil, fmt.Errorf("deferred while %s config is leased: %w", p.client, err)
+	}
+	if err := p.swap(); err != nil {
+		return nil, err
+	}
+	result := p.result()
+	if err := p.activate(ctx, result); err != nil {
+		return nil, p.rollback(ctx, err)
+	}
+	p.complete(result)
+	return result, nil
+}
+
+// prepare generates and validates the new config
+func (p *UpdatePipeline) prepare(ctx context.Context) error {
+	if err := p.step(StepGenerate, func() error { return p.generate(ctx) }); err != nil {
+		return fmt.Errorf("failed to import config: %w", err)
+	}
+	if err := p.step(StepValidate, func() error { return p.validate(ctx) }); err != nil {
+		return fmt.Errorf("refusing to apply %s config: %w", p.client, err)
+	}
+	return nil
+}
+
+// swap backs up the current config and replaces it with the new one
+func (p *UpdatePipeline) swap() error {
+	if err := p.step(StepBackup, p.checkBackup); err != nil {
+		return fmt.Errorf("failed to back up %s config: %w", p.client, err)
+	}
+	if err := p.step(StepApply, p.apply); err != nil {
+		return fmt.Errorf("failed to save imported config: %w", lsm.Explain(err))
+	}
+	return nil
+}
+
+// result describes the applied config
+func (p *UpdatePipeline) result() *ImportResult {
+	return &ImportResult{
+		ClientType: p.client,
+		Source:     p.imported.Metadata.Source,
+		ConfigPath: p.path,
+		BackupPath: p.backup,
+		Checksum:   p.imported.Metadata.Checksum,
+		Warnings:   p.warnings,
+	}
+}
+
+// activate reloads the client on the applied config and verifies it, if
+// the client can be reloaded
+func (p *UpdatePipeline) activate(ctx context.Context, result *ImportResult) error {
+	a := p.agent
+	if !a.canReload(p.client) {
+		p.skip(StepReload)
+		p.skip(StepVerify)
+		return nil
+	}
+	p.reloaded = true
+	if err := p.step(StepReload, func() error { return a.reloadClient(ctx, p.client) }); err != nil {
+		return fmt.Errorf("failed to reload %s: %w", p.client, err)
+	}
+	result.Reloaded = true
+	if err := p.step(StepVerify, func() error { return p.verify(ctx) }); err != nil {
+		return fmt.Errorf("failed to verify %s: %w", p.client, err)
+	}
+	result.Verified = true
+	return nil
+}
+
+// complete logs and publishes an applied update
+func (p *UpdatePipeline) complete(result *ImportResult) {
+	p.agent.logger.Info("Imported client configuration", map[string]interface{}{
+		"client":   result.ClientType,
+		"source":   result.Source,
+		"path":     result.ConfigPath,
+		"backup":   result.BackupPath,
+		"checksum": result.Checksum,
+	})
+	p.agent.publishEvent("IMPORT_COMPLETED", result)
+	p.agent.clearFallback(result.ClientType)
+}
+
+// DryRun generates and validates the new config and compares it with the
+// current one, without writing files or reloading the client
+func (p *UpdatePipeline) DryRun(ctx context.Context) (*UpdatePreview, error) {
+	if err := p.step(StepGenerate, func() error { return p.generate(ctx) }); err != nil {
+		return nil, fmt.Errorf("failed to import config: %w", err)
+	}
+	if err := p.step(StepValidate, func() error { return p.validate(ctx) }); err != nil {
+		return nil, fmt.Errorf("%s config would be refused: %w", p.client, err)
+	}
+
+	changes, err := p.agent.importer.DiffConfig(p.imported, p.path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to compare %s config: %w", p.client, err)
+	}
+	return &UpdatePreview{
+		ClientType: p.client,
+		Source:     p.imported.Metadata.Source,
+		ConfigPath: p.path,
+		Checksum:   p.imported.Metadata.Checksum,
+		HasChanges: len(changes) > 0,
+		Changes:    changes,
+		Warnings:   p.warnings,
+	}, nil
+}
+
+// generate imports the configured subscriptions with sboxmgr, passing it the
+// client's template variables
+func (p *UpdatePipeline) generate(ctx context.Context) error {
+	cfg := p.config.Import
+	overrides, _ := p.config.Clients.Overrides(p.client)
+	req := importer.ImportRequest{
+		SubscriptionURL: cfg.SubscriptionURL,
+		ClientType:      p.client,
+		Options:         cfg.Options,
+		Vars:            overrides.TemplateVars,
+		Timeout:         p.config.Services.CLI.ActionTimeout("export", cfg.Timeout),
+	}
+	var err error
+	if len(cfg.Sources) > 0 {
+		p.imported, err = p.agent.importer.ImportSources(ctx, req, cfg.Sources)
+	} else {
+		p.imported, err = p.agent.importer.ImportFromSboxmgr(ctx, req)
+	}
+	return err
+}
+
+// validate checks the generated config and, if enabled, that its inbound
+// ports are free and that the client's own checker accepts it. Features
+// the installed client is too old for are only warned about.
+func (p *UpdatePipeline) validate(ctx context.Context) error {
+	if !p.imported.Validation.Valid {
+		return fmt.Errorf("config failed verification")
+	}
+	p.warnings = p.agent.checkConfigVersion(p.client, p.imported.Config)
+	if p.config.Import.CheckPorts {
+		if err := p.agent.checkPorts(p.client, p.imported.Config); err != nil {
+			return err
+		}
+	}
+	if p.config.Import.CheckConfig {
+		return p.agent.checkClientConfig(ctx, p.client, p.path, p.imported.Config)
+	}
+	return nil
+}
+
+// checkBackup makes sure the current config can be read, so applying can
+// back it up and a failed update can be rolled back
+func (p *UpdatePipeline) checkBackup() error {
+	file, err := os.Open(p.path)
+	if errors.Is(err, os.ErrNotExist) {
+		p.previous = false
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	p.previous = true
+	return file.Close()
+}
+
+// apply saves the new config, keeping the current one as a backup
+func (p *UpdatePipeline) apply() error {
+	backup, err := p.agent.importer.SaveImportedConfig(p.imported, p.path)
+	if err != nil {
+		return err
+	}
+	p.backup = backup
+	return nil
+}
+
+// verify checks that the reloaded client runs: its unit is active, the
+// verify command succeeds and, for clients with a controller API, the
+// running config matches the saved one
+func (p *UpdatePipeline) verify(ctx context.Context) error {
+	a := p.agent
+	cfg := a.GetConfig()
+	if cfg.Services.Systemd.Enabled {
+		if err := a.checkUnitActive(ctx); err != nil {
+			return fmt.Errorf("%s is not active: %w", cfg.Services.Systemd.ServiceName, err)
+		}
+	}
+	if command := cfg.Import.VerifyCommand; len(command) > 0 {
+		if err := a.runCommand(ctx, cfg.Services.CLI.ActionTimeout("reload", cfg.Import.Timeout), command); err != nil {
+			return fmt.Errorf("verify command failed: %w", err)
+		}
+	}
+
+	// The client may take a moment to come back after the reload
+	deadline := time.Now().Add(verifyTimeout)
+	for {
+		view, err := a.ClientConfig(ctx, p.client)
+		switch {
+		case err != nil:
+			return err
+		case view.API == "":
+			// No controller API to ask
+			return nil
+		case view.RuntimeError == "" && !view.Diverged:
+			return nil
+		}
+		if time.Now().After(deadline) {
+			if view.RuntimeError != "" {
+				return fmt.Errorf("client API unreachable: %s", view.RuntimeError)
+			}
+			return fmt.Errorf("running config differs from the saved one in %d settings", len(view.Differences))
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(verifyInterval):
+		}
+	}
+}
+
+// rollback restores the backup taken by apply and reloads the client, or
+// removes the new config of a client that had none. It returns cause,
+// noting whether the rollback succeeded.
+func (p *UpdatePipeline) rollback(ctx context.Context, cause error) error {
+	if !p.previous {
+		if err := p.discard(ctx, cause); err != nil {
+			return fmt.Errorf("%w; rollback failed: %v", cause, err)
+		}
+		return fmt.Errorf("%w; new config removed", cause)
+	}
+	if p.backup == "" {
+		p.skip(StepRollback)
+		return fmt.Errorf("%w; no previous config to roll back to", cause)
+	}
+	if err := p.restore(ctx, cause); err != nil {
+		return fmt.Errorf("%w; rollback failed: %v", cause, err)
+	}
+	return fmt.Errorf("%w; rolled back to %s", cause, filepath.Base(p.backup))
+}
+
+// restore puts the backup taken by apply back and, if the client was
+// reloaded on the new config, reloads it again
+func (p *UpdatePipeline) restore(ctx context.Context, cause error) error {
+	a := p.agent
+	err := p.step(StepRollback, func() error {
+		if _, err := importer.RestoreBackup(p.path, filepath.Base(p.backup)); err != nil {
+			return err
+		}
+		if !p.reloaded {
+			return nil
+		}
+		return a.reloadClient(ctx, p.client)
+	})
+	if err != nil {
+		a.logger.Error("Failed to roll back client configuration", map[string]interface{}{
+			"client": p.client,
+			"backup": p.backup,
+			"error":  err.Error(),
+		})
+		return err
+	}
+
+	a.logger.Warn("Rolled back client configuration", map[string]interface{}{
+		"client": p.client,
+		"backup": p.backup,
+		"error":  cause.Error(),
+	})
+	a.publishEvent("UPDATE_ROLLED_BACK", map[string]interface{}{
+		"pipelineId": p.id,
+		"clientType": p.client,
+		"backup":     filepath.Base(p.backup),
+		"error":      cause.Error(),
+		"severity":   "error",
+	})
+	return nil
+}
+
+// discard removes a config applied where the client had none and, if the
+// client was reloaded on it, reloads the client again
+func (p *UpdatePipeline) discard(ctx context.Context, cause error) error {
+	a := p.agent
+	err := p.step(StepRollback, func() error {
+		if err := os.Remove(p.path); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+		if !p.reloaded {
+			return nil
+		}
+		return a.reloadClient(ctx, p.client)
+	})
+	if err != nil {
+		a.logger.Error("Failed to remove client configuration", map[string]interface{}{
+			"client": p.client,
+			"path":   p.path,
+			"error":  err.Error(),
+		})
+		return err
+	}
+
+	a.logger.Warn("Removed new client configuration", map[string]interface{}{
+		"client": p.client,
+		"path":   p.path,
+		"error":  cause.Error(),
+	})
+	a.publishEvent("UPDATE_ROLLED_BACK", map[string]interface{}{
+		"pipelineId": p.id,
+		"clientType": p.client,
+		"removed":    true,
+		"error":      cause.Error(),
+		"severity":   "error",
+	})
+	return nil
+}
+
+// step runs one step, publishing its start and outcome
+func (p *UpdatePipeline) step(step PipelineStep, run func() error) error {
+	p.publish(step, "started", nil)
+	if err := run(); err != nil {
+		p.publish(step, "failed", err)
+		return err
+	}
+	p.publish(step, "completed", nil)
+	return nil
+}
+
+// skip publishes a step that does not apply to this update
+func (p *UpdatePipeline) skip(step PipelineStep) {
+	p.publish(step, "skipped", nil)
+}
+
+// publish sends an UPDATE_STEP event
+func (p *UpdatePipeline) publish(step PipelineStep, status string, err error) {
+	event := UpdateStepEvent{
+		PipelineID: p.id,
+		ClientType: p.client,
+		Step:       step,
+		Status:     status,
+	}
+	if err != nil {
+		event.Error = err.Error()
+	}
+	p.agent.publishEvent("UPDATE_STEP", event)
+}
@@ -0,0 +1,251 @@
+package agent
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/kpblcaoo/sboxagent/internal/config"
+	"github.com/kpblcaoo/sboxagent/internal/importer"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// pipelineAgent creates an agent importing payload into a sing-box config
+// that already holds previous
+func pipelineAgent(t *testing.T, payload, previous string, verify []string) (*Agent, string) {
+	dir := t.TempDir()
+	script, _ := fakeSboxmgr(t, dir, payload)
+	clientConfig := filepath.Join(dir, "sing-box.json")
+	require.NoError(t, os.WriteFile(clientConfig, []byte(previous), 0644))
+
+	agent, err := New(&config.Config{
+		Agent:   config.AgentConfig{Name: "pipeline-test", LogLevel: "error"},
+		Clients: config.ClientsConfig{SingBox: config.SingBoxConfig{ConfigPath: clientConfig}},
+		Import: config.ImportConfig{
+			Enabled:         true,
+			SubscriptionURL: "https://sub.example.com/list",
+			ClientType:      "sing-box",
+			Schedule:        time.Hour,
+			Timeout:         5 * time.Second,
+			Command:         []string{script},
+			ReloadCommand:   []string{"true"},
+			VerifyCommand:   verify,
+		},
+	})
+	require.NoError(t, err)
+	return agent, clientConfig
+}
+
+func TestUpdatePipeline_Run(t *testing.T) {
+	payload := `{"outbounds":[{"type":"direct"}]}`
+	agent, clientConfig := pipelineAgent(t, payload, `{"outbounds":[]}`, []string{"true"})
+
+	pipeline, err := agent.NewUpdatePipeline("")
+	require.NoError(t, err)
+	result, err := pipeline.Run(context.Background())
+	require.NoError(t, err)
+	assert.True(t, result.Reloaded)
+	assert.True(t, result.Verified)
+	assert.NotEmpty(t, result.BackupPath)
+
+	saved, err := os.ReadFile(clientConfig)
+	require.NoError(t, err)
+	assert.JSONEq(t, payload, string(saved))
+}
+
+func TestUpdatePipeline_PassesTemplateVars(t *testing.T) {
+	agent, _ := pipelineAgent(t, `{"outbounds":[]}`, `{}`, []string{"true"})
+
+	// Record the arguments sboxmgr is run with
+	dir := t.TempDir()
+	argsFile := filepath.Join(dir, "args")
+	wrapper := filepath.Join(dir, "sboxmgr")
+	require.NoError(t, os.WriteFile(wrapper, []byte("#!/bin/sh\necho \"$@\" > "+argsFile+"\nexec "+agent.config.Import.Command[0]+"\n"), 0755))
+	agent.config.Import.Command = []string{wrapper}
+	agent.importer = importer.NewImporter(agent.config.Import, agent.logger)
+	agent.config.Clients.SingBox.TemplateVars = map[string]string{"log_level": "warn"}
+
+	pipeline, err := agent.NewUpdatePipeline("sing-box")
+	require.NoError(t, err)
+	_, err = pipeline.Run(context.Background())
+	require.NoError(t, err)
+
+	args, err := os.ReadFile(argsFile)
+	require.NoError(t, err)
+	assert.Contains(t, string(args), "--var log_level=warn")
+}
+
+func TestUpdatePipeline_ClientRejectsConfig(t *testing.T) {
+	previous := `{"outbounds":[]}`
+	agent, clientConfig := pipelineAgent(t, `{"outbounds":[{"type":"anytls"}]}`, previous, []string{"true"})
+
+	// A fake sing-box checker rejecting the config it is given
+	binary := filepath.Join(t.TempDir(), "sing-box")
+	require.NoError(t, os.WriteFile(binary, []byte(`#!/bin/sh
+[ "$1" = check ] && [ "$2" = -c ] && grep -q anytls "$3" || exit 0
+echo 'FATAL[0000] decode config at '"$3"': outbounds[0]: unknown outbound type: anytls' >&2
+exit 1
+`), 0755))
+	agent.config.Clients.SingBox.BinaryPath = binary
+	agent.config.Import.CheckConfig = true
+
+	pipeline, err := agent.NewUpdatePipeline("sing-box")
+	require.NoError(t, err)
+	_, err = pipeline.Run(context.Background())
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "refusing to apply sing-box config: sing-box rejected the config: exit status 1")
+	assert.Contains(t, err.Error(), "unknown outbound type: anytls")
+
+	saved, err := os.ReadFile(clientConfig)
+	require.NoError(t, err)
+	assert.JSONEq(t, previous, string(saved))
+	matches, err := filepath.Glob(filepath.Join(os.TempDir(), "sboxagent-check-*"))
+	require.NoError(t, err)
+	assert.Empty(t, matches, "the checked copy is removed")
+
+	// Configs the checker accepts are applied
+	accepted, _ := pipelineAgent(t, `{"outbounds":[{"type":"direct"}]}`, previous, []string{"true"})
+	accepted.config.Clients.SingBox.BinaryPath = binary
+	accepted.config.Import.CheckConfig = true
+	pipeline, err = accepted.NewUpdatePipeline("sing-box")
+	require.NoError(t, err)
+	_, err = pipeline.Run(context.Background())
+	assert.NoError(t, err)
+}
+
+func TestUpdatePipeline_RollsBackFailedVerify(t *testing.T) {
+	previous := `{"outbounds":[]}`
+	agent, clientConfig := pipelineAgent(t, `{"outbounds":[{"type":"direct"}]}`, previous, []string{"false"})
+
+	pipeline, err := agent.NewUpdatePipeline("sing-box")
+	require.NoError(t, err)
+	_, err = pipeline.Run(context.Background())
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "verify command failed")
+	assert.Contains(t, err.Error(), "rolled back to")
+
+	saved, err := os.ReadFile(clientConfig)
+	require.NoError(t, err)
+	assert.JSONEq(t, previous, string(saved))
+}
+
+func TestUpdatePipeline_FirstTimeClientRollback(t *testing.T) {
+	agent, clientConfig := pipelineAgent(t, `{"outbounds":[{"type":"direct"}]}`, "", []string{"false"})
+	require.NoError(t, os.Remove(clientConfig))
+	reloads := filepath.Join(t.TempDir(), "reloads")
+	agent.config.Import.ReloadCommand = []string{"sh", "-c", "echo reload >> " + reloads}
+
+	pipeline, err := agent.NewUpdatePipeline("sing-box")
+	require.NoError(t, err)
+	_, err = pipeline.Run(context.Background())
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "new config removed")
+
+	// The rejected config is removed and the client reloaded without it
+	assert.NoFileExists(t, clientConfig)
+	data, err := os.ReadFile(reloads)
+	require.NoError(t, err)
+	assert.Equal(t, "reload\nreload\n", string(data))
+}
+
+func TestAgent_DryRunUpdate(t *testing.T) {
+	previous := `{"outbounds":[]}`
+	agent, clientConfig := pipelineAgent(t, `{"outbounds":[{"type":"direct"}]}`, previous, nil)
+	reloaded := filepath.Join(t.TempDir(), "reloaded")
+	agent.config.Import.ReloadCommand = []string{"touch", reloaded}
+
+	preview, err := agent.DryRunUpdate(context.Background(), "")
+	require.NoError(t, err)
+	assert.Equal(t, "sing-box", preview.ClientType)
+	assert.True(t, preview.HasChanges)
+	require.Len(t, preview.Changes, 1)
+	assert.Equal(t, "outbounds[0].type", preview.Changes[0].Path)
+	assert.Equal(t, "direct", preview.Changes[0].New)
+
+	// Nothing is written or reloaded
+	saved, err := os.ReadFile(clientConfig)
+	require.NoError(t, err)
+	assert.Equal(t, previous, string(saved))
+	assert.NoFileExists(t, reloaded)
+	backups, err := filepath.Glob(clientConfig + ".*")
+	require.NoError(t, err)
+	assert.Empty(t, backups)
+}
+
+func TestMultiUpdate(t *testing.T) {
+	previous := `{"outbounds":[]}`
+	payload := `{"outbounds":[{"type":"direct"}]}`
+	agent, singBoxConfig := pipelineAgent(t, payload, previous, []string{"false"})
+	xrayConfig := filepath.Join(t.TempDir(), "xray.json")
+	require.NoError(t, os.WriteFile(xrayConfig, []byte(previous), 0644))
+	agent.config.Clients.Xray.ConfigPath = xrayConfig
+	agent.config.Import.Clients = []string{"xray", "sing-box"}
+
+	// sboxmgr generates the config for the client named by its last argument
+	checksum, err := importer.Checksum([]byte(payload))
+	require.NoError(t, err)
+	script := filepath.Join(t.TempDir(), "sboxmgr")
+	require.NoError(t, os.WriteFile(script, []byte(`#!/bin/sh
+for client; do :; done
+printf '{"config":%s,"metadata":{"client_type":"%s","checksum":"%s"}}' '`+payload+`' "$client" '`+checksum+`'
+`), 0755))
+	agent.config.Import.Command = []string{script}
+	agent.importer = importer.NewImporter(agent.config.Import, agent.logger)
+
+	// sing-box fails to verify, so xray, applied first, is rolled back too
+	_, err = agent.runImports(context.Background())
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "failed to verify sing-box: verify command failed")
+	assert.Contains(t, err.Error(), "xray rolled back to xray.json.")
+	assert.Contains(t, err.Error(), "sing-box rolled back to sing-box.json.")
+	for _, path := range []string{xrayConfig, singBoxConfig} {
+		saved, err := os.ReadFile(path)
+		require.NoError(t, err)
+		assert.JSONEq(t, previous, string(saved))
+	}
+
+	agent.config.Import.VerifyCommand = []string{"true"}
+	results, err := agent.runImports(context.Background())
+	require.NoError(t, err)
+	require.Len(t, results, 2)
+	assert.Equal(t, "xray", results[0].ClientType)
+	assert.True(t, results[1].Verified)
+	for _, path := range []string{xrayConfig, singBoxConfig} {
+		saved, err := os.ReadFile(path)
+		require.NoError(t, err)
+		assert.JSONEq(t, payload, string(saved))
+	}
+}
+
+func TestMultiUpdate_FirstTimeClient(t *testing.T) {
+	previous := `{"outbounds":[]}`
+	payload := `{"outbounds":[{"type":"direct"}]}`
+	agent, singBoxConfig := pipelineAgent(t, payload, previous, []string{"false"})
+	// xray has no config yet
+	xrayConfig := filepath.Join(t.TempDir(), "xray.json")
+	agent.config.Clients.Xray.ConfigPath = xrayConfig
+	agent.config.Import.Clients = []string{"xray", "sing-box"}
+
+	checksum, err := importer.Checksum([]byte(payload))
+	require.NoError(t, err)
+	script := filepath.Join(t.TempDir(), "sboxmgr")
+	require.NoError(t, os.WriteFile(script, []byte(`#!/bin/sh
+for client; do :; done
+printf '{"config":%s,"metadata":{"client_type":"%s","checksum":"%s"}}' '`+payload+`' "$client" '`+checksum+`'
+`), 0755))
+	agent.config.Import.Command = []string{script}
+	agent.importer = importer.NewImporter(agent.config.Import, agent.logger)
+
+	// sing-box fails to verify, so the config written for xray is removed
+	_, err = agent.runImports(context.Background())
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "xray new config removed")
+	assert.Contains(t, err.Error(), "sing-box rolled back to sing-box.json.")
+	assert.NoFileExists(t, xrayConfig)
+	saved, err := os.ReadFile(singBoxConfig)
+	require.NoError(t, err)
+	assert.JSONEq(t, previous, string(saved))
+}
@@ -0,0 +1,54 @@
+package agent
+
+import (
+	"fmt"
+
+	"github.com/kpblcaoo/sboxagent/internal/privilege"
+	"github.com/kpblcaoo/sboxagent/internal/process"
+)
+
+// dropPrivileges drops the capabilities the agent does not need and
+// switches to the service account. It runs once the socket and API are
+// bound, which may need privileges the agent then gives up.
+func (a *Agent) dropPrivileges() error {
+	cfg := a.GetConfig().Security.Privileges
+	if !cfg.Enabled() {
+		return nil
+	}
+	opts := privilege.Options{Drop: cfg.DropCapabilities, Keep: cfg.KeepCapabilities}
+	if cfg.User != "" {
+		credential, err := process.LookupCredential(cfg.User, cfg.Group)
+		if err != nil {
+			return err
+		}
+		opts.SwitchUser = true
+		opts.UID = int(credential.UID)
+		opts.GID = int(credential.GID)
+	}
+	if err := privilege.Apply(opts); err != nil {
+		return fmt.Errorf("failed to drop privileges: %w", err)
+	}
+
+	state, err := privilege.Current()
+	if err != nil {
+		return err
+	}
+	a.logger.Info("Privileges dropped", map[string]interface{}{
+		"uid":       state.UID,
+		"gid":       state.GID,
+		"effective": state.Effective,
+	})
+	return nil
+}
+
+// privilegeStatus reports the effective privileges when they are reduced
+func (a *Agent) privilegeStatus() (privilege.State, bool) {
+	if !a.GetConfig().Security.Privileges.Enabled() {
+		return privilege.State{}, false
+	}
+	state, err := privilege.Current()
+	if err != nil {
+		return privilege.State{}, false
+	}
+	return state, true
+}
@@ -0,0 +1,254 @@
+package agent
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"os"
+	"os/exec"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/kpblcaoo/sboxagent/internal/config"
+	"github.com/kpblcaoo/sboxagent/internal/health"
+	"github.com/kpblcaoo/sboxagent/internal/ports"
+)
+
+// ClientProbe is the last liveness probe of a client: whether its process
+// runs and the inbound ports of its config listen
+type ClientProbe struct {
+	Client  string      `json:"client"`
+	PID     int         `json:"pid,omitempty"`
+	Running bool        `json:"running"`
+	Ports   []PortProbe `json:"ports,omitempty"`
+	Error   string      `json:"error,omitempty"`
+	// Failures counts failed probes in a row
+	Failures  int       `json:"failures"`
+	CheckedAt time.Time `json:"checkedAt"`
+}
+
+// PortProbe is the probe of one inbound port
+type PortProbe struct {
+	ports.Listener
+	Listening bool   `json:"listening"`
+	Error     string `json:"error,omitempty"`
+}
+
+// healthy tells whether the client runs and all its ports listen
+func (p ClientProbe) healthy() bool {
+	if !p.Running || p.Error != "" {
+		return false
+	}
+	for _, port := range p.Ports {
+		if !port.Listening {
+			return false
+		}
+	}
+	return true
+}
+
+// watchClientProbes probes the installed clients on the monitoring interval
+func (a *Agent) watchClientProbes() {
+	defer a.wg.Done()
+
+	ticker := time.NewTicker(a.GetConfig().Services.Monitoring.Interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-a.ctx.Done():
+			return
+		case <-ticker.C:
+			if a.ClientsStopped() == nil {
+				a.probeClients(a.ctx)
+			}
+		}
+	}
+}
+
+// probeClients probes the enabled clients whose binary is installed
+func (a *Agent) probeClients(ctx context.Context) {
+	cfg := a.GetConfig()
+	for _, name := range config.ClientNames {
+		if !cfg.Clients.Enabled(name) {
+			continue
+		}
+		binary, _ := cfg.Clients.BinaryPath(name)
+		if binary == "" {
+			binary = name
+		}
+		if _, err := exec.LookPath(binary); err != nil {
+			continue
+		}
+		probeCtx, cancel := context.WithTimeout(ctx, cfg.Services.Monitoring.Timeout)
+		probe := a.probeClient(probeCtx, name, binary)
+		cancel()
+		a.recordClientProbe(probe)
+	}
+}
+
+// probeClient checks that a client's process runs and that the inbound
+// ports of its config listen: TCP ports accept a connection, UDP ports are
+// bound
+func (a *Agent) probeClient(ctx context.Context, client, binary string) ClientProbe {
+	probe := ClientProbe{Client: client, CheckedAt: time.Now()}
+	checker := ports.NewChecker()
+	pid, err := checker.Process(binary)
+	if err != nil {
+		probe.Error = err.Error()
+		return probe
+	}
+	probe.PID = pid
+	probe.Running = pid != 0
+	if !probe.Running {
+		return probe
+	}
+
+	path, _ := a.GetConfig().Clients.ConfigPath(client)
+	data, err := os.ReadFile(path)
+	if err != nil {
+		probe.Error = fmt.Sprintf("failed to read config: %v", err)
+		return probe
+	}
+	listeners, err := ports.Listeners(client, data)
+	if err != nil {
+		probe.Error = err.Error()
+		return probe
+	}
+	for _, listener := range listeners {
+		port := PortProbe{Listener: listener}
+		if listener.Network == "udp" {
+			port.Listening, err = checker.Bound(listener)
+		} else {
+			err = dialListener(ctx, listener)
+			port.Listening = err == nil
+		}
+		if err != nil {
+			port.Error = err.Error()
+		}
+		probe.Ports = append(probe.Ports, port)
+	}
+	return probe
+}
+
+// dialListener connects to a TCP listener, on loopback when it listens on
+// all addresses
+func dialListener(ctx context.Context, listener ports.Listener) error {
+	host := listener.Host
+	if host == "" {
+		host = "127.0.0.1"
+	}
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "tcp", net.JoinHostPort(host, strconv.Itoa(listener.Port)))
+	if err != nil {
+		return err
+	}
+	return conn.Close()
+}
+
+// recordClientProbe stores a probe, counting failures in a row. Reaching
+// the failure threshold publishes CLIENT_PROBE_FAILED; the next healthy
+// probe publishes CLIENT_PROBE_RECOVERED.
+func (a *Agent) recordClientProbe(probe ClientProbe) {
+	threshold := a.GetConfig().Services.Monitoring.FailureThreshold
+	a.mu.Lock()
+	previous := a.clientProbes[probe.Client]
+	if !probe.healthy() {
+		probe.Failures = previous.Failures + 1
+	}
+	if a.clientProbes == nil {
+		a.clientProbes = make(map[string]ClientProbe)
+	}
+	a.clientProbes[probe.Client] = probe
+	a.mu.Unlock()
+
+	switch {
+	case probe.Failures == threshold:
+		a.logger.Warn("Client probe failed", map[string]interface{}{
+			"client":   probe.Client,
+			"failures": probe.Failures,
+			"reason":   probe.reason(),
+		})
+		a.publishEvent("CLIENT_PROBE_FAILED", map[string]interface{}{
+			"severity": "critical",
+			"client":   probe.Client,
+			"error":    probe.reason(),
+			"probe":    probe,
+		})
+	case probe.Failures == 0 && previous.Failures >= threshold:
+		a.logger.Info("Client probe recovered", map[string]interface{}{
+			"client": probe.Client,
+		})
+		a.publishEvent("CLIENT_PROBE_RECOVERED", map[string]interface{}{
+			"client": probe.Client,
+			"probe":  probe,
+		})
+	}
+}
+
+// reason describes why a probe failed
+func (p ClientProbe) reason() string {
+	switch {
+	case p.Error != "":
+		return p.Error
+	case !p.Running:
+		return "process not running"
+	}
+	var closed []string
+	for _, port := range p.Ports {
+		if !port.Listening {
+			closed = append(closed, port.Listener.String())
+		}
+	}
+	return "not listening on " + strings.Join(closed, ", ")
+}
+
+// ClientProbes returns the last probe of each client by client name
+func (a *Agent) ClientProbes() map[string]ClientProbe {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	probes := make(map[string]ClientProbe, len(a.clientProbes))
+	for client, probe := range a.clientProbes {
+		probes[client] = probe
+	}
+	return probes
+}
+
+// clientProbeCheck reports the client probes as a health component:
+// unhealthy once a client reaches the failure threshold, degraded while
+// probes fail below it
+type clientProbeCheck struct {
+	agent *Agent
+}
+
+func (c clientProbeCheck) Name() string {
+	return "client_probes"
+}
+
+func (c clientProbeCheck) Check(ctx context.Context) health.ComponentHealth {
+	result := health.ComponentHealth{
+		Name:      c.Name(),
+		Status:    health.HealthStatusHealthy,
+		Message:   "Clients are running and listening",
+		Timestamp: time.Now(),
+	}
+	threshold := c.agent.GetConfig().Services.Monitoring.FailureThreshold
+	var failing []string
+	for client, probe := range c.agent.ClientProbes() {
+		if probe.Failures == 0 {
+			continue
+		}
+		failing = append(failing, client+": "+probe.reason())
+		if probe.Failures >= threshold {
+			result.Status = health.HealthStatusUnhealthy
+		} else if result.Status == health.HealthStatusHealthy {
+			result.Status = health.HealthStatusDegraded
+		}
+	}
+	if len(failing) > 0 {
+		sort.Strings(failing)
+		result.Message = strings.Join(failing, "; ")
+	}
+	return result
+}
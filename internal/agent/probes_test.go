@@ -0,0 +1,97 @@
+package agent
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/kpblcaoo/sboxagent/internal/config"
+	"github.com/kpblcaoo/sboxagent/internal/health"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAgent_ProbeClients(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("requires procfs")
+	}
+	dir := t.TempDir()
+	binary := filepath.Join(dir, "sing-box")
+	require.NoError(t, os.WriteFile(binary, []byte("#!/bin/sh\nwhile :; do sleep 1; done\n"), 0755))
+
+	// One inbound listens, the other does not
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer listener.Close()
+	closed, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	closedPort := closed.Addr().(*net.TCPAddr).Port
+	closed.Close()
+	clientConfig := filepath.Join(dir, "config.json")
+	writeInbounds := func(ports ...int) {
+		inbounds := ""
+		for i, port := range ports {
+			if i > 0 {
+				inbounds += ","
+			}
+			inbounds += fmt.Sprintf(`{"type":"mixed","listen":"127.0.0.1","listen_port":%d}`, port)
+		}
+		require.NoError(t, os.WriteFile(clientConfig, []byte(`{"inbounds":[`+inbounds+`]}`), 0644))
+	}
+	writeInbounds(listener.Addr().(*net.TCPAddr).Port, closedPort)
+
+	agent, err := New(&config.Config{
+		Agent: config.AgentConfig{Name: "probe-test", LogLevel: "error"},
+		Services: config.ServicesConfig{
+			Monitoring: config.MonitorConfig{Enabled: true, Interval: time.Minute, Timeout: 5 * time.Second, FailureThreshold: 2},
+		},
+		Clients: config.ClientsConfig{
+			SingBox: config.SingBoxConfig{Enabled: true, BinaryPath: binary, ConfigPath: clientConfig},
+		},
+	})
+	require.NoError(t, err)
+	check := clientProbeCheck{agent: agent}
+
+	// Not running
+	agent.probeClients(context.Background())
+	probe := agent.ClientProbes()["sing-box"]
+	assert.False(t, probe.Running)
+	assert.Equal(t, 1, probe.Failures)
+	assert.Equal(t, "process not running", probe.reason())
+	assert.Equal(t, health.HealthStatusDegraded, check.Check(context.Background()).Status)
+
+	cmd := exec.Command(binary)
+	require.NoError(t, cmd.Start())
+	defer func() {
+		cmd.Process.Kill()
+		cmd.Wait()
+	}()
+	require.Eventually(t, func() bool {
+		agent.probeClients(context.Background())
+		return agent.ClientProbes()["sing-box"].Running
+	}, 5*time.Second, 10*time.Millisecond)
+	probe = agent.ClientProbes()["sing-box"]
+	assert.Equal(t, cmd.Process.Pid, probe.PID)
+	require.Len(t, probe.Ports, 2)
+	assert.True(t, probe.Ports[0].Listening)
+	assert.False(t, probe.Ports[1].Listening)
+	assert.Equal(t, fmt.Sprintf("not listening on 127.0.0.1:%d/tcp", closedPort), probe.reason())
+	assert.GreaterOrEqual(t, probe.Failures, 2)
+	component := check.Check(context.Background())
+	assert.Equal(t, health.HealthStatusUnhealthy, component.Status)
+	assert.Contains(t, component.Message, "sing-box: not listening on")
+
+	// Recovers once all ports listen
+	writeInbounds(listener.Addr().(*net.TCPAddr).Port)
+	agent.probeClients(context.Background())
+	probe = agent.ClientProbes()["sing-box"]
+	assert.Zero(t, probe.Failures)
+	assert.Equal(t, agent.ClientProbes(), agent.GetStatus()["client_probes"])
+	assert.Equal(t, health.HealthStatusHealthy, check.Check(context.Background()).Status)
+}
@@ -0,0 +1,95 @@
+package agent
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/kpblcaoo/sboxagent/internal/logger"
+)
+
+// maxConfigAudit bounds the number of runtime config changes kept in memory
+const maxConfigAudit = 100
+
+// ConfigAuditEntry records a configuration key changed at runtime. Sensitive
+// values are masked.
+type ConfigAuditEntry struct {
+	Key             string      `json:"key"`
+	Old             interface{} `json:"old"`
+	New             interface{} `json:"new"`
+	Actor           string      `json:"actor,omitempty"`
+	Persisted       bool        `json:"persisted"`
+	RestartRequired bool        `json:"restart_required"`
+	At              time.Time   `json:"at"`
+}
+
+// GetConfigValue returns the running value of a single config key
+func (a *Agent) GetConfigValue(key string) (interface{}, error) {
+	return a.GetConfig().Get(key)
+}
+
+// SetConfigValue validates and applies a new value for key to the running
+// configuration, optionally persisting it to the runtime drop-in. Keys that
+// cannot be applied live take effect after a restart.
+func (a *Agent) SetConfigValue(key string, value interface{}, persist bool, actor string) (*ConfigAuditEntry, error) {
+	a.configMu.Lock()
+	defer a.configMu.Unlock()
+
+	current := a.GetConfig()
+	updated, err := current.With(key, value)
+	if err != nil {
+		return nil, err
+	}
+	if persist {
+		if err := updated.PersistKey(key); err != nil {
+			return nil, fmt.Errorf("failed to persist %s: %w", key, err)
+		}
+	}
+
+	restartRequired := true
+	if key == "agent.log_level" {
+		level, err := logger.ParseLogLevel(updated.Agent.LogLevel)
+		if err != nil {
+			return nil, err
+		}
+		a.logger.SetLevel(level)
+		restartRequired = false
+	}
+
+	oldValue, _ := current.Get(key)
+	newValue, _ := updated.Get(key)
+	entry := &ConfigAuditEntry{
+		Key:             key,
+		Old:             oldValue,
+		New:             newValue,
+		Actor:           actor,
+		Persisted:       persist,
+		RestartRequired: restartRequired,
+		At:              time.Now(),
+	}
+
+	a.mu.Lock()
+	a.config = updated
+	a.configAudit = append(a.configAudit, *entry)
+	if len(a.configAudit) > maxConfigAudit {
+		a.configAudit = a.configAudit[len(a.configAudit)-maxConfigAudit:]
+	}
+	a.mu.Unlock()
+
+	a.logger.Info("Configuration changed", map[string]interface{}{
+		"key":             key,
+		"old":             oldValue,
+		"new":             newValue,
+		"actor":           actor,
+		"persisted":       persist,
+		"restartRequired": restartRequired,
+	})
+	a.publishEvent("CONFIG_CHANGED", entry)
+	return entry, nil
+}
+
+// ConfigAudit returns the runtime config changes, oldest first
+func (a *Agent) ConfigAudit() []ConfigAuditEntry {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	return append([]ConfigAuditEntry(nil), a.configAudit...)
+}
@@ -0,0 +1,124 @@
+package agent
+
+import (
+	"time"
+)
+
+const (
+	// defaultStopTimeout is used when no shutdown stop timeout is configured
+	defaultStopTimeout = 10 * time.Second
+
+	// forceStopGrace is how long a force-stopped service may take to exit
+	// before it is abandoned
+	forceStopGrace = 2 * time.Second
+)
+
+// ServiceStopResult describes how a single service stopped
+type ServiceStopResult struct {
+	Name      string        `json:"name"`
+	Deadline  time.Duration `json:"deadline"`
+	Duration  time.Duration `json:"duration"`
+	TimedOut  bool          `json:"timed_out"`
+	Abandoned bool          `json:"abandoned"`
+}
+
+// ShutdownReport summarizes the last shutdown
+type ShutdownReport struct {
+	StartedAt time.Time           `json:"started_at"`
+	Duration  time.Duration       `json:"duration"`
+	Services  []ServiceStopResult `json:"services"`
+}
+
+// TimedOut returns the names of services that exceeded their deadline
+func (r *ShutdownReport) TimedOut() []string {
+	var names []string
+	for _, service := range r.Services {
+		if service.TimedOut {
+			names = append(names, service.Name)
+		}
+	}
+	return names
+}
+
+// stopStep is a service to stop during shutdown. force is optional and is
+// called when stop exceeds its deadline.
+type stopStep struct {
+	name  string
+	stop  func()
+	force func()
+}
+
+// stopTimeout returns the configured stop deadline for a service
+func (a *Agent) stopTimeout(name string) time.Duration {
+	shutdown := a.GetConfig().Agent.Shutdown
+	if timeout, ok := shutdown.Services[name]; ok && timeout > 0 {
+		return timeout
+	}
+	if shutdown.StopTimeout > 0 {
+		return shutdown.StopTimeout
+	}
+	return defaultStopTimeout
+}
+
+// runStopSteps stops services in order, each bounded by its deadline, and
+// returns a report. A service that exceeds its deadline is force-stopped and
+// abandoned if it still does not exit, so shutdown always completes.
+func (a *Agent) runStopSteps(steps []stopStep) *ShutdownReport {
+	report := &ShutdownReport{StartedAt: time.Now()}
+
+	for _, step := range steps {
+		result := a.runStopStep(step)
+		report.Services = append(report.Services, result)
+	}
+	report.Duration = time.Since(report.StartedAt)
+
+	if timedOut := report.TimedOut(); len(timedOut) > 0 {
+		a.logger.Error("Services exceeded their stop deadline", map[string]interface{}{
+			"services": timedOut,
+			"duration": report.Duration.String(),
+		})
+	}
+
+	return report
+}
+
+// runStopStep stops one service within its deadline
+func (a *Agent) runStopStep(step stopStep) ServiceStopResult {
+	deadline := a.stopTimeout(step.name)
+	result := ServiceStopResult{Name: step.name, Deadline: deadline}
+	start := time.Now()
+
+	done := make(chan struct{})
+	go func() {
+		step.stop()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		result.Duration = time.Since(start)
+		return result
+	case <-time.After(deadline):
+	}
+
+	result.TimedOut = true
+	a.logger.Warn("Service exceeded stop deadline, forcing stop", map[string]interface{}{
+		"service":  step.name,
+		"deadline": deadline.String(),
+	})
+
+	if step.force != nil {
+		step.force()
+	}
+
+	select {
+	case <-done:
+	case <-time.After(forceStopGrace):
+		result.Abandoned = true
+		a.logger.Error("Service did not stop after force stop, abandoning it", map[string]interface{}{
+			"service": step.name,
+		})
+	}
+	result.Duration = time.Since(start)
+	return result
+}
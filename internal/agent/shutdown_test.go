@@ -0,0 +1,66 @@
+package agent
+
+import (
+	"testing"
+	"time"
+
+	"github.com/kpblcaoo/sboxagent/internal/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newShutdownTestAgent(t *testing.T, shutdown config.ShutdownConfig) *Agent {
+	agent, err := New(&config.Config{
+		Agent: config.AgentConfig{
+			Name:     "test-agent",
+			Version:  "1.0.0",
+			LogLevel: "error",
+			Shutdown: shutdown,
+		},
+	})
+	require.NoError(t, err)
+	return agent
+}
+
+func TestAgent_StopTimeout(t *testing.T) {
+	agent := newShutdownTestAgent(t, config.ShutdownConfig{
+		StopTimeout: 3 * time.Second,
+		Services:    map[string]time.Duration{"sboxctl": 7 * time.Second},
+	})
+	assert.Equal(t, 7*time.Second, agent.stopTimeout("sboxctl"))
+	assert.Equal(t, 3*time.Second, agent.stopTimeout("api"))
+
+	agent = newShutdownTestAgent(t, config.ShutdownConfig{})
+	assert.Equal(t, defaultStopTimeout, agent.stopTimeout("api"))
+}
+
+func TestAgent_RunStopSteps(t *testing.T) {
+	agent := newShutdownTestAgent(t, config.ShutdownConfig{StopTimeout: 50 * time.Millisecond})
+
+	release := make(chan struct{})
+	var order []string
+	report := agent.runStopSteps([]stopStep{
+		{name: "fast", stop: func() { order = append(order, "fast") }},
+		{
+			name:  "hung-with-force",
+			stop:  func() { <-release },
+			force: func() { close(release) },
+		},
+		{name: "hung", stop: func() { select {} }},
+		{name: "after", stop: func() { order = append(order, "after") }},
+	})
+
+	// Every service is attempted in order even when earlier ones hang
+	assert.Equal(t, []string{"fast", "after"}, order)
+	require.Len(t, report.Services, 4)
+
+	assert.False(t, report.Services[0].TimedOut)
+
+	assert.True(t, report.Services[1].TimedOut)
+	assert.False(t, report.Services[1].Abandoned)
+
+	assert.True(t, report.Services[2].TimedOut)
+	assert.True(t, report.Services[2].Abandoned)
+
+	assert.Equal(t, []string{"hung-with-force", "hung"}, report.TimedOut())
+}
@@ -0,0 +1,105 @@
+package agent
+
+import (
+	"time"
+
+	"github.com/kpblcaoo/sboxagent/internal/standby"
+)
+
+// newElector creates the standby elector when pairing is enabled
+func (a *Agent) newElector() *standby.Elector {
+	if !a.config.Standby.Enabled {
+		return nil
+	}
+	id := a.config.Standby.NodeID
+	if id == "" {
+		id = a.config.Agent.Name
+	}
+	return standby.NewElector(a.config.Standby, id, a.logger)
+}
+
+// startStandby checks the lease once, starts the apply duties if this agent
+// is active and then follows lease changes in the background
+func (a *Agent) startStandby() error {
+	active, err := a.elector.Check(time.Now())
+	if err != nil {
+		a.logger.Error("Failed to check standby lease", map[string]interface{}{
+			"path":  a.GetConfig().Standby.LeaseFile,
+			"error": err.Error(),
+		})
+	}
+	if active {
+		if err := a.becomeActive("standby lease acquired"); err != nil {
+			return err
+		}
+	} else {
+		a.transition(StateStandby, "peer holds the standby lease")
+	}
+
+	a.wg.Add(1)
+	go func() {
+		defer a.wg.Done()
+		a.elector.Run(a.ctx, a.onRoleChange)
+	}()
+	return nil
+}
+
+// becomeActive starts the services only the active agent runs
+func (a *Agent) becomeActive(reason string) error {
+	a.logger.Info("Agent is active", map[string]interface{}{
+		"node":   a.elector.ID(),
+		"reason": reason,
+	})
+	if err := a.startSboxctlInstances(); err != nil {
+		return err
+	}
+	if a.sboxctlService == nil {
+		return a.transition(StateReady, reason)
+	}
+	a.transition(StateSyncing, reason)
+	return a.sboxctlService.Start(a.ctx)
+}
+
+// onRoleChange starts or stops the apply duties when the lease changes hands
+func (a *Agent) onRoleChange(active bool) {
+	if active {
+		if err := a.becomeActive("standby lease acquired"); err != nil {
+			a.logger.Error("Failed to take over from standby peer", map[string]interface{}{
+				"error": err.Error(),
+			})
+		}
+		return
+	}
+
+	a.logger.Warn("Standby lease lost, becoming passive", map[string]interface{}{
+		"node": a.elector.ID(),
+	})
+	if a.sboxctlService != nil {
+		a.sboxctlService.Stop()
+	}
+	a.stopSboxctlInstances()
+	if err := a.transition(StateStandby, "standby lease lost"); err != nil {
+		a.logger.Debug("Ignoring standby change", map[string]interface{}{
+			"error": err.Error(),
+		})
+	}
+}
+
+// isActive reports whether this agent should perform applies and scheduled
+// work; agents without standby pairing are always active
+func (a *Agent) isActive() bool {
+	return a.elector == nil || a.elector.IsActive()
+}
+
+// standbyStatus describes the agent's standby role for the status command
+func (a *Agent) standbyStatus() map[string]interface{} {
+	status := map[string]interface{}{
+		"node":   a.elector.ID(),
+		"active": a.elector.IsActive(),
+	}
+	if lease := a.elector.Lease(); lease != nil {
+		status["holder"] = lease.Holder
+		status["expiresAt"] = lease.ExpiresAt
+	}
+	return status
+}
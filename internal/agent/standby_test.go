@@ -0,0 +1,59 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/kpblcaoo/sboxagent/internal/config"
+	"github.com/kpblcaoo/sboxagent/internal/standby"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAgent_StandbyTakeover(t *testing.T) {
+	leaseFile := filepath.Join(t.TempDir(), "lease.json")
+	peerLease, err := json.Marshal(standby.Lease{Holder: "gw-a", ExpiresAt: time.Now().Add(time.Hour)})
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(leaseFile, peerLease, 0644))
+
+	agent, err := New(&config.Config{
+		Agent: config.AgentConfig{Name: "gw-b", LogLevel: "error"},
+		Services: config.ServicesConfig{
+			Sboxctl: config.SboxctlConfig{
+				Enabled:  true,
+				Command:  []string{"true"},
+				Interval: time.Minute,
+				Timeout:  time.Second,
+			},
+		},
+		Standby: config.StandbyConfig{
+			Enabled:       true,
+			LeaseFile:     leaseFile,
+			LeaseTTL:      200 * time.Millisecond,
+			RenewInterval: 20 * time.Millisecond,
+		},
+	})
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- agent.Start(ctx) }()
+
+	// The peer holds the lease, so the agent waits without running sboxctl
+	require.Eventually(t, func() bool { return agent.State() == StateStandby }, 2*time.Second, 10*time.Millisecond)
+	assert.Equal(t, false, agent.GetStatus()["standby"].(map[string]interface{})["active"])
+	assert.Equal(t, false, agent.sboxctlService.GetStatus()["running"])
+
+	// The peer goes away and releases its lease
+	require.NoError(t, os.Remove(leaseFile))
+	require.Eventually(t, func() bool { return agent.State() == StateReady }, 2*time.Second, 10*time.Millisecond)
+	assert.Equal(t, true, agent.sboxctlService.GetStatus()["running"])
+
+	cancel()
+	require.NoError(t, <-done)
+	assert.NoFileExists(t, leaseFile)
+}
@@ -0,0 +1,229 @@
+package agent
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/kpblcaoo/sboxagent/internal/config"
+)
+
+// defaultNeeds are the built-in dependencies between startup steps
+var defaultNeeds = map[string][]string{
+	"journal":      {"dispatcher"},
+	"sboxctl":      {"dispatcher"},
+	"clients":      {"network-online", "configs-validated"},
+	"unit-watch":   {"clients"},
+	"probes":       {"clients"},
+	"connectivity": {"clients"},
+	"imports":      {"network-online"},
+}
+
+// networkPollInterval is how often network-online looks for an address
+const networkPollInterval = time.Second
+
+// startStep is a service started by startServices. A nil start marks a
+// disabled step, which counts as started. A gate is a condition later
+// steps wait for: when it fails, the steps needing it are held back
+// instead of failing the start.
+type startStep struct {
+	name  string
+	gate  bool
+	start func() error
+}
+
+// startupOrder sorts the steps so that each follows the steps it needs,
+// keeping the given order where the dependencies allow
+func startupOrder(steps []startStep, extra map[string][]string) ([]startStep, error) {
+	needs := make(map[string][]string, len(steps))
+	known := make(map[string]bool, len(steps))
+	for _, step := range steps {
+		known[step.name] = true
+	}
+	for step, names := range defaultNeeds {
+		for _, name := range names {
+			if known[name] {
+				needs[step] = append(needs[step], name)
+			}
+		}
+	}
+	for step, names := range extra {
+		for _, name := range names {
+			if !known[name] {
+				return nil, fmt.Errorf("startup step %s needs unknown step %q", step, name)
+			}
+			needs[step] = append(needs[step], name)
+		}
+	}
+
+	ordered := make([]startStep, 0, len(steps))
+	done := make(map[string]bool, len(steps))
+	pending := append([]startStep{}, steps...)
+	for len(pending) > 0 {
+		next := -1
+		for i, step := range pending {
+			ready := true
+			for _, name := range needs[step.name] {
+				if !done[name] {
+					ready = false
+					break
+				}
+			}
+			if ready {
+				next = i
+				break
+			}
+		}
+		if next < 0 {
+			names := make([]string, len(pending))
+			for i, step := range pending {
+				names[i] = step.name
+			}
+			return nil, fmt.Errorf("startup dependency cycle among %s", strings.Join(names, ", "))
+		}
+		ordered = append(ordered, pending[next])
+		done[pending[next].name] = true
+		pending = append(pending[:next], pending[next+1:]...)
+	}
+	return ordered, nil
+}
+
+// runStartup starts the steps in dependency order. A failed step fails the
+// start; a failed gate holds back the steps needing it, directly or not,
+// which are returned with the reason.
+func (a *Agent) runStartup(steps []startStep) (map[string]string, error) {
+	extra := a.GetConfig().Services.Startup.Needs
+	ordered, err := startupOrder(steps, extra)
+	if err != nil {
+		return nil, err
+	}
+	needs := make(map[string][]string)
+	for _, source := range []map[string][]string{defaultNeeds, extra} {
+		for step, names := range source {
+			needs[step] = append(needs[step], names...)
+		}
+	}
+
+	blocked := make(map[string]string)
+	for _, step := range ordered {
+		for _, name := range needs[step.name] {
+			if reason, ok := blocked[name]; ok {
+				blocked[step.name] = reason
+				break
+			}
+		}
+		if _, ok := blocked[step.name]; ok || step.start == nil {
+			continue
+		}
+		if err := step.start(); err != nil {
+			if !step.gate {
+				return blocked, err
+			}
+			blocked[step.name] = err.Error()
+		}
+	}
+
+	if len(blocked) > 0 {
+		names := make([]string, 0, len(blocked))
+		for name := range blocked {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		a.logger.Warn("Services held back at startup", map[string]interface{}{
+			"steps":  names,
+			"reason": blocked[names[0]],
+		})
+		a.publishEvent("STARTUP_BLOCKED", map[string]interface{}{
+			"severity": "critical",
+			"steps":    blocked,
+		})
+	}
+	return blocked, nil
+}
+
+// waitNetworkOnline waits up to the startup network timeout for an
+// interface other than loopback to be up with a routable address. When it
+// times out, startup carries on, since clients may bring the network up.
+func (a *Agent) waitNetworkOnline() error {
+	timeout := a.GetConfig().Services.Startup.NetworkTimeout
+	if timeout <= 0 {
+		return nil
+	}
+	ctx, cancel := context.WithTimeout(a.ctx, timeout)
+	defer cancel()
+	ticker := time.NewTicker(networkPollInterval)
+	defer ticker.Stop()
+	for {
+		if networkOnline() {
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			if a.ctx.Err() != nil {
+				return a.ctx.Err()
+			}
+			a.logger.Warn("Network not online, starting anyway", map[string]interface{}{
+				"timeout": timeout.String(),
+			})
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+// networkOnline tells whether an interface other than loopback is up with
+// a global unicast address
+func networkOnline() bool {
+	interfaces, err := net.Interfaces()
+	if err != nil {
+		return false
+	}
+	for _, iface := range interfaces {
+		if iface.Flags&net.FlagUp == 0 || iface.Flags&net.FlagLoopback != 0 {
+			continue
+		}
+		addrs, err := iface.Addrs()
+		if err != nil {
+			continue
+		}
+		for _, addr := range addrs {
+			if ipNet, ok := addr.(*net.IPNet); ok && ipNet.IP.IsGlobalUnicast() {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// validateClientConfigs checks the current config of each enabled client
+// with the client's own checker
+func (a *Agent) validateClientConfigs() error {
+	cfg := a.GetConfig()
+	var errs []error
+	for _, name := range config.ClientNames {
+		if !cfg.Clients.Enabled(name) {
+			continue
+		}
+		path, _ := cfg.Clients.ConfigPath(name)
+		if path == "" {
+			continue
+		}
+		data, err := os.ReadFile(path)
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			errs = append(errs, fmt.Errorf("failed to read %s config: %w", name, err))
+			continue
+		}
+		if err := a.checkClientConfig(a.ctx, name, path, data); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
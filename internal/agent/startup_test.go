@@ -0,0 +1,101 @@
+package agent
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/kpblcaoo/sboxagent/internal/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStartupOrder(t *testing.T) {
+	names := func(steps []startStep) []string {
+		result := make([]string, len(steps))
+		for i, step := range steps {
+			result[i] = step.name
+		}
+		return result
+	}
+	steps := make([]startStep, len(config.StartupSteps))
+	for i, name := range config.StartupSteps {
+		steps[i] = startStep{name: name}
+	}
+
+	// The built-in dependencies keep the default order
+	ordered, err := startupOrder(steps, nil)
+	require.NoError(t, err)
+	assert.Equal(t, config.StartupSteps, names(ordered))
+
+	// Declared dependencies move steps after the ones they need
+	ordered, err = startupOrder(steps, map[string][]string{"api": {"clients"}})
+	require.NoError(t, err)
+	order := names(ordered)
+	assert.Less(t, indexOf(order, "clients"), indexOf(order, "api"))
+	assert.Less(t, indexOf(order, "configs-validated"), indexOf(order, "api"))
+	assert.Less(t, indexOf(order, "dispatcher"), indexOf(order, "sboxctl"))
+
+	_, err = startupOrder(steps, map[string][]string{"network-online": {"probes"}})
+	assert.ErrorContains(t, err, "startup dependency cycle among network-online, clients, unit-watch, probes, connectivity, imports")
+
+	_, err = startupOrder(steps, map[string][]string{"api": {"database"}})
+	assert.EqualError(t, err, `startup step api needs unknown step "database"`)
+}
+
+func indexOf(names []string, name string) int {
+	for i, n := range names {
+		if n == name {
+			return i
+		}
+	}
+	return -1
+}
+
+func TestAgent_StartupGates(t *testing.T) {
+	agent, err := New(&config.Config{
+		Agent: config.AgentConfig{Name: "startup-test", LogLevel: "error"},
+		Services: config.ServicesConfig{
+			Startup: config.StartupConfig{Needs: map[string][]string{"api": {"probes"}}},
+		},
+	})
+	require.NoError(t, err)
+
+	var started []string
+	start := func(name string) func() error {
+		return func() error {
+			started = append(started, name)
+			return nil
+		}
+	}
+	steps := []startStep{
+		{name: "network-online", gate: true, start: start("network-online")},
+		{name: "configs-validated", gate: true, start: func() error {
+			return errors.New("sing-box rejected the config")
+		}},
+		{name: "clients", start: start("clients")},
+		{name: "unit-watch"},
+		{name: "probes", start: start("probes")},
+		{name: "api", start: start("api")},
+		{name: "imports", start: start("imports")},
+	}
+
+	// A failed gate holds back the steps needing it, directly or not
+	blocked, err := agent.runStartup(steps)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"network-online", "imports"}, started)
+	assert.Equal(t, map[string]string{
+		"configs-validated": "sing-box rejected the config",
+		"clients":           "sing-box rejected the config",
+		"unit-watch":        "sing-box rejected the config",
+		"probes":            "sing-box rejected the config",
+		"api":               "sing-box rejected the config",
+	}, blocked)
+
+	// Other failed steps fail the start
+	started = nil
+	steps[1].start = nil
+	steps[2].start = func() error { return errors.New("supervisor failed") }
+	_, err = agent.runStartup(steps)
+	assert.EqualError(t, err, "supervisor failed")
+	assert.Equal(t, []string{"network-online"}, started)
+}
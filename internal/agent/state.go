@@ -0,0 +1,201 @@
+package agent
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/kpblcaoo/sboxagent/internal/sdnotify"
+)
+
+// State is a stage of the agent lifecycle
+type State string
+
+const (
+	StateStopped      State = "stopped"
+	StateInitializing State = "initializing"
+	StateSyncing      State = "syncing"
+	StateReady        State = "ready"
+	StateDegraded     State = "degraded"
+	StateMaintenance  State = "maintenance"
+	StateStopping     State = "stopping"
+	// StateStandby is a passive agent waiting for its peer's lease to lapse
+	StateStandby State = "standby"
+)
+
+// stateTransitions lists the states each state may move to
+var stateTransitions = map[State][]State{
+	StateStopped:      {StateInitializing},
+	StateInitializing: {StateSyncing, StateReady, StateStandby, StateStopping},
+	StateSyncing:      {StateReady, StateDegraded, StateMaintenance, StateStandby, StateStopping},
+	StateReady:        {StateSyncing, StateDegraded, StateMaintenance, StateStandby, StateStopping},
+	StateDegraded:     {StateReady, StateSyncing, StateMaintenance, StateStandby, StateStopping},
+	StateMaintenance:  {StateReady, StateStopping},
+	StateStandby:      {StateSyncing, StateReady, StateStopping},
+	StateStopping:     {StateStopped},
+}
+
+// StateChange describes a state transition
+type StateChange struct {
+	From   State     `json:"from"`
+	To     State     `json:"to"`
+	Reason string    `json:"reason,omitempty"`
+	At     time.Time `json:"at"`
+}
+
+// CanTransition reports whether the lifecycle allows moving from one state
+// to another
+func CanTransition(from, to State) bool {
+	for _, allowed := range stateTransitions[from] {
+		if allowed == to {
+			return true
+		}
+	}
+	return false
+}
+
+// State returns the current lifecycle state
+func (a *Agent) State() State {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	return a.state
+}
+
+// transition moves the agent to a new state and announces the change. It
+// fails if the transition is not allowed; moving to the current state is a
+// no-op.
+func (a *Agent) transition(to State, reason string) error {
+	a.mu.Lock()
+	from := a.state
+	if from == to {
+		a.mu.Unlock()
+		return nil
+	}
+	if !CanTransition(from, to) {
+		a.mu.Unlock()
+		return fmt.Errorf("invalid state transition from %s to %s", from, to)
+	}
+	a.state = to
+	a.mu.Unlock()
+
+	a.announceStateChange(StateChange{From: from, To: to, Reason: reason, At: time.Now()})
+	return nil
+}
+
+// announceStateChange logs a transition, publishes it to socket clients and
+// reports it to systemd
+func (a *Agent) announceStateChange(change StateChange) {
+	a.logger.Info("Agent state changed", map[string]interface{}{
+		"from":   change.From,
+		"to":     change.To,
+		"reason": change.Reason,
+	})
+
+	a.publishEvent("STATE_CHANGED", change)
+
+	if change.To == StateStopping {
+		a.notifyStatus(change.To, sdnotify.Stopping)
+	} else {
+		a.notifyStatus(change.To)
+	}
+}
+
+// notifyStatus sends systemd a STATUS= line for state, shown by systemctl
+// status, along with further messages
+func (a *Agent) notifyStatus(state State, messages ...string) {
+	messages = append([]string{sdnotify.Status(a.statusLine(state))}, messages...)
+	if _, err := sdnotify.Notify(messages...); err != nil {
+		a.logger.Warn("Failed to notify systemd", map[string]interface{}{
+			"error": err.Error(),
+		})
+	}
+}
+
+// maxStatusError bounds the error quoted in a status line
+const maxStatusError = 80
+
+// statusLine summarizes the agent in one line, such as
+// "ready; health healthy; last sync 15:04:05"
+func (a *Agent) statusLine(state State) string {
+	parts := []string{string(state)}
+
+	health := healthSummary(state)
+	// Reports of a stopping agent are stale
+	if a.health != nil && health != HealthStopped {
+		if report := a.health.GetLastReport(); !report.Timestamp.IsZero() {
+			health = string(report.OverallStatus)
+			var problems []string
+			for _, status := range []string{"unhealthy", "degraded"} {
+				if n := report.Summary[status]; n > 0 {
+					problems = append(problems, fmt.Sprintf("%d %s", n, status))
+				}
+			}
+			if len(problems) > 0 {
+				health += " (" + strings.Join(problems, ", ") + ")"
+			}
+		}
+	}
+	parts = append(parts, "health "+health)
+
+	if a.sboxctlService != nil {
+		status := a.sboxctlService.GetStatus()
+		if lastError, ok := status["lastError"].(string); ok {
+			lastError, _, _ = strings.Cut(lastError, "\n")
+			if len(lastError) > maxStatusError {
+				lastError = lastError[:maxStatusError] + "..."
+			}
+			parts = append(parts, "sboxctl failing: "+lastError)
+		} else if lastRun, ok := status["lastRun"].(time.Time); ok && !lastRun.IsZero() {
+			parts = append(parts, "last sync "+lastRun.Format("15:04:05"))
+		}
+	}
+
+	if a.ClientsStopped() != nil {
+		parts = append(parts, "clients stopped")
+	}
+	return strings.Join(parts, "; ")
+}
+
+// SetMaintenance enters or leaves maintenance mode. In maintenance the agent
+// keeps running but service results no longer change its state.
+func (a *Agent) SetMaintenance(enabled bool) error {
+	if enabled {
+		return a.transition(StateMaintenance, "maintenance requested")
+	}
+	if a.State() != StateMaintenance {
+		return nil
+	}
+	return a.transition(StateReady, "maintenance finished")
+}
+
+// onSboxctlRun updates the state after each sboxctl run
+func (a *Agent) onSboxctlRun(err error) {
+	if state := a.State(); state == StateMaintenance || state == StateStandby {
+		return
+	}
+
+	to, reason := StateReady, "sboxctl run succeeded"
+	if err != nil {
+		to, reason = StateDegraded, "sboxctl run failed: "+err.Error()
+	}
+	if err := a.transition(to, reason); err != nil {
+		a.logger.Debug("Ignoring sboxctl result", map[string]interface{}{
+			"error": err.Error(),
+		})
+	}
+}
+
+// onSboxctlCircuit raises a critical alert when repeated sboxctl failures
+// open the circuit, and reports when runs resume
+func (a *Agent) onSboxctlCircuit(open bool, failures int, err error) {
+	if !open {
+		a.publishEvent("SBOXCTL_CIRCUIT_CLOSED", map[string]interface{}{})
+		return
+	}
+	a.publishEvent("SBOXCTL_CIRCUIT_OPENED", map[string]interface{}{
+		"severity": "critical",
+		"failures": failures,
+		"cooldown": a.GetConfig().Services.Sboxctl.CircuitBreaker.Cooldown.String(),
+		"error":    err.Error(),
+	})
+}
@@ -0,0 +1,106 @@
+package agent
+
+import (
+	"context"
+	"errors"
+	"net"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/kpblcaoo/sboxagent/internal/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newStateTestAgent(t *testing.T) *Agent {
+	agent, err := New(&config.Config{
+		Agent: config.AgentConfig{Name: "state-test", LogLevel: "error"},
+	})
+	require.NoError(t, err)
+	return agent
+}
+
+func TestCanTransition(t *testing.T) {
+	assert.True(t, CanTransition(StateStopped, StateInitializing))
+	assert.True(t, CanTransition(StateReady, StateDegraded))
+	assert.True(t, CanTransition(StateStopping, StateStopped))
+	assert.False(t, CanTransition(StateStopped, StateReady))
+	assert.False(t, CanTransition(StateStopping, StateReady))
+	assert.False(t, CanTransition(StateMaintenance, StateDegraded))
+	assert.True(t, CanTransition(StateReady, StateStandby))
+	assert.False(t, CanTransition(StateStandby, StateDegraded))
+}
+
+func TestAgent_Transition(t *testing.T) {
+	agent := newStateTestAgent(t)
+	assert.Equal(t, StateStopped, agent.State())
+	assert.False(t, agent.IsRunning())
+
+	require.NoError(t, agent.transition(StateInitializing, "test"))
+	assert.True(t, agent.IsRunning())
+
+	err := agent.transition(StateDegraded, "test")
+	assert.ErrorContains(t, err, "invalid state transition from initializing to degraded")
+	assert.Equal(t, StateInitializing, agent.State())
+
+	// Moving to the current state is a no-op
+	assert.NoError(t, agent.transition(StateInitializing, "test"))
+}
+
+func TestAgent_MaintenanceAndSboxctlResults(t *testing.T) {
+	agent := newStateTestAgent(t)
+	require.NoError(t, agent.transition(StateInitializing, "test"))
+	require.NoError(t, agent.transition(StateSyncing, "test"))
+
+	agent.onSboxctlRun(errors.New("exit status 1"))
+	assert.Equal(t, StateDegraded, agent.State())
+	agent.onSboxctlRun(nil)
+	assert.Equal(t, StateReady, agent.State())
+
+	// Results are ignored during maintenance
+	require.NoError(t, agent.SetMaintenance(true))
+	agent.onSboxctlRun(errors.New("exit status 1"))
+	assert.Equal(t, StateMaintenance, agent.State())
+
+	require.NoError(t, agent.SetMaintenance(false))
+	assert.Equal(t, StateReady, agent.State())
+	assert.NoError(t, agent.SetMaintenance(false))
+}
+
+func TestAgent_NotifiesSystemd(t *testing.T) {
+	socketPath := filepath.Join(t.TempDir(), "notify.sock")
+	conn, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Name: socketPath, Net: "unixgram"})
+	require.NoError(t, err)
+	defer conn.Close()
+	t.Setenv("NOTIFY_SOCKET", socketPath)
+
+	// receive returns the next notification containing message
+	receive := func(message string) string {
+		require.NoError(t, conn.SetReadDeadline(time.Now().Add(2*time.Second)))
+		buf := make([]byte, 512)
+		for {
+			n, err := conn.Read(buf)
+			require.NoError(t, err, "expected %s", message)
+			if strings.Contains(string(buf[:n]), message) {
+				return string(buf[:n])
+			}
+		}
+	}
+
+	agent := newStateTestAgent(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- agent.Start(ctx) }()
+
+	// READY=1 follows the start of all services; the health depends on the
+	// host once the first round of checks completed
+	ready := receive("READY=1")
+	assert.True(t, strings.HasPrefix(ready, "STATUS=ready; health "), ready)
+	assert.True(t, strings.HasSuffix(ready, "\nREADY=1"), ready)
+
+	cancel()
+	require.NoError(t, <-done)
+	assert.Equal(t, "STATUS=stopping; health stopped\nSTOPPING=1", receive("STOPPING=1"))
+}
@@ -0,0 +1,77 @@
+package agent
+
+import (
+	"github.com/kpblcaoo/sboxagent/internal/config"
+	"github.com/kpblcaoo/sboxagent/internal/initsys"
+	"github.com/kpblcaoo/sboxagent/internal/logger"
+	"github.com/kpblcaoo/sboxagent/internal/supervisor"
+)
+
+// supervised reports whether the agent runs the clients itself: when
+// services.supervisor.mode is on, or auto in a container without a
+// service manager
+func supervised(cfg config.SupervisorConfig) bool {
+	switch cfg.Mode {
+	case config.SupervisorOn:
+		return true
+	case config.SupervisorAuto:
+		return initsys.InContainer() && !initsys.ServiceManagerRunning()
+	default:
+		return false
+	}
+}
+
+// newSupervisor creates the supervisor of the enabled clients, named by
+// clients.<name>.unit
+func newSupervisor(cfg *config.Config, log *logger.Logger) *supervisor.Supervisor {
+	var programs []supervisor.Program
+	for _, name := range config.ClientNames {
+		if !cfg.Clients.Enabled(name) {
+			continue
+		}
+		unit, _ := cfg.Clients.Unit(name)
+		command, _ := cfg.Clients.Command(name)
+		overrides, _ := cfg.Clients.Overrides(name)
+		programs = append(programs, supervisor.Program{
+			Name:        unit,
+			Command:     command,
+			Env:         overrides.Env,
+			Restart:     overrides.RestartPolicy,
+			HealthCheck: overrides.HealthCheck,
+		})
+	}
+	opts := supervisor.Options{
+		RestartDelay:    cfg.Services.Supervisor.RestartDelay,
+		MaxRestartDelay: cfg.Services.Supervisor.MaxRestartDelay,
+		MaxRestarts:     cfg.Services.Supervisor.MaxRestarts,
+		RestartWindow:   cfg.Services.Supervisor.RestartWindow,
+		StopTimeout:     cfg.Services.Supervisor.StopTimeout,
+	}
+	// Health checks gate restarts only with client monitoring enabled
+	if monitoring := cfg.Services.Monitoring; monitoring.Enabled {
+		opts.HealthInterval = monitoring.Interval
+		opts.HealthTimeout = monitoring.Timeout
+		opts.HealthThreshold = monitoring.FailureThreshold
+	}
+	return supervisor.New(programs, opts, log)
+}
+
+// startSupervisor starts the enabled clients and forwards signals to them.
+// Clients failing to start are reported in the client unit states and do
+// not keep the agent from starting.
+func (a *Agent) startSupervisor() {
+	a.logger.Info("Supervising clients", map[string]interface{}{
+		"mode":      a.GetConfig().Services.Supervisor.Mode,
+		"container": initsys.InContainer(),
+	})
+	if err := a.supervisor.StartAll(a.ctx); err != nil {
+		a.logger.Error("Failed to start clients", map[string]interface{}{
+			"error": err.Error(),
+		})
+	}
+	a.wg.Add(1)
+	go func() {
+		defer a.wg.Done()
+		a.supervisor.ForwardSignals(a.ctx)
+	}()
+}
@@ -0,0 +1,58 @@
+package agent
+
+import (
+	"time"
+
+	"github.com/kpblcaoo/sboxagent/internal/config"
+	"github.com/kpblcaoo/sboxagent/internal/dispatcher"
+	"github.com/kpblcaoo/sboxagent/internal/health"
+)
+
+// trendChecks returns the trend checks of the limits configured in
+// health.trends
+func (a *Agent) trendChecks() []health.HealthCheck {
+	cfg := a.GetConfig().Health.Trends
+	var checks []*health.TrendHealthCheck
+	if cfg.MemoryLimitMB > 0 {
+		checks = append(checks, health.NewMemoryTrendCheck(a.logger, uint64(cfg.MemoryLimitMB)<<20))
+	}
+	if cfg.ErrorRatePercent > 0 && a.dispatcher != nil {
+		checks = append(checks, health.NewErrorRateTrendCheck(a.logger, liveDispatcherStats{a.dispatcher}, cfg.ErrorRatePercent))
+	}
+	if cfg.DiskMinFreeMB > 0 {
+		path := cfg.DiskPath
+		if path == "" {
+			path = config.DefaultDataDir
+		}
+		checks = append(checks, health.NewDiskTrendCheck(a.logger, path, uint64(cfg.DiskMinFreeMB)<<20))
+	}
+
+	trends := make([]health.HealthCheck, len(checks))
+	for i, check := range checks {
+		check.SetWindow(cfg.Window)
+		check.Horizon = cfg.Horizon
+		trends[i] = check
+	}
+	return trends
+}
+
+// liveDispatcherStats reads the dispatcher's statistics on every call
+type liveDispatcherStats struct {
+	dispatcher *dispatcher.Dispatcher
+}
+
+func (s liveDispatcherStats) GetEventsProcessed() int64 {
+	return s.dispatcher.GetStats().EventsProcessed
+}
+
+func (s liveDispatcherStats) GetEventsDropped() int64 {
+	return s.dispatcher.GetStats().EventsDropped
+}
+
+func (s liveDispatcherStats) GetErrors() int64 {
+	return s.dispatcher.GetStats().Errors
+}
+
+func (s liveDispatcherStats) GetLastEventTime() time.Time {
+	return s.dispatcher.GetStats().LastEventTime
+}
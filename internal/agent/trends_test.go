@@ -0,0 +1,56 @@
+package agent
+
+import (
+	"context"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/kpblcaoo/sboxagent/internal/config"
+	"github.com/kpblcaoo/sboxagent/internal/health"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAgent_TrendChecks(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("disk usage is not supported")
+	}
+	// A free space limit beyond any disk is crossed from the start
+	agent, err := New(&config.Config{
+		Agent: config.AgentConfig{Name: "trend-test", LogLevel: "error"},
+		Health: config.HealthConfig{Trends: config.TrendsConfig{
+			Enabled: true, Window: 5, Horizon: time.Hour,
+			MemoryLimitMB: 512, DiskPath: t.TempDir(), DiskMinFreeMB: 1 << 40,
+		}},
+	})
+	require.NoError(t, err)
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- agent.Start(ctx) }()
+	defer func() {
+		cancel()
+		<-done
+	}()
+
+	var report health.HealthReport
+	require.Eventually(t, func() bool {
+		agent.mu.RLock()
+		checker := agent.health
+		agent.mu.RUnlock()
+		if checker == nil {
+			return false
+		}
+		report = checker.ForceCheck()
+		return true
+	}, 2*time.Second, 10*time.Millisecond)
+
+	statuses := make(map[string]health.HealthStatus)
+	for _, component := range report.Components {
+		statuses[component.Name] = component.Status
+	}
+	assert.Equal(t, health.HealthStatusUnhealthy, statuses["disk_trend"])
+	assert.Contains(t, statuses, "memory_trend")
+	// The error rate is only watched with the event dispatcher
+	assert.NotContains(t, statuses, "error_rate_trend")
+}
@@ -0,0 +1,226 @@
+package agent
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/kpblcaoo/sboxagent/internal/config"
+	"github.com/kpblcaoo/sboxagent/internal/importer"
+	"github.com/kpblcaoo/sboxagent/internal/notify"
+	"github.com/kpblcaoo/sboxagent/internal/services"
+)
+
+// UninstallOptions select what Uninstall does besides removing the agent
+type UninstallOptions struct {
+	// RestoreBackups puts back the oldest backup of each client config,
+	// the config from before the agent replaced it, and removes the others
+	RestoreBackups bool
+}
+
+// UninstallResult lists what Uninstall changed
+type UninstallResult struct {
+	// Unit is the agent unit that was disabled and removed
+	Unit     string            `json:"unit,omitempty"`
+	Removed  []string          `json:"removed"`
+	Restored map[string]string `json:"restored,omitempty"`
+	Errors   []string          `json:"errors,omitempty"`
+}
+
+// Uninstall disables and removes the agent unit, deletes the socket, the
+// runtime and state directories and the files the agent wrote to the event
+// record and spool directories, and optionally restores the client configs
+// from their backups. It carries on past failures, listing them in
+// the result, and fails if any step did. The agent config is kept.
+func (a *Agent) Uninstall(ctx context.Context, opts UninstallOptions) (*UninstallResult, error) {
+	cfg := a.GetConfig()
+	result := &UninstallResult{Removed: []string{}}
+	var errs []error
+	fail := func(err error) {
+		errs = append(errs, err)
+		result.Errors = append(result.Errors, err.Error())
+	}
+
+	if err := a.uninstallUnit(ctx, result); err != nil {
+		fail(err)
+	}
+	if opts.RestoreBackups {
+		for _, name := range config.ClientNames {
+			path, _ := cfg.Clients.ConfigPath(name)
+			if path == "" {
+				continue
+			}
+			if err := restoreOriginal(name, path, result); err != nil {
+				fail(err)
+			}
+		}
+	}
+
+	var paths []string
+	if a.socketServer != nil && a.socketServer.Network != "tcp" {
+		paths = append(paths, a.socketServer.SocketPath)
+	}
+	if dir := cfg.Agent.Unit.RuntimeDirectory; dir != "" {
+		paths = append(paths, filepath.Join("/run", dir))
+	}
+	paths = append(paths, cfg.Remote.CacheFile)
+	for _, path := range paths {
+		if err := a.removeState(path, result); err != nil {
+			fail(err)
+		}
+	}
+	// Those directories may be shared, so only the agent's files go
+	if err := a.removeOwned(cfg.Services.Sboxctl.Record.Dir, []string{services.RecordPattern}, result); err != nil {
+		fail(err)
+	}
+	if err := a.removeOwned(cfg.Notifications.SpoolDir, notify.SpoolPatterns, result); err != nil {
+		fail(err)
+	}
+	if err := a.removeState(config.DefaultDataDir, result); err != nil {
+		fail(err)
+	}
+
+	a.logger.Info("Agent uninstalled", map[string]interface{}{
+		"unit":    result.Unit,
+		"removed": len(result.Removed),
+		"errors":  len(result.Errors),
+	})
+	return result, errors.Join(errs...)
+}
+
+// uninstallUnit disables, stops and removes the agent's systemd unit
+func (a *Agent) uninstallUnit(ctx context.Context, result *UninstallResult) error {
+	cfg := a.GetConfig().Services.Systemd
+	if cfg.Drift.AgentUnit == "" || cfg.Drift.UnitDir == "" {
+		return nil
+	}
+	path := filepath.Join(cfg.Drift.UnitDir, cfg.Drift.AgentUnit)
+	if _, err := os.Stat(path); os.IsNotExist(err) {
+		return nil
+	}
+	if _, err := exec.LookPath("systemctl"); err != nil {
+		return nil
+	}
+
+	systemctl := func(args ...string) error {
+		command := []string{"systemctl"}
+		if cfg.UserMode {
+			command = append(command, "--user")
+		}
+		runCtx, cancel := context.WithTimeout(ctx, cfg.Timeout)
+		defer cancel()
+		_, err := a.commandOutput(runCtx, append(command, args...))
+		return err
+	}
+	if err := systemctl("disable", "--now", cfg.Drift.AgentUnit); err != nil {
+		return fmt.Errorf("failed to disable %s: %w", cfg.Drift.AgentUnit, err)
+	}
+	result.Unit = cfg.Drift.AgentUnit
+	if err := os.Remove(path); err != nil {
+		return fmt.Errorf("failed to remove unit: %w", err)
+	}
+	result.Removed = append(result.Removed, path)
+	if err := systemctl("daemon-reload"); err != nil {
+		return fmt.Errorf("failed to reload systemd: %w", err)
+	}
+	return nil
+}
+
+// restoreOriginal moves the oldest backup of a client config over it and
+// removes the newer backups
+func restoreOriginal(client, path string, result *UninstallResult) error {
+	backups, err := importer.ListBackups(path)
+	if err != nil || len(backups) == 0 {
+		return err
+	}
+	oldest := backups[len(backups)-1]
+	if err := os.Rename(oldest.Path, path); err != nil {
+		return fmt.Errorf("failed to restore %s config: %w", client, err)
+	}
+	if result.Restored == nil {
+		result.Restored = make(map[string]string)
+	}
+	result.Restored[client] = oldest.Name
+	for _, backup := range backups[:len(backups)-1] {
+		if err := os.Remove(backup.Path); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("failed to remove backup %s: %w", backup.Name, err)
+		}
+		result.Removed = append(result.Removed, backup.Path)
+	}
+	return nil
+}
+
+// removeState removes a state file or directory unless it holds the agent
+// config
+func (a *Agent) removeState(path string, result *UninstallResult) error {
+	if path == "" {
+		return nil
+	}
+	path = filepath.Clean(path)
+	if _, err := os.Lstat(path); os.IsNotExist(err) {
+		return nil
+	}
+	if a.keepsConfig(path) {
+		return nil
+	}
+	if err := os.RemoveAll(path); err != nil {
+		return fmt.Errorf("failed to remove %s: %w", path, err)
+	}
+	result.Removed = append(result.Removed, path)
+	return nil
+}
+
+// removeOwned removes the files matching patterns in dir, and dir too if
+// nothing else is left in it
+func (a *Agent) removeOwned(dir string, patterns []string, result *UninstallResult) error {
+	if dir == "" {
+		return nil
+	}
+	dir = filepath.Clean(dir)
+	if _, err := os.Lstat(dir); os.IsNotExist(err) {
+		return nil
+	}
+	if a.keepsConfig(dir) {
+		return nil
+	}
+	for _, pattern := range patterns {
+		files, err := filepath.Glob(filepath.Join(dir, pattern))
+		if err != nil {
+			return fmt.Errorf("failed to list %s: %w", dir, err)
+		}
+		for _, file := range files {
+			if err := os.Remove(file); err != nil && !os.IsNotExist(err) {
+				return fmt.Errorf("failed to remove %s: %w", file, err)
+			}
+			result.Removed = append(result.Removed, file)
+		}
+	}
+	if entries, err := os.ReadDir(dir); err != nil || len(entries) > 0 {
+		return nil
+	}
+	if err := os.Remove(dir); err != nil {
+		return fmt.Errorf("failed to remove %s: %w", dir, err)
+	}
+	result.Removed = append(result.Removed, dir)
+	return nil
+}
+
+// keepsConfig tells whether path holds the agent config, as the data
+// directory does on macOS and Windows
+func (a *Agent) keepsConfig(path string) bool {
+	for _, kept := range []string{a.GetConfig().Path(), config.DefaultConfigDir} {
+		if kept != "" && within(filepath.Clean(kept), path) {
+			return true
+		}
+	}
+	return false
+}
+
+// within tells whether path is dir or below it
+func within(path, dir string) bool {
+	return path == dir || strings.HasPrefix(path, dir+string(filepath.Separator))
+}
@@ -0,0 +1,117 @@
+package agent
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/kpblcaoo/sboxagent/internal/config"
+	"github.com/kpblcaoo/sboxagent/internal/socket"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAgent_Uninstall(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("requires sh")
+	}
+	dir := t.TempDir()
+	calls := filepath.Join(dir, "calls")
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "systemctl"), []byte("#!/bin/sh\necho \"$@\" >> "+calls+"\n"), 0755))
+	t.Setenv("PATH", dir+string(os.PathListSeparator)+os.Getenv("PATH"))
+
+	unitDir := filepath.Join(dir, "units")
+	require.NoError(t, os.Mkdir(unitDir, 0755))
+	unit := filepath.Join(unitDir, "sboxagent.service")
+	require.NoError(t, os.WriteFile(unit, []byte("[Service]\n"), 0644))
+
+	dataDir := filepath.Join(dir, "data")
+	require.NoError(t, os.MkdirAll(filepath.Join(dataDir, "spool"), 0755))
+	originalDataDir := config.DefaultDataDir
+	config.DefaultDataDir = dataDir
+	defer func() { config.DefaultDataDir = originalDataDir }()
+	socketPath := filepath.Join(dir, "agent.sock")
+	require.NoError(t, os.WriteFile(socketPath, nil, 0600))
+
+	// The original config and two backups of configs the agent replaced
+	clientConfig := filepath.Join(dir, "config.json")
+	require.NoError(t, os.WriteFile(clientConfig, []byte(`{"imported":3}`), 0644))
+	stamp := time.Now().Add(-time.Hour)
+	original := clientConfig + "." + stamp.Format("20060102-150405") + ".bak"
+	newer := clientConfig + "." + stamp.Add(time.Minute).Format("20060102-150405") + ".bak"
+	require.NoError(t, os.WriteFile(original, []byte(`{"original":true}`), 0644))
+	require.NoError(t, os.WriteFile(newer, []byte(`{"imported":2}`), 0644))
+
+	agent, err := New(&config.Config{
+		Agent: config.AgentConfig{Name: "uninstall-test", LogLevel: "error"},
+		Services: config.ServicesConfig{
+			Systemd: config.SystemdConfig{
+				Timeout: 5 * time.Second,
+				Drift:   config.UnitDriftConfig{UnitDir: unitDir, AgentUnit: "sboxagent.service"},
+			},
+		},
+		Notifications: config.NotificationsConfig{SpoolDir: filepath.Join(dataDir, "spool")},
+		Clients: config.ClientsConfig{
+			SingBox: config.SingBoxConfig{Enabled: true, ConfigPath: clientConfig},
+		},
+	})
+	require.NoError(t, err)
+	agent.AttachSocket(socket.NewServer(socketPath, nil))
+
+	result, err := agent.Uninstall(context.Background(), UninstallOptions{RestoreBackups: true})
+	require.NoError(t, err)
+	assert.Equal(t, "sboxagent.service", result.Unit)
+	assert.Equal(t, []string{unit, newer, socketPath, filepath.Join(dataDir, "spool"), dataDir}, result.Removed)
+	assert.Equal(t, map[string]string{"sing-box": filepath.Base(original)}, result.Restored)
+	assert.Empty(t, result.Errors)
+
+	data, err := os.ReadFile(calls)
+	require.NoError(t, err)
+	assert.Equal(t, "disable --now sboxagent.service\ndaemon-reload\n", string(data))
+	data, err = os.ReadFile(clientConfig)
+	require.NoError(t, err)
+	assert.Equal(t, `{"original":true}`, string(data))
+	for _, path := range result.Removed {
+		assert.NoFileExists(t, path)
+		assert.NoDirExists(t, path)
+	}
+}
+
+func TestAgent_UninstallSharedDirectories(t *testing.T) {
+	dir := t.TempDir()
+	originalDataDir := config.DefaultDataDir
+	config.DefaultDataDir = filepath.Join(dir, "data")
+	defer func() { config.DefaultDataDir = originalDataDir }()
+
+	// Record and spool directories pointed at directories holding other files
+	recordDir := filepath.Join(dir, "log")
+	spoolDir := filepath.Join(dir, "spool")
+	require.NoError(t, os.Mkdir(recordDir, 0755))
+	require.NoError(t, os.Mkdir(spoolDir, 0755))
+	record := filepath.Join(recordDir, "sboxctl-20250101-120000.000000.ndjson")
+	spooled := filepath.Join(spoolDir, "abc.json")
+	interrupted := filepath.Join(spoolDir, "def.json.tmp")
+	foreign := filepath.Join(recordDir, "syslog")
+	for _, path := range []string{record, spooled, interrupted, foreign} {
+		require.NoError(t, os.WriteFile(path, nil, 0644))
+	}
+
+	agent, err := New(&config.Config{
+		Agent: config.AgentConfig{Name: "uninstall-test", LogLevel: "error"},
+		Services: config.ServicesConfig{
+			Sboxctl: config.SboxctlConfig{Record: config.EventRecordConfig{Dir: recordDir}},
+		},
+		Notifications: config.NotificationsConfig{SpoolDir: spoolDir},
+	})
+	require.NoError(t, err)
+
+	result, err := agent.Uninstall(context.Background(), UninstallOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, []string{record, spooled, interrupted, spoolDir}, result.Removed)
+	assert.FileExists(t, foreign)
+	assert.NoFileExists(t, record)
+	assert.NoDirExists(t, spoolDir)
+}
@@ -0,0 +1,273 @@
+package agent
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/kpblcaoo/sboxagent/internal/config"
+	"github.com/kpblcaoo/sboxagent/internal/health"
+	"github.com/kpblcaoo/sboxagent/internal/lsm"
+	"github.com/kpblcaoo/sboxagent/internal/systemd"
+)
+
+// UnitDrift is an installed unit file that differs from the unit the agent
+// generates for it, or is missing
+type UnitDrift struct {
+	Unit    string               `json:"unit"`
+	Client  string               `json:"client,omitempty"`
+	Path    string               `json:"path"`
+	Missing bool                 `json:"missing,omitempty"`
+	Changes []systemd.UnitChange `json:"changes,omitempty"`
+}
+
+// expectedUnit is a unit file the agent generates
+type expectedUnit struct {
+	unit   string
+	client string
+	path   string
+	data   []byte
+}
+
+// expectedUnits generates the agent unit and the units of the enabled
+// clients whose binary is installed
+func (a *Agent) expectedUnits() ([]expectedUnit, error) {
+	cfg := a.GetConfig()
+	drift := cfg.Services.Systemd.Drift
+	var units []expectedUnit
+	if drift.AgentUnit != "" {
+		vars, err := config.NewUnitVars(cfg, a.commandVars().SocketPath)
+		if err != nil {
+			return nil, err
+		}
+		data, err := systemd.RenderUnit(cfg.Agent.Unit, vars)
+		if err != nil {
+			return nil, err
+		}
+		units = append(units, expectedUnit{
+			unit: drift.AgentUnit,
+			path: filepath.Join(drift.UnitDir, drift.AgentUnit),
+			data: data,
+		})
+	}
+	if !drift.Clients {
+		return units, nil
+	}
+	for _, name := range config.ClientNames {
+		if !cfg.Clients.Enabled(name) {
+			continue
+		}
+		binary, _ := cfg.Clients.BinaryPath(name)
+		if binary == "" {
+			binary = name
+		}
+		path, err := exec.LookPath(binary)
+		if err != nil {
+			continue
+		}
+		if path, err = filepath.Abs(path); err != nil {
+			return nil, err
+		}
+		data, err := systemd.RenderClientUnit(cfg.Clients, name, path)
+		if err != nil {
+			return nil, err
+		}
+		unit, _ := cfg.Clients.Unit(name)
+		if !strings.Contains(unit, ".") {
+			unit += ".service"
+		}
+		units = append(units, expectedUnit{
+			unit:   unit,
+			client: name,
+			path:   filepath.Join(drift.UnitDir, unit),
+			data:   data,
+		})
+	}
+	return units, nil
+}
+
+// CheckUnitDrift compares the installed units with the generated ones and
+// returns those that drifted. Units newly drifted are logged and published
+// as UNIT_DRIFT_DETECTED.
+func (a *Agent) CheckUnitDrift() ([]UnitDrift, error) {
+	expected, err := a.expectedUnits()
+	if err != nil {
+		return nil, err
+	}
+	drifts := []UnitDrift{}
+	for _, unit := range expected {
+		drift, err := compareUnit(unit)
+		if err != nil {
+			return nil, err
+		}
+		if drift != nil {
+			drifts = append(drifts, *drift)
+		}
+	}
+
+	a.mu.Lock()
+	previous := make(map[string]bool, len(a.unitDrift))
+	for _, drift := range a.unitDrift {
+		previous[drift.Unit] = true
+	}
+	a.unitDrift = drifts
+	a.mu.Unlock()
+
+	var detected []UnitDrift
+	for _, drift := range drifts {
+		if previous[drift.Unit] {
+			continue
+		}
+		detected = append(detected, drift)
+		a.logger.Warn("Unit file drifted", map[string]interface{}{
+			"unit":    drift.Unit,
+			"path":    drift.Path,
+			"missing": drift.Missing,
+			"changes": len(drift.Changes),
+		})
+	}
+	if len(detected) > 0 {
+		a.publishEvent("UNIT_DRIFT_DETECTED", map[string]interface{}{
+			"units": detected,
+		})
+	}
+	return drifts, nil
+}
+
+// compareUnit returns how an installed unit differs from the expected one,
+// or nil if it does not
+func compareUnit(unit expectedUnit) (*UnitDrift, error) {
+	drift := &UnitDrift{Unit: unit.unit, Client: unit.client, Path: unit.path}
+	installed, err := os.ReadFile(unit.path)
+	if os.IsNotExist(err) {
+		drift.Missing = true
+		return drift, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read unit %s: %w", unit.path, err)
+	}
+	drift.Changes = systemd.DiffUnit(installed, unit.data)
+	if len(drift.Changes) == 0 {
+		return nil, nil
+	}
+	return drift, nil
+}
+
+// RepairUnits rewrites the drifted units with the generated ones and
+// reloads the systemd configuration. It returns the repaired units.
+func (a *Agent) RepairUnits(ctx context.Context) ([]UnitDrift, error) {
+	expected, err := a.expectedUnits()
+	if err != nil {
+		return nil, err
+	}
+	repaired := []UnitDrift{}
+	for _, unit := range expected {
+		drift, err := compareUnit(unit)
+		if err != nil {
+			return nil, err
+		}
+		if drift == nil {
+			continue
+		}
+		if err := os.WriteFile(unit.path, unit.data, 0644); err != nil {
+			return nil, fmt.Errorf("failed to write unit %s: %w", unit.path, lsm.Explain(err))
+		}
+		repaired = append(repaired, *drift)
+	}
+	if len(repaired) == 0 {
+		return repaired, nil
+	}
+
+	cfg := a.GetConfig().Services.Systemd
+	command := []string{"systemctl", "daemon-reload"}
+	if cfg.UserMode {
+		command = []string{"systemctl", "--user", "daemon-reload"}
+	}
+	reloadCtx, cancel := context.WithTimeout(ctx, cfg.Timeout)
+	defer cancel()
+	if _, err := a.commandOutput(reloadCtx, command); err != nil {
+		return repaired, fmt.Errorf("units rewritten, but daemon-reload failed: %w", err)
+	}
+
+	a.mu.Lock()
+	a.unitDrift = []UnitDrift{}
+	a.mu.Unlock()
+	a.logger.Info("Units repaired", map[string]interface{}{
+		"units": len(repaired),
+	})
+	a.publishEvent("UNITS_REPAIRED", map[string]interface{}{
+		"units": repaired,
+	})
+	return repaired, nil
+}
+
+// watchUnitDrift checks the units on start and then on the drift interval
+func (a *Agent) watchUnitDrift() {
+	defer a.wg.Done()
+
+	check := func() {
+		if _, err := a.CheckUnitDrift(); err != nil {
+			a.logger.Warn("Failed to check unit drift", map[string]interface{}{
+				"error": err.Error(),
+			})
+		}
+	}
+	check()
+	interval := a.GetConfig().Services.Systemd.Drift.Interval
+	if interval <= 0 {
+		return
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-a.ctx.Done():
+			return
+		case <-ticker.C:
+			check()
+		}
+	}
+}
+
+// UnitDrift returns the units that drifted at the last check, or nil if
+// they were not checked yet
+func (a *Agent) UnitDrift() []UnitDrift {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	if a.unitDrift == nil {
+		return nil
+	}
+	return append([]UnitDrift{}, a.unitDrift...)
+}
+
+// unitDriftCheck reports drifted units as a degraded health component
+type unitDriftCheck struct {
+	agent *Agent
+}
+
+func (c unitDriftCheck) Name() string {
+	return "unit_drift"
+}
+
+func (c unitDriftCheck) Check(ctx context.Context) health.ComponentHealth {
+	result := health.ComponentHealth{
+		Name:      c.Name(),
+		Status:    health.HealthStatusHealthy,
+		Message:   "Unit files match the generated units",
+		Timestamp: time.Now(),
+	}
+	drifts := c.agent.UnitDrift()
+	if len(drifts) > 0 {
+		units := make([]string, len(drifts))
+		for i, drift := range drifts {
+			units[i] = drift.Unit
+		}
+		result.Status = health.HealthStatusDegraded
+		result.Message = "Drifted units: " + strings.Join(units, ", ") + "; run repair_units"
+	}
+	return result
+}
@@ -0,0 +1,98 @@
+package agent
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/kpblcaoo/sboxagent/internal/config"
+	"github.com/kpblcaoo/sboxagent/internal/health"
+	"github.com/kpblcaoo/sboxagent/internal/socket"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAgent_UnitDrift(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("requires sh")
+	}
+	dir := t.TempDir()
+	unitDir := filepath.Join(dir, "units")
+	require.NoError(t, os.Mkdir(unitDir, 0755))
+	binary := filepath.Join(dir, "sing-box")
+	require.NoError(t, os.WriteFile(binary, []byte("#!/bin/sh\n"), 0755))
+	reloads := filepath.Join(dir, "reloads")
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "systemctl"), []byte("#!/bin/sh\necho \"$@\" >> "+reloads+"\n"), 0755))
+	t.Setenv("PATH", dir+string(os.PathListSeparator)+os.Getenv("PATH"))
+
+	agent, err := New(&config.Config{
+		Agent: config.AgentConfig{
+			Name:     "drift-test",
+			LogLevel: "error",
+			Unit: config.UnitConfig{
+				Description: "SboxAgent",
+				ExecStart:   []string{"{{.Binary}}", "-socket", "{{.SocketPath}}"},
+			},
+		},
+		Services: config.ServicesConfig{
+			Systemd: config.SystemdConfig{
+				Timeout: 5 * time.Second,
+				Drift: config.UnitDriftConfig{
+					Enabled:   true,
+					UnitDir:   unitDir,
+					AgentUnit: "sboxagent.service",
+					Clients:   true,
+				},
+			},
+		},
+		Clients: config.ClientsConfig{
+			SingBox: config.SingBoxConfig{Enabled: true, BinaryPath: binary, ConfigPath: "/etc/sing-box/config.json"},
+		},
+	})
+	require.NoError(t, err)
+	agent.AttachSocket(socket.NewServer(filepath.Join(dir, "agent.sock"), nil))
+	check := unitDriftCheck{agent: agent}
+	assert.Nil(t, agent.UnitDrift())
+
+	// Nothing installed yet
+	drifts, err := agent.CheckUnitDrift()
+	require.NoError(t, err)
+	require.Len(t, drifts, 2)
+	assert.Equal(t, "sboxagent.service", drifts[0].Unit)
+	assert.True(t, drifts[0].Missing)
+	assert.Equal(t, "sing-box.service", drifts[1].Unit)
+	assert.Equal(t, "sing-box", drifts[1].Client)
+	assert.Equal(t, health.HealthStatusDegraded, check.Check(context.Background()).Status)
+
+	repaired, err := agent.RepairUnits(context.Background())
+	require.NoError(t, err)
+	assert.Len(t, repaired, 2)
+	data, err := os.ReadFile(reloads)
+	require.NoError(t, err)
+	assert.Equal(t, "daemon-reload\n", string(data))
+	data, err = os.ReadFile(filepath.Join(unitDir, "sing-box.service"))
+	require.NoError(t, err)
+	assert.Contains(t, string(data), "ExecStart="+binary+" run -c /etc/sing-box/config.json\n")
+
+	drifts, err = agent.CheckUnitDrift()
+	require.NoError(t, err)
+	assert.Empty(t, drifts)
+	assert.Equal(t, health.HealthStatusHealthy, check.Check(context.Background()).Status)
+
+	// A local edit is reported as changed settings
+	edited := strings.Replace(string(data), "Restart=on-failure", "Restart=always", 1)
+	require.NoError(t, os.WriteFile(filepath.Join(unitDir, "sing-box.service"), []byte(edited), 0644))
+	drifts, err = agent.CheckUnitDrift()
+	require.NoError(t, err)
+	require.Len(t, drifts, 1)
+	assert.False(t, drifts[0].Missing)
+	require.Len(t, drifts[0].Changes, 1)
+	assert.Equal(t, "Service.Restart", drifts[0].Changes[0].Key)
+	assert.Equal(t, "always", drifts[0].Changes[0].Old)
+	assert.Equal(t, "on-failure", drifts[0].Changes[0].New)
+	assert.Contains(t, agent.GetStatus(), "unit_drift")
+}
@@ -0,0 +1,176 @@
+package agent
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os/exec"
+	"strings"
+
+	"github.com/kpblcaoo/sboxagent/internal/initsys"
+	"github.com/kpblcaoo/sboxagent/internal/process"
+)
+
+// initSystem returns the manager of the init system running the clients,
+// connecting on first use, or the agent's supervisor when it runs them
+func (a *Agent) initSystem() (initsys.Manager, error) {
+	if a.supervisor != nil {
+		return a.supervisor, nil
+	}
+	a.unitsMu.Lock()
+	defer a.unitsMu.Unlock()
+	if a.units != nil {
+		return a.units, nil
+	}
+
+	cfg := a.GetConfig().Services.Systemd
+	ctx, cancel := context.WithTimeout(a.runContext(), cfg.Timeout)
+	defer cancel()
+	units, err := initsys.Open(ctx, initsys.Options{
+		System:   cfg.InitSystem,
+		Backend:  cfg.Backend,
+		UserMode: cfg.UserMode,
+		Run:      a.commandOutput,
+	})
+	if err != nil {
+		return nil, err
+	}
+	a.logger.Info("Managing client units", map[string]interface{}{
+		"initSystem": units.System(),
+		"backend":    units.Backend(),
+		"userMode":   cfg.UserMode,
+	})
+	a.units = units
+	return units, nil
+}
+
+// controlUnit starts or stops the client unit
+func (a *Agent) controlUnit(ctx context.Context, action string) error {
+	units, err := a.initSystem()
+	if err != nil {
+		return err
+	}
+	cfg := a.GetConfig().Services
+	ctx, cancel := context.WithTimeout(ctx, cfg.CLI.ActionTimeout("systemctl", cfg.Systemd.Timeout))
+	defer cancel()
+
+	switch action {
+	case "start":
+		return units.Start(ctx, cfg.Systemd.ServiceName)
+	case "stop":
+		return units.Stop(ctx, cfg.Systemd.ServiceName)
+	default:
+		return fmt.Errorf("unknown unit action %q", action)
+	}
+}
+
+// checkUnitActive fails unless the client unit is active
+func (a *Agent) checkUnitActive(ctx context.Context) error {
+	units, err := a.initSystem()
+	if err != nil {
+		return err
+	}
+	cfg := a.GetConfig().Services
+	ctx, cancel := context.WithTimeout(ctx, cfg.CLI.ActionTimeout("systemctl", cfg.Systemd.Timeout))
+	defer cancel()
+
+	state, err := units.State(ctx, cfg.Systemd.ServiceName)
+	if err != nil {
+		return err
+	}
+	if state.ActiveState != "active" {
+		return fmt.Errorf("unit is %s", state.ActiveState)
+	}
+	return nil
+}
+
+// watchUnit publishes the state changes of the client unit and tracks those
+// of the enabled clients' units while the agent runs. Backends without
+// change notifications are not watched.
+func (a *Agent) watchUnit() {
+	defer a.wg.Done()
+
+	units, err := a.initSystem()
+	if err != nil {
+		a.logger.Warn("Failed to connect to the init system", map[string]interface{}{
+			"error": err.Error(),
+		})
+		return
+	}
+	a.clientUnits.Refresh(a.ctx)
+
+	unit := units.Name(a.GetConfig().Services.Systemd.ServiceName)
+	watched := []string{unit}
+	for _, clientUnit := range a.clientUnits.Units() {
+		if clientUnit != unit {
+			watched = append(watched, clientUnit)
+		}
+	}
+	err = units.Watch(a.ctx, watched, func(state initsys.UnitState) {
+		a.clientUnits.update(state)
+		a.escalateClientFailure(state)
+		if state.Unit != unit {
+			return
+		}
+
+		a.mu.Lock()
+		a.unitState = &state
+		a.mu.Unlock()
+
+		fields := map[string]interface{}{
+			"unit":        state.Unit,
+			"activeState": state.ActiveState,
+			"subState":    state.SubState,
+		}
+		if state.ActiveState == "failed" {
+			a.logger.Warn("Client unit failed", fields)
+		} else {
+			a.logger.Info("Client unit state changed", fields)
+		}
+		a.publishEvent("UNIT_STATE_CHANGED", state)
+	})
+	if err != nil && !errors.Is(err, initsys.ErrWatchUnsupported) {
+		a.logger.Warn("Stopped watching client unit", map[string]interface{}{
+			"unit":  unit,
+			"error": err.Error(),
+		})
+	}
+}
+
+// closeUnits closes the connection to the init system
+func (a *Agent) closeUnits() {
+	a.unitsMu.Lock()
+	defer a.unitsMu.Unlock()
+	if a.units != nil {
+		a.units.Close()
+		a.units = nil
+	}
+}
+
+// commandOutput runs a helper command like runCommand, returning its
+// stdout. Errors carry the command's stderr.
+func (a *Agent) commandOutput(ctx context.Context, command []string) ([]byte, error) {
+	release, err := a.commands.Acquire(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+
+	var stdout, stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, command[0], command[1:]...)
+	cmd.Env = a.subprocessEnv()
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	process.Prepare(cmd)
+	if err := process.Start(cmd); err != nil {
+		return nil, err
+	}
+	if err := process.Wait(cmd); err != nil {
+		if message := strings.TrimSpace(stderr.String()); message != "" {
+			return nil, fmt.Errorf("%w: %s", err, message)
+		}
+		return nil, err
+	}
+	return stdout.Bytes(), nil
+}
@@ -0,0 +1,171 @@
+package agent
+
+import (
+	"context"
+	"fmt"
+	"os/exec"
+	"time"
+
+	"github.com/kpblcaoo/sboxagent/internal/clientversion"
+	"github.com/kpblcaoo/sboxagent/internal/upgrade"
+)
+
+// ClientUpgrade is the result of upgrading a client binary
+type ClientUpgrade struct {
+	Client   string `json:"client"`
+	Binary   string `json:"binary"`
+	Previous string `json:"previous,omitempty"`
+	Version  string `json:"version"`
+	Asset    string `json:"asset,omitempty"`
+	// Installed is false when the binary already had the release's version
+	Installed bool `json:"installed"`
+	Restarted bool `json:"restarted,omitempty"`
+	// RestartError is set when the new binary is installed but the
+	// client failed to restart on it
+	RestartError string    `json:"restartError,omitempty"`
+	UpgradedAt   time.Time `json:"upgradedAt"`
+}
+
+// newUpgrader creates the client upgrader from clients.upgrade
+func (a *Agent) newUpgrader() (*upgrade.Upgrader, error) {
+	cfg := a.GetConfig().Clients.Upgrade
+	key, err := cfg.Key()
+	if err != nil {
+		return nil, err
+	}
+	return upgrade.New(upgrade.Options{
+		APIURL:          cfg.APIURL,
+		PublicKey:       key,
+		RequireChecksum: cfg.RequireChecksum,
+	}), nil
+}
+
+// UpgradeClient installs a release of a client to its binary_path. An empty
+// version selects the version pinned in clients.upgrade.versions, or the
+// latest release. The binary is left alone when it already has the
+// release's version unless force is set. A running client is restarted on
+// the new binary when clients.upgrade.restart is set.
+func (a *Agent) UpgradeClient(ctx context.Context, client, version string, force bool) (*ClientUpgrade, error) {
+	if a.upgrader == nil {
+		return nil, fmt.Errorf("client upgrades require clients.upgrade to be enabled")
+	}
+	a.upgradeMu.Lock()
+	defer a.upgradeMu.Unlock()
+
+	clients := a.GetConfig().Clients
+	if !clients.Enabled(client) {
+		return nil, fmt.Errorf("client %q is not enabled", client)
+	}
+	binary, _ := clients.BinaryPath(client)
+	if binary == "" {
+		return nil, fmt.Errorf("clients.%s.binary_path is required to upgrade %s", client, client)
+	}
+	if version == "" {
+		version = clients.Upgrade.Versions[client]
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, clients.Upgrade.Timeout)
+	defer cancel()
+	release, err := a.upgrader.Resolve(ctx, client, version)
+	if err != nil {
+		return nil, a.upgradeFailed(client, version, err)
+	}
+
+	result := &ClientUpgrade{
+		Client:     client,
+		Binary:     binary,
+		Previous:   a.ClientVersions()[client].Version,
+		Version:    release.Version,
+		Asset:      release.Asset,
+		UpgradedAt: time.Now(),
+	}
+	if result.Previous == release.Version && !force {
+		return result, nil
+	}
+
+	if err := a.upgrader.Install(ctx, release, binary); err != nil {
+		return nil, a.upgradeFailed(client, release.Version, err)
+	}
+	result.Installed = true
+	installed, err := clientversion.Probe(ctx, a.commandOutput, client, binary)
+	a.recordClientVersion(client, binary, installed, err)
+
+	if clients.Upgrade.Restart && a.clientUnits != nil {
+		a.clientUnits.Refresh(ctx)
+		if a.clientUnits.state(client).ActiveState == "active" {
+			if _, err := a.clientUnits.Control(ctx, client, UnitRestart); err != nil {
+				result.RestartError = err.Error()
+			} else {
+				result.Restarted = true
+			}
+		}
+	}
+
+	a.logger.Info("Upgraded client", map[string]interface{}{
+		"client":    client,
+		"binary":    binary,
+		"previous":  result.Previous,
+		"version":   result.Version,
+		"restarted": result.Restarted,
+	})
+	if result.RestartError != "" {
+		a.logger.Warn("Failed to restart upgraded client", map[string]interface{}{
+			"client": client,
+			"error":  result.RestartError,
+		})
+	}
+	a.publishEvent("CLIENT_UPGRADED", result)
+	return result, nil
+}
+
+// upgradeFailed logs and publishes a failed upgrade and returns its error
+func (a *Agent) upgradeFailed(client, version string, err error) error {
+	a.logger.Error("Failed to upgrade client", map[string]interface{}{
+		"client":  client,
+		"version": version,
+		"error":   err.Error(),
+	})
+	a.publishEvent("CLIENT_UPGRADE_FAILED", map[string]interface{}{
+		"client":   client,
+		"version":  version,
+		"error":    err.Error(),
+		"severity": "error",
+	})
+	return err
+}
+
+// pollUpgrades upgrades the installed clients, and those with a pinned
+// version, on the clients.upgrade schedule
+func (a *Agent) pollUpgrades() {
+	defer a.wg.Done()
+
+	ticker := time.NewTicker(a.GetConfig().Clients.Upgrade.Schedule)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-a.ctx.Done():
+			return
+		case <-ticker.C:
+			a.upgradeClients(a.ctx)
+		}
+	}
+}
+
+// upgradeClients runs one scheduled upgrade of every enabled client the
+// upgrader supports
+func (a *Agent) upgradeClients(ctx context.Context) {
+	clients := a.GetConfig().Clients
+	for _, client := range upgrade.Clients() {
+		if !clients.Enabled(client) {
+			continue
+		}
+		binary, _ := clients.BinaryPath(client)
+		if _, pinned := clients.Upgrade.Versions[client]; !pinned {
+			if _, err := exec.LookPath(binary); err != nil {
+				continue
+			}
+		}
+		// Failures are logged and published by UpgradeClient
+		a.UpgradeClient(ctx, client, "", false)
+	}
+}
@@ -0,0 +1,94 @@
+package agent
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/kpblcaoo/sboxagent/internal/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// releaseArchive is a sing-box release archive with a fake binary
+// reporting version
+func releaseArchive(t *testing.T, version string) (string, []byte) {
+	name := fmt.Sprintf("sing-box-%s-%s-%s.tar.gz", version, runtime.GOOS, runtime.GOARCH)
+	binary := []byte("#!/bin/sh\necho 'sing-box version " + version + "'\n")
+	var b bytes.Buffer
+	gz := gzip.NewWriter(&b)
+	tw := tar.NewWriter(gz)
+	require.NoError(t, tw.WriteHeader(&tar.Header{Name: "sing-box", Mode: 0755, Size: int64(len(binary)), Typeflag: tar.TypeReg}))
+	_, err := tw.Write(binary)
+	require.NoError(t, err)
+	require.NoError(t, tw.Close())
+	require.NoError(t, gz.Close())
+	return name, b.Bytes()
+}
+
+func TestAgent_UpgradeClient(t *testing.T) {
+	asset, archive := releaseArchive(t, "1.12.0")
+	sum := sha256.Sum256(archive)
+	var server *httptest.Server
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/repos/SagerNet/sing-box/releases/latest":
+			fmt.Fprintf(w, `{"tag_name":"v1.12.0","assets":[{"name":%q,"browser_download_url":%q,"digest":"sha256:%s"}]}`,
+				asset, server.URL+"/download/"+asset, hex.EncodeToString(sum[:]))
+		case "/download/" + asset:
+			w.Write(archive)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	binary := filepath.Join(t.TempDir(), "sing-box")
+	require.NoError(t, os.WriteFile(binary, []byte("#!/bin/sh\necho 'sing-box version 1.11.4'\n"), 0755))
+	agent, err := New(&config.Config{
+		Agent: config.AgentConfig{Name: "upgrade-test", LogLevel: "error"},
+		Clients: config.ClientsConfig{
+			SingBox:      config.SingBoxConfig{Enabled: true, BinaryPath: binary},
+			VersionCheck: config.VersionCheckConfig{Enabled: true, Timeout: 5 * time.Second},
+			Upgrade: config.UpgradeConfig{
+				Enabled:         true,
+				APIURL:          server.URL,
+				Timeout:         10 * time.Second,
+				RequireChecksum: true,
+			},
+		},
+	})
+	require.NoError(t, err)
+	agent.probeClientVersions(context.Background())
+
+	result, err := agent.UpgradeClient(context.Background(), "sing-box", "", false)
+	require.NoError(t, err)
+	assert.True(t, result.Installed)
+	assert.Equal(t, "1.11.4", result.Previous)
+	assert.Equal(t, "1.12.0", result.Version)
+	assert.Equal(t, "1.12.0", agent.ClientVersions()["sing-box"].Version)
+
+	// The installed version is left alone unless forced
+	result, err = agent.UpgradeClient(context.Background(), "sing-box", "", false)
+	require.NoError(t, err)
+	assert.False(t, result.Installed)
+	result, err = agent.UpgradeClient(context.Background(), "sing-box", "", true)
+	require.NoError(t, err)
+	assert.True(t, result.Installed)
+
+	_, err = agent.UpgradeClient(context.Background(), "sing-box", "1.13.0", false)
+	assert.ErrorContains(t, err, "failed to look up sing-box release")
+	_, err = agent.UpgradeClient(context.Background(), "xray", "", false)
+	assert.EqualError(t, err, `client "xray" is not enabled`)
+}
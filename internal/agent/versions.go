@@ -0,0 +1,155 @@
+package agent
+
+import (
+	"context"
+	"fmt"
+	"os/exec"
+	"time"
+
+	"github.com/kpblcaoo/sboxagent/internal/clientversion"
+	"github.com/kpblcaoo/sboxagent/internal/config"
+)
+
+// ClientVersion is the version of an installed client binary
+type ClientVersion struct {
+	Client    string    `json:"client"`
+	Binary    string    `json:"binary"`
+	Version   string    `json:"version,omitempty"`
+	Error     string    `json:"error,omitempty"`
+	CheckedAt time.Time `json:"checkedAt"`
+
+	version clientversion.Version
+}
+
+// watchClientVersions probes the client binaries at startup and on the
+// version check interval
+func (a *Agent) watchClientVersions() {
+	defer a.wg.Done()
+
+	a.probeClientVersions(a.ctx)
+	interval := a.GetConfig().Clients.VersionCheck.Interval
+	if interval <= 0 {
+		return
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-a.ctx.Done():
+			return
+		case <-ticker.C:
+			a.probeClientVersions(a.ctx)
+		}
+	}
+}
+
+// probeClientVersions records the versions of the enabled clients' binaries.
+// Clients whose binary is not installed are skipped.
+func (a *Agent) probeClientVersions(ctx context.Context) {
+	clients := a.GetConfig().Clients
+	for _, name := range config.ClientNames {
+		if !clients.Enabled(name) {
+			continue
+		}
+		binary, _ := clients.BinaryPath(name)
+		if binary == "" {
+			binary = name
+		}
+		if _, err := exec.LookPath(binary); err != nil {
+			a.logger.Debug("Client binary not installed", map[string]interface{}{
+				"client": name,
+				"binary": binary,
+			})
+			continue
+		}
+
+		probeCtx, cancel := context.WithTimeout(ctx, clients.VersionCheck.Timeout)
+		version, err := clientversion.Probe(probeCtx, a.commandOutput, name, binary)
+		cancel()
+		a.recordClientVersion(name, binary, version, err)
+	}
+}
+
+// recordClientVersion stores a probe result, logging new versions and
+// failed probes
+func (a *Agent) recordClientVersion(client, binary string, version clientversion.Version, err error) {
+	current := ClientVersion{Client: client, Binary: binary, CheckedAt: time.Now()}
+	if err != nil {
+		current.Error = err.Error()
+	} else {
+		current.Version = version.String()
+		current.version = version
+	}
+
+	a.mu.Lock()
+	previous, known := a.clientVersions[client]
+	if err != nil && known && previous.Version != "" {
+		// Keep the last detected version when a probe fails
+		current.Version = previous.Version
+		current.version = previous.version
+	}
+	if a.clientVersions == nil {
+		a.clientVersions = make(map[string]ClientVersion)
+	}
+	a.clientVersions[client] = current
+	a.mu.Unlock()
+
+	switch {
+	case err != nil:
+		a.logger.Warn("Failed to detect client version", map[string]interface{}{
+			"client": client,
+			"binary": binary,
+			"error":  err.Error(),
+		})
+	case !known || previous.Version != current.Version:
+		a.logger.Info("Detected client version", map[string]interface{}{
+			"client":  client,
+			"binary":  binary,
+			"version": current.Version,
+		})
+	}
+}
+
+// ClientVersions returns the detected client versions by client name
+func (a *Agent) ClientVersions() map[string]ClientVersion {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	versions := make(map[string]ClientVersion, len(a.clientVersions))
+	for client, version := range a.clientVersions {
+		versions[client] = version
+	}
+	return versions
+}
+
+// checkConfigVersion returns warnings for the features of a client config
+// that the installed client binary is too old for, publishing them as a
+// CLIENT_VERSION_INCOMPATIBLE event. Configs of clients with an unknown
+// version are not checked.
+func (a *Agent) checkConfigVersion(client string, data []byte) []string {
+	a.mu.RLock()
+	installed, ok := a.clientVersions[client]
+	a.mu.RUnlock()
+	if !ok || installed.Version == "" {
+		return nil
+	}
+
+	unsupported, err := clientversion.Unsupported(client, installed.version, data)
+	if err != nil || len(unsupported) == 0 {
+		return nil
+	}
+	warnings := make([]string, 0, len(unsupported))
+	for _, req := range unsupported {
+		warnings = append(warnings, fmt.Sprintf("%s, %s %s is installed", req, client, installed.Version))
+	}
+	a.logger.Warn("Client config needs a newer client", map[string]interface{}{
+		"client":    client,
+		"installed": installed.Version,
+		"features":  warnings,
+	})
+	a.publishEvent("CLIENT_VERSION_INCOMPATIBLE", map[string]interface{}{
+		"client":       client,
+		"installed":    installed.Version,
+		"requirements": unsupported,
+	})
+	return warnings
+}
@@ -0,0 +1,46 @@
+package agent
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAgent_ClientVersions(t *testing.T) {
+	payload := `{"outbounds":[{"type":"anytls"},{"type":"direct"}]}`
+	agent, _ := pipelineAgent(t, payload, `{"outbounds":[]}`, []string{"true"})
+
+	// A fake sing-box reports an older release than the config needs
+	binary := filepath.Join(t.TempDir(), "sing-box")
+	require.NoError(t, os.WriteFile(binary, []byte("#!/bin/sh\necho 'sing-box version 1.11.4'\n"), 0755))
+	agent.config.Clients.SingBox.Enabled = true
+	agent.config.Clients.SingBox.BinaryPath = binary
+	agent.config.Clients.Xray.Enabled = true
+	agent.config.Clients.Xray.BinaryPath = filepath.Join(t.TempDir(), "xray")
+	agent.config.Clients.VersionCheck.Timeout = 5 * time.Second
+
+	agent.probeClientVersions(context.Background())
+	versions := agent.ClientVersions()
+	require.Len(t, versions, 1, "clients that are not installed are skipped")
+	assert.Equal(t, "1.11.4", versions["sing-box"].Version)
+	assert.Equal(t, binary, versions["sing-box"].Binary)
+	assert.Equal(t, versions, agent.GetStatus()["client_versions"])
+
+	pipeline, err := agent.NewUpdatePipeline("sing-box")
+	require.NoError(t, err)
+	result, err := pipeline.Run(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, []string{"anytls outbound requires 1.12.0, sing-box 1.11.4 is installed"}, result.Warnings)
+
+	// A failed probe keeps the last detected version
+	require.NoError(t, os.WriteFile(binary, []byte("#!/bin/sh\nexit 1\n"), 0755))
+	agent.probeClientVersions(context.Background())
+	version := agent.ClientVersions()["sing-box"]
+	assert.Equal(t, "1.11.4", version.Version)
+	assert.Contains(t, version.Error, "failed to query sing-box version")
+}
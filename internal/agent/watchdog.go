@@ -0,0 +1,101 @@
+package agent
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/kpblcaoo/sboxagent/internal/health"
+	"github.com/kpblcaoo/sboxagent/internal/lsm"
+	"github.com/kpblcaoo/sboxagent/internal/sdnotify"
+)
+
+// defaultHealthInterval is the health check interval of configs without one
+const defaultHealthInterval = 30 * time.Second
+
+// startHealth runs the health checker every health.interval. Its reports
+// back the API's /readyz, the status line and the checks' alerts. When the
+// unit sets WatchdogSec=, systemd is pinged after each completed round: a
+// deadlocked agent or health check stops the pings, and systemd restarts
+// the agent.
+func (a *Agent) startHealth() error {
+	cfg := a.GetConfig()
+	checkInterval := cfg.Health.Interval
+	if checkInterval == 0 {
+		checkInterval = defaultHealthInterval
+	}
+	interval, watchdog := sdnotify.WatchdogInterval()
+	watchdog = watchdog && cfg.Agent.Watchdog
+	// Ping twice per interval, as systemd recommends
+	if watchdog && interval/2 < checkInterval {
+		checkInterval = interval / 2
+	}
+
+	checker := health.NewHealthChecker(a.logger, checkInterval, checkInterval/2)
+	checker.RegisterCheck(health.NewSystemHealthCheck(a.logger))
+	checker.RegisterCheck(health.NewProcessHealthCheck(a.logger, a.startTime))
+	if a.sboxctlService != nil {
+		checker.RegisterCheck(health.NewSboxctlHealthCheck(a.logger, a.sboxctlService))
+	}
+	if cfg.Logging.Journal.Enabled {
+		checker.RegisterCheck(clientLogCheck{logs: &a.clientLogs})
+	}
+	if cfg.Services.Monitoring.Enabled {
+		checker.RegisterCheck(clientProbeCheck{agent: a})
+	}
+	if a.connectivity != nil {
+		checker.RegisterCheck(connectivityCheck{agent: a})
+	}
+	if cfg.Services.Systemd.Drift.Enabled {
+		checker.RegisterCheck(unitDriftCheck{agent: a})
+	}
+	if lsm.Detect().Active() {
+		checker.RegisterCheck(securityModuleCheck{agent: a})
+	}
+	if disk := cfg.Health.Disk; disk.Enabled {
+		checker.RegisterCheck(health.NewDiskCheck("disk", a.diskPaths(), disk.WarningPercent, disk.CriticalPercent))
+	}
+	if cfg.Health.Trends.Enabled {
+		for _, check := range a.trendChecks() {
+			checker.RegisterCheck(check)
+		}
+	}
+	if cfg.Health.Certificates.Enabled {
+		checker.RegisterCheck(newCertificateCheck(a))
+	}
+	for _, check := range cfg.Health.Exec {
+		checker.RegisterCheck(execCheck{agent: a, config: check})
+	}
+	for _, check := range cfg.Health.Endpoints {
+		checker.RegisterCheck(health.NewEndpointCheck(check.Name, check.Kind, check.Address, check.URL, check.Timeout))
+	}
+	for _, check := range cfg.Health.DNS {
+		dnsCheck, err := health.NewDNSCheck(check.Name, check.Domain, check.Server, check.Proxy, check.Expect, check.Timeout)
+		if err != nil {
+			return fmt.Errorf("dns health check %s: %w", check.Name, err)
+		}
+		checker.RegisterCheck(dnsCheck)
+	}
+	if watchdog {
+		checker.SetReportHook(func(report health.HealthReport) {
+			// The agent's lock must be free for the agent to count as alive;
+			// the status line is refreshed with the new health summary
+			a.notifyStatus(a.State(), sdnotify.Watchdog)
+		})
+	}
+	a.mu.Lock()
+	a.health = checker
+	a.mu.Unlock()
+	if err := checker.Start(a.ctx); err != nil {
+		return err
+	}
+	if a.apiServer != nil {
+		a.apiServer.SetHealthChecker(checker)
+	}
+
+	if watchdog {
+		a.logger.Info("Systemd watchdog enabled", map[string]interface{}{
+			"interval": interval.String(),
+		})
+	}
+	return nil
+}
@@ -0,0 +1,51 @@
+package agent
+
+import (
+	"context"
+	"net"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/kpblcaoo/sboxagent/internal/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAgent_Watchdog(t *testing.T) {
+	socketPath := filepath.Join(t.TempDir(), "notify.sock")
+	conn, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Name: socketPath, Net: "unixgram"})
+	require.NoError(t, err)
+	defer conn.Close()
+	t.Setenv("NOTIFY_SOCKET", socketPath)
+	t.Setenv("WATCHDOG_USEC", "200000")
+	t.Setenv("WATCHDOG_PID", "")
+
+	agent, err := New(&config.Config{
+		Agent: config.AgentConfig{Name: "watchdog-test", LogLevel: "error", Watchdog: true},
+	})
+	require.NoError(t, err)
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- agent.Start(ctx) }()
+	defer func() {
+		cancel()
+		<-done
+	}()
+
+	// Pings arrive alongside the state notifications
+	require.NoError(t, conn.SetReadDeadline(time.Now().Add(2*time.Second)))
+	buf := make([]byte, 256)
+	for {
+		n, err := conn.Read(buf)
+		require.NoError(t, err, "expected a watchdog ping")
+		if strings.Contains(string(buf[:n]), "WATCHDOG=1") {
+			break
+		}
+	}
+	assert.Eventually(t, func() bool {
+		_, ok := agent.GetStatus()["health"]
+		return ok
+	}, time.Second, 10*time.Millisecond)
+}
@@ -118,6 +118,26 @@ func (a *MemoryAggregator) Add(entry LogEntry) {
 	}
 }
 
+// LoggerHook returns a logger hook that records emitted messages with the
+// given source, so the agent's own activity appears alongside captured output
+func (a *MemoryAggregator) LoggerHook(source string) logger.Hook {
+	return func(level logger.LogLevel, message string, fields map[string]interface{}) {
+		var metadata map[string]interface{}
+		if len(fields) > 0 {
+			metadata = make(map[string]interface{}, len(fields))
+			for key, value := range fields {
+				metadata[key] = value
+			}
+		}
+		a.Add(LogEntry{
+			Level:    LogLevel(level.String()),
+			Message:  message,
+			Source:   source,
+			Metadata: metadata,
+		})
+	}
+}
+
 // GetEntries returns log entries with optional filtering
 func (a *MemoryAggregator) GetEntries(limit int, level LogLevel, since time.Time) []LogEntry {
 	a.mu.RLock()
@@ -131,10 +151,7 @@ func (a *MemoryAggregator) GetEntries(limit int, level LogLevel, since time.Time
 	count := 0
 
 	// Determine how many entries to check
-	entriesToCheck := a.count
-	if entriesToCheck > a.maxEntries {
-		entriesToCheck = a.maxEntries
-	}
+	entriesToCheck := a.filled()
 
 	// Start from the most recent entry
 	startIndex := (a.index - 1 + a.maxEntries) % a.maxEntries
@@ -209,7 +226,6 @@ func (a *AggregatorStats) GetNewestEntry() time.Time {
 // Clear clears all entries
 func (a *MemoryAggregator) Clear() {
 	a.mu.Lock()
-	defer a.mu.Unlock()
 
 	// Reset entries
 	for i := range a.entries {
@@ -225,10 +241,21 @@ func (a *MemoryAggregator) Clear() {
 	a.stats.OldestEntry = time.Time{}
 	a.stats.NewestEntry = time.Time{}
 	a.statsMu.Unlock()
+	a.mu.Unlock()
 
+	// Logged without holding the lock, as the logger may feed this aggregator
 	a.logger.Info("Memory aggregator cleared", map[string]interface{}{})
 }
 
+// filled returns how many slots of the circular buffer hold entries added
+// since the last clear; a.mu must be held
+func (a *MemoryAggregator) filled() int {
+	if a.count > a.maxEntries {
+		return a.maxEntries
+	}
+	return a.count
+}
+
 // cleanupOldEntries removes entries older than maxAge
 func (a *MemoryAggregator) cleanupOldEntries() {
 	if a.maxAge <= 0 {
@@ -241,9 +268,11 @@ func (a *MemoryAggregator) cleanupOldEntries() {
 	defer a.mu.Unlock()
 
 	dropped := 0
-	for i := 0; i < a.count; i++ {
-		idx := (a.index - a.count + i + a.maxEntries) % a.maxEntries
-		if a.entries[idx].Timestamp.Before(cutoff) {
+	filled := a.filled()
+	for i := 0; i < filled; i++ {
+		idx := (a.index - filled + i + a.maxEntries) % a.maxEntries
+		// Cleared entries have no timestamp and were counted already
+		if timestamp := a.entries[idx].Timestamp; !timestamp.IsZero() && timestamp.Before(cutoff) {
 			a.entries[idx] = LogEntry{}
 			dropped++
 		}
@@ -269,8 +298,9 @@ func (a *MemoryAggregator) GetLevelCounts() map[LogLevel]int {
 
 	counts := make(map[LogLevel]int)
 
-	for i := 0; i < a.count; i++ {
-		idx := (a.index - a.count + i + a.maxEntries) % a.maxEntries
+	filled := a.filled()
+	for i := 0; i < filled; i++ {
+		idx := (a.index - filled + i + a.maxEntries) % a.maxEntries
 		entry := a.entries[idx]
 
 		if !entry.Timestamp.IsZero() {
@@ -296,7 +326,7 @@ func (a *MemoryAggregator) Search(query string, limit int) []LogEntry {
 	// Start from the most recent entry
 	startIndex := (a.index - 1 + a.maxEntries) % a.maxEntries
 
-	for i := 0; i < a.count && count < limit; i++ {
+	for i := 0; i < a.filled() && count < limit; i++ {
 		idx := (startIndex - i + a.maxEntries) % a.maxEntries
 		entry := a.entries[idx]
 
@@ -0,0 +1,52 @@
+package aggregator
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/kpblcaoo/sboxagent/internal/logger"
+)
+
+// benchmarkAggregator returns an aggregator filled with entries of mixed levels
+func benchmarkAggregator(b *testing.B, entries int) *MemoryAggregator {
+	log, _ := logger.New("error")
+	aggregator := NewMemoryAggregator(log, entries, time.Hour)
+	levels := []LogLevel{LogLevelDebug, LogLevelInfo, LogLevelWarn, LogLevelError}
+	for i := 0; i < entries; i++ {
+		aggregator.Add(LogEntry{
+			Level:   levels[i%len(levels)],
+			Message: fmt.Sprintf("entry %d", i),
+			Source:  "bench",
+		})
+	}
+	return aggregator
+}
+
+func BenchmarkMemoryAggregator_Add(b *testing.B) {
+	aggregator := benchmarkAggregator(b, 1000)
+	entry := LogEntry{Level: LogLevelInfo, Message: "entry", Source: "bench"}
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		aggregator.Add(entry)
+	}
+}
+
+func BenchmarkMemoryAggregator_GetEntries(b *testing.B) {
+	aggregator := benchmarkAggregator(b, 1000)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		aggregator.GetEntries(100, LogLevelWarn, time.Time{})
+	}
+}
+
+func BenchmarkMemoryAggregator_Search(b *testing.B) {
+	aggregator := benchmarkAggregator(b, 1000)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		aggregator.Search("entry 99", 10)
+	}
+}
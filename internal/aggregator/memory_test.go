@@ -99,6 +99,31 @@ func TestMemoryAggregator_CircularBuffer(t *testing.T) {
 	}
 }
 
+func TestMemoryAggregator_WrappedTwice(t *testing.T) {
+	log, _ := logger.New("error")
+	aggregator := NewMemoryAggregator(log, 3, time.Hour)
+
+	// Filling the buffer more than twice over must not index outside it
+	for i := 0; i < 10; i++ {
+		aggregator.Add(LogEntry{
+			Level:   LogLevelInfo,
+			Message: fmt.Sprintf("test message %d", i),
+			Source:  "test",
+		})
+	}
+	aggregator.cleanupOldEntries()
+
+	if counts := aggregator.GetLevelCounts(); counts[LogLevelInfo] != 3 {
+		t.Errorf("Expected 3 info entries, got %d", counts[LogLevelInfo])
+	}
+	if results := aggregator.Search("test message", 10); len(results) != 3 {
+		t.Errorf("Expected 3 search results, got %d", len(results))
+	}
+	if stats := aggregator.GetStats(); stats.DroppedEntries != 0 {
+		t.Errorf("Expected no dropped entries, got %d", stats.DroppedEntries)
+	}
+}
+
 func TestMemoryAggregator_GetEntriesByLevel(t *testing.T) {
 	log, _ := logger.New("debug")
 	aggregator := NewMemoryAggregator(log, 10, 0)
@@ -273,3 +298,29 @@ func TestMemoryAggregator_MaxAge(t *testing.T) {
 		t.Errorf("Expected 'recent entry', got %s", entries[0].Message)
 	}
 }
+
+func TestMemoryAggregator_LoggerHook(t *testing.T) {
+	log, _ := logger.New("info")
+	aggregator := NewMemoryAggregator(log, 10, 0)
+	log.AddHook(aggregator.LoggerHook("agent"))
+
+	log.Debug("filtered by level", nil)
+	log.Warn("disk almost full", map[string]interface{}{"free": "5%"})
+
+	entries := aggregator.GetRecentEntries(10)
+	if len(entries) != 1 {
+		t.Fatalf("Expected 1 entry, got %d", len(entries))
+	}
+	if entries[0].Source != "agent" || entries[0].Level != LogLevelWarn {
+		t.Errorf("Expected warn entry from agent, got %s entry from %s", entries[0].Level, entries[0].Source)
+	}
+	if entries[0].Metadata["free"] != "5%" {
+		t.Errorf("Expected fields in metadata, got %v", entries[0].Metadata)
+	}
+
+	// Clear logs through the hooked logger and must not deadlock
+	aggregator.Clear()
+	if entries := aggregator.GetRecentEntries(10); len(entries) != 1 || entries[0].Message != "Memory aggregator cleared" {
+		t.Errorf("Expected only the clear message, got %v", entries)
+	}
+}
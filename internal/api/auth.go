@@ -0,0 +1,311 @@
+package api
+
+import (
+	"bufio"
+	"context"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/kpblcaoo/sboxagent/internal/config"
+	"github.com/kpblcaoo/sboxagent/internal/logger"
+)
+
+// ErrInvalidCredentials is returned by providers that do not accept a token
+var ErrInvalidCredentials = errors.New("invalid credentials")
+
+// Identity describes an authenticated API caller
+type Identity struct {
+	Name     string `json:"name"`
+	Provider string `json:"provider"`
+}
+
+// AuthProvider authenticates bearer tokens
+type AuthProvider interface {
+	Name() string
+	Authenticate(ctx context.Context, token string) (*Identity, error)
+}
+
+type identityKey struct{}
+
+// IdentityFromContext returns the identity of the authenticated caller, if any
+func IdentityFromContext(ctx context.Context) (*Identity, bool) {
+	identity, ok := ctx.Value(identityKey{}).(*Identity)
+	return identity, ok
+}
+
+// Authenticator tries a chain of providers in order
+type Authenticator struct {
+	logger    *logger.Logger
+	providers []AuthProvider
+}
+
+// NewAuthenticator creates an authenticator from the given providers
+func NewAuthenticator(log *logger.Logger, providers ...AuthProvider) *Authenticator {
+	return &Authenticator{
+		logger:    log,
+		providers: providers,
+	}
+}
+
+// NewAuthenticatorFromConfig builds the provider chain from security configuration.
+// The legacy api_token is registered as a static token named "default".
+func NewAuthenticatorFromConfig(cfg config.SecurityConfig, log *logger.Logger) (*Authenticator, error) {
+	var providers []AuthProvider
+
+	tokens := make(map[string]string)
+	if cfg.APIToken != "" {
+		tokens["default"] = cfg.APIToken
+	}
+	for _, token := range cfg.Auth.Tokens {
+		if token.Name == "" || token.Token == "" {
+			return nil, fmt.Errorf("static tokens require both name and token")
+		}
+		if _, ok := tokens[token.Name]; ok {
+			return nil, fmt.Errorf("duplicate static token name %q", token.Name)
+		}
+		tokens[token.Name] = token.Token
+	}
+	if len(tokens) > 0 {
+		providers = append(providers, NewStaticTokenProvider(tokens))
+	}
+
+	if cfg.Auth.TokenFile != "" {
+		provider, err := NewTokenFileProvider(cfg.Auth.TokenFile)
+		if err != nil {
+			return nil, err
+		}
+		providers = append(providers, provider)
+	}
+
+	if cfg.Auth.OIDC.Enabled {
+		provider, err := NewOIDCProvider(cfg.Auth.OIDC)
+		if err != nil {
+			return nil, err
+		}
+		providers = append(providers, provider)
+	}
+
+	return NewAuthenticator(log, providers...), nil
+}
+
+// Enabled reports whether any provider is configured
+func (a *Authenticator) Enabled() bool {
+	return a != nil && len(a.providers) > 0
+}
+
+// Authenticate checks a bearer token against all providers
+func (a *Authenticator) Authenticate(ctx context.Context, token string) (*Identity, error) {
+	if token == "" {
+		return nil, ErrInvalidCredentials
+	}
+
+	for _, provider := range a.providers {
+		identity, err := provider.Authenticate(ctx, token)
+		if err == nil {
+			return identity, nil
+		}
+		if !errors.Is(err, ErrInvalidCredentials) {
+			a.logger.Warn("Auth provider failed", map[string]interface{}{
+				"provider": provider.Name(),
+				"error":    err.Error(),
+			})
+		}
+	}
+
+	return nil, ErrInvalidCredentials
+}
+
+// Middleware rejects requests without valid credentials
+func (a *Authenticator) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !a.Enabled() {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		identity, err := a.Authenticate(r.Context(), bearerToken(r))
+		if err != nil {
+			a.logger.Warn("API request rejected", map[string]interface{}{
+				"path":   r.URL.Path,
+				"remote": r.RemoteAddr,
+			})
+			w.Header().Set("WWW-Authenticate", `Bearer realm="sboxagent"`)
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), identityKey{}, identity)))
+	})
+}
+
+// bearerToken extracts the token from the Authorization or X-API-Token header
+func bearerToken(r *http.Request) string {
+	if header := r.Header.Get("Authorization"); header != "" {
+		if len(header) > 7 && strings.EqualFold(header[:7], "Bearer ") {
+			return strings.TrimSpace(header[7:])
+		}
+		return ""
+	}
+	return r.Header.Get("X-API-Token")
+}
+
+// StaticTokenProvider authenticates against a fixed set of named tokens
+type StaticTokenProvider struct {
+	tokens map[string]string // name -> token
+}
+
+// NewStaticTokenProvider creates a provider from a name to token map
+func NewStaticTokenProvider(tokens map[string]string) *StaticTokenProvider {
+	copied := make(map[string]string, len(tokens))
+	for name, token := range tokens {
+		copied[name] = token
+	}
+	return &StaticTokenProvider{tokens: copied}
+}
+
+// Name returns the provider name
+func (p *StaticTokenProvider) Name() string {
+	return "static"
+}
+
+// Authenticate checks the token against the configured tokens
+func (p *StaticTokenProvider) Authenticate(ctx context.Context, token string) (*Identity, error) {
+	if name, ok := matchToken(p.tokens, token); ok {
+		return &Identity{Name: name, Provider: p.Name()}, nil
+	}
+	return nil, ErrInvalidCredentials
+}
+
+// TokenFileProvider authenticates against tokens stored in a file. The file
+// is reloaded whenever its modification time or size changes. Each line is
+// either "name: token" or a bare token; blank lines and # comments are ignored.
+// A name is made of letters, digits, '_', '.' and '-' and is separated from
+// the token by a colon and whitespace, so a bare token may contain colons.
+type TokenFileProvider struct {
+	path string
+
+	mu      sync.Mutex
+	modTime time.Time
+	size    int64
+	tokens  map[string]string
+}
+
+// NewTokenFileProvider creates a provider and performs the initial load
+func NewTokenFileProvider(path string) (*TokenFileProvider, error) {
+	p := &TokenFileProvider{path: path}
+	if err := p.reloadIfChanged(); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// Name returns the provider name
+func (p *TokenFileProvider) Name() string {
+	return "token_file"
+}
+
+// Authenticate checks the token against the current file contents
+func (p *TokenFileProvider) Authenticate(ctx context.Context, token string) (*Identity, error) {
+	if err := p.reloadIfChanged(); err != nil {
+		// Keep serving the last good token set
+		p.mu.Lock()
+		loaded := p.tokens != nil
+		p.mu.Unlock()
+		if !loaded {
+			return nil, err
+		}
+	}
+
+	p.mu.Lock()
+	name, ok := matchToken(p.tokens, token)
+	p.mu.Unlock()
+
+	if ok {
+		return &Identity{Name: name, Provider: p.Name()}, nil
+	}
+	return nil, ErrInvalidCredentials
+}
+
+// reloadIfChanged re-reads the token file if it changed on disk
+func (p *TokenFileProvider) reloadIfChanged() error {
+	info, err := os.Stat(p.path)
+	if err != nil {
+		return fmt.Errorf("failed to stat token file: %w", err)
+	}
+
+	p.mu.Lock()
+	unchanged := p.tokens != nil && info.ModTime().Equal(p.modTime) && info.Size() == p.size
+	p.mu.Unlock()
+	if unchanged {
+		return nil
+	}
+
+	tokens, err := readTokenFile(p.path)
+	if err != nil {
+		return err
+	}
+
+	p.mu.Lock()
+	p.tokens = tokens
+	p.modTime = info.ModTime()
+	p.size = info.Size()
+	p.mu.Unlock()
+
+	return nil
+}
+
+// tokenNamePattern matches the "name:" prefix of a named token line
+var tokenNamePattern = regexp.MustCompile(`^[A-Za-z0-9_.-]+:$`)
+
+// readTokenFile parses a token file
+func readTokenFile(path string) (map[string]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open token file: %w", err)
+	}
+	defer f.Close()
+
+	tokens := make(map[string]string)
+	scanner := bufio.NewScanner(f)
+	lineNum := 0
+	for scanner.Scan() {
+		lineNum++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		fields := strings.Fields(line)
+		switch {
+		case len(fields) == 1:
+			tokens[fmt.Sprintf("line-%d", lineNum)] = fields[0]
+		case len(fields) == 2 && tokenNamePattern.MatchString(fields[0]):
+			tokens[strings.TrimSuffix(fields[0], ":")] = fields[1]
+		default:
+			return nil, fmt.Errorf("invalid token file line %d: expected \"name: token\" or a bare token", lineNum)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read token file: %w", err)
+	}
+
+	return tokens, nil
+}
+
+// matchToken finds the name of a token using constant-time comparison
+func matchToken(tokens map[string]string, token string) (string, bool) {
+	matched := ""
+	for name, candidate := range tokens {
+		if subtle.ConstantTimeCompare([]byte(candidate), []byte(token)) == 1 {
+			matched = name
+		}
+	}
+	return matched, matched != ""
+}
@@ -0,0 +1,155 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/kpblcaoo/sboxagent/internal/config"
+	"github.com/kpblcaoo/sboxagent/internal/logger"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStaticTokenProvider(t *testing.T) {
+	provider := NewStaticTokenProvider(map[string]string{
+		"sboxmgr": "token-a",
+		"ui":      "token-b",
+	})
+
+	identity, err := provider.Authenticate(context.Background(), "token-b")
+	require.NoError(t, err)
+	assert.Equal(t, "ui", identity.Name)
+	assert.Equal(t, "static", identity.Provider)
+
+	_, err = provider.Authenticate(context.Background(), "token-c")
+	assert.ErrorIs(t, err, ErrInvalidCredentials)
+}
+
+func TestTokenFileProvider_ReloadsOnChange(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "tokens")
+	require.NoError(t, os.WriteFile(path, []byte("# operators\nalice: first\n\nbare-token\n"), 0600))
+
+	provider, err := NewTokenFileProvider(path)
+	require.NoError(t, err)
+
+	identity, err := provider.Authenticate(context.Background(), "first")
+	require.NoError(t, err)
+	assert.Equal(t, "alice", identity.Name)
+
+	identity, err = provider.Authenticate(context.Background(), "bare-token")
+	require.NoError(t, err)
+	assert.Equal(t, "line-4", identity.Name)
+
+	// Rewrite the file with a different mtime
+	require.NoError(t, os.WriteFile(path, []byte("bob:\tsecond\n"), 0600))
+	future := time.Now().Add(time.Minute)
+	require.NoError(t, os.Chtimes(path, future, future))
+
+	_, err = provider.Authenticate(context.Background(), "first")
+	assert.ErrorIs(t, err, ErrInvalidCredentials)
+
+	identity, err = provider.Authenticate(context.Background(), "second")
+	require.NoError(t, err)
+	assert.Equal(t, "bob", identity.Name)
+}
+
+func TestTokenFileProvider_TokenWithColon(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "tokens")
+	require.NoError(t, os.WriteFile(path, []byte("alice: abc:def\nuser:secret\n"), 0600))
+
+	provider, err := NewTokenFileProvider(path)
+	require.NoError(t, err)
+
+	identity, err := provider.Authenticate(context.Background(), "abc:def")
+	require.NoError(t, err)
+	assert.Equal(t, "alice", identity.Name)
+
+	// Without whitespace after the colon the whole line is the token
+	identity, err = provider.Authenticate(context.Background(), "user:secret")
+	require.NoError(t, err)
+	assert.Equal(t, "line-2", identity.Name)
+	_, err = provider.Authenticate(context.Background(), "secret")
+	assert.ErrorIs(t, err, ErrInvalidCredentials)
+}
+
+func TestTokenFileProvider_InvalidLine(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "tokens")
+	require.NoError(t, os.WriteFile(path, []byte("alice bob: token\n"), 0600))
+
+	_, err := NewTokenFileProvider(path)
+	assert.ErrorContains(t, err, "line 1")
+}
+
+func TestTokenFileProvider_MissingFile(t *testing.T) {
+	_, err := NewTokenFileProvider(filepath.Join(t.TempDir(), "missing"))
+	assert.Error(t, err)
+}
+
+func TestAuthenticator_Middleware(t *testing.T) {
+	log, err := logger.New("error")
+	require.NoError(t, err)
+
+	auth, err := NewAuthenticatorFromConfig(config.SecurityConfig{
+		APIToken: "legacy",
+		Auth: config.AuthConfig{
+			Tokens: []config.NamedToken{{Name: "sboxmgr", Token: "named"}},
+		},
+	}, log)
+	require.NoError(t, err)
+	require.True(t, auth.Enabled())
+
+	var seen *Identity
+	handler := auth.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		seen, _ = IdentityFromContext(r.Context())
+	}))
+
+	tests := []struct {
+		name     string
+		header   string
+		value    string
+		status   int
+		identity string
+	}{
+		{"no credentials", "", "", http.StatusUnauthorized, ""},
+		{"wrong token", "Authorization", "Bearer nope", http.StatusUnauthorized, ""},
+		{"legacy token", "Authorization", "Bearer legacy", http.StatusOK, "default"},
+		{"named token", "X-API-Token", "named", http.StatusOK, "sboxmgr"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			seen = nil
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			if tt.header != "" {
+				req.Header.Set(tt.header, tt.value)
+			}
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+
+			assert.Equal(t, tt.status, rec.Code)
+			if tt.identity != "" {
+				require.NotNil(t, seen)
+				assert.Equal(t, tt.identity, seen.Name)
+			}
+		})
+	}
+}
+
+func TestAuthenticator_DisabledPassesThrough(t *testing.T) {
+	log, err := logger.New("error")
+	require.NoError(t, err)
+
+	auth, err := NewAuthenticatorFromConfig(config.SecurityConfig{}, log)
+	require.NoError(t, err)
+	assert.False(t, auth.Enabled())
+
+	rec := httptest.NewRecorder()
+	auth.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})).
+		ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+	assert.Equal(t, http.StatusOK, rec.Code)
+}
@@ -0,0 +1,73 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/kpblcaoo/sboxagent/internal/health"
+)
+
+// probeResponse is the body of /healthz and /readyz
+type probeResponse struct {
+	Status     string                         `json:"status"`
+	Components map[string]health.HealthStatus `json:"components,omitempty"`
+}
+
+// SetHealthChecker sets the health checker whose last report decides
+// readiness
+func (s *Server) SetHealthChecker(checker *health.HealthChecker) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.health = checker
+}
+
+// handleProbe registers a probe endpoint. Probes pass the access list but
+// not authentication, as orchestrators and load balancers carry no tokens.
+func (s *Server) handleProbe(pattern string, handler func(http.ResponseWriter, *http.Request)) {
+	s.mux.Handle(pattern, s.metrics.Middleware(pattern, s.filterAddress(http.HandlerFunc(handler))))
+}
+
+// handleHealthz reports liveness: the agent serves requests
+func (s *Server) handleHealthz(w http.ResponseWriter, r *http.Request) {
+	writeProbe(w, http.StatusOK, probeResponse{Status: "ok"})
+}
+
+// handleReadyz reports readiness: the last health report is healthy or
+// degraded. Without a health checker or before its first report the agent
+// is not ready.
+func (s *Server) handleReadyz(w http.ResponseWriter, r *http.Request) {
+	s.mu.RLock()
+	checker := s.health
+	s.mu.RUnlock()
+	if checker == nil {
+		writeProbe(w, http.StatusServiceUnavailable, probeResponse{Status: string(health.HealthStatusUnknown)})
+		return
+	}
+
+	report := checker.GetLastReport()
+	response := probeResponse{Status: string(report.OverallStatus)}
+	if response.Status == "" {
+		response.Status = string(health.HealthStatusUnknown)
+	}
+	if len(report.Components) > 0 {
+		response.Components = make(map[string]health.HealthStatus, len(report.Components))
+		for _, component := range report.Components {
+			response.Components[component.Name] = component.Status
+		}
+	}
+
+	code := http.StatusServiceUnavailable
+	switch report.OverallStatus {
+	case health.HealthStatusHealthy, health.HealthStatusDegraded:
+		code = http.StatusOK
+	}
+	writeProbe(w, code, response)
+}
+
+// writeProbe writes a probe response
+func writeProbe(w http.ResponseWriter, code int, response probeResponse) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(response)
+}
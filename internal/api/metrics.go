@@ -0,0 +1,235 @@
+package api
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/kpblcaoo/sboxagent/internal/logger"
+	"github.com/kpblcaoo/sboxagent/internal/telemetry"
+)
+
+// latencyBuckets are the upper bounds of the request duration histogram
+var latencyBuckets = []time.Duration{
+	5 * time.Millisecond,
+	10 * time.Millisecond,
+	25 * time.Millisecond,
+	50 * time.Millisecond,
+	100 * time.Millisecond,
+	250 * time.Millisecond,
+	500 * time.Millisecond,
+	time.Second,
+	2500 * time.Millisecond,
+	5 * time.Second,
+}
+
+// EndpointStats holds request statistics for a single endpoint
+type EndpointStats struct {
+	Requests     int64         `json:"requests"`
+	Errors       int64         `json:"errors"`
+	SlowRequests int64         `json:"slowRequests"`
+	TotalLatency time.Duration `json:"totalLatency"`
+	MaxLatency   time.Duration `json:"maxLatency"`
+	StatusCodes  map[int]int64 `json:"statusCodes"`
+	buckets      []int64       // cumulative counts per latencyBuckets entry
+}
+
+// AverageLatency returns the mean request latency
+func (e EndpointStats) AverageLatency() time.Duration {
+	if e.Requests == 0 {
+		return 0
+	}
+	return e.TotalLatency / time.Duration(e.Requests)
+}
+
+// Metrics collects per-endpoint request metrics for the HTTP API
+type Metrics struct {
+	logger        *logger.Logger
+	slowThreshold time.Duration
+
+	mu        sync.RWMutex
+	endpoints map[string]*EndpointStats
+
+	// collectors write metrics owned by other components
+	collectors []func(w io.Writer)
+
+	// labels are added to every HTTP metric
+	labels telemetry.Labels
+}
+
+// NewMetrics creates a new metrics collector. Requests slower than
+// slowThreshold are logged; a zero threshold disables slow request logging.
+func NewMetrics(log *logger.Logger, slowThreshold time.Duration) *Metrics {
+	return &Metrics{
+		logger:        log,
+		slowThreshold: slowThreshold,
+		endpoints:     make(map[string]*EndpointStats),
+	}
+}
+
+// Middleware wraps a handler and records metrics under the given endpoint name
+func (m *Metrics) Middleware(endpoint string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		recorder := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+
+		next.ServeHTTP(recorder, r)
+
+		duration := time.Since(start)
+		m.Observe(endpoint, recorder.status, duration)
+
+		if m.slowThreshold > 0 && duration >= m.slowThreshold {
+			m.logger.Warn("Slow API request", map[string]interface{}{
+				"endpoint":  endpoint,
+				"method":    r.Method,
+				"status":    recorder.status,
+				"duration":  duration.String(),
+				"threshold": m.slowThreshold.String(),
+			})
+		}
+	})
+}
+
+// Observe records a single request
+func (m *Metrics) Observe(endpoint string, status int, duration time.Duration) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	stats, ok := m.endpoints[endpoint]
+	if !ok {
+		stats = &EndpointStats{
+			StatusCodes: make(map[int]int64),
+			buckets:     make([]int64, len(latencyBuckets)),
+		}
+		m.endpoints[endpoint] = stats
+	}
+
+	stats.Requests++
+	stats.StatusCodes[status]++
+	stats.TotalLatency += duration
+	if duration > stats.MaxLatency {
+		stats.MaxLatency = duration
+	}
+	if status >= http.StatusInternalServerError {
+		stats.Errors++
+	}
+	if m.slowThreshold > 0 && duration >= m.slowThreshold {
+		stats.SlowRequests++
+	}
+	for i, bound := range latencyBuckets {
+		if duration <= bound {
+			stats.buckets[i]++
+		}
+	}
+}
+
+// AddCollector registers a function that writes further metrics in
+// Prometheus text format after the HTTP metrics
+func (m *Metrics) AddCollector(collect func(w io.Writer)) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.collectors = append(m.collectors, collect)
+}
+
+// SetLabels sets the telemetry labels added to every HTTP metric
+func (m *Metrics) SetLabels(labels telemetry.Labels) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.labels = labels
+}
+
+// GetStats returns a copy of the statistics for all endpoints
+func (m *Metrics) GetStats() map[string]EndpointStats {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	result := make(map[string]EndpointStats, len(m.endpoints))
+	for endpoint, stats := range m.endpoints {
+		statsCopy := *stats
+		statsCopy.StatusCodes = make(map[int]int64, len(stats.StatusCodes))
+		for code, count := range stats.StatusCodes {
+			statsCopy.StatusCodes[code] = count
+		}
+		statsCopy.buckets = append([]int64(nil), stats.buckets...)
+		result[endpoint] = statsCopy
+	}
+	return result
+}
+
+// WritePrometheus writes the metrics in Prometheus text exposition format
+func (m *Metrics) WritePrometheus(w io.Writer) {
+	stats := m.GetStats()
+	m.mu.RLock()
+	labels := m.labels.Prefix()
+	m.mu.RUnlock()
+
+	endpoints := make([]string, 0, len(stats))
+	for endpoint := range stats {
+		endpoints = append(endpoints, endpoint)
+	}
+	sort.Strings(endpoints)
+
+	fmt.Fprintln(w, "# HELP sboxagent_http_requests_total Total HTTP API requests by endpoint and status code.")
+	fmt.Fprintln(w, "# TYPE sboxagent_http_requests_total counter")
+	for _, endpoint := range endpoints {
+		codes := make([]int, 0, len(stats[endpoint].StatusCodes))
+		for code := range stats[endpoint].StatusCodes {
+			codes = append(codes, code)
+		}
+		sort.Ints(codes)
+		for _, code := range codes {
+			fmt.Fprintf(w, "sboxagent_http_requests_total{%sendpoint=%q,code=\"%d\"} %d\n",
+				labels, endpoint, code, stats[endpoint].StatusCodes[code])
+		}
+	}
+
+	// The error rate is left to PromQL, as the ratio of the rates of this
+	// counter and sboxagent_http_requests_total
+	fmt.Fprintln(w, "# HELP sboxagent_http_request_errors_total Total HTTP API requests that failed with a 5xx status.")
+	fmt.Fprintln(w, "# TYPE sboxagent_http_request_errors_total counter")
+	for _, endpoint := range endpoints {
+		fmt.Fprintf(w, "sboxagent_http_request_errors_total{%sendpoint=%q} %d\n", labels, endpoint, stats[endpoint].Errors)
+	}
+
+	fmt.Fprintln(w, "# HELP sboxagent_http_slow_requests_total Total HTTP API requests slower than the slow request threshold.")
+	fmt.Fprintln(w, "# TYPE sboxagent_http_slow_requests_total counter")
+	for _, endpoint := range endpoints {
+		fmt.Fprintf(w, "sboxagent_http_slow_requests_total{%sendpoint=%q} %d\n", labels, endpoint, stats[endpoint].SlowRequests)
+	}
+
+	fmt.Fprintln(w, "# HELP sboxagent_http_request_duration_seconds HTTP API request latency.")
+	fmt.Fprintln(w, "# TYPE sboxagent_http_request_duration_seconds histogram")
+	for _, endpoint := range endpoints {
+		endpointStats := stats[endpoint]
+		for i, bound := range latencyBuckets {
+			fmt.Fprintf(w, "sboxagent_http_request_duration_seconds_bucket{%sendpoint=%q,le=%q} %d\n",
+				labels, endpoint, strconv.FormatFloat(bound.Seconds(), 'f', -1, 64), endpointStats.buckets[i])
+		}
+		fmt.Fprintf(w, "sboxagent_http_request_duration_seconds_bucket{%sendpoint=%q,le=\"+Inf\"} %d\n", labels, endpoint, endpointStats.Requests)
+		fmt.Fprintf(w, "sboxagent_http_request_duration_seconds_sum{%sendpoint=%q} %g\n", labels, endpoint, endpointStats.TotalLatency.Seconds())
+		fmt.Fprintf(w, "sboxagent_http_request_duration_seconds_count{%sendpoint=%q} %d\n", labels, endpoint, endpointStats.Requests)
+	}
+
+	m.mu.RLock()
+	collectors := append([]func(w io.Writer){}, m.collectors...)
+	m.mu.RUnlock()
+	for _, collect := range collectors {
+		collect(w)
+	}
+}
+
+// statusRecorder captures the response status code
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+// WriteHeader records the status code before writing it
+func (r *statusRecorder) WriteHeader(status int) {
+	r.status = status
+	r.ResponseWriter.WriteHeader(status)
+}
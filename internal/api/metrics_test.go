@@ -0,0 +1,95 @@
+package api
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/kpblcaoo/sboxagent/internal/logger"
+	"github.com/kpblcaoo/sboxagent/internal/telemetry"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMetrics_Observe(t *testing.T) {
+	log, err := logger.New("error")
+	require.NoError(t, err)
+
+	metrics := NewMetrics(log, 100*time.Millisecond)
+	metrics.Observe("/status", http.StatusOK, 10*time.Millisecond)
+	metrics.Observe("/status", http.StatusInternalServerError, 200*time.Millisecond)
+
+	stats := metrics.GetStats()["/status"]
+	assert.Equal(t, int64(2), stats.Requests)
+	assert.Equal(t, int64(1), stats.Errors)
+	assert.Equal(t, int64(1), stats.SlowRequests)
+	assert.Equal(t, 200*time.Millisecond, stats.MaxLatency)
+	assert.Equal(t, 105*time.Millisecond, stats.AverageLatency())
+	assert.Equal(t, int64(1), stats.StatusCodes[http.StatusOK])
+}
+
+func TestMetrics_Middleware(t *testing.T) {
+	log, err := logger.New("error")
+	require.NoError(t, err)
+
+	metrics := NewMetrics(log, 0)
+	handler := metrics.Middleware("/fail", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "boom", http.StatusServiceUnavailable)
+	}))
+
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/fail", nil))
+
+	stats := metrics.GetStats()["/fail"]
+	assert.Equal(t, int64(1), stats.Requests)
+	assert.Equal(t, int64(1), stats.StatusCodes[http.StatusServiceUnavailable])
+	assert.Equal(t, int64(0), stats.SlowRequests)
+}
+
+func TestMetrics_WritePrometheus(t *testing.T) {
+	log, err := logger.New("error")
+	require.NoError(t, err)
+
+	metrics := NewMetrics(log, time.Second)
+	metrics.Observe("/metrics", http.StatusOK, 3*time.Millisecond)
+
+	var buf bytes.Buffer
+	metrics.WritePrometheus(&buf)
+	output := buf.String()
+
+	assert.Contains(t, output, `sboxagent_http_requests_total{endpoint="/metrics",code="200"} 1`)
+	assert.Contains(t, output, `sboxagent_http_request_errors_total{endpoint="/metrics"} 0`)
+	assert.Contains(t, output, `sboxagent_http_request_duration_seconds_bucket{endpoint="/metrics",le="0.005"} 1`)
+	assert.Contains(t, output, `sboxagent_http_request_duration_seconds_count{endpoint="/metrics"} 1`)
+}
+
+func TestMetrics_SetLabels(t *testing.T) {
+	log, err := logger.New("error")
+	require.NoError(t, err)
+
+	metrics := NewMetrics(log, 0)
+	metrics.SetLabels(telemetry.New("edge-1", "home", "").With(telemetry.LabelService, "api"))
+	metrics.Observe("/status", http.StatusOK, time.Millisecond)
+
+	var buf bytes.Buffer
+	metrics.WritePrometheus(&buf)
+	assert.Contains(t, buf.String(),
+		`sboxagent_http_requests_total{agent_id="edge-1",profile="home",service="api",endpoint="/status",code="200"} 1`)
+}
+
+func TestMetrics_AddCollector(t *testing.T) {
+	log, err := logger.New("error")
+	require.NoError(t, err)
+
+	metrics := NewMetrics(log, 0)
+	metrics.AddCollector(func(w io.Writer) {
+		fmt.Fprintln(w, "sboxagent_custom 1")
+	})
+
+	var buf bytes.Buffer
+	metrics.WritePrometheus(&buf)
+	assert.Contains(t, buf.String(), "sboxagent_custom 1\n")
+}
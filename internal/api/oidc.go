@@ -0,0 +1,283 @@
+package api
+
+import (
+	"context"
+	"crypto"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/kpblcaoo/sboxagent/internal/config"
+)
+
+// oidcLeeway is the allowed clock skew for exp/nbf checks
+const oidcLeeway = time.Minute
+
+// oidcRefreshBackoff is the minimum time between key set refreshes, so
+// unknown key IDs or an unreachable provider do not trigger a fetch per
+// request
+const oidcRefreshBackoff = time.Minute
+
+// OIDCProvider validates RS256-signed JWT bearer tokens issued by an OIDC provider
+type OIDCProvider struct {
+	issuer          string
+	audience        string
+	jwksURL         string
+	refreshInterval time.Duration
+	client          *http.Client
+
+	mu          sync.Mutex
+	keys        map[string]*rsa.PublicKey
+	lastRefresh time.Time
+	// lastAttempt is when the last refresh started, whether it succeeded
+	lastAttempt time.Time
+	// refreshing is closed when the refresh in flight ends
+	refreshing chan struct{}
+	refreshErr error
+}
+
+// NewOIDCProvider creates a new OIDC provider. Keys are fetched lazily.
+func NewOIDCProvider(cfg config.OIDCConfig) (*OIDCProvider, error) {
+	if cfg.Issuer == "" {
+		return nil, fmt.Errorf("oidc issuer is required")
+	}
+	if cfg.Audience == "" {
+		return nil, fmt.Errorf("oidc audience is required")
+	}
+
+	refreshInterval := time.Hour
+	if cfg.RefreshInterval > 0 {
+		refreshInterval = cfg.RefreshInterval
+	}
+
+	return &OIDCProvider{
+		issuer:          strings.TrimSuffix(cfg.Issuer, "/"),
+		audience:        cfg.Audience,
+		jwksURL:         cfg.JWKSURL,
+		refreshInterval: refreshInterval,
+		client:          &http.Client{Timeout: 10 * time.Second},
+	}, nil
+}
+
+// Name returns the provider name
+func (p *OIDCProvider) Name() string {
+	return "oidc"
+}
+
+// Authenticate validates the JWT signature and its iss, aud, exp and nbf claims
+func (p *OIDCProvider) Authenticate(ctx context.Context, token string) (*Identity, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, ErrInvalidCredentials
+	}
+
+	var header struct {
+		Alg string `json:"alg"`
+		Kid string `json:"kid"`
+	}
+	if err := decodeSegment(parts[0], &header); err != nil {
+		return nil, ErrInvalidCredentials
+	}
+	if header.Alg != "RS256" {
+		return nil, ErrInvalidCredentials
+	}
+
+	key, err := p.key(ctx, header.Kid)
+	if err != nil {
+		return nil, err
+	}
+
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, ErrInvalidCredentials
+	}
+	digest := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+	if err := rsa.VerifyPKCS1v15(key, crypto.SHA256, digest[:], signature); err != nil {
+		return nil, ErrInvalidCredentials
+	}
+
+	var claims struct {
+		Issuer            string          `json:"iss"`
+		Subject           string          `json:"sub"`
+		Audience          json.RawMessage `json:"aud"`
+		ExpiresAt         int64           `json:"exp"`
+		NotBefore         int64           `json:"nbf"`
+		PreferredUsername string          `json:"preferred_username"`
+	}
+	if err := decodeSegment(parts[1], &claims); err != nil {
+		return nil, ErrInvalidCredentials
+	}
+
+	now := time.Now()
+	switch {
+	case strings.TrimSuffix(claims.Issuer, "/") != p.issuer:
+		return nil, ErrInvalidCredentials
+	case !audienceContains(claims.Audience, p.audience):
+		return nil, ErrInvalidCredentials
+	case claims.ExpiresAt == 0 || now.After(time.Unix(claims.ExpiresAt, 0).Add(oidcLeeway)):
+		return nil, ErrInvalidCredentials
+	case claims.NotBefore != 0 && now.Add(oidcLeeway).Before(time.Unix(claims.NotBefore, 0)):
+		return nil, ErrInvalidCredentials
+	}
+
+	name := claims.PreferredUsername
+	if name == "" {
+		name = claims.Subject
+	}
+	return &Identity{Name: name, Provider: p.Name()}, nil
+}
+
+// key returns the public key for kid, refreshing the key set when it is
+// stale or the key is unknown. Cached keys keep being served while the
+// refresh fails.
+func (p *OIDCProvider) key(ctx context.Context, kid string) (*rsa.PublicKey, error) {
+	p.mu.Lock()
+	key, ok := p.keys[kid]
+	stale := time.Since(p.lastRefresh) > p.refreshInterval
+	refreshing := p.refreshing != nil
+	due := !refreshing && time.Since(p.lastAttempt) >= oidcRefreshBackoff
+	// Known keys are served while a refresh runs or backs off
+	if ok && (!stale || !due) {
+		p.mu.Unlock()
+		return key, nil
+	}
+	if !due && !refreshing {
+		p.mu.Unlock()
+		return nil, ErrInvalidCredentials
+	}
+
+	// Requests arriving during a refresh wait for it instead of fetching
+	done := p.refreshing
+	if done == nil {
+		done = make(chan struct{})
+		p.refreshing = done
+		p.lastAttempt = time.Now()
+		p.mu.Unlock()
+		// The fetch is shared, so it outlives the request starting it
+		keys, err := p.fetchKeys(context.WithoutCancel(ctx))
+		p.mu.Lock()
+		if err == nil {
+			p.keys = keys
+			p.lastRefresh = time.Now()
+		}
+		p.refreshErr = err
+		p.refreshing = nil
+		close(done)
+		p.mu.Unlock()
+	} else {
+		p.mu.Unlock()
+		select {
+		case <-done:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if key, ok := p.keys[kid]; ok {
+		return key, nil
+	}
+	if p.refreshErr != nil {
+		return nil, p.refreshErr
+	}
+	return nil, ErrInvalidCredentials
+}
+
+// fetchKeys fetches the JWKS document
+func (p *OIDCProvider) fetchKeys(ctx context.Context) (map[string]*rsa.PublicKey, error) {
+	jwksURL := p.jwksURL
+	if jwksURL == "" {
+		var discovery struct {
+			JWKSURI string `json:"jwks_uri"`
+		}
+		if err := p.getJSON(ctx, p.issuer+"/.well-known/openid-configuration", &discovery); err != nil {
+			return nil, fmt.Errorf("oidc discovery failed: %w", err)
+		}
+		if discovery.JWKSURI == "" {
+			return nil, fmt.Errorf("oidc discovery document has no jwks_uri")
+		}
+		jwksURL = discovery.JWKSURI
+	}
+
+	var jwks struct {
+		Keys []struct {
+			Kty string `json:"kty"`
+			Kid string `json:"kid"`
+			N   string `json:"n"`
+			E   string `json:"e"`
+		} `json:"keys"`
+	}
+	if err := p.getJSON(ctx, jwksURL, &jwks); err != nil {
+		return nil, fmt.Errorf("failed to fetch jwks: %w", err)
+	}
+
+	keys := make(map[string]*rsa.PublicKey)
+	for _, jwk := range jwks.Keys {
+		if jwk.Kty != "RSA" {
+			continue
+		}
+		n, errN := base64.RawURLEncoding.DecodeString(jwk.N)
+		e, errE := base64.RawURLEncoding.DecodeString(jwk.E)
+		if errN != nil || errE != nil {
+			continue
+		}
+		keys[jwk.Kid] = &rsa.PublicKey{
+			N: new(big.Int).SetBytes(n),
+			E: int(new(big.Int).SetBytes(e).Int64()),
+		}
+	}
+	return keys, nil
+}
+
+// getJSON fetches and decodes a JSON document
+func (p *OIDCProvider) getJSON(ctx context.Context, url string, v interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected status %d from %s", resp.StatusCode, url)
+	}
+	return json.NewDecoder(resp.Body).Decode(v)
+}
+
+// decodeSegment decodes a base64url JWT segment into v
+func decodeSegment(segment string, v interface{}) error {
+	data, err := base64.RawURLEncoding.DecodeString(segment)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
+
+// audienceContains checks a string or array aud claim
+func audienceContains(raw json.RawMessage, audience string) bool {
+	var single string
+	if err := json.Unmarshal(raw, &single); err == nil {
+		return single == audience
+	}
+	var multiple []string
+	if err := json.Unmarshal(raw, &multiple); err == nil {
+		for _, aud := range multiple {
+			if aud == audience {
+				return true
+			}
+		}
+	}
+	return false
+}
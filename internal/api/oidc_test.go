@@ -0,0 +1,188 @@
+package api
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/kpblcaoo/sboxagent/internal/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newTestIssuer starts an OIDC discovery and JWKS server for a single key
+func newTestIssuer(t *testing.T, key *rsa.PrivateKey) *httptest.Server {
+	return newFlakyIssuer(t, key, nil, nil)
+}
+
+// newFlakyIssuer is newTestIssuer counting key set fetches in fetches and
+// failing them while down is set
+func newFlakyIssuer(t *testing.T, key *rsa.PrivateKey, fetches *atomic.Int32, down *atomic.Bool) *httptest.Server {
+	mux := http.NewServeMux()
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]string{
+			"issuer":   server.URL,
+			"jwks_uri": server.URL + "/jwks",
+		})
+	})
+	mux.HandleFunc("/jwks", func(w http.ResponseWriter, r *http.Request) {
+		if fetches != nil {
+			fetches.Add(1)
+		}
+		if down != nil && down.Load() {
+			http.Error(w, "unavailable", http.StatusServiceUnavailable)
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"keys": []map[string]string{{
+				"kty": "RSA",
+				"kid": "test-key",
+				"n":   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+				"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+			}},
+		})
+	})
+
+	return server
+}
+
+// signToken creates an RS256 JWT with the given claims
+func signToken(t *testing.T, key *rsa.PrivateKey, claims map[string]interface{}) string {
+	header, err := json.Marshal(map[string]string{"alg": "RS256", "kid": "test-key", "typ": "JWT"})
+	require.NoError(t, err)
+	payload, err := json.Marshal(claims)
+	require.NoError(t, err)
+
+	signingInput := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(payload)
+	digest := sha256.Sum256([]byte(signingInput))
+	signature, err := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, digest[:])
+	require.NoError(t, err)
+
+	return signingInput + "." + base64.RawURLEncoding.EncodeToString(signature)
+}
+
+func TestOIDCProvider_Authenticate(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	issuer := newTestIssuer(t, key)
+
+	provider, err := NewOIDCProvider(config.OIDCConfig{
+		Enabled:  true,
+		Issuer:   issuer.URL,
+		Audience: "sboxagent",
+	})
+	require.NoError(t, err)
+
+	valid := map[string]interface{}{
+		"iss":                issuer.URL,
+		"sub":                "user-1",
+		"aud":                []string{"other", "sboxagent"},
+		"exp":                time.Now().Add(time.Hour).Unix(),
+		"preferred_username": "alice",
+	}
+
+	identity, err := provider.Authenticate(context.Background(), signToken(t, key, valid))
+	require.NoError(t, err)
+	assert.Equal(t, "alice", identity.Name)
+	assert.Equal(t, "oidc", identity.Provider)
+
+	invalid := []struct {
+		name   string
+		mutate func(map[string]interface{})
+	}{
+		{"expired", func(c map[string]interface{}) { c["exp"] = time.Now().Add(-time.Hour).Unix() }},
+		{"wrong audience", func(c map[string]interface{}) { c["aud"] = "someone-else" }},
+		{"wrong issuer", func(c map[string]interface{}) { c["iss"] = "https://evil.example" }},
+		{"not yet valid", func(c map[string]interface{}) { c["nbf"] = time.Now().Add(time.Hour).Unix() }},
+	}
+	for _, tt := range invalid {
+		t.Run(tt.name, func(t *testing.T) {
+			claims := make(map[string]interface{})
+			for k, v := range valid {
+				claims[k] = v
+			}
+			tt.mutate(claims)
+
+			_, err := provider.Authenticate(context.Background(), signToken(t, key, claims))
+			assert.ErrorIs(t, err, ErrInvalidCredentials)
+		})
+	}
+}
+
+func TestOIDCProvider_RejectsForeignSignature(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	otherKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	issuer := newTestIssuer(t, key)
+
+	provider, err := NewOIDCProvider(config.OIDCConfig{Issuer: issuer.URL, Audience: "sboxagent"})
+	require.NoError(t, err)
+
+	token := signToken(t, otherKey, map[string]interface{}{
+		"iss": issuer.URL,
+		"aud": "sboxagent",
+		"exp": time.Now().Add(time.Hour).Unix(),
+	})
+	_, err = provider.Authenticate(context.Background(), token)
+	assert.ErrorIs(t, err, ErrInvalidCredentials)
+
+	_, err = provider.Authenticate(context.Background(), "not-a-jwt")
+	assert.ErrorIs(t, err, ErrInvalidCredentials)
+}
+
+func TestOIDCProvider_ServesCachedKeysWhileProviderIsDown(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	var fetches atomic.Int32
+	var down atomic.Bool
+	issuer := newFlakyIssuer(t, key, &fetches, &down)
+
+	// Every request finds the key set stale
+	provider, err := NewOIDCProvider(config.OIDCConfig{Issuer: issuer.URL, Audience: "sboxagent", RefreshInterval: time.Nanosecond})
+	require.NoError(t, err)
+	token := signToken(t, key, map[string]interface{}{
+		"iss": issuer.URL,
+		"aud": "sboxagent",
+		"exp": time.Now().Add(time.Hour).Unix(),
+	})
+	_, err = provider.Authenticate(context.Background(), token)
+	require.NoError(t, err)
+	require.Equal(t, int32(1), fetches.Load())
+
+	// The failed refresh is not retried until the backoff passes
+	down.Store(true)
+	provider.lastAttempt = time.Time{}
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := provider.Authenticate(context.Background(), token)
+			assert.NoError(t, err)
+		}()
+	}
+	wg.Wait()
+	assert.Equal(t, int32(2), fetches.Load())
+}
+
+func TestNewOIDCProvider_RequiresIssuerAndAudience(t *testing.T) {
+	_, err := NewOIDCProvider(config.OIDCConfig{Audience: "x"})
+	assert.Error(t, err)
+	_, err = NewOIDCProvider(config.OIDCConfig{Issuer: "https://idp.example"})
+	assert.Error(t, err)
+}
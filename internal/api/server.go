@@ -0,0 +1,221 @@
+// Package api implements the agent's HTTP API server.
+package api
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/kpblcaoo/sboxagent/internal/config"
+	"github.com/kpblcaoo/sboxagent/internal/health"
+	"github.com/kpblcaoo/sboxagent/internal/logger"
+	"github.com/kpblcaoo/sboxagent/internal/security"
+	"github.com/kpblcaoo/sboxagent/internal/tunnel"
+)
+
+// Server represents the HTTP API server
+type Server struct {
+	config  config.ServerConfig
+	logger  *logger.Logger
+	timeout time.Duration
+
+	mux        *http.ServeMux
+	metrics    *Metrics
+	auth       *Authenticator
+	acl        *security.AccessList
+	health     *health.HealthChecker
+	httpServer *http.Server
+	listener   net.Listener
+
+	// State
+	mu      sync.RWMutex
+	running bool
+	wg      sync.WaitGroup
+}
+
+// NewServer creates a new HTTP API server
+func NewServer(cfg config.ServerConfig, log *logger.Logger) (*Server, error) {
+	if cfg.Timeout <= 0 {
+		return nil, fmt.Errorf("invalid server timeout: %s", cfg.Timeout)
+	}
+
+	s := &Server{
+		config:  cfg,
+		logger:  log,
+		timeout: cfg.Timeout,
+		mux:     http.NewServeMux(),
+		metrics: NewMetrics(log, cfg.SlowRequestThreshold),
+	}
+
+	s.HandleFunc("/metrics", s.handleMetrics)
+	s.handleProbe("GET /healthz", s.handleHealthz)
+	s.handleProbe("GET /readyz", s.handleReadyz)
+
+	return s, nil
+}
+
+// SetAuthenticator sets the authenticator applied to all endpoints
+func (s *Server) SetAuthenticator(auth *Authenticator) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.auth = auth
+}
+
+// SetAccessList sets the client address allowlist/denylist
+func (s *Server) SetAccessList(acl *security.AccessList) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.acl = acl
+}
+
+// Handle registers a handler for the given pattern with request metrics,
+// address filtering and authentication
+func (s *Server) Handle(pattern string, handler http.Handler) {
+	s.mux.Handle(pattern, s.metrics.Middleware(pattern, s.filterAddress(s.authenticate(handler))))
+}
+
+// HandleFunc registers a handler function for the given pattern with request metrics
+func (s *Server) HandleFunc(pattern string, handler func(http.ResponseWriter, *http.Request)) {
+	s.Handle(pattern, http.HandlerFunc(handler))
+}
+
+// Start starts serving HTTP requests
+func (s *Server) Start(ctx context.Context) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.running {
+		return fmt.Errorf("api server is already running")
+	}
+
+	addr := net.JoinHostPort(s.config.Host, strconv.Itoa(s.config.Port))
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return fmt.Errorf("failed to listen on %s: %w", addr, err)
+	}
+
+	s.listener = ln
+	s.httpServer = &http.Server{
+		Handler:      s.mux,
+		ReadTimeout:  s.timeout,
+		WriteTimeout: s.timeout,
+	}
+	s.running = true
+
+	s.logger.Info("API server starting", map[string]interface{}{
+		"address": ln.Addr().String(),
+	})
+
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		if err := s.httpServer.Serve(ln); err != nil && err != http.ErrServerClosed {
+			s.logger.Error("API server failed", map[string]interface{}{
+				"error": err.Error(),
+			})
+		}
+	}()
+
+	return nil
+}
+
+// Stop gracefully stops the server
+func (s *Server) Stop() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if !s.running {
+		return
+	}
+
+	s.logger.Info("API server stopping", map[string]interface{}{})
+
+	ctx, cancel := context.WithTimeout(context.Background(), s.timeout)
+	defer cancel()
+	if err := s.httpServer.Shutdown(ctx); err != nil {
+		s.httpServer.Close()
+	}
+	s.wg.Wait()
+	s.running = false
+}
+
+// Addr returns the address the server is listening on
+func (s *Server) Addr() string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if s.listener == nil {
+		return ""
+	}
+	return s.listener.Addr().String()
+}
+
+// Handler returns the API handler, including metrics, access control and
+// authentication
+func (s *Server) Handler() http.Handler {
+	return s.mux
+}
+
+// GetMetrics returns the API request metrics
+func (s *Server) GetMetrics() *Metrics {
+	return s.metrics
+}
+
+// filterAddress rejects clients not permitted by the access list
+func (s *Server) filterAddress(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.mu.RLock()
+		acl := s.acl
+		s.mu.RUnlock()
+
+		// Tunnel requests are authenticated by the tunnel connection itself
+		if acl == nil || tunnel.FromTunnel(r.Context()) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		decision := acl.CheckRemoteAddr(r.RemoteAddr)
+		fields := map[string]interface{}{
+			"remote": r.RemoteAddr,
+			"path":   r.URL.Path,
+			"reason": decision.Reason,
+		}
+		if !decision.Allowed {
+			s.logger.Warn("API request denied by access list", fields)
+			http.Error(w, "forbidden", http.StatusForbidden)
+			return
+		}
+		s.logger.Debug("API request allowed by access list", fields)
+		next.ServeHTTP(w, r)
+	})
+}
+
+// authenticate applies the configured authenticator, if any
+func (s *Server) authenticate(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.mu.RLock()
+		auth := s.auth
+		s.mu.RUnlock()
+
+		if auth == nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+		auth.Middleware(next).ServeHTTP(w, r)
+	})
+}
+
+// handleMetrics serves metrics in Prometheus text format
+func (s *Server) handleMetrics(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	s.metrics.WritePrometheus(w)
+}
@@ -0,0 +1,177 @@
+package api
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/kpblcaoo/sboxagent/internal/config"
+	"github.com/kpblcaoo/sboxagent/internal/health"
+	"github.com/kpblcaoo/sboxagent/internal/logger"
+	"github.com/kpblcaoo/sboxagent/internal/security"
+	"github.com/kpblcaoo/sboxagent/internal/tunnel"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestServer(t *testing.T) *Server {
+	log, err := logger.New("error")
+	require.NoError(t, err)
+
+	server, err := NewServer(config.ServerConfig{
+		Enabled: true,
+		Host:    "127.0.0.1",
+		Port:    0,
+		Timeout: 5 * time.Second,
+	}, log)
+	require.NoError(t, err)
+	return server
+}
+
+func TestNewServer_InvalidTimeout(t *testing.T) {
+	log, err := logger.New("error")
+	require.NoError(t, err)
+
+	_, err = NewServer(config.ServerConfig{Timeout: 0}, log)
+	assert.Error(t, err)
+}
+
+func TestServer_MetricsEndpoint(t *testing.T) {
+	server := newTestServer(t)
+	server.HandleFunc("/ping", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("pong"))
+	})
+
+	require.NoError(t, server.Start(context.Background()))
+	defer server.Stop()
+
+	base := "http://" + server.Addr()
+
+	resp, err := http.Get(base + "/ping")
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+	resp, err = http.Get(base + "/metrics")
+	require.NoError(t, err)
+	body, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	require.NoError(t, err)
+
+	assert.Contains(t, string(body), `sboxagent_http_requests_total{endpoint="/ping",code="200"} 1`)
+}
+
+func TestServer_StartTwice(t *testing.T) {
+	server := newTestServer(t)
+	require.NoError(t, server.Start(context.Background()))
+	defer server.Stop()
+
+	assert.Error(t, server.Start(context.Background()))
+}
+
+func TestServer_AccessList(t *testing.T) {
+	server := newTestServer(t)
+	server.HandleFunc("/ping", func(w http.ResponseWriter, r *http.Request) {})
+
+	acl, err := security.NewAccessList([]string{"10.0.0.0/8"}, []string{"10.6.6.6"})
+	require.NoError(t, err)
+	server.SetAccessList(acl)
+
+	tests := []struct {
+		remote string
+		status int
+	}{
+		{"10.1.2.3:5555", http.StatusOK},
+		{"10.6.6.6:5555", http.StatusForbidden},
+		{"192.0.2.1:5555", http.StatusForbidden},
+	}
+
+	for _, tt := range tests {
+		req := httptest.NewRequest(http.MethodGet, "/ping", nil)
+		req.RemoteAddr = tt.remote
+		rec := httptest.NewRecorder()
+		server.mux.ServeHTTP(rec, req)
+		assert.Equal(t, tt.status, rec.Code, tt.remote)
+	}
+}
+
+func TestServer_TunnelRequestsBypassAccessList(t *testing.T) {
+	server := newTestServer(t)
+	acl, err := security.NewAccessList([]string{"10.0.0.0/8"}, nil)
+	require.NoError(t, err)
+	server.SetAccessList(acl)
+	server.HandleFunc("/ping", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+
+	// Direct request from a non-allowed address is denied
+	req := httptest.NewRequest(http.MethodGet, "/ping", nil)
+	rec := httptest.NewRecorder()
+	server.Handler().ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusForbidden, rec.Code)
+
+	// The same request arriving over the tunnel is served
+	req = httptest.NewRequest(http.MethodGet, "/ping", nil).WithContext(tunnel.WithTunnel(context.Background()))
+	req.RemoteAddr = "tunnel"
+	rec = httptest.NewRecorder()
+	server.Handler().ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusOK, rec.Code)
+}
+
+// stubCheck reports a fixed status
+type stubCheck struct {
+	status health.HealthStatus
+}
+
+func (c stubCheck) Name() string { return "stub" }
+
+func (c stubCheck) Check(ctx context.Context) health.ComponentHealth {
+	return health.ComponentHealth{Name: "stub", Status: c.status, Timestamp: time.Now()}
+}
+
+func TestServer_Probes(t *testing.T) {
+	server := newTestServer(t)
+	// Probes are served without a token
+	server.SetAuthenticator(NewAuthenticator(server.logger, NewStaticTokenProvider(map[string]string{"secret": "admin"})))
+	probe := func(path string) (int, string) {
+		rec := httptest.NewRecorder()
+		server.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+		return rec.Code, rec.Body.String()
+	}
+
+	code, body := probe("/healthz")
+	assert.Equal(t, http.StatusOK, code)
+	assert.JSONEq(t, `{"status":"ok"}`, body)
+	code, body = probe("/readyz")
+	assert.Equal(t, http.StatusServiceUnavailable, code)
+	assert.JSONEq(t, `{"status":"unknown"}`, body)
+
+	for _, tt := range []struct {
+		status health.HealthStatus
+		code   int
+	}{
+		{health.HealthStatusHealthy, http.StatusOK},
+		{health.HealthStatusDegraded, http.StatusOK},
+		{health.HealthStatusUnhealthy, http.StatusServiceUnavailable},
+	} {
+		checker := health.NewHealthChecker(server.logger, time.Hour, time.Second)
+		require.NoError(t, checker.RegisterCheck(stubCheck{status: tt.status}))
+		require.NoError(t, checker.Start(context.Background()))
+		require.Eventually(t, func() bool {
+			return checker.GetLastReport().OverallStatus != ""
+		}, 5*time.Second, 10*time.Millisecond)
+		server.SetHealthChecker(checker)
+
+		code, body = probe("/readyz")
+		assert.Equal(t, tt.code, code, tt.status)
+		assert.JSONEq(t, `{"status":"`+string(tt.status)+`","components":{"stub":"`+string(tt.status)+`"}}`, body)
+		checker.Stop()
+	}
+
+	// Other endpoints still require authentication
+	code, _ = probe("/metrics")
+	assert.Equal(t, http.StatusUnauthorized, code)
+}
@@ -0,0 +1,175 @@
+// Package clientapi reads the configuration a running client reports through
+// its Clash-compatible controller API (clash's external-controller and
+// sing-box's clash_api) and compares it with the config file on disk.
+package clientapi
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/spf13/viper"
+)
+
+// ErrUnsupported is returned for clients without a controller API, or whose
+// config does not enable it
+var ErrUnsupported = errors.New("client does not expose a controller API")
+
+// maxResponse bounds the controller response read
+const maxResponse = 1 << 20
+
+// Endpoint is the controller API of a running client
+type Endpoint struct {
+	URL    string `json:"url"`
+	Secret string `json:"-"`
+}
+
+// Difference is a setting whose runtime value differs from the file
+type Difference struct {
+	Key     string      `json:"key"`
+	Disk    interface{} `json:"disk"`
+	Runtime interface{} `json:"runtime"`
+}
+
+// ParseConfig decodes a client config file, which is JSON or, for clash,
+// YAML
+func ParseConfig(data []byte) (map[string]interface{}, error) {
+	var doc map[string]interface{}
+	if err := json.Unmarshal(data, &doc); err == nil {
+		return doc, nil
+	}
+	v := viper.New()
+	v.SetConfigType("yaml")
+	if err := v.ReadConfig(bytes.NewReader(data)); err != nil {
+		return nil, fmt.Errorf("failed to parse client config: %w", err)
+	}
+	return v.AllSettings(), nil
+}
+
+// Discover returns the controller API configured in a client config
+func Discover(clientType string, doc map[string]interface{}) (Endpoint, error) {
+	var controller, secret string
+	switch clientType {
+	case "sing-box":
+		experimental, _ := doc["experimental"].(map[string]interface{})
+		clashAPI, _ := experimental["clash_api"].(map[string]interface{})
+		controller, _ = clashAPI["external_controller"].(string)
+		secret, _ = clashAPI["secret"].(string)
+	case "clash":
+		controller, _ = doc["external-controller"].(string)
+		secret, _ = doc["secret"].(string)
+	}
+	if controller == "" {
+		return Endpoint{}, ErrUnsupported
+	}
+
+	// Controllers listening on all addresses are reached over loopback
+	if strings.HasPrefix(controller, ":") || strings.HasPrefix(controller, "0.0.0.0:") {
+		controller = "127.0.0.1:" + controller[strings.LastIndex(controller, ":")+1:]
+	}
+	if !strings.Contains(controller, "://") {
+		controller = "http://" + controller
+	}
+	return Endpoint{URL: strings.TrimSuffix(controller, "/"), Secret: secret}, nil
+}
+
+// FetchConfig returns the settings the client reports at /configs
+func FetchConfig(ctx context.Context, client *http.Client, endpoint Endpoint) (map[string]interface{}, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint.URL+"/configs", nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	if endpoint.Secret != "" {
+		req.Header.Set("Authorization", "Bearer "+endpoint.Secret)
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query client api: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("client api returned %s", resp.Status)
+	}
+
+	var settings map[string]interface{}
+	if err := json.NewDecoder(io.LimitReader(resp.Body, maxResponse)).Decode(&settings); err != nil {
+		return nil, fmt.Errorf("failed to decode client api response: %w", err)
+	}
+	return settings, nil
+}
+
+// clashSettings are the clash config keys reported at /configs
+var clashSettings = []string{"port", "socks-port", "redir-port", "tproxy-port", "mixed-port", "allow-lan", "bind-address", "mode", "log-level", "ipv6"}
+
+// Expected returns the settings a client should report at /configs
+// according to its config file. Settings the file leaves unset are omitted.
+func Expected(clientType string, doc map[string]interface{}) map[string]interface{} {
+	expected := make(map[string]interface{})
+	switch clientType {
+	case "sing-box":
+		// The clash API of sing-box reports only the mode and log level
+		if log, ok := doc["log"].(map[string]interface{}); ok && log["level"] != nil {
+			expected["log-level"] = log["level"]
+		}
+		experimental, _ := doc["experimental"].(map[string]interface{})
+		clashAPI, _ := experimental["clash_api"].(map[string]interface{})
+		if mode, ok := clashAPI["default_mode"]; ok {
+			expected["mode"] = mode
+		}
+	case "clash":
+		for _, key := range clashSettings {
+			if value, ok := doc[key]; ok {
+				expected[key] = value
+			}
+		}
+	}
+	return expected
+}
+
+// Compare returns the expected settings whose runtime values differ, by key
+func Compare(expected, runtime map[string]interface{}) []Difference {
+	var differences []Difference
+	for key, want := range expected {
+		got, ok := runtime[key]
+		if ok && equal(want, got) {
+			continue
+		}
+		differences = append(differences, Difference{Key: key, Disk: want, Runtime: got})
+	}
+	sort.Slice(differences, func(i, j int) bool { return differences[i].Key < differences[j].Key })
+	return differences
+}
+
+// equal compares a file value with a reported one. Numbers are compared by
+// value and strings case-insensitively, since clients normalize modes.
+func equal(disk, runtime interface{}) bool {
+	if a, ok := number(disk); ok {
+		b, ok := number(runtime)
+		return ok && a == b
+	}
+	if a, ok := disk.(string); ok {
+		b, ok := runtime.(string)
+		return ok && strings.EqualFold(a, b)
+	}
+	return fmt.Sprint(disk) == fmt.Sprint(runtime)
+}
+
+// number converts the numeric types produced by JSON and YAML decoding
+func number(value interface{}) (float64, bool) {
+	switch n := value.(type) {
+	case float64:
+		return n, true
+	case int:
+		return float64(n), true
+	case int64:
+		return float64(n), true
+	}
+	return 0, false
+}
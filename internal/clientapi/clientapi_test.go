@@ -0,0 +1,66 @@
+package clientapi
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDiscover(t *testing.T) {
+	singBox, err := ParseConfig([]byte(`{"experimental":{"clash_api":{"external_controller":"0.0.0.0:9090","secret":"s3cret"}}}`))
+	require.NoError(t, err)
+	endpoint, err := Discover("sing-box", singBox)
+	require.NoError(t, err)
+	assert.Equal(t, Endpoint{URL: "http://127.0.0.1:9090", Secret: "s3cret"}, endpoint)
+
+	clash, err := ParseConfig([]byte("mixed-port: 7890\nexternal-controller: 127.0.0.1:9091\n"))
+	require.NoError(t, err)
+	endpoint, err = Discover("clash", clash)
+	require.NoError(t, err)
+	assert.Equal(t, "http://127.0.0.1:9091", endpoint.URL)
+
+	_, err = Discover("sing-box", map[string]interface{}{})
+	assert.ErrorIs(t, err, ErrUnsupported)
+	_, err = Discover("xray", clash)
+	assert.ErrorIs(t, err, ErrUnsupported)
+}
+
+func TestFetchConfig(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer s3cret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		assert.Equal(t, "/configs", r.URL.Path)
+		w.Write([]byte(`{"mixed-port":7890,"mode":"Rule","log-level":"info"}`))
+	}))
+	defer server.Close()
+
+	settings, err := FetchConfig(context.Background(), server.Client(), Endpoint{URL: server.URL, Secret: "s3cret"})
+	require.NoError(t, err)
+	assert.Equal(t, "Rule", settings["mode"])
+
+	_, err = FetchConfig(context.Background(), server.Client(), Endpoint{URL: server.URL})
+	assert.ErrorContains(t, err, "401")
+}
+
+func TestCompare(t *testing.T) {
+	clash, err := ParseConfig([]byte("mixed-port: 7890\nmode: rule\nlog-level: debug\nproxies: []\n"))
+	require.NoError(t, err)
+
+	differences := Compare(Expected("clash", clash), map[string]interface{}{
+		"mixed-port": float64(7890),
+		"mode":       "Rule",
+		"log-level":  "info",
+	})
+	assert.Equal(t, []Difference{{Key: "log-level", Disk: "debug", Runtime: "info"}}, differences)
+
+	singBox, err := ParseConfig([]byte(`{"log":{"level":"warn"},"experimental":{"clash_api":{"default_mode":"global"}}}`))
+	require.NoError(t, err)
+	assert.Equal(t, map[string]interface{}{"log-level": "warn", "mode": "global"}, Expected("sing-box", singBox))
+	assert.Empty(t, Compare(Expected("sing-box", singBox), map[string]interface{}{"log-level": "warn", "mode": "Global", "port": 0}))
+}
@@ -0,0 +1,170 @@
+package clientversion
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+)
+
+// Requirement is a feature of a config and the first client release
+// supporting it
+type Requirement struct {
+	Feature string  `json:"feature"`
+	Since   Version `json:"since"`
+}
+
+func (r Requirement) String() string {
+	return fmt.Sprintf("%s requires %s", r.Feature, r.Since)
+}
+
+// Compatibility matrix: the first release supporting each feature, by
+// client. Features not listed are assumed to be supported by every release.
+var (
+	// singBoxTypes are sing-box inbound, outbound and endpoint types
+	singBoxTypes = map[string]Version{
+		"shadowtls": {1, 1, 0},
+		"tuic":      {1, 2, 0},
+		"hysteria2": {1, 5, 0},
+		"wireguard": {1, 11, 0}, // as an endpoint
+		"anytls":    {1, 12, 0},
+	}
+	singBoxEndpoints   = Version{1, 11, 0}
+	singBoxRuleSets    = Version{1, 8, 0}
+	singBoxRuleActions = Version{1, 11, 0}
+	singBoxDNSTypes    = Version{1, 12, 0}
+
+	// xrayTransports are Xray stream networks and security types
+	xrayTransports = map[string]Version{
+		"reality":   {1, 8, 0},
+		"splithttp": {1, 8, 16},
+		"xhttp":     {24, 9, 30},
+	}
+)
+
+// Requirements returns the features of a client config that not every
+// release supports, sorted by feature. Clients without a compatibility
+// matrix have none.
+func Requirements(client string, data []byte) ([]Requirement, error) {
+	var reqs requirements
+	var err error
+	switch client {
+	case "sing-box":
+		err = singBoxRequirements(data, &reqs)
+	case "xray":
+		err = xrayRequirements(data, &reqs)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse %s config: %w", client, err)
+	}
+	return reqs.sorted(), nil
+}
+
+// Unsupported returns the requirements of a client config that installed
+// does not meet
+func Unsupported(client string, installed Version, data []byte) ([]Requirement, error) {
+	reqs, err := Requirements(client, data)
+	if err != nil {
+		return nil, err
+	}
+	var unsupported []Requirement
+	for _, req := range reqs {
+		if installed.Less(req.Since) {
+			unsupported = append(unsupported, req)
+		}
+	}
+	return unsupported, nil
+}
+
+// requirements collects requirements by feature
+type requirements map[string]Version
+
+func (r *requirements) add(feature string, since Version) {
+	if *r == nil {
+		*r = make(requirements)
+	}
+	(*r)[feature] = since
+}
+
+func (r requirements) sorted() []Requirement {
+	reqs := make([]Requirement, 0, len(r))
+	for feature, since := range r {
+		reqs = append(reqs, Requirement{Feature: feature, Since: since})
+	}
+	sort.Slice(reqs, func(i, j int) bool {
+		return reqs[i].Feature < reqs[j].Feature
+	})
+	return reqs
+}
+
+func singBoxRequirements(data []byte, reqs *requirements) error {
+	type typed struct {
+		Type string `json:"type"`
+	}
+	var doc struct {
+		Inbounds  []typed `json:"inbounds"`
+		Outbounds []typed `json:"outbounds"`
+		Endpoints []typed `json:"endpoints"`
+		Route     struct {
+			RuleSet []json.RawMessage `json:"rule_set"`
+			Rules   []struct {
+				Action string `json:"action"`
+			} `json:"rules"`
+		} `json:"route"`
+		DNS struct {
+			Servers []typed `json:"servers"`
+		} `json:"dns"`
+	}
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return err
+	}
+
+	for kind, items := range map[string][]typed{"inbound": doc.Inbounds, "outbound": doc.Outbounds, "endpoint": doc.Endpoints} {
+		for _, item := range items {
+			if since, ok := singBoxTypes[item.Type]; ok {
+				reqs.add(fmt.Sprintf("%s %s", item.Type, kind), since)
+			}
+		}
+	}
+	if len(doc.Endpoints) > 0 {
+		reqs.add("endpoints", singBoxEndpoints)
+	}
+	if len(doc.Route.RuleSet) > 0 {
+		reqs.add("rule sets", singBoxRuleSets)
+	}
+	for _, rule := range doc.Route.Rules {
+		if rule.Action != "" {
+			reqs.add("rule actions", singBoxRuleActions)
+		}
+	}
+	for _, server := range doc.DNS.Servers {
+		if server.Type != "" {
+			reqs.add("typed DNS servers", singBoxDNSTypes)
+		}
+	}
+	return nil
+}
+
+func xrayRequirements(data []byte, reqs *requirements) error {
+	type proxy struct {
+		StreamSettings struct {
+			Network  string `json:"network"`
+			Security string `json:"security"`
+		} `json:"streamSettings"`
+	}
+	var doc struct {
+		Inbounds  []proxy `json:"inbounds"`
+		Outbounds []proxy `json:"outbounds"`
+	}
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return err
+	}
+
+	for _, item := range append(doc.Inbounds, doc.Outbounds...) {
+		for _, transport := range []string{item.StreamSettings.Network, item.StreamSettings.Security} {
+			if since, ok := xrayTransports[transport]; ok {
+				reqs.add(transport+" transport", since)
+			}
+		}
+	}
+	return nil
+}
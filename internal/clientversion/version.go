@@ -0,0 +1,102 @@
+// Package clientversion detects the versions of the installed client
+// binaries and finds the features a client config needs newer releases
+// for.
+package clientversion
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Runner runs a command and returns its stdout
+type Runner func(ctx context.Context, command []string) ([]byte, error)
+
+// versionPattern matches the first dotted version in version output
+var versionPattern = regexp.MustCompile(`(\d+)\.(\d+)(?:\.(\d+))?`)
+
+// Version is a client release version. Xray numbers its releases by date,
+// as in 24.9.30, which compare the same way.
+type Version struct {
+	Major int `json:"major"`
+	Minor int `json:"minor"`
+	Patch int `json:"patch"`
+}
+
+// Parse extracts the version from the version output of a client, such as
+// "sing-box version 1.10.1" or "Xray 24.12.31 (Xray, Penetrates Everything.)"
+func Parse(output string) (Version, error) {
+	match := versionPattern.FindStringSubmatch(output)
+	if match == nil {
+		return Version{}, fmt.Errorf("no version in %q", firstLine(output))
+	}
+	var v Version
+	v.Major, _ = strconv.Atoi(match[1])
+	v.Minor, _ = strconv.Atoi(match[2])
+	if match[3] != "" {
+		v.Patch, _ = strconv.Atoi(match[3])
+	}
+	return v, nil
+}
+
+// String formats the version as major.minor.patch
+func (v Version) String() string {
+	return fmt.Sprintf("%d.%d.%d", v.Major, v.Minor, v.Patch)
+}
+
+// Less reports whether v is an older release than other
+func (v Version) Less(other Version) bool {
+	if v.Major != other.Major {
+		return v.Major < other.Major
+	}
+	if v.Minor != other.Minor {
+		return v.Minor < other.Minor
+	}
+	return v.Patch < other.Patch
+}
+
+// versionArgs are the arguments printing the version of each client
+var versionArgs = map[string][]string{
+	"sing-box": {"version"},
+	"xray":     {"version"},
+	"clash":    {"-v"},
+	"hysteria": {"version"},
+}
+
+// Command returns the command printing the version of a client binary
+func Command(client, binary string) ([]string, error) {
+	args, ok := versionArgs[client]
+	if !ok {
+		return nil, fmt.Errorf("unknown client %q", client)
+	}
+	return append([]string{binary}, args...), nil
+}
+
+// Probe runs the version command of a client binary and parses its output
+func Probe(ctx context.Context, run Runner, client, binary string) (Version, error) {
+	command, err := Command(client, binary)
+	if err != nil {
+		return Version{}, err
+	}
+	output, err := run(ctx, command)
+	if err != nil {
+		return Version{}, fmt.Errorf("failed to query %s version: %w", client, err)
+	}
+	version, err := Parse(string(output))
+	if err != nil {
+		return Version{}, fmt.Errorf("failed to parse %s version: %w", client, err)
+	}
+	return version, nil
+}
+
+// firstLine returns the first non-empty line of output
+func firstLine(output string) string {
+	for _, line := range strings.Split(output, "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			return line
+		}
+	}
+	return ""
+}
@@ -0,0 +1,92 @@
+package clientversion
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		output string
+		want   Version
+	}{
+		{"sing-box version 1.10.1\n\nEnvironment: go1.23.1 linux/amd64\n", Version{1, 10, 1}},
+		{"Xray 24.12.31 (Xray, Penetrates Everything.) 6a6ae09 (go1.23.4 linux/amd64)\n", Version{24, 12, 31}},
+		{"Mihomo Meta v1.18.1 linux amd64 with go1.22.0\n", Version{1, 18, 1}},
+		{"Version:\tv2.5.0\nBuildDate:\t2024-06-30\n", Version{2, 5, 0}},
+		{"clash 1.2", Version{1, 2, 0}},
+	}
+	for _, tt := range tests {
+		version, err := Parse(tt.output)
+		require.NoError(t, err)
+		assert.Equal(t, tt.want, version)
+	}
+
+	_, err := Parse("\nunknown flag: version\n")
+	assert.EqualError(t, err, `no version in "unknown flag: version"`)
+
+	assert.True(t, Version{1, 9, 9}.Less(Version{1, 10, 0}))
+	assert.False(t, Version{24, 9, 30}.Less(Version{1, 8, 16}))
+	assert.Equal(t, "1.10.1", Version{1, 10, 1}.String())
+}
+
+func TestProbe(t *testing.T) {
+	var command []string
+	run := func(ctx context.Context, cmd []string) ([]byte, error) {
+		command = cmd
+		return []byte("Clash v1.18.0 linux amd64"), nil
+	}
+	version, err := Probe(context.Background(), run, "clash", "/usr/bin/clash")
+	require.NoError(t, err)
+	assert.Equal(t, Version{1, 18, 0}, version)
+	assert.Equal(t, []string{"/usr/bin/clash", "-v"}, command)
+
+	_, err = Probe(context.Background(), run, "v2ray", "v2ray")
+	assert.EqualError(t, err, `unknown client "v2ray"`)
+
+	_, err = Probe(context.Background(), func(ctx context.Context, cmd []string) ([]byte, error) {
+		return nil, errors.New("exit status 1")
+	}, "xray", "xray")
+	assert.EqualError(t, err, "failed to query xray version: exit status 1")
+}
+
+func TestRequirements(t *testing.T) {
+	config := []byte(`{
+		"inbounds": [{"type": "mixed"}, {"type": "tuic"}],
+		"outbounds": [{"type": "anytls"}, {"type": "direct"}],
+		"endpoints": [{"type": "wireguard"}],
+		"route": {"rule_set": [{"tag": "geoip-ru"}], "rules": [{"action": "sniff"}]}
+	}`)
+	reqs, err := Requirements("sing-box", config)
+	require.NoError(t, err)
+	assert.Equal(t, []Requirement{
+		{Feature: "anytls outbound", Since: Version{1, 12, 0}},
+		{Feature: "endpoints", Since: Version{1, 11, 0}},
+		{Feature: "rule actions", Since: Version{1, 11, 0}},
+		{Feature: "rule sets", Since: Version{1, 8, 0}},
+		{Feature: "tuic inbound", Since: Version{1, 2, 0}},
+		{Feature: "wireguard endpoint", Since: Version{1, 11, 0}},
+	}, reqs)
+
+	unsupported, err := Unsupported("sing-box", Version{1, 11, 4}, config)
+	require.NoError(t, err)
+	assert.Equal(t, []Requirement{{Feature: "anytls outbound", Since: Version{1, 12, 0}}}, unsupported)
+	assert.Equal(t, "anytls outbound requires 1.12.0", unsupported[0].String())
+
+	unsupported, err = Unsupported("xray", Version{1, 8, 4}, []byte(`{
+		"outbounds": [{"protocol": "vless", "streamSettings": {"network": "xhttp", "security": "reality"}}]
+	}`))
+	require.NoError(t, err)
+	assert.Equal(t, []Requirement{{Feature: "xhttp transport", Since: Version{24, 9, 30}}}, unsupported)
+
+	reqs, err = Requirements("clash", []byte("proxies: []"))
+	require.NoError(t, err)
+	assert.Empty(t, reqs)
+
+	_, err = Requirements("sing-box", []byte("{"))
+	assert.ErrorContains(t, err, "failed to parse sing-box config")
+}
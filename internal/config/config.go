@@ -1,92 +1,1050 @@
 package config
 
 import (
+	"context"
+	"crypto/ed25519"
+	"encoding/base64"
+	"errors"
 	"fmt"
+	"net"
+	"net/url"
 	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"sort"
+	"strings"
+	"time"
 
+	"github.com/go-viper/mapstructure/v2"
+	"github.com/kpblcaoo/sboxagent/internal/privilege"
+	"github.com/kpblcaoo/sboxagent/internal/schedule"
+	"github.com/kpblcaoo/sboxagent/internal/security"
 	"github.com/spf13/viper"
 )
 
+const (
+	// DropInDirName is the name of the drop-in directory next to agent.yaml
+	DropInDirName = "agent.d"
+)
+
 // Config represents the main configuration structure
 type Config struct {
-	Agent    AgentConfig    `mapstructure:"agent"`
-	Server   ServerConfig   `mapstructure:"server"`
-	Services ServicesConfig `mapstructure:"services"`
-	Clients  ClientsConfig  `mapstructure:"clients"`
-	Logging  LoggingConfig  `mapstructure:"logging"`
-	Security SecurityConfig `mapstructure:"security"`
+	Agent         AgentConfig         `mapstructure:"agent"`
+	Server        ServerConfig        `mapstructure:"server"`
+	Services      ServicesConfig      `mapstructure:"services"`
+	Clients       ClientsConfig       `mapstructure:"clients"`
+	Logging       LoggingConfig       `mapstructure:"logging"`
+	Security      SecurityConfig      `mapstructure:"security"`
+	Remote        RemoteConfig        `mapstructure:"remote"`
+	Import        ImportConfig        `mapstructure:"import"`
+	Standby       StandbyConfig       `mapstructure:"standby"`
+	Notifications NotificationsConfig `mapstructure:"notifications"`
+	Location      LocationConfig      `mapstructure:"location"`
+	Health        HealthConfig        `mapstructure:"health"`
+
+	// path is the config file used by Load
+	path string
+	// options are the options the config was loaded with, reused by Reload
+	options LoadOptions
 }
 
 // AgentConfig represents agent basic configuration
 type AgentConfig struct {
-	Name     string `mapstructure:"name"`
-	Version  string `mapstructure:"version"`
-	LogLevel string `mapstructure:"log_level"`
+	Name     string         `mapstructure:"name"`
+	Version  string         `mapstructure:"version"`
+	LogLevel string         `mapstructure:"log_level"`
+	Shutdown ShutdownConfig `mapstructure:"shutdown"`
+	// Profile names the sboxctl profile, available to command templates
+	Profile string `mapstructure:"profile"`
+	// HeartbeatInterval is how often heartbeats are sent to socket clients;
+	// zero disables them
+	HeartbeatInterval time.Duration `mapstructure:"heartbeat_interval"`
+	// StrictConfig rejects unknown configuration keys
+	StrictConfig bool `mapstructure:"strict_config"`
+	// ReapOrphans makes the agent a child subreaper that reaps orphaned
+	// descendants of the processes it runs
+	ReapOrphans bool `mapstructure:"reap_orphans"`
+	// Watchdog pings the systemd watchdog when the unit sets WatchdogSec=
+	Watchdog bool `mapstructure:"watchdog"`
+	// Unit is the systemd unit, or launchd property list on macOS, generated
+	// with -generate-unit
+	Unit UnitConfig `mapstructure:"unit"`
+}
+
+// UnitConfig describes the systemd unit of the agent and its hardening, or
+// its launchd property list on macOS
+type UnitConfig struct {
+	Description string `mapstructure:"description"`
+	// Label is the launchd label of the agent
+	Label string `mapstructure:"label"`
+	User  string `mapstructure:"user"`
+	Group string `mapstructure:"group"`
+	// ExecStart is the agent command line. Arguments may use {{.Binary}},
+	// {{.ConfigPath}} and {{.SocketPath}}.
+	ExecStart   []string      `mapstructure:"exec_start"`
+	Restart     string        `mapstructure:"restart"`
+	RestartSec  time.Duration `mapstructure:"restart_sec"`
+	WatchdogSec time.Duration `mapstructure:"watchdog_sec"`
+	// RuntimeDirectory is created under /run for the unit, e.g. for the socket
+	RuntimeDirectory string `mapstructure:"runtime_directory"`
+	// ProtectSystem is strict, full, true or false
+	ProtectSystem   string `mapstructure:"protect_system"`
+	ProtectHome     bool   `mapstructure:"protect_home"`
+	PrivateTmp      bool   `mapstructure:"private_tmp"`
+	NoNewPrivileges bool   `mapstructure:"no_new_privileges"`
+	// CapabilityBoundingSet limits the capabilities of the agent and the
+	// clients it starts, e.g. CAP_NET_ADMIN for TUN interfaces
+	CapabilityBoundingSet []string `mapstructure:"capability_bounding_set"`
+	AmbientCapabilities   []string `mapstructure:"ambient_capabilities"`
+	ReadWritePaths        []string `mapstructure:"read_write_paths"`
+	LimitNOFILE           int      `mapstructure:"limit_nofile"`
+	LimitNPROC            int      `mapstructure:"limit_nproc"`
+	// Extra holds additional Key=Value lines for the [Service] section
+	Extra []string `mapstructure:"extra"`
+}
+
+// ShutdownConfig represents graceful shutdown deadlines
+type ShutdownConfig struct {
+	// StopTimeout is the default deadline for stopping each service
+	StopTimeout time.Duration `mapstructure:"stop_timeout"`
+	// Services overrides StopTimeout per service name
+	Services map[string]time.Duration `mapstructure:"services"`
 }
 
 // ServerConfig represents HTTP server configuration
 type ServerConfig struct {
-	Port    int    `mapstructure:"port"`
-	Host    string `mapstructure:"host"`
-	Timeout string `mapstructure:"timeout"`
+	Enabled              bool          `mapstructure:"enabled"`
+	Port                 int           `mapstructure:"port"`
+	Host                 string        `mapstructure:"host"`
+	Timeout              time.Duration `mapstructure:"timeout"`
+	SlowRequestThreshold time.Duration `mapstructure:"slow_request_threshold"`
+	Tunnel               TunnelConfig  `mapstructure:"tunnel"`
+}
+
+// TunnelConfig represents the outbound management tunnel configuration
+type TunnelConfig struct {
+	Enabled              bool          `mapstructure:"enabled"`
+	URL                  string        `mapstructure:"url"`
+	Token                string        `mapstructure:"token"`
+	AgentID              string        `mapstructure:"agent_id"`
+	CAFile               string        `mapstructure:"ca_file"`
+	ReconnectInterval    time.Duration `mapstructure:"reconnect_interval"`
+	MaxReconnectInterval time.Duration `mapstructure:"max_reconnect_interval"`
+}
+
+// RemoteConfig represents the remote configuration source
+type RemoteConfig struct {
+	Enabled      bool          `mapstructure:"enabled"`
+	URL          string        `mapstructure:"url"`
+	PublicKey    string        `mapstructure:"public_key"`
+	PollInterval time.Duration `mapstructure:"poll_interval"`
+	Timeout      time.Duration `mapstructure:"timeout"`
+	CacheFile    string        `mapstructure:"cache_file"`
 }
 
 // ServicesConfig represents service management configuration
 type ServicesConfig struct {
-	Sboxctl SboxctlConfig `mapstructure:"sboxctl"`
+	Sboxctl     SboxctlConfig     `mapstructure:"sboxctl"`
+	CLI         CLIConfig         `mapstructure:"cli"`
+	Systemd     SystemdConfig     `mapstructure:"systemd"`
+	Supervisor  SupervisorConfig  `mapstructure:"supervisor"`
+	Monitoring  MonitorConfig     `mapstructure:"monitoring"`
+	Dispatcher  DispatcherConfig  `mapstructure:"dispatcher"`
+	Environment EnvironmentConfig `mapstructure:"environment"`
+	// RunHistory is the number of sboxctl and sboxmgr runs kept in memory
+	// for the get_runs socket command; zero disables the history
+	RunHistory int `mapstructure:"run_history"`
+	// Startup orders the start of the agent's services
+	Startup StartupConfig `mapstructure:"startup"`
+}
+
+// StartupSteps are the services the agent starts, in their default order
+var StartupSteps = []string{
+	"health", "notifier", "dispatcher", "journal", "sboxctl", "api",
+	"tunnel", "version-check", "upgrades", "unit-drift", "location",
+	"heartbeat", "reaper", "remote-config", "network-online",
+	"configs-validated", "clients", "unit-watch", "probes", "connectivity",
+	"imports",
+}
+
+// StartupConfig declares dependencies between the agent's services on top
+// of the built-in ones, under which clients start after the network is
+// online and their configs are validated
+type StartupConfig struct {
+	// Needs maps a step of StartupSteps to the steps that must have
+	// started before it
+	Needs map[string][]string `mapstructure:"needs"`
+	// NetworkTimeout bounds the wait of network-online for a non-loopback
+	// interface with an address; zero does not wait
+	NetworkTimeout time.Duration `mapstructure:"network_timeout"`
+}
+
+// CLIConfig represents the sboxmgr command line tool configuration
+type CLIConfig struct {
+	Enabled bool `mapstructure:"enabled"`
+	// Path is the sboxmgr executable, looked up in PATH if it has no slash
+	Path    string        `mapstructure:"path"`
+	Timeout time.Duration `mapstructure:"timeout"`
+	// MaxRetries is the number of retries after a failed run. The delay
+	// starts at RetryDelay and doubles per retry, with jitter, up to
+	// MaxRetryDelay.
+	MaxRetries    int           `mapstructure:"max_retries"`
+	RetryDelay    time.Duration `mapstructure:"retry_delay"`
+	MaxRetryDelay time.Duration `mapstructure:"max_retry_delay"`
+	// MaxConcurrent bounds the sboxmgr and helper commands (reload,
+	// systemctl, kill switch) running at once; further ones queue for up to
+	// QueueTimeout; zero disables the limit. Applies whether or not the CLI
+	// service is enabled.
+	MaxConcurrent int           `mapstructure:"max_concurrent"`
+	QueueTimeout  time.Duration `mapstructure:"queue_timeout"`
+	// Timeouts overrides the timeout of single actions (see CLIActions), so
+	// slow sboxmgr exports do not force a long timeout on everything else
+	Timeouts map[string]time.Duration `mapstructure:"timeouts"`
+	// Environment and working directory of sboxmgr runs
+	SubprocessConfig `mapstructure:",squash"`
+}
+
+// CLIActions are the actions whose timeout services.cli.timeouts overrides:
+// sboxmgr exports, client reloads, systemctl calls and kill switch commands
+var CLIActions = []string{"export", "reload", "systemctl", "kill_switch"}
+
+// ActionTimeout returns the timeout configured for an action, or fallback
+// if it has none
+func (c CLIConfig) ActionTimeout(action string, fallback time.Duration) time.Duration {
+	if timeout, ok := c.Timeouts[action]; ok && timeout > 0 {
+		return timeout
+	}
+	return fallback
+}
+
+// SystemdConfig represents systemd unit management configuration
+type SystemdConfig struct {
+	Enabled     bool   `mapstructure:"enabled"`
+	ServiceName string `mapstructure:"service_name"`
+	// UserMode manages a user unit (systemctl --user) instead of a system one
+	UserMode bool          `mapstructure:"user_mode"`
+	Timeout  time.Duration `mapstructure:"timeout"`
+	// Backend is dbus, systemctl or auto, which uses D-Bus when the bus is
+	// reachable and systemctl otherwise
+	Backend string `mapstructure:"backend"`
+	// InitSystem is systemd, openrc, runit, sysv, launchd, windows or auto,
+	// which detects the running one
+	InitSystem string `mapstructure:"init_system"`
+	// Drift compares the installed unit files with the ones the agent
+	// generates
+	Drift UnitDriftConfig `mapstructure:"drift"`
+}
+
+// UnitDriftConfig checks the agent unit and the units of the enabled
+// clients in UnitDir against the units generated from this config
+type UnitDriftConfig struct {
+	Enabled bool `mapstructure:"enabled"`
+	// Interval is how often units are checked; zero checks them on start only
+	Interval time.Duration `mapstructure:"interval"`
+	UnitDir  string        `mapstructure:"unit_dir"`
+	// AgentUnit is the unit file name of the agent, which -uninstall also
+	// removes; empty skips it
+	AgentUnit string `mapstructure:"agent_unit"`
+	// Clients also checks the units of the enabled clients
+	Clients bool `mapstructure:"clients"`
+}
+
+// Supervisor modes
+const (
+	SupervisorAuto = "auto"
+	SupervisorOn   = "on"
+	SupervisorOff  = "off"
+)
+
+// SupervisorConfig runs the enabled clients as children of the agent where
+// no service manager runs them, such as in containers
+type SupervisorConfig struct {
+	// Mode is on, off or auto, which supervises the clients when the agent
+	// runs in a container without a service manager
+	Mode string `mapstructure:"mode"`
+	// RestartDelay is the delay before a client is restarted; it doubles
+	// after each restart up to MaxRestartDelay and is reset once a client
+	// runs longer than MaxRestartDelay
+	RestartDelay    time.Duration `mapstructure:"restart_delay"`
+	MaxRestartDelay time.Duration `mapstructure:"max_restart_delay"`
+	// MaxRestarts is how many times a client may be restarted within
+	// RestartWindow before it is left failed; zero allows any number
+	MaxRestarts   int           `mapstructure:"max_restarts"`
+	RestartWindow time.Duration `mapstructure:"restart_window"`
+	// StopTimeout is how long a client has to exit after SIGTERM before it
+	// is killed
+	StopTimeout time.Duration `mapstructure:"stop_timeout"`
+	// FallbackConfig restores the previous config of a client given up on
+	// after max_restarts and starts it again, once until a new config is
+	// applied
+	FallbackConfig bool `mapstructure:"fallback_config"`
+}
+
+// MonitorConfig represents client process monitoring configuration
+type MonitorConfig struct {
+	Enabled  bool          `mapstructure:"enabled"`
+	Interval time.Duration `mapstructure:"interval"`
+	Timeout  time.Duration `mapstructure:"timeout"`
+	// FailureThreshold is the number of failed checks in a row before the
+	// client is reported unhealthy
+	FailureThreshold int `mapstructure:"failure_threshold"`
+	// Connectivity probes a URL through the clients end to end
+	Connectivity ConnectivityConfig `mapstructure:"connectivity"`
+}
+
+// ConnectivityConfig fetches a small URL through the client's proxy every
+// interval, keeping the success rate and latency of the last Window probes.
+// The check degrades when the success rate falls below MinSuccessRate
+// percent or the average latency exceeds MaxLatency, and is unhealthy when
+// every probe in the window failed.
+type ConnectivityConfig struct {
+	Enabled bool   `mapstructure:"enabled"`
+	URL     string `mapstructure:"url"`
+	// Proxy is the client inbound as socks5://host:port or http://host:port;
+	// empty fetches directly, for clients routing all traffic
+	Proxy          string        `mapstructure:"proxy"`
+	Interval       time.Duration `mapstructure:"interval"`
+	Timeout        time.Duration `mapstructure:"timeout"`
+	Window         int           `mapstructure:"window"`
+	MinSuccessRate float64       `mapstructure:"min_success_rate"`
+	MaxLatency     time.Duration `mapstructure:"max_latency"`
+}
+
+// maxServiceRetries bounds retry counts of services
+const maxServiceRetries = 10
+
+// maxConcurrentCommands bounds services.cli.max_concurrent
+const maxConcurrentCommands = 32
+
+// serviceEnv maps service keys to the environment variables overriding them
+var serviceEnv = map[string]string{
+	"services.cli.enabled":                  "SBOXAGENT_CLI_ENABLED",
+	"services.cli.path":                     "SBOXAGENT_CLI_PATH",
+	"services.cli.timeout":                  "SBOXAGENT_CLI_TIMEOUT",
+	"services.cli.max_retries":              "SBOXAGENT_CLI_MAX_RETRIES",
+	"services.cli.retry_delay":              "SBOXAGENT_CLI_RETRY_DELAY",
+	"services.cli.max_retry_delay":          "SBOXAGENT_CLI_MAX_RETRY_DELAY",
+	"services.cli.max_concurrent":           "SBOXAGENT_CLI_MAX_CONCURRENT",
+	"services.cli.queue_timeout":            "SBOXAGENT_CLI_QUEUE_TIMEOUT",
+	"services.systemd.enabled":              "SBOXAGENT_SYSTEMD_ENABLED",
+	"services.systemd.service_name":         "SBOXAGENT_SYSTEMD_SERVICE_NAME",
+	"services.systemd.user_mode":            "SBOXAGENT_SYSTEMD_USER_MODE",
+	"services.systemd.timeout":              "SBOXAGENT_SYSTEMD_TIMEOUT",
+	"services.systemd.backend":              "SBOXAGENT_SYSTEMD_BACKEND",
+	"services.systemd.init_system":          "SBOXAGENT_INIT_SYSTEM",
+	"services.supervisor.mode":              "SBOXAGENT_SUPERVISOR_MODE",
+	"services.monitoring.enabled":           "SBOXAGENT_MONITORING_ENABLED",
+	"services.monitoring.interval":          "SBOXAGENT_MONITORING_INTERVAL",
+	"services.monitoring.timeout":           "SBOXAGENT_MONITORING_TIMEOUT",
+	"services.monitoring.failure_threshold": "SBOXAGENT_MONITORING_FAILURE_THRESHOLD",
+}
+
+// DispatcherConfig represents event dispatcher configuration
+type DispatcherConfig struct {
+	// BufferSize is the number of events queued for handlers; events
+	// arriving while it is full are dropped
+	BufferSize int `mapstructure:"buffer_size"`
+}
+
+// EnvironmentConfig controls the environment of subprocesses such as sboxctl.
+// Only allowlisted variables are inherited from the agent so its secrets do
+// not leak into child processes.
+type EnvironmentConfig struct {
+	// InheritAll passes the full agent environment, disabling the allowlist
+	InheritAll bool `mapstructure:"inherit_all"`
+	// Allow lists inherited variable names; a trailing * matches a prefix
+	Allow []string `mapstructure:"allow"`
+	// Set holds KEY=value entries added to every subprocess environment
+	Set []string `mapstructure:"set"`
+}
+
+// Environ builds a subprocess environment from the agent environment base.
+// Allowlisted variables are kept, then injected and configured variables are
+// appended so they take precedence.
+func (e EnvironmentConfig) Environ(base []string, injected map[string]string) []string {
+	env := make([]string, 0, len(e.Allow)+len(injected)+len(e.Set))
+	for _, entry := range base {
+		name, _, _ := strings.Cut(entry, "=")
+		if e.InheritAll || e.allows(name) {
+			env = append(env, entry)
+		}
+	}
+
+	names := make([]string, 0, len(injected))
+	for name := range injected {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		env = append(env, name+"="+injected[name])
+	}
+
+	return append(env, e.Set...)
+}
+
+// allows reports whether an inherited variable is on the allowlist
+func (e EnvironmentConfig) allows(name string) bool {
+	for _, pattern := range e.Allow {
+		if prefix, ok := strings.CutSuffix(pattern, "*"); ok {
+			if strings.HasPrefix(name, prefix) {
+				return true
+			}
+		} else if name == pattern {
+			return true
+		}
+	}
+	return false
 }
 
 // SboxctlConfig represents sboxctl service configuration
 type SboxctlConfig struct {
 	Enabled       bool              `mapstructure:"enabled"`
 	Command       []string          `mapstructure:"command"`
-	Interval      string            `mapstructure:"interval"`
-	Timeout       string            `mapstructure:"timeout"`
+	Interval      time.Duration     `mapstructure:"interval"`
+	Timeout       time.Duration     `mapstructure:"timeout"`
 	StdoutCapture bool              `mapstructure:"stdout_capture"`
 	HealthCheck   HealthCheckConfig `mapstructure:"health_check"`
+	// Schedule is a cron expression such as "0 4 * * *" replacing the
+	// interval; runs are delayed by a random duration up to Splay
+	Schedule string        `mapstructure:"schedule"`
+	Splay    time.Duration `mapstructure:"splay"`
+	// EventBuffer is the number of sboxctl events queued for forwarding;
+	// events arriving while it is full are dropped
+	EventBuffer int `mapstructure:"event_buffer"`
+	// Parsers turn stdout lines into events, tried in order: json,
+	// key_value, traceback and text; empty uses all of them
+	Parsers []string `mapstructure:"parsers"`
+	// MaxLineBytes cuts longer stdout and stderr lines, which are logged
+	// with a truncation marker; zero uses the built-in default
+	MaxLineBytes int `mapstructure:"max_line_bytes"`
+	// MaxOutputBytes stops processing the stdout of a run after that many
+	// bytes; zero does not limit it
+	MaxOutputBytes int64 `mapstructure:"max_output_bytes"`
+	// Record persists the raw event stream of each run to files
+	Record EventRecordConfig `mapstructure:"record"`
+	// Interactive keeps sboxctl's stdin open so JSON commands can be sent
+	// to a running session; responses are read from stdout
+	Interactive bool `mapstructure:"interactive"`
+	// CircuitBreaker stops runs after repeated failures
+	CircuitBreaker CircuitBreakerConfig `mapstructure:"circuit_breaker"`
+	// Environment and working directory of sboxctl runs
+	SubprocessConfig `mapstructure:",squash"`
+	// Instances are further sboxctl services by name, for example one per
+	// subscription or client. Each inherits these settings and overrides
+	// the ones it sets; instances of instances are ignored.
+	Instances map[string]SboxctlConfig `mapstructure:"instances"`
+}
+
+// SubprocessConfig adjusts the subprocesses of one service on top of the
+// environment built from services.environment
+type SubprocessConfig struct {
+	// Env holds KEY=value entries added for this service only, such as
+	// HTTPS_PROXY or SBOXMGR_CONFIG
+	Env []string `mapstructure:"env"`
+	// WorkDir is the working directory; empty keeps the agent's
+	WorkDir string `mapstructure:"work_dir"`
+	// SearchPath replaces PATH, both in the environment and for finding
+	// the executable
+	SearchPath []string `mapstructure:"search_path"`
+	// User is a user name or uid to run as, so a privileged agent does not
+	// run the tooling as root; Group defaults to the user's primary group
+	User  string `mapstructure:"user"`
+	Group string `mapstructure:"group"`
+	// Limits bound the resources of each run
+	Limits ResourceLimits `mapstructure:"limits"`
+}
+
+// ResourceLimits are per-process limits of a service's subprocesses; zero
+// leaves a limit as inherited from the agent
+type ResourceLimits struct {
+	// CPUTime is the processor time after which a run is killed
+	CPUTime time.Duration `mapstructure:"cpu_time"`
+	// MemoryMB is the address space size in megabytes
+	MemoryMB int `mapstructure:"memory_mb"`
+	// OpenFiles is the number of file descriptors
+	OpenFiles int `mapstructure:"open_files"`
+}
+
+// Environ returns base with the service variables and search path
+// appended, so they take precedence over inherited ones
+func (s SubprocessConfig) Environ(base []string) []string {
+	env := make([]string, 0, len(base)+len(s.Env)+1)
+	env = append(env, base...)
+	env = append(env, s.Env...)
+	if len(s.SearchPath) > 0 {
+		env = append(env, "PATH="+strings.Join(s.SearchPath, string(os.PathListSeparator)))
+	}
+	return env
+}
+
+// validate checks the entries and paths of a service's subprocess settings
+func (s SubprocessConfig) validate(service string) error {
+	for _, entry := range s.Env {
+		if !strings.Contains(entry, "=") || strings.HasPrefix(entry, "=") {
+			return fmt.Errorf("invalid %s env entry %q: expected KEY=value", service, entry)
+		}
+	}
+	if s.WorkDir != "" && !filepath.IsAbs(s.WorkDir) {
+		return fmt.Errorf("%s work_dir must be an absolute path", service)
+	}
+	for _, dir := range s.SearchPath {
+		if !filepath.IsAbs(dir) {
+			return fmt.Errorf("%s search_path entry %q must be an absolute path", service, dir)
+		}
+	}
+	if s.Group != "" && s.User == "" {
+		return fmt.Errorf("%s group requires a user", service)
+	}
+	if s.Limits.CPUTime < 0 || s.Limits.MemoryMB < 0 || s.Limits.OpenFiles < 0 {
+		return fmt.Errorf("%s limits must not be negative", service)
+	}
+	return nil
+}
+
+// EventRecordConfig controls recording of raw sboxctl events, one NDJSON
+// file per run, for offline analysis and replay
+type EventRecordConfig struct {
+	Enabled bool   `mapstructure:"enabled"`
+	Dir     string `mapstructure:"dir"`
+	// MaxFiles is the number of run files kept; older ones are removed.
+	// Zero keeps all files.
+	MaxFiles int `mapstructure:"max_files"`
+}
+
+// CircuitBreakerConfig opens a circuit after Threshold consecutive failed
+// runs. No runs are made while it is open; after Cooldown ProbeCommand, if
+// set, must succeed before runs resume.
+type CircuitBreakerConfig struct {
+	// Threshold of consecutive failures; zero disables the breaker
+	Threshold    int           `mapstructure:"threshold"`
+	Cooldown     time.Duration `mapstructure:"cooldown"`
+	ProbeCommand []string      `mapstructure:"probe_command"`
 }
 
 // HealthCheckConfig represents health check configuration
 type HealthCheckConfig struct {
-	Enabled  bool   `mapstructure:"enabled"`
-	Interval string `mapstructure:"interval"`
-	Timeout  string `mapstructure:"timeout"`
+	Enabled  bool          `mapstructure:"enabled"`
+	Interval time.Duration `mapstructure:"interval"`
+	Timeout  time.Duration `mapstructure:"timeout"`
 }
 
 // ClientsConfig represents VPN client configuration
 type ClientsConfig struct {
-	SingBox SingBoxConfig `mapstructure:"sing-box"`
-	Xray    XrayConfig    `mapstructure:"xray"`
-	Clash   ClashConfig   `mapstructure:"clash"`
+	SingBox  SingBoxConfig  `mapstructure:"sing-box"`
+	Xray     XrayConfig     `mapstructure:"xray"`
+	Clash    ClashConfig    `mapstructure:"clash"`
 	Hysteria HysteriaConfig `mapstructure:"hysteria"`
+	// KillSwitch blocks traffic while clients are stopped on demand
+	KillSwitch KillSwitchConfig `mapstructure:"kill_switch"`
+	// VersionCheck probes the installed client binaries for their versions
+	VersionCheck VersionCheckConfig `mapstructure:"version_check"`
+	// Upgrade installs official client releases on demand or on a schedule
+	Upgrade UpgradeConfig `mapstructure:"upgrade"`
+}
+
+// VersionCheckConfig controls probing the versions of the client binaries
+// at startup and every Interval; a zero Interval probes at startup only
+type VersionCheckConfig struct {
+	Enabled  bool          `mapstructure:"enabled"`
+	Interval time.Duration `mapstructure:"interval"`
+	Timeout  time.Duration `mapstructure:"timeout"`
+}
+
+// UpgradeConfig controls downloading and installing official client
+// releases to the clients' binary_path. Versions pins a version per client,
+// the latest release is installed otherwise; a zero Schedule upgrades on
+// demand only.
+type UpgradeConfig struct {
+	Enabled  bool              `mapstructure:"enabled"`
+	APIURL   string            `mapstructure:"api_url"`
+	Versions map[string]string `mapstructure:"versions"`
+	Schedule time.Duration     `mapstructure:"schedule"`
+	// Restart restarts a running client after its binary is replaced
+	Restart bool          `mapstructure:"restart"`
+	Timeout time.Duration `mapstructure:"timeout"`
+	// PublicKey, when set, is the base64 ed25519 key release archives must
+	// carry a detached signature of
+	PublicKey       string `mapstructure:"public_key"`
+	RequireChecksum bool   `mapstructure:"require_checksum"`
+}
+
+// Key decodes the release signing key; nil when none is configured
+func (c UpgradeConfig) Key() (ed25519.PublicKey, error) {
+	if c.PublicKey == "" {
+		return nil, nil
+	}
+	key, err := base64.StdEncoding.DecodeString(c.PublicKey)
+	if err != nil || len(key) != ed25519.PublicKeySize {
+		return nil, fmt.Errorf("client upgrade public key must be a base64 ed25519 public key")
+	}
+	return ed25519.PublicKey(key), nil
+}
+
+// KillSwitchConfig holds the commands that block traffic outside the VPN
+// while clients are stopped and lift the block when they start again
+type KillSwitchConfig struct {
+	Enabled        bool     `mapstructure:"enabled"`
+	Command        []string `mapstructure:"command"`
+	ReleaseCommand []string `mapstructure:"release_command"`
+}
+
+// Restart policies for managed clients
+const (
+	RestartNever     = "never"
+	RestartOnFailure = "on-failure"
+	RestartAlways    = "always"
+)
+
+// ClientOverrides holds per-client knobs that override the global behavior
+// of the importer and client lifecycle management
+type ClientOverrides struct {
+	// ExtraArgs are appended to the client command line
+	ExtraArgs []string `mapstructure:"extra_args"`
+	// Env holds KEY=value entries added to the client process environment.
+	// It is a list because config map keys are case-insensitive.
+	Env []string `mapstructure:"env"`
+	// RestartPolicy is one of never, on-failure or always
+	RestartPolicy string `mapstructure:"restart_policy"`
+	// TemplateVars are passed to sboxmgr as --var name=value when it exports
+	// the client's config, for its config templates; names are lowercased
+	TemplateVars map[string]string `mapstructure:"template_vars"`
+	// Unit is the systemd unit running the client; it defaults to the
+	// client name
+	Unit string `mapstructure:"unit"`
+	// HealthCheck is a command checking a supervised client, run as
+	// services.monitoring configures; the client is restarted once it
+	// fails failure_threshold checks in a row
+	HealthCheck []string `mapstructure:"health_check"`
+}
+
+// Args returns base with the extra arguments appended
+func (o ClientOverrides) Args(base []string) []string {
+	args := make([]string, 0, len(base)+len(o.ExtraArgs))
+	args = append(args, base...)
+	return append(args, o.ExtraArgs...)
+}
+
+// Environ returns base with the override variables appended, so they take
+// precedence over inherited ones
+func (o ClientOverrides) Environ(base []string) []string {
+	env := make([]string, 0, len(base)+len(o.Env))
+	env = append(env, base...)
+	return append(env, o.Env...)
+}
+
+// ClientNames are the config keys of the supported clients
+var ClientNames = []string{"sing-box", "xray", "clash", "hysteria"}
+
+// Enabled reports whether a client is enabled by its config key
+func (c ClientsConfig) Enabled(name string) bool {
+	switch name {
+	case "sing-box":
+		return c.SingBox.Enabled
+	case "xray":
+		return c.Xray.Enabled
+	case "clash":
+		return c.Clash.Enabled
+	case "hysteria":
+		return c.Hysteria.Enabled
+	}
+	return false
+}
+
+// Unit returns the systemd unit of a client by its config key
+func (c ClientsConfig) Unit(name string) (string, bool) {
+	overrides, ok := c.Overrides(name)
+	if !ok {
+		return "", false
+	}
+	if overrides.Unit != "" {
+		return overrides.Unit, true
+	}
+	return name, true
+}
+
+// Overrides returns the override knobs of a client by its config key
+func (c ClientsConfig) Overrides(name string) (ClientOverrides, bool) {
+	switch name {
+	case "sing-box":
+		return c.SingBox.ClientOverrides, true
+	case "xray":
+		return c.Xray.ClientOverrides, true
+	case "clash":
+		return c.Clash.ClientOverrides, true
+	case "hysteria":
+		return c.Hysteria.ClientOverrides, true
+	}
+	return ClientOverrides{}, false
+}
+
+// clientArgs are the arguments that run a client in the foreground with
+// its config file, by config key
+var clientArgs = map[string][]string{
+	"sing-box": {"run", "-c"},
+	"xray":     {"run", "-c"},
+	"clash":    {"-f"},
+	"hysteria": {"client", "-c"},
+}
+
+// clientCheckArgs are the arguments making a client check a config file
+// without running it, followed by the config path. Hysteria has no checker.
+var clientCheckArgs = map[string][]string{
+	"sing-box": {"check", "-c"},
+	"xray":     {"run", "-test", "-c"},
+	"clash":    {"-t", "-f"},
+}
+
+// CheckCommand returns the command line making a client check the config
+// at path, or false for clients without a config checker
+func (c ClientsConfig) CheckCommand(name, path string) ([]string, bool) {
+	args, ok := clientCheckArgs[name]
+	if !ok {
+		return nil, false
+	}
+	binary, _ := c.BinaryPath(name)
+	if binary == "" {
+		binary = name
+	}
+	return append(append([]string{binary}, args...), path), true
+}
+
+// Command returns the command line running a client in the foreground by
+// its config key: the binary, falling back to the client name, the client's
+// arguments with its config path, and the extra arguments
+func (c ClientsConfig) Command(name string) ([]string, bool) {
+	binary, ok := c.BinaryPath(name)
+	if !ok {
+		return nil, false
+	}
+	if binary == "" {
+		binary = name
+	}
+	configPath, _ := c.ConfigPath(name)
+	overrides, _ := c.Overrides(name)
+	base := append([]string{binary}, clientArgs[name]...)
+	return overrides.Args(append(base, configPath)), true
+}
+
+// ConfigPath returns the config file path of a client by its config key
+func (c ClientsConfig) ConfigPath(name string) (string, bool) {
+	switch name {
+	case "sing-box":
+		return c.SingBox.ConfigPath, true
+	case "xray":
+		return c.Xray.ConfigPath, true
+	case "clash":
+		return c.Clash.ConfigPath, true
+	case "hysteria":
+		return c.Hysteria.ConfigPath, true
+	}
+	return "", false
+}
+
+// BinaryPath returns the binary path of a client by its config key
+func (c ClientsConfig) BinaryPath(name string) (string, bool) {
+	switch name {
+	case "sing-box":
+		return c.SingBox.BinaryPath, true
+	case "xray":
+		return c.Xray.BinaryPath, true
+	case "clash":
+		return c.Clash.BinaryPath, true
+	case "hysteria":
+		return c.Hysteria.BinaryPath, true
+	}
+	return "", false
 }
 
 // SingBoxConfig represents sing-box client configuration
 type SingBoxConfig struct {
-	Enabled    bool   `mapstructure:"enabled"`
-	BinaryPath string `mapstructure:"binary_path"`
-	ConfigPath string `mapstructure:"config_path"`
+	Enabled         bool   `mapstructure:"enabled"`
+	BinaryPath      string `mapstructure:"binary_path"`
+	ConfigPath      string `mapstructure:"config_path"`
+	ClientOverrides `mapstructure:",squash"`
 }
 
 // XrayConfig represents xray client configuration
 type XrayConfig struct {
-	Enabled    bool   `mapstructure:"enabled"`
-	BinaryPath string `mapstructure:"binary_path"`
-	ConfigPath string `mapstructure:"config_path"`
+	Enabled         bool   `mapstructure:"enabled"`
+	BinaryPath      string `mapstructure:"binary_path"`
+	ConfigPath      string `mapstructure:"config_path"`
+	ClientOverrides `mapstructure:",squash"`
 }
 
 // ClashConfig represents clash client configuration
 type ClashConfig struct {
-	Enabled    bool   `mapstructure:"enabled"`
-	BinaryPath string `mapstructure:"binary_path"`
-	ConfigPath string `mapstructure:"config_path"`
+	Enabled         bool   `mapstructure:"enabled"`
+	BinaryPath      string `mapstructure:"binary_path"`
+	ConfigPath      string `mapstructure:"config_path"`
+	ClientOverrides `mapstructure:",squash"`
 }
 
 // HysteriaConfig represents hysteria client configuration
 type HysteriaConfig struct {
-	Enabled    bool   `mapstructure:"enabled"`
-	BinaryPath string `mapstructure:"binary_path"`
-	ConfigPath string `mapstructure:"config_path"`
+	Enabled         bool   `mapstructure:"enabled"`
+	BinaryPath      string `mapstructure:"binary_path"`
+	ConfigPath      string `mapstructure:"config_path"`
+	ClientOverrides `mapstructure:",squash"`
+}
+
+// ImportConfig represents the scheduled import of client configs generated by
+// sboxmgr from a subscription
+type ImportConfig struct {
+	Enabled         bool          `mapstructure:"enabled"`
+	SubscriptionURL string        `mapstructure:"subscription_url"`
+	ClientType      string        `mapstructure:"client_type"`
+	Schedule        time.Duration `mapstructure:"schedule"`
+	// Timeout bounds each sboxmgr attempt
+	Timeout time.Duration `mapstructure:"timeout"`
+	// Clients applies the subscription to several clients at once, all or
+	// none of them; empty imports for ClientType only
+	Clients []string `mapstructure:"clients"`
+	// Retries is the number of times a failed sboxmgr run is retried. The
+	// delay starts at RetryDelay and doubles per retry, with jitter, up to
+	// MaxRetryDelay.
+	Retries       int           `mapstructure:"retries"`
+	RetryDelay    time.Duration `mapstructure:"retry_delay"`
+	MaxRetryDelay time.Duration `mapstructure:"max_retry_delay"`
+	// RetryExitCodes are sboxmgr exit codes retried in addition to
+	// timeouts, network errors and the standard temporary failure codes
+	RetryExitCodes []int `mapstructure:"retry_exit_codes"`
+	// Command runs sboxmgr; the subscription and client are appended
+	Command []string `mapstructure:"command"`
+	// Options are passed to sboxmgr as --key=value
+	Options map[string]string `mapstructure:"options"`
+	// ReloadCommand runs after a new config of the import client was saved,
+	// if set
+	ReloadCommand []string `mapstructure:"reload_command"`
+	// HotReload reloads the unit of a client without a reload command after
+	// its new config was saved, restarting clients that cannot reload
+	HotReload bool `mapstructure:"hot_reload"`
+	// VerifyCommand runs after a reload to check the client works; if it
+	// fails the previous config is restored
+	VerifyCommand []string `mapstructure:"verify_command"`
+	// Sources replace SubscriptionURL with several subscriptions whose
+	// servers are merged into one client config
+	Sources []ImportSource `mapstructure:"sources"`
+	// Backups limits the backups kept of replaced client configs
+	Backups BackupConfig `mapstructure:"backups"`
+	// CheckPorts refuses configs whose inbound ports are taken by a process
+	// other than the client
+	CheckPorts bool `mapstructure:"check_ports"`
+	// CheckConfig refuses configs the client's own checker rejects, such
+	// as sing-box check or xray -test
+	CheckConfig bool `mapstructure:"check_config"`
+	// Secrets maps names to secret references. Imported configs refer to
+	// them as "!secret:NAME" and get the values when they are written.
+	Secrets map[string]string `mapstructure:"secrets"`
+	// Session sends sboxmgr runs to one long-lived sboxmgr process
+	Session SboxmgrSessionConfig `mapstructure:"session"`
+}
+
+// SboxmgrSessionConfig keeps one sboxmgr process serving runs over its
+// stdin and stdout instead of starting sboxmgr for each run
+type SboxmgrSessionConfig struct {
+	Enabled bool `mapstructure:"enabled"`
+	// Command starts the serving process
+	Command []string `mapstructure:"command"`
+	// RespawnDelay is the least time between starts of the process, so a
+	// process that keeps crashing is not restarted in a tight loop
+	RespawnDelay time.Duration `mapstructure:"respawn_delay"`
+}
+
+// BackupConfig is the retention policy for client config backups. Zero
+// disables a limit.
+type BackupConfig struct {
+	MaxCount int           `mapstructure:"max_count"`
+	MaxAge   time.Duration `mapstructure:"max_age"`
+}
+
+// ImportSource is one subscription merged into an imported client config.
+// When sources define servers with the same name, the one with the highest
+// priority is kept.
+type ImportSource struct {
+	Name     string `mapstructure:"name"`
+	URL      string `mapstructure:"url"`
+	Priority int    `mapstructure:"priority"`
+	// Include and Exclude are glob patterns matched against server names;
+	// an empty Include keeps every server that is not excluded
+	Include []string `mapstructure:"include"`
+	Exclude []string `mapstructure:"exclude"`
+}
+
+// LocationConfig switches between profiles by the network the host is on
+type LocationConfig struct {
+	Enabled  bool          `mapstructure:"enabled"`
+	Interval time.Duration `mapstructure:"interval"`
+	// DefaultProfile applies when no rule matches; empty keeps the current
+	// profile
+	DefaultProfile string `mapstructure:"default_profile"`
+	// Rules are checked in order and the first match selects its profile
+	Rules []LocationRule `mapstructure:"rules"`
+}
+
+// LocationRule selects a profile on matching networks. Every criterion set
+// must match; within a criterion any listed value does.
+type LocationRule struct {
+	Profile string   `mapstructure:"profile"`
+	SSIDs   []string `mapstructure:"ssids"`
+	// Subnets match addresses of the host's interfaces, in CIDR notation
+	Subnets     []string `mapstructure:"subnets"`
+	GatewayMACs []string `mapstructure:"gateway_macs"`
+}
+
+// HealthConfig configures the agent's health checks. Their reports feed
+// the systemd watchdog, the API's /readyz, the status line and alerts.
+type HealthConfig struct {
+	// Interval is how often the health checks run, 30s when zero; the
+	// systemd watchdog shortens it to half its timeout
+	Interval time.Duration `mapstructure:"interval"`
+	// Exec are operator-provided checks run as commands
+	Exec []ExecCheckConfig `mapstructure:"exec"`
+	// Endpoints are proxy inbounds checked to accept connections
+	Endpoints []EndpointCheckConfig `mapstructure:"endpoints"`
+	// DNS are test domains resolved through the clients' DNS
+	DNS []DNSCheckConfig `mapstructure:"dns"`
+	// Disk watches the filesystems the agent writes to
+	Disk DiskCheckConfig `mapstructure:"disk"`
+	// Certificates watches the expiry of the TLS certificates in use
+	Certificates CertificateCheckConfig `mapstructure:"certificates"`
+	// Trends project resource usage towards its limits
+	Trends TrendsConfig `mapstructure:"trends"`
+}
+
+// TrendsConfig fits a line through the last Window samples of the agent's
+// heap, the event error rate and the free space of DiskPath, by default
+// the data directory. A limit projected to be crossed within Horizon
+// degrades its check, a crossed limit is unhealthy. A zero limit disables
+// its check.
+type TrendsConfig struct {
+	Enabled          bool          `mapstructure:"enabled"`
+	Window           int           `mapstructure:"window"`
+	Horizon          time.Duration `mapstructure:"horizon"`
+	MemoryLimitMB    int           `mapstructure:"memory_limit_mb"`
+	ErrorRatePercent float64       `mapstructure:"error_rate_percent"`
+	DiskPath         string        `mapstructure:"disk_path"`
+	DiskMinFreeMB    int           `mapstructure:"disk_min_free_mb"`
+}
+
+// CertificateCheckConfig checks the expiry of the API's TLS certificate
+// when security.tls_enabled is set, the certificates referenced by the
+// enabled clients' configs and Paths. A certificate expiring within
+// Warning degrades the check, within Critical or expired it is unhealthy;
+// crossing either raises a CERTIFICATE_EXPIRING alert.
+type CertificateCheckConfig struct {
+	Enabled  bool          `mapstructure:"enabled"`
+	Paths    []string      `mapstructure:"paths"`
+	Warning  time.Duration `mapstructure:"warning"`
+	Critical time.Duration `mapstructure:"critical"`
+}
+
+// DiskCheckConfig checks the space and inode usage of the filesystems
+// holding the agent's config, data and spool directories, client configs
+// with their backups, the audit log and Paths. Usage at WarningPercent
+// degrades the check, at CriticalPercent it is unhealthy.
+type DiskCheckConfig struct {
+	Enabled         bool     `mapstructure:"enabled"`
+	Paths           []string `mapstructure:"paths"`
+	WarningPercent  float64  `mapstructure:"warning_percent"`
+	CriticalPercent float64  `mapstructure:"critical_percent"`
+}
+
+// ExecCheckConfig runs a command as a health check. Exit code 0 is healthy,
+// 1 degraded and 2, any other code, a timeout or a failure to run the
+// command unhealthy. The first line of output becomes the message.
+type ExecCheckConfig struct {
+	Name    string   `mapstructure:"name"`
+	Command []string `mapstructure:"command"`
+	// Timeout bounds a run; zero leaves it to the health check round
+	Timeout time.Duration `mapstructure:"timeout"`
+}
+
+// Endpoint check kinds
+const (
+	EndpointTCP    = "tcp"
+	EndpointSOCKS5 = "socks5"
+	EndpointHTTP   = "http"
+)
+
+// EndpointCheckConfig checks a client inbound. A tcp endpoint has to accept
+// connections, socks5 and http endpoints also have to answer as proxies. A
+// URL is fetched through socks5 and http endpoints; failing to fetch it
+// degrades the check.
+type EndpointCheckConfig struct {
+	Name    string        `mapstructure:"name"`
+	Kind    string        `mapstructure:"kind"`
+	Address string        `mapstructure:"address"`
+	URL     string        `mapstructure:"url"`
+	Timeout time.Duration `mapstructure:"timeout"`
+}
+
+// DNSCheckConfig resolves a test domain. Server is the client's DNS
+// address, queried over TCP through the SOCKS5 inbound at Proxy when set;
+// without a server the system resolver is used. Timeouts and NXDOMAIN are
+// unhealthy. Answers outside Expect, addresses or CIDR networks, or private
+// and reserved addresses when Expect is empty, count as poisoned and
+// degrade the check.
+type DNSCheckConfig struct {
+	Name    string        `mapstructure:"name"`
+	Domain  string        `mapstructure:"domain"`
+	Server  string        `mapstructure:"server"`
+	Proxy   string        `mapstructure:"proxy"`
+	Expect  []string      `mapstructure:"expect"`
+	Timeout time.Duration `mapstructure:"timeout"`
+}
+
+// StandbyConfig pairs agents as active and passive. The agent holding the
+// lease in LeaseFile runs sboxctl and scheduled imports; the other takes over
+// when the lease is not renewed within LeaseTTL.
+type StandbyConfig struct {
+	Enabled bool `mapstructure:"enabled"`
+	// LeaseFile must be on storage both agents share
+	LeaseFile     string        `mapstructure:"lease_file"`
+	LeaseTTL      time.Duration `mapstructure:"lease_ttl"`
+	RenewInterval time.Duration `mapstructure:"renew_interval"`
+	// NodeID identifies this agent in the lease; defaults to agent.name
+	NodeID string `mapstructure:"node_id"`
+}
+
+// NotificationsConfig represents outbound notifications of agent events.
+// Messages are spooled on disk and retried until delivered or expired.
+type NotificationsConfig struct {
+	Enabled bool `mapstructure:"enabled"`
+	// Events lists the agent event types that are sent, such as IMPORT_FAILED
+	Events           []string       `mapstructure:"events"`
+	SpoolDir         string         `mapstructure:"spool_dir"`
+	RetryInterval    time.Duration  `mapstructure:"retry_interval"`
+	MaxRetryInterval time.Duration  `mapstructure:"max_retry_interval"`
+	Expiry           time.Duration  `mapstructure:"expiry"`
+	Webhook          WebhookConfig  `mapstructure:"webhook"`
+	Telegram         TelegramConfig `mapstructure:"telegram"`
+	Email            EmailConfig    `mapstructure:"email"`
+}
+
+// WebhookConfig sends notifications as JSON POST requests
+type WebhookConfig struct {
+	Enabled bool   `mapstructure:"enabled"`
+	URL     string `mapstructure:"url"`
+}
+
+// TelegramConfig sends notifications through a Telegram bot
+type TelegramConfig struct {
+	Enabled  bool   `mapstructure:"enabled"`
+	BotToken string `mapstructure:"bot_token"`
+	ChatID   string `mapstructure:"chat_id"`
+}
+
+// EmailConfig sends notifications by SMTP
+type EmailConfig struct {
+	Enabled  bool     `mapstructure:"enabled"`
+	SMTPAddr string   `mapstructure:"smtp_addr"`
+	From     string   `mapstructure:"from"`
+	To       []string `mapstructure:"to"`
+	Username string   `mapstructure:"username"`
+	Password string   `mapstructure:"password"`
 }
 
 // LoggingConfig represents logging configuration
@@ -95,20 +1053,107 @@ type LoggingConfig struct {
 	Aggregation   bool `mapstructure:"aggregation"`
 	RetentionDays int  `mapstructure:"retention_days"`
 	MaxEntries    int  `mapstructure:"max_entries"`
+	// Audit records spawned commands and socket admin actions
+	Audit AuditConfig `mapstructure:"audit"`
+	// Journal follows the systemd journal of the client units
+	Journal JournalConfig `mapstructure:"journal"`
+}
+
+// JournalConfig controls reading client logs from the systemd journal.
+// Entries go to the log aggregator as source "journal/<unit>" and to the
+// event dispatcher; errors are raised as CLIENT_LOG_ERROR events. The user
+// journal is read when services.systemd.user_mode is set.
+type JournalConfig struct {
+	Enabled bool `mapstructure:"enabled"`
+	// Units are the followed units; names without a type are services
+	Units []string `mapstructure:"units"`
+	// RestartDelay is how long to wait before starting journalctl again
+	// after it exits
+	RestartDelay time.Duration `mapstructure:"restart_delay"`
+}
+
+// AuditConfig controls the audit log of every external command the agent
+// spawns and every command received over the socket. Entries go to the log
+// aggregator as source "audit" and, if File is set, are appended to it as
+// JSON lines.
+type AuditConfig struct {
+	Enabled bool   `mapstructure:"enabled"`
+	File    string `mapstructure:"file"`
 }
 
 // SecurityConfig represents security configuration
 type SecurityConfig struct {
-	AllowRemoteAPI bool     `mapstructure:"allow_remote_api"`
-	APIToken       string   `mapstructure:"api_token"`
-	AllowedHosts   []string `mapstructure:"allowed_hosts"`
-	TLSEnabled     bool     `mapstructure:"tls_enabled"`
-	TLSCertFile    string   `mapstructure:"tls_cert_file"`
-	TLSKeyFile     string   `mapstructure:"tls_key_file"`
+	AllowRemoteAPI bool       `mapstructure:"allow_remote_api"`
+	APIToken       string     `mapstructure:"api_token"`
+	AllowedHosts   []string   `mapstructure:"allowed_hosts"`
+	DeniedHosts    []string   `mapstructure:"denied_hosts"`
+	TLSEnabled     bool       `mapstructure:"tls_enabled"`
+	TLSCertFile    string     `mapstructure:"tls_cert_file"`
+	TLSKeyFile     string     `mapstructure:"tls_key_file"`
+	Auth           AuthConfig `mapstructure:"auth"`
+	// Privileges reduces what the agent may do once it has started
+	Privileges PrivilegesConfig `mapstructure:"privileges"`
+}
+
+// PrivilegesConfig drops the agent's privileges after the socket and API
+// are bound: DropCapabilities keeps only KeepCapabilities, and User, with
+// Group or the user's primary group, switches to a service account
+type PrivilegesConfig struct {
+	DropCapabilities bool     `mapstructure:"drop_capabilities"`
+	KeepCapabilities []string `mapstructure:"keep_capabilities"`
+	User             string   `mapstructure:"user"`
+	Group            string   `mapstructure:"group"`
+}
+
+// Enabled tells whether privileges are reduced at all
+func (p PrivilegesConfig) Enabled() bool {
+	return p.DropCapabilities || p.User != ""
+}
+
+// AuthConfig represents API authentication provider configuration
+type AuthConfig struct {
+	Tokens    []NamedToken `mapstructure:"tokens"`
+	TokenFile string       `mapstructure:"token_file"`
+	OIDC      OIDCConfig   `mapstructure:"oidc"`
 }
 
+// NamedToken represents a static API token with a caller name
+type NamedToken struct {
+	Name  string `mapstructure:"name"`
+	Token string `mapstructure:"token"`
+}
+
+// OIDCConfig represents OIDC bearer token validation configuration
+type OIDCConfig struct {
+	Enabled         bool          `mapstructure:"enabled"`
+	Issuer          string        `mapstructure:"issuer"`
+	Audience        string        `mapstructure:"audience"`
+	JWKSURL         string        `mapstructure:"jwks_url"`
+	RefreshInterval time.Duration `mapstructure:"refresh_interval"`
+}
+
+// LoadOptions controls how configuration is loaded
+type LoadOptions struct {
+	// Strict rejects unknown keys, as does agent.strict_config in the file
+	Strict bool
+	// Profile selects an entry of the profiles section to merge over the
+	// base config; empty falls back to the ProfileEnv variable
+	Profile string
+	// FetchRemote refreshes the remote config cache before merging it; a
+	// failed fetch falls back to the cached document
+	FetchRemote bool
+}
+
+// ProfileEnv names the environment variable selecting a profile
+const ProfileEnv = "SBOXAGENT_PROFILE"
+
 // Load loads configuration from file or creates default
 func Load(configPath string) (*Config, error) {
+	return LoadWithOptions(configPath, LoadOptions{})
+}
+
+// LoadWithOptions loads configuration from file or creates default
+func LoadWithOptions(configPath string, opts LoadOptions) (*Config, error) {
 	v := viper.New()
 
 	// Set default values
@@ -125,7 +1170,7 @@ func Load(configPath string) (*Config, error) {
 		v.SetConfigName("agent")
 		v.SetConfigType("yaml")
 		v.AddConfigPath(".")
-		v.AddConfigPath("/etc/sboxagent")
+		v.AddConfigPath(DefaultConfigDir)
 		v.AddConfigPath("$HOME/.sboxagent")
 
 		if err := v.ReadInConfig(); err != nil {
@@ -133,19 +1178,91 @@ func Load(configPath string) (*Config, error) {
 				return nil, fmt.Errorf("failed to read config: %w", err)
 			}
 			// Config file not found, use defaults
-			fmt.Println("No configuration file found, using defaults")
+			fmt.Fprintln(os.Stderr, "No configuration file found, using defaults")
+		}
+	}
+
+	// Merge drop-in files over the base config
+	dropInDir := filepath.Join(DefaultConfigDir, DropInDirName)
+	if used := v.ConfigFileUsed(); used != "" {
+		dropInDir = filepath.Join(filepath.Dir(used), DropInDirName)
+	}
+	if err := mergeDropIns(v, dropInDir); err != nil {
+		return nil, err
+	}
+
+	// Merge the selected profile over the file and drop-ins
+	if opts.Profile == "" {
+		opts.Profile = os.Getenv(ProfileEnv)
+	}
+	if err := mergeProfile(v, opts.Profile); err != nil {
+		return nil, err
+	}
+
+	// Merge the last verified remote config over local files
+	if v.GetBool("remote.enabled") {
+		if opts.FetchRemote {
+			if err := fetchRemoteCache(context.Background(), v); err != nil {
+				fmt.Fprintf(os.Stderr, "Failed to fetch remote config, using the cached one: %v\n", err)
+			}
+		}
+		if err := mergeRemoteCache(v); err != nil {
+			return nil, err
 		}
 	}
 
 	// Environment variable overrides
 	v.SetEnvPrefix("SBOXAGENT")
 	v.AutomaticEnv()
+	for key, env := range serviceEnv {
+		if err := v.BindEnv(key, env); err != nil {
+			return nil, fmt.Errorf("failed to bind %s: %w", env, err)
+		}
+	}
 
 	var cfg Config
-	if err := v.Unmarshal(&cfg); err != nil {
+	var metadata mapstructure.Metadata
+	if err := v.Unmarshal(&cfg, decoderConfig(&metadata)); err != nil {
 		return nil, fmt.Errorf("failed to unmarshal config: %w", err)
 	}
 
+	// Reject unknown keys in strict mode; profile definitions are checked
+	// once merged
+	var unused []string
+	for _, key := range metadata.Unused {
+		if key != profilesKey && !strings.HasPrefix(key, profilesKey+".") {
+			unused = append(unused, key)
+		}
+	}
+	if (opts.Strict || cfg.Agent.StrictConfig) && len(unused) > 0 {
+		sort.Strings(unused)
+		return nil, fmt.Errorf("unknown configuration keys: %s", strings.Join(unused, ", "))
+	}
+	cfg.path = v.ConfigFileUsed()
+	cfg.options = opts
+
+	// Named sboxctl instances inherit the service settings
+	if err := resolveSboxctlInstances(v, &cfg); err != nil {
+		return nil, err
+	}
+
+	// Location rules may only select defined profiles
+	if cfg.Location.Enabled {
+		if err := checkLocationProfiles(v, cfg.Location); err != nil {
+			return nil, err
+		}
+	}
+
+	// Expand environment references and templates in values
+	if err := expandConfig(&cfg); err != nil {
+		return nil, err
+	}
+
+	// Resolve secret references in sensitive settings
+	if err := resolveSecrets(&cfg); err != nil {
+		return nil, err
+	}
+
 	// Validate configuration
 	if err := validateConfig(&cfg); err != nil {
 		return nil, fmt.Errorf("invalid configuration: %w", err)
@@ -154,17 +1271,211 @@ func Load(configPath string) (*Config, error) {
 	return &cfg, nil
 }
 
+// decoderConfig configures how viper values decode into Config, recording
+// unused keys in metadata
+func decoderConfig(metadata *mapstructure.Metadata) viper.DecoderConfigOption {
+	return func(dc *mapstructure.DecoderConfig) {
+		dc.Metadata = metadata
+		dc.DecodeHook = mapstructure.ComposeDecodeHookFunc(
+			durationHook,
+			mapstructure.StringToSliceHookFunc(","),
+		)
+	}
+}
+
+// mergeDropIns merges *.yaml files from dir over the loaded config in lexical order
+func mergeDropIns(v *viper.Viper, dir string) error {
+	files, err := DropInFiles(dir)
+	if err != nil {
+		return err
+	}
+
+	v.SetConfigType("yaml")
+	for _, file := range files {
+		f, err := os.Open(file)
+		if err != nil {
+			return fmt.Errorf("failed to open drop-in config %s: %w", file, err)
+		}
+		err = v.MergeConfig(f)
+		f.Close()
+		if err != nil {
+			return fmt.Errorf("failed to merge drop-in config %s: %w", file, err)
+		}
+	}
+
+	return nil
+}
+
+// profilesKey is the config section holding named profiles
+const profilesKey = "profiles"
+
+// mergeProfile merges the named profile over the config. The profile name
+// becomes agent.profile unless the profile sets it.
+func mergeProfile(v *viper.Viper, name string) error {
+	if name == "" {
+		return nil
+	}
+	profiles := v.GetStringMap(profilesKey)
+	raw, ok := profiles[strings.ToLower(name)]
+	if !ok {
+		available := make([]string, 0, len(profiles))
+		for profile := range profiles {
+			available = append(available, profile)
+		}
+		sort.Strings(available)
+		return fmt.Errorf("unknown profile %q (available: %s)", name, strings.Join(available, ", "))
+	}
+	overlay, ok := raw.(map[string]interface{})
+	if !ok && raw != nil {
+		return fmt.Errorf("profile %q must be a mapping", name)
+	}
+	if overlay == nil {
+		overlay = make(map[string]interface{})
+	}
+
+	profile := viper.New()
+	if err := profile.MergeConfigMap(overlay); err != nil {
+		return fmt.Errorf("failed to read profile %q: %w", name, err)
+	}
+	if !profile.IsSet("agent.profile") {
+		profile.Set("agent.profile", name)
+	}
+	if err := v.MergeConfigMap(profile.AllSettings()); err != nil {
+		return fmt.Errorf("failed to merge profile %q: %w", name, err)
+	}
+	return nil
+}
+
+// sboxctlInstancesKey is the config section holding named sboxctl instances
+const sboxctlInstancesKey = "services.sboxctl.instances"
+
+// resolveSboxctlInstances decodes each sboxctl instance over the service
+// settings, so an instance only needs to set what differs
+func resolveSboxctlInstances(v *viper.Viper, cfg *Config) error {
+	instances := v.GetStringMap(sboxctlInstancesKey)
+	if len(instances) == 0 {
+		cfg.Services.Sboxctl.Instances = nil
+		return nil
+	}
+
+	services, _ := v.AllSettings()["services"].(map[string]interface{})
+	base, _ := services["sboxctl"].(map[string]interface{})
+	delete(base, "instances")
+
+	resolved := make(map[string]SboxctlConfig, len(instances))
+	for name, raw := range instances {
+		overlay, ok := raw.(map[string]interface{})
+		if !ok && raw != nil {
+			return fmt.Errorf("sboxctl instance %q must be a mapping", name)
+		}
+
+		instance := viper.New()
+		if err := instance.MergeConfigMap(base); err != nil {
+			return fmt.Errorf("failed to read sboxctl settings: %w", err)
+		}
+		if err := instance.MergeConfigMap(overlay); err != nil {
+			return fmt.Errorf("failed to merge sboxctl instance %q: %w", name, err)
+		}
+
+		var sboxctl SboxctlConfig
+		var metadata mapstructure.Metadata
+		if err := instance.Unmarshal(&sboxctl, decoderConfig(&metadata)); err != nil {
+			return fmt.Errorf("failed to unmarshal sboxctl instance %q: %w", name, err)
+		}
+		sboxctl.Instances = nil
+		resolved[name] = sboxctl
+	}
+	cfg.Services.Sboxctl.Instances = resolved
+	return nil
+}
+
+// checkLocationProfiles rejects location rules naming undefined profiles
+func checkLocationProfiles(v *viper.Viper, cfg LocationConfig) error {
+	profiles := v.GetStringMap(profilesKey)
+	names := []string{cfg.DefaultProfile}
+	for _, rule := range cfg.Rules {
+		names = append(names, rule.Profile)
+	}
+	for _, name := range names {
+		if _, ok := profiles[strings.ToLower(name)]; name != "" && !ok {
+			return fmt.Errorf("location rule selects unknown profile %q", name)
+		}
+	}
+	return nil
+}
+
+// DropInFiles returns the drop-in config files in dir sorted lexically.
+// A missing directory yields no files.
+func DropInFiles(dir string) ([]string, error) {
+	var files []string
+	for _, pattern := range []string{"*.yaml", "*.yml"} {
+		matches, err := filepath.Glob(filepath.Join(dir, pattern))
+		if err != nil {
+			return nil, fmt.Errorf("failed to list drop-in configs: %w", err)
+		}
+		files = append(files, matches...)
+	}
+	sort.Slice(files, func(i, j int) bool {
+		return filepath.Base(files[i]) < filepath.Base(files[j])
+	})
+	return files, nil
+}
+
 // setDefaults sets default configuration values
 func setDefaults(v *viper.Viper) {
 	// Agent defaults
 	v.SetDefault("agent.name", "sboxagent")
 	v.SetDefault("agent.version", "0.1.0")
 	v.SetDefault("agent.log_level", "info")
+	v.SetDefault("agent.profile", "")
+	v.SetDefault("agent.heartbeat_interval", "30s")
+	v.SetDefault("agent.shutdown.stop_timeout", "10s")
+	v.SetDefault("agent.strict_config", false)
+	v.SetDefault("agent.reap_orphans", true)
+	v.SetDefault("agent.watchdog", true)
+	v.SetDefault("agent.unit.description", "SboxAgent - sing-box proxy configuration manager")
+	v.SetDefault("agent.unit.label", "io.github.kpblcaoo.sboxagent")
+	v.SetDefault("agent.unit.user", "sboxagent")
+	v.SetDefault("agent.unit.group", "sboxagent")
+	v.SetDefault("agent.unit.exec_start", []string{"{{.Binary}}", "-config", "{{.ConfigPath}}", "-socket", "{{.SocketPath}}"})
+	v.SetDefault("agent.unit.restart", "always")
+	v.SetDefault("agent.unit.restart_sec", "5s")
+	v.SetDefault("agent.unit.watchdog_sec", "30s")
+	v.SetDefault("agent.unit.runtime_directory", "sboxagent")
+	v.SetDefault("agent.unit.protect_system", "strict")
+	v.SetDefault("agent.unit.protect_home", true)
+	v.SetDefault("agent.unit.private_tmp", true)
+	v.SetDefault("agent.unit.no_new_privileges", true)
+	v.SetDefault("agent.unit.capability_bounding_set", []string{})
+	v.SetDefault("agent.unit.ambient_capabilities", []string{})
+	v.SetDefault("agent.unit.read_write_paths", []string{DefaultConfigDir})
+	v.SetDefault("agent.unit.limit_nofile", 65536)
+	v.SetDefault("agent.unit.limit_nproc", 4096)
+	v.SetDefault("agent.unit.extra", []string{})
 
 	// Server defaults
+	v.SetDefault("server.enabled", false)
 	v.SetDefault("server.port", 8080)
 	v.SetDefault("server.host", "127.0.0.1")
 	v.SetDefault("server.timeout", "30s")
+	v.SetDefault("server.slow_request_threshold", "1s")
+	v.SetDefault("health.interval", "30s")
+	v.SetDefault("health.disk.enabled", true)
+	v.SetDefault("health.disk.warning_percent", 90)
+	v.SetDefault("health.disk.critical_percent", 95)
+	v.SetDefault("health.certificates.enabled", true)
+	v.SetDefault("health.certificates.warning", "720h")
+	v.SetDefault("health.certificates.critical", "168h")
+	v.SetDefault("health.trends.enabled", true)
+	v.SetDefault("health.trends.window", 30)
+	v.SetDefault("health.trends.horizon", "24h")
+	v.SetDefault("health.trends.memory_limit_mb", 512)
+	v.SetDefault("health.trends.error_rate_percent", 10)
+	v.SetDefault("health.trends.disk_path", "")
+	v.SetDefault("health.trends.disk_min_free_mb", 1024)
+	v.SetDefault("server.tunnel.enabled", false)
+	v.SetDefault("server.tunnel.reconnect_interval", "5s")
+	v.SetDefault("server.tunnel.max_reconnect_interval", "5m")
 
 	// Services defaults
 	v.SetDefault("services.sboxctl.enabled", true)
@@ -175,82 +1486,847 @@ func setDefaults(v *viper.Viper) {
 	v.SetDefault("services.sboxctl.health_check.enabled", true)
 	v.SetDefault("services.sboxctl.health_check.interval", "1m")
 	v.SetDefault("services.sboxctl.health_check.timeout", "10s")
+	v.SetDefault("services.sboxctl.event_buffer", 100)
+	v.SetDefault("services.sboxctl.max_line_bytes", 1<<20)
+	v.SetDefault("services.sboxctl.max_output_bytes", 64<<20)
+	v.SetDefault("services.sboxctl.interactive", false)
+	v.SetDefault("services.sboxctl.circuit_breaker.threshold", 5)
+	v.SetDefault("services.sboxctl.circuit_breaker.cooldown", "15m")
+	v.SetDefault("services.sboxctl.circuit_breaker.probe_command", []string{"sboxctl", "--version"})
+	v.SetDefault("services.sboxctl.record.enabled", false)
+	v.SetDefault("services.sboxctl.record.dir", filepath.Join(DefaultDataDir, "events"))
+	v.SetDefault("services.sboxctl.record.max_files", 50)
+	v.SetDefault("services.cli.enabled", false)
+	v.SetDefault("services.cli.path", "sboxmgr")
+	v.SetDefault("services.cli.timeout", "30s")
+	v.SetDefault("services.cli.max_retries", 3)
+	v.SetDefault("services.cli.retry_delay", "5s")
+	v.SetDefault("services.cli.max_retry_delay", "1m")
+	v.SetDefault("services.cli.max_concurrent", 4)
+	v.SetDefault("services.cli.queue_timeout", "30s")
+	v.SetDefault("services.systemd.enabled", false)
+	v.SetDefault("services.systemd.service_name", "sing-box")
+	v.SetDefault("services.systemd.user_mode", false)
+	v.SetDefault("services.systemd.timeout", "30s")
+	v.SetDefault("services.systemd.backend", "auto")
+	v.SetDefault("services.systemd.init_system", "auto")
+	v.SetDefault("services.startup.network_timeout", "30s")
+	v.SetDefault("services.systemd.drift.enabled", false)
+	v.SetDefault("services.systemd.drift.interval", "1h")
+	v.SetDefault("services.systemd.drift.unit_dir", "/etc/systemd/system")
+	v.SetDefault("services.systemd.drift.agent_unit", "sboxagent.service")
+	v.SetDefault("services.systemd.drift.clients", true)
+	v.SetDefault("services.supervisor.mode", SupervisorAuto)
+	v.SetDefault("services.supervisor.restart_delay", "1s")
+	v.SetDefault("services.supervisor.max_restart_delay", "1m")
+	v.SetDefault("services.supervisor.max_restarts", 5)
+	v.SetDefault("services.supervisor.restart_window", "5m")
+	v.SetDefault("services.supervisor.stop_timeout", "10s")
+	v.SetDefault("services.supervisor.fallback_config", false)
+	v.SetDefault("services.monitoring.enabled", false)
+	v.SetDefault("services.monitoring.interval", "30s")
+	v.SetDefault("services.monitoring.timeout", "10s")
+	v.SetDefault("services.monitoring.failure_threshold", 3)
+	v.SetDefault("services.monitoring.connectivity.enabled", false)
+	v.SetDefault("services.monitoring.connectivity.url", "https://www.gstatic.com/generate_204")
+	v.SetDefault("services.monitoring.connectivity.interval", "1m")
+	v.SetDefault("services.monitoring.connectivity.timeout", "10s")
+	v.SetDefault("services.monitoring.connectivity.window", 10)
+	v.SetDefault("services.monitoring.connectivity.min_success_rate", 80)
+	v.SetDefault("services.monitoring.connectivity.max_latency", "2s")
+	v.SetDefault("services.dispatcher.buffer_size", 1000)
+	v.SetDefault("services.run_history", 50)
+	v.SetDefault("services.environment.inherit_all", false)
+	v.SetDefault("services.environment.allow", []string{"PATH", "HOME", "USER", "LANG", "LC_*", "TZ", "TMPDIR"})
 
 	// Clients defaults
 	v.SetDefault("clients.sing-box.enabled", true)
 	v.SetDefault("clients.sing-box.binary_path", "/usr/local/bin/sing-box")
 	v.SetDefault("clients.sing-box.config_path", "/etc/sing-box/config.json")
+	v.SetDefault("clients.sing-box.restart_policy", RestartOnFailure)
 
 	v.SetDefault("clients.xray.enabled", true)
 	v.SetDefault("clients.xray.binary_path", "/usr/local/bin/xray")
 	v.SetDefault("clients.xray.config_path", "/etc/xray/config.json")
+	v.SetDefault("clients.xray.restart_policy", RestartOnFailure)
 
 	v.SetDefault("clients.clash.enabled", true)
 	v.SetDefault("clients.clash.binary_path", "/usr/local/bin/clash")
 	v.SetDefault("clients.clash.config_path", "/etc/clash/config.yaml")
+	v.SetDefault("clients.clash.restart_policy", RestartOnFailure)
 
 	v.SetDefault("clients.hysteria.enabled", true)
 	v.SetDefault("clients.hysteria.binary_path", "/usr/local/bin/hysteria")
 	v.SetDefault("clients.hysteria.config_path", "/etc/hysteria/config.json")
+	v.SetDefault("clients.hysteria.restart_policy", RestartOnFailure)
+	v.SetDefault("clients.kill_switch.enabled", false)
+	v.SetDefault("clients.version_check.enabled", true)
+	v.SetDefault("clients.version_check.interval", "6h")
+	v.SetDefault("clients.version_check.timeout", "10s")
+	v.SetDefault("clients.upgrade.enabled", false)
+	v.SetDefault("clients.upgrade.api_url", "https://api.github.com")
+	v.SetDefault("clients.upgrade.restart", true)
+	v.SetDefault("clients.upgrade.timeout", "5m")
+	v.SetDefault("clients.upgrade.require_checksum", true)
 
 	// Logging defaults
 	v.SetDefault("logging.stdout_capture", true)
 	v.SetDefault("logging.aggregation", true)
 	v.SetDefault("logging.retention_days", 30)
 	v.SetDefault("logging.max_entries", 1000)
+	v.SetDefault("logging.audit.enabled", false)
+	v.SetDefault("logging.audit.file", "")
+	v.SetDefault("logging.journal.enabled", false)
+	v.SetDefault("logging.journal.units", []string{"sing-box", "xray", "clash"})
+	v.SetDefault("logging.journal.restart_delay", "5s")
 
 	// Security defaults
 	v.SetDefault("security.allow_remote_api", false)
 	v.SetDefault("security.allowed_hosts", []string{"127.0.0.1", "::1"})
+	v.SetDefault("security.denied_hosts", []string{})
 	v.SetDefault("security.tls_enabled", false)
+	v.SetDefault("security.auth.oidc.enabled", false)
+	v.SetDefault("security.auth.oidc.refresh_interval", "1h")
+	v.SetDefault("security.privileges.drop_capabilities", false)
+	v.SetDefault("security.privileges.keep_capabilities", privilege.DefaultKeep)
+
+	// Remote config defaults
+	v.SetDefault("remote.enabled", false)
+	v.SetDefault("remote.poll_interval", "5m")
+	v.SetDefault("remote.timeout", "30s")
+	v.SetDefault("remote.cache_file", filepath.Join(DefaultDataDir, "remote-config.yaml"))
+
+	// Import defaults
+	v.SetDefault("location.enabled", false)
+	v.SetDefault("location.interval", "30s")
+	v.SetDefault("import.enabled", false)
+	v.SetDefault("import.client_type", "sing-box")
+	v.SetDefault("import.schedule", "1h")
+	v.SetDefault("import.timeout", "2m")
+	v.SetDefault("import.retries", 2)
+	v.SetDefault("import.retry_delay", "10s")
+	v.SetDefault("import.max_retry_delay", "2m")
+	v.SetDefault("import.command", []string{"sboxmgr", "export", "--format", "agent"})
+	v.SetDefault("import.backups.max_count", 10)
+	v.SetDefault("import.backups.max_age", "720h")
+	v.SetDefault("import.check_ports", true)
+	v.SetDefault("import.check_config", true)
+	v.SetDefault("import.hot_reload", true)
+	v.SetDefault("import.session.enabled", false)
+	v.SetDefault("import.session.command", []string{"sboxmgr", "serve-stdio"})
+	v.SetDefault("import.session.respawn_delay", "5s")
+
+	// Notification defaults
+	v.SetDefault("notifications.enabled", false)
+	v.SetDefault("notifications.events", []string{"STATE_CHANGED", "IMPORT_FAILED"})
+	v.SetDefault("notifications.spool_dir", filepath.Join(DefaultDataDir, "spool"))
+	v.SetDefault("notifications.retry_interval", "30s")
+	v.SetDefault("notifications.max_retry_interval", "10m")
+	v.SetDefault("notifications.expiry", "24h")
+
+	// Standby defaults
+	v.SetDefault("standby.enabled", false)
+	v.SetDefault("standby.lease_ttl", "30s")
+	v.SetDefault("standby.renew_interval", "10s")
+}
+
+// durationHook decodes duration strings such as "30s" or "5m" into
+// time.Duration. Bare numbers are rejected because they would silently be
+// read as nanoseconds.
+func durationHook(from reflect.Type, to reflect.Type, data interface{}) (interface{}, error) {
+	if to != reflect.TypeOf(time.Duration(0)) {
+		return data, nil
+	}
+	switch value := data.(type) {
+	case string:
+		d, err := time.ParseDuration(value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid duration %q: expected a value like 30s or 5m", value)
+		}
+		return d, nil
+	case time.Duration:
+		return value, nil
+	default:
+		return nil, fmt.Errorf("invalid duration %v: expected a string like 30s or 5m", value)
+	}
+}
+
+// validateImportSources checks that sources are named uniquely, have a URL
+// and use valid filter patterns
+func validateImportSources(sources []ImportSource) error {
+	names := make(map[string]bool, len(sources))
+	for i, source := range sources {
+		if source.Name == "" {
+			return fmt.Errorf("import source %d has no name", i)
+		}
+		if names[source.Name] {
+			return fmt.Errorf("duplicate import source %q", source.Name)
+		}
+		names[source.Name] = true
+
+		if source.URL == "" {
+			return fmt.Errorf("import source %s has no url", source.Name)
+		}
+		for _, pattern := range append(append([]string{}, source.Include...), source.Exclude...) {
+			if _, err := path.Match(pattern, ""); err != nil {
+				return fmt.Errorf("invalid filter %q for import source %s: %w", pattern, source.Name, err)
+			}
+		}
+	}
+	return nil
+}
+
+// validateUpgrade checks the client upgrade settings
+func validateUpgrade(clients ClientsConfig) error {
+	cfg := clients.Upgrade
+	u, err := url.Parse(cfg.APIURL)
+	if err != nil || (u.Scheme != "https" && u.Scheme != "http") || u.Host == "" {
+		return fmt.Errorf("client upgrade api_url must be an http(s) url")
+	}
+	if cfg.Schedule < 0 {
+		return fmt.Errorf("client upgrade schedule must not be negative")
+	}
+	if cfg.Timeout <= 0 {
+		return fmt.Errorf("client upgrade timeout must be positive")
+	}
+	for client, version := range cfg.Versions {
+		if !slices.Contains(ClientNames, client) {
+			return fmt.Errorf("unknown client %q in client upgrade versions", client)
+		}
+		if version == "" {
+			return fmt.Errorf("client upgrade version for %s is empty", client)
+		}
+	}
+	_, err = cfg.Key()
+	return err
+}
+
+// validateLocation checks location rules. Profile names are checked against
+// the profiles section by Load.
+func validateLocation(cfg LocationConfig) error {
+	if cfg.Interval <= 0 {
+		return fmt.Errorf("location interval must be positive")
+	}
+	for i, rule := range cfg.Rules {
+		if rule.Profile == "" {
+			return fmt.Errorf("location rule %d has no profile", i+1)
+		}
+		if len(rule.SSIDs) == 0 && len(rule.Subnets) == 0 && len(rule.GatewayMACs) == 0 {
+			return fmt.Errorf("location rule for %s has no criteria", rule.Profile)
+		}
+		for _, subnet := range rule.Subnets {
+			if _, _, err := net.ParseCIDR(subnet); err != nil {
+				return fmt.Errorf("invalid subnet %q in location rule for %s", subnet, rule.Profile)
+			}
+		}
+		for _, mac := range rule.GatewayMACs {
+			if _, err := net.ParseMAC(mac); err != nil {
+				return fmt.Errorf("invalid gateway mac %q in location rule for %s", mac, rule.Profile)
+			}
+		}
+	}
+	return nil
+}
+
+// validateHealth checks the additional health checks
+func validateHealth(cfg HealthConfig) error {
+	var errs []error
+	if cfg.Interval < 0 {
+		errs = append(errs, fmt.Errorf("health interval must not be negative"))
+	}
+	names := make(map[string]bool, len(cfg.Exec))
+	for i, check := range cfg.Exec {
+		if check.Name == "" {
+			errs = append(errs, fmt.Errorf("exec health check %d has no name", i+1))
+			continue
+		}
+		if names[check.Name] {
+			errs = append(errs, fmt.Errorf("duplicate health check %q", check.Name))
+		}
+		names[check.Name] = true
+		if len(check.Command) == 0 {
+			errs = append(errs, fmt.Errorf("exec health check %s has no command", check.Name))
+		}
+		if check.Timeout < 0 {
+			errs = append(errs, fmt.Errorf("exec health check %s timeout must not be negative", check.Name))
+		}
+	}
+	for i, check := range cfg.Endpoints {
+		if check.Name == "" {
+			errs = append(errs, fmt.Errorf("endpoint health check %d has no name", i+1))
+			continue
+		}
+		if names[check.Name] {
+			errs = append(errs, fmt.Errorf("duplicate health check %q", check.Name))
+		}
+		names[check.Name] = true
+		switch check.Kind {
+		case EndpointTCP, EndpointSOCKS5, EndpointHTTP:
+		default:
+			errs = append(errs, fmt.Errorf("endpoint health check %s kind must be tcp, socks5 or http", check.Name))
+		}
+		if _, _, err := net.SplitHostPort(check.Address); err != nil {
+			errs = append(errs, fmt.Errorf("endpoint health check %s address: %w", check.Name, err))
+		}
+		if check.URL != "" {
+			if check.Kind == EndpointTCP {
+				errs = append(errs, fmt.Errorf("endpoint health check %s url requires kind socks5 or http", check.Name))
+			}
+			parsed, err := url.Parse(check.URL)
+			if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+				errs = append(errs, fmt.Errorf("endpoint health check %s url must be an http or https url", check.Name))
+			}
+		}
+		if check.Timeout < 0 {
+			errs = append(errs, fmt.Errorf("endpoint health check %s timeout must not be negative", check.Name))
+		}
+	}
+	for i, check := range cfg.DNS {
+		if check.Name == "" {
+			errs = append(errs, fmt.Errorf("dns health check %d has no name", i+1))
+			continue
+		}
+		if names[check.Name] {
+			errs = append(errs, fmt.Errorf("duplicate health check %q", check.Name))
+		}
+		names[check.Name] = true
+		if check.Domain == "" {
+			errs = append(errs, fmt.Errorf("dns health check %s has no domain", check.Name))
+		}
+		if check.Server != "" {
+			if _, _, err := net.SplitHostPort(check.Server); err != nil {
+				errs = append(errs, fmt.Errorf("dns health check %s server: %w", check.Name, err))
+			}
+		}
+		if check.Proxy != "" {
+			if check.Server == "" {
+				errs = append(errs, fmt.Errorf("dns health check %s proxy requires a server", check.Name))
+			}
+			if _, _, err := net.SplitHostPort(check.Proxy); err != nil {
+				errs = append(errs, fmt.Errorf("dns health check %s proxy: %w", check.Name, err))
+			}
+		}
+		for _, entry := range check.Expect {
+			if net.ParseIP(entry) == nil {
+				if _, _, err := net.ParseCIDR(entry); err != nil {
+					errs = append(errs, fmt.Errorf("dns health check %s expects invalid address %q", check.Name, entry))
+				}
+			}
+		}
+		if check.Timeout < 0 {
+			errs = append(errs, fmt.Errorf("dns health check %s timeout must not be negative", check.Name))
+		}
+	}
+	if disk := cfg.Disk; disk.Enabled {
+		if disk.WarningPercent <= 0 || disk.WarningPercent > disk.CriticalPercent || disk.CriticalPercent > 100 {
+			errs = append(errs, fmt.Errorf("disk health check thresholds must satisfy 0 < warning_percent <= critical_percent <= 100"))
+		}
+	}
+	if certs := cfg.Certificates; certs.Enabled {
+		if certs.Critical <= 0 || certs.Warning < certs.Critical {
+			errs = append(errs, fmt.Errorf("certificate health check thresholds must satisfy 0 < critical <= warning"))
+		}
+	}
+	if trends := cfg.Trends; trends.Enabled {
+		if trends.Window < 3 {
+			errs = append(errs, fmt.Errorf("health trends window must be at least 3 samples"))
+		}
+		if trends.Horizon <= 0 {
+			errs = append(errs, fmt.Errorf("health trends horizon must be positive"))
+		}
+		if trends.MemoryLimitMB < 0 || trends.DiskMinFreeMB < 0 || trends.ErrorRatePercent < 0 || trends.ErrorRatePercent > 100 {
+			errs = append(errs, fmt.Errorf("health trends limits must not be negative, with error_rate_percent at most 100"))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// validateNotifications checks the spool settings and enabled channels
+func validateNotifications(cfg NotificationsConfig) error {
+	if cfg.SpoolDir == "" {
+		return fmt.Errorf("notifications spool_dir is required when enabled")
+	}
+	if cfg.RetryInterval <= 0 || cfg.MaxRetryInterval < cfg.RetryInterval || cfg.Expiry <= 0 {
+		return fmt.Errorf("notification retry intervals and expiry must be positive, with max_retry_interval at least retry_interval")
+	}
+	if !cfg.Webhook.Enabled && !cfg.Telegram.Enabled && !cfg.Email.Enabled {
+		return fmt.Errorf("notifications require at least one enabled channel")
+	}
+	if cfg.Webhook.Enabled && cfg.Webhook.URL == "" {
+		return fmt.Errorf("notification webhook url is required when enabled")
+	}
+	if cfg.Telegram.Enabled && (cfg.Telegram.BotToken == "" || cfg.Telegram.ChatID == "") {
+		return fmt.Errorf("notification telegram bot_token and chat_id are required when enabled")
+	}
+	if cfg.Email.Enabled && (cfg.Email.SMTPAddr == "" || cfg.Email.From == "" || len(cfg.Email.To) == 0) {
+		return fmt.Errorf("notification email smtp_addr, from and to are required when enabled")
+	}
+	return nil
+}
+
+// validate checks the hardening and command line of the agent unit
+func (u UnitConfig) validate() error {
+	switch u.ProtectSystem {
+	case "", "strict", "full", "true", "false":
+	default:
+		return fmt.Errorf("protect_system must be strict, full, true or false")
+	}
+	if u.RestartSec < 0 || u.WatchdogSec < 0 {
+		return fmt.Errorf("restart_sec and watchdog_sec must not be negative")
+	}
+	if u.LimitNOFILE < 0 || u.LimitNPROC < 0 {
+		return fmt.Errorf("limit_nofile and limit_nproc must not be negative")
+	}
+	for _, line := range u.Extra {
+		if key, _, ok := strings.Cut(line, "="); !ok || strings.TrimSpace(key) == "" {
+			return fmt.Errorf("extra line %q is not Key=Value", line)
+		}
+	}
+	return nil
+}
+
+// validate checks the settings of the sboxctl service or one of its
+// instances
+func (s SboxctlConfig) validate() error {
+	if s.Enabled && s.Schedule == "" && s.Interval <= 0 {
+		return fmt.Errorf("sboxctl interval must be positive")
+	}
+	if s.Schedule != "" {
+		if _, err := schedule.Parse(s.Schedule); err != nil {
+			return fmt.Errorf("invalid sboxctl schedule: %w", err)
+		}
+	}
+	if s.Splay < 0 {
+		return fmt.Errorf("sboxctl splay must not be negative")
+	}
+	if s.Enabled && s.HealthCheck.Enabled && s.HealthCheck.Interval <= 0 {
+		return fmt.Errorf("sboxctl health check interval must be positive")
+	}
+	if s.CircuitBreaker.Threshold < 0 {
+		return fmt.Errorf("sboxctl circuit breaker threshold must not be negative")
+	}
+	if s.CircuitBreaker.Threshold > 0 && s.CircuitBreaker.Cooldown <= 0 {
+		return fmt.Errorf("sboxctl circuit breaker cooldown must be positive")
+	}
+	if s.Interactive && !s.StdoutCapture {
+		return fmt.Errorf("interactive sboxctl requires stdout_capture")
+	}
+	if s.Record.Enabled {
+		if s.Record.Dir == "" {
+			return fmt.Errorf("sboxctl record dir is required when enabled")
+		}
+		if s.Record.MaxFiles < 0 {
+			return fmt.Errorf("sboxctl record max_files must not be negative")
+		}
+	}
+	if s.EventBuffer < 0 {
+		return fmt.Errorf("event buffer sizes must not be negative")
+	}
+	if s.MaxLineBytes < 0 || s.MaxOutputBytes < 0 {
+		return fmt.Errorf("sboxctl max_line_bytes and max_output_bytes must not be negative")
+	}
+	if err := s.SubprocessConfig.validate("sboxctl"); err != nil {
+		return err
+	}
+	if s.Enabled && len(s.Command) == 0 {
+		return fmt.Errorf("sboxctl command is required when enabled")
+	}
+	return nil
+}
+
+// validateServices validates the enabled CLI, systemd and monitoring services
+func validateServices(cfg ServicesConfig) error {
+	var errs []error
+	if cfg.CLI.MaxConcurrent < 0 || cfg.CLI.MaxConcurrent > maxConcurrentCommands {
+		errs = append(errs, fmt.Errorf("cli max_concurrent must be between 0 and %d", maxConcurrentCommands))
+	}
+	if cfg.CLI.QueueTimeout < 0 {
+		errs = append(errs, fmt.Errorf("cli queue_timeout must not be negative"))
+	}
+	if cfg.RunHistory < 0 {
+		errs = append(errs, fmt.Errorf("run_history must not be negative"))
+	}
+	switch cfg.Supervisor.Mode {
+	case "", SupervisorAuto, SupervisorOn, SupervisorOff:
+	default:
+		errs = append(errs, fmt.Errorf("supervisor mode must be auto, on or off"))
+	}
+	if cfg.Supervisor.Mode != "" && cfg.Supervisor.Mode != SupervisorOff {
+		if cfg.Supervisor.RestartDelay <= 0 || cfg.Supervisor.MaxRestartDelay < cfg.Supervisor.RestartDelay {
+			errs = append(errs, fmt.Errorf("supervisor restart_delay must be positive and not exceed max_restart_delay"))
+		}
+		if cfg.Supervisor.StopTimeout <= 0 {
+			errs = append(errs, fmt.Errorf("supervisor stop_timeout must be positive"))
+		}
+		if cfg.Supervisor.MaxRestarts < 0 {
+			errs = append(errs, fmt.Errorf("supervisor max_restarts must not be negative"))
+		}
+		if cfg.Supervisor.MaxRestarts > 0 && cfg.Supervisor.RestartWindow <= 0 {
+			errs = append(errs, fmt.Errorf("supervisor restart_window must be positive with max_restarts"))
+		}
+	}
+	for action, timeout := range cfg.CLI.Timeouts {
+		if !slices.Contains(CLIActions, action) {
+			errs = append(errs, fmt.Errorf("unknown cli timeout action %q, expected one of %s", action, strings.Join(CLIActions, ", ")))
+		}
+		if timeout <= 0 {
+			errs = append(errs, fmt.Errorf("cli timeout for %s must be positive", action))
+		}
+	}
+
+	if cfg.CLI.Enabled {
+		if cfg.CLI.Path == "" {
+			errs = append(errs, fmt.Errorf("cli path is required when enabled"))
+		} else if _, err := exec.LookPath(cfg.CLI.Path); err != nil {
+			errs = append(errs, fmt.Errorf("cli executable not found: %w", err))
+		}
+		if cfg.CLI.Timeout <= 0 {
+			errs = append(errs, fmt.Errorf("cli timeout must be positive"))
+		}
+		if cfg.CLI.MaxRetries < 0 || cfg.CLI.MaxRetries > maxServiceRetries {
+			errs = append(errs, fmt.Errorf("cli max_retries must be between 0 and %d", maxServiceRetries))
+		}
+		if cfg.CLI.RetryDelay < 0 || cfg.CLI.MaxRetryDelay < cfg.CLI.RetryDelay {
+			errs = append(errs, fmt.Errorf("cli retry_delay must not be negative or exceed max_retry_delay"))
+		}
+	}
+
+	if cfg.Systemd.Enabled {
+		if cfg.Systemd.ServiceName == "" {
+			errs = append(errs, fmt.Errorf("systemd service_name is required when enabled"))
+		}
+		if cfg.Systemd.Timeout <= 0 {
+			errs = append(errs, fmt.Errorf("systemd timeout must be positive"))
+		}
+		switch cfg.Systemd.Backend {
+		case "", "auto", "dbus", "systemctl":
+		default:
+			errs = append(errs, fmt.Errorf("systemd backend must be auto, dbus or systemctl"))
+		}
+		switch cfg.Systemd.InitSystem {
+		case "", "auto", "systemd", "openrc", "runit", "sysv", "launchd", "windows":
+		default:
+			errs = append(errs, fmt.Errorf("init system must be auto, systemd, openrc, runit, sysv, launchd or windows"))
+		}
+	}
+	for step, needs := range cfg.Startup.Needs {
+		for _, name := range append([]string{step}, needs...) {
+			if !slices.Contains(StartupSteps, name) {
+				errs = append(errs, fmt.Errorf("unknown startup step %q", name))
+			}
+		}
+	}
+	if cfg.Startup.NetworkTimeout < 0 {
+		errs = append(errs, fmt.Errorf("startup network_timeout must not be negative"))
+	}
+	if cfg.Systemd.Drift.Enabled {
+		if cfg.Systemd.Drift.Interval < 0 {
+			errs = append(errs, fmt.Errorf("unit drift interval must not be negative"))
+		}
+		if cfg.Systemd.Drift.UnitDir == "" {
+			errs = append(errs, fmt.Errorf("unit drift unit_dir is required when enabled"))
+		}
+	}
+
+	if cfg.Monitoring.Enabled {
+		if cfg.Monitoring.Interval <= 0 {
+			errs = append(errs, fmt.Errorf("monitoring interval must be positive"))
+		}
+		if cfg.Monitoring.Timeout <= 0 || cfg.Monitoring.Timeout > cfg.Monitoring.Interval {
+			errs = append(errs, fmt.Errorf("monitoring timeout must be positive and not exceed the interval"))
+		}
+		if cfg.Monitoring.FailureThreshold < 1 || cfg.Monitoring.FailureThreshold > maxServiceRetries {
+			errs = append(errs, fmt.Errorf("monitoring failure_threshold must be between 1 and %d", maxServiceRetries))
+		}
+	}
+	if connectivity := cfg.Monitoring.Connectivity; connectivity.Enabled {
+		parsed, err := url.Parse(connectivity.URL)
+		if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+			errs = append(errs, fmt.Errorf("connectivity url must be an http or https url"))
+		}
+		if connectivity.Proxy != "" {
+			proxy, err := url.Parse(connectivity.Proxy)
+			if err != nil || (proxy.Scheme != "socks5" && proxy.Scheme != "http") || proxy.Host == "" {
+				errs = append(errs, fmt.Errorf("connectivity proxy must be a socks5:// or http:// url"))
+			}
+		}
+		if connectivity.Interval <= 0 {
+			errs = append(errs, fmt.Errorf("connectivity interval must be positive"))
+		}
+		if connectivity.Timeout <= 0 || connectivity.Timeout > connectivity.Interval {
+			errs = append(errs, fmt.Errorf("connectivity timeout must be positive and not exceed the interval"))
+		}
+		if connectivity.Window < 1 {
+			errs = append(errs, fmt.Errorf("connectivity window must be positive"))
+		}
+		if connectivity.MinSuccessRate < 0 || connectivity.MinSuccessRate > 100 {
+			errs = append(errs, fmt.Errorf("connectivity min_success_rate must be between 0 and 100"))
+		}
+		if connectivity.MaxLatency < 0 {
+			errs = append(errs, fmt.Errorf("connectivity max_latency must not be negative"))
+		}
+	}
+	return errors.Join(errs...)
 }
 
 // validateConfig validates the configuration
 func validateConfig(cfg *Config) error {
+	// Collect every failure so all of them are fixed in one go
+	var errs []error
+
 	// Validate agent configuration
 	if cfg.Agent.Name == "" {
-		return fmt.Errorf("agent name is required")
+		errs = append(errs, fmt.Errorf("agent name is required"))
 	}
 	if cfg.Agent.Version == "" {
-		return fmt.Errorf("agent version is required")
+		errs = append(errs, fmt.Errorf("agent version is required"))
+	}
+	if err := cfg.Agent.Unit.validate(); err != nil {
+		errs = append(errs, fmt.Errorf("agent unit: %w", err))
+	}
+
+	// Validate sboxctl and its instances
+	if err := cfg.Services.Sboxctl.validate(); err != nil {
+		errs = append(errs, err)
+	}
+	for name, instance := range cfg.Services.Sboxctl.Instances {
+		if err := instance.validate(); err != nil {
+			errs = append(errs, fmt.Errorf("sboxctl instance %s: %w", name, err))
+		}
+	}
+
+	// Validate durations that drive timers
+	if cfg.Remote.Enabled && cfg.Remote.PollInterval <= 0 {
+		errs = append(errs, fmt.Errorf("remote config poll interval must be positive"))
+	}
+
+	if err := validateServices(cfg.Services); err != nil {
+		errs = append(errs, err)
+	}
+
+	// Validate event queue sizes; zero uses the built-in default
+	if cfg.Services.Dispatcher.BufferSize < 0 {
+		errs = append(errs, fmt.Errorf("event buffer sizes must not be negative"))
 	}
 
 	// Validate server configuration
 	if cfg.Server.Port < 1 || cfg.Server.Port > 65535 {
-		return fmt.Errorf("server port must be between 1 and 65535")
+		errs = append(errs, fmt.Errorf("server port must be between 1 and 65535"))
+	}
+
+	// Validate management tunnel configuration if enabled
+	if cfg.Server.Tunnel.Enabled {
+		if !cfg.Server.Enabled {
+			errs = append(errs, fmt.Errorf("server tunnel requires the api server to be enabled"))
+		}
+		if cfg.Server.Tunnel.URL == "" || cfg.Server.Tunnel.Token == "" {
+			errs = append(errs, fmt.Errorf("server tunnel url and token are required when enabled"))
+		}
 	}
 
-	// Validate sboxctl configuration if enabled
-	if cfg.Services.Sboxctl.Enabled {
-		if len(cfg.Services.Sboxctl.Command) == 0 {
-			return fmt.Errorf("sboxctl command is required when enabled")
+	// Validate remote config source if enabled
+	if cfg.Remote.Enabled {
+		if _, err := NewRemoteSource(cfg.Remote); err != nil {
+			errs = append(errs, err)
 		}
 	}
 
-	return nil
+	// Validate scheduled import if enabled
+	if cfg.Import.Enabled {
+		if cfg.Import.SubscriptionURL == "" && len(cfg.Import.Sources) == 0 {
+			errs = append(errs, fmt.Errorf("import subscription_url or sources is required when enabled"))
+		}
+		if cfg.Import.SubscriptionURL != "" && len(cfg.Import.Sources) > 0 {
+			errs = append(errs, fmt.Errorf("import subscription_url and sources are mutually exclusive"))
+		}
+		if err := validateImportSources(cfg.Import.Sources); err != nil {
+			errs = append(errs, err)
+		}
+		path, ok := cfg.Clients.ConfigPath(cfg.Import.ClientType)
+		if !ok {
+			errs = append(errs, fmt.Errorf("unknown import client type %q", cfg.Import.ClientType))
+		} else if path == "" {
+			errs = append(errs, fmt.Errorf("import client %s has no config_path", cfg.Import.ClientType))
+		}
+		seen := make(map[string]bool, len(cfg.Import.Clients))
+		for _, client := range cfg.Import.Clients {
+			path, ok := cfg.Clients.ConfigPath(client)
+			if !ok {
+				errs = append(errs, fmt.Errorf("unknown import client %q", client))
+			} else if path == "" {
+				errs = append(errs, fmt.Errorf("import client %s has no config_path", client))
+			}
+			if seen[client] {
+				errs = append(errs, fmt.Errorf("duplicate import client %q", client))
+			}
+			seen[client] = true
+		}
+		if cfg.Import.Schedule <= 0 || cfg.Import.Timeout <= 0 {
+			errs = append(errs, fmt.Errorf("import schedule and timeout must be positive"))
+		}
+		if len(cfg.Import.Command) == 0 {
+			errs = append(errs, fmt.Errorf("import command cannot be empty when enabled"))
+		}
+		if cfg.Import.Session.Enabled && len(cfg.Import.Session.Command) == 0 {
+			errs = append(errs, fmt.Errorf("import session command cannot be empty when enabled"))
+		}
+	}
+
+	if cfg.Import.Session.RespawnDelay < 0 {
+		errs = append(errs, fmt.Errorf("import session respawn_delay must not be negative"))
+	}
+	if cfg.Import.Retries < 0 || cfg.Import.Retries > maxServiceRetries {
+		errs = append(errs, fmt.Errorf("import retries must be between 0 and %d", maxServiceRetries))
+	}
+	if cfg.Import.RetryDelay < 0 || cfg.Import.MaxRetryDelay < cfg.Import.RetryDelay {
+		errs = append(errs, fmt.Errorf("import retry_delay must not be negative or exceed max_retry_delay"))
+	}
+	if cfg.Import.Backups.MaxCount < 0 || cfg.Import.Backups.MaxAge < 0 {
+		errs = append(errs, fmt.Errorf("import backup limits must not be negative"))
+	}
+	for name, ref := range cfg.Import.Secrets {
+		if !IsSecretReference(ref) {
+			errs = append(errs, fmt.Errorf("import secret %s must be a !file:, !env: or !cred: reference", name))
+		}
+	}
+
+	// Validate standby pairing if enabled
+	if cfg.Standby.Enabled {
+		if cfg.Standby.LeaseFile == "" {
+			errs = append(errs, fmt.Errorf("standby lease_file is required when enabled"))
+		}
+		if cfg.Standby.RenewInterval <= 0 || cfg.Standby.LeaseTTL <= cfg.Standby.RenewInterval {
+			errs = append(errs, fmt.Errorf("standby renew interval must be positive and shorter than the lease ttl"))
+		}
+	}
+
+	// Validate location based profile switching if enabled
+	if cfg.Location.Enabled {
+		if err := validateLocation(cfg.Location); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	if err := validateHealth(cfg.Health); err != nil {
+		errs = append(errs, err)
+	}
+
+	// Validate notifications if enabled
+	if cfg.Notifications.Enabled {
+		if err := validateNotifications(cfg.Notifications); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	if cfg.Agent.HeartbeatInterval < 0 {
+		errs = append(errs, fmt.Errorf("agent heartbeat interval must not be negative"))
+	}
+
+	// Validate log aggregation
+	if cfg.Logging.Aggregation && cfg.Logging.MaxEntries <= 0 {
+		errs = append(errs, fmt.Errorf("logging max_entries must be positive when aggregation is enabled"))
+	}
+	if journal := cfg.Logging.Journal; journal.Enabled {
+		if len(journal.Units) == 0 {
+			errs = append(errs, fmt.Errorf("logging journal units are required when enabled"))
+		}
+		if journal.RestartDelay <= 0 {
+			errs = append(errs, fmt.Errorf("logging journal restart_delay must be positive"))
+		}
+	}
+
+	// Validate subprocess environment
+	for _, entry := range cfg.Services.Environment.Set {
+		if !strings.Contains(entry, "=") || strings.HasPrefix(entry, "=") {
+			errs = append(errs, fmt.Errorf("invalid environment entry %q: expected KEY=value", entry))
+		}
+	}
+	if err := cfg.Services.CLI.SubprocessConfig.validate("cli"); err != nil {
+		errs = append(errs, err)
+	}
+
+	// Validate per-client overrides
+	for _, name := range ClientNames {
+		overrides, _ := cfg.Clients.Overrides(name)
+		switch overrides.RestartPolicy {
+		case "", RestartNever, RestartOnFailure, RestartAlways:
+		default:
+			errs = append(errs, fmt.Errorf("invalid restart policy %q for client %s", overrides.RestartPolicy, name))
+		}
+		for _, entry := range overrides.Env {
+			if !strings.Contains(entry, "=") || strings.HasPrefix(entry, "=") {
+				errs = append(errs, fmt.Errorf("invalid env entry %q for client %s: expected KEY=value", entry, name))
+			}
+		}
+	}
+
+	// Validate host access lists
+	if _, err := security.NewAccessList(cfg.Security.AllowedHosts, cfg.Security.DeniedHosts); err != nil {
+		errs = append(errs, err)
+	}
+
+	// Validate static token names, the legacy api_token is named "default"
+	tokenNames := make(map[string]bool)
+	if cfg.Security.APIToken != "" {
+		tokenNames["default"] = true
+	}
+	for _, token := range cfg.Security.Auth.Tokens {
+		if tokenNames[token.Name] {
+			errs = append(errs, fmt.Errorf("duplicate static token name %q", token.Name))
+		}
+		tokenNames[token.Name] = true
+	}
+
+	// Validate OIDC configuration if enabled
+	if cfg.Security.Auth.OIDC.Enabled {
+		if cfg.Security.Auth.OIDC.Issuer == "" || cfg.Security.Auth.OIDC.Audience == "" {
+			errs = append(errs, fmt.Errorf("oidc issuer and audience are required when enabled"))
+		}
+	}
+
+	if _, err := privilege.Parse(cfg.Security.Privileges.KeepCapabilities); err != nil {
+		errs = append(errs, fmt.Errorf("invalid keep_capabilities: %w", err))
+	}
+	if cfg.Security.Privileges.Group != "" && cfg.Security.Privileges.User == "" {
+		errs = append(errs, fmt.Errorf("privileges group requires a user"))
+	}
+
+	// Validate kill switch if enabled
+	if cfg.Clients.KillSwitch.Enabled {
+		if len(cfg.Clients.KillSwitch.Command) == 0 || len(cfg.Clients.KillSwitch.ReleaseCommand) == 0 {
+			errs = append(errs, fmt.Errorf("kill switch command and release_command are required when enabled"))
+		}
+	}
+	if cfg.Clients.VersionCheck.Enabled {
+		if cfg.Clients.VersionCheck.Interval < 0 {
+			errs = append(errs, fmt.Errorf("client version_check interval must not be negative"))
+		}
+		if cfg.Clients.VersionCheck.Timeout <= 0 {
+			errs = append(errs, fmt.Errorf("client version_check timeout must be positive"))
+		}
+	}
+	if cfg.Clients.Upgrade.Enabled {
+		if err := validateUpgrade(cfg.Clients); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	return errors.Join(errs...)
 }
 
 // Save saves configuration to file
 func (c *Config) Save(path string) error {
 	v := viper.New()
-	
-	// Convert config back to map
-	if err := v.MergeConfigMap(map[string]interface{}{
-		"agent":    c.Agent,
-		"server":   c.Server,
-		"services": c.Services,
-		"clients":  c.Clients,
-		"logging":  c.Logging,
-		"security": c.Security,
-	}); err != nil {
-		return fmt.Errorf("failed to merge config: %w", err)
+
+	// Set keys by their config file names so the file loads back unchanged
+	for key, value := range Flatten(c) {
+		v.Set(key, value)
 	}
 
 	// Ensure directory exists
-	dir := path[:len(path)-len("/"+path[len(path)-1:])]
-	if err := os.MkdirAll(dir, 0755); err != nil {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
 		return fmt.Errorf("failed to create directory: %w", err)
 	}
 
 	return v.WriteConfigAs(path)
-} 
\ No newline at end of file
+}
@@ -2,7 +2,9 @@ package config
 
 import (
 	"os"
+	"path/filepath"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -53,17 +55,17 @@ services:
 
 	assert.Equal(t, 9090, cfg.Server.Port)
 	assert.Equal(t, "localhost", cfg.Server.Host)
-	assert.Equal(t, "60s", cfg.Server.Timeout)
+	assert.Equal(t, 60*time.Second, cfg.Server.Timeout)
 
 	assert.True(t, cfg.Services.Sboxctl.Enabled)
 	assert.Equal(t, []string{"sboxctl", "update", "--test"}, cfg.Services.Sboxctl.Command)
-	assert.Equal(t, "15m", cfg.Services.Sboxctl.Interval)
-	assert.Equal(t, "2m", cfg.Services.Sboxctl.Timeout)
+	assert.Equal(t, 15*time.Minute, cfg.Services.Sboxctl.Interval)
+	assert.Equal(t, 2*time.Minute, cfg.Services.Sboxctl.Timeout)
 	assert.True(t, cfg.Services.Sboxctl.StdoutCapture)
 
 	assert.True(t, cfg.Services.Sboxctl.HealthCheck.Enabled)
-	assert.Equal(t, "30s", cfg.Services.Sboxctl.HealthCheck.Interval)
-	assert.Equal(t, "5s", cfg.Services.Sboxctl.HealthCheck.Timeout)
+	assert.Equal(t, 30*time.Second, cfg.Services.Sboxctl.HealthCheck.Interval)
+	assert.Equal(t, 5*time.Second, cfg.Services.Sboxctl.HealthCheck.Timeout)
 }
 
 func TestLoad_WithDefaults(t *testing.T) {
@@ -76,17 +78,17 @@ func TestLoad_WithDefaults(t *testing.T) {
 	assert.Equal(t, "info", cfg.Agent.LogLevel)
 	assert.Equal(t, 8080, cfg.Server.Port)
 	assert.Equal(t, "127.0.0.1", cfg.Server.Host)
-	assert.Equal(t, "30s", cfg.Server.Timeout)
+	assert.Equal(t, 30*time.Second, cfg.Server.Timeout)
 
 	assert.True(t, cfg.Services.Sboxctl.Enabled)
 	assert.Equal(t, []string{"sboxctl", "update"}, cfg.Services.Sboxctl.Command)
-	assert.Equal(t, "30m", cfg.Services.Sboxctl.Interval)
-	assert.Equal(t, "5m", cfg.Services.Sboxctl.Timeout)
+	assert.Equal(t, 30*time.Minute, cfg.Services.Sboxctl.Interval)
+	assert.Equal(t, 5*time.Minute, cfg.Services.Sboxctl.Timeout)
 	assert.True(t, cfg.Services.Sboxctl.StdoutCapture)
 
 	assert.True(t, cfg.Services.Sboxctl.HealthCheck.Enabled)
-	assert.Equal(t, "1m", cfg.Services.Sboxctl.HealthCheck.Interval)
-	assert.Equal(t, "10s", cfg.Services.Sboxctl.HealthCheck.Timeout)
+	assert.Equal(t, time.Minute, cfg.Services.Sboxctl.HealthCheck.Interval)
+	assert.Equal(t, 10*time.Second, cfg.Services.Sboxctl.HealthCheck.Timeout)
 }
 
 func TestLoad_WithInvalidConfig(t *testing.T) {
@@ -171,7 +173,7 @@ func TestSave(t *testing.T) {
 		Server: ServerConfig{
 			Port:    9090,
 			Host:    "localhost",
-			Timeout: "60s",
+			Timeout: 60 * time.Second,
 		},
 	}
 
@@ -188,8 +190,1054 @@ func TestSave(t *testing.T) {
 	// Assert values match
 	assert.Equal(t, cfg.Agent.Name, loadedCfg.Agent.Name)
 	assert.Equal(t, cfg.Agent.Version, loadedCfg.Agent.Version)
-	assert.Equal(t, "info", loadedCfg.Agent.LogLevel)
+	assert.Equal(t, cfg.Agent.LogLevel, loadedCfg.Agent.LogLevel)
 	assert.Equal(t, cfg.Server.Port, loadedCfg.Server.Port)
 	assert.Equal(t, cfg.Server.Host, loadedCfg.Server.Host)
 	assert.Equal(t, cfg.Server.Timeout, loadedCfg.Server.Timeout)
 }
+
+func TestLoad_WithDropIns(t *testing.T) {
+	dir := t.TempDir()
+	configPath := filepath.Join(dir, "agent.yaml")
+	require.NoError(t, os.WriteFile(configPath, []byte(`
+agent:
+  name: "base"
+  version: "1.0.0"
+  log_level: "info"
+server:
+  port: 9090
+`), 0644))
+
+	dropInDir := filepath.Join(dir, DropInDirName)
+	require.NoError(t, os.Mkdir(dropInDir, 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(dropInDir, "20-name.yaml"), []byte(`
+agent:
+  name: "from-20"
+`), 0644))
+	require.NoError(t, os.WriteFile(filepath.Join(dropInDir, "10-name.yaml"), []byte(`
+agent:
+  name: "from-10"
+  log_level: "debug"
+`), 0644))
+	require.NoError(t, os.WriteFile(filepath.Join(dropInDir, "ignored.txt"), []byte(`agent: {name: "txt"}`), 0644))
+
+	cfg, err := Load(configPath)
+	require.NoError(t, err)
+
+	// Later files win, untouched keys keep base values
+	assert.Equal(t, "from-20", cfg.Agent.Name)
+	assert.Equal(t, "debug", cfg.Agent.LogLevel)
+	assert.Equal(t, 9090, cfg.Server.Port)
+}
+
+func TestLoad_WithInvalidDropIn(t *testing.T) {
+	dir := t.TempDir()
+	configPath := filepath.Join(dir, "agent.yaml")
+	require.NoError(t, os.WriteFile(configPath, []byte("agent:\n  name: base\n"), 0644))
+
+	dropInDir := filepath.Join(dir, DropInDirName)
+	require.NoError(t, os.Mkdir(dropInDir, 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(dropInDir, "bad.yaml"), []byte("agent: [unclosed"), 0644))
+
+	_, err := Load(configPath)
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "bad.yaml")
+}
+
+func TestLoad_StrictConfig(t *testing.T) {
+	dir := t.TempDir()
+	configPath := filepath.Join(dir, "agent.yaml")
+	require.NoError(t, os.WriteFile(configPath, []byte(`
+agent:
+  name: "strict"
+  nmae: "typo"
+servcies:
+  sboxctl:
+    enabled: false
+`), 0644))
+
+	// Unknown keys are ignored by default
+	_, err := Load(configPath)
+	require.NoError(t, err)
+
+	_, err = LoadWithOptions(configPath, LoadOptions{Strict: true})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "agent.nmae")
+	assert.Contains(t, err.Error(), "servcies")
+
+	// Strict mode can also be enabled from the file
+	require.NoError(t, os.WriteFile(configPath, []byte(`
+agent:
+  name: "strict"
+  strict_config: true
+server:
+  prot: 9090
+`), 0644))
+	_, err = Load(configPath)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "server.prot")
+
+	// Free-form maps accept any keys
+	require.NoError(t, os.WriteFile(configPath, []byte(`
+agent:
+  name: "strict"
+  strict_config: true
+  shutdown:
+    services:
+      anything: "5s"
+`), 0644))
+	_, err = Load(configPath)
+	assert.NoError(t, err)
+}
+
+func TestLoad_ClientOverrides(t *testing.T) {
+	configPath := filepath.Join(t.TempDir(), "agent.yaml")
+	require.NoError(t, os.WriteFile(configPath, []byte(`
+agent:
+  name: "overrides"
+  strict_config: true
+clients:
+  sing-box:
+    extra_args: ["-D", "/var/lib/sing-box"]
+    env: ["B=2", "A=1"]
+    restart_policy: "always"
+    template_vars:
+      log_level: "warn"
+    unit: "sing-box@main"
+    health_check: ["nc", "-z", "127.0.0.1", "2080"]
+`), 0644))
+
+	cfg, err := Load(configPath)
+	require.NoError(t, err)
+
+	overrides, ok := cfg.Clients.Overrides("sing-box")
+	require.True(t, ok)
+	assert.Equal(t, RestartAlways, overrides.RestartPolicy)
+	assert.Equal(t, map[string]string{"log_level": "warn"}, overrides.TemplateVars)
+	assert.Equal(t, []string{"nc", "-z", "127.0.0.1", "2080"}, overrides.HealthCheck)
+	assert.Equal(t, []string{"run", "-c", "config.json", "-D", "/var/lib/sing-box"},
+		overrides.Args([]string{"run", "-c", "config.json"}))
+	assert.Equal(t, []string{"PATH=/bin", "B=2", "A=1"}, overrides.Environ([]string{"PATH=/bin"}))
+
+	// Other clients keep the defaults
+	xray, ok := cfg.Clients.Overrides("xray")
+	require.True(t, ok)
+	assert.Equal(t, RestartOnFailure, xray.RestartPolicy)
+	assert.Empty(t, xray.ExtraArgs)
+
+	_, ok = cfg.Clients.Overrides("unknown")
+	assert.False(t, ok)
+
+	// Units default to the client name
+	unit, _ := cfg.Clients.Unit("sing-box")
+	assert.Equal(t, "sing-box@main", unit)
+	unit, _ = cfg.Clients.Unit("xray")
+	assert.Equal(t, "xray", unit)
+
+	// Commands run the clients in the foreground with their config
+	command, ok := cfg.Clients.Command("sing-box")
+	require.True(t, ok)
+	assert.Equal(t, []string{"/usr/local/bin/sing-box", "run", "-c", "/etc/sing-box/config.json", "-D", "/var/lib/sing-box"}, command)
+	command, _ = cfg.Clients.Command("clash")
+	assert.Equal(t, []string{"/usr/local/bin/clash", "-f", "/etc/clash/config.yaml"}, command)
+	_, ok = cfg.Clients.Command("unknown")
+	assert.False(t, ok)
+
+	// Checkers test a config file without running the client
+	command, ok = cfg.Clients.CheckCommand("xray", "/tmp/xray.json")
+	require.True(t, ok)
+	assert.Equal(t, []string{"/usr/local/bin/xray", "run", "-test", "-c", "/tmp/xray.json"}, command)
+	_, ok = cfg.Clients.CheckCommand("hysteria", "/tmp/hysteria.json")
+	assert.False(t, ok)
+
+	assert.Equal(t, VersionCheckConfig{Enabled: true, Interval: 6 * time.Hour, Timeout: 10 * time.Second}, cfg.Clients.VersionCheck)
+	assert.Equal(t, UpgradeConfig{
+		APIURL:          "https://api.github.com",
+		Restart:         true,
+		Timeout:         5 * time.Minute,
+		RequireChecksum: true,
+	}, cfg.Clients.Upgrade)
+}
+
+func TestLoad_InvalidVersionCheck(t *testing.T) {
+	configPath := filepath.Join(t.TempDir(), "agent.yaml")
+	require.NoError(t, os.WriteFile(configPath, []byte(`
+clients:
+  version_check:
+    timeout: 0s
+`), 0644))
+
+	_, err := Load(configPath)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "client version_check timeout must be positive")
+}
+
+func TestLoad_Upgrade(t *testing.T) {
+	configPath := filepath.Join(t.TempDir(), "agent.yaml")
+	require.NoError(t, os.WriteFile(configPath, []byte(`
+clients:
+  upgrade:
+    enabled: true
+    schedule: 24h
+    versions:
+      sing-box: 1.12.0
+    public_key: "11qYAYKxCrfVS/7TyWQHOg7hcvPapiMlrwIaaPcHURo="
+`), 0644))
+
+	cfg, err := Load(configPath)
+	require.NoError(t, err)
+	assert.Equal(t, 24*time.Hour, cfg.Clients.Upgrade.Schedule)
+	assert.Equal(t, map[string]string{"sing-box": "1.12.0"}, cfg.Clients.Upgrade.Versions)
+	key, err := cfg.Clients.Upgrade.Key()
+	require.NoError(t, err)
+	assert.Len(t, key, 32)
+
+	require.NoError(t, os.WriteFile(configPath, []byte(`
+clients:
+  upgrade:
+    enabled: true
+    public_key: "not a key"
+`), 0644))
+	_, err = Load(configPath)
+	assert.ErrorContains(t, err, "client upgrade public key must be a base64 ed25519 public key")
+
+	require.NoError(t, os.WriteFile(configPath, []byte(`
+clients:
+  upgrade:
+    enabled: true
+    versions:
+      v2ray: 5.0.0
+`), 0644))
+	_, err = Load(configPath)
+	assert.ErrorContains(t, err, `unknown client "v2ray" in client upgrade versions`)
+}
+
+func TestLoad_Privileges(t *testing.T) {
+	configPath := filepath.Join(t.TempDir(), "agent.yaml")
+	require.NoError(t, os.WriteFile(configPath, []byte(`
+security:
+  privileges:
+    drop_capabilities: true
+    user: sboxagent
+`), 0644))
+
+	cfg, err := Load(configPath)
+	require.NoError(t, err)
+	assert.True(t, cfg.Security.Privileges.Enabled())
+	assert.Contains(t, cfg.Security.Privileges.KeepCapabilities, "CAP_NET_ADMIN")
+
+	require.NoError(t, os.WriteFile(configPath, []byte(`
+security:
+  privileges:
+    drop_capabilities: true
+    keep_capabilities: [net_admin, CAP_TELEPORT]
+`), 0644))
+	_, err = Load(configPath)
+	assert.ErrorContains(t, err, `invalid keep_capabilities: unknown capability "CAP_TELEPORT"`)
+}
+
+func TestLoad_StartupNeeds(t *testing.T) {
+	configPath := filepath.Join(t.TempDir(), "agent.yaml")
+	require.NoError(t, os.WriteFile(configPath, []byte(`
+services:
+  startup:
+    needs:
+      api: [clients]
+`), 0644))
+
+	cfg, err := Load(configPath)
+	require.NoError(t, err)
+	assert.Equal(t, map[string][]string{"api": {"clients"}}, cfg.Services.Startup.Needs)
+	assert.Equal(t, 30*time.Second, cfg.Services.Startup.NetworkTimeout)
+
+	require.NoError(t, os.WriteFile(configPath, []byte(`
+services:
+  startup:
+    needs:
+      clients: [database]
+`), 0644))
+	_, err = Load(configPath)
+	assert.ErrorContains(t, err, `unknown startup step "database"`)
+}
+
+func TestLoad_InvalidRestartPolicy(t *testing.T) {
+	configPath := filepath.Join(t.TempDir(), "agent.yaml")
+	require.NoError(t, os.WriteFile(configPath, []byte(`
+clients:
+  clash:
+    restart_policy: "sometimes"
+`), 0644))
+
+	_, err := Load(configPath)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), `invalid restart policy "sometimes" for client clash`)
+}
+
+func TestLoad_InvalidImportSecret(t *testing.T) {
+	configPath := filepath.Join(t.TempDir(), "agent.yaml")
+	require.NoError(t, os.WriteFile(configPath, []byte(`
+import:
+  secrets:
+    wg_key: "plain-text-key"
+`), 0644))
+
+	_, err := Load(configPath)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "import secret wg_key must be a !file:, !env: or !cred: reference")
+}
+
+func TestLoad_Durations(t *testing.T) {
+	configPath := filepath.Join(t.TempDir(), "agent.yaml")
+	require.NoError(t, os.WriteFile(configPath, []byte(`
+services:
+  sboxctl:
+    interval: "90s"
+    timeout: "2m"
+`), 0644))
+
+	cfg, err := Load(configPath)
+	require.NoError(t, err)
+	assert.Equal(t, 90*time.Second, cfg.Services.Sboxctl.Interval)
+	assert.Equal(t, 2*time.Minute, cfg.Services.Sboxctl.Timeout)
+}
+
+func TestLoad_SubprocessSettings(t *testing.T) {
+	configPath := filepath.Join(t.TempDir(), "agent.yaml")
+	require.NoError(t, os.WriteFile(configPath, []byte(`
+agent:
+  strict_config: true
+services:
+  sboxctl:
+    work_dir: "/var/lib/sboxagent"
+    limits:
+      cpu_time: "2m"
+      memory_mb: 512
+      open_files: 1024
+  cli:
+    env: ["HTTPS_PROXY=http://127.0.0.1:3128", "SBOXMGR_CONFIG=/etc/sboxmgr.toml"]
+    search_path: ["/opt/sboxmgr/bin", "/usr/bin"]
+`), 0644))
+
+	cfg, err := Load(configPath)
+	require.NoError(t, err)
+	assert.Equal(t, "/var/lib/sboxagent", cfg.Services.Sboxctl.WorkDir)
+	assert.Equal(t, ResourceLimits{CPUTime: 2 * time.Minute, MemoryMB: 512, OpenFiles: 1024}, cfg.Services.Sboxctl.Limits)
+	assert.Equal(t, ResourceLimits{}, cfg.Services.CLI.Limits)
+	assert.Equal(t, []string{
+		"PATH=/usr/local/bin",
+		"HTTPS_PROXY=http://127.0.0.1:3128",
+		"SBOXMGR_CONFIG=/etc/sboxmgr.toml",
+		"PATH=/opt/sboxmgr/bin:/usr/bin",
+	}, cfg.Services.CLI.Environ([]string{"PATH=/usr/local/bin"}))
+
+	require.NoError(t, os.WriteFile(configPath, []byte(`
+services:
+  cli:
+    work_dir: "relative/dir"
+`), 0644))
+	_, err = Load(configPath)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "cli work_dir must be an absolute path")
+
+	require.NoError(t, os.WriteFile(configPath, []byte(`
+services:
+  sboxctl:
+    group: "nogroup"
+`), 0644))
+	_, err = Load(configPath)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "sboxctl group requires a user")
+
+	require.NoError(t, os.WriteFile(configPath, []byte(`
+services:
+  cli:
+    limits:
+      memory_mb: -1
+`), 0644))
+	_, err = Load(configPath)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "cli limits must not be negative")
+}
+
+func TestLoad_CLIActionTimeouts(t *testing.T) {
+	configPath := filepath.Join(t.TempDir(), "agent.yaml")
+	require.NoError(t, os.WriteFile(configPath, []byte(`
+services:
+  cli:
+    timeouts:
+      export: "10m"
+      reload: "15s"
+`), 0644))
+
+	cfg, err := Load(configPath)
+	require.NoError(t, err)
+	assert.Equal(t, 10*time.Minute, cfg.Services.CLI.ActionTimeout("export", time.Minute))
+	assert.Equal(t, 15*time.Second, cfg.Services.CLI.ActionTimeout("reload", time.Minute))
+	assert.Equal(t, time.Minute, cfg.Services.CLI.ActionTimeout("systemctl", time.Minute))
+
+	require.NoError(t, os.WriteFile(configPath, []byte(`
+services:
+  cli:
+    timeouts:
+      generate: "10m"
+`), 0644))
+	_, err = Load(configPath)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), `unknown cli timeout action "generate"`)
+}
+
+func TestLoad_SboxctlSchedule(t *testing.T) {
+	configPath := filepath.Join(t.TempDir(), "agent.yaml")
+	require.NoError(t, os.WriteFile(configPath, []byte(`
+services:
+  sboxctl:
+    schedule: "0 4 * * *"
+    splay: "15m"
+`), 0644))
+
+	cfg, err := Load(configPath)
+	require.NoError(t, err)
+	assert.Equal(t, "0 4 * * *", cfg.Services.Sboxctl.Schedule)
+	assert.Equal(t, 15*time.Minute, cfg.Services.Sboxctl.Splay)
+
+	require.NoError(t, os.WriteFile(configPath, []byte(`
+services:
+  sboxctl:
+    schedule: "daily at 4"
+`), 0644))
+	_, err = Load(configPath)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "invalid sboxctl schedule")
+}
+
+func TestLoad_SboxctlCircuitBreaker(t *testing.T) {
+	configPath := filepath.Join(t.TempDir(), "agent.yaml")
+	require.NoError(t, os.WriteFile(configPath, []byte("agent:\n  name: test\n"), 0644))
+
+	cfg, err := Load(configPath)
+	require.NoError(t, err)
+	assert.Equal(t, 5, cfg.Services.Sboxctl.CircuitBreaker.Threshold)
+	assert.Equal(t, 15*time.Minute, cfg.Services.Sboxctl.CircuitBreaker.Cooldown)
+	assert.Equal(t, []string{"sboxctl", "--version"}, cfg.Services.Sboxctl.CircuitBreaker.ProbeCommand)
+
+	require.NoError(t, os.WriteFile(configPath, []byte(`
+services:
+  sboxctl:
+    circuit_breaker:
+      threshold: 3
+      cooldown: 0s
+`), 0644))
+	_, err = Load(configPath)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "sboxctl circuit breaker cooldown must be positive")
+}
+
+func TestLoad_SboxctlInstances(t *testing.T) {
+	configPath := filepath.Join(t.TempDir(), "agent.yaml")
+	require.NoError(t, os.WriteFile(configPath, []byte(`
+services:
+  sboxctl:
+    enabled: true
+    command: ["sboxctl", "run"]
+    interval: 10m
+    timeout: 1m
+    instances:
+      work:
+        command: ["sboxctl", "run", "--client", "xray"]
+        interval: 1h
+      home:
+        enabled: false
+`), 0644))
+
+	cfg, err := Load(configPath)
+	require.NoError(t, err)
+	require.Len(t, cfg.Services.Sboxctl.Instances, 2)
+
+	work := cfg.Services.Sboxctl.Instances["work"]
+	assert.True(t, work.Enabled)
+	assert.Equal(t, []string{"sboxctl", "run", "--client", "xray"}, work.Command)
+	assert.Equal(t, time.Hour, work.Interval)
+	assert.Equal(t, time.Minute, work.Timeout)
+	assert.Equal(t, 5, work.CircuitBreaker.Threshold)
+	assert.Nil(t, work.Instances)
+
+	home := cfg.Services.Sboxctl.Instances["home"]
+	assert.False(t, home.Enabled)
+	assert.Equal(t, 10*time.Minute, home.Interval)
+
+	assert.Equal(t, "1h0m0s", Flatten(cfg)["services.sboxctl.instances.work.interval"])
+
+	// Saved instances load back unchanged
+	savedPath := filepath.Join(t.TempDir(), "saved.yaml")
+	require.NoError(t, cfg.Save(savedPath))
+	saved, err := Load(savedPath)
+	require.NoError(t, err)
+	require.Len(t, saved.Services.Sboxctl.Instances, 2)
+	assert.Equal(t, work.Command, saved.Services.Sboxctl.Instances["work"].Command)
+	assert.Equal(t, work.Interval, saved.Services.Sboxctl.Instances["work"].Interval)
+	assert.False(t, saved.Services.Sboxctl.Instances["home"].Enabled)
+
+	require.NoError(t, os.WriteFile(configPath, []byte(`
+services:
+  sboxctl:
+    instances:
+      broken:
+        enabled: true
+        interval: 0s
+`), 0644))
+	_, err = Load(configPath)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "sboxctl instance broken: sboxctl interval must be positive")
+}
+
+func TestLoad_InvalidDuration(t *testing.T) {
+	tests := []struct {
+		name  string
+		value string
+		err   string
+	}{
+		{"unparseable", `"soon"`, `invalid duration "soon"`},
+		{"bare number", `30`, `invalid duration 30`},
+		{"not positive", `"0s"`, "sboxctl interval must be positive"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			configPath := filepath.Join(t.TempDir(), "agent.yaml")
+			require.NoError(t, os.WriteFile(configPath, []byte(`
+services:
+  sboxctl:
+    interval: `+tt.value+`
+`), 0644))
+
+			_, err := Load(configPath)
+			require.Error(t, err)
+			assert.Contains(t, err.Error(), tt.err)
+		})
+	}
+}
+
+func TestLoad_InvalidDurationFromEnvAndRuntime(t *testing.T) {
+	configPath := filepath.Join(t.TempDir(), "agent.yaml")
+	require.NoError(t, os.WriteFile(configPath, []byte("agent:\n  name: test\n"), 0644))
+
+	t.Setenv("SBOXAGENT_CLI_TIMEOUT", "soon")
+	_, err := Load(configPath)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), `invalid duration "soon"`)
+
+	t.Setenv("SBOXAGENT_CLI_TIMEOUT", "45s")
+	cfg, err := Load(configPath)
+	require.NoError(t, err)
+	_, err = cfg.With("services.cli.timeout", "soon")
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), `invalid duration "soon"`)
+}
+
+func TestLoad_Import(t *testing.T) {
+	configPath := filepath.Join(t.TempDir(), "agent.yaml")
+	require.NoError(t, os.WriteFile(configPath, []byte(`
+import:
+  enabled: true
+  subscription_url: "https://sub.example.com/list"
+  client_type: "xray"
+  schedule: "6h"
+  options:
+    exclude: "ru"
+`), 0644))
+
+	cfg, err := Load(configPath)
+	require.NoError(t, err)
+	assert.Equal(t, "xray", cfg.Import.ClientType)
+	assert.Equal(t, 6*time.Hour, cfg.Import.Schedule)
+	assert.Equal(t, 2*time.Minute, cfg.Import.Timeout)
+	assert.Equal(t, []string{"sboxmgr", "export", "--format", "agent"}, cfg.Import.Command)
+	assert.Equal(t, map[string]string{"exclude": "ru"}, cfg.Import.Options)
+	assert.Equal(t, BackupConfig{MaxCount: 10, MaxAge: 720 * time.Hour}, cfg.Import.Backups)
+	assert.True(t, cfg.Import.CheckPorts)
+	assert.True(t, cfg.Import.CheckConfig)
+	assert.True(t, cfg.Import.HotReload)
+}
+
+func TestLoad_InvalidImport(t *testing.T) {
+	tests := []struct {
+		name   string
+		config string
+		err    string
+	}{
+		{"missing url", "client_type: sing-box", "subscription_url or sources is required"},
+		{"unknown client", "subscription_url: https://sub\n  client_type: wireguard", `unknown import client type "wireguard"`},
+		{"zero schedule", "subscription_url: https://sub\n  schedule: 0s", "schedule and timeout must be positive"},
+		{"url and sources", "subscription_url: https://sub\n  sources: [{name: a, url: https://a}]", "mutually exclusive"},
+		{"duplicate source", "sources: [{name: a, url: https://a}, {name: a, url: https://b}]", `duplicate import source "a"`},
+		{"source without url", "sources: [{name: a}]", "import source a has no url"},
+		{"bad filter", "sources: [{name: a, url: https://a, exclude: ['[']}]", `invalid filter "["`},
+		{"unknown clients", "subscription_url: https://sub\n  clients: [sing-box, wireguard]", `unknown import client "wireguard"`},
+		{"duplicate clients", "subscription_url: https://sub\n  clients: [xray, xray]", `duplicate import client "xray"`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			configPath := filepath.Join(t.TempDir(), "agent.yaml")
+			data := "import:\n  enabled: true\n  " + tt.config + "\n"
+			require.NoError(t, os.WriteFile(configPath, []byte(data), 0644))
+
+			_, err := Load(configPath)
+			require.Error(t, err)
+			assert.Contains(t, err.Error(), tt.err)
+		})
+	}
+}
+
+func TestLoad_InvalidStandby(t *testing.T) {
+	tests := []struct {
+		name   string
+		config string
+		err    string
+	}{
+		{"missing lease file", "lease_ttl: 30s", "standby lease_file is required"},
+		{"renew not shorter than ttl", "lease_file: /shared/lease\n  lease_ttl: 10s\n  renew_interval: 10s", "shorter than the lease ttl"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			configPath := filepath.Join(t.TempDir(), "agent.yaml")
+			data := "standby:\n  enabled: true\n  " + tt.config + "\n"
+			require.NoError(t, os.WriteFile(configPath, []byte(data), 0644))
+
+			_, err := Load(configPath)
+			require.Error(t, err)
+			assert.Contains(t, err.Error(), tt.err)
+		})
+	}
+}
+
+func TestLoad_InvalidNotifications(t *testing.T) {
+	tests := []struct {
+		name   string
+		config string
+		err    string
+	}{
+		{"no channel", "events: [IMPORT_FAILED]", "at least one enabled channel"},
+		{"webhook without url", "webhook: {enabled: true}", "webhook url is required"},
+		{"telegram without chat", "telegram: {enabled: true, bot_token: abc}", "bot_token and chat_id are required"},
+		{"retry above max", "retry_interval: 1h\n  webhook: {enabled: true, url: http://hook}", "max_retry_interval at least retry_interval"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			configPath := filepath.Join(t.TempDir(), "agent.yaml")
+			data := "notifications:\n  enabled: true\n  " + tt.config + "\n"
+			require.NoError(t, os.WriteFile(configPath, []byte(data), 0644))
+
+			_, err := Load(configPath)
+			require.Error(t, err)
+			assert.Contains(t, err.Error(), tt.err)
+		})
+	}
+}
+
+func TestEnvironmentConfig_Environ(t *testing.T) {
+	env := EnvironmentConfig{
+		Allow: []string{"PATH", "LC_*"},
+		Set:   []string{"PATH=/opt/bin"},
+	}
+	base := []string{"PATH=/usr/bin", "LC_ALL=C", "API_TOKEN=secret", "PATHEXT=x"}
+
+	assert.Equal(t, []string{
+		"PATH=/usr/bin",
+		"LC_ALL=C",
+		"SBOX_AGENT_NAME=test",
+		"PATH=/opt/bin",
+	}, env.Environ(base, map[string]string{"SBOX_AGENT_NAME": "test"}))
+
+	env.InheritAll = true
+	assert.Contains(t, env.Environ(base, nil), "API_TOKEN=secret")
+}
+
+func TestLoad_Services(t *testing.T) {
+	configPath := filepath.Join(t.TempDir(), "agent.yaml")
+	require.NoError(t, os.WriteFile(configPath, []byte(`
+services:
+  cli:
+    enabled: true
+    path: "sh"
+    max_retries: 5
+  systemd:
+    enabled: true
+  monitoring:
+    enabled: true
+    interval: 1m
+`), 0644))
+	t.Setenv("SBOXAGENT_SYSTEMD_SERVICE_NAME", "xray")
+	t.Setenv("SBOXAGENT_CLI_TIMEOUT", "45s")
+
+	cfg, err := Load(configPath)
+	require.NoError(t, err)
+	assert.Equal(t, "sh", cfg.Services.CLI.Path)
+	assert.Equal(t, 45*time.Second, cfg.Services.CLI.Timeout)
+	assert.Equal(t, 5, cfg.Services.CLI.MaxRetries)
+	assert.Equal(t, 5*time.Second, cfg.Services.CLI.RetryDelay)
+	assert.Equal(t, time.Minute, cfg.Services.CLI.MaxRetryDelay)
+	assert.Equal(t, 4, cfg.Services.CLI.MaxConcurrent)
+	assert.Equal(t, 30*time.Second, cfg.Services.CLI.QueueTimeout)
+	assert.Equal(t, "xray", cfg.Services.Systemd.ServiceName)
+	assert.Equal(t, 30*time.Second, cfg.Services.Systemd.Timeout)
+	assert.Equal(t, time.Minute, cfg.Services.Monitoring.Interval)
+	assert.Equal(t, 3, cfg.Services.Monitoring.FailureThreshold)
+	assert.Equal(t, SupervisorAuto, cfg.Services.Supervisor.Mode)
+	assert.Equal(t, time.Second, cfg.Services.Supervisor.RestartDelay)
+	assert.Equal(t, time.Minute, cfg.Services.Supervisor.MaxRestartDelay)
+	assert.Equal(t, 10*time.Second, cfg.Services.Supervisor.StopTimeout)
+	assert.Equal(t, 5, cfg.Services.Supervisor.MaxRestarts)
+	assert.Equal(t, 5*time.Minute, cfg.Services.Supervisor.RestartWindow)
+}
+
+func TestLoad_InvalidServices(t *testing.T) {
+	tests := []struct {
+		name   string
+		config string
+		err    string
+	}{
+		{"missing cli", "cli:\n    enabled: true\n    path: /nonexistent/sboxmgr", "cli executable not found"},
+		{"too many retries", "cli:\n    enabled: true\n    path: sh\n    max_retries: 50", "cli max_retries must be between 0 and 10"},
+		{"delay over max", "cli:\n    enabled: true\n    path: sh\n    retry_delay: 2m", "cli retry_delay must not be negative or exceed max_retry_delay"},
+		{"too many commands", "cli:\n    max_concurrent: 100", "cli max_concurrent must be between 0 and 32"},
+		{"no service name", "systemd:\n    enabled: true\n    service_name: ''", "systemd service_name is required"},
+		{"zero interval", "monitoring:\n    enabled: true\n    interval: 0s", "monitoring interval must be positive"},
+		{"timeout over interval", "monitoring:\n    enabled: true\n    interval: 5s\n    timeout: 10s", "not exceed the interval"},
+		{"zero threshold", "monitoring:\n    enabled: true\n    failure_threshold: 0", "failure_threshold must be between 1 and 10"},
+		{"supervisor mode", "supervisor:\n    mode: always", "supervisor mode must be auto, on or off"},
+		{"supervisor delay", "supervisor:\n    restart_delay: 2m", "supervisor restart_delay must be positive"},
+		{"supervisor stop timeout", "supervisor:\n    mode: on\n    stop_timeout: 0s", "supervisor stop_timeout must be positive"},
+		{"supervisor max restarts", "supervisor:\n    max_restarts: -1", "supervisor max_restarts must not be negative"},
+		{"supervisor restart window", "supervisor:\n    restart_window: 0s", "supervisor restart_window must be positive"},
+		{"connectivity url", "monitoring:\n    connectivity:\n      enabled: true\n      url: example.com", "connectivity url must be an http or https url"},
+		{"connectivity proxy", "monitoring:\n    connectivity:\n      enabled: true\n      proxy: 127.0.0.1:2080", "connectivity proxy must be a socks5:// or http:// url"},
+		{"connectivity window", "monitoring:\n    connectivity:\n      enabled: true\n      window: 0", "connectivity window must be positive"},
+		{"connectivity success rate", "monitoring:\n    connectivity:\n      enabled: true\n      min_success_rate: 120", "connectivity min_success_rate must be between 0 and 100"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			configPath := filepath.Join(t.TempDir(), "agent.yaml")
+			data := "services:\n  " + tt.config + "\n"
+			require.NoError(t, os.WriteFile(configPath, []byte(data), 0644))
+
+			_, err := Load(configPath)
+			require.Error(t, err)
+			assert.Contains(t, err.Error(), tt.err)
+		})
+	}
+}
+
+func TestLoad_Profiles(t *testing.T) {
+	configPath := filepath.Join(t.TempDir(), "agent.yaml")
+	require.NoError(t, os.WriteFile(configPath, []byte(`
+agent:
+  name: "edge"
+  log_level: "info"
+services:
+  sboxctl:
+    interval: 30m
+profiles:
+  home:
+    agent:
+      log_level: "debug"
+  vps:
+    agent:
+      profile: "server"
+    services:
+      sboxctl:
+        interval: 5m
+`), 0644))
+
+	// Without a profile the section is ignored, even in strict mode
+	cfg, err := LoadWithOptions(configPath, LoadOptions{Strict: true})
+	require.NoError(t, err)
+	assert.Equal(t, "info", cfg.Agent.LogLevel)
+	assert.Equal(t, "", cfg.Agent.Profile)
+
+	cfg, err = LoadWithOptions(configPath, LoadOptions{Profile: "home"})
+	require.NoError(t, err)
+	assert.Equal(t, "debug", cfg.Agent.LogLevel)
+	assert.Equal(t, "home", cfg.Agent.Profile)
+	assert.Equal(t, "edge", cfg.Agent.Name)
+
+	// The profile set explicitly wins over the profile name
+	t.Setenv(ProfileEnv, "vps")
+	cfg, err = Load(configPath)
+	require.NoError(t, err)
+	assert.Equal(t, "server", cfg.Agent.Profile)
+	assert.Equal(t, 5*time.Minute, cfg.Services.Sboxctl.Interval)
+	assert.Equal(t, "info", cfg.Agent.LogLevel)
+
+	// Reload keeps the selected profile
+	reloaded, err := cfg.Reload()
+	require.NoError(t, err)
+	assert.Empty(t, Diff(cfg, reloaded))
+
+	_, err = LoadWithOptions(configPath, LoadOptions{Profile: "lab"})
+	assert.ErrorContains(t, err, `unknown profile "lab" (available: home, vps)`)
+}
+
+func TestLoad_InvalidLocation(t *testing.T) {
+	tests := []struct {
+		name   string
+		config string
+		err    string
+	}{
+		{"unknown profile", "rules:\n    - profile: office\n      subnets: [10.0.0.0/8]", `location rule selects unknown profile "office"`},
+		{"unknown default", "default_profile: lab", `location rule selects unknown profile "lab"`},
+		{"no criteria", "rules:\n    - profile: home", "location rule for home has no criteria"},
+		{"bad subnet", "rules:\n    - profile: home\n      subnets: [10.0.0.0]", `invalid subnet "10.0.0.0"`},
+		{"bad mac", "rules:\n    - profile: home\n      gateway_macs: [router]", `invalid gateway mac "router"`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			configPath := filepath.Join(t.TempDir(), "agent.yaml")
+			data := "profiles:\n  home: {}\nlocation:\n  enabled: true\n  " + tt.config + "\n"
+			require.NoError(t, os.WriteFile(configPath, []byte(data), 0644))
+
+			_, err := Load(configPath)
+			require.Error(t, err)
+			assert.Contains(t, err.Error(), tt.err)
+		})
+	}
+}
+
+func TestLoad_Unit(t *testing.T) {
+	cfg, err := Load("")
+	require.NoError(t, err)
+	assert.Equal(t, "strict", cfg.Agent.Unit.ProtectSystem)
+	assert.Equal(t, []string{"{{.Binary}}", "-config", "{{.ConfigPath}}", "-socket", "{{.SocketPath}}"}, cfg.Agent.Unit.ExecStart)
+	assert.Equal(t, 30*time.Second, cfg.Agent.Unit.WatchdogSec)
+
+	tests := []struct {
+		name   string
+		config string
+		err    string
+	}{
+		{"protect system", "protect_system: read-only", "protect_system must be strict, full, true or false"},
+		{"restart sec", "restart_sec: -1s", "restart_sec and watchdog_sec must not be negative"},
+		{"extra", "extra: [MemoryMax]", `extra line "MemoryMax" is not Key=Value`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			configPath := filepath.Join(t.TempDir(), "agent.yaml")
+			data := "agent:\n  unit:\n    " + tt.config + "\n"
+			require.NoError(t, os.WriteFile(configPath, []byte(data), 0644))
+
+			_, err := Load(configPath)
+			require.Error(t, err)
+			assert.Contains(t, err.Error(), tt.err)
+		})
+	}
+}
+
+func TestLoad_HealthExec(t *testing.T) {
+	configPath := filepath.Join(t.TempDir(), "agent.yaml")
+	data := "health:\n  exec:\n    - name: vpn-route\n      command: [\"/usr/local/bin/check-route\", \"10.0.0.1\"]\n      timeout: 5s\n"
+	require.NoError(t, os.WriteFile(configPath, []byte(data), 0644))
+
+	cfg, err := Load(configPath)
+	require.NoError(t, err)
+	assert.Equal(t, []ExecCheckConfig{{
+		Name:    "vpn-route",
+		Command: []string{"/usr/local/bin/check-route", "10.0.0.1"},
+		Timeout: 5 * time.Second,
+	}}, cfg.Health.Exec)
+
+	tests := []struct {
+		name   string
+		config string
+		err    string
+	}{
+		{"no name", "- command: [\"true\"]", "exec health check 1 has no name"},
+		{"no command", "- name: route", "exec health check route has no command"},
+		{"duplicate", "- name: route\n      command: [\"true\"]\n    - name: route\n      command: [\"false\"]", "duplicate health check \"route\""},
+		{"negative timeout", "- name: route\n      command: [\"true\"]\n      timeout: -1s", "timeout must not be negative"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			configPath := filepath.Join(t.TempDir(), "agent.yaml")
+			data := "health:\n  exec:\n    " + tt.config + "\n"
+			require.NoError(t, os.WriteFile(configPath, []byte(data), 0644))
+
+			_, err := Load(configPath)
+			require.Error(t, err)
+			assert.Contains(t, err.Error(), tt.err)
+		})
+	}
+}
+
+func TestLoad_HealthEndpoints(t *testing.T) {
+	configPath := filepath.Join(t.TempDir(), "agent.yaml")
+	data := "health:\n  endpoints:\n    - name: socks\n      kind: socks5\n      address: 127.0.0.1:2080\n      url: https://www.gstatic.com/generate_204\n      timeout: 5s\n"
+	require.NoError(t, os.WriteFile(configPath, []byte(data), 0644))
+
+	cfg, err := Load(configPath)
+	require.NoError(t, err)
+	assert.Equal(t, []EndpointCheckConfig{{
+		Name:    "socks",
+		Kind:    EndpointSOCKS5,
+		Address: "127.0.0.1:2080",
+		URL:     "https://www.gstatic.com/generate_204",
+		Timeout: 5 * time.Second,
+	}}, cfg.Health.Endpoints)
+
+	tests := []struct {
+		name   string
+		config string
+		err    string
+	}{
+		{"kind", "- name: in\n      kind: udp\n      address: 127.0.0.1:53", "kind must be tcp, socks5 or http"},
+		{"address", "- name: in\n      kind: tcp\n      address: localhost", "endpoint health check in address"},
+		{"url on tcp", "- name: in\n      kind: tcp\n      address: 127.0.0.1:80\n      url: http://example.com", "url requires kind socks5 or http"},
+		{"url scheme", "- name: in\n      kind: http\n      address: 127.0.0.1:80\n      url: ftp://example.com", "must be an http or https url"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			configPath := filepath.Join(t.TempDir(), "agent.yaml")
+			data := "health:\n  endpoints:\n    " + tt.config + "\n"
+			require.NoError(t, os.WriteFile(configPath, []byte(data), 0644))
+
+			_, err := Load(configPath)
+			require.Error(t, err)
+			assert.Contains(t, err.Error(), tt.err)
+		})
+	}
+}
+
+func TestLoad_HealthDNS(t *testing.T) {
+	configPath := filepath.Join(t.TempDir(), "agent.yaml")
+	data := "health:\n  dns:\n    - name: dns\n      domain: example.com\n      server: 8.8.8.8:53\n      proxy: 127.0.0.1:2080\n      expect: [\"93.184.216.0/24\"]\n"
+	require.NoError(t, os.WriteFile(configPath, []byte(data), 0644))
+
+	cfg, err := Load(configPath)
+	require.NoError(t, err)
+	assert.Equal(t, []DNSCheckConfig{{
+		Name:   "dns",
+		Domain: "example.com",
+		Server: "8.8.8.8:53",
+		Proxy:  "127.0.0.1:2080",
+		Expect: []string{"93.184.216.0/24"},
+	}}, cfg.Health.DNS)
+
+	tests := []struct {
+		name   string
+		config string
+		err    string
+	}{
+		{"no domain", "- name: dns", "dns health check dns has no domain"},
+		{"server", "- name: dns\n      domain: example.com\n      server: 8.8.8.8", "dns health check dns server"},
+		{"proxy without server", "- name: dns\n      domain: example.com\n      proxy: 127.0.0.1:2080", "proxy requires a server"},
+		{"expect", "- name: dns\n      domain: example.com\n      expect: [\"example\"]", "expects invalid address"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			configPath := filepath.Join(t.TempDir(), "agent.yaml")
+			data := "health:\n  dns:\n    " + tt.config + "\n"
+			require.NoError(t, os.WriteFile(configPath, []byte(data), 0644))
+
+			_, err := Load(configPath)
+			require.Error(t, err)
+			assert.Contains(t, err.Error(), tt.err)
+		})
+	}
+}
+
+func TestLoad_HealthDisk(t *testing.T) {
+	configPath := filepath.Join(t.TempDir(), "agent.yaml")
+	require.NoError(t, os.WriteFile(configPath, []byte("health:\n  disk:\n    paths: [\"/srv/backups\"]\n"), 0644))
+	cfg, err := Load(configPath)
+	require.NoError(t, err)
+	assert.Equal(t, DiskCheckConfig{Enabled: true, Paths: []string{"/srv/backups"}, WarningPercent: 90, CriticalPercent: 95}, cfg.Health.Disk)
+
+	require.NoError(t, os.WriteFile(configPath, []byte("health:\n  disk:\n    warning_percent: 97\n"), 0644))
+	_, err = Load(configPath)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "disk health check thresholds")
+}
+
+func TestLoad_HealthCertificates(t *testing.T) {
+	configPath := filepath.Join(t.TempDir(), "agent.yaml")
+	require.NoError(t, os.WriteFile(configPath, []byte("health:\n  certificates:\n    paths: [\"/etc/ssl/ca.pem\"]\n"), 0644))
+	cfg, err := Load(configPath)
+	require.NoError(t, err)
+	assert.Equal(t, CertificateCheckConfig{Enabled: true, Paths: []string{"/etc/ssl/ca.pem"}, Warning: 720 * time.Hour, Critical: 168 * time.Hour}, cfg.Health.Certificates)
+
+	require.NoError(t, os.WriteFile(configPath, []byte("health:\n  certificates:\n    warning: 24h\n"), 0644))
+	_, err = Load(configPath)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "certificate health check thresholds")
+}
+
+func TestLoad_HealthInterval(t *testing.T) {
+	configPath := filepath.Join(t.TempDir(), "agent.yaml")
+	require.NoError(t, os.WriteFile(configPath, []byte("agent:\n  name: test\n"), 0644))
+	cfg, err := Load(configPath)
+	require.NoError(t, err)
+	assert.Equal(t, 30*time.Second, cfg.Health.Interval)
+
+	require.NoError(t, os.WriteFile(configPath, []byte("health:\n  interval: -1s\n"), 0644))
+	_, err = Load(configPath)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "health interval must not be negative")
+}
+
+func TestLoad_HealthTrends(t *testing.T) {
+	configPath := filepath.Join(t.TempDir(), "agent.yaml")
+	require.NoError(t, os.WriteFile(configPath, []byte("health:\n  trends:\n    memory_limit_mb: 256\n"), 0644))
+	cfg, err := Load(configPath)
+	require.NoError(t, err)
+	assert.Equal(t, TrendsConfig{
+		Enabled: true, Window: 30, Horizon: 24 * time.Hour,
+		MemoryLimitMB: 256, ErrorRatePercent: 10, DiskMinFreeMB: 1024,
+	}, cfg.Health.Trends)
+
+	require.NoError(t, os.WriteFile(configPath, []byte("health:\n  trends:\n    window: 2\n"), 0644))
+	_, err = Load(configPath)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "health trends window")
+}
+
+func TestLoad_AggregatesValidationErrors(t *testing.T) {
+	// Every invalid setting is reported at once, across sections
+	configPath := filepath.Join(t.TempDir(), "agent.yaml")
+	require.NoError(t, os.WriteFile(configPath, []byte(`
+agent:
+  heartbeat_interval: "-1s"
+services:
+  startup:
+    network_timeout: "-1s"
+health:
+  interval: "-1s"
+`), 0644))
+	_, err := Load(configPath)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "agent heartbeat interval must not be negative")
+	assert.Contains(t, err.Error(), "startup network_timeout must not be negative")
+	assert.Contains(t, err.Error(), "health interval must not be negative")
+}
+
+func TestLoad_DuplicateTokenNames(t *testing.T) {
+	configPath := filepath.Join(t.TempDir(), "agent.yaml")
+	require.NoError(t, os.WriteFile(configPath, []byte(`
+security:
+  api_token: "legacy"
+  auth:
+    tokens:
+      - name: "sboxmgr"
+        token: "first"
+      - name: "sboxmgr"
+        token: "second"
+      - name: "default"
+        token: "third"
+`), 0644))
+	_, err := Load(configPath)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), `duplicate static token name "sboxmgr"`)
+	assert.Contains(t, err.Error(), `duplicate static token name "default"`)
+}
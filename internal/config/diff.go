@@ -0,0 +1,144 @@
+package config
+
+import (
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+)
+
+// maskedValue replaces sensitive values in diffs
+const maskedValue = "********"
+
+// Change describes a single differing config key
+type Change struct {
+	Key string      `json:"key"`
+	Old interface{} `json:"old"`
+	New interface{} `json:"new"`
+}
+
+// Path returns the config file the configuration was loaded from, or an empty
+// string if only defaults were used
+func (c *Config) Path() string {
+	return c.path
+}
+
+// Reload loads the configuration again from its file with the same options,
+// including the selected profile
+func (c *Config) Reload() (*Config, error) {
+	return LoadWithOptions(c.path, c.options)
+}
+
+// Profile returns the name of the profile selected at load, or an empty
+// string if none was
+func (c *Config) Profile() string {
+	return c.options.Profile
+}
+
+// WithProfile loads the configuration again from its file with another
+// profile selected
+func (c *Config) WithProfile(name string) (*Config, error) {
+	opts := c.options
+	opts.Profile = name
+	return LoadWithOptions(c.path, opts)
+}
+
+// Diff compares two configurations and returns the changed keys sorted by
+// name. Sensitive values are masked.
+func Diff(old, new *Config) []Change {
+	oldValues := Flatten(old)
+	newValues := Flatten(new)
+
+	keys := make(map[string]struct{}, len(oldValues))
+	for key := range oldValues {
+		keys[key] = struct{}{}
+	}
+	for key := range newValues {
+		keys[key] = struct{}{}
+	}
+
+	changes := []Change{}
+	for key := range keys {
+		oldValue, newValue := oldValues[key], newValues[key]
+		if reflect.DeepEqual(oldValue, newValue) {
+			continue
+		}
+		if IsSensitiveKey(key) {
+			oldValue, newValue = maskedValue, maskedValue
+		}
+		changes = append(changes, Change{Key: key, Old: oldValue, New: newValue})
+	}
+
+	sort.Slice(changes, func(i, j int) bool {
+		return changes[i].Key < changes[j].Key
+	})
+	return changes
+}
+
+// Flatten returns the configuration as dotted keys, using the same key names
+// as the config file
+func Flatten(cfg *Config) map[string]interface{} {
+	out := make(map[string]interface{})
+	if cfg != nil {
+		flattenValue(reflect.ValueOf(*cfg), "", out)
+	}
+	return out
+}
+
+// flattenValue walks structs by mapstructure tag and records leaf values
+func flattenValue(v reflect.Value, prefix string, out map[string]interface{}) {
+	// Durations are shown the way they are written in the config file
+	if d, ok := v.Interface().(time.Duration); ok {
+		out[prefix] = d.String()
+		return
+	}
+	if durations, ok := v.Interface().(map[string]time.Duration); ok {
+		values := make(map[string]string, len(durations))
+		for key, d := range durations {
+			values[key] = d.String()
+		}
+		out[prefix] = values
+		return
+	}
+	// Named sections such as sboxctl instances are walked like structs
+	if v.Kind() == reflect.Map && v.Type().Elem().Kind() == reflect.Struct {
+		for _, name := range v.MapKeys() {
+			flattenValue(v.MapIndex(name), prefix+"."+name.String(), out)
+		}
+		return
+	}
+	if v.Kind() != reflect.Struct {
+		out[prefix] = v.Interface()
+		return
+	}
+
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		tag := field.Tag.Get("mapstructure")
+		if !field.IsExported() || tag == "" || tag == "-" {
+			continue
+		}
+		// Squashed structs share the parent's keys
+		if strings.HasSuffix(tag, ",squash") {
+			flattenValue(v.Field(i), prefix, out)
+			continue
+		}
+		key := tag
+		if prefix != "" {
+			key = prefix + "." + tag
+		}
+		flattenValue(v.Field(i), key, out)
+	}
+}
+
+// IsSensitiveKey reports whether a config key holds a credential
+func IsSensitiveKey(key string) bool {
+	name := key[strings.LastIndex(key, ".")+1:]
+	for _, marker := range []string{"token", "secret", "password"} {
+		if strings.Contains(name, marker) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,37 @@
+package config
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDiff(t *testing.T) {
+	old := &Config{
+		Agent:    AgentConfig{Name: "agent", LogLevel: "info"},
+		Services: ServicesConfig{Sboxctl: SboxctlConfig{Command: []string{"sboxctl", "update"}}},
+		Security: SecurityConfig{APIToken: "old-token"},
+	}
+	new := &Config{
+		Agent:    AgentConfig{Name: "agent", LogLevel: "debug"},
+		Services: ServicesConfig{Sboxctl: SboxctlConfig{Command: []string{"sboxctl", "update", "--force"}}},
+		Security: SecurityConfig{APIToken: "new-token"},
+	}
+
+	changes := Diff(old, new)
+	assert.Equal(t, []Change{
+		{Key: "agent.log_level", Old: "info", New: "debug"},
+		{Key: "security.api_token", Old: maskedValue, New: maskedValue},
+		{Key: "services.sboxctl.command", Old: []string{"sboxctl", "update"}, New: []string{"sboxctl", "update", "--force"}},
+	}, changes)
+
+	assert.Empty(t, Diff(old, old))
+}
+
+func TestFlatten(t *testing.T) {
+	values := Flatten(&Config{Server: ServerConfig{Port: 8080, Tunnel: TunnelConfig{URL: "wss://manager"}}})
+	assert.Equal(t, 8080, values["server.port"])
+	assert.Equal(t, "wss://manager", values["server.tunnel.url"])
+	assert.Contains(t, values, "clients.sing-box.binary_path")
+	assert.NotContains(t, values, "path")
+}
@@ -0,0 +1,30 @@
+//go:build darwin
+
+package config
+
+import (
+	"os"
+	"path/filepath"
+)
+
+// On macOS the agent runs as a launchd agent of the user, so its files live
+// under ~/Library, or /Library when there is no home directory
+var (
+	// DefaultConfigDir is the configuration directory
+	DefaultConfigDir = filepath.Join(libraryDir(), "Application Support", "sboxagent")
+
+	// DefaultDataDir holds state such as the remote config cache and spools
+	DefaultDataDir = DefaultConfigDir
+
+	// DefaultLogDir holds the output of the agent written by launchd
+	DefaultLogDir = filepath.Join(libraryDir(), "Logs", "sboxagent")
+)
+
+// libraryDir returns ~/Library
+func libraryDir() string {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "/Library"
+	}
+	return filepath.Join(home, "Library")
+}
@@ -0,0 +1,15 @@
+//go:build !darwin && !windows
+
+package config
+
+var (
+	// DefaultConfigDir is the system-wide configuration directory
+	DefaultConfigDir = "/etc/sboxagent"
+
+	// DefaultDataDir holds state such as the remote config cache and spools
+	DefaultDataDir = "/var/lib/sboxagent"
+
+	// DefaultLogDir holds log files of the agent where its output does not
+	// go to a journal
+	DefaultLogDir = "/var/log/sboxagent"
+)
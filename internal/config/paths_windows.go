@@ -0,0 +1,29 @@
+//go:build windows
+
+package config
+
+import (
+	"os"
+	"path/filepath"
+)
+
+// On Windows the agent runs as a service, so its files live under
+// %ProgramData%
+var (
+	// DefaultConfigDir is the configuration directory
+	DefaultConfigDir = filepath.Join(programData(), "sboxagent")
+
+	// DefaultDataDir holds state such as the remote config cache and spools
+	DefaultDataDir = DefaultConfigDir
+
+	// DefaultLogDir holds log files of the agent
+	DefaultLogDir = filepath.Join(DefaultConfigDir, "logs")
+)
+
+// programData returns %ProgramData%
+func programData() string {
+	if dir := os.Getenv("ProgramData"); dir != "" {
+		return dir
+	}
+	return `C:\ProgramData`
+}
@@ -0,0 +1,50 @@
+package config
+
+import (
+	"fmt"
+	"io"
+	"reflect"
+
+	"github.com/spf13/viper"
+)
+
+// Print writes the effective configuration to w as "yaml" or "json", using
+// the same keys as the config file. Sensitive values are redacted.
+func Print(w io.Writer, cfg *Config, format string) error {
+	switch format {
+	case "yaml", "json":
+	default:
+		return fmt.Errorf("unsupported config format %q: expected yaml or json", format)
+	}
+
+	v := viper.New()
+	for key, value := range Flatten(cfg) {
+		if IsSensitiveKey(key) && !isEmptyValue(value) {
+			value = maskedValue
+		}
+		v.Set(key, value)
+	}
+
+	v.SetConfigType(format)
+	if err := v.WriteConfigTo(w); err != nil {
+		return fmt.Errorf("failed to write config: %w", err)
+	}
+	return nil
+}
+
+// isEmptyValue reports whether a flattened value is unset, so empty secrets
+// are shown as empty rather than masked
+func isEmptyValue(value interface{}) bool {
+	switch v := value.(type) {
+	case nil:
+		return true
+	case string:
+		return v == ""
+	}
+	rv := reflect.ValueOf(value)
+	switch rv.Kind() {
+	case reflect.Slice, reflect.Map:
+		return rv.Len() == 0
+	}
+	return false
+}
@@ -0,0 +1,49 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPrint(t *testing.T) {
+	configPath := filepath.Join(t.TempDir(), "agent.yaml")
+	require.NoError(t, os.WriteFile(configPath, []byte(`
+agent:
+  name: "printed"
+services:
+  sboxctl:
+    interval: "45m"
+security:
+  api_token: "super-secret"
+`), 0644))
+
+	cfg, err := Load(configPath)
+	require.NoError(t, err)
+
+	var out bytes.Buffer
+	require.NoError(t, Print(&out, cfg, "json"))
+
+	var printed map[string]interface{}
+	require.NoError(t, json.Unmarshal(out.Bytes(), &printed))
+	agent := printed["agent"].(map[string]interface{})
+	assert.Equal(t, "printed", agent["name"])
+	// Defaults are included
+	assert.Equal(t, "info", agent["log_level"])
+	sboxctl := printed["services"].(map[string]interface{})["sboxctl"].(map[string]interface{})
+	assert.Equal(t, "45m0s", sboxctl["interval"])
+	assert.NotContains(t, out.String(), "super-secret")
+	assert.Contains(t, out.String(), maskedValue)
+
+	out.Reset()
+	require.NoError(t, Print(&out, cfg, "yaml"))
+	assert.Contains(t, out.String(), "name: printed")
+	assert.NotContains(t, out.String(), "super-secret")
+
+	assert.Error(t, Print(&out, cfg, "toml"))
+}
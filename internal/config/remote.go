@@ -0,0 +1,273 @@
+package config
+
+import (
+	"bytes"
+	"context"
+	"crypto/ed25519"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/spf13/viper"
+)
+
+const (
+	// SignatureHeader carries the base64 ed25519 signature of a remote config body
+	SignatureHeader = "X-Signature"
+
+	// maxRemoteConfigSize limits the size of a remote config document
+	maxRemoteConfigSize = 1024 * 1024
+
+	// cacheSignaturePrefix starts the first line of the remote config cache,
+	// holding the signature of the document that follows
+	cacheSignaturePrefix = "# signature: "
+)
+
+// remoteHTTPClient creates the HTTP client of remote sources
+var remoteHTTPClient = func(timeout time.Duration) *http.Client {
+	return &http.Client{Timeout: timeout}
+}
+
+// RemoteDocument is a verified remote config document
+type RemoteDocument struct {
+	Data         []byte
+	Signature    []byte
+	ETag         string
+	LastModified string
+}
+
+// RemoteSource fetches signed configuration documents from an HTTPS URL.
+// Conditional requests are used so unchanged documents are not re-downloaded.
+type RemoteSource struct {
+	config    RemoteConfig
+	publicKey ed25519.PublicKey
+	client    *http.Client
+
+	mu           sync.Mutex
+	etag         string
+	lastModified string
+}
+
+// NewRemoteSource creates a new remote config source
+func NewRemoteSource(cfg RemoteConfig) (*RemoteSource, error) {
+	u, err := url.Parse(cfg.URL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid remote config url: %w", err)
+	}
+	if u.Scheme != "https" {
+		return nil, fmt.Errorf("remote config url must use https://, got %q", u.Scheme)
+	}
+
+	key, err := base64.StdEncoding.DecodeString(cfg.PublicKey)
+	if err != nil || len(key) != ed25519.PublicKeySize {
+		return nil, fmt.Errorf("remote config public key must be a base64 ed25519 public key")
+	}
+
+	return &RemoteSource{
+		config:    cfg,
+		publicKey: ed25519.PublicKey(key),
+		client:    remoteHTTPClient(cfg.Timeout),
+	}, nil
+}
+
+// PollInterval returns how often the source should be polled
+func (r *RemoteSource) PollInterval() time.Duration {
+	return r.config.PollInterval
+}
+
+// Fetch downloads the remote config. It returns nil without error if the
+// document has not changed since the last successful fetch.
+func (r *RemoteSource) Fetch(ctx context.Context) (*RemoteDocument, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, r.config.URL, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create remote config request: %w", err)
+	}
+
+	r.mu.Lock()
+	if r.etag != "" {
+		req.Header.Set("If-None-Match", r.etag)
+	}
+	if r.lastModified != "" {
+		req.Header.Set("If-Modified-Since", r.lastModified)
+	}
+	r.mu.Unlock()
+
+	resp, err := r.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch remote config: %w", err)
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusNotModified:
+		return nil, nil
+	case http.StatusOK:
+	default:
+		return nil, fmt.Errorf("remote config server returned status %d", resp.StatusCode)
+	}
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxRemoteConfigSize+1))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read remote config: %w", err)
+	}
+	if len(data) > maxRemoteConfigSize {
+		return nil, fmt.Errorf("remote config exceeds %d bytes", maxRemoteConfigSize)
+	}
+
+	signature, err := base64.StdEncoding.DecodeString(resp.Header.Get(SignatureHeader))
+	if err != nil {
+		return nil, fmt.Errorf("invalid remote config signature encoding: %w", err)
+	}
+
+	doc := &RemoteDocument{
+		Data:         data,
+		Signature:    signature,
+		ETag:         resp.Header.Get("ETag"),
+		LastModified: resp.Header.Get("Last-Modified"),
+	}
+	if err := r.Verify(doc.Data, doc.Signature); err != nil {
+		return nil, err
+	}
+
+	r.mu.Lock()
+	r.etag = doc.ETag
+	r.lastModified = doc.LastModified
+	r.mu.Unlock()
+
+	return doc, nil
+}
+
+// Verify checks the document signature and that it is a usable config overlay
+func (r *RemoteSource) Verify(data, signature []byte) error {
+	return verifyRemoteDocument(r.publicKey, data, signature)
+}
+
+// SaveCache stores a verified document so it is merged by Load on the next
+// start. The signature is kept on the first line of the same file, so a
+// crash never leaves a document next to the signature of another.
+func (r *RemoteSource) SaveCache(doc *RemoteDocument) error {
+	header := cacheSignaturePrefix + base64.StdEncoding.EncodeToString(doc.Signature) + "\n"
+	if err := writeFileAtomic(r.config.CacheFile, append([]byte(header), doc.Data...)); err != nil {
+		return fmt.Errorf("failed to write remote config cache: %w", err)
+	}
+	return nil
+}
+
+// readRemoteCache returns the cached document and its signature
+func readRemoteCache(path string) ([]byte, []byte, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	header, body, ok := bytes.Cut(data, []byte("\n"))
+	encoded, signed := strings.CutPrefix(string(header), cacheSignaturePrefix)
+	if !ok || !signed {
+		return nil, nil, fmt.Errorf("remote config cache has no signature")
+	}
+	signature, err := base64.StdEncoding.DecodeString(strings.TrimSpace(encoded))
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid remote config signature encoding: %w", err)
+	}
+	return body, signature, nil
+}
+
+// fetchRemoteCache refreshes the remote config cache from the source
+// configured in v, so the agent starts on the current document rather than
+// the one cached by its last run
+func fetchRemoteCache(ctx context.Context, v *viper.Viper) error {
+	source, err := NewRemoteSource(RemoteConfig{
+		Enabled:   true,
+		URL:       v.GetString("remote.url"),
+		PublicKey: v.GetString("remote.public_key"),
+		Timeout:   v.GetDuration("remote.timeout"),
+		CacheFile: v.GetString("remote.cache_file"),
+	})
+	if err != nil {
+		return err
+	}
+	doc, err := source.Fetch(ctx)
+	if err != nil || doc == nil {
+		return err
+	}
+	return source.SaveCache(doc)
+}
+
+// mergeRemoteCache merges the cached remote config over v after re-verifying
+// its signature. A missing cache is not an error.
+func mergeRemoteCache(v *viper.Viper) error {
+	cfg := RemoteConfig{
+		PublicKey: v.GetString("remote.public_key"),
+		CacheFile: v.GetString("remote.cache_file"),
+	}
+
+	data, signature, err := readRemoteCache(cfg.CacheFile)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read remote config cache: %w", err)
+	}
+
+	key, err := base64.StdEncoding.DecodeString(cfg.PublicKey)
+	if err != nil || len(key) != ed25519.PublicKeySize {
+		return fmt.Errorf("remote config public key must be a base64 ed25519 public key")
+	}
+	if err := verifyRemoteDocument(ed25519.PublicKey(key), data, signature); err != nil {
+		return fmt.Errorf("cached %w", err)
+	}
+
+	v.SetConfigType("yaml")
+	if err := v.MergeConfig(bytes.NewReader(data)); err != nil {
+		return fmt.Errorf("failed to merge remote config: %w", err)
+	}
+	return nil
+}
+
+// verifyRemoteDocument checks the signature and rejects documents that try to
+// change the remote source itself
+func verifyRemoteDocument(key ed25519.PublicKey, data, signature []byte) error {
+	if !ed25519.Verify(key, data, signature) {
+		return fmt.Errorf("remote config signature verification failed")
+	}
+
+	v := viper.New()
+	v.SetConfigType("yaml")
+	if err := v.ReadConfig(bytes.NewReader(data)); err != nil {
+		return fmt.Errorf("failed to parse remote config: %w", err)
+	}
+	if v.IsSet("remote") {
+		return fmt.Errorf("remote config must not contain a remote section")
+	}
+	return nil
+}
+
+// writeFileAtomic writes data to a temp file and renames it over path
+func writeFileAtomic(path string, data []byte) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".tmp*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmp.Name(), 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
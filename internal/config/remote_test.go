@@ -0,0 +1,182 @@
+package config
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/base64"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newSignedServer(t *testing.T, priv ed25519.PrivateKey, body string) (*httptest.Server, *int) {
+	requests := 0
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		if r.Header.Get("If-None-Match") == `"v1"` {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Header().Set("ETag", `"v1"`)
+		w.Header().Set(SignatureHeader, base64.StdEncoding.EncodeToString(ed25519.Sign(priv, []byte(body))))
+		w.Write([]byte(body))
+	}))
+	t.Cleanup(server.Close)
+	return server, &requests
+}
+
+func newTestRemoteSource(t *testing.T, server *httptest.Server, pub ed25519.PublicKey) *RemoteSource {
+	source, err := NewRemoteSource(RemoteConfig{
+		Enabled:      true,
+		URL:          server.URL + "/agent.yaml",
+		PublicKey:    base64.StdEncoding.EncodeToString(pub),
+		PollInterval: time.Minute,
+		Timeout:      5 * time.Second,
+		CacheFile:    filepath.Join(t.TempDir(), "remote.yaml"),
+	})
+	require.NoError(t, err)
+	source.client = server.Client()
+	return source
+}
+
+func TestNewRemoteSource_Validation(t *testing.T) {
+	pub, _, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	cfg := RemoteConfig{
+		URL:          "http://config.example.com/agent.yaml",
+		PublicKey:    base64.StdEncoding.EncodeToString(pub),
+		PollInterval: 5 * time.Minute,
+		Timeout:      30 * time.Second,
+	}
+
+	_, err = NewRemoteSource(cfg)
+	assert.ErrorContains(t, err, "https://")
+
+	cfg.URL = "https://config.example.com/agent.yaml"
+	cfg.PublicKey = "not-a-key"
+	_, err = NewRemoteSource(cfg)
+	assert.ErrorContains(t, err, "ed25519")
+
+	cfg.PublicKey = base64.StdEncoding.EncodeToString(pub)
+	_, err = NewRemoteSource(cfg)
+	assert.NoError(t, err)
+}
+
+func TestRemoteSource_FetchConditional(t *testing.T) {
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	server, requests := newSignedServer(t, priv, "agent:\n  log_level: debug\n")
+	source := newTestRemoteSource(t, server, pub)
+
+	doc, err := source.Fetch(context.Background())
+	require.NoError(t, err)
+	require.NotNil(t, doc)
+	assert.Equal(t, `"v1"`, doc.ETag)
+
+	// Second fetch sends If-None-Match and reports no change
+	doc, err = source.Fetch(context.Background())
+	require.NoError(t, err)
+	assert.Nil(t, doc)
+	assert.Equal(t, 2, *requests)
+}
+
+func TestRemoteSource_RejectsBadSignature(t *testing.T) {
+	pub, _, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	_, otherPriv, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	server, _ := newSignedServer(t, otherPriv, "agent:\n  log_level: debug\n")
+	source := newTestRemoteSource(t, server, pub)
+
+	_, err = source.Fetch(context.Background())
+	assert.ErrorContains(t, err, "signature verification failed")
+}
+
+func TestRemoteSource_RejectsRemoteSection(t *testing.T) {
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	server, _ := newSignedServer(t, priv, "remote:\n  url: https://evil.example.com\n")
+	source := newTestRemoteSource(t, server, pub)
+
+	_, err = source.Fetch(context.Background())
+	assert.ErrorContains(t, err, "must not contain a remote section")
+}
+
+func TestLoad_MergesCachedRemoteConfig(t *testing.T) {
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	server, _ := newSignedServer(t, priv, "agent:\n  log_level: debug\n")
+	source := newTestRemoteSource(t, server, pub)
+
+	doc, err := source.Fetch(context.Background())
+	require.NoError(t, err)
+	require.NoError(t, source.SaveCache(doc))
+
+	dir := t.TempDir()
+	configPath := filepath.Join(dir, "agent.yaml")
+	require.NoError(t, os.WriteFile(configPath, []byte(`
+agent:
+  name: "local"
+  log_level: "info"
+remote:
+  enabled: true
+  url: "`+server.URL+`"
+  public_key: "`+base64.StdEncoding.EncodeToString(pub)+`"
+  cache_file: "`+source.config.CacheFile+`"
+`), 0644))
+
+	cfg, err := Load(configPath)
+	require.NoError(t, err)
+	assert.Equal(t, "local", cfg.Agent.Name)
+	assert.Equal(t, "debug", cfg.Agent.LogLevel)
+
+	// A tampered cache is rejected
+	cached, err := os.ReadFile(source.config.CacheFile)
+	require.NoError(t, err)
+	tampered := strings.Replace(string(cached), "debug", "error", 1)
+	require.NoError(t, os.WriteFile(source.config.CacheFile, []byte(tampered), 0600))
+	_, err = Load(configPath)
+	assert.ErrorContains(t, err, "signature verification failed")
+}
+
+func TestLoad_FetchRemote(t *testing.T) {
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	server, requests := newSignedServer(t, priv, "agent:\n  log_level: debug\n")
+	original := remoteHTTPClient
+	remoteHTTPClient = func(timeout time.Duration) *http.Client { return server.Client() }
+	defer func() { remoteHTTPClient = original }()
+
+	dir := t.TempDir()
+	cacheFile := filepath.Join(dir, "remote.yaml")
+	configPath := filepath.Join(dir, "agent.yaml")
+	require.NoError(t, os.WriteFile(configPath, []byte(`
+agent:
+  log_level: "info"
+remote:
+  enabled: true
+  url: "`+server.URL+`"
+  public_key: "`+base64.StdEncoding.EncodeToString(pub)+`"
+  cache_file: "`+cacheFile+`"
+`), 0644))
+
+	// The first start runs the fetched config, without a cache
+	cfg, err := LoadWithOptions(configPath, LoadOptions{FetchRemote: true})
+	require.NoError(t, err)
+	assert.Equal(t, "debug", cfg.Agent.LogLevel)
+	assert.Equal(t, 1, *requests)
+
+	// An unreachable source falls back to the cache
+	server.Close()
+	cfg, err = LoadWithOptions(configPath, LoadOptions{FetchRemote: true})
+	require.NoError(t, err)
+	assert.Equal(t, "debug", cfg.Agent.LogLevel)
+}
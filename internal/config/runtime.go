@@ -0,0 +1,87 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/go-viper/mapstructure/v2"
+	"github.com/spf13/viper"
+)
+
+// RuntimeDropIn is the drop-in file that keys changed at runtime are
+// persisted to. Only those keys are written, so the main config file and
+// secret references in it stay untouched.
+const RuntimeDropIn = "99-runtime.yaml"
+
+// Get returns the value of a single key, named as in the config file.
+// Sensitive values are masked.
+func (c *Config) Get(key string) (interface{}, error) {
+	value, ok := Flatten(c)[key]
+	if !ok {
+		return nil, fmt.Errorf("unknown configuration key %q", key)
+	}
+	if IsSensitiveKey(key) {
+		return maskedValue, nil
+	}
+	return value, nil
+}
+
+// With returns a copy of the configuration with key set to value. The value
+// is decoded like the config file would be and the result is validated; the
+// receiver is not modified.
+func (c *Config) With(key string, value interface{}) (*Config, error) {
+	values := Flatten(c)
+	if _, ok := values[key]; !ok {
+		return nil, fmt.Errorf("unknown configuration key %q", key)
+	}
+
+	v := viper.New()
+	for k, current := range values {
+		v.Set(k, current)
+	}
+	v.Set(key, value)
+
+	var cfg Config
+	var metadata mapstructure.Metadata
+	if err := v.Unmarshal(&cfg, decoderConfig(&metadata)); err != nil {
+		return nil, fmt.Errorf("invalid value for %s: %w", key, err)
+	}
+	cfg.path = c.path
+	cfg.options = c.options
+
+	if err := validateConfig(&cfg); err != nil {
+		return nil, fmt.Errorf("invalid configuration: %w", err)
+	}
+	return &cfg, nil
+}
+
+// PersistKey writes the current value of key to the runtime drop-in next to
+// the config file, keeping keys persisted earlier
+func (c *Config) PersistKey(key string) error {
+	value, ok := Flatten(c)[key]
+	if !ok {
+		return fmt.Errorf("unknown configuration key %q", key)
+	}
+	if c.path == "" {
+		return fmt.Errorf("no config file to persist %s next to", key)
+	}
+
+	path := filepath.Join(filepath.Dir(c.path), DropInDirName, RuntimeDropIn)
+	v := viper.New()
+	v.SetConfigFile(path)
+	if _, err := os.Stat(path); err == nil {
+		if err := v.ReadInConfig(); err != nil {
+			return fmt.Errorf("failed to read runtime config: %w", err)
+		}
+	}
+	v.Set(key, value)
+
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("failed to create directory: %w", err)
+	}
+	if err := v.WriteConfigAs(path); err != nil {
+		return fmt.Errorf("failed to write runtime config: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,89 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestConfig_Get(t *testing.T) {
+	cfg, err := Load(writeRuntimeConfig(t))
+	require.NoError(t, err)
+
+	value, err := cfg.Get("services.sboxctl.interval")
+	require.NoError(t, err)
+	assert.Equal(t, "30m0s", value)
+
+	value, err = cfg.Get("security.api_token")
+	require.NoError(t, err)
+	assert.Equal(t, maskedValue, value)
+
+	_, err = cfg.Get("services.sboxctl")
+	assert.ErrorContains(t, err, `unknown configuration key "services.sboxctl"`)
+}
+
+func TestConfig_With(t *testing.T) {
+	cfg, err := Load(writeRuntimeConfig(t))
+	require.NoError(t, err)
+
+	updated, err := cfg.With("services.sboxctl.interval", "5m")
+	require.NoError(t, err)
+	assert.Equal(t, 5*time.Minute, updated.Services.Sboxctl.Interval)
+	assert.Equal(t, 30*time.Minute, cfg.Services.Sboxctl.Interval)
+	assert.Equal(t, cfg.Path(), updated.Path())
+
+	// Only the set key differs
+	changes := Diff(cfg, updated)
+	require.Len(t, changes, 1)
+	assert.Equal(t, "services.sboxctl.interval", changes[0].Key)
+
+	_, err = cfg.With("services.sboxctl.interval", "0s")
+	assert.ErrorContains(t, err, "sboxctl interval must be positive")
+	_, err = cfg.With("server.port", "http")
+	assert.ErrorContains(t, err, "invalid value for server.port")
+	_, err = cfg.With("agent.nickname", "x")
+	assert.ErrorContains(t, err, "unknown configuration key")
+}
+
+func TestConfig_PersistKey(t *testing.T) {
+	configPath := writeRuntimeConfig(t)
+	cfg, err := Load(configPath)
+	require.NoError(t, err)
+
+	cfg, err = cfg.With("agent.log_level", "debug")
+	require.NoError(t, err)
+	require.NoError(t, cfg.PersistKey("agent.log_level"))
+	cfg, err = cfg.With("services.sboxctl.timeout", "1m")
+	require.NoError(t, err)
+	require.NoError(t, cfg.PersistKey("services.sboxctl.timeout"))
+
+	// The main file is untouched and the drop-in holds both keys
+	data, err := os.ReadFile(configPath)
+	require.NoError(t, err)
+	assert.NotContains(t, string(data), "debug")
+
+	reloaded, err := Load(configPath)
+	require.NoError(t, err)
+	assert.Equal(t, "debug", reloaded.Agent.LogLevel)
+	assert.Equal(t, time.Minute, reloaded.Services.Sboxctl.Timeout)
+	assert.Equal(t, "runtime-test", reloaded.Agent.Name)
+
+	noFile := &Config{}
+	assert.ErrorContains(t, noFile.PersistKey("agent.name"), "no config file")
+}
+
+// writeRuntimeConfig writes a minimal config file and returns its path
+func writeRuntimeConfig(t *testing.T) string {
+	configPath := filepath.Join(t.TempDir(), "agent.yaml")
+	require.NoError(t, os.WriteFile(configPath, []byte(`
+agent:
+  name: "runtime-test"
+security:
+  api_token: "secret-token"
+`), 0644))
+	return configPath
+}
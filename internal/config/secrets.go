@@ -0,0 +1,136 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Secret reference prefixes. A sensitive setting written as "!file:/path",
+// "!env:NAME" or "!cred:NAME" is resolved at load time so the secret itself
+// does not have to live in the config file.
+const (
+	secretFilePrefix       = "!file:"
+	secretEnvPrefix        = "!env:"
+	secretCredentialPrefix = "!cred:"
+)
+
+// credentialsDirEnv is set by systemd to the directory holding the unit's
+// credentials (LoadCredential=, SetCredentialEncrypted=, ...)
+const credentialsDirEnv = "CREDENTIALS_DIRECTORY"
+
+// resolveSecrets replaces secret references in sensitive settings with the
+// values they point to
+func resolveSecrets(cfg *Config) error {
+	values := map[string]*string{
+		"security.api_token":               &cfg.Security.APIToken,
+		"server.tunnel.token":              &cfg.Server.Tunnel.Token,
+		"notifications.telegram.bot_token": &cfg.Notifications.Telegram.BotToken,
+		"notifications.email.password":     &cfg.Notifications.Email.Password,
+	}
+	for i := range cfg.Security.Auth.Tokens {
+		values[fmt.Sprintf("security.auth.tokens[%d].token", i)] = &cfg.Security.Auth.Tokens[i].Token
+	}
+	for key, value := range values {
+		resolved, err := resolveSecret(*value)
+		if err != nil {
+			return fmt.Errorf("failed to resolve %s: %w", key, err)
+		}
+		*value = resolved
+	}
+
+	// TLS keys are read by path, so references resolve to a file path
+	paths := map[string]*string{
+		"security.tls_key_file":    &cfg.Security.TLSKeyFile,
+		"security.tls_cert_file":   &cfg.Security.TLSCertFile,
+		"security.auth.token_file": &cfg.Security.Auth.TokenFile,
+	}
+	for key, value := range paths {
+		resolved, err := resolveSecretPath(*value)
+		if err != nil {
+			return fmt.Errorf("failed to resolve %s: %w", key, err)
+		}
+		*value = resolved
+	}
+
+	return nil
+}
+
+// resolveSecret returns the secret a reference points to. Values that are not
+// references are returned unchanged.
+func resolveSecret(value string) (string, error) {
+	switch {
+	case strings.HasPrefix(value, secretFilePrefix):
+		return readSecretFile(strings.TrimPrefix(value, secretFilePrefix))
+	case strings.HasPrefix(value, secretCredentialPrefix):
+		path, err := credentialPath(strings.TrimPrefix(value, secretCredentialPrefix))
+		if err != nil {
+			return "", err
+		}
+		return readSecretFile(path)
+	case strings.HasPrefix(value, secretEnvPrefix):
+		return lookupSecretEnv(strings.TrimPrefix(value, secretEnvPrefix))
+	}
+	return value, nil
+}
+
+// ResolveSecret returns the secret a reference points to, for secrets that
+// are resolved when they are used rather than at load time
+func ResolveSecret(ref string) (string, error) {
+	if !IsSecretReference(ref) {
+		return "", fmt.Errorf("%q is not a secret reference", ref)
+	}
+	return resolveSecret(ref)
+}
+
+// IsSecretReference reports whether a value is a secret reference
+func IsSecretReference(value string) bool {
+	return strings.HasPrefix(value, secretFilePrefix) ||
+		strings.HasPrefix(value, secretEnvPrefix) ||
+		strings.HasPrefix(value, secretCredentialPrefix)
+}
+
+// resolveSecretPath returns the file path a reference points to, for settings
+// that hold the path of a secret rather than the secret itself
+func resolveSecretPath(value string) (string, error) {
+	switch {
+	case strings.HasPrefix(value, secretFilePrefix):
+		return strings.TrimPrefix(value, secretFilePrefix), nil
+	case strings.HasPrefix(value, secretCredentialPrefix):
+		return credentialPath(strings.TrimPrefix(value, secretCredentialPrefix))
+	case strings.HasPrefix(value, secretEnvPrefix):
+		return lookupSecretEnv(strings.TrimPrefix(value, secretEnvPrefix))
+	}
+	return value, nil
+}
+
+// readSecretFile reads a secret from a file, dropping the trailing newline
+func readSecretFile(path string) (string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", fmt.Errorf("failed to read secret file: %w", err)
+	}
+	return strings.TrimRight(string(data), "\r\n"), nil
+}
+
+// lookupSecretEnv returns the value of an environment variable holding a secret
+func lookupSecretEnv(name string) (string, error) {
+	value, ok := os.LookupEnv(name)
+	if !ok {
+		return "", fmt.Errorf("environment variable %s is not set", name)
+	}
+	return value, nil
+}
+
+// credentialPath returns the path of a systemd credential
+func credentialPath(name string) (string, error) {
+	dir := os.Getenv(credentialsDirEnv)
+	if dir == "" {
+		return "", fmt.Errorf("systemd credential %q requested but %s is not set", name, credentialsDirEnv)
+	}
+	if name == "" || strings.ContainsRune(name, '/') {
+		return "", fmt.Errorf("invalid systemd credential name %q", name)
+	}
+	return filepath.Join(dir, name), nil
+}
@@ -0,0 +1,60 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLoad_ResolvesSecretReferences(t *testing.T) {
+	dir := t.TempDir()
+	tokenFile := filepath.Join(dir, "api-token")
+	require.NoError(t, os.WriteFile(tokenFile, []byte("from-file\n"), 0600))
+	credDir := filepath.Join(dir, "credentials")
+	require.NoError(t, os.MkdirAll(credDir, 0700))
+	require.NoError(t, os.WriteFile(filepath.Join(credDir, "tunnel"), []byte("from-cred"), 0600))
+
+	t.Setenv("SBOX_TEST_TOKEN", "from-env")
+	t.Setenv(credentialsDirEnv, credDir)
+
+	configPath := filepath.Join(dir, "agent.yaml")
+	require.NoError(t, os.WriteFile(configPath, []byte(`
+security:
+  api_token: "!file:`+tokenFile+`"
+  tls_key_file: "!cred:tls.key"
+  auth:
+    tokens:
+      - name: "sboxmgr"
+        token: "!env:SBOX_TEST_TOKEN"
+server:
+  tunnel:
+    token: "!cred:tunnel"
+`), 0644))
+
+	cfg, err := Load(configPath)
+	require.NoError(t, err)
+	assert.Equal(t, "from-file", cfg.Security.APIToken)
+	assert.Equal(t, "from-env", cfg.Security.Auth.Tokens[0].Token)
+	assert.Equal(t, "from-cred", cfg.Server.Tunnel.Token)
+	assert.Equal(t, filepath.Join(credDir, "tls.key"), cfg.Security.TLSKeyFile)
+}
+
+func TestResolveSecret_Errors(t *testing.T) {
+	t.Setenv(credentialsDirEnv, "")
+
+	_, err := resolveSecret("!file:/nonexistent/secret")
+	assert.ErrorContains(t, err, "failed to read secret file")
+
+	_, err = resolveSecret("!env:SBOX_TEST_UNSET_VARIABLE")
+	assert.ErrorContains(t, err, "is not set")
+
+	_, err = resolveSecret("!cred:token")
+	assert.ErrorContains(t, err, credentialsDirEnv)
+
+	value, err := resolveSecret("plain-token")
+	require.NoError(t, err)
+	assert.Equal(t, "plain-token", value)
+}
@@ -0,0 +1,179 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"strings"
+	"text/template"
+)
+
+// envPattern matches ${VAR} and ${VAR:-default} references in config values
+var envPattern = regexp.MustCompile(`\$\{([A-Za-z_][A-Za-z0-9_]*)(?::-([^}]*))?\}`)
+
+// runtimeTemplateKeys hold templates that are rendered later with their own
+// variables, so they are not expanded at load time. Entries match a full key
+// or the last key segment, for settings repeated per client.
+var runtimeTemplateKeys = map[string]bool{
+	"services.sboxctl.command": true,
+	"agent.unit.exec_start":    true,
+	"template_vars":            true,
+}
+
+// templateFuncs are available to template expressions in config values
+var templateFuncs = template.FuncMap{
+	"env":      os.Getenv,
+	"hostname": os.Hostname,
+}
+
+// expandConfig expands ${VAR} references and {{ }} template expressions in
+// string values, so one config file can be reused across hosts
+func expandConfig(cfg *Config) error {
+	return expandValue(reflect.ValueOf(cfg).Elem(), "")
+}
+
+// expandValue walks structs by mapstructure tag and expands string values
+func expandValue(v reflect.Value, key string) error {
+	if runtimeTemplateKeys[key] || runtimeTemplateKeys[key[strings.LastIndex(key, ".")+1:]] {
+		return nil
+	}
+
+	switch v.Kind() {
+	case reflect.String:
+		expanded, err := expandString(v.String())
+		if err != nil {
+			return fmt.Errorf("failed to expand %s: %w", key, err)
+		}
+		v.SetString(expanded)
+	case reflect.Slice:
+		for i := 0; i < v.Len(); i++ {
+			if err := expandValue(v.Index(i), fmt.Sprintf("%s[%d]", key, i)); err != nil {
+				return err
+			}
+		}
+	case reflect.Map:
+		if v.Type().Elem().Kind() == reflect.Struct {
+			// Map values are not addressable, so expand copies
+			for _, mapKey := range v.MapKeys() {
+				value := reflect.New(v.Type().Elem()).Elem()
+				value.Set(v.MapIndex(mapKey))
+				if err := expandValue(value, key+"."+mapKey.String()); err != nil {
+					return err
+				}
+				v.SetMapIndex(mapKey, value)
+			}
+			return nil
+		}
+		if v.Type().Elem().Kind() != reflect.String {
+			return nil
+		}
+		for _, mapKey := range v.MapKeys() {
+			expanded, err := expandString(v.MapIndex(mapKey).String())
+			if err != nil {
+				return fmt.Errorf("failed to expand %s.%s: %w", key, mapKey.String(), err)
+			}
+			v.SetMapIndex(mapKey, reflect.ValueOf(expanded))
+		}
+	case reflect.Struct:
+		t := v.Type()
+		for i := 0; i < t.NumField(); i++ {
+			field := t.Field(i)
+			tag := field.Tag.Get("mapstructure")
+			if !field.IsExported() || tag == "" || tag == "-" {
+				continue
+			}
+			fieldKey := key
+			if !strings.HasSuffix(tag, ",squash") {
+				fieldKey = tag
+				if key != "" {
+					fieldKey = key + "." + tag
+				}
+			}
+			if err := expandValue(v.Field(i), fieldKey); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// expandString expands environment references, then template expressions
+func expandString(value string) (string, error) {
+	var missing []string
+	value = envPattern.ReplaceAllStringFunc(value, func(ref string) string {
+		match := envPattern.FindStringSubmatch(ref)
+		if env, ok := os.LookupEnv(match[1]); ok {
+			return env
+		}
+		if strings.Contains(ref, ":-") {
+			return match[2]
+		}
+		missing = append(missing, match[1])
+		return ref
+	})
+	if len(missing) > 0 {
+		return "", fmt.Errorf("environment variable %s is not set", strings.Join(missing, ", "))
+	}
+
+	if !strings.Contains(value, "{{") {
+		return value, nil
+	}
+	tmpl, err := template.New("value").Funcs(templateFuncs).Option("missingkey=error").Parse(value)
+	if err != nil {
+		return "", fmt.Errorf("invalid template: %w", err)
+	}
+	var b strings.Builder
+	if err := tmpl.Execute(&b, nil); err != nil {
+		return "", fmt.Errorf("failed to render template: %w", err)
+	}
+	return b.String(), nil
+}
+
+// UnitVars are the variables available to agent.unit.exec_start
+type UnitVars struct {
+	Binary     string
+	ConfigPath string
+	SocketPath string
+}
+
+// NewUnitVars returns the variables of the agent unit: the running binary,
+// the config file, or agent.yaml in the default directory, and the socket
+func NewUnitVars(cfg *Config, socketPath string) (UnitVars, error) {
+	vars := UnitVars{
+		ConfigPath: cfg.Path(),
+		SocketPath: socketPath,
+	}
+	if vars.ConfigPath == "" {
+		vars.ConfigPath = filepath.Join(DefaultConfigDir, "agent.yaml")
+	}
+	var err error
+	if vars.ConfigPath, err = filepath.Abs(vars.ConfigPath); err != nil {
+		return vars, err
+	}
+	if vars.Binary, err = os.Executable(); err != nil {
+		return vars, fmt.Errorf("failed to find the agent binary: %w", err)
+	}
+	return vars, nil
+}
+
+// Command renders the agent command line of exec_start with vars
+func (u UnitConfig) Command(vars UnitVars) ([]string, error) {
+	if len(u.ExecStart) == 0 {
+		return nil, fmt.Errorf("unit exec_start is empty")
+	}
+	args := make([]string, len(u.ExecStart))
+	for i, arg := range u.ExecStart {
+		t, err := template.New(fmt.Sprintf("arg%d", i)).Option("missingkey=error").Parse(arg)
+		if err != nil {
+			return nil, fmt.Errorf("invalid template in exec_start argument %q: %w", arg, err)
+		}
+		var b strings.Builder
+		if err := t.Execute(&b, vars); err != nil {
+			return nil, fmt.Errorf("failed to render exec_start: %w", err)
+		}
+		args[i] = b.String()
+	}
+	return args, nil
+}
@@ -0,0 +1,64 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLoad_ExpandsEnvironmentAndTemplates(t *testing.T) {
+	t.Setenv("SBOX_TEST_HOST", "edge-1")
+	hostname, err := os.Hostname()
+	require.NoError(t, err)
+
+	configPath := filepath.Join(t.TempDir(), "agent.yaml")
+	require.NoError(t, os.WriteFile(configPath, []byte(`
+agent:
+  name: "agent-${SBOX_TEST_HOST}"
+  profile: "${SBOX_TEST_PROFILE:-default}"
+server:
+  tunnel:
+    agent_id: "{{ hostname }}"
+services:
+  sboxctl:
+    command: ["sboxctl", "--socket={{.SocketPath}}"]
+clients:
+  xray:
+    template_vars:
+      inbound: "{{ .Port }}"
+`), 0644))
+
+	cfg, err := Load(configPath)
+	require.NoError(t, err)
+	assert.Equal(t, "agent-edge-1", cfg.Agent.Name)
+	assert.Equal(t, "default", cfg.Agent.Profile)
+	assert.Equal(t, hostname, cfg.Server.Tunnel.AgentID)
+	// Run-time templates are left for their consumers
+	assert.Equal(t, []string{"sboxctl", "--socket={{.SocketPath}}"}, cfg.Services.Sboxctl.Command)
+	assert.Equal(t, "{{ .Port }}", cfg.Clients.Xray.TemplateVars["inbound"])
+}
+
+func TestLoad_ExpandErrors(t *testing.T) {
+	tests := []struct {
+		name  string
+		value string
+		err   string
+	}{
+		{"unset variable", `"${SBOX_TEST_UNSET_VARIABLE}"`, "failed to expand agent.name: environment variable SBOX_TEST_UNSET_VARIABLE is not set"},
+		{"invalid template", `"{{ hostname"`, "failed to expand agent.name: invalid template"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			configPath := filepath.Join(t.TempDir(), "agent.yaml")
+			require.NoError(t, os.WriteFile(configPath, []byte("agent:\n  name: "+tt.value+"\n"), 0644))
+
+			_, err := Load(configPath)
+			require.Error(t, err)
+			assert.Contains(t, err.Error(), tt.err)
+		})
+	}
+}
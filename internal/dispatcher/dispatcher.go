@@ -3,6 +3,7 @@ package dispatcher
 import (
 	"context"
 	"fmt"
+	"strings"
 	"sync"
 	"time"
 
@@ -65,12 +66,19 @@ type DispatcherStats struct {
 	StartTime       time.Time
 }
 
-// NewDispatcher creates a new event dispatcher
-func NewDispatcher(log *logger.Logger) *Dispatcher {
+// DefaultBufferSize is the event channel size when none is configured
+const DefaultBufferSize = 1000
+
+// NewDispatcher creates a new event dispatcher whose channel holds bufferSize
+// events; zero or less uses DefaultBufferSize
+func NewDispatcher(log *logger.Logger, bufferSize int) *Dispatcher {
+	if bufferSize <= 0 {
+		bufferSize = DefaultBufferSize
+	}
 	return &Dispatcher{
 		logger:    log,
 		handlers:  make(map[EventType][]EventHandler),
-		eventChan: make(chan Event, 1000), // Large buffer for high throughput
+		eventChan: make(chan Event, bufferSize),
 		stats: DispatcherStats{
 			StartTime: time.Now(),
 		},
@@ -189,8 +197,9 @@ func (d *Dispatcher) Dispatch(event Event) error {
 		d.statsMu.Unlock()
 
 		d.logger.Warn("Event channel is full, dropping event", map[string]interface{}{
-			"type": event.Type,
-			"id":   event.ID,
+			"type":     event.Type,
+			"id":       event.ID,
+			"capacity": cap(d.eventChan),
 		})
 		return fmt.Errorf("event channel is full")
 	}
@@ -263,6 +272,17 @@ func (d *Dispatcher) GetStats() DispatcherStats {
 	return d.stats
 }
 
+// QueueStats returns the fill level and overflow count of the event channel
+func (d *Dispatcher) QueueStats() services.QueueStats {
+	d.statsMu.RLock()
+	defer d.statsMu.RUnlock()
+	return services.QueueStats{
+		Capacity: cap(d.eventChan),
+		Length:   len(d.eventChan),
+		Dropped:  d.stats.EventsDropped,
+	}
+}
+
 // GetEventsProcessed returns the number of events processed
 func (d *DispatcherStats) GetEventsProcessed() int64 {
 	return d.EventsProcessed
@@ -299,10 +319,11 @@ func (d *Dispatcher) GetRegisteredHandlers() map[EventType][]string {
 	return result
 }
 
-// ConvertSboxctlEvent converts a SboxctlEvent to a generic Event
+// ConvertSboxctlEvent converts a SboxctlEvent to a generic Event. sboxctl
+// writes types in upper case, such as LOG.
 func ConvertSboxctlEvent(sboxEvent services.SboxctlEvent) Event {
 	event := Event{
-		Type:      EventType(sboxEvent.Type),
+		Type:      EventType(strings.ToLower(sboxEvent.Type)),
 		Data:      sboxEvent.Data,
 		Source:    "sboxctl",
 		Timestamp: time.Now(), // Will be overridden if timestamp is provided
@@ -0,0 +1,53 @@
+package dispatcher
+
+import (
+	"context"
+	"sync"
+	"testing"
+
+	"github.com/kpblcaoo/sboxagent/internal/logger"
+)
+
+// countingHandler signals every handled event on a wait group
+type countingHandler struct {
+	wg *sync.WaitGroup
+}
+
+func (h *countingHandler) Handle(ctx context.Context, event Event) error {
+	h.wg.Done()
+	return nil
+}
+
+func (h *countingHandler) GetName() string {
+	return "counting"
+}
+
+func (h *countingHandler) GetSupportedTypes() []EventType {
+	return []EventType{EventTypeLog}
+}
+
+// BenchmarkDispatcher_Throughput measures dispatching events through to a
+// handler
+func BenchmarkDispatcher_Throughput(b *testing.B) {
+	log, _ := logger.New("error")
+	dispatcher := NewDispatcher(log, b.N+1)
+	var wg sync.WaitGroup
+	if err := dispatcher.RegisterHandler(&countingHandler{wg: &wg}); err != nil {
+		b.Fatal(err)
+	}
+	if err := dispatcher.Start(context.Background()); err != nil {
+		b.Fatal(err)
+	}
+	defer dispatcher.Stop()
+
+	event := Event{Type: EventTypeLog, Source: "bench", Data: map[string]interface{}{"message": "test"}}
+	wg.Add(b.N)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if err := dispatcher.Dispatch(event); err != nil {
+			b.Fatal(err)
+		}
+	}
+	wg.Wait()
+}
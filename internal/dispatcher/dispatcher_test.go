@@ -5,13 +5,14 @@ import (
 	"testing"
 	"time"
 
+	"github.com/kpblcaoo/sboxagent/internal/aggregator"
 	"github.com/kpblcaoo/sboxagent/internal/logger"
 	"github.com/kpblcaoo/sboxagent/internal/services"
 )
 
 func TestNewDispatcher(t *testing.T) {
 	log, _ := logger.New("debug")
-	dispatcher := NewDispatcher(log)
+	dispatcher := NewDispatcher(log, 0)
 
 	if dispatcher == nil {
 		t.Fatal("Expected dispatcher to be created")
@@ -28,7 +29,7 @@ func TestNewDispatcher(t *testing.T) {
 
 func TestDispatcher_StartStop(t *testing.T) {
 	log, _ := logger.New("debug")
-	dispatcher := NewDispatcher(log)
+	dispatcher := NewDispatcher(log, 0)
 	ctx := context.Background()
 
 	// Test start
@@ -52,7 +53,7 @@ func TestDispatcher_StartStop(t *testing.T) {
 
 func TestDispatcher_RegisterHandler(t *testing.T) {
 	log, _ := logger.New("debug")
-	dispatcher := NewDispatcher(log)
+	dispatcher := NewDispatcher(log, 0)
 
 	// Create a test handler
 	handler := &testHandler{
@@ -79,7 +80,7 @@ func TestDispatcher_RegisterHandler(t *testing.T) {
 
 func TestDispatcher_RegisterNilHandler(t *testing.T) {
 	log, _ := logger.New("debug")
-	dispatcher := NewDispatcher(log)
+	dispatcher := NewDispatcher(log, 0)
 
 	err := dispatcher.RegisterHandler(nil)
 	if err == nil {
@@ -89,7 +90,7 @@ func TestDispatcher_RegisterNilHandler(t *testing.T) {
 
 func TestDispatcher_UnregisterHandler(t *testing.T) {
 	log, _ := logger.New("debug")
-	dispatcher := NewDispatcher(log)
+	dispatcher := NewDispatcher(log, 0)
 
 	// Create and register handler
 	handler := &testHandler{
@@ -110,7 +111,7 @@ func TestDispatcher_UnregisterHandler(t *testing.T) {
 
 func TestDispatcher_Dispatch(t *testing.T) {
 	log, _ := logger.New("debug")
-	dispatcher := NewDispatcher(log)
+	dispatcher := NewDispatcher(log, 0)
 	ctx := context.Background()
 
 	// Start dispatcher
@@ -149,7 +150,7 @@ func TestDispatcher_Dispatch(t *testing.T) {
 
 func TestDispatcher_GetStats(t *testing.T) {
 	log, _ := logger.New("debug")
-	dispatcher := NewDispatcher(log)
+	dispatcher := NewDispatcher(log, 0)
 	ctx := context.Background()
 
 	dispatcher.Start(ctx)
@@ -200,6 +201,44 @@ func TestConvertSboxctlEvent(t *testing.T) {
 	if event.ID == "" {
 		t.Error("Expected event ID to be generated")
 	}
+
+	// sboxctl writes upper case types
+	sboxEvent.Type = "LOG"
+	if event := ConvertSboxctlEvent(sboxEvent); event.Type != EventTypeLog {
+		t.Errorf("Expected event type to be 'log', got %s", event.Type)
+	}
+}
+
+func TestAggregatorHandler(t *testing.T) {
+	log, _ := logger.New("error")
+	agg := aggregator.NewMemoryAggregator(log, 10, time.Hour)
+	handler := NewAggregatorHandler(agg)
+
+	err := handler.Handle(context.Background(), Event{
+		Type:      EventTypeLog,
+		Data:      map[string]interface{}{"level": "warning", "message": "route table full", "table": "main"},
+		Source:    "sboxctl",
+		Timestamp: time.Now(),
+	})
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+
+	entries := agg.GetRecentEntries(10)
+	if len(entries) != 1 {
+		t.Fatalf("Expected 1 entry, got %d", len(entries))
+	}
+	entry := entries[0]
+	if entry.Level != aggregator.LogLevelWarn || entry.Message != "route table full" || entry.Source != "sboxctl" {
+		t.Errorf("Unexpected entry: %+v", entry)
+	}
+	if entry.Metadata["table"] != "main" || entry.Metadata["message"] != nil {
+		t.Errorf("Expected only extra fields in metadata, got %v", entry.Metadata)
+	}
+
+	if err := handler.Handle(context.Background(), Event{Type: EventTypeLog, Data: map[string]interface{}{}}); err == nil {
+		t.Error("Expected error for a log event without message")
+	}
 }
 
 // testHandler is a test implementation of EventHandler
@@ -221,3 +260,24 @@ func (h *testHandler) GetName() string {
 func (h *testHandler) GetSupportedTypes() []EventType {
 	return h.types
 }
+
+func TestDispatcher_QueueStats(t *testing.T) {
+	log, _ := logger.New("error")
+	dispatcher := NewDispatcher(log, 2)
+
+	// Not started, so nothing drains the queue
+	for i := 0; i < 3; i++ {
+		dispatcher.Dispatch(Event{Type: EventTypeLog, Source: "test"})
+	}
+
+	stats := dispatcher.QueueStats()
+	if stats.Capacity != 2 || stats.Length != 2 {
+		t.Errorf("Expected a full queue of 2, got %d/%d", stats.Length, stats.Capacity)
+	}
+	if stats.Dropped != 1 {
+		t.Errorf("Expected 1 dropped event, got %d", stats.Dropped)
+	}
+	if stats.FillRatio() != 1 {
+		t.Errorf("Expected fill ratio 1, got %f", stats.FillRatio())
+	}
+}
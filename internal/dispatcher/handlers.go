@@ -6,6 +6,7 @@ import (
 	"sync"
 	"time"
 
+	"github.com/kpblcaoo/sboxagent/internal/aggregator"
 	"github.com/kpblcaoo/sboxagent/internal/logger"
 )
 
@@ -60,6 +61,66 @@ func (h *LogHandler) GetSupportedTypes() []EventType {
 	return []EventType{EventTypeLog}
 }
 
+// AggregatorHandler stores log events in a log aggregator, so output of
+// services such as sboxctl can be queried along with the agent's own logs
+type AggregatorHandler struct {
+	aggregator *aggregator.MemoryAggregator
+	name       string
+}
+
+// NewAggregatorHandler creates a new aggregator handler
+func NewAggregatorHandler(agg *aggregator.MemoryAggregator) *AggregatorHandler {
+	return &AggregatorHandler{
+		aggregator: agg,
+		name:       "aggregator_handler",
+	}
+}
+
+// Handle adds a log event to the aggregator
+func (h *AggregatorHandler) Handle(ctx context.Context, event Event) error {
+	message, _ := event.Data["message"].(string)
+	if message == "" {
+		return fmt.Errorf("log event missing message")
+	}
+
+	level := aggregator.LogLevelInfo
+	switch value, _ := event.Data["level"].(string); value {
+	case "debug":
+		level = aggregator.LogLevelDebug
+	case "warn", "warning":
+		level = aggregator.LogLevelWarn
+	case "error":
+		level = aggregator.LogLevelError
+	}
+
+	// Everything besides the level and message is kept as metadata
+	metadata := make(map[string]interface{}, len(event.Data))
+	for key, value := range event.Data {
+		if key != "level" && key != "message" {
+			metadata[key] = value
+		}
+	}
+
+	h.aggregator.Add(aggregator.LogEntry{
+		Timestamp: event.Timestamp,
+		Level:     level,
+		Message:   message,
+		Source:    event.Source,
+		Metadata:  metadata,
+	})
+	return nil
+}
+
+// GetName returns the handler name
+func (h *AggregatorHandler) GetName() string {
+	return h.name
+}
+
+// GetSupportedTypes returns supported event types
+func (h *AggregatorHandler) GetSupportedTypes() []EventType {
+	return []EventType{EventTypeLog}
+}
+
 // ConfigHandler handles configuration events
 type ConfigHandler struct {
 	logger *logger.Logger
@@ -0,0 +1,134 @@
+package health
+
+import (
+	"context"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+)
+
+// CertificateExpiry is the validity of a certificate file's leaf
+// certificate
+type CertificateExpiry struct {
+	Path     string       `json:"path"`
+	Subject  string       `json:"subject"`
+	NotAfter time.Time    `json:"notAfter"`
+	DaysLeft int          `json:"daysLeft"`
+	Status   HealthStatus `json:"status"`
+}
+
+// CertificateCheck checks the expiry of TLS certificates. A certificate
+// expiring within the warning period degrades the check, within the
+// critical period or expired it is unhealthy. Unreadable certificates
+// degrade it too, as the server or client using them fails to start.
+type CertificateCheck struct {
+	name     string
+	paths    func() []string
+	warning  time.Duration
+	critical time.Duration
+	now      func() time.Time
+}
+
+// NewCertificateCheck creates a certificate check. Paths is called on
+// every check, so certificates referenced by changing configs are
+// followed.
+func NewCertificateCheck(name string, paths func() []string, warning, critical time.Duration) *CertificateCheck {
+	return &CertificateCheck{
+		name:     name,
+		paths:    paths,
+		warning:  warning,
+		critical: critical,
+		now:      time.Now,
+	}
+}
+
+// Name returns the check name
+func (h *CertificateCheck) Name() string {
+	return h.name
+}
+
+// Check performs the certificate check
+func (h *CertificateCheck) Check(ctx context.Context) ComponentHealth {
+	now := h.now()
+	result := ComponentHealth{
+		Name:      h.name,
+		Status:    HealthStatusHealthy,
+		Timestamp: now,
+	}
+	paths := h.paths()
+	if len(paths) == 0 {
+		result.Message = "No certificates configured"
+		return result
+	}
+
+	var certificates []CertificateExpiry
+	var problems, errors []string
+	for _, path := range paths {
+		cert, err := ReadCertificate(path)
+		if err != nil {
+			errors = append(errors, fmt.Sprintf("%s: %v", path, err))
+			if result.Status == HealthStatusHealthy {
+				result.Status = HealthStatusDegraded
+			}
+			continue
+		}
+		left := cert.NotAfter.Sub(now)
+		expiry := CertificateExpiry{
+			Path:     path,
+			Subject:  cert.Subject.String(),
+			NotAfter: cert.NotAfter,
+			DaysLeft: int(left.Hours() / 24),
+			Status:   HealthStatusHealthy,
+		}
+		switch {
+		case left <= 0:
+			expiry.Status = HealthStatusUnhealthy
+			problems = append(problems, path+" expired")
+		case left <= h.critical:
+			expiry.Status = HealthStatusUnhealthy
+			problems = append(problems, fmt.Sprintf("%s expires in %d days", path, expiry.DaysLeft))
+		case left <= h.warning:
+			expiry.Status = HealthStatusDegraded
+			problems = append(problems, fmt.Sprintf("%s expires in %d days", path, expiry.DaysLeft))
+		}
+		if expiry.Status == HealthStatusUnhealthy {
+			result.Status = HealthStatusUnhealthy
+		} else if expiry.Status == HealthStatusDegraded && result.Status == HealthStatusHealthy {
+			result.Status = HealthStatusDegraded
+		}
+		certificates = append(certificates, expiry)
+	}
+
+	result.Data = map[string]interface{}{"certificates": certificates}
+	if len(errors) > 0 {
+		result.Data["errors"] = errors
+	}
+	if messages := append(problems, errors...); len(messages) > 0 {
+		result.Message = strings.Join(messages, "; ")
+	} else {
+		result.Message = "Certificates are valid"
+	}
+	return result
+}
+
+// ReadCertificate parses the first certificate of a PEM file, the leaf of
+// a chain
+func ReadCertificate(path string) (*x509.Certificate, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	for {
+		var block *pem.Block
+		block, data = pem.Decode(data)
+		if block == nil {
+			return nil, fmt.Errorf("no PEM certificate found")
+		}
+		if block.Type == "CERTIFICATE" {
+			return x509.ParseCertificate(block.Bytes)
+		}
+	}
+}
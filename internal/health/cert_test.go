@@ -0,0 +1,108 @@
+package health
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// writeCertificate writes a self-signed certificate expiring at notAfter
+func writeCertificate(t *testing.T, path string, notAfter time.Time) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: filepath.Base(path)},
+		NotBefore:    notAfter.Add(-365 * 24 * time.Hour),
+		NotAfter:     notAfter,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestCertificateCheck(t *testing.T) {
+	dir := t.TempDir()
+	now := time.Now()
+	day := 24 * time.Hour
+	valid := filepath.Join(dir, "valid.pem")
+	writeCertificate(t, valid, now.Add(90*day))
+	expiring := filepath.Join(dir, "expiring.pem")
+	writeCertificate(t, expiring, now.Add(20*day+time.Hour))
+	critical := filepath.Join(dir, "critical.pem")
+	writeCertificate(t, critical, now.Add(3*day+time.Hour))
+	expired := filepath.Join(dir, "expired.pem")
+	writeCertificate(t, expired, now.Add(-day))
+	invalid := filepath.Join(dir, "invalid.pem")
+	if err := os.WriteFile(invalid, []byte("not a certificate"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		paths   []string
+		status  HealthStatus
+		message string
+	}{
+		{"none", nil, HealthStatusHealthy, "No certificates configured"},
+		{"valid", []string{valid}, HealthStatusHealthy, "Certificates are valid"},
+		{"warning", []string{valid, expiring}, HealthStatusDegraded, expiring + " expires in 20 days"},
+		{"critical", []string{expiring, critical}, HealthStatusUnhealthy, critical + " expires in 3 days"},
+		{"expired", []string{expired}, HealthStatusUnhealthy, expired + " expired"},
+		{"unreadable", []string{valid, invalid}, HealthStatusDegraded, "no PEM certificate found"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			check := NewCertificateCheck("certificates", func() []string { return tt.paths }, 30*day, 7*day)
+			check.now = func() time.Time { return now }
+			result := check.Check(context.Background())
+			if result.Status != tt.status {
+				t.Errorf("Expected status %s, got %s: %s", tt.status, result.Status, result.Message)
+			}
+			if !strings.Contains(result.Message, tt.message) {
+				t.Errorf("Expected message to contain %q, got %q", tt.message, result.Message)
+			}
+		})
+	}
+}
+
+func TestReadCertificate_Chain(t *testing.T) {
+	// The leaf comes first; a key in the same file is skipped
+	dir := t.TempDir()
+	leaf := filepath.Join(dir, "leaf.pem")
+	writeCertificate(t, leaf, time.Now().Add(time.Hour))
+	data, err := os.ReadFile(leaf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	chain := filepath.Join(dir, "chain.pem")
+	key := pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: []byte{1}})
+	if err := os.WriteFile(chain, append(key, data...), 0644); err != nil {
+		t.Fatal(err)
+	}
+	cert, err := ReadCertificate(chain)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cert.Subject.CommonName != "leaf.pem" {
+		t.Errorf("Expected the leaf certificate, got %s", cert.Subject)
+	}
+}
@@ -63,6 +63,9 @@ type HealthChecker struct {
 	// Last report
 	lastReport HealthReport
 	reportMu   sync.RWMutex
+
+	// reportHook is called with each report of the checking loop
+	reportHook func(HealthReport)
 }
 
 // HealthCheck defines the interface for health checks
@@ -263,7 +266,11 @@ func (h *HealthChecker) performHealthCheck() {
 	// Store last report
 	h.reportMu.Lock()
 	h.lastReport = report
+	hook := h.reportHook
 	h.reportMu.Unlock()
+	if hook != nil {
+		hook(report)
+	}
 
 	// Log overall status
 	h.logger.Info("Health check completed", map[string]interface{}{
@@ -341,6 +348,14 @@ func (h *HealthChecker) getSystemInfo() map[string]interface{} {
 	}
 }
 
+// SetReportHook sets a function called with the report of each completed
+// round of the checking loop. Rounds that time out produce no report.
+func (h *HealthChecker) SetReportHook(hook func(HealthReport)) {
+	h.reportMu.Lock()
+	defer h.reportMu.Unlock()
+	h.reportHook = hook
+}
+
 // GetLastReport returns the last health report
 func (h *HealthChecker) GetLastReport() HealthReport {
 	h.reportMu.RLock()
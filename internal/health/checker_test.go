@@ -186,6 +186,35 @@ func TestHealthChecker_GetSystemInfo(t *testing.T) {
 	}
 }
 
+func TestHealthChecker_ReportHook(t *testing.T) {
+	log, _ := logger.New("error")
+	checker := NewHealthChecker(log, 10*time.Millisecond, time.Second)
+	if err := checker.RegisterCheck(&testHealthCheck{name: "test_check", status: HealthStatusHealthy}); err != nil {
+		t.Fatal(err)
+	}
+
+	reports := make(chan HealthReport, 1)
+	checker.SetReportHook(func(report HealthReport) {
+		select {
+		case reports <- report:
+		default:
+		}
+	})
+	if err := checker.Start(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	defer checker.Stop()
+
+	select {
+	case report := <-reports:
+		if report.OverallStatus != HealthStatusHealthy {
+			t.Errorf("Expected healthy report, got %s", report.OverallStatus)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Expected a report from the checking loop")
+	}
+}
+
 // testHealthCheck is a test implementation of HealthCheck
 type testHealthCheck struct {
 	name   string
@@ -0,0 +1,134 @@
+package health
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// DiskUsage is the space and inode usage of the filesystem holding a path
+type DiskUsage struct {
+	Path       string `json:"path"`
+	TotalBytes uint64 `json:"totalBytes"`
+	FreeBytes  uint64 `json:"freeBytes"`
+	Inodes     uint64 `json:"inodes,omitempty"`
+	FreeInodes uint64 `json:"freeInodes,omitempty"`
+}
+
+// SpaceUsed returns the percentage of space in use
+func (u DiskUsage) SpaceUsed() float64 {
+	if u.TotalBytes == 0 {
+		return 0
+	}
+	return float64(u.TotalBytes-u.FreeBytes) / float64(u.TotalBytes) * 100
+}
+
+// InodesUsed returns the percentage of inodes in use; filesystems without
+// a fixed number of inodes report zero
+func (u DiskUsage) InodesUsed() float64 {
+	if u.Inodes == 0 {
+		return 0
+	}
+	return float64(u.Inodes-u.FreeInodes) / float64(u.Inodes) * 100
+}
+
+// DiskCheck checks the space and inode usage of the filesystems holding
+// the paths the agent writes to. Usage at the warning percentage degrades
+// the check, at the critical percentage it is unhealthy, so a full disk is
+// noticed before config writes start to fail.
+type DiskCheck struct {
+	name     string
+	paths    []string
+	warning  float64
+	critical float64
+	usage    func(path string) (DiskUsage, error)
+}
+
+// NewDiskCheck creates a disk check of paths with thresholds in percent
+// used. Paths that do not exist yet are checked at their nearest existing
+// parent.
+func NewDiskCheck(name string, paths []string, warning, critical float64) *DiskCheck {
+	return &DiskCheck{
+		name:     name,
+		paths:    paths,
+		warning:  warning,
+		critical: critical,
+		usage: func(path string) (DiskUsage, error) {
+			return diskUsage(existingParent(path))
+		},
+	}
+}
+
+// Name returns the check name
+func (h *DiskCheck) Name() string {
+	return h.name
+}
+
+// Check performs the disk check
+func (h *DiskCheck) Check(ctx context.Context) ComponentHealth {
+	result := ComponentHealth{
+		Name:      h.name,
+		Status:    HealthStatusHealthy,
+		Timestamp: time.Now(),
+	}
+	var usages []DiskUsage
+	var problems, errors []string
+	for _, path := range h.paths {
+		usage, err := h.usage(path)
+		if err != nil {
+			errors = append(errors, fmt.Sprintf("%s: %v", path, err))
+			continue
+		}
+		usage.Path = path
+		usages = append(usages, usage)
+
+		used := usage.SpaceUsed()
+		kind := "space"
+		if usage.InodesUsed() > used {
+			used, kind = usage.InodesUsed(), "inodes"
+		}
+		switch {
+		case used >= h.critical:
+			result.Status = HealthStatusUnhealthy
+		case used >= h.warning:
+			if result.Status == HealthStatusHealthy {
+				result.Status = HealthStatusDegraded
+			}
+		default:
+			continue
+		}
+		problems = append(problems, fmt.Sprintf("%s %.0f%% %s used", path, used, kind))
+	}
+
+	result.Data = map[string]interface{}{"usage": usages}
+	switch {
+	case len(usages) == 0 && len(errors) > 0:
+		result.Status = HealthStatusUnknown
+		result.Message = strings.Join(errors, "; ")
+	case len(problems) > 0:
+		result.Message = strings.Join(problems, ", ")
+	default:
+		result.Message = "Disk space is sufficient"
+	}
+	if len(errors) > 0 {
+		result.Data["errors"] = errors
+	}
+	return result
+}
+
+// existingParent returns path or its nearest ancestor that exists
+func existingParent(path string) string {
+	for {
+		if _, err := os.Stat(path); err == nil {
+			return path
+		}
+		parent := filepath.Dir(path)
+		if parent == path {
+			return path
+		}
+		path = parent
+	}
+}
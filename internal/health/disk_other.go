@@ -0,0 +1,15 @@
+//go:build !unix
+
+package health
+
+import "fmt"
+
+// freeSpace is not supported on this platform
+func freeSpace(path string) (uint64, error) {
+	return 0, fmt.Errorf("free space is not supported on this platform")
+}
+
+// diskUsage is not supported on this platform
+func diskUsage(path string) (DiskUsage, error) {
+	return DiskUsage{}, fmt.Errorf("disk usage is not supported on this platform")
+}
@@ -0,0 +1,35 @@
+//go:build unix
+
+package health
+
+import (
+	"fmt"
+
+	"golang.org/x/sys/unix"
+)
+
+// freeSpace returns the bytes available to unprivileged users on the
+// filesystem holding path
+func freeSpace(path string) (uint64, error) {
+	var stat unix.Statfs_t
+	if err := unix.Statfs(path, &stat); err != nil {
+		return 0, fmt.Errorf("failed to stat filesystem: %w", err)
+	}
+	return uint64(stat.Bavail) * uint64(stat.Bsize), nil
+}
+
+// diskUsage returns the space and inode usage of the filesystem holding
+// path, counting space reserved for root as used
+func diskUsage(path string) (DiskUsage, error) {
+	var stat unix.Statfs_t
+	if err := unix.Statfs(path, &stat); err != nil {
+		return DiskUsage{}, fmt.Errorf("failed to stat filesystem: %w", err)
+	}
+	return DiskUsage{
+		Path:       path,
+		TotalBytes: uint64(stat.Blocks) * uint64(stat.Bsize),
+		FreeBytes:  uint64(stat.Bavail) * uint64(stat.Bsize),
+		Inodes:     uint64(stat.Files),
+		FreeInodes: uint64(stat.Ffree),
+	}, nil
+}
@@ -0,0 +1,232 @@
+package health
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"time"
+)
+
+// DNSCheck resolves a test domain through the client's DNS server,
+// optionally reached through a SOCKS5 inbound. Failures to resolve,
+// timeouts and NXDOMAIN are unhealthy; answers outside the expected
+// networks, or in private and reserved ranges when none are expected, are
+// reported as poisoned and degraded.
+type DNSCheck struct {
+	name    string
+	domain  string
+	server  string
+	proxy   string
+	expect  []*net.IPNet
+	timeout time.Duration
+}
+
+// NewDNSCheck creates a check resolving domain. An empty server uses the
+// system resolver; with a proxy the server is queried over TCP through it.
+// Expected answers are given as addresses or CIDR networks.
+func NewDNSCheck(name, domain, server, proxy string, expect []string, timeout time.Duration) (*DNSCheck, error) {
+	check := &DNSCheck{
+		name:    name,
+		domain:  domain,
+		server:  server,
+		proxy:   proxy,
+		timeout: timeout,
+	}
+	for _, entry := range expect {
+		network, err := parseNetwork(entry)
+		if err != nil {
+			return nil, err
+		}
+		check.expect = append(check.expect, network)
+	}
+	return check, nil
+}
+
+// parseNetwork parses an address or CIDR network
+func parseNetwork(entry string) (*net.IPNet, error) {
+	if ip := net.ParseIP(entry); ip != nil {
+		bits := 8 * net.IPv6len
+		if ip.To4() != nil {
+			ip, bits = ip.To4(), 8*net.IPv4len
+		}
+		return &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)}, nil
+	}
+	_, network, err := net.ParseCIDR(entry)
+	if err != nil {
+		return nil, fmt.Errorf("invalid address or network %q", entry)
+	}
+	return network, nil
+}
+
+// Name returns the check name
+func (h *DNSCheck) Name() string {
+	return h.name
+}
+
+// Check performs the DNS check
+func (h *DNSCheck) Check(ctx context.Context) ComponentHealth {
+	if h.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, h.timeout)
+		defer cancel()
+	}
+	result := ComponentHealth{
+		Name:      h.name,
+		Status:    HealthStatusUnhealthy,
+		Timestamp: time.Now(),
+		Data:      map[string]interface{}{"domain": h.domain},
+	}
+	if h.server != "" {
+		result.Data["server"] = h.server
+	}
+	if h.proxy != "" {
+		result.Data["proxy"] = h.proxy
+	}
+
+	started := time.Now()
+	addrs, err := h.resolver().LookupIPAddr(ctx, h.domain)
+	result.Data["duration"] = time.Since(started).String()
+	var dnsErr *net.DNSError
+	switch {
+	case errors.As(err, &dnsErr) && dnsErr.IsNotFound:
+		result.Message = fmt.Sprintf("%s does not resolve (NXDOMAIN)", h.domain)
+		return result
+	case errors.As(err, &dnsErr) && dnsErr.IsTimeout, ctx.Err() != nil:
+		result.Message = fmt.Sprintf("resolving %s timed out", h.domain)
+		return result
+	case err != nil:
+		result.Message = fmt.Sprintf("failed to resolve %s: %v", h.domain, err)
+		return result
+	}
+
+	answers := make([]string, len(addrs))
+	var poisoned []string
+	for i, addr := range addrs {
+		answers[i] = addr.IP.String()
+		if !h.expected(addr.IP) {
+			poisoned = append(poisoned, answers[i])
+		}
+	}
+	result.Data["answers"] = answers
+	if len(poisoned) > 0 {
+		result.Status = HealthStatusDegraded
+		result.Data["poisoned"] = poisoned
+		result.Message = fmt.Sprintf("%s resolves to unexpected addresses %v", h.domain, poisoned)
+		return result
+	}
+	result.Status = HealthStatusHealthy
+	result.Message = fmt.Sprintf("%s resolves", h.domain)
+	return result
+}
+
+// expected tells whether an answer is plausible: within the expected
+// networks, or a public address when none are configured
+func (h *DNSCheck) expected(ip net.IP) bool {
+	if len(h.expect) == 0 {
+		return ip.IsGlobalUnicast() && !ip.IsPrivate()
+	}
+	for _, network := range h.expect {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// resolver returns the resolver querying the configured server
+func (h *DNSCheck) resolver() *net.Resolver {
+	if h.server == "" {
+		return net.DefaultResolver
+	}
+	return &net.Resolver{
+		PreferGo: true,
+		Dial: func(ctx context.Context, network, address string) (net.Conn, error) {
+			// A stream connection makes the resolver use DNS over TCP
+			if h.proxy != "" {
+				return dialSOCKS5(ctx, h.proxy, h.server)
+			}
+			var dialer net.Dialer
+			return dialer.DialContext(ctx, network, h.server)
+		},
+	}
+}
+
+// dialSOCKS5 connects to target through a SOCKS5 proxy without
+// authentication
+func dialSOCKS5(ctx context.Context, proxy, target string) (net.Conn, error) {
+	host, portText, err := net.SplitHostPort(target)
+	if err != nil {
+		return nil, err
+	}
+	port, err := strconv.Atoi(portText)
+	if err != nil {
+		return nil, fmt.Errorf("invalid port in %q", target)
+	}
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "tcp", proxy)
+	if err != nil {
+		return nil, err
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+
+	request := []byte{5, 1, 0}
+	if _, err := conn.Write(request); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	reply := make([]byte, 2)
+	if _, err := io.ReadFull(conn, reply); err != nil || reply[0] != 5 || reply[1] != 0 {
+		conn.Close()
+		return nil, fmt.Errorf("socks5 proxy %s refused the connection", proxy)
+	}
+
+	request = []byte{5, 1, 0}
+	if ip := net.ParseIP(host); ip != nil && ip.To4() != nil {
+		request = append(append(request, 1), ip.To4()...)
+	} else if ip != nil {
+		request = append(append(request, 4), ip.To16()...)
+	} else {
+		request = append(append(request, 3, byte(len(host))), host...)
+	}
+	request = binary.BigEndian.AppendUint16(request, uint16(port))
+	if _, err := conn.Write(request); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	// The reply carries the bound address, of a length set by its type
+	header := make([]byte, 4)
+	if _, err := io.ReadFull(conn, header); err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("no socks5 reply: %w", err)
+	}
+	if header[1] != 0 {
+		conn.Close()
+		return nil, fmt.Errorf("socks5 proxy %s failed to connect to %s: code %d", proxy, target, header[1])
+	}
+	var skip int
+	switch header[3] {
+	case 1:
+		skip = net.IPv4len + 2
+	case 4:
+		skip = net.IPv6len + 2
+	case 3:
+		length := make([]byte, 1)
+		if _, err := io.ReadFull(conn, length); err != nil {
+			conn.Close()
+			return nil, err
+		}
+		skip = int(length[0]) + 2
+	}
+	if _, err := io.ReadFull(conn, make([]byte, skip)); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	conn.SetDeadline(time.Time{})
+	return conn, nil
+}
@@ -0,0 +1,153 @@
+package health
+
+import (
+	"context"
+	"encoding/binary"
+	"io"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+// dnsAnswers are the A records served by the test DNS server; other names
+// are NXDOMAIN and slow.test is not answered
+var dnsAnswers = map[string]net.IP{
+	"good.test":    net.IPv4(93, 184, 216, 34),
+	"private.test": net.IPv4(10, 0, 0, 1),
+}
+
+// dnsReply answers a DNS query, or returns nil to leave it unanswered
+func dnsReply(query []byte) []byte {
+	if len(query) < 12 {
+		return nil
+	}
+	// Read the question name
+	var labels []string
+	offset := 12
+	for offset < len(query) && query[offset] != 0 {
+		length := int(query[offset])
+		labels = append(labels, string(query[offset+1:offset+1+length]))
+		offset += 1 + length
+	}
+	offset++
+	qtype := binary.BigEndian.Uint16(query[offset:])
+	question := query[12 : offset+4]
+	name := strings.Join(labels, ".")
+	if name == "slow.test" {
+		return nil
+	}
+
+	reply := append([]byte{}, query[:2]...)
+	ip, ok := dnsAnswers[name]
+	var answers uint16
+	flags := uint16(0x8180)
+	if !ok {
+		flags |= 3
+	} else if qtype == 1 {
+		answers = 1
+	}
+	reply = binary.BigEndian.AppendUint16(reply, flags)
+	reply = binary.BigEndian.AppendUint16(reply, 1)
+	reply = binary.BigEndian.AppendUint16(reply, answers)
+	reply = append(reply, 0, 0, 0, 0)
+	reply = append(reply, question...)
+	if answers > 0 {
+		reply = append(reply, 0xc0, 12, 0, 1, 0, 1, 0, 0, 0, 60, 0, 4)
+		reply = append(reply, ip.To4()...)
+	}
+	return reply
+}
+
+// serveDNS runs the test DNS server over UDP and TCP on the same port
+func serveDNS(t *testing.T) string {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+	packets, err := net.ListenPacket("udp", ln.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { packets.Close() })
+
+	go func() {
+		buf := make([]byte, 512)
+		for {
+			n, addr, err := packets.ReadFrom(buf)
+			if err != nil {
+				return
+			}
+			if reply := dnsReply(buf[:n]); reply != nil {
+				packets.WriteTo(reply, addr)
+			}
+		}
+	}()
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				for {
+					length := make([]byte, 2)
+					if _, err := io.ReadFull(conn, length); err != nil {
+						return
+					}
+					query := make([]byte, binary.BigEndian.Uint16(length))
+					if _, err := io.ReadFull(conn, query); err != nil {
+						return
+					}
+					reply := dnsReply(query)
+					if reply == nil {
+						continue
+					}
+					conn.Write(binary.BigEndian.AppendUint16(nil, uint16(len(reply))))
+					conn.Write(reply)
+				}
+			}()
+		}
+	}()
+	return ln.Addr().String()
+}
+
+func TestDNSCheck(t *testing.T) {
+	server := serveDNS(t)
+	socks := serveSOCKS5(t)
+
+	tests := []struct {
+		name   string
+		domain string
+		proxy  string
+		expect []string
+		status HealthStatus
+	}{
+		{"resolves", "good.test", "", nil, HealthStatusHealthy},
+		{"through proxy", "good.test", socks, nil, HealthStatusHealthy},
+		{"nxdomain", "missing.test", "", nil, HealthStatusUnhealthy},
+		{"nxdomain through proxy", "missing.test", socks, nil, HealthStatusUnhealthy},
+		{"timeout", "slow.test", "", nil, HealthStatusUnhealthy},
+		{"private answer", "private.test", "", nil, HealthStatusDegraded},
+		{"expected private answer", "private.test", "", []string{"10.0.0.0/8"}, HealthStatusHealthy},
+		{"unexpected answer", "good.test", "", []string{"10.0.0.1"}, HealthStatusDegraded},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			check, err := NewDNSCheck("dns", tt.domain, server, tt.proxy, tt.expect, 500*time.Millisecond)
+			if err != nil {
+				t.Fatal(err)
+			}
+			result := check.Check(context.Background())
+			if result.Status != tt.status {
+				t.Errorf("Expected status %s, got %s: %s", tt.status, result.Status, result.Message)
+			}
+		})
+	}
+
+	if _, err := NewDNSCheck("dns", "good.test", server, "", []string{"not-an-ip"}, time.Second); err == nil {
+		t.Error("Expected error for an invalid expected network")
+	}
+}
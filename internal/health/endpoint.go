@@ -0,0 +1,168 @@
+package health
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// Endpoint kinds
+const (
+	// EndpointTCP only checks that the address accepts connections
+	EndpointTCP = "tcp"
+	// EndpointSOCKS5 checks for a SOCKS5 method selection reply
+	EndpointSOCKS5 = "socks5"
+	// EndpointHTTP checks for an HTTP response from a proxy
+	EndpointHTTP = "http"
+)
+
+// maxEndpointBody bounds the response body read from probe URLs
+const maxEndpointBody = 64 << 10
+
+// EndpointCheck checks that a proxy inbound accepts connections and speaks
+// its protocol, and optionally fetches a URL through it. An inbound that
+// does not answer is unhealthy; one that answers but cannot fetch the URL is
+// degraded, as the outbound rather than the client is failing.
+type EndpointCheck struct {
+	name    string
+	kind    string
+	address string
+	url     string
+	timeout time.Duration
+}
+
+// NewEndpointCheck creates a check of the inbound at address, of kind tcp,
+// socks5 or http. A URL is fetched through socks5 and http inbounds.
+func NewEndpointCheck(name, kind, address, url string, timeout time.Duration) *EndpointCheck {
+	return &EndpointCheck{
+		name:    name,
+		kind:    kind,
+		address: address,
+		url:     url,
+		timeout: timeout,
+	}
+}
+
+// Name returns the check name
+func (h *EndpointCheck) Name() string {
+	return h.name
+}
+
+// Check performs the endpoint check
+func (h *EndpointCheck) Check(ctx context.Context) ComponentHealth {
+	if h.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, h.timeout)
+		defer cancel()
+	}
+	result := ComponentHealth{
+		Name:      h.name,
+		Status:    HealthStatusUnhealthy,
+		Timestamp: time.Now(),
+		Data: map[string]interface{}{
+			"kind":    h.kind,
+			"address": h.address,
+		},
+	}
+
+	started := time.Now()
+	if err := h.handshake(ctx); err != nil {
+		result.Message = fmt.Sprintf("%s inbound %s not accepting connections: %v", h.kind, h.address, err)
+		return result
+	}
+	result.Data["connectTime"] = time.Since(started).String()
+	if h.url == "" {
+		result.Status = HealthStatusHealthy
+		result.Message = fmt.Sprintf("%s inbound %s accepts connections", h.kind, h.address)
+		return result
+	}
+
+	result.Data["url"] = h.url
+	started = time.Now()
+	code, err := h.fetch(ctx)
+	result.Data["fetchTime"] = time.Since(started).String()
+	if code != 0 {
+		result.Data["statusCode"] = code
+	}
+	if err != nil {
+		result.Status = HealthStatusDegraded
+		result.Message = fmt.Sprintf("failed to fetch %s through %s: %v", h.url, h.address, err)
+		return result
+	}
+	result.Status = HealthStatusHealthy
+	result.Message = fmt.Sprintf("fetched %s through %s", h.url, h.address)
+	return result
+}
+
+// handshake connects to the inbound and, for proxies, waits for the first
+// reply of their protocol
+func (h *EndpointCheck) handshake(ctx context.Context) error {
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "tcp", h.address)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+
+	switch h.kind {
+	case EndpointSOCKS5:
+		// Offer no authentication; any SOCKS5 reply, even one refusing
+		// the method, shows the proxy is serving
+		if _, err := conn.Write([]byte{5, 1, 0}); err != nil {
+			return err
+		}
+		reply := make([]byte, 2)
+		if _, err := io.ReadFull(conn, reply); err != nil {
+			return fmt.Errorf("no socks5 reply: %w", err)
+		}
+		if reply[0] != 5 {
+			return fmt.Errorf("not a socks5 reply: version %d", reply[0])
+		}
+	case EndpointHTTP:
+		if _, err := fmt.Fprintf(conn, "OPTIONS * HTTP/1.1\r\nHost: %s\r\nConnection: close\r\n\r\n", h.address); err != nil {
+			return err
+		}
+		line, err := bufio.NewReader(conn).ReadString('\n')
+		if err != nil {
+			return fmt.Errorf("no http reply: %w", err)
+		}
+		if !strings.HasPrefix(line, "HTTP/") {
+			return fmt.Errorf("not an http reply: %q", strings.TrimSpace(line))
+		}
+	}
+	return nil
+}
+
+// fetch gets the URL through the inbound and fails on error statuses
+func (h *EndpointCheck) fetch(ctx context.Context) (int, error) {
+	proxy := &url.URL{Scheme: h.kind, Host: h.address}
+	client := &http.Client{
+		Transport: &http.Transport{
+			Proxy:             http.ProxyURL(proxy),
+			DisableKeepAlives: true,
+		},
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, h.url, nil)
+	if err != nil {
+		return 0, err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, maxEndpointBody))
+	if resp.StatusCode >= 400 {
+		return resp.StatusCode, fmt.Errorf("status %s", resp.Status)
+	}
+	return resp.StatusCode, nil
+}
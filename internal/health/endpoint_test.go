@@ -0,0 +1,135 @@
+package health
+
+import (
+	"context"
+	"encoding/binary"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// serveSOCKS5 runs a minimal SOCKS5 proxy without authentication
+func serveSOCKS5(t *testing.T) string {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				greeting := make([]byte, 3)
+				if _, err := io.ReadFull(conn, greeting); err != nil {
+					return
+				}
+				conn.Write([]byte{5, 0})
+				request := make([]byte, 4)
+				if _, err := io.ReadFull(conn, request); err != nil {
+					return
+				}
+				var host string
+				switch request[3] {
+				case 1:
+					ip := make([]byte, 4)
+					io.ReadFull(conn, ip)
+					host = net.IP(ip).String()
+				case 3:
+					length := make([]byte, 1)
+					io.ReadFull(conn, length)
+					name := make([]byte, length[0])
+					io.ReadFull(conn, name)
+					host = string(name)
+				default:
+					return
+				}
+				port := make([]byte, 2)
+				io.ReadFull(conn, port)
+				target, err := net.Dial("tcp", net.JoinHostPort(host, strconv.Itoa(int(binary.BigEndian.Uint16(port)))))
+				if err != nil {
+					conn.Write([]byte{5, 5, 0, 1, 0, 0, 0, 0, 0, 0})
+					return
+				}
+				defer target.Close()
+				conn.Write([]byte{5, 0, 0, 1, 0, 0, 0, 0, 0, 0})
+				go io.Copy(target, conn)
+				io.Copy(conn, target)
+			}()
+		}
+	}()
+	return ln.Addr().String()
+}
+
+func TestEndpointCheck(t *testing.T) {
+	target := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/missing" {
+			http.NotFound(w, r)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer target.Close()
+	// An HTTP proxy answering requests for the target itself
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !r.URL.IsAbs() {
+			http.Error(w, "not a proxy request", http.StatusBadRequest)
+			return
+		}
+		resp, err := http.Get(r.URL.String())
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadGateway)
+			return
+		}
+		resp.Body.Close()
+		w.WriteHeader(resp.StatusCode)
+	}))
+	defer proxy.Close()
+	socks := serveSOCKS5(t)
+	proxyAddress := proxy.Listener.Addr().String()
+
+	// A port nothing listens on
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	closed := ln.Addr().String()
+	ln.Close()
+
+	tests := []struct {
+		name    string
+		kind    string
+		address string
+		url     string
+		status  HealthStatus
+	}{
+		{"tcp", EndpointTCP, proxyAddress, "", HealthStatusHealthy},
+		{"closed port", EndpointTCP, closed, "", HealthStatusUnhealthy},
+		{"http proxy", EndpointHTTP, proxyAddress, "", HealthStatusHealthy},
+		{"http proxy url", EndpointHTTP, proxyAddress, target.URL + "/generate_204", HealthStatusHealthy},
+		{"http proxy error status", EndpointHTTP, proxyAddress, target.URL + "/missing", HealthStatusDegraded},
+		{"socks5", EndpointSOCKS5, socks, "", HealthStatusHealthy},
+		{"socks5 url", EndpointSOCKS5, socks, target.URL + "/generate_204", HealthStatusHealthy},
+		{"socks5 unreachable url", EndpointSOCKS5, socks, "http://" + closed + "/", HealthStatusDegraded},
+		{"socks5 on http proxy", EndpointSOCKS5, proxyAddress, "", HealthStatusUnhealthy},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			check := NewEndpointCheck("inbound", tt.kind, tt.address, tt.url, 500*time.Millisecond)
+			result := check.Check(context.Background())
+			if result.Name != "inbound" {
+				t.Errorf("Expected name inbound, got %s", result.Name)
+			}
+			if result.Status != tt.status {
+				t.Errorf("Expected status %s, got %s: %s", tt.status, result.Status, result.Message)
+			}
+		})
+	}
+}
@@ -0,0 +1,237 @@
+package health
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"runtime"
+	"sync"
+	"time"
+
+	"github.com/kpblcaoo/sboxagent/internal/logger"
+)
+
+// Defaults for trend checks
+const (
+	defaultTrendWindow  = 30
+	defaultTrendHorizon = 24 * time.Hour
+	// minTrendSamples is the number of samples needed before projecting
+	minTrendSamples = 3
+)
+
+// Sample is a value observed at a point in time
+type Sample struct {
+	Time  time.Time
+	Value float64
+}
+
+// Trend keeps the most recent samples of a value and fits a line through
+// them to project where the value is heading
+type Trend struct {
+	window  int
+	samples []Sample
+}
+
+// NewTrend creates a trend over the last window samples
+func NewTrend(window int) *Trend {
+	if window < minTrendSamples {
+		window = minTrendSamples
+	}
+	return &Trend{window: window}
+}
+
+// Add records a sample, dropping the oldest one beyond the window
+func (t *Trend) Add(sample Sample) {
+	t.samples = append(t.samples, sample)
+	if len(t.samples) > t.window {
+		t.samples = t.samples[len(t.samples)-t.window:]
+	}
+}
+
+// Len returns the number of samples kept
+func (t *Trend) Len() int {
+	return len(t.samples)
+}
+
+// Slope returns the least squares rate of change per second. It is false
+// until enough samples spanning some time were recorded.
+func (t *Trend) Slope() (float64, bool) {
+	n := float64(len(t.samples))
+	if len(t.samples) < minTrendSamples {
+		return 0, false
+	}
+
+	origin := t.samples[0].Time
+	var sumX, sumY, sumXY, sumXX float64
+	for _, s := range t.samples {
+		x := s.Time.Sub(origin).Seconds()
+		sumX += x
+		sumY += s.Value
+		sumXY += x * s.Value
+		sumXX += x * x
+	}
+	denominator := n*sumXX - sumX*sumX
+	if denominator == 0 {
+		return 0, false
+	}
+	return (n*sumXY - sumX*sumY) / denominator, true
+}
+
+// TimeToLimit projects how long until the value crosses limit at the
+// current rate. It is false when the value is not moving towards the limit.
+func (t *Trend) TimeToLimit(limit float64) (time.Duration, bool) {
+	slope, ok := t.Slope()
+	if !ok || slope == 0 {
+		return 0, false
+	}
+	current := t.samples[len(t.samples)-1].Value
+	seconds := (limit - current) / slope
+	if seconds < 0 || math.IsInf(seconds, 0) || math.IsNaN(seconds) {
+		return 0, false
+	}
+	if seconds > math.MaxInt64/float64(time.Second) {
+		return 0, false
+	}
+	return time.Duration(seconds * float64(time.Second)), true
+}
+
+// TrendHealthCheck samples a value on every check and reports the component
+// degraded when the trend projects the value to cross its limit within the
+// horizon, and unhealthy once it has crossed it. Limits are crossed from
+// below unless Falling is set, as for free disk space.
+type TrendHealthCheck struct {
+	logger *logger.Logger
+	name   string
+	sample func(ctx context.Context) (float64, error)
+	limit  float64
+	// Falling reports values that fail by dropping below the limit
+	Falling bool
+	// Horizon is how far ahead a projected failure degrades the component
+	Horizon time.Duration
+
+	mu    sync.Mutex
+	trend *Trend
+	now   func() time.Time
+}
+
+// NewTrendHealthCheck creates a trend check of the values returned by sample
+func NewTrendHealthCheck(log *logger.Logger, name string, limit float64, sample func(ctx context.Context) (float64, error)) *TrendHealthCheck {
+	return &TrendHealthCheck{
+		logger:  log,
+		name:    name,
+		sample:  sample,
+		limit:   limit,
+		Horizon: defaultTrendHorizon,
+		trend:   NewTrend(defaultTrendWindow),
+		now:     time.Now,
+	}
+}
+
+// SetWindow keeps the last window samples, dropping those recorded so far
+func (h *TrendHealthCheck) SetWindow(window int) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.trend = NewTrend(window)
+}
+
+// Name returns the check name
+func (h *TrendHealthCheck) Name() string {
+	return h.name
+}
+
+// Check samples the value and evaluates its trend
+func (h *TrendHealthCheck) Check(ctx context.Context) ComponentHealth {
+	now := h.now()
+	value, err := h.sample(ctx)
+	if err != nil {
+		return ComponentHealth{
+			Name:      h.name,
+			Status:    HealthStatusUnknown,
+			Message:   fmt.Sprintf("Failed to sample %s: %v", h.name, err),
+			Timestamp: now,
+		}
+	}
+
+	h.mu.Lock()
+	h.trend.Add(Sample{Time: now, Value: value})
+	slope, hasSlope := h.trend.Slope()
+	remaining, projected := h.trend.TimeToLimit(h.limit)
+	samples := h.trend.Len()
+	h.mu.Unlock()
+
+	data := map[string]interface{}{
+		"value":   value,
+		"limit":   h.limit,
+		"samples": samples,
+	}
+	if hasSlope {
+		data["ratePerHour"] = slope * time.Hour.Seconds()
+	}
+
+	var status HealthStatus
+	var message string
+	crossed := value >= h.limit
+	if h.Falling {
+		crossed = value <= h.limit
+	}
+	switch {
+	case crossed:
+		status = HealthStatusUnhealthy
+		message = fmt.Sprintf("%s is past its limit", h.name)
+	case projected && remaining <= h.Horizon:
+		status = HealthStatusDegraded
+		message = fmt.Sprintf("degraded — projected to fail in ~%s", formatProjection(remaining))
+		data["projectedFailure"] = now.Add(remaining)
+	default:
+		status = HealthStatusHealthy
+		message = fmt.Sprintf("%s is within its limit", h.name)
+	}
+
+	return ComponentHealth{
+		Name:      h.name,
+		Status:    status,
+		Message:   message,
+		Timestamp: now,
+		Data:      data,
+	}
+}
+
+// formatProjection rounds a projected duration for display
+func formatProjection(d time.Duration) string {
+	if d >= time.Hour {
+		return fmt.Sprintf("%.0f hours", math.Round(d.Hours()))
+	}
+	return fmt.Sprintf("%.0f minutes", math.Ceil(d.Minutes()))
+}
+
+// NewMemoryTrendCheck projects the heap of the agent growing past limit bytes
+func NewMemoryTrendCheck(log *logger.Logger, limit uint64) *TrendHealthCheck {
+	return NewTrendHealthCheck(log, "memory_trend", float64(limit), func(ctx context.Context) (float64, error) {
+		var m runtime.MemStats
+		runtime.ReadMemStats(&m)
+		return float64(m.HeapAlloc), nil
+	})
+}
+
+// NewErrorRateTrendCheck projects the dispatcher error rate, in percent of
+// processed events, rising past maxRate
+func NewErrorRateTrendCheck(log *logger.Logger, dispatcher DispatcherStats, maxRate float64) *TrendHealthCheck {
+	return NewTrendHealthCheck(log, "error_rate_trend", maxRate, func(ctx context.Context) (float64, error) {
+		processed := dispatcher.GetEventsProcessed()
+		if processed == 0 {
+			return 0, nil
+		}
+		return float64(dispatcher.GetErrors()) / float64(processed) * 100, nil
+	})
+}
+
+// NewDiskTrendCheck projects the free space of the filesystem holding path
+// shrinking below minFree bytes
+func NewDiskTrendCheck(log *logger.Logger, path string, minFree uint64) *TrendHealthCheck {
+	check := NewTrendHealthCheck(log, "disk_trend", float64(minFree), func(ctx context.Context) (float64, error) {
+		free, err := freeSpace(path)
+		return float64(free), err
+	})
+	check.Falling = true
+	return check
+}
@@ -0,0 +1,126 @@
+package health
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/kpblcaoo/sboxagent/internal/logger"
+)
+
+func TestTrend_TimeToLimit(t *testing.T) {
+	start := time.Now()
+	trend := NewTrend(5)
+
+	if _, ok := trend.TimeToLimit(100); ok {
+		t.Fatal("Expected no projection without samples")
+	}
+
+	// Rising by 10 per hour from 0
+	for i := 0; i < 8; i++ {
+		trend.Add(Sample{Time: start.Add(time.Duration(i) * time.Hour), Value: float64(i * 10)})
+	}
+	if trend.Len() != 5 {
+		t.Errorf("Expected window of 5 samples, got %d", trend.Len())
+	}
+
+	remaining, ok := trend.TimeToLimit(100)
+	if !ok {
+		t.Fatal("Expected a projection")
+	}
+	if remaining != 3*time.Hour {
+		t.Errorf("Expected 3h to the limit, got %v", remaining)
+	}
+
+	// Moving away from the limit is never projected to cross it
+	if _, ok := trend.TimeToLimit(0); ok {
+		t.Error("Expected no projection for a limit behind the trend")
+	}
+}
+
+func TestTrendHealthCheck(t *testing.T) {
+	log, _ := logger.New("error")
+	start := time.Now()
+
+	var value float64
+	check := NewTrendHealthCheck(log, "test_trend", 100, func(ctx context.Context) (float64, error) {
+		return value, nil
+	})
+	check.Horizon = 6 * time.Hour
+
+	step := 0
+	check.now = func() time.Time { return start.Add(time.Duration(step) * time.Hour) }
+	run := func(v float64) ComponentHealth {
+		value = v
+		result := check.Check(context.Background())
+		step++
+		return result
+	}
+
+	// Slow growth is projected beyond the horizon
+	for _, v := range []float64{10, 11, 12} {
+		if result := run(v); result.Status != HealthStatusHealthy {
+			t.Fatalf("Expected healthy at %v, got %s: %s", v, result.Status, result.Message)
+		}
+	}
+
+	// Fast growth reaches the limit within the horizon
+	run(40)
+	result := run(70)
+	if result.Status != HealthStatusDegraded {
+		t.Fatalf("Expected degraded, got %s: %s", result.Status, result.Message)
+	}
+	if !strings.Contains(result.Message, "projected to fail in ~") {
+		t.Errorf("Expected projection in message, got %q", result.Message)
+	}
+	if _, ok := result.Data["projectedFailure"].(time.Time); !ok {
+		t.Error("Expected projected failure time in data")
+	}
+
+	if result := run(120); result.Status != HealthStatusUnhealthy {
+		t.Errorf("Expected unhealthy past the limit, got %s", result.Status)
+	}
+}
+
+func TestTrendHealthCheck_Falling(t *testing.T) {
+	log, _ := logger.New("error")
+	start := time.Now()
+
+	free := []float64{1000, 800, 600}
+	check := NewTrendHealthCheck(log, "disk_trend", 100, func(ctx context.Context) (float64, error) {
+		return free[0], nil
+	})
+	check.Falling = true
+
+	step := 0
+	check.now = func() time.Time { return start.Add(time.Duration(step) * time.Hour) }
+	var result ComponentHealth
+	for len(free) > 0 {
+		result = check.Check(context.Background())
+		free = free[1:]
+		step++
+	}
+
+	// 600 left shrinking by 200 per hour fails in about 3 hours
+	if result.Status != HealthStatusDegraded {
+		t.Fatalf("Expected degraded, got %s: %s", result.Status, result.Message)
+	}
+	if !strings.Contains(result.Message, "~3 hours") {
+		t.Errorf("Expected ~3 hours in message, got %q", result.Message)
+	}
+}
+
+func TestNewDiskTrendCheck(t *testing.T) {
+	log, _ := logger.New("error")
+
+	result := NewDiskTrendCheck(log, t.TempDir(), 1).Check(context.Background())
+	if result.Status != HealthStatusHealthy {
+		t.Errorf("Expected healthy disk, got %s: %s", result.Status, result.Message)
+	}
+
+	result = NewDiskTrendCheck(log, "/nonexistent/path", 1).Check(context.Background())
+	if result.Status != HealthStatusUnknown {
+		t.Errorf("Expected unknown for a missing path, got %s", result.Status)
+	}
+}
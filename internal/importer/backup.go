@@ -0,0 +1,113 @@
+package importer
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/kpblcaoo/sboxagent/internal/config"
+)
+
+// backupSuffix ends the names of client config backups
+const backupSuffix = ".bak"
+
+// Backup is a saved copy of a replaced client config
+type Backup struct {
+	Name      string    `json:"name"`
+	Path      string    `json:"path"`
+	CreatedAt time.Time `json:"createdAt"`
+	Size      int64     `json:"size"`
+}
+
+// ListBackups returns the backups of the config at path, newest first
+func ListBackups(path string) ([]Backup, error) {
+	matches, err := filepath.Glob(globEscape(path) + ".*" + backupSuffix)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list backups: %w", err)
+	}
+
+	prefix := filepath.Base(path) + "."
+	backups := make([]Backup, 0, len(matches))
+	for _, match := range matches {
+		name := filepath.Base(match)
+		stamp := strings.TrimSuffix(strings.TrimPrefix(name, prefix), backupSuffix)
+		createdAt, err := time.ParseInLocation(backupTimeFormat, stamp, time.Local)
+		if err != nil {
+			// Not one of ours
+			continue
+		}
+		info, err := os.Stat(match)
+		if err != nil {
+			continue
+		}
+		backups = append(backups, Backup{
+			Name:      name,
+			Path:      match,
+			CreatedAt: createdAt,
+			Size:      info.Size(),
+		})
+	}
+
+	sort.Slice(backups, func(i, j int) bool {
+		return backups[i].CreatedAt.After(backups[j].CreatedAt)
+	})
+	return backups, nil
+}
+
+// PruneBackups removes backups of the config at path beyond the policy's
+// count and age limits and returns the removed backups
+func PruneBackups(path string, policy config.BackupConfig, now time.Time) ([]Backup, error) {
+	backups, err := ListBackups(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var removed []Backup
+	for i, backup := range backups {
+		tooMany := policy.MaxCount > 0 && i >= policy.MaxCount
+		tooOld := policy.MaxAge > 0 && now.Sub(backup.CreatedAt) > policy.MaxAge
+		if !tooMany && !tooOld {
+			continue
+		}
+		if err := os.Remove(backup.Path); err != nil && !os.IsNotExist(err) {
+			return removed, fmt.Errorf("failed to remove backup %s: %w", backup.Name, err)
+		}
+		removed = append(removed, backup)
+	}
+	return removed, nil
+}
+
+// RestoreBackup replaces the config at path with the named backup. The
+// current config is backed up first; its backup path is returned.
+func RestoreBackup(path, name string) (string, error) {
+	backups, err := ListBackups(path)
+	if err != nil {
+		return "", err
+	}
+	for _, backup := range backups {
+		if backup.Name != name {
+			continue
+		}
+		data, err := os.ReadFile(backup.Path)
+		if err != nil {
+			return "", fmt.Errorf("failed to read backup: %w", err)
+		}
+		return writeClientConfig(path, data)
+	}
+	return "", fmt.Errorf("backup %q not found for %s", name, path)
+}
+
+// globEscape escapes glob metacharacters in a literal path
+func globEscape(path string) string {
+	var b strings.Builder
+	for _, r := range path {
+		if strings.ContainsRune(`*?[\`, r) {
+			b.WriteRune('\\')
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
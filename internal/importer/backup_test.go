@@ -0,0 +1,89 @@
+package importer
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/kpblcaoo/sboxagent/internal/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// writeBackups creates a config and backups of it taken at the given times
+func writeBackups(t *testing.T, times ...time.Time) string {
+	path := filepath.Join(t.TempDir(), "config[1].json")
+	require.NoError(t, os.WriteFile(path, []byte("current"), 0640))
+	for _, at := range times {
+		backup := path + "." + at.Format(backupTimeFormat) + backupSuffix
+		require.NoError(t, os.WriteFile(backup, []byte(at.Format(backupTimeFormat)), 0640))
+	}
+	// Files that only look like backups are ignored
+	require.NoError(t, os.WriteFile(path+".manual.bak", []byte("manual"), 0640))
+	return path
+}
+
+func TestListBackups(t *testing.T) {
+	now := time.Now().Truncate(time.Second)
+	path := writeBackups(t, now.Add(-2*time.Hour), now, now.Add(-time.Hour))
+
+	backups, err := ListBackups(path)
+	require.NoError(t, err)
+	require.Len(t, backups, 3)
+	assert.True(t, backups[0].CreatedAt.Equal(now))
+	assert.True(t, backups[2].CreatedAt.Equal(now.Add(-2*time.Hour)))
+	assert.Equal(t, filepath.Base(backups[0].Path), backups[0].Name)
+	assert.NotZero(t, backups[0].Size)
+}
+
+func TestPruneBackups(t *testing.T) {
+	now := time.Now().Truncate(time.Second)
+	times := []time.Time{now, now.Add(-time.Hour), now.Add(-2 * time.Hour), now.Add(-48 * time.Hour)}
+
+	t.Run("max count", func(t *testing.T) {
+		path := writeBackups(t, times...)
+		removed, err := PruneBackups(path, config.BackupConfig{MaxCount: 2}, now)
+		require.NoError(t, err)
+		assert.Len(t, removed, 2)
+
+		backups, err := ListBackups(path)
+		require.NoError(t, err)
+		assert.Len(t, backups, 2)
+		assert.True(t, backups[1].CreatedAt.Equal(now.Add(-time.Hour)))
+	})
+
+	t.Run("max age", func(t *testing.T) {
+		path := writeBackups(t, times...)
+		removed, err := PruneBackups(path, config.BackupConfig{MaxAge: 24 * time.Hour}, now)
+		require.NoError(t, err)
+		require.Len(t, removed, 1)
+		assert.True(t, removed[0].CreatedAt.Equal(now.Add(-48*time.Hour)))
+	})
+
+	t.Run("unlimited", func(t *testing.T) {
+		path := writeBackups(t, times...)
+		removed, err := PruneBackups(path, config.BackupConfig{}, now)
+		require.NoError(t, err)
+		assert.Empty(t, removed)
+	})
+}
+
+func TestRestoreBackup(t *testing.T) {
+	taken := time.Now().Add(-time.Hour).Truncate(time.Second)
+	path := writeBackups(t, taken)
+	name := filepath.Base(path) + "." + taken.Format(backupTimeFormat) + backupSuffix
+
+	replaced, err := RestoreBackup(path, name)
+	require.NoError(t, err)
+
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	assert.Equal(t, taken.Format(backupTimeFormat), string(data))
+	data, err = os.ReadFile(replaced)
+	require.NoError(t, err)
+	assert.Equal(t, "current", string(data))
+
+	_, err = RestoreBackup(path, "config.json.manual.bak")
+	assert.ErrorContains(t, err, "not found")
+}
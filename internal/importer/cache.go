@@ -0,0 +1,111 @@
+package importer
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+	"time"
+)
+
+// queryCacheTTL is how long the output of a sboxmgr query is reused
+const queryCacheTTL = 10 * time.Minute
+
+// queryResult is the cached output of a sboxmgr query
+type queryResult struct {
+	output    []byte
+	expiresAt time.Time
+}
+
+// queryCache caches sboxmgr query output by command line. Entries are
+// dropped when the sboxmgr executable changes, as after an upgrade.
+type queryCache struct {
+	mu          sync.Mutex
+	version     string
+	results     map[string]queryResult
+	hits, calls int64
+}
+
+// get returns unexpired output for a command run by the given sboxmgr
+// version, clearing the cache if the version changed
+func (c *queryCache) get(key, version string, now time.Time) ([]byte, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.calls++
+	if version != c.version {
+		c.version = version
+		c.results = nil
+		return nil, false
+	}
+	result, ok := c.results[key]
+	if !ok || !now.Before(result.expiresAt) {
+		return nil, false
+	}
+	c.hits++
+	return result.output, true
+}
+
+// put caches output for a command run by the given sboxmgr version
+func (c *queryCache) put(key, version string, output []byte, expiresAt time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if version != c.version {
+		return
+	}
+	if c.results == nil {
+		c.results = make(map[string]queryResult)
+	}
+	c.results[key] = queryResult{output: output, expiresAt: expiresAt}
+}
+
+// sboxmgrVersion identifies the installed sboxmgr executable by path, size
+// and modification time, so upgrades invalidate cached queries without
+// running sboxmgr
+func sboxmgrVersion(executable string) (string, error) {
+	path, err := exec.LookPath(executable)
+	if err != nil {
+		return "", fmt.Errorf("failed to find sboxmgr: %w", err)
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return "", fmt.Errorf("failed to stat sboxmgr: %w", err)
+	}
+	return fmt.Sprintf("%s:%d:%d", path, info.Size(), info.ModTime().UnixNano()), nil
+}
+
+// Query runs sboxmgr with args for static information such as its version,
+// supported clients or info, and returns its stdout. Output is cached for
+// ten minutes and until the sboxmgr executable changes.
+func (i *Importer) Query(ctx context.Context, args ...string) ([]byte, error) {
+	if len(i.config.Command) == 0 {
+		return nil, fmt.Errorf("no sboxmgr command configured")
+	}
+	executable := i.config.Command[0]
+	version, err := sboxmgrVersion(executable)
+	if err != nil {
+		return nil, err
+	}
+
+	key := strings.Join(args, "\x00")
+	if output, ok := i.queries.get(key, version, time.Now()); ok {
+		return output, nil
+	}
+
+	output, failure := i.runSboxmgr(ctx, append([]string{executable}, args...), i.config.Timeout)
+	if failure != nil {
+		failure.Attempts = 1
+		return nil, failure
+	}
+	i.queries.put(key, version, output, time.Now().Add(queryCacheTTL))
+	return output, nil
+}
+
+// QueryCacheStats returns how many queries were made and answered from the
+// cache
+func (i *Importer) QueryCacheStats() (calls, hits int64) {
+	i.queries.mu.Lock()
+	defer i.queries.mu.Unlock()
+	return i.queries.calls, i.queries.hits
+}
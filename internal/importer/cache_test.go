@@ -0,0 +1,66 @@
+package importer
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestImporter_QueryCache(t *testing.T) {
+	dir := t.TempDir()
+	runs := filepath.Join(dir, "runs")
+	script := filepath.Join(dir, "sboxmgr")
+	writeScript := func(version string) {
+		require.NoError(t, os.WriteFile(script, []byte(
+			"#!/bin/sh\necho run >> "+runs+"\necho "+version+" \"$@\"\n"), 0755))
+	}
+	countRuns := func() int {
+		data, err := os.ReadFile(runs)
+		require.NoError(t, err)
+		return strings.Count(string(data), "run")
+	}
+	writeScript("v1")
+	importer := newSboxmgrImporter(t, []string{script, "export"})
+
+	output, err := importer.Query(context.Background(), "list-clients")
+	require.NoError(t, err)
+	assert.Equal(t, "v1 list-clients\n", string(output))
+
+	// Repeated queries are served from the cache, other ones are not
+	output, err = importer.Query(context.Background(), "list-clients")
+	require.NoError(t, err)
+	assert.Equal(t, "v1 list-clients\n", string(output))
+	_, err = importer.Query(context.Background(), "info")
+	require.NoError(t, err)
+	assert.Equal(t, 2, countRuns())
+
+	// Upgrading sboxmgr invalidates the cache
+	writeScript("version2")
+	output, err = importer.Query(context.Background(), "list-clients")
+	require.NoError(t, err)
+	assert.Equal(t, "version2 list-clients\n", string(output))
+	assert.Equal(t, 3, countRuns())
+
+	calls, hits := importer.QueryCacheStats()
+	assert.Equal(t, int64(4), calls)
+	assert.Equal(t, int64(1), hits)
+}
+
+func TestImporter_QueryFailureNotCached(t *testing.T) {
+	importer := newSboxmgrImporter(t, []string{"sh"})
+
+	_, err := importer.Query(context.Background(), "-c", "exit 3")
+	var failure *SboxmgrError
+	require.ErrorAs(t, err, &failure)
+	assert.Equal(t, 3, failure.ExitCode)
+
+	_, err = importer.Query(context.Background(), "-c", "exit 3")
+	require.Error(t, err)
+	_, hits := importer.QueryCacheStats()
+	assert.Zero(t, hits)
+}
@@ -0,0 +1,152 @@
+package importer
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// maskedSecret replaces secret values in config changes
+const maskedSecret = "********"
+
+// ConfigChange is a setting a new client config adds, removes or changes,
+// by its path such as outbounds[0].server. Old is unset for added and New
+// for removed settings.
+type ConfigChange struct {
+	Path string      `json:"path"`
+	Old  interface{} `json:"old,omitempty"`
+	New  interface{} `json:"new,omitempty"`
+}
+
+// DiffConfig compares an imported config with the one at path, as it would
+// be written, and returns the changed settings sorted by path. A missing
+// file compares as empty. Settings filled from secrets are masked.
+func (i *Importer) DiffConfig(imported *ImportedConfig, path string) ([]ConfigChange, error) {
+	var current interface{}
+	data, err := os.ReadFile(path)
+	switch {
+	case errors.Is(err, os.ErrNotExist):
+	case err != nil:
+		return nil, fmt.Errorf("failed to read current config: %w", err)
+	default:
+		if err := json.Unmarshal(data, &current); err != nil {
+			return nil, fmt.Errorf("failed to parse current config: %w", err)
+		}
+	}
+
+	var proposed interface{}
+	if err := json.Unmarshal(imported.Config, &proposed); err != nil {
+		return nil, fmt.Errorf("failed to parse imported config: %w", err)
+	}
+
+	oldValues := make(map[string]interface{})
+	newValues := make(map[string]interface{})
+	flattenJSON(current, "", oldValues)
+	flattenJSON(proposed, "", newValues)
+
+	paths := make(map[string]struct{}, len(oldValues))
+	for path := range oldValues {
+		paths[path] = struct{}{}
+	}
+	for path := range newValues {
+		paths[path] = struct{}{}
+	}
+
+	changes := []ConfigChange{}
+	for path := range paths {
+		oldValue, hadOld := oldValues[path]
+		newValue, hasNew := newValues[path]
+
+		// Compare secrets by their values without showing them
+		secret := false
+		if placeholder, ok := newValue.(string); ok && strings.HasPrefix(placeholder, SecretPlaceholderPrefix) {
+			if newValue, err = i.resolvePlaceholder(placeholder); err != nil {
+				return nil, err
+			}
+			secret = true
+		}
+		if hadOld == hasNew && reflect.DeepEqual(oldValue, newValue) {
+			continue
+		}
+		// An emptied or filled container shows as its entries
+		if (!hadOld && hasDescendant(oldValues, path)) || (!hasNew && hasDescendant(newValues, path)) {
+			continue
+		}
+
+		change := ConfigChange{Path: path, Old: oldValue, New: newValue}
+		if secret {
+			change.New = maskedSecret
+			if hadOld {
+				change.Old = maskedSecret
+			}
+		}
+		changes = append(changes, change)
+	}
+
+	sort.Slice(changes, func(a, b int) bool { return changes[a].Path < changes[b].Path })
+	return changes, nil
+}
+
+// resolvePlaceholder returns the secret a "!secret:NAME" string is
+// replaced with
+func (i *Importer) resolvePlaceholder(placeholder string) (interface{}, error) {
+	encoded, err := json.Marshal(placeholder)
+	if err != nil {
+		return nil, err
+	}
+	injected, err := InjectSecrets(encoded, i.config.Secrets)
+	if err != nil {
+		return nil, fmt.Errorf("failed to inject secrets: %w", err)
+	}
+	var value interface{}
+	if err := json.Unmarshal(injected, &value); err != nil {
+		return nil, fmt.Errorf("failed to inject secrets: %w", err)
+	}
+	return value, nil
+}
+
+// hasDescendant reports whether values has entries below path
+func hasDescendant(values map[string]interface{}, path string) bool {
+	for key := range values {
+		if strings.HasPrefix(key, path+".") || strings.HasPrefix(key, path+"[") {
+			return true
+		}
+	}
+	return false
+}
+
+// flattenJSON records the leaf values of a decoded JSON document by path.
+// Empty objects and arrays are leaves so adding or removing them shows.
+func flattenJSON(value interface{}, prefix string, out map[string]interface{}) {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		if len(v) == 0 && prefix != "" {
+			out[prefix] = v
+		}
+		for key, child := range v {
+			path := key
+			if prefix != "" {
+				path = prefix + "." + key
+			}
+			flattenJSON(child, path, out)
+		}
+	case []interface{}:
+		if len(v) == 0 {
+			out[prefix] = v
+		}
+		for index, child := range v {
+			flattenJSON(child, prefix+"["+strconv.Itoa(index)+"]", out)
+		}
+	case nil:
+		if prefix != "" {
+			out[prefix] = nil
+		}
+	default:
+		out[prefix] = v
+	}
+}
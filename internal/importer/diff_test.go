@@ -0,0 +1,51 @@
+package importer
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestImporter_DiffConfig(t *testing.T) {
+	t.Setenv("SBOX_TEST_PSK", "local-psk")
+	importer := newTestImporter(t)
+	importer.config.Secrets = map[string]string{"psk": "!env:SBOX_TEST_PSK", "other": "!env:SBOX_TEST_PSK"}
+	path := filepath.Join(t.TempDir(), "config.json")
+
+	imported := &ImportedConfig{Config: []byte(`{"log":{"level":"info"},` +
+		`"outbounds":[{"type":"vless","server":"b.example.com","psk":"!secret:psk"}]}`)}
+
+	// Everything is added to a missing config
+	changes, err := importer.DiffConfig(imported, path)
+	require.NoError(t, err)
+	assert.Equal(t, []ConfigChange{
+		{Path: "log.level", New: "info"},
+		{Path: "outbounds[0].psk", New: maskedSecret},
+		{Path: "outbounds[0].server", New: "b.example.com"},
+		{Path: "outbounds[0].type", New: "vless"},
+	}, changes)
+
+	// An unchanged secret is no change
+	require.NoError(t, os.WriteFile(path, []byte(`{"outbounds":[{"type":"vless",`+
+		`"server":"a.example.com","psk":"local-psk","tag":"proxy"}]}`), 0640))
+	changes, err = importer.DiffConfig(imported, path)
+	require.NoError(t, err)
+	assert.Equal(t, []ConfigChange{
+		{Path: "log.level", New: "info"},
+		{Path: "outbounds[0].server", Old: "a.example.com", New: "b.example.com"},
+		{Path: "outbounds[0].tag", Old: "proxy"},
+	}, changes)
+
+	// A changed secret is masked on both sides
+	require.NoError(t, os.WriteFile(path, []byte(`{"log":{"level":"info"},`+
+		`"outbounds":[{"type":"vless","server":"b.example.com","psk":"old-psk"}]}`), 0640))
+	changes, err = importer.DiffConfig(imported, path)
+	require.NoError(t, err)
+	assert.Equal(t, []ConfigChange{{Path: "outbounds[0].psk", Old: maskedSecret, New: maskedSecret}}, changes)
+
+	_, err = importer.DiffConfig(&ImportedConfig{Config: []byte(`{"psk":"!secret:missing"}`)}, path)
+	assert.ErrorContains(t, err, `unknown secret "missing"`)
+}
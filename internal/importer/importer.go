@@ -0,0 +1,218 @@
+// Package importer imports VPN client configurations generated by sboxmgr and
+// verifies them before they are written for a client.
+package importer
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/kpblcaoo/sboxagent/internal/config"
+	"github.com/kpblcaoo/sboxagent/internal/logger"
+	"github.com/kpblcaoo/sboxagent/internal/process"
+)
+
+// checksumAlgorithm prefixes checksums in ConfigMetadata
+const checksumAlgorithm = "sha256"
+
+// ConfigMetadata describes an imported configuration
+type ConfigMetadata struct {
+	ClientType  string    `json:"client_type"`
+	Version     string    `json:"version,omitempty"`
+	Source      string    `json:"source,omitempty"`
+	GeneratedAt time.Time `json:"generated_at"`
+	// Checksum is "sha256:<hex>" of the compacted Config payload
+	Checksum string `json:"checksum"`
+}
+
+// ValidationInfo records the result of verifying an imported configuration
+type ValidationInfo struct {
+	Valid            bool      `json:"valid"`
+	ChecksumVerified bool      `json:"checksum_verified"`
+	Errors           []string  `json:"errors,omitempty"`
+	ValidatedAt      time.Time `json:"validated_at"`
+}
+
+// ImportedConfig is a client configuration produced by sboxmgr
+type ImportedConfig struct {
+	Config     json.RawMessage `json:"config"`
+	Metadata   ConfigMetadata  `json:"metadata"`
+	Validation ValidationInfo  `json:"validation"`
+}
+
+// ImportRequest selects what sboxmgr generates
+type ImportRequest struct {
+	SubscriptionURL string
+	ClientType      string
+	Options         map[string]string
+	// Vars are the client's template variables, passed to sboxmgr for the
+	// templates of the exported config
+	Vars map[string]string
+	// Timeout bounds each sboxmgr attempt; zero uses the import timeout
+	Timeout time.Duration
+}
+
+// Importer runs sboxmgr, verifies the configurations it produces and saves
+// them for clients
+type Importer struct {
+	config config.ImportConfig
+	logger *logger.Logger
+
+	// Environment and working directory for sboxmgr; nil inherits the
+	// agent environment and empty its working directory
+	mu  sync.RWMutex
+	env []string
+	dir string
+	// credential is the user sboxmgr runs as; nil keeps the agent's
+	credential *process.Credential
+	// limits bound the resources of each sboxmgr run
+	limits *process.Limits
+
+	// pool bounds concurrent sboxmgr runs along with other agent commands
+	pool *process.Pool
+	// history records each sboxmgr run
+	history *process.History
+
+	queries queryCache
+
+	// session runs sboxmgr in one long-lived process when enabled
+	session *session
+
+	// Version and flags of sboxmgr, set by Probe
+	version Version
+	args    argSet
+	probed  bool
+}
+
+// NewImporter creates a new importer
+func NewImporter(cfg config.ImportConfig, log *logger.Logger) *Importer {
+	i := &Importer{
+		config: cfg,
+		logger: log,
+	}
+	if cfg.Session.Enabled {
+		i.session = newSession(cfg.Session, log, i)
+	}
+	return i
+}
+
+// Close stops the sboxmgr session, if any
+func (i *Importer) Close() {
+	if i.session != nil {
+		i.session.close()
+	}
+}
+
+// SetEnv sets the environment sboxmgr runs with, as KEY=value entries
+func (i *Importer) SetEnv(env []string) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	i.env = env
+}
+
+// SetDir sets the working directory sboxmgr runs in
+func (i *Importer) SetDir(dir string) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	i.dir = dir
+}
+
+// SetCredential sets the user and group sboxmgr runs as
+func (i *Importer) SetCredential(cred *process.Credential) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	i.credential = cred
+}
+
+// SetLimits sets the resource limits of sboxmgr runs
+func (i *Importer) SetLimits(limits *process.Limits) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	i.limits = limits
+}
+
+// SetPool sets the pool sboxmgr runs take a slot from
+func (i *Importer) SetPool(pool *process.Pool) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	i.pool = pool
+}
+
+// SetHistory sets the history sboxmgr runs are recorded in
+func (i *Importer) SetHistory(history *process.History) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	i.history = history
+}
+
+// Import parses sboxmgr output and verifies it. The returned config carries
+// the verification result even when an error is returned.
+func (i *Importer) Import(data []byte) (*ImportedConfig, error) {
+	var imported ImportedConfig
+	if err := json.Unmarshal(data, &imported); err != nil {
+		return nil, fmt.Errorf("failed to parse imported config: %w", err)
+	}
+	if len(imported.Config) == 0 {
+		return nil, fmt.Errorf("imported config has no config payload")
+	}
+
+	if err := i.Verify(&imported); err != nil {
+		return &imported, err
+	}
+	return &imported, nil
+}
+
+// Verify checks the payload against the metadata checksum and records the
+// result in the config's ValidationInfo
+func (i *Importer) Verify(imported *ImportedConfig) error {
+	imported.Validation = ValidationInfo{ValidatedAt: time.Now()}
+
+	if err := verifyChecksum(imported.Config, imported.Metadata.Checksum); err != nil {
+		imported.Validation.Errors = append(imported.Validation.Errors, err.Error())
+		i.logger.Warn("Imported config failed verification", map[string]interface{}{
+			"client": imported.Metadata.ClientType,
+			"error":  err.Error(),
+		})
+		return err
+	}
+
+	imported.Validation.ChecksumVerified = true
+	imported.Validation.Valid = true
+	return nil
+}
+
+// Checksum returns the checksum of a config payload in ConfigMetadata format.
+// The payload is compacted first so formatting does not affect it.
+func Checksum(config []byte) (string, error) {
+	var compact bytes.Buffer
+	if err := json.Compact(&compact, config); err != nil {
+		return "", fmt.Errorf("invalid config payload: %w", err)
+	}
+	sum := sha256.Sum256(compact.Bytes())
+	return checksumAlgorithm + ":" + hex.EncodeToString(sum[:]), nil
+}
+
+// verifyChecksum compares the payload checksum with the expected one
+func verifyChecksum(config []byte, expected string) error {
+	if expected == "" {
+		return fmt.Errorf("imported config has no checksum")
+	}
+	algorithm, _, ok := strings.Cut(expected, ":")
+	if !ok || algorithm != checksumAlgorithm {
+		return fmt.Errorf("unsupported checksum %q: expected %s:<hex>", expected, checksumAlgorithm)
+	}
+
+	actual, err := Checksum(config)
+	if err != nil {
+		return err
+	}
+	if !strings.EqualFold(actual, expected) {
+		return fmt.Errorf("checksum mismatch: expected %s, got %s", expected, actual)
+	}
+	return nil
+}
@@ -0,0 +1,96 @@
+package importer
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/kpblcaoo/sboxagent/internal/config"
+	"github.com/kpblcaoo/sboxagent/internal/logger"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestImporter(t *testing.T) *Importer {
+	log, err := logger.New("error")
+	require.NoError(t, err)
+	return NewImporter(config.ImportConfig{Timeout: 5 * time.Second}, log)
+}
+
+func importedJSON(t *testing.T, payload, checksum string) []byte {
+	data, err := json.Marshal(map[string]interface{}{
+		"config": json.RawMessage(payload),
+		"metadata": map[string]interface{}{
+			"client_type": "sing-box",
+			"checksum":    checksum,
+		},
+	})
+	require.NoError(t, err)
+	return data
+}
+
+func TestChecksum_IgnoresFormatting(t *testing.T) {
+	a, err := Checksum([]byte(`{"log": {"level": "info"}}`))
+	require.NoError(t, err)
+	b, err := Checksum([]byte("{\n  \"log\": {\"level\":\"info\"}\n}"))
+	require.NoError(t, err)
+	assert.Equal(t, a, b)
+	assert.Contains(t, a, "sha256:")
+
+	_, err = Checksum([]byte(`{"log":`))
+	assert.Error(t, err)
+}
+
+func TestImporter_Import(t *testing.T) {
+	importer := newTestImporter(t)
+	payload := `{"outbounds":[{"type":"direct"}]}`
+	checksum, err := Checksum([]byte(payload))
+	require.NoError(t, err)
+
+	imported, err := importer.Import(importedJSON(t, payload, checksum))
+	require.NoError(t, err)
+	assert.Equal(t, "sing-box", imported.Metadata.ClientType)
+	assert.True(t, imported.Validation.Valid)
+	assert.True(t, imported.Validation.ChecksumVerified)
+	assert.Empty(t, imported.Validation.Errors)
+	assert.False(t, imported.Validation.ValidatedAt.IsZero())
+}
+
+func TestImporter_ImportRejectsBadChecksum(t *testing.T) {
+	importer := newTestImporter(t)
+	payload := `{"outbounds":[{"type":"direct"}]}`
+	other, err := Checksum([]byte(`{"outbounds":[]}`))
+	require.NoError(t, err)
+
+	tests := []struct {
+		name     string
+		checksum string
+		err      string
+	}{
+		{"mismatch", other, "checksum mismatch"},
+		{"missing", "", "has no checksum"},
+		{"unsupported algorithm", "md5:abc", "unsupported checksum"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			imported, err := importer.Import(importedJSON(t, payload, tt.checksum))
+			require.Error(t, err)
+			assert.Contains(t, err.Error(), tt.err)
+			require.NotNil(t, imported)
+			assert.False(t, imported.Validation.Valid)
+			assert.False(t, imported.Validation.ChecksumVerified)
+			assert.Len(t, imported.Validation.Errors, 1)
+		})
+	}
+}
+
+func TestImporter_ImportRejectsInvalidDocument(t *testing.T) {
+	importer := newTestImporter(t)
+
+	_, err := importer.Import([]byte(`not json`))
+	assert.ErrorContains(t, err, "failed to parse")
+
+	_, err = importer.Import([]byte(`{"metadata":{"client_type":"xray"}}`))
+	assert.ErrorContains(t, err, "no config payload")
+}
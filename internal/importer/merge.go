@@ -0,0 +1,171 @@
+package importer
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/kpblcaoo/sboxagent/internal/config"
+)
+
+// serverList locates the servers in a client config: the top-level list
+// holding them and the field naming each server
+type serverList struct {
+	key  string
+	name string
+}
+
+// serverLists lists the client types whose configs can be merged
+var serverLists = map[string]serverList{
+	"sing-box": {key: "outbounds", name: "tag"},
+	"xray":     {key: "outbounds", name: "tag"},
+	"clash":    {key: "proxies", name: "name"},
+}
+
+// CanMerge reports whether configs of a client type can be merged from
+// several sources
+func CanMerge(clientType string) bool {
+	_, ok := serverLists[clientType]
+	return ok
+}
+
+// ImportSources imports every source with sboxmgr and merges their servers
+// into one config. Sources are merged by descending priority: settings other
+// than servers come from the highest priority source, and a server name
+// defined by several sources keeps the higher priority definition. Sources
+// that fail are skipped; the import fails only if all of them do. Each
+// source is imported with req and the source URL.
+func (i *Importer) ImportSources(ctx context.Context, req ImportRequest, sources []config.ImportSource) (*ImportedConfig, error) {
+	clientType := req.ClientType
+	list, ok := serverLists[clientType]
+	if !ok {
+		return nil, fmt.Errorf("merging sources is not supported for %s", clientType)
+	}
+
+	ordered := append([]config.ImportSource{}, sources...)
+	sort.SliceStable(ordered, func(a, b int) bool {
+		return ordered[a].Priority > ordered[b].Priority
+	})
+
+	var (
+		base    map[string]json.RawMessage
+		servers []json.RawMessage
+		seen    = make(map[string]bool)
+		merged  []string
+	)
+	for _, source := range ordered {
+		req.SubscriptionURL = source.URL
+		imported, err := i.ImportFromSboxmgr(ctx, req)
+		if err != nil {
+			i.logger.Warn("Skipping import source", map[string]interface{}{
+				"source": source.Name,
+				"error":  err.Error(),
+			})
+			continue
+		}
+
+		var doc map[string]json.RawMessage
+		if err := json.Unmarshal(imported.Config, &doc); err != nil {
+			i.logger.Warn("Skipping import source", map[string]interface{}{
+				"source": source.Name,
+				"error":  fmt.Sprintf("config is not a JSON object: %v", err),
+			})
+			continue
+		}
+		var entries []json.RawMessage
+		if raw, ok := doc[list.key]; ok {
+			if err := json.Unmarshal(raw, &entries); err != nil {
+				i.logger.Warn("Skipping import source", map[string]interface{}{
+					"source": source.Name,
+					"error":  fmt.Sprintf("invalid %s: %v", list.key, err),
+				})
+				continue
+			}
+		}
+
+		if base == nil {
+			base = doc
+		}
+		for _, entry := range entries {
+			name := serverName(entry, list.name)
+			if seen[name] || !keepServer(name, source) {
+				continue
+			}
+			if name != "" {
+				seen[name] = true
+			}
+			servers = append(servers, entry)
+		}
+		merged = append(merged, source.Name)
+	}
+
+	if base == nil {
+		return nil, fmt.Errorf("all %d import sources failed", len(sources))
+	}
+
+	serversJSON, err := json.Marshal(servers)
+	if err != nil {
+		return nil, fmt.Errorf("failed to merge servers: %w", err)
+	}
+	base[list.key] = serversJSON
+	payload, err := json.Marshal(base)
+	if err != nil {
+		return nil, fmt.Errorf("failed to merge configs: %w", err)
+	}
+	checksum, err := Checksum(payload)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &ImportedConfig{
+		Config: payload,
+		Metadata: ConfigMetadata{
+			ClientType:  clientType,
+			Source:      strings.Join(merged, ","),
+			GeneratedAt: time.Now(),
+			Checksum:    checksum,
+		},
+	}
+	if err := i.Verify(result); err != nil {
+		return result, err
+	}
+	i.logger.Info("Merged import sources", map[string]interface{}{
+		"client":  clientType,
+		"sources": merged,
+		"servers": len(servers),
+	})
+	return result, nil
+}
+
+// serverName returns the name field of a server entry, or "" if it has none
+func serverName(entry json.RawMessage, field string) string {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(entry, &fields); err != nil {
+		return ""
+	}
+	var name string
+	json.Unmarshal(fields[field], &name)
+	return name
+}
+
+// keepServer applies a source's include and exclude filters to a server name
+func keepServer(name string, source config.ImportSource) bool {
+	if len(source.Include) > 0 && !matchAny(source.Include, name) {
+		return false
+	}
+	return !matchAny(source.Exclude, name)
+}
+
+// matchAny reports whether name matches one of the glob patterns
+func matchAny(patterns []string, name string) bool {
+	for _, pattern := range patterns {
+		if ok, _ := path.Match(pattern, name); ok {
+			return true
+		}
+	}
+	return false
+}
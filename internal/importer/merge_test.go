@@ -0,0 +1,71 @@
+package importer
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/kpblcaoo/sboxagent/internal/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeSources writes sboxmgr output per subscription and a script that
+// prints the output named by its --url argument
+func fakeSources(t *testing.T, payloads map[string]string) []string {
+	dir := t.TempDir()
+	for name, payload := range payloads {
+		checksum, err := Checksum([]byte(payload))
+		require.NoError(t, err)
+		require.NoError(t, os.WriteFile(filepath.Join(dir, name+".json"), importedJSON(t, payload, checksum), 0644))
+	}
+	script := filepath.Join(dir, "sboxmgr")
+	require.NoError(t, os.WriteFile(script, []byte("#!/bin/sh\ncat "+dir+"/$2.json\n"), 0755))
+	return []string{script}
+}
+
+func TestImporter_ImportSources(t *testing.T) {
+	command := fakeSources(t, map[string]string{
+		"main": `{"log":{"level":"warn"},"outbounds":[{"tag":"de-1","server":"main"},{"tag":"us-1","server":"main"}]}`,
+		"backup": `{"log":{"level":"debug"},"outbounds":[{"tag":"de-1","server":"backup"},{"tag":"nl-1","server":"backup"},` +
+			`{"tag":"ru-1","server":"backup"}]}`,
+	})
+	importer := newSboxmgrImporter(t, command)
+
+	imported, err := importer.ImportSources(context.Background(), ImportRequest{ClientType: "sing-box"}, []config.ImportSource{
+		{Name: "backup", URL: "backup", Priority: 1, Exclude: []string{"ru-*"}},
+		{Name: "main", URL: "main", Priority: 10, Include: []string{"de-*", "us-*"}},
+		{Name: "broken", URL: "missing", Priority: 5},
+	})
+	require.NoError(t, err)
+	assert.True(t, imported.Validation.Valid)
+	assert.Equal(t, "main,backup", imported.Metadata.Source)
+
+	var doc struct {
+		Log       map[string]string   `json:"log"`
+		Outbounds []map[string]string `json:"outbounds"`
+	}
+	require.NoError(t, json.Unmarshal(imported.Config, &doc))
+	assert.Equal(t, "warn", doc.Log["level"])
+	assert.Equal(t, []map[string]string{
+		{"tag": "de-1", "server": "main"},
+		{"tag": "us-1", "server": "main"},
+		{"tag": "nl-1", "server": "backup"},
+	}, doc.Outbounds)
+}
+
+func TestImporter_ImportSourcesFailures(t *testing.T) {
+	importer := newSboxmgrImporter(t, fakeSources(t, nil))
+
+	_, err := importer.ImportSources(context.Background(), ImportRequest{ClientType: "sing-box"}, []config.ImportSource{
+		{Name: "a", URL: "a"},
+		{Name: "b", URL: "b"},
+	})
+	assert.ErrorContains(t, err, "all 2 import sources failed")
+
+	_, err = importer.ImportSources(context.Background(), ImportRequest{ClientType: "hysteria"}, []config.ImportSource{{Name: "a", URL: "a"}})
+	assert.ErrorContains(t, err, "not supported for hysteria")
+	assert.False(t, CanMerge("hysteria"))
+}
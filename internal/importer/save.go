@@ -0,0 +1,87 @@
+package importer
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// backupTimeFormat names client config backups
+const backupTimeFormat = "20060102-150405"
+
+// SaveImportedConfig writes a verified config payload to path with secret
+// placeholders filled in. An existing file is kept as a timestamped .bak
+// next to it, whose path is returned; backups beyond the retention policy
+// are pruned.
+func (i *Importer) SaveImportedConfig(imported *ImportedConfig, path string) (string, error) {
+	if !imported.Validation.Valid {
+		return "", fmt.Errorf("refusing to save unverified config for %s", imported.Metadata.ClientType)
+	}
+	data, err := InjectSecrets(imported.Config, i.config.Secrets)
+	if err != nil {
+		return "", fmt.Errorf("failed to inject secrets: %w", err)
+	}
+	backup, err := writeClientConfig(path, data)
+	if err != nil {
+		return "", err
+	}
+
+	removed, err := PruneBackups(path, i.config.Backups, time.Now())
+	if err != nil {
+		i.logger.Warn("Failed to prune config backups", map[string]interface{}{
+			"path":  path,
+			"error": err.Error(),
+		})
+	}
+	if len(removed) > 0 {
+		i.logger.Debug("Pruned config backups", map[string]interface{}{
+			"path":    path,
+			"removed": len(removed),
+		})
+	}
+	return backup, nil
+}
+
+// writeClientConfig atomically replaces path with data, backing up the
+// previous file first
+func writeClientConfig(path string, data []byte) (string, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return "", fmt.Errorf("failed to create config directory: %w", err)
+	}
+
+	mode := os.FileMode(0640)
+	backup := ""
+	if info, err := os.Stat(path); err == nil {
+		mode = info.Mode().Perm()
+		backup = fmt.Sprintf("%s.%s%s", path, time.Now().Format(backupTimeFormat), backupSuffix)
+		previous, err := os.ReadFile(path)
+		if err != nil {
+			return "", fmt.Errorf("failed to read current config: %w", err)
+		}
+		if err := os.WriteFile(backup, previous, mode); err != nil {
+			return "", fmt.Errorf("failed to back up current config: %w", err)
+		}
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".tmp*")
+	if err != nil {
+		return "", fmt.Errorf("failed to write config: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return "", fmt.Errorf("failed to write config: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return "", fmt.Errorf("failed to write config: %w", err)
+	}
+	if err := os.Chmod(tmp.Name(), mode); err != nil {
+		return "", fmt.Errorf("failed to write config: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return "", fmt.Errorf("failed to write config: %w", err)
+	}
+	return backup, nil
+}
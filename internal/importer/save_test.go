@@ -0,0 +1,72 @@
+package importer
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/kpblcaoo/sboxagent/internal/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestImporter_SaveImportedConfig(t *testing.T) {
+	importer := newTestImporter(t)
+	path := filepath.Join(t.TempDir(), "sing-box", "config.json")
+	imported := &ImportedConfig{
+		Config:     []byte(`{"outbounds":[]}`),
+		Validation: ValidationInfo{Valid: true},
+	}
+
+	backup, err := importer.SaveImportedConfig(imported, path)
+	require.NoError(t, err)
+	assert.Empty(t, backup)
+
+	info, err := os.Stat(path)
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0640), info.Mode().Perm())
+
+	imported.Config = []byte(`{"outbounds":[{"type":"direct"}]}`)
+	backup, err = importer.SaveImportedConfig(imported, path)
+	require.NoError(t, err)
+	assert.Regexp(t, `config\.json\.\d{8}-\d{6}\.bak$`, backup)
+
+	previous, err := os.ReadFile(backup)
+	require.NoError(t, err)
+	assert.Equal(t, `{"outbounds":[]}`, string(previous))
+	current, err := os.ReadFile(path)
+	require.NoError(t, err)
+	assert.Equal(t, `{"outbounds":[{"type":"direct"}]}`, string(current))
+}
+
+func TestImporter_SaveImportedConfigRejectsUnverified(t *testing.T) {
+	importer := newTestImporter(t)
+	path := filepath.Join(t.TempDir(), "config.json")
+
+	_, err := importer.SaveImportedConfig(&ImportedConfig{Config: []byte(`{}`)}, path)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "refusing to save unverified config")
+	assert.NoFileExists(t, path)
+}
+
+func TestImporter_SaveImportedConfigPrunesBackups(t *testing.T) {
+	importer := newTestImporter(t)
+	importer.config.Backups = config.BackupConfig{MaxCount: 1}
+	path := filepath.Join(t.TempDir(), "config.json")
+	require.NoError(t, os.WriteFile(path, []byte(`{}`), 0640))
+	old := path + "." + time.Now().Add(-time.Hour).Format(backupTimeFormat) + backupSuffix
+	require.NoError(t, os.WriteFile(old, []byte(`{}`), 0640))
+
+	backup, err := importer.SaveImportedConfig(&ImportedConfig{
+		Config:     []byte(`{"outbounds":[]}`),
+		Validation: ValidationInfo{Valid: true},
+	}, path)
+	require.NoError(t, err)
+
+	backups, err := ListBackups(path)
+	require.NoError(t, err)
+	require.Len(t, backups, 1)
+	assert.Equal(t, backup, backups[0].Path)
+	assert.NoFileExists(t, old)
+}
@@ -0,0 +1,322 @@
+package importer
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"os/exec"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/kpblcaoo/sboxagent/internal/process"
+)
+
+// ImportFromSboxmgr runs sboxmgr for the request and returns the verified
+// configuration it generated
+func (i *Importer) ImportFromSboxmgr(ctx context.Context, req ImportRequest) (*ImportedConfig, error) {
+	output, err := i.executeSboxmgr(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+
+	imported, err := i.Import(output)
+	if err != nil {
+		return imported, err
+	}
+	if err := validateClientType(imported, req.ClientType); err != nil {
+		imported.Validation.Valid = false
+		imported.Validation.Errors = append(imported.Validation.Errors, err.Error())
+		return imported, err
+	}
+	return imported, nil
+}
+
+// maxStderr bounds the sboxmgr stderr kept for error reports
+const maxStderr = 4096
+
+// SboxmgrError describes a failed sboxmgr run after all attempts
+type SboxmgrError struct {
+	Command  []string `json:"command"`
+	Attempts int      `json:"attempts"`
+	// ExitCode is the exit status of the last attempt, or -1 if it did not
+	// exit normally
+	ExitCode int    `json:"exitCode"`
+	TimedOut bool   `json:"timedOut"`
+	Stderr   string `json:"stderr,omitempty"`
+	// Transient reports whether the last failure was of a kind worth
+	// retrying, such as a timeout or network error
+	Transient bool  `json:"transient"`
+	Err       error `json:"-"`
+
+	// started reports whether the command ran at all
+	started bool
+}
+
+// Error summarizes the failure with the last line sboxmgr wrote to stderr
+func (e *SboxmgrError) Error() string {
+	var msg string
+	switch {
+	case e.TimedOut:
+		msg = fmt.Sprintf("sboxmgr timed out after %d attempt(s)", e.Attempts)
+	case e.ExitCode >= 0:
+		msg = fmt.Sprintf("sboxmgr exited with code %d after %d attempt(s)", e.ExitCode, e.Attempts)
+	default:
+		msg = fmt.Sprintf("sboxmgr failed after %d attempt(s): %v", e.Attempts, e.Err)
+	}
+	if line := lastLine(e.Stderr); line != "" {
+		msg += ": " + line
+	}
+	return msg
+}
+
+// Unwrap returns the error of the last attempt
+func (e *SboxmgrError) Unwrap() error {
+	return e.Err
+}
+
+// executeSboxmgr runs the sboxmgr command and returns its stdout. Transient
+// failures are retried as configured unless ctx is done; permanent ones fail
+// right away.
+func (i *Importer) executeSboxmgr(ctx context.Context, req ImportRequest) ([]byte, error) {
+	args := sboxmgrArgs(i.config.Command, i.argSet(), req)
+	i.logger.Debug("Executing sboxmgr", map[string]interface{}{
+		"command": args,
+	})
+
+	for attempt := 1; ; attempt++ {
+		output, failure := i.runSboxmgr(ctx, args, i.timeout(req))
+		if failure == nil {
+			return output, nil
+		}
+		failure.Attempts = attempt
+		failure.Transient = i.transient(failure)
+		if !failure.Transient || attempt > i.config.Retries || ctx.Err() != nil {
+			return nil, failure
+		}
+
+		delay := i.retryDelay(attempt)
+		i.logger.Warn("Sboxmgr run failed, retrying", map[string]interface{}{
+			"attempt": attempt,
+			"error":   failure.Error(),
+			"delay":   delay.String(),
+		})
+		select {
+		case <-ctx.Done():
+			return nil, failure
+		case <-time.After(delay):
+		}
+	}
+}
+
+// retryDelay returns the wait before the retry following attempt: the retry
+// delay doubled per previous retry and capped at the maximum, of which a
+// random half is dropped so agents do not retry in lockstep during an outage
+func (i *Importer) retryDelay(attempt int) time.Duration {
+	delay := i.config.RetryDelay
+	for n := 1; n < attempt && (i.config.MaxRetryDelay <= 0 || delay < i.config.MaxRetryDelay); n++ {
+		delay *= 2
+	}
+	if i.config.MaxRetryDelay > 0 && delay > i.config.MaxRetryDelay {
+		delay = i.config.MaxRetryDelay
+	}
+	if delay <= 1 {
+		return delay
+	}
+	half := delay / 2
+	return half + time.Duration(rand.Int64N(int64(delay-half)))
+}
+
+// Exit codes of permanent failures: usage errors (2, EX_USAGE), bad input
+// (EX_DATAERR), missing permissions (EX_NOPERM), configuration errors
+// (EX_CONFIG) and a command that cannot be executed (126, 127)
+var permanentExitCodes = map[int]bool{2: true, 64: true, 65: true, 77: true, 78: true, 126: true, 127: true}
+
+// Exit codes of transient failures: service unavailable (EX_UNAVAILABLE),
+// I/O errors (EX_IOERR) and temporary failures (EX_TEMPFAIL)
+var transientExitCodes = map[int]bool{69: true, 74: true, 75: true}
+
+// networkErrorMarkers identify network failures in stderr of runs that
+// exited with a generic code
+var networkErrorMarkers = []string{
+	"timed out", "timeout", "connection refused", "connection reset",
+	"unreachable", "no route to host", "temporary failure",
+	"name resolution", "no such host", "tls handshake", "eof",
+}
+
+// transient reports whether a failed sboxmgr run may succeed on retry. A
+// command that cannot start will not start on retry either, and generic
+// exit codes are retried only when stderr points at the network.
+func (i *Importer) transient(failure *SboxmgrError) bool {
+	switch {
+	case !failure.started:
+		return false
+	case failure.TimedOut:
+		return true
+	case failure.ExitCode < 0:
+		// Killed by a signal, e.g. the OOM killer
+		return true
+	case permanentExitCodes[failure.ExitCode]:
+		return false
+	case transientExitCodes[failure.ExitCode]:
+		return true
+	}
+	for _, code := range i.config.RetryExitCodes {
+		if code == failure.ExitCode {
+			return true
+		}
+	}
+
+	stderr := strings.ToLower(failure.Stderr)
+	for _, marker := range networkErrorMarkers {
+		if strings.Contains(stderr, marker) {
+			return true
+		}
+	}
+	return false
+}
+
+// timeout returns the timeout of a sboxmgr attempt for a request
+func (i *Importer) timeout(req ImportRequest) time.Duration {
+	if req.Timeout > 0 {
+		return req.Timeout
+	}
+	return i.config.Timeout
+}
+
+// runSboxmgr runs a single sboxmgr attempt bounded by timeout. Waiting for
+// a pool slot does not count against the timeout.
+func (i *Importer) runSboxmgr(ctx context.Context, args []string, timeout time.Duration) ([]byte, *SboxmgrError) {
+	i.mu.RLock()
+	env, dir, credential, limits, pool, history := i.env, i.dir, i.credential, i.limits, i.pool, i.history
+	i.mu.RUnlock()
+
+	release, err := pool.Acquire(ctx)
+	if err != nil {
+		return nil, &SboxmgrError{Command: args, ExitCode: -1, Err: err}
+	}
+	defer release()
+
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	if i.session != nil {
+		return i.runSession(ctx, args, history)
+	}
+
+	cmd := exec.CommandContext(ctx, args[0], args[1:]...)
+	cmd.Env = env
+	cmd.Dir = dir
+	process.Prepare(cmd)
+	if err := process.SetCredential(cmd, credential); err != nil {
+		return nil, &SboxmgrError{Command: args, ExitCode: -1, Err: err}
+	}
+
+	var stdout bytes.Buffer
+	stderr := &tailBuffer{max: maxStderr}
+	cmd.Stdout = &stdout
+	cmd.Stderr = stderr
+
+	started := time.Now()
+	if err := process.StartLimited(cmd, limits); err != nil {
+		err = fmt.Errorf("failed to start sboxmgr: %w", err)
+		history.Add(process.NewRun("sboxmgr", args, started, 0, err))
+		return nil, &SboxmgrError{
+			Command:  args,
+			ExitCode: -1,
+			Err:      err,
+		}
+	}
+	err = process.Wait(cmd)
+	history.Add(process.NewRun("sboxmgr", args, started, int64(stdout.Len()), runError(err, stderr.String())))
+	if err != nil {
+		failure := &SboxmgrError{
+			Command:  args,
+			ExitCode: -1,
+			TimedOut: errors.Is(ctx.Err(), context.DeadlineExceeded),
+			Stderr:   stderr.String(),
+			Err:      err,
+			started:  true,
+		}
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) && exitErr.Exited() {
+			failure.ExitCode = exitErr.ExitCode()
+		}
+		return nil, failure
+	}
+	return stdout.Bytes(), nil
+}
+
+// sboxmgrArgs appends the subscription, client type, options and template
+// variables to the configured command using the flags of the sboxmgr
+// release. Options and variables are sorted so the command line is stable.
+func sboxmgrArgs(command []string, flags argSet, req ImportRequest) []string {
+	args := append([]string{}, command...)
+	args = append(args, flags.url, req.SubscriptionURL, flags.client, req.ClientType)
+
+	keys := make([]string, 0, len(req.Options))
+	for key := range req.Options {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		args = append(args, fmt.Sprintf("--%s=%s", key, req.Options[key]))
+	}
+
+	names := make([]string, 0, len(req.Vars))
+	for name := range req.Vars {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		args = append(args, flags.vars, name+"="+req.Vars[name])
+	}
+	return args
+}
+
+// validateClientType rejects configs generated for a different client
+func validateClientType(imported *ImportedConfig, clientType string) error {
+	if imported.Metadata.ClientType != "" && imported.Metadata.ClientType != clientType {
+		return fmt.Errorf("imported config is for %s, expected %s", imported.Metadata.ClientType, clientType)
+	}
+	return nil
+}
+
+// runError summarizes a failed run with the last line of its stderr
+func runError(err error, stderr string) error {
+	if err == nil {
+		return nil
+	}
+	if line := lastLine(stderr); line != "" {
+		return fmt.Errorf("%w: %s", err, line)
+	}
+	return err
+}
+
+// tailBuffer keeps the last max bytes written to it
+type tailBuffer struct {
+	max  int
+	data []byte
+}
+
+// Write appends p, dropping the oldest bytes beyond the limit
+func (b *tailBuffer) Write(p []byte) (int, error) {
+	b.data = append(b.data, p...)
+	if len(b.data) > b.max {
+		b.data = b.data[len(b.data)-b.max:]
+	}
+	return len(p), nil
+}
+
+// String returns the kept output
+func (b *tailBuffer) String() string {
+	return string(b.data)
+}
+
+// lastLine returns the last non-empty line of output
+func lastLine(output string) string {
+	lines := strings.Split(strings.TrimSpace(output), "\n")
+	return strings.TrimSpace(lines[len(lines)-1])
+}
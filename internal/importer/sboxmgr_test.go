@@ -0,0 +1,232 @@
+package importer
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/kpblcaoo/sboxagent/internal/config"
+	"github.com/kpblcaoo/sboxagent/internal/logger"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeSboxmgr writes a script that records its arguments and prints output
+func fakeSboxmgr(t *testing.T, output []byte) (command []string, argsFile string) {
+	dir := t.TempDir()
+	outputFile := filepath.Join(dir, "output.json")
+	argsFile = filepath.Join(dir, "args")
+	require.NoError(t, os.WriteFile(outputFile, output, 0644))
+
+	script := filepath.Join(dir, "sboxmgr")
+	require.NoError(t, os.WriteFile(script, []byte(
+		"#!/bin/sh\necho \"$@\" > "+argsFile+"\ncat "+outputFile+"\n"), 0755))
+	return []string{script, "export"}, argsFile
+}
+
+func newSboxmgrImporter(t *testing.T, command []string) *Importer {
+	log, err := logger.New("error")
+	require.NoError(t, err)
+	return NewImporter(config.ImportConfig{Command: command, Timeout: 5 * time.Second}, log)
+}
+
+func TestImporter_ImportFromSboxmgr(t *testing.T) {
+	payload := `{"outbounds":[{"type":"direct"}]}`
+	checksum, err := Checksum([]byte(payload))
+	require.NoError(t, err)
+	command, argsFile := fakeSboxmgr(t, importedJSON(t, payload, checksum))
+
+	imported, err := newSboxmgrImporter(t, command).ImportFromSboxmgr(context.Background(), ImportRequest{
+		SubscriptionURL: "https://sub.example.com/list",
+		ClientType:      "sing-box",
+		Options:         map[string]string{"tag": "home", "exclude": "ru"},
+		Vars:            map[string]string{"log_level": "warn", "dns": "1.1.1.1"},
+	})
+	require.NoError(t, err)
+	assert.True(t, imported.Validation.Valid)
+	assert.JSONEq(t, payload, string(imported.Config))
+
+	args, err := os.ReadFile(argsFile)
+	require.NoError(t, err)
+	assert.Equal(t, "export --url https://sub.example.com/list --client sing-box --exclude=ru --tag=home --var dns=1.1.1.1 --var log_level=warn",
+		strings.TrimSpace(string(args)))
+}
+
+func TestImporter_ImportFromSboxmgrRejectsWrongClient(t *testing.T) {
+	payload := `{"outbounds":[]}`
+	checksum, err := Checksum([]byte(payload))
+	require.NoError(t, err)
+	command, _ := fakeSboxmgr(t, importedJSON(t, payload, checksum))
+
+	imported, err := newSboxmgrImporter(t, command).ImportFromSboxmgr(context.Background(), ImportRequest{
+		SubscriptionURL: "https://sub.example.com/list",
+		ClientType:      "xray",
+	})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "imported config is for sing-box, expected xray")
+	assert.False(t, imported.Validation.Valid)
+}
+
+func TestImporter_ImportFromSboxmgrFailure(t *testing.T) {
+	dir := t.TempDir()
+	script := filepath.Join(dir, "sboxmgr")
+	require.NoError(t, os.WriteFile(script, []byte(
+		"#!/bin/sh\necho attempt >> "+filepath.Join(dir, "attempts")+"\necho 'loading subscription' >&2\necho 'error: subscription unreachable' >&2\nexit 3\n"), 0755))
+
+	log, err := logger.New("error")
+	require.NoError(t, err)
+	importer := NewImporter(config.ImportConfig{
+		Command:    []string{script},
+		Timeout:    5 * time.Second,
+		Retries:    2,
+		RetryDelay: time.Millisecond,
+	}, log)
+
+	_, err = importer.ImportFromSboxmgr(context.Background(), ImportRequest{ClientType: "sing-box"})
+	var failure *SboxmgrError
+	require.ErrorAs(t, err, &failure)
+	assert.Equal(t, 3, failure.Attempts)
+	assert.Equal(t, 3, failure.ExitCode)
+	assert.False(t, failure.TimedOut)
+	assert.True(t, failure.Transient)
+	assert.Contains(t, failure.Stderr, "loading subscription")
+	assert.Equal(t, "sboxmgr exited with code 3 after 3 attempt(s): error: subscription unreachable", err.Error())
+
+	attempts, err := os.ReadFile(filepath.Join(dir, "attempts"))
+	require.NoError(t, err)
+	assert.Equal(t, 3, strings.Count(string(attempts), "attempt"))
+}
+
+func TestImporter_ImportFromSboxmgrRetrySucceeds(t *testing.T) {
+	payload := `{"outbounds":[]}`
+	checksum, err := Checksum([]byte(payload))
+	require.NoError(t, err)
+	command, _ := fakeSboxmgr(t, importedJSON(t, payload, checksum))
+
+	// Fail the first run only, with EX_TEMPFAIL
+	marker := filepath.Join(t.TempDir(), "failed")
+	wrapper := filepath.Join(t.TempDir(), "sboxmgr")
+	require.NoError(t, os.WriteFile(wrapper, []byte(
+		"#!/bin/sh\nif [ ! -e "+marker+" ]; then touch "+marker+"; exit 75; fi\nexec "+command[0]+" \"$@\"\n"), 0755))
+
+	log, err := logger.New("error")
+	require.NoError(t, err)
+	importer := NewImporter(config.ImportConfig{Command: []string{wrapper}, Timeout: 5 * time.Second, Retries: 1}, log)
+	imported, err := importer.ImportFromSboxmgr(context.Background(), ImportRequest{ClientType: "sing-box"})
+	require.NoError(t, err)
+	assert.True(t, imported.Validation.Valid)
+}
+
+func TestImporter_ImportFromSboxmgrPermanentFailure(t *testing.T) {
+	dir := t.TempDir()
+	script := filepath.Join(dir, "sboxmgr")
+	require.NoError(t, os.WriteFile(script, []byte(
+		"#!/bin/sh\necho attempt >> "+filepath.Join(dir, "attempts")+"\necho 'usage: sboxmgr export [--url URL]' >&2\nexit 2\n"), 0755))
+
+	log, err := logger.New("error")
+	require.NoError(t, err)
+	importer := NewImporter(config.ImportConfig{
+		Command:    []string{script},
+		Timeout:    5 * time.Second,
+		Retries:    3,
+		RetryDelay: time.Millisecond,
+	}, log)
+
+	_, err = importer.ImportFromSboxmgr(context.Background(), ImportRequest{ClientType: "sing-box"})
+	var failure *SboxmgrError
+	require.ErrorAs(t, err, &failure)
+	assert.Equal(t, 1, failure.Attempts)
+	assert.False(t, failure.Transient)
+
+	attempts, err := os.ReadFile(filepath.Join(dir, "attempts"))
+	require.NoError(t, err)
+	assert.Equal(t, 1, strings.Count(string(attempts), "attempt"))
+}
+
+func TestImporter_RetryDelay(t *testing.T) {
+	importer := NewImporter(config.ImportConfig{RetryDelay: 10 * time.Second, MaxRetryDelay: time.Minute}, nil)
+
+	for attempt, base := range map[int]time.Duration{
+		1: 10 * time.Second,
+		2: 20 * time.Second,
+		3: 40 * time.Second,
+		4: time.Minute,
+		9: time.Minute,
+	} {
+		for n := 0; n < 20; n++ {
+			delay := importer.retryDelay(attempt)
+			assert.GreaterOrEqual(t, delay, base/2, "attempt %d", attempt)
+			assert.Less(t, delay, base, "attempt %d", attempt)
+		}
+	}
+
+	importer.config.RetryDelay = 0
+	assert.Zero(t, importer.retryDelay(3))
+}
+
+func TestImporter_Transient(t *testing.T) {
+	importer := NewImporter(config.ImportConfig{RetryExitCodes: []int{42}}, nil)
+
+	tests := []struct {
+		name    string
+		failure SboxmgrError
+		want    bool
+	}{
+		{"not started", SboxmgrError{ExitCode: -1}, false},
+		{"timeout", SboxmgrError{TimedOut: true, ExitCode: -1, started: true}, true},
+		{"signal", SboxmgrError{ExitCode: -1, started: true}, true},
+		{"not found", SboxmgrError{ExitCode: 127, started: true}, false},
+		{"usage", SboxmgrError{ExitCode: 2, Stderr: "connection refused", started: true}, false},
+		{"tempfail", SboxmgrError{ExitCode: 75, started: true}, true},
+		{"configured", SboxmgrError{ExitCode: 42, started: true}, true},
+		{"network", SboxmgrError{ExitCode: 1, Stderr: "Get https://sub: dial tcp: lookup sub: no such host", started: true}, true},
+		{"invalid subscription", SboxmgrError{ExitCode: 1, Stderr: "error: invalid subscription format", started: true}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, importer.transient(&tt.failure))
+		})
+	}
+}
+
+func TestImporter_ImportFromSboxmgrTimeoutAndStartFailure(t *testing.T) {
+	log, err := logger.New("error")
+	require.NoError(t, err)
+
+	importer := NewImporter(config.ImportConfig{Command: []string{"sh", "-c", "sleep 5"}, Timeout: 50 * time.Millisecond}, log)
+	_, err = importer.ImportFromSboxmgr(context.Background(), ImportRequest{ClientType: "sing-box"})
+	var failure *SboxmgrError
+	require.ErrorAs(t, err, &failure)
+	assert.True(t, failure.TimedOut)
+	assert.Contains(t, err.Error(), "sboxmgr timed out after 1 attempt(s)")
+
+	// A request timeout overrides the import timeout
+	importer = NewImporter(config.ImportConfig{Command: []string{"sh", "-c", "sleep 0.2; echo '{}'"}, Timeout: 50 * time.Millisecond}, log)
+	_, err = importer.ImportFromSboxmgr(context.Background(), ImportRequest{ClientType: "sing-box", Timeout: 5 * time.Second})
+	assert.False(t, errors.As(err, &failure), "request timeout should override the import timeout")
+
+	// A missing executable is not retried
+	importer = NewImporter(config.ImportConfig{Command: []string{"/nonexistent/sboxmgr"}, Timeout: time.Second, Retries: 3}, log)
+	_, err = importer.ImportFromSboxmgr(context.Background(), ImportRequest{ClientType: "sing-box"})
+	require.ErrorAs(t, err, &failure)
+	assert.Equal(t, 1, failure.Attempts)
+	assert.Equal(t, -1, failure.ExitCode)
+	assert.Contains(t, err.Error(), "failed to start sboxmgr")
+}
+
+func TestImporter_SetDirAndEnv(t *testing.T) {
+	dir := t.TempDir()
+	importer := newSboxmgrImporter(t, []string{"sh"})
+	importer.SetDir(dir)
+	importer.SetEnv([]string{"PATH=" + os.Getenv("PATH"), "SBOXMGR_CONFIG=/etc/sboxmgr.toml"})
+
+	output, err := importer.Query(context.Background(), "-c", "pwd; echo $SBOXMGR_CONFIG")
+	require.NoError(t, err)
+	resolved, err := filepath.EvalSymlinks(dir)
+	require.NoError(t, err)
+	assert.Equal(t, resolved+"\n/etc/sboxmgr.toml\n", string(output))
+}
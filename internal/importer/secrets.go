@@ -0,0 +1,54 @@
+package importer
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/kpblcaoo/sboxagent/internal/config"
+)
+
+// SecretPlaceholderPrefix marks a JSON string in an imported config that is
+// replaced with a local secret when the config is written
+const SecretPlaceholderPrefix = "!secret:"
+
+// secretPlaceholder matches a whole JSON string holding a placeholder. The
+// leading group keeps escaped quotes inside other strings from matching.
+var secretPlaceholder = regexp.MustCompile(`(^|[^\\])"` + regexp.QuoteMeta(SecretPlaceholderPrefix) + `([A-Za-z0-9_.-]+)"`)
+
+// InjectSecrets replaces "!secret:NAME" strings in a client config with the
+// secrets their names refer to in secrets, resolving each reference now so
+// the values never pass through sboxmgr. Unknown names fail the injection.
+func InjectSecrets(data []byte, secrets map[string]string) ([]byte, error) {
+	var injectErr error
+	out := secretPlaceholder.ReplaceAllFunc(data, func(match []byte) []byte {
+		groups := secretPlaceholder.FindSubmatch(match)
+		name := string(groups[2])
+		if injectErr != nil {
+			return match
+		}
+
+		// Config keys are case-insensitive
+		ref, ok := secrets[strings.ToLower(name)]
+		if !ok {
+			injectErr = fmt.Errorf("unknown secret %q", name)
+			return match
+		}
+		value, err := config.ResolveSecret(ref)
+		if err != nil {
+			injectErr = fmt.Errorf("failed to resolve secret %s: %w", name, err)
+			return match
+		}
+		encoded, err := json.Marshal(value)
+		if err != nil {
+			injectErr = fmt.Errorf("failed to encode secret %s: %w", name, err)
+			return match
+		}
+		return append(append([]byte{}, groups[1]...), encoded...)
+	})
+	if injectErr != nil {
+		return nil, injectErr
+	}
+	return out, nil
+}
@@ -0,0 +1,57 @@
+package importer
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestInjectSecrets(t *testing.T) {
+	keyFile := filepath.Join(t.TempDir(), "wg.key")
+	require.NoError(t, os.WriteFile(keyFile, []byte("aGVsbG8=\n"), 0600))
+	t.Setenv("SBOX_TEST_UUID", `quoted"uuid`)
+	secrets := map[string]string{
+		"wg_key": "!file:" + keyFile,
+		"uuid":   "!env:SBOX_TEST_UUID",
+	}
+
+	data, err := InjectSecrets([]byte(`{"endpoints":[{"private_key":"!secret:wg_key"}],`+
+		`"outbounds":[{"uuid":"!secret:UUID","tag":"note \"!secret:wg_key\""}]}`), secrets)
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"endpoints":[{"private_key":"aGVsbG8="}],`+
+		`"outbounds":[{"uuid":"quoted\"uuid","tag":"note \"!secret:wg_key\""}]}`, string(data))
+
+	_, err = InjectSecrets([]byte(`{"private_key":"!secret:missing"}`), secrets)
+	assert.EqualError(t, err, `unknown secret "missing"`)
+
+	_, err = InjectSecrets([]byte(`{"private_key":"!secret:broken"}`), map[string]string{"broken": "!env:SBOX_TEST_UNSET"})
+	assert.ErrorContains(t, err, "failed to resolve secret broken")
+}
+
+func TestImporter_SaveImportedConfigInjectsSecrets(t *testing.T) {
+	t.Setenv("SBOX_TEST_PSK", "local-psk")
+	importer := newTestImporter(t)
+	importer.config.Secrets = map[string]string{"psk": "!env:SBOX_TEST_PSK"}
+	path := filepath.Join(t.TempDir(), "config.json")
+
+	imported := &ImportedConfig{
+		Config:     []byte(`{"outbounds":[{"password":"!secret:psk"}]}`),
+		Validation: ValidationInfo{Valid: true},
+	}
+	_, err := importer.SaveImportedConfig(imported, path)
+	require.NoError(t, err)
+	saved, err := os.ReadFile(path)
+	require.NoError(t, err)
+	assert.Equal(t, `{"outbounds":[{"password":"local-psk"}]}`, string(saved))
+
+	// A missing secret leaves the current config in place
+	importer.config.Secrets = map[string]string{}
+	_, err = importer.SaveImportedConfig(imported, path)
+	assert.ErrorContains(t, err, `unknown secret "psk"`)
+	saved, err = os.ReadFile(path)
+	require.NoError(t, err)
+	assert.Equal(t, `{"outbounds":[{"password":"local-psk"}]}`, string(saved))
+}
@@ -0,0 +1,336 @@
+package importer
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os/exec"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/kpblcaoo/sboxagent/internal/config"
+	"github.com/kpblcaoo/sboxagent/internal/logger"
+	"github.com/kpblcaoo/sboxagent/internal/process"
+)
+
+// ErrSessionClosed is returned for runs sent after the session was closed
+var ErrSessionClosed = errors.New("sboxmgr session is closed")
+
+// sessionRequest asks the serving sboxmgr to run a command line, written
+// to its stdin as one JSON line in the command format of interactive
+// sboxctl
+type sessionRequest struct {
+	ID      string                 `json:"id"`
+	Command string                 `json:"command"`
+	Params  map[string]interface{} `json:"params"`
+}
+
+// sessionResponse is the RESPONSE event sboxmgr writes to stdout when a
+// run finished; request_id is the ID of the request
+type sessionResponse struct {
+	Type string `json:"type"`
+	Data struct {
+		RequestID string `json:"request_id"`
+		ExitCode  int    `json:"exit_code"`
+		Stdout    string `json:"stdout"`
+		Stderr    string `json:"stderr"`
+	} `json:"data"`
+}
+
+// sessionResult is the outcome of one run in a session
+type sessionResult struct {
+	stdout   []byte
+	stderr   string
+	exitCode int
+}
+
+// session keeps one sboxmgr serve-stdio process and sends it the runs the
+// importer would otherwise start sboxmgr for. Runs are multiplexed by
+// request ID. A process that exits is started again by the next run, no
+// sooner than the respawn delay after the previous start.
+type session struct {
+	config   config.SboxmgrSessionConfig
+	logger   *logger.Logger
+	importer *Importer
+
+	mu        sync.Mutex
+	proc      *sessionProcess
+	lastStart time.Time
+	closed    bool
+}
+
+// sessionProcess is one started serving process
+type sessionProcess struct {
+	cmd    *exec.Cmd
+	cancel context.CancelFunc
+
+	writeMu sync.Mutex
+	stdin   io.WriteCloser
+
+	mu      sync.Mutex
+	pending map[string]chan sessionResult
+
+	// done is closed once the process exited; err is its exit error
+	done chan struct{}
+	err  error
+}
+
+// newSession creates a session; the process starts with the first run
+func newSession(cfg config.SboxmgrSessionConfig, log *logger.Logger, importer *Importer) *session {
+	return &session{config: cfg, logger: log, importer: importer}
+}
+
+// run sends args, the sboxmgr command line without the executable, to the
+// serving process and waits for its result. A run abandoned because ctx
+// is done stops the process, so a hung sboxmgr is replaced.
+func (s *session) run(ctx context.Context, args []string) (*sessionResult, error) {
+	proc, err := s.process(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	req := sessionRequest{
+		ID:      uuid.NewString(),
+		Command: "run",
+		Params:  map[string]interface{}{"args": args},
+	}
+	line, err := json.Marshal(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode sboxmgr request: %w", err)
+	}
+
+	reply := make(chan sessionResult, 1)
+	proc.mu.Lock()
+	proc.pending[req.ID] = reply
+	proc.mu.Unlock()
+	defer proc.forget(req.ID)
+
+	proc.writeMu.Lock()
+	_, err = proc.stdin.Write(append(line, '\n'))
+	proc.writeMu.Unlock()
+	if err != nil {
+		return nil, fmt.Errorf("failed to send sboxmgr request: %w", err)
+	}
+
+	select {
+	case result := <-reply:
+		return &result, nil
+	case <-proc.done:
+		return nil, fmt.Errorf("sboxmgr session exited: %v", proc.err)
+	case <-ctx.Done():
+		s.logger.Warn("Stopping unresponsive sboxmgr session", map[string]interface{}{
+			"pid": proc.cmd.Process.Pid,
+		})
+		proc.cancel()
+		return nil, ctx.Err()
+	}
+}
+
+// process returns the serving process, starting it if needed
+func (s *session) process(ctx context.Context) (*sessionProcess, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return nil, ErrSessionClosed
+	}
+	if s.proc != nil {
+		return s.proc, nil
+	}
+
+	if wait := time.Until(s.lastStart.Add(s.config.RespawnDelay)); wait > 0 {
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(wait):
+		}
+	}
+	s.lastStart = time.Now()
+
+	proc, err := s.start()
+	if err != nil {
+		return nil, err
+	}
+	s.proc = proc
+	return proc, nil
+}
+
+// start starts the serving process with the importer's environment, user
+// and limits
+func (s *session) start() (*sessionProcess, error) {
+	i := s.importer
+	i.mu.RLock()
+	env, dir, credential, limits := i.env, i.dir, i.credential, i.limits
+	i.mu.RUnlock()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	command := s.config.Command
+	cmd := exec.CommandContext(ctx, command[0], command[1:]...)
+	cmd.Env = env
+	cmd.Dir = dir
+	process.Prepare(cmd)
+	if err := process.SetCredential(cmd, credential); err != nil {
+		cancel()
+		return nil, err
+	}
+
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		cancel()
+		return nil, fmt.Errorf("failed to open sboxmgr session stdin: %w", err)
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		cancel()
+		return nil, fmt.Errorf("failed to open sboxmgr session stdout: %w", err)
+	}
+	stderr := &tailBuffer{max: maxStderr}
+	cmd.Stderr = stderr
+
+	if err := process.StartLimited(cmd, limits); err != nil {
+		cancel()
+		return nil, fmt.Errorf("failed to start sboxmgr session: %w", err)
+	}
+	s.logger.Info("Started sboxmgr session", map[string]interface{}{
+		"command": command,
+		"pid":     cmd.Process.Pid,
+	})
+
+	proc := &sessionProcess{
+		cmd:     cmd,
+		cancel:  cancel,
+		stdin:   stdin,
+		pending: make(map[string]chan sessionResult),
+		done:    make(chan struct{}),
+	}
+	go s.read(proc, stdout, stderr)
+	return proc, nil
+}
+
+// read delivers the responses of a process until it exits
+func (s *session) read(proc *sessionProcess, stdout io.Reader, stderr *tailBuffer) {
+	reader := bufio.NewReader(stdout)
+	for {
+		line, err := reader.ReadBytes('\n')
+		if len(line) > 0 {
+			proc.deliver(line, s.logger)
+		}
+		if err != nil {
+			break
+		}
+	}
+
+	err := process.Wait(proc.cmd)
+	proc.cancel()
+	if err == nil {
+		err = errors.New("exited")
+	}
+	proc.err = runError(err, stderr.String())
+	close(proc.done)
+
+	s.mu.Lock()
+	if s.proc == proc {
+		s.proc = nil
+	}
+	closed := s.closed
+	s.mu.Unlock()
+	if !closed {
+		s.logger.Warn("Sboxmgr session exited, restarting on next run", map[string]interface{}{
+			"error": proc.err.Error(),
+		})
+	}
+}
+
+// deliver hands a response line to the run waiting for it
+func (p *sessionProcess) deliver(line []byte, log *logger.Logger) {
+	var response sessionResponse
+	if err := json.Unmarshal(line, &response); err != nil || response.Type != "RESPONSE" {
+		log.Debug("Ignoring sboxmgr session output", map[string]interface{}{
+			"line": string(line),
+		})
+		return
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	reply, ok := p.pending[response.Data.RequestID]
+	if !ok {
+		return
+	}
+	delete(p.pending, response.Data.RequestID)
+	reply <- sessionResult{
+		stdout:   []byte(response.Data.Stdout),
+		stderr:   response.Data.Stderr,
+		exitCode: response.Data.ExitCode,
+	}
+}
+
+// forget drops a run that is no longer waited for
+func (p *sessionProcess) forget(id string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	delete(p.pending, id)
+}
+
+// runSession runs a sboxmgr command line in the session, reporting the
+// outcome like a separate sboxmgr run would
+func (i *Importer) runSession(ctx context.Context, args []string, history *process.History) ([]byte, *SboxmgrError) {
+	started := time.Now()
+	result, err := i.session.run(ctx, args[1:])
+	if err != nil {
+		history.Add(process.NewRun("sboxmgr", args, started, 0, err))
+		return nil, &SboxmgrError{
+			Command:  args,
+			ExitCode: -1,
+			TimedOut: errors.Is(ctx.Err(), context.DeadlineExceeded),
+			Err:      err,
+			started:  !errors.Is(err, ErrSessionClosed),
+		}
+	}
+
+	if result.exitCode != 0 {
+		err := fmt.Errorf("exit status %d", result.exitCode)
+		history.Add(process.NewRun("sboxmgr", args, started, int64(len(result.stdout)), runError(err, result.stderr)))
+		return nil, &SboxmgrError{
+			Command:  args,
+			ExitCode: result.exitCode,
+			Stderr:   tail(result.stderr, maxStderr),
+			Err:      err,
+			started:  true,
+		}
+	}
+	history.Add(process.NewRun("sboxmgr", args, started, int64(len(result.stdout)), nil))
+	return result.stdout, nil
+}
+
+// tail returns the last max bytes of s
+func tail(s string, max int) string {
+	if len(s) > max {
+		return s[len(s)-max:]
+	}
+	return s
+}
+
+// close stops the serving process and rejects further runs
+func (s *session) close() {
+	s.mu.Lock()
+	s.closed = true
+	proc := s.proc
+	s.proc = nil
+	s.mu.Unlock()
+	if proc == nil {
+		return
+	}
+
+	// Closing stdin asks sboxmgr to exit; it is stopped if it does not
+	proc.stdin.Close()
+	select {
+	case <-proc.done:
+	case <-time.After(process.DefaultWaitDelay):
+		proc.cancel()
+		<-proc.done
+	}
+}
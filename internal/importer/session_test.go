@@ -0,0 +1,81 @@
+package importer
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/kpblcaoo/sboxagent/internal/config"
+	"github.com/kpblcaoo/sboxagent/internal/logger"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeServeStdio writes a sboxmgr serve-stdio stand-in answering each run
+// with its pid, failing runs mentioning "fail" and exiting on "crash"
+func fakeServeStdio(t *testing.T) (command []string, startsFile string) {
+	dir := t.TempDir()
+	startsFile = filepath.Join(dir, "starts")
+	script := filepath.Join(dir, "sboxmgr")
+	require.NoError(t, os.WriteFile(script, []byte(`#!/bin/sh
+echo start >> `+startsFile+`
+echo "not a response"
+while read -r line; do
+  id=$(echo "$line" | sed 's/.*"id":"\([^"]*\)".*/\1/')
+  case "$line" in
+    *crash*) exit 1 ;;
+    *fail*) printf '{"type":"RESPONSE","data":{"request_id":"%s","exit_code":65,"stderr":"invalid subscription"}}\n' "$id" ;;
+    *) printf '{"type":"RESPONSE","data":{"request_id":"%s","exit_code":0,"stdout":"pid %s"}}\n' "$id" "$$" ;;
+  esac
+done
+`), 0755))
+	return []string{script, "serve-stdio"}, startsFile
+}
+
+func TestImporter_Session(t *testing.T) {
+	log, err := logger.New("error")
+	require.NoError(t, err)
+	command, startsFile := fakeServeStdio(t)
+	importer := NewImporter(config.ImportConfig{
+		Command: []string{"sboxmgr", "export"},
+		Timeout: 5 * time.Second,
+		Session: config.SboxmgrSessionConfig{Enabled: true, Command: command},
+	}, log)
+	defer importer.Close()
+	ctx := context.Background()
+
+	// Runs share one process
+	first, failure := importer.runSboxmgr(ctx, []string{"sboxmgr", "export", "--url", "a"}, time.Second)
+	require.Nil(t, failure)
+	second, failure := importer.runSboxmgr(ctx, []string{"sboxmgr", "export", "--url", "b"}, time.Second)
+	require.Nil(t, failure)
+	assert.True(t, strings.HasPrefix(string(first), "pid "))
+	assert.Equal(t, first, second)
+
+	_, failure = importer.runSboxmgr(ctx, []string{"sboxmgr", "export", "--url", "fail"}, time.Second)
+	require.NotNil(t, failure)
+	assert.Equal(t, 65, failure.ExitCode)
+	assert.Equal(t, "invalid subscription", failure.Stderr)
+	assert.False(t, importer.transient(failure))
+
+	// A crash fails the run in flight as transient and respawns sboxmgr
+	_, failure = importer.runSboxmgr(ctx, []string{"sboxmgr", "export", "--url", "crash"}, time.Second)
+	require.NotNil(t, failure)
+	assert.True(t, importer.transient(failure))
+	third, failure := importer.runSboxmgr(ctx, []string{"sboxmgr", "export", "--url", "c"}, time.Second)
+	require.Nil(t, failure)
+	assert.NotEqual(t, first, third)
+
+	starts, err := os.ReadFile(startsFile)
+	require.NoError(t, err)
+	assert.Equal(t, 2, strings.Count(string(starts), "start"))
+
+	importer.Close()
+	_, failure = importer.runSboxmgr(ctx, []string{"sboxmgr", "export"}, time.Second)
+	require.NotNil(t, failure)
+	assert.True(t, errors.Is(failure, ErrSessionClosed))
+}
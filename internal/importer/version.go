@@ -0,0 +1,123 @@
+package importer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+)
+
+// ErrUnsupportedVersion is returned by Probe for sboxmgr releases the agent
+// has no argument set for
+var ErrUnsupportedVersion = errors.New("unsupported sboxmgr version")
+
+// versionPattern matches the first dotted version in sboxmgr --version output
+var versionPattern = regexp.MustCompile(`(\d+)\.(\d+)(?:\.(\d+))?`)
+
+// Version is a sboxmgr release version
+type Version struct {
+	Major int `json:"major"`
+	Minor int `json:"minor"`
+	Patch int `json:"patch"`
+}
+
+// ParseVersion extracts the version from sboxmgr --version output such as
+// "sboxmgr, version 1.4.2"
+func ParseVersion(output string) (Version, error) {
+	match := versionPattern.FindStringSubmatch(output)
+	if match == nil {
+		return Version{}, fmt.Errorf("no version in %q", lastLine(output))
+	}
+	var v Version
+	v.Major, _ = strconv.Atoi(match[1])
+	v.Minor, _ = strconv.Atoi(match[2])
+	if match[3] != "" {
+		v.Patch, _ = strconv.Atoi(match[3])
+	}
+	return v, nil
+}
+
+// String formats the version as major.minor.patch
+func (v Version) String() string {
+	return fmt.Sprintf("%d.%d.%d", v.Major, v.Minor, v.Patch)
+}
+
+// Less reports whether v is an older release than other
+func (v Version) Less(other Version) bool {
+	if v.Major != other.Major {
+		return v.Major < other.Major
+	}
+	if v.Minor != other.Minor {
+		return v.Minor < other.Minor
+	}
+	return v.Patch < other.Patch
+}
+
+// argSet names the flags sboxmgr takes for the subscription, client and
+// template variables
+type argSet struct {
+	since  Version
+	url    string
+	client string
+	vars   string
+}
+
+// argSets are the flag names by the first release using them, newest first.
+// Releases that rename flags add an entry; releases older than the last
+// entry are not supported.
+var argSets = []argSet{
+	{since: Version{0, 1, 0}, url: "--url", client: "--client", vars: "--var"},
+}
+
+// argSetFor returns the flags of a sboxmgr release
+func argSetFor(v Version) (argSet, error) {
+	for _, set := range argSets {
+		if !v.Less(set.since) {
+			return set, nil
+		}
+	}
+	oldest := argSets[len(argSets)-1].since
+	return argSet{}, fmt.Errorf("%w %s: sboxmgr %s or newer is required", ErrUnsupportedVersion, v, oldest)
+}
+
+// Probe runs sboxmgr --version, records the version and selects the flags
+// imports pass to it. Until a probe succeeds the newest flags are used.
+func (i *Importer) Probe(ctx context.Context) (Version, error) {
+	output, err := i.Query(ctx, "--version")
+	if err != nil {
+		return Version{}, fmt.Errorf("failed to query sboxmgr version: %w", err)
+	}
+	version, err := ParseVersion(string(output))
+	if err != nil {
+		return Version{}, fmt.Errorf("failed to parse sboxmgr version: %w", err)
+	}
+	set, err := argSetFor(version)
+	if err != nil {
+		return version, err
+	}
+
+	i.mu.Lock()
+	i.version = version
+	i.args = set
+	i.probed = true
+	i.mu.Unlock()
+	return version, nil
+}
+
+// SboxmgrVersion returns the version found by the last successful probe
+func (i *Importer) SboxmgrVersion() (Version, bool) {
+	i.mu.RLock()
+	defer i.mu.RUnlock()
+	return i.version, i.probed
+}
+
+// argSet returns the flags to run sboxmgr with
+func (i *Importer) argSet() argSet {
+	i.mu.RLock()
+	defer i.mu.RUnlock()
+	if !i.probed {
+		return argSets[0]
+	}
+	return i.args
+}
@@ -0,0 +1,64 @@
+package importer
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseVersion(t *testing.T) {
+	tests := []struct {
+		output string
+		want   Version
+	}{
+		{"sboxmgr, version 1.4.2\n", Version{1, 4, 2}},
+		{"0.2\n", Version{0, 2, 0}},
+		{"sboxmgr 2.0.0rc1 (python 3.12.1)", Version{2, 0, 0}},
+	}
+	for _, tt := range tests {
+		got, err := ParseVersion(tt.output)
+		require.NoError(t, err, tt.output)
+		assert.Equal(t, tt.want, got, tt.output)
+	}
+
+	_, err := ParseVersion("usage: sboxmgr [OPTIONS]")
+	assert.Error(t, err)
+}
+
+func TestArgSetFor(t *testing.T) {
+	set, err := argSetFor(Version{1, 0, 0})
+	require.NoError(t, err)
+	assert.Equal(t, "--url", set.url)
+	assert.Equal(t, "--client", set.client)
+
+	_, err = argSetFor(Version{0, 0, 9})
+	require.ErrorIs(t, err, ErrUnsupportedVersion)
+	assert.Contains(t, err.Error(), "sboxmgr 0.1.0 or newer is required")
+}
+
+func TestImporter_Probe(t *testing.T) {
+	script := filepath.Join(t.TempDir(), "sboxmgr")
+	require.NoError(t, os.WriteFile(script, []byte("#!/bin/sh\necho 'sboxmgr, version 1.4.2'\n"), 0755))
+	importer := newSboxmgrImporter(t, []string{script, "export"})
+
+	_, ok := importer.SboxmgrVersion()
+	assert.False(t, ok)
+
+	version, err := importer.Probe(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, Version{1, 4, 2}, version)
+	got, ok := importer.SboxmgrVersion()
+	assert.True(t, ok)
+	assert.Equal(t, "1.4.2", got.String())
+
+	// Unsupported releases are refused and leave the flags unchanged
+	require.NoError(t, os.WriteFile(script, []byte("#!/bin/sh\necho 'sboxmgr, version 0.0.1-dev'\n"), 0755))
+	_, err = importer.Probe(context.Background())
+	require.ErrorIs(t, err, ErrUnsupportedVersion)
+	got, _ = importer.SboxmgrVersion()
+	assert.Equal(t, Version{1, 4, 2}, got)
+}
@@ -0,0 +1,183 @@
+package initsys
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/kpblcaoo/sboxagent/internal/process"
+)
+
+// Locations of SysV init scripts and runit services, variables for tests
+var (
+	initScriptDir = "/etc/init.d"
+	pidDir        = "/run"
+	runitSvDir    = "/etc/sv"
+	runitDirs     = []string{"/etc/service", "/var/service", "/service"}
+)
+
+// genericManager manages services with the service command of SysV init or
+// the sv command of runit. Neither reports states, so they are read from
+// pidfiles: /run/<name>.pid for SysV and runsv's supervise/pid for runit.
+type genericManager struct {
+	system string
+	run    Runner
+}
+
+func newGeneric(system string, run Runner) *genericManager {
+	return &genericManager{system: system, run: run}
+}
+
+func (g *genericManager) System() string {
+	return g.system
+}
+
+func (g *genericManager) Backend() string {
+	if g.system == SystemRunit {
+		return "sv"
+	}
+	return "service"
+}
+
+// Name strips a systemd unit type like openrcManager.Name
+func (g *genericManager) Name(service string) string {
+	return strings.TrimSuffix(service, ".service")
+}
+
+// exec runs a command for service, mapping unknown services to
+// ErrNoSuchUnit
+func (g *genericManager) exec(ctx context.Context, op, service string, command ...string) error {
+	if _, err := g.run(ctx, command); err != nil {
+		if message := err.Error(); strings.Contains(message, "unrecognized service") || strings.Contains(message, "does not exist") {
+			err = errors.Join(ErrNoSuchUnit, err)
+		}
+		return &Error{Unit: service, Op: op, Err: err}
+	}
+	return nil
+}
+
+// control runs a lifecycle action; runit reloads services with a HUP
+func (g *genericManager) control(ctx context.Context, op, service string) error {
+	service = g.Name(service)
+	if g.system == SystemRunit {
+		action := op
+		if op == "reload" {
+			action = "hup"
+		}
+		return g.exec(ctx, op, service, "sv", action, filepath.Join(runitServiceDir(), service))
+	}
+	return g.exec(ctx, op, service, "service", service, op)
+}
+
+func (g *genericManager) Start(ctx context.Context, service string) error {
+	return g.control(ctx, "start", service)
+}
+
+func (g *genericManager) Stop(ctx context.Context, service string) error {
+	return g.control(ctx, "stop", service)
+}
+
+func (g *genericManager) Restart(ctx context.Context, service string) error {
+	return g.control(ctx, "restart", service)
+}
+
+func (g *genericManager) Reload(ctx context.Context, service string) error {
+	return g.control(ctx, "reload", service)
+}
+
+// Enable links a runit service into the service directory, or enables the
+// rc links of a SysV script with update-rc.d
+func (g *genericManager) Enable(ctx context.Context, service string) error {
+	service = g.Name(service)
+	if g.system != SystemRunit {
+		return g.exec(ctx, "enable", service, "update-rc.d", service, "enable")
+	}
+	link := filepath.Join(runitServiceDir(), service)
+	if _, err := os.Lstat(link); err == nil {
+		return nil
+	}
+	if err := os.Symlink(filepath.Join(runitSvDir, service), link); err != nil {
+		return &Error{Unit: service, Op: "enable", Err: err}
+	}
+	return nil
+}
+
+// Disable removes a runit service from the service directory, or disables
+// the rc links of a SysV script
+func (g *genericManager) Disable(ctx context.Context, service string) error {
+	service = g.Name(service)
+	if g.system != SystemRunit {
+		return g.exec(ctx, "disable", service, "update-rc.d", service, "disable")
+	}
+	if err := os.Remove(filepath.Join(runitServiceDir(), service)); err != nil && !os.IsNotExist(err) {
+		return &Error{Unit: service, Op: "disable", Err: err}
+	}
+	return nil
+}
+
+// State checks the service's pidfile. A pidfile naming a process that is
+// gone means the service died without cleaning up and is reported failed.
+func (g *genericManager) State(ctx context.Context, service string) (UnitState, error) {
+	service = g.Name(service)
+	state := UnitState{Unit: service}
+
+	var installed, pidFile string
+	if g.system == SystemRunit {
+		installed = filepath.Join(runitServiceDir(), service)
+		pidFile = filepath.Join(installed, "supervise", "pid")
+	} else {
+		installed = filepath.Join(initScriptDir, service)
+		pidFile = filepath.Join(pidDir, service+".pid")
+	}
+	if _, err := os.Stat(installed); err != nil {
+		if os.IsNotExist(err) {
+			err = fmt.Errorf("%w: %s", ErrNoSuchUnit, installed)
+		}
+		return state, &Error{Unit: service, Op: "status", Err: err}
+	}
+
+	data, err := os.ReadFile(pidFile)
+	if err != nil && !os.IsNotExist(err) {
+		return state, &Error{Unit: service, Op: "status", Err: err}
+	}
+	// runsv empties its pidfile while the service is down
+	content := strings.TrimSpace(string(data))
+	if content == "" {
+		state.ActiveState, state.SubState = "inactive", "dead"
+		return state, nil
+	}
+	pid, err := strconv.Atoi(content)
+	if err != nil {
+		return state, &Error{Unit: service, Op: "status", Err: fmt.Errorf("invalid pidfile %s: %w", pidFile, err)}
+	}
+	if process.Alive(pid) {
+		state.ActiveState, state.SubState = "active", "running"
+	} else {
+		state.ActiveState, state.SubState = "failed", "dead"
+	}
+	return state, nil
+}
+
+func (g *genericManager) Watch(ctx context.Context, services []string, changed func(UnitState)) error {
+	return ErrWatchUnsupported
+}
+
+func (g *genericManager) Close() {}
+
+// runitServiceDir returns the directory runsvdir supervises: $SVDIR, or the
+// first of the usual locations that exists
+func runitServiceDir() string {
+	if dir := os.Getenv("SVDIR"); dir != "" {
+		return dir
+	}
+	for _, dir := range runitDirs {
+		if _, err := os.Stat(dir); err == nil {
+			return dir
+		}
+	}
+	return runitDirs[0]
+}
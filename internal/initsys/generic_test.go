@@ -0,0 +1,106 @@
+package initsys
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGeneric_SysV(t *testing.T) {
+	dir := t.TempDir()
+	initScriptDir, pidDir = filepath.Join(dir, "init.d"), filepath.Join(dir, "run")
+	t.Cleanup(func() {
+		initScriptDir, pidDir = "/etc/init.d", "/run"
+	})
+	require.NoError(t, os.MkdirAll(initScriptDir, 0755))
+	require.NoError(t, os.MkdirAll(pidDir, 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(initScriptDir, "sing-box"), nil, 0755))
+
+	var commands [][]string
+	manager, err := Open(context.Background(), Options{System: SystemSysV, Run: func(ctx context.Context, command []string) ([]byte, error) {
+		commands = append(commands, command)
+		return nil, nil
+	}})
+	require.NoError(t, err)
+	assert.Equal(t, "service", manager.Backend())
+
+	ctx := context.Background()
+	require.NoError(t, manager.Restart(ctx, "sing-box.service"))
+	require.NoError(t, manager.Disable(ctx, "sing-box"))
+	assert.Equal(t, [][]string{
+		{"service", "sing-box", "restart"},
+		{"update-rc.d", "sing-box", "disable"},
+	}, commands)
+
+	// No pidfile, a live process and a stale pidfile
+	state, err := manager.State(ctx, "sing-box")
+	require.NoError(t, err)
+	assert.Equal(t, UnitState{Unit: "sing-box", ActiveState: "inactive", SubState: "dead"}, state)
+
+	pidFile := filepath.Join(pidDir, "sing-box.pid")
+	require.NoError(t, os.WriteFile(pidFile, []byte(strconv.Itoa(os.Getpid())+"\n"), 0644))
+	state, err = manager.State(ctx, "sing-box")
+	require.NoError(t, err)
+	assert.Equal(t, "active", state.ActiveState)
+
+	require.NoError(t, os.WriteFile(pidFile, []byte("999999999"), 0644))
+	state, err = manager.State(ctx, "sing-box")
+	require.NoError(t, err)
+	assert.Equal(t, "failed", state.ActiveState)
+
+	_, err = manager.State(ctx, "xray")
+	assert.ErrorIs(t, err, ErrNoSuchUnit)
+}
+
+func TestGeneric_Runit(t *testing.T) {
+	dir := t.TempDir()
+	serviceDir := filepath.Join(dir, "service")
+	runitSvDir = filepath.Join(dir, "sv")
+	t.Setenv("SVDIR", serviceDir)
+	t.Cleanup(func() {
+		runitSvDir = "/etc/sv"
+	})
+	require.NoError(t, os.MkdirAll(filepath.Join(runitSvDir, "sing-box", "supervise"), 0755))
+	require.NoError(t, os.MkdirAll(serviceDir, 0755))
+
+	var commands [][]string
+	manager := newGeneric(SystemRunit, func(ctx context.Context, command []string) ([]byte, error) {
+		commands = append(commands, command)
+		return nil, nil
+	})
+	assert.Equal(t, "sv", manager.Backend())
+
+	ctx := context.Background()
+	_, err := manager.State(ctx, "sing-box")
+	assert.ErrorIs(t, err, ErrNoSuchUnit)
+
+	require.NoError(t, manager.Enable(ctx, "sing-box"))
+	require.NoError(t, manager.Enable(ctx, "sing-box"))
+	target, err := os.Readlink(filepath.Join(serviceDir, "sing-box"))
+	require.NoError(t, err)
+	assert.Equal(t, filepath.Join(runitSvDir, "sing-box"), target)
+
+	require.NoError(t, manager.Reload(ctx, "sing-box"))
+	assert.Equal(t, [][]string{{"sv", "hup", filepath.Join(serviceDir, "sing-box")}}, commands)
+
+	// runsv leaves an empty pidfile while the service is down
+	pidFile := filepath.Join(runitSvDir, "sing-box", "supervise", "pid")
+	require.NoError(t, os.WriteFile(pidFile, nil, 0644))
+	state, err := manager.State(ctx, "sing-box")
+	require.NoError(t, err)
+	assert.Equal(t, "inactive", state.ActiveState)
+
+	require.NoError(t, os.WriteFile(pidFile, []byte(strconv.Itoa(os.Getpid())), 0644))
+	state, err = manager.State(ctx, "sing-box")
+	require.NoError(t, err)
+	assert.Equal(t, "active", state.ActiveState)
+
+	require.NoError(t, manager.Disable(ctx, "sing-box"))
+	_, err = os.Lstat(filepath.Join(serviceDir, "sing-box"))
+	assert.True(t, os.IsNotExist(err))
+}
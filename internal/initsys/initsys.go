@@ -0,0 +1,190 @@
+// Package initsys manages the services of the host's init system: the
+// service control manager on Windows, launchd on macOS, systemd where it
+// runs, otherwise OpenRC, runit or SysV init.
+package initsys
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"runtime"
+
+	"github.com/kpblcaoo/sboxagent/internal/systemd"
+)
+
+// Init systems of services.systemd.init_system
+const (
+	SystemAuto    = "auto"
+	SystemSystemd = "systemd"
+	SystemOpenRC  = "openrc"
+	SystemRunit   = "runit"
+	SystemSysV    = "sysv"
+	SystemLaunchd = "launchd"
+	SystemWindows = "windows"
+)
+
+// UnitState is the state of a service, in systemd's active and sub state
+// terms for every init system
+type UnitState = systemd.UnitState
+
+// Runner runs a command and returns its stdout
+type Runner = systemd.Runner
+
+// Error is a failed service operation
+type Error = systemd.Error
+
+var (
+	// ErrNoSuchUnit is returned for services the init system does not know
+	ErrNoSuchUnit = systemd.ErrNoSuchUnit
+	// ErrWatchUnsupported is returned by init systems that cannot report
+	// state changes
+	ErrWatchUnsupported = systemd.ErrWatchUnsupported
+)
+
+// Manager starts, stops and inspects the services of an init system
+type Manager interface {
+	// System returns the name of the init system, such as systemd or openrc
+	System() string
+	// Backend returns how the init system is driven, such as dbus,
+	// systemctl or rc-service
+	Backend() string
+	// Name returns the full name the init system uses for a service
+	Name(service string) string
+	Start(ctx context.Context, service string) error
+	Stop(ctx context.Context, service string) error
+	Restart(ctx context.Context, service string) error
+	Reload(ctx context.Context, service string) error
+	// Enable and Disable change whether the service starts at boot
+	Enable(ctx context.Context, service string) error
+	Disable(ctx context.Context, service string) error
+	// State returns the state of a service under its full name
+	State(ctx context.Context, service string) (UnitState, error)
+	// Watch calls changed whenever the state of one of the services
+	// changes, until ctx is done
+	Watch(ctx context.Context, services []string, changed func(UnitState)) error
+	Close()
+}
+
+// Options select and configure the init system
+type Options struct {
+	// System is systemd, openrc, runit, sysv, launchd, windows or auto,
+	// which detects the running one
+	System string
+	// Backend is the systemd backend, see systemd.Open
+	Backend string
+	// UserMode manages the services of the user instead of the system
+	UserMode bool
+	// Run runs the init system's commands
+	Run Runner
+}
+
+// Paths the init systems create at boot, variables for tests
+var (
+	systemdRunDir = "/run/systemd/system"
+	openrcRunDir  = "/run/openrc"
+	runitRunDir   = "/run/runit"
+)
+
+// Detect returns the init system running the host: the service control
+// manager on Windows, launchd on macOS, otherwise the first found of
+// systemd, OpenRC, runit and the SysV service command. Hosts with none of
+// them are assumed to use systemd.
+func Detect() string {
+	switch runtime.GOOS {
+	case "windows":
+		return SystemWindows
+	case "darwin":
+		return SystemLaunchd
+	}
+	if _, err := os.Stat(systemdRunDir); err == nil {
+		return SystemSystemd
+	}
+	if _, err := os.Stat(openrcRunDir); err == nil {
+		return SystemOpenRC
+	}
+	if _, err := exec.LookPath("rc-service"); err == nil {
+		return SystemOpenRC
+	}
+	if _, err := os.Stat(runitRunDir); err == nil {
+		return SystemRunit
+	}
+	if _, err := exec.LookPath("sv"); err == nil {
+		return SystemRunit
+	}
+	if _, err := exec.LookPath("service"); err == nil {
+		return SystemSysV
+	}
+	return SystemSystemd
+}
+
+// Files container engines create in their containers, variables for tests
+var (
+	dockerEnvFile = "/.dockerenv"
+	podmanEnvFile = "/run/.containerenv"
+)
+
+// InContainer reports whether the agent runs in a Docker or Podman
+// container, or one started by an engine setting $container
+func InContainer() bool {
+	if os.Getenv("container") != "" {
+		return true
+	}
+	for _, path := range []string{dockerEnvFile, podmanEnvFile} {
+		if _, err := os.Stat(path); err == nil {
+			return true
+		}
+	}
+	return false
+}
+
+// ServiceManagerRunning reports whether systemd, OpenRC or runit was booted
+// on the host. Containers usually run none of them even when their image
+// ships the tools.
+func ServiceManagerRunning() bool {
+	for _, dir := range []string{systemdRunDir, openrcRunDir, runitRunDir} {
+		if _, err := os.Stat(dir); err == nil {
+			return true
+		}
+	}
+	return false
+}
+
+// Open returns the manager of the selected init system
+func Open(ctx context.Context, opts Options) (Manager, error) {
+	system := opts.System
+	if system == "" || system == SystemAuto {
+		system = Detect()
+	}
+	switch system {
+	case SystemSystemd:
+		units, err := systemd.Open(ctx, opts.Backend, opts.UserMode, opts.Run)
+		if err != nil {
+			return nil, err
+		}
+		return systemdManager{units}, nil
+	case SystemOpenRC:
+		return newOpenRC(opts.UserMode, opts.Run), nil
+	case SystemLaunchd:
+		return newLaunchd(opts.UserMode, opts.Run), nil
+	case SystemWindows:
+		return openSCM()
+	case SystemRunit, SystemSysV:
+		return newGeneric(system, opts.Run), nil
+	default:
+		return nil, fmt.Errorf("unknown init system %q", opts.System)
+	}
+}
+
+// systemdManager manages systemd units
+type systemdManager struct {
+	systemd.Units
+}
+
+func (m systemdManager) System() string {
+	return SystemSystemd
+}
+
+func (m systemdManager) Name(service string) string {
+	return systemd.UnitName(service)
+}
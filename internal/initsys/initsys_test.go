@@ -0,0 +1,126 @@
+package initsys
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDetect(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv("PATH", dir)
+	systemdRunDir, openrcRunDir, runitRunDir = filepath.Join(dir, "systemd"), filepath.Join(dir, "openrc"), filepath.Join(dir, "runit")
+	t.Cleanup(func() {
+		systemdRunDir, openrcRunDir, runitRunDir = "/run/systemd/system", "/run/openrc", "/run/runit"
+	})
+	assert.Equal(t, SystemSystemd, Detect())
+
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "service"), []byte("#!/bin/sh\n"), 0755))
+	assert.Equal(t, SystemSysV, Detect())
+
+	require.NoError(t, os.MkdirAll(runitRunDir, 0755))
+	assert.Equal(t, SystemRunit, Detect())
+
+	require.NoError(t, os.MkdirAll(openrcRunDir, 0755))
+	assert.Equal(t, SystemOpenRC, Detect())
+
+	require.NoError(t, os.MkdirAll(systemdRunDir, 0755))
+	assert.Equal(t, SystemSystemd, Detect())
+}
+
+func TestInContainer(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv("container", "")
+	dockerEnvFile, podmanEnvFile = filepath.Join(dir, ".dockerenv"), filepath.Join(dir, ".containerenv")
+	systemdRunDir, openrcRunDir, runitRunDir = filepath.Join(dir, "systemd"), filepath.Join(dir, "openrc"), filepath.Join(dir, "runit")
+	t.Cleanup(func() {
+		dockerEnvFile, podmanEnvFile = "/.dockerenv", "/run/.containerenv"
+		systemdRunDir, openrcRunDir, runitRunDir = "/run/systemd/system", "/run/openrc", "/run/runit"
+	})
+	assert.False(t, InContainer())
+	assert.False(t, ServiceManagerRunning())
+
+	require.NoError(t, os.WriteFile(podmanEnvFile, nil, 0644))
+	assert.True(t, InContainer())
+	require.NoError(t, os.Remove(podmanEnvFile))
+	t.Setenv("container", "lxc")
+	assert.True(t, InContainer())
+
+	require.NoError(t, os.MkdirAll(runitRunDir, 0755))
+	assert.True(t, ServiceManagerRunning())
+}
+
+func TestOpen(t *testing.T) {
+	manager, err := Open(context.Background(), Options{System: SystemSystemd, Backend: "systemctl"})
+	require.NoError(t, err)
+	assert.Equal(t, SystemSystemd, manager.System())
+	assert.Equal(t, "systemctl", manager.Backend())
+	assert.Equal(t, "sing-box.service", manager.Name("sing-box"))
+
+	manager, err = Open(context.Background(), Options{System: SystemOpenRC})
+	require.NoError(t, err)
+	assert.Equal(t, SystemOpenRC, manager.System())
+	assert.Equal(t, "sing-box", manager.Name("sing-box.service"))
+
+	_, err = Open(context.Background(), Options{System: "upstart"})
+	assert.EqualError(t, err, `unknown init system "upstart"`)
+}
+
+func TestOpenRC(t *testing.T) {
+	var commands [][]string
+	status := 0
+	manager, err := Open(context.Background(), Options{System: SystemOpenRC, UserMode: true, Run: func(ctx context.Context, command []string) ([]byte, error) {
+		commands = append(commands, command)
+		if command[len(command)-1] == "status" && status != 0 {
+			return nil, exec.CommandContext(ctx, "sh", "-c", fmt.Sprintf("exit %d", status)).Run()
+		}
+		return nil, nil
+	}})
+	require.NoError(t, err)
+
+	ctx := context.Background()
+	require.NoError(t, manager.Restart(ctx, "sing-box.service"))
+	require.NoError(t, manager.Enable(ctx, "sing-box"))
+	state, err := manager.State(ctx, "sing-box")
+	require.NoError(t, err)
+	assert.Equal(t, UnitState{Unit: "sing-box", ActiveState: "active", SubState: "running"}, state)
+
+	status = 32
+	state, err = manager.State(ctx, "sing-box")
+	require.NoError(t, err)
+	assert.Equal(t, "failed", state.ActiveState)
+	assert.Equal(t, "crashed", state.SubState)
+
+	assert.Equal(t, [][]string{
+		{"rc-service", "--user", "sing-box", "restart"},
+		{"rc-update", "--user", "add", "sing-box", "default"},
+		{"rc-service", "--user", "sing-box", "status"},
+		{"rc-service", "--user", "sing-box", "status"},
+	}, commands)
+
+	err = manager.Watch(ctx, []string{"sing-box"}, func(UnitState) {})
+	assert.ErrorIs(t, err, ErrWatchUnsupported)
+}
+
+func TestOpenRC_Errors(t *testing.T) {
+	manager := newOpenRC(false, func(ctx context.Context, command []string) ([]byte, error) {
+		return nil, fmt.Errorf("exit status 1: rc-service: service `%s' does not exist", command[1])
+	})
+
+	err := manager.Start(context.Background(), "missing")
+	var opErr *Error
+	require.True(t, errors.As(err, &opErr))
+	assert.Equal(t, "start", opErr.Op)
+	assert.Equal(t, "missing", opErr.Unit)
+	assert.ErrorIs(t, err, ErrNoSuchUnit)
+
+	_, err = manager.State(context.Background(), "missing")
+	assert.ErrorIs(t, err, ErrNoSuchUnit)
+}
@@ -0,0 +1,193 @@
+package initsys
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/kpblcaoo/sboxagent/internal/process"
+)
+
+// exitNoSuchService is the exit status of launchctl for services that are
+// not loaded
+const exitNoSuchService = 113
+
+// launchdManager manages launchd jobs with launchctl. Services are job
+// labels in the gui domain of the user in user mode and in the system
+// domain otherwise.
+type launchdManager struct {
+	userMode bool
+	run      Runner
+}
+
+func newLaunchd(userMode bool, run Runner) *launchdManager {
+	return &launchdManager{userMode: userMode, run: run}
+}
+
+func (l *launchdManager) System() string {
+	return SystemLaunchd
+}
+
+func (l *launchdManager) Backend() string {
+	return "launchctl"
+}
+
+// Name strips a systemd unit type like openrcManager.Name
+func (l *launchdManager) Name(service string) string {
+	return strings.TrimSuffix(service, ".service")
+}
+
+// domain returns the launchd domain of the services
+func (l *launchdManager) domain() string {
+	if l.userMode {
+		return fmt.Sprintf("gui/%d", os.Getuid())
+	}
+	return "system"
+}
+
+// target returns the service target of a job label
+func (l *launchdManager) target(label string) string {
+	return l.domain() + "/" + label
+}
+
+// PlistPath returns where the property list of a launchd job is installed:
+// ~/Library/LaunchAgents in user mode and /Library/LaunchDaemons otherwise
+func PlistPath(label string, userMode bool) string {
+	dir := "/Library/LaunchDaemons"
+	if userMode {
+		if home, err := os.UserHomeDir(); err == nil {
+			dir = filepath.Join(home, "Library", "LaunchAgents")
+		}
+	}
+	return filepath.Join(dir, label+".plist")
+}
+
+// launchctl runs launchctl, mapping jobs that are not loaded to
+// ErrNoSuchUnit
+func (l *launchdManager) launchctl(ctx context.Context, op, label string, args ...string) ([]byte, error) {
+	output, err := l.run(ctx, append([]string{"launchctl"}, args...))
+	if err != nil {
+		if process.ExitCode(err) == exitNoSuchService {
+			err = errors.Join(ErrNoSuchUnit, err)
+		}
+		return nil, &Error{Unit: label, Op: op, Err: err}
+	}
+	return output, nil
+}
+
+// Start kicks off a loaded job, or loads the job from its installed
+// property list
+func (l *launchdManager) Start(ctx context.Context, service string) error {
+	label := l.Name(service)
+	_, err := l.launchctl(ctx, "start", label, "kickstart", l.target(label))
+	if !errors.Is(err, ErrNoSuchUnit) {
+		return err
+	}
+	return l.bootstrap(ctx, "start", label)
+}
+
+// bootstrap loads a job from its installed property list
+func (l *launchdManager) bootstrap(ctx context.Context, op, label string) error {
+	plist := PlistPath(label, l.userMode)
+	if _, err := os.Stat(plist); err != nil {
+		if os.IsNotExist(err) {
+			err = fmt.Errorf("%w: %s", ErrNoSuchUnit, plist)
+		}
+		return &Error{Unit: label, Op: op, Err: err}
+	}
+	_, err := l.launchctl(ctx, op, label, "bootstrap", l.domain(), plist)
+	return err
+}
+
+// Stop unloads the job, so KeepAlive does not start it again
+func (l *launchdManager) Stop(ctx context.Context, service string) error {
+	label := l.Name(service)
+	_, err := l.launchctl(ctx, "stop", label, "bootout", l.target(label))
+	if errors.Is(err, ErrNoSuchUnit) {
+		return nil
+	}
+	return err
+}
+
+func (l *launchdManager) Restart(ctx context.Context, service string) error {
+	label := l.Name(service)
+	_, err := l.launchctl(ctx, "restart", label, "kickstart", "-k", l.target(label))
+	if !errors.Is(err, ErrNoSuchUnit) {
+		return err
+	}
+	return l.bootstrap(ctx, "restart", label)
+}
+
+// Reload sends the job SIGHUP
+func (l *launchdManager) Reload(ctx context.Context, service string) error {
+	label := l.Name(service)
+	_, err := l.launchctl(ctx, "reload", label, "kill", "SIGHUP", l.target(label))
+	return err
+}
+
+func (l *launchdManager) Enable(ctx context.Context, service string) error {
+	label := l.Name(service)
+	_, err := l.launchctl(ctx, "enable", label, "enable", l.target(label))
+	return err
+}
+
+func (l *launchdManager) Disable(ctx context.Context, service string) error {
+	label := l.Name(service)
+	_, err := l.launchctl(ctx, "disable", label, "disable", l.target(label))
+	return err
+}
+
+// State parses launchctl print. Jobs that are installed but not loaded are
+// inactive; jobs that are not running after a non-zero exit are failed.
+func (l *launchdManager) State(ctx context.Context, service string) (UnitState, error) {
+	label := l.Name(service)
+	state := UnitState{Unit: label}
+	output, err := l.launchctl(ctx, "status", label, "print", l.target(label))
+	if errors.Is(err, ErrNoSuchUnit) {
+		if _, statErr := os.Stat(PlistPath(label, l.userMode)); statErr == nil {
+			state.ActiveState, state.SubState = "inactive", "unloaded"
+			return state, nil
+		}
+	}
+	if err != nil {
+		return state, err
+	}
+
+	var running, exitCode string
+	scanner := bufio.NewScanner(bytes.NewReader(output))
+	for scanner.Scan() {
+		name, value, ok := strings.Cut(strings.TrimSpace(scanner.Text()), " = ")
+		if !ok {
+			continue
+		}
+		// Nested sections repeat keys; the job's own come first
+		switch {
+		case name == "state" && running == "":
+			running = value
+		case name == "last exit code" && exitCode == "":
+			exitCode = value
+		}
+	}
+	switch {
+	case running == "running":
+		state.ActiveState, state.SubState = "active", "running"
+	case running == "spawn scheduled":
+		state.ActiveState, state.SubState = "activating", "scheduled"
+	case exitCode != "" && exitCode != "0" && !strings.HasPrefix(exitCode, "(never exited)"):
+		state.ActiveState, state.SubState = "failed", "exited"
+	default:
+		state.ActiveState, state.SubState = "inactive", "dead"
+	}
+	return state, nil
+}
+
+func (l *launchdManager) Watch(ctx context.Context, services []string, changed func(UnitState)) error {
+	return ErrWatchUnsupported
+}
+
+func (l *launchdManager) Close() {}
@@ -0,0 +1,86 @@
+package initsys
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const launchctlPrint = `gui/501/homebrew.mxcl.sing-box = {
+	active count = 0
+	path = /Users/me/Library/LaunchAgents/homebrew.mxcl.sing-box.plist
+	state = %s
+	last exit code = %s
+	endpoints = {
+		state = active
+	}
+}
+`
+
+func TestLaunchd(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	require.NoError(t, os.MkdirAll(filepath.Join(home, "Library", "LaunchAgents"), 0755))
+
+	var commands [][]string
+	loaded, state, exitCode := false, "running", "(never exited)"
+	manager, err := Open(context.Background(), Options{System: SystemLaunchd, UserMode: true, Run: func(ctx context.Context, command []string) ([]byte, error) {
+		commands = append(commands, command)
+		if !loaded && (command[1] == "kickstart" || command[1] == "print") {
+			return nil, exec.CommandContext(ctx, "sh", "-c", "exit 113").Run()
+		}
+		if command[1] == "print" {
+			return []byte(fmt.Sprintf(launchctlPrint, state, exitCode)), nil
+		}
+		return nil, nil
+	}})
+	require.NoError(t, err)
+	assert.Equal(t, "launchctl", manager.Backend())
+
+	ctx := context.Background()
+	label := "homebrew.mxcl.sing-box"
+	target := fmt.Sprintf("gui/%d/%s", os.Getuid(), label)
+	plist := filepath.Join(home, "Library", "LaunchAgents", label+".plist")
+
+	// Jobs neither loaded nor installed are unknown
+	err = manager.Start(ctx, label)
+	assert.ErrorIs(t, err, ErrNoSuchUnit)
+	_, err = manager.State(ctx, label)
+	assert.ErrorIs(t, err, ErrNoSuchUnit)
+
+	// Installed jobs are loaded on start
+	require.NoError(t, os.WriteFile(plist, nil, 0644))
+	unitState, err := manager.State(ctx, label)
+	require.NoError(t, err)
+	assert.Equal(t, "inactive", unitState.ActiveState)
+	commands = nil
+	require.NoError(t, manager.Start(ctx, label))
+	assert.Equal(t, [][]string{
+		{"launchctl", "kickstart", target},
+		{"launchctl", "bootstrap", fmt.Sprintf("gui/%d", os.Getuid()), plist},
+	}, commands)
+
+	loaded = true
+	unitState, err = manager.State(ctx, label+".service")
+	require.NoError(t, err)
+	assert.Equal(t, UnitState{Unit: label, ActiveState: "active", SubState: "running"}, unitState)
+
+	state, exitCode = "not running", "78: Function not implemented"
+	unitState, err = manager.State(ctx, label)
+	require.NoError(t, err)
+	assert.Equal(t, "failed", unitState.ActiveState)
+
+	commands = nil
+	require.NoError(t, manager.Restart(ctx, label))
+	require.NoError(t, manager.Stop(ctx, label))
+	assert.Equal(t, [][]string{
+		{"launchctl", "kickstart", "-k", target},
+		{"launchctl", "bootout", target},
+	}, commands)
+}
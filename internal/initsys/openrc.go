@@ -0,0 +1,116 @@
+package initsys
+
+import (
+	"context"
+	"errors"
+	"strings"
+
+	"github.com/kpblcaoo/sboxagent/internal/process"
+)
+
+// runlevel is the OpenRC runlevel services are enabled in
+const runlevel = "default"
+
+// openrcStates maps the exit status of rc-service status to systemd's active
+// and sub states
+var openrcStates = map[int][2]string{
+	0:  {"active", "running"},
+	3:  {"inactive", "dead"},
+	4:  {"deactivating", "stopping"},
+	8:  {"activating", "starting"},
+	16: {"inactive", "inactive"},
+	32: {"failed", "crashed"},
+}
+
+// openrcManager manages OpenRC services with rc-service and rc-update
+type openrcManager struct {
+	userMode bool
+	run      Runner
+}
+
+func newOpenRC(userMode bool, run Runner) *openrcManager {
+	return &openrcManager{userMode: userMode, run: run}
+}
+
+func (o *openrcManager) System() string {
+	return SystemOpenRC
+}
+
+func (o *openrcManager) Backend() string {
+	return "rc-service"
+}
+
+// Name strips a systemd unit type, so units configured for systemd map to
+// the OpenRC service of the same name
+func (o *openrcManager) Name(service string) string {
+	return strings.TrimSuffix(service, ".service")
+}
+
+// exec runs an OpenRC command for service
+func (o *openrcManager) exec(ctx context.Context, op, service, command string, args ...string) ([]byte, error) {
+	argv := []string{command}
+	if o.userMode {
+		argv = append(argv, "--user")
+	}
+	output, err := o.run(ctx, append(argv, args...))
+	if err != nil {
+		if strings.Contains(err.Error(), "does not exist") {
+			err = errors.Join(ErrNoSuchUnit, err)
+		}
+		return nil, &Error{Unit: service, Op: op, Err: err}
+	}
+	return output, nil
+}
+
+func (o *openrcManager) service(ctx context.Context, op, service string) error {
+	service = o.Name(service)
+	_, err := o.exec(ctx, op, service, "rc-service", service, op)
+	return err
+}
+
+func (o *openrcManager) Start(ctx context.Context, service string) error {
+	return o.service(ctx, "start", service)
+}
+
+func (o *openrcManager) Stop(ctx context.Context, service string) error {
+	return o.service(ctx, "stop", service)
+}
+
+func (o *openrcManager) Restart(ctx context.Context, service string) error {
+	return o.service(ctx, "restart", service)
+}
+
+func (o *openrcManager) Reload(ctx context.Context, service string) error {
+	return o.service(ctx, "reload", service)
+}
+
+func (o *openrcManager) Enable(ctx context.Context, service string) error {
+	service = o.Name(service)
+	_, err := o.exec(ctx, "enable", service, "rc-update", "add", service, runlevel)
+	return err
+}
+
+func (o *openrcManager) Disable(ctx context.Context, service string) error {
+	service = o.Name(service)
+	_, err := o.exec(ctx, "disable", service, "rc-update", "del", service, runlevel)
+	return err
+}
+
+// State maps the exit status of rc-service status, which is not an error
+// for stopped or crashed services
+func (o *openrcManager) State(ctx context.Context, service string) (UnitState, error) {
+	service = o.Name(service)
+	state := UnitState{Unit: service}
+	_, err := o.exec(ctx, "status", service, "rc-service", service, "status")
+	if states, ok := openrcStates[process.ExitCode(err)]; ok {
+		state.ActiveState, state.SubState = states[0], states[1]
+		return state, nil
+	}
+	return state, err
+}
+
+func (o *openrcManager) Watch(ctx context.Context, services []string, changed func(UnitState)) error {
+	return ErrWatchUnsupported
+}
+
+func (o *openrcManager) Close() {}
@@ -0,0 +1,196 @@
+package initsys
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/template"
+
+	"github.com/kpblcaoo/sboxagent/internal/config"
+	"github.com/kpblcaoo/sboxagent/internal/systemd"
+)
+
+// Change is a setting that differs between two property lists, keyed by
+// its dotted path
+type Change = systemd.UnitChange
+
+var plistTemplate = template.Must(template.New("plist").Funcs(template.FuncMap{
+	"xml": func(s string) string {
+		var b strings.Builder
+		xml.EscapeText(&b, []byte(s))
+		return b.String()
+	},
+}).Parse(`<?xml version="1.0" encoding="UTF-8"?>
+<!DOCTYPE plist PUBLIC "-//Apple//DTD PLIST 1.0//EN" "http://www.apple.com/DTDs/PropertyList-1.0.dtd">
+<plist version="1.0">
+<dict>
+	<key>Label</key>
+	<string>{{xml .Label}}</string>
+	<key>ProgramArguments</key>
+	<array>
+{{- range .Args}}
+		<string>{{xml .}}</string>
+{{- end}}
+	</array>
+	<key>RunAtLoad</key>
+	<true/>
+{{- if eq .Restart "always"}}
+	<key>KeepAlive</key>
+	<true/>
+{{- else if eq .Restart "on-failure"}}
+	<key>KeepAlive</key>
+	<dict>
+		<key>SuccessfulExit</key>
+		<false/>
+	</dict>
+{{- end}}
+{{- with .ThrottleInterval}}
+	<key>ThrottleInterval</key>
+	<integer>{{.}}</integer>
+{{- end}}
+{{- if or .LimitNOFILE .LimitNPROC}}
+	<key>SoftResourceLimits</key>
+	<dict>
+{{- with .LimitNOFILE}}
+		<key>NumberOfFiles</key>
+		<integer>{{.}}</integer>
+{{- end}}
+{{- with .LimitNPROC}}
+		<key>NumberOfProcesses</key>
+		<integer>{{.}}</integer>
+{{- end}}
+	</dict>
+{{- end}}
+	<key>StandardOutPath</key>
+	<string>{{xml .LogPath}}</string>
+	<key>StandardErrorPath</key>
+	<string>{{xml .LogPath}}</string>
+	<key>ProcessType</key>
+	<string>Background</string>
+</dict>
+</plist>
+`))
+
+// RenderPlist generates the launchd property list of the agent from cfg.
+// Output goes to sboxagent.log in logDir. The hardening settings of systemd
+// have no launchd equivalent and are left out.
+func RenderPlist(cfg config.UnitConfig, vars config.UnitVars, logDir string) ([]byte, error) {
+	if cfg.Label == "" {
+		return nil, fmt.Errorf("unit label is required for launchd")
+	}
+	args, err := cfg.Command(vars)
+	if err != nil {
+		return nil, err
+	}
+
+	data := struct {
+		config.UnitConfig
+		Args             []string
+		ThrottleInterval int
+		LogPath          string
+	}{
+		UnitConfig:       cfg,
+		Args:             args,
+		ThrottleInterval: int(cfg.RestartSec.Seconds()),
+		LogPath:          filepath.Join(logDir, "sboxagent.log"),
+	}
+	var b bytes.Buffer
+	if err := plistTemplate.Execute(&b, data); err != nil {
+		return nil, fmt.Errorf("failed to render plist: %w", err)
+	}
+	return b.Bytes(), nil
+}
+
+// DiffPlist compares the settings of two property lists. Arrays are
+// compared as a whole; property lists that cannot be parsed compare as
+// empty.
+func DiffPlist(old, new []byte) []Change {
+	oldValues := parsePlist(old)
+	newValues := parsePlist(new)
+
+	keys := make(map[string]struct{}, len(oldValues))
+	for key := range oldValues {
+		keys[key] = struct{}{}
+	}
+	for key := range newValues {
+		keys[key] = struct{}{}
+	}
+
+	changes := []Change{}
+	for key := range keys {
+		if oldValues[key] != newValues[key] {
+			changes = append(changes, Change{Key: key, Old: oldValues[key], New: newValues[key]})
+		}
+	}
+	sort.Slice(changes, func(i, j int) bool {
+		return changes[i].Key < changes[j].Key
+	})
+	return changes
+}
+
+// parsePlist flattens the dictionaries of a property list into dotted keys.
+// Values of arrays are joined by newlines.
+func parsePlist(data []byte) map[string]string {
+	values := make(map[string]string)
+	decoder := xml.NewDecoder(bytes.NewReader(data))
+	// Keys of the enclosing dicts, the current key and array
+	var path []string
+	key, array := "", ""
+	inArray := false
+	for {
+		token, err := decoder.Token()
+		if err != nil {
+			return values
+		}
+		start, ok := token.(xml.StartElement)
+		if !ok {
+			if end, ok := token.(xml.EndElement); ok {
+				switch end.Name.Local {
+				case "dict":
+					if len(path) > 0 {
+						path = path[:len(path)-1]
+					}
+				case "array":
+					if inArray {
+						values[array] = strings.TrimPrefix(values[array], "\n")
+						inArray = false
+					}
+				}
+			}
+			continue
+		}
+
+		switch start.Name.Local {
+		case "plist":
+		case "key":
+			var name string
+			if decoder.DecodeElement(&name, &start) != nil {
+				return values
+			}
+			key = strings.Join(append(append([]string{}, path...), name), ".")
+		case "dict":
+			if key != "" {
+				path = append(path, key[strings.LastIndex(key, ".")+1:])
+			}
+		case "array":
+			array, inArray = key, true
+			values[array] = ""
+		default:
+			var value string
+			if start.Name.Local == "true" || start.Name.Local == "false" {
+				value = start.Name.Local
+				decoder.Skip()
+			} else if decoder.DecodeElement(&value, &start) != nil {
+				return values
+			}
+			if inArray {
+				values[array] += "\n" + value
+			} else {
+				values[key] = value
+			}
+		}
+	}
+}
@@ -0,0 +1,57 @@
+package initsys
+
+import (
+	"testing"
+	"time"
+
+	"github.com/kpblcaoo/sboxagent/internal/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRenderPlist(t *testing.T) {
+	cfg := config.UnitConfig{
+		Label:       "io.github.kpblcaoo.sboxagent",
+		ExecStart:   []string{"{{.Binary}}", "-config", "{{.ConfigPath}}"},
+		Restart:     "on-failure",
+		RestartSec:  5 * time.Second,
+		LimitNOFILE: 65536,
+	}
+	plist, err := RenderPlist(cfg, config.UnitVars{
+		Binary:     "/usr/local/bin/sboxagent",
+		ConfigPath: "/Users/me/Library/Application Support/sboxagent/a&b.yaml",
+	}, "/Users/me/Library/Logs/sboxagent")
+	require.NoError(t, err)
+
+	assert.Equal(t, map[string]string{
+		"Label":                            "io.github.kpblcaoo.sboxagent",
+		"ProgramArguments":                 "/usr/local/bin/sboxagent\n-config\n/Users/me/Library/Application Support/sboxagent/a&b.yaml",
+		"RunAtLoad":                        "true",
+		"KeepAlive.SuccessfulExit":         "false",
+		"ThrottleInterval":                 "5",
+		"SoftResourceLimits.NumberOfFiles": "65536",
+		"StandardOutPath":                  "/Users/me/Library/Logs/sboxagent/sboxagent.log",
+		"StandardErrorPath":                "/Users/me/Library/Logs/sboxagent/sboxagent.log",
+		"ProcessType":                      "Background",
+	}, parsePlist(plist))
+	assert.Contains(t, string(plist), "a&amp;b.yaml")
+
+	_, err = RenderPlist(config.UnitConfig{ExecStart: []string{"sboxagent"}}, config.UnitVars{}, "")
+	assert.EqualError(t, err, "unit label is required for launchd")
+}
+
+func TestDiffPlist(t *testing.T) {
+	cfg := config.UnitConfig{Label: "sboxagent", ExecStart: []string{"/usr/local/bin/sboxagent"}, Restart: "always"}
+	old, err := RenderPlist(cfg, config.UnitVars{}, "/tmp")
+	require.NoError(t, err)
+	cfg.ExecStart = append(cfg.ExecStart, "-debug")
+	cfg.Restart = "no"
+	new, err := RenderPlist(cfg, config.UnitVars{}, "/tmp")
+	require.NoError(t, err)
+
+	assert.Equal(t, []Change{
+		{Key: "KeepAlive", Old: "true"},
+		{Key: "ProgramArguments", Old: "/usr/local/bin/sboxagent", New: "/usr/local/bin/sboxagent\n-debug"},
+	}, DiffPlist(old, new))
+	assert.Empty(t, DiffPlist(new, new))
+}
@@ -0,0 +1,10 @@
+//go:build !windows
+
+package initsys
+
+import "fmt"
+
+// openSCM fails where there is no service control manager
+func openSCM() (Manager, error) {
+	return nil, fmt.Errorf("the service control manager is only available on windows")
+}
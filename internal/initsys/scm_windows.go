@@ -0,0 +1,192 @@
+//go:build windows
+
+package initsys
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"golang.org/x/sys/windows"
+	"golang.org/x/sys/windows/svc"
+	"golang.org/x/sys/windows/svc/mgr"
+)
+
+// scmPollInterval is how often a stopping service is queried
+const scmPollInterval = 200 * time.Millisecond
+
+// scmManager manages Windows services through the service control manager
+type scmManager struct {
+	m *mgr.Mgr
+}
+
+// openSCM connects to the service control manager
+func openSCM() (Manager, error) {
+	m, err := mgr.Connect()
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to the service control manager: %w", err)
+	}
+	return &scmManager{m: m}, nil
+}
+
+func (s *scmManager) System() string {
+	return SystemWindows
+}
+
+func (s *scmManager) Backend() string {
+	return "scm"
+}
+
+// Name strips a systemd unit type like openrcManager.Name
+func (s *scmManager) Name(service string) string {
+	return strings.TrimSuffix(service, ".service")
+}
+
+// open opens a service, mapping unknown services to ErrNoSuchUnit
+func (s *scmManager) open(op, service string) (*mgr.Service, error) {
+	handle, err := s.m.OpenService(service)
+	if err != nil {
+		if errors.Is(err, windows.ERROR_SERVICE_DOES_NOT_EXIST) {
+			err = errors.Join(ErrNoSuchUnit, err)
+		}
+		return nil, &Error{Unit: service, Op: op, Err: err}
+	}
+	return handle, nil
+}
+
+func (s *scmManager) Start(ctx context.Context, service string) error {
+	service = s.Name(service)
+	handle, err := s.open("start", service)
+	if err != nil {
+		return err
+	}
+	defer handle.Close()
+	if err := handle.Start(); err != nil && !errors.Is(err, windows.ERROR_SERVICE_ALREADY_RUNNING) {
+		return &Error{Unit: service, Op: "start", Err: err}
+	}
+	return nil
+}
+
+// Stop asks the service to stop and waits until it has
+func (s *scmManager) Stop(ctx context.Context, service string) error {
+	service = s.Name(service)
+	handle, err := s.open("stop", service)
+	if err != nil {
+		return err
+	}
+	defer handle.Close()
+
+	status, err := handle.Control(svc.Stop)
+	if errors.Is(err, windows.ERROR_SERVICE_NOT_ACTIVE) {
+		return nil
+	}
+	if err != nil {
+		return &Error{Unit: service, Op: "stop", Err: err}
+	}
+	ticker := time.NewTicker(scmPollInterval)
+	defer ticker.Stop()
+	for status.State != svc.Stopped {
+		select {
+		case <-ctx.Done():
+			return &Error{Unit: service, Op: "stop", Err: ctx.Err()}
+		case <-ticker.C:
+		}
+		if status, err = handle.Query(); err != nil {
+			return &Error{Unit: service, Op: "stop", Err: err}
+		}
+	}
+	return nil
+}
+
+func (s *scmManager) Restart(ctx context.Context, service string) error {
+	if err := s.Stop(ctx, service); err != nil {
+		return err
+	}
+	return s.Start(ctx, service)
+}
+
+// Reload sends the service a parameter change
+func (s *scmManager) Reload(ctx context.Context, service string) error {
+	service = s.Name(service)
+	handle, err := s.open("reload", service)
+	if err != nil {
+		return err
+	}
+	defer handle.Close()
+	if _, err := handle.Control(svc.ParamChange); err != nil {
+		return &Error{Unit: service, Op: "reload", Err: err}
+	}
+	return nil
+}
+
+func (s *scmManager) Enable(ctx context.Context, service string) error {
+	return s.setStartType("enable", service, mgr.StartAutomatic)
+}
+
+func (s *scmManager) Disable(ctx context.Context, service string) error {
+	return s.setStartType("disable", service, mgr.StartManual)
+}
+
+// setStartType changes whether the service starts at boot
+func (s *scmManager) setStartType(op, service string, startType uint32) error {
+	service = s.Name(service)
+	handle, err := s.open(op, service)
+	if err != nil {
+		return err
+	}
+	defer handle.Close()
+	cfg, err := handle.Config()
+	if err != nil {
+		return &Error{Unit: service, Op: op, Err: err}
+	}
+	cfg.StartType = startType
+	if err := handle.UpdateConfig(cfg); err != nil {
+		return &Error{Unit: service, Op: op, Err: err}
+	}
+	return nil
+}
+
+// State maps the service status; stopped services that exited with an
+// error are failed
+func (s *scmManager) State(ctx context.Context, service string) (UnitState, error) {
+	service = s.Name(service)
+	state := UnitState{Unit: service}
+	handle, err := s.open("status", service)
+	if err != nil {
+		return state, err
+	}
+	defer handle.Close()
+	status, err := handle.Query()
+	if err != nil {
+		return state, &Error{Unit: service, Op: "status", Err: err}
+	}
+
+	switch status.State {
+	case svc.Running:
+		state.ActiveState, state.SubState = "active", "running"
+	case svc.Paused, svc.PausePending, svc.ContinuePending:
+		state.ActiveState, state.SubState = "active", "paused"
+	case svc.StartPending:
+		state.ActiveState, state.SubState = "activating", "starting"
+	case svc.StopPending:
+		state.ActiveState, state.SubState = "deactivating", "stopping"
+	default:
+		exitCode := status.Win32ExitCode
+		if status.ServiceSpecificExitCode != 0 || (exitCode != 0 && exitCode != uint32(windows.ERROR_SERVICE_NEVER_STARTED)) {
+			state.ActiveState, state.SubState = "failed", "exited"
+		} else {
+			state.ActiveState, state.SubState = "inactive", "dead"
+		}
+	}
+	return state, nil
+}
+
+func (s *scmManager) Watch(ctx context.Context, services []string, changed func(UnitState)) error {
+	return ErrWatchUnsupported
+}
+
+func (s *scmManager) Close() {
+	s.m.Disconnect()
+}
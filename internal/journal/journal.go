@@ -0,0 +1,182 @@
+// Package journal follows the systemd journal of client units by running
+// journalctl, so no cgo binding to libsystemd is needed.
+package journal
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os/exec"
+	"strconv"
+	"time"
+
+	"github.com/kpblcaoo/sboxagent/internal/logger"
+	"github.com/kpblcaoo/sboxagent/internal/process"
+	"github.com/kpblcaoo/sboxagent/internal/systemd"
+)
+
+// Entry is one journal entry of a followed unit
+type Entry struct {
+	Time     time.Time
+	Unit     string
+	Priority int
+	Message  string
+	PID      int
+}
+
+// Level maps the syslog priority of the entry to a log level
+func (e Entry) Level() string {
+	switch {
+	case e.Priority <= 3:
+		return "error"
+	case e.Priority == 4:
+		return "warn"
+	case e.Priority == 7:
+		return "debug"
+	default:
+		return "info"
+	}
+}
+
+// Reader follows the journal of a set of units
+type Reader struct {
+	units        []string
+	userMode     bool
+	restartDelay time.Duration
+	env          []string
+	logger       *logger.Logger
+}
+
+// NewReader creates a reader of the units of the system journal, or of the
+// user journal in userMode. journalctl is started again restartDelay after
+// it exits.
+func NewReader(units []string, userMode bool, restartDelay time.Duration, log *logger.Logger) *Reader {
+	names := make([]string, len(units))
+	for i, unit := range units {
+		names[i] = systemd.UnitName(unit)
+	}
+	return &Reader{units: names, userMode: userMode, restartDelay: restartDelay, logger: log}
+}
+
+// SetEnv sets the environment journalctl runs with
+func (r *Reader) SetEnv(env []string) {
+	r.env = env
+}
+
+// Command returns the journalctl command line following the units from
+// now on
+func (r *Reader) Command() []string {
+	command := []string{"journalctl"}
+	if r.userMode {
+		command = append(command, "--user")
+	}
+	command = append(command, "--follow", "--lines=0", "--output=json")
+	for _, unit := range r.units {
+		command = append(command, "--unit="+unit)
+	}
+	return command
+}
+
+// Run passes each new entry to handle until ctx is done
+func (r *Reader) Run(ctx context.Context, handle func(Entry)) {
+	for {
+		if err := r.follow(ctx, handle); err != nil && ctx.Err() == nil {
+			r.logger.Warn("Journal reader stopped, restarting", map[string]interface{}{
+				"error": err.Error(),
+				"delay": r.restartDelay.String(),
+			})
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(r.restartDelay):
+		}
+	}
+}
+
+// follow runs journalctl once
+func (r *Reader) follow(ctx context.Context, handle func(Entry)) error {
+	command := r.Command()
+	cmd := exec.CommandContext(ctx, command[0], command[1:]...)
+	cmd.Env = r.env
+	process.Prepare(cmd)
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return fmt.Errorf("failed to open journalctl stdout: %w", err)
+	}
+	if err := process.Start(cmd); err != nil {
+		return fmt.Errorf("failed to start journalctl: %w", err)
+	}
+
+	reader := bufio.NewReader(stdout)
+	for {
+		line, err := reader.ReadBytes('\n')
+		if len(line) > 0 {
+			if entry, err := ParseEntry(line); err == nil {
+				handle(entry)
+			} else {
+				r.logger.Debug("Ignoring journal line", map[string]interface{}{
+					"error": err.Error(),
+				})
+			}
+		}
+		if err != nil {
+			break
+		}
+	}
+	if err := process.Wait(cmd); err != nil {
+		return err
+	}
+	return fmt.Errorf("journalctl exited")
+}
+
+// ParseEntry parses an entry of journalctl --output=json
+func ParseEntry(line []byte) (Entry, error) {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(line, &fields); err != nil {
+		return Entry{}, fmt.Errorf("invalid journal entry: %w", err)
+	}
+
+	entry := Entry{
+		Unit:     field(fields, "_SYSTEMD_UNIT"),
+		Message:  field(fields, "MESSAGE"),
+		Priority: 6,
+	}
+	if unit := field(fields, "_SYSTEMD_USER_UNIT"); unit != "" {
+		entry.Unit = unit
+	}
+	if priority, err := strconv.Atoi(field(fields, "PRIORITY")); err == nil {
+		entry.Priority = priority
+	}
+	if pid, err := strconv.Atoi(field(fields, "_PID")); err == nil {
+		entry.PID = pid
+	}
+	if usec, err := strconv.ParseInt(field(fields, "__REALTIME_TIMESTAMP"), 10, 64); err == nil {
+		entry.Time = time.UnixMicro(usec)
+	} else {
+		entry.Time = time.Now()
+	}
+	return entry, nil
+}
+
+// field returns a journal field as a string. journalctl writes fields that
+// are not valid UTF-8 as arrays of bytes.
+func field(fields map[string]json.RawMessage, name string) string {
+	raw, ok := fields[name]
+	if !ok {
+		return ""
+	}
+	var value string
+	if err := json.Unmarshal(raw, &value); err == nil {
+		return value
+	}
+	var bytes []byte
+	var numbers []int
+	if err := json.Unmarshal(raw, &numbers); err == nil {
+		for _, n := range numbers {
+			bytes = append(bytes, byte(n))
+		}
+	}
+	return string(bytes)
+}
@@ -0,0 +1,68 @@
+package journal
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/kpblcaoo/sboxagent/internal/logger"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseEntry(t *testing.T) {
+	entry, err := ParseEntry([]byte(`{"__REALTIME_TIMESTAMP":"1700000000000000","_SYSTEMD_UNIT":"sing-box.service","PRIORITY":"3","MESSAGE":"dial tcp: timeout","_PID":"42"}`))
+	require.NoError(t, err)
+	assert.Equal(t, "sing-box.service", entry.Unit)
+	assert.Equal(t, "dial tcp: timeout", entry.Message)
+	assert.Equal(t, "error", entry.Level())
+	assert.Equal(t, 42, entry.PID)
+	assert.True(t, entry.Time.Equal(time.Unix(1700000000, 0)))
+
+	// Messages that are not valid UTF-8 are arrays of bytes
+	entry, err = ParseEntry([]byte(`{"_SYSTEMD_USER_UNIT":"xray.service","PRIORITY":"4","MESSAGE":[104,105]}`))
+	require.NoError(t, err)
+	assert.Equal(t, "xray.service", entry.Unit)
+	assert.Equal(t, "hi", entry.Message)
+	assert.Equal(t, "warn", entry.Level())
+
+	_, err = ParseEntry([]byte("-- No entries --"))
+	assert.Error(t, err)
+}
+
+func TestReader(t *testing.T) {
+	log, err := logger.New("error")
+	require.NoError(t, err)
+
+	reader := NewReader([]string{"sing-box", "clash.service"}, true, time.Hour, log)
+	assert.Equal(t, []string{
+		"journalctl", "--user", "--follow", "--lines=0", "--output=json",
+		"--unit=sing-box.service", "--unit=clash.service",
+	}, reader.Command())
+
+	// A fake journalctl writes one entry and exits
+	dir := t.TempDir()
+	script := "#!/bin/sh\necho '{\"_SYSTEMD_UNIT\":\"sing-box.service\",\"MESSAGE\":\"started\"}'\n"
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "journalctl"), []byte(script), 0755))
+	t.Setenv("PATH", dir+string(os.PathListSeparator)+os.Getenv("PATH"))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	entries := make(chan Entry, 1)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		reader.Run(ctx, func(entry Entry) { entries <- entry })
+	}()
+
+	select {
+	case entry := <-entries:
+		assert.Equal(t, "started", entry.Message)
+		assert.Equal(t, "info", entry.Level())
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected a journal entry")
+	}
+	cancel()
+	<-done
+}
@@ -5,6 +5,7 @@ import (
 	"log"
 	"os"
 	"strings"
+	"sync"
 	"time"
 )
 
@@ -50,6 +51,9 @@ func ParseLogLevel(level string) (LogLevel, error) {
 	}
 }
 
+// Hook receives every message the logger emits
+type Hook func(level LogLevel, message string, fields map[string]interface{})
+
 // Logger represents a structured logger
 type Logger struct {
 	level LogLevel
@@ -57,6 +61,13 @@ type Logger struct {
 	info  *log.Logger
 	warn  *log.Logger
 	error *log.Logger
+
+	hooksMu sync.RWMutex
+	hooks   []Hook
+
+	// fields are added to every message unless the caller sets the same key
+	fieldsMu sync.RWMutex
+	fields   map[string]interface{}
 }
 
 // New creates a new logger instance
@@ -78,28 +89,36 @@ func New(level string) (*Logger, error) {
 // Debug logs a debug message
 func (l *Logger) Debug(message string, fields map[string]interface{}) {
 	if l.level <= DebugLevel {
+		fields = l.withFields(fields)
 		l.log(l.debug, "DEBUG", message, fields)
+		l.fireHooks(DebugLevel, message, fields)
 	}
 }
 
 // Info logs an info message
 func (l *Logger) Info(message string, fields map[string]interface{}) {
 	if l.level <= InfoLevel {
+		fields = l.withFields(fields)
 		l.log(l.info, "INFO", message, fields)
+		l.fireHooks(InfoLevel, message, fields)
 	}
 }
 
 // Warn logs a warning message
 func (l *Logger) Warn(message string, fields map[string]interface{}) {
 	if l.level <= WarnLevel {
+		fields = l.withFields(fields)
 		l.log(l.warn, "WARN", message, fields)
+		l.fireHooks(WarnLevel, message, fields)
 	}
 }
 
 // Error logs an error message
 func (l *Logger) Error(message string, fields map[string]interface{}) {
 	if l.level <= ErrorLevel {
+		fields = l.withFields(fields)
 		l.log(l.error, "ERROR", message, fields)
+		l.fireHooks(ErrorLevel, message, fields)
 	}
 }
 
@@ -122,6 +141,52 @@ func (l *Logger) log(logger *log.Logger, level, message string, fields map[strin
 	logger.Println(entry)
 }
 
+// SetFields sets fields added to every message, such as telemetry labels.
+// Fields passed with a message take precedence.
+func (l *Logger) SetFields(fields map[string]interface{}) {
+	l.fieldsMu.Lock()
+	defer l.fieldsMu.Unlock()
+	l.fields = fields
+}
+
+// withFields merges the logger's fields into the fields of a message
+func (l *Logger) withFields(fields map[string]interface{}) map[string]interface{} {
+	l.fieldsMu.RLock()
+	defaults := l.fields
+	l.fieldsMu.RUnlock()
+
+	if len(defaults) == 0 {
+		return fields
+	}
+	merged := make(map[string]interface{}, len(defaults)+len(fields))
+	for key, value := range defaults {
+		merged[key] = value
+	}
+	for key, value := range fields {
+		merged[key] = value
+	}
+	return merged
+}
+
+// AddHook registers a hook called for every emitted message. Hooks must not
+// log through the same logger at a level that would call them again.
+func (l *Logger) AddHook(hook Hook) {
+	l.hooksMu.Lock()
+	defer l.hooksMu.Unlock()
+	l.hooks = append(l.hooks, hook)
+}
+
+// fireHooks passes an emitted message to the registered hooks
+func (l *Logger) fireHooks(level LogLevel, message string, fields map[string]interface{}) {
+	l.hooksMu.RLock()
+	hooks := l.hooks
+	l.hooksMu.RUnlock()
+
+	for _, hook := range hooks {
+		hook(level, message, fields)
+	}
+}
+
 // SetLevel sets the logging level
 func (l *Logger) SetLevel(level LogLevel) {
 	l.level = level
@@ -0,0 +1,33 @@
+package logger
+
+import (
+	"io"
+	"log"
+	"testing"
+)
+
+func BenchmarkLogger_Info(b *testing.B) {
+	logger, err := New("info")
+	if err != nil {
+		b.Fatal(err)
+	}
+	logger.info = log.New(io.Discard, "[INFO] ", log.LstdFlags)
+	fields := map[string]interface{}{"client": "sing-box", "attempt": 1}
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		logger.Info("Imported config", fields)
+	}
+}
+
+func BenchmarkLogger_Filtered(b *testing.B) {
+	logger, err := New("error")
+	if err != nil {
+		b.Fatal(err)
+	}
+	fields := map[string]interface{}{"client": "sing-box"}
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		logger.Debug("Skipped message", fields)
+	}
+}
@@ -152,4 +152,42 @@ func TestLogger_WithNilLogger(t *testing.T) {
 	logger.Info("info", nil)
 	logger.Warn("warn", nil)
 	logger.Error("error", nil)
-} 
\ No newline at end of file
+} 
+
+func TestLogger_AddHook(t *testing.T) {
+	logger, err := New("warn")
+	require.NoError(t, err)
+
+	var levels []LogLevel
+	var messages []string
+	logger.AddHook(func(level LogLevel, message string, fields map[string]interface{}) {
+		levels = append(levels, level)
+		messages = append(messages, message)
+	})
+
+	// Only messages that pass the level filter reach hooks
+	logger.Info("info", nil)
+	logger.Warn("warn", nil)
+	logger.Error("error", map[string]interface{}{"key": "value"})
+
+	assert.Equal(t, []LogLevel{WarnLevel, ErrorLevel}, levels)
+	assert.Equal(t, []string{"warn", "error"}, messages)
+}
+
+func TestLogger_SetFields(t *testing.T) {
+	logger, err := New("info")
+	require.NoError(t, err)
+
+	var received []map[string]interface{}
+	logger.AddHook(func(level LogLevel, message string, fields map[string]interface{}) {
+		received = append(received, fields)
+	})
+
+	logger.SetFields(map[string]interface{}{"agent_id": "edge-1", "profile": "home"})
+	logger.Info("labelled", map[string]interface{}{"profile": "override"})
+	logger.Info("defaults only", nil)
+
+	require.Len(t, received, 2)
+	assert.Equal(t, map[string]interface{}{"agent_id": "edge-1", "profile": "override"}, received[0])
+	assert.Equal(t, map[string]interface{}{"agent_id": "edge-1", "profile": "home"}, received[1])
+}
@@ -0,0 +1,273 @@
+// Package lsm detects the SELinux and AppArmor security modules and checks
+// that the files the agent and its clients use are labelled and profiled
+// so that they can be used, turning denials into actionable warnings
+package lsm
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// root is prepended to the kernel interfaces read, for tests
+var root = "/"
+
+// label returns the SELinux context of a path
+var label = selinuxLabel
+
+// Kinds of checked paths
+const (
+	KindSocket = "socket"
+	KindConfig = "config"
+	KindBinary = "binary"
+	KindAgent  = "agent"
+)
+
+// Target is a path the agent or a client needs
+type Target struct {
+	Kind string
+	// Client names the client of config and binary targets
+	Client string
+	Path   string
+}
+
+// Finding is a target a security module is likely to deny, with the
+// command that fixes it
+type Finding struct {
+	Kind    string `json:"kind"`
+	Client  string `json:"client,omitempty"`
+	Path    string `json:"path"`
+	Module  string `json:"module"`
+	Context string `json:"context,omitempty"`
+	Problem string `json:"problem"`
+	Hint    string `json:"hint"`
+}
+
+// String describes the finding on one line
+func (f Finding) String() string {
+	return fmt.Sprintf("%s %s: %s (%s)", f.Kind, f.Path, f.Problem, f.Hint)
+}
+
+// Status is the state of the security modules and the findings of the
+// last check
+type Status struct {
+	// SELinux is "enforcing" or "permissive", empty when disabled
+	SELinux string `json:"selinux,omitempty"`
+	// AppArmor is "enabled", empty when disabled
+	AppArmor string `json:"apparmor,omitempty"`
+	// Confinement is the agent's own SELinux context or AppArmor profile
+	Confinement string    `json:"confinement,omitempty"`
+	Findings    []Finding `json:"findings,omitempty"`
+}
+
+// Active tells whether a security module may deny access
+func (s Status) Active() bool {
+	return s.SELinux == "enforcing" || s.AppArmor != ""
+}
+
+// Detect reports which security modules are enabled and how the agent is
+// confined
+func Detect() Status {
+	var status Status
+	if enforce, err := readFile("sys/fs/selinux/enforce"); err == nil {
+		if enforce == "1" {
+			status.SELinux = "enforcing"
+		} else {
+			status.SELinux = "permissive"
+		}
+	}
+	if enabled, err := readFile("sys/module/apparmor/parameters/enabled"); err == nil && enabled == "Y" {
+		status.AppArmor = "enabled"
+	}
+	if status.SELinux != "" || status.AppArmor != "" {
+		if current, err := readFile("proc/self/attr/current"); err == nil {
+			status.Confinement = strings.TrimRight(current, "\x00")
+		}
+	}
+	return status
+}
+
+// Check detects the security modules and checks the targets against them
+func Check(targets []Target) Status {
+	status := Detect()
+	if !status.Active() {
+		return status
+	}
+	if status.SELinux == "enforcing" {
+		for _, target := range targets {
+			if finding, ok := checkSELinux(target); ok {
+				status.Findings = append(status.Findings, finding)
+			}
+		}
+	}
+	if status.AppArmor != "" {
+		status.Findings = append(status.Findings, checkAppArmor(status.Confinement, targets)...)
+	}
+	return status
+}
+
+// deniedTypes are SELinux file types system services are usually denied,
+// typically left by files created in a home or temporary directory and
+// moved into place
+var deniedTypes = map[string]bool{
+	"default_t":    true,
+	"unlabeled_t":  true,
+	"user_home_t":  true,
+	"admin_home_t": true,
+	"user_tmp_t":   true,
+	"tmp_t":        true,
+}
+
+// expectedTypes are the SELinux file types to label targets with
+var expectedTypes = map[string]string{
+	KindSocket: "var_run_t",
+	KindConfig: "etc_t",
+	KindBinary: "bin_t",
+}
+
+// checkSELinux checks the label of a target, or of its directory for
+// sockets and configs, which may not exist yet
+func checkSELinux(target Target) (Finding, bool) {
+	path := target.Path
+	if target.Kind == KindSocket || target.Kind == KindConfig {
+		path = filepath.Dir(path)
+	}
+	context, err := label(path)
+	if err != nil || context == "" {
+		return Finding{}, false
+	}
+	fields := strings.Split(context, ":")
+	if len(fields) < 3 || !deniedTypes[fields[2]] {
+		return Finding{}, false
+	}
+	hint := "restorecon -Rv " + path
+	if expected, ok := expectedTypes[target.Kind]; ok {
+		hint = fmt.Sprintf("semanage fcontext -a -t %s '%s(/.*)?' && %s", expected, path, hint)
+	}
+	return Finding{
+		Kind:    target.Kind,
+		Client:  target.Client,
+		Path:    path,
+		Module:  "selinux",
+		Context: context,
+		Problem: fmt.Sprintf("labelled %s, which system services are usually denied", fields[2]),
+		Hint:    hint,
+	}, true
+}
+
+// checkAppArmor reports an agent confined by an enforcing profile, whose
+// profile must allow the socket and configs, and client binaries confined
+// by one, whose profiles must allow their configs
+func checkAppArmor(confinement string, targets []Target) []Finding {
+	var findings []Finding
+	if name, mode := parseProfile(confinement); mode == "enforce" {
+		var paths []string
+		for _, target := range targets {
+			if target.Kind == KindSocket || target.Kind == KindConfig {
+				paths = append(paths, target.Path)
+			}
+		}
+		findings = append(findings, Finding{
+			Kind:    KindAgent,
+			Path:    strings.Join(paths, ", "),
+			Module:  "apparmor",
+			Context: name,
+			Problem: fmt.Sprintf("agent confined by profile %s, which must allow these paths", name),
+			Hint:    fmt.Sprintf("add rules to /etc/apparmor.d/local/%s or aa-complain %s", filepath.Base(name), name),
+		})
+	}
+
+	profiles := loadedProfiles()
+	configs := make(map[string]string)
+	for _, target := range targets {
+		if target.Kind == KindConfig {
+			configs[target.Client] = target.Path
+		}
+	}
+	for _, target := range targets {
+		if target.Kind != KindBinary {
+			continue
+		}
+		name := target.Path
+		mode, ok := profiles[name]
+		if !ok {
+			name = filepath.Base(target.Path)
+			mode, ok = profiles[name]
+		}
+		if !ok || mode != "enforce" {
+			continue
+		}
+		problem := fmt.Sprintf("confined by profile %s", name)
+		if config := configs[target.Client]; config != "" {
+			problem += ", which must allow reading " + config
+		}
+		findings = append(findings, Finding{
+			Kind:    KindBinary,
+			Client:  target.Client,
+			Path:    target.Path,
+			Module:  "apparmor",
+			Context: name,
+			Problem: problem,
+			Hint:    fmt.Sprintf("add rules to /etc/apparmor.d/local/%s or aa-complain %s", filepath.Base(name), name),
+		})
+	}
+	return findings
+}
+
+// loadedProfiles returns the mode of each loaded AppArmor profile by name
+func loadedProfiles() map[string]string {
+	profiles := make(map[string]string)
+	data, err := readFile("sys/kernel/security/apparmor/profiles")
+	if err != nil {
+		return profiles
+	}
+	for _, line := range strings.Split(data, "\n") {
+		if name, mode := parseProfile(line); name != "" {
+			profiles[name] = mode
+		}
+	}
+	return profiles
+}
+
+// parseProfile splits "name (mode)"
+func parseProfile(line string) (string, string) {
+	line = strings.TrimSpace(line)
+	name, mode, ok := strings.Cut(line, " (")
+	if !ok {
+		return line, ""
+	}
+	return name, strings.TrimSuffix(mode, ")")
+}
+
+// readFile reads a kernel interface file below root
+func readFile(path string) (string, error) {
+	data, err := os.ReadFile(filepath.Join(root, path))
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(data)), nil
+}
+
+// Explain adds a hint to permission errors while a security module may
+// deny access, since the error itself does not tell a denial by the
+// module from one by file permissions
+func Explain(err error) error {
+	if err == nil || !errors.Is(err, fs.ErrPermission) {
+		return err
+	}
+	status := Detect()
+	var modules []string
+	if status.SELinux == "enforcing" {
+		modules = append(modules, "SELinux (ausearch -m avc -ts recent)")
+	}
+	if status.AppArmor != "" {
+		modules = append(modules, "AppArmor (journalctl -k -g apparmor=\"DENIED\")")
+	}
+	if len(modules) == 0 {
+		return err
+	}
+	return fmt.Errorf("%w; access may have been denied by %s", err, strings.Join(modules, " or "))
+}
@@ -0,0 +1,17 @@
+package lsm
+
+import (
+	"strings"
+
+	"golang.org/x/sys/unix"
+)
+
+// selinuxLabel reads the security.selinux attribute of a path
+func selinuxLabel(path string) (string, error) {
+	buf := make([]byte, 256)
+	n, err := unix.Getxattr(path, "security.selinux", buf)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimRight(string(buf[:n]), "\x00"), nil
+}
@@ -0,0 +1,8 @@
+//go:build !linux
+
+package lsm
+
+// selinuxLabel returns no label, SELinux is Linux only
+func selinuxLabel(path string) (string, error) {
+	return "", nil
+}
@@ -0,0 +1,100 @@
+package lsm
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeRoot points the kernel interfaces at a temporary directory with
+// files, and SELinux labels at labels
+func fakeRoot(t *testing.T, files map[string]string, labels map[string]string) {
+	t.Helper()
+	dir := t.TempDir()
+	for path, content := range files {
+		full := filepath.Join(dir, path)
+		require.NoError(t, os.MkdirAll(filepath.Dir(full), 0755))
+		require.NoError(t, os.WriteFile(full, []byte(content), 0644))
+	}
+	originalRoot, originalLabel := root, label
+	root = dir
+	label = func(path string) (string, error) {
+		return labels[path], nil
+	}
+	t.Cleanup(func() {
+		root, label = originalRoot, originalLabel
+	})
+}
+
+func TestCheck_Disabled(t *testing.T) {
+	fakeRoot(t, nil, nil)
+
+	status := Check([]Target{{Kind: KindConfig, Path: "/etc/sing-box/config.json"}})
+	assert.False(t, status.Active())
+	assert.Empty(t, status.Findings)
+}
+
+func TestCheck_SELinux(t *testing.T) {
+	fakeRoot(t, map[string]string{
+		"sys/fs/selinux/enforce": "1",
+		"proc/self/attr/current": "system_u:system_r:unconfined_service_t:s0\x00",
+	}, map[string]string{
+		"/etc/sing-box":           "unconfined_u:object_r:user_home_t:s0",
+		"/run/sboxagent":          "system_u:object_r:var_run_t:s0",
+		"/usr/local/bin/sing-box": "system_u:object_r:bin_t:s0",
+	})
+
+	status := Check([]Target{
+		{Kind: KindSocket, Path: "/run/sboxagent/agent.sock"},
+		{Kind: KindConfig, Client: "sing-box", Path: "/etc/sing-box/config.json"},
+		{Kind: KindBinary, Client: "sing-box", Path: "/usr/local/bin/sing-box"},
+	})
+	assert.Equal(t, "enforcing", status.SELinux)
+	assert.Equal(t, "system_u:system_r:unconfined_service_t:s0", status.Confinement)
+	require.Len(t, status.Findings, 1)
+	finding := status.Findings[0]
+	assert.Equal(t, "/etc/sing-box", finding.Path)
+	assert.Equal(t, "sing-box", finding.Client)
+	assert.Equal(t, "labelled user_home_t, which system services are usually denied", finding.Problem)
+	assert.Equal(t, "semanage fcontext -a -t etc_t '/etc/sing-box(/.*)?' && restorecon -Rv /etc/sing-box", finding.Hint)
+}
+
+func TestCheck_AppArmor(t *testing.T) {
+	fakeRoot(t, map[string]string{
+		"sys/module/apparmor/parameters/enabled": "Y",
+		"proc/self/attr/current":                 "sboxagent (enforce)",
+		"sys/kernel/security/apparmor/profiles":  "/usr/bin/xray (complain)\nsing-box (enforce)\n",
+	}, nil)
+
+	status := Check([]Target{
+		{Kind: KindSocket, Path: "/run/sboxagent/agent.sock"},
+		{Kind: KindConfig, Client: "sing-box", Path: "/etc/sing-box/config.json"},
+		{Kind: KindBinary, Client: "sing-box", Path: "/usr/bin/sing-box"},
+		{Kind: KindBinary, Client: "xray", Path: "/usr/bin/xray"},
+	})
+	assert.Equal(t, "enabled", status.AppArmor)
+	require.Len(t, status.Findings, 2)
+	assert.Equal(t, KindAgent, status.Findings[0].Kind)
+	assert.Equal(t, "/run/sboxagent/agent.sock, /etc/sing-box/config.json", status.Findings[0].Path)
+	assert.Equal(t, "add rules to /etc/apparmor.d/local/sboxagent or aa-complain sboxagent", status.Findings[0].Hint)
+	assert.Equal(t, "confined by profile sing-box, which must allow reading /etc/sing-box/config.json", status.Findings[1].Problem)
+}
+
+func TestExplain(t *testing.T) {
+	denied := fmt.Errorf("failed to write: %w", fs.ErrPermission)
+
+	fakeRoot(t, nil, nil)
+	assert.Equal(t, denied, Explain(denied))
+
+	fakeRoot(t, map[string]string{"sys/fs/selinux/enforce": "1"}, nil)
+	err := Explain(denied)
+	assert.ErrorIs(t, err, fs.ErrPermission)
+	assert.ErrorContains(t, err, "access may have been denied by SELinux (ausearch -m avc -ts recent)")
+	assert.NoError(t, Explain(nil))
+	assert.Equal(t, fs.ErrNotExist, Explain(fs.ErrNotExist))
+}
@@ -0,0 +1,192 @@
+// Package netloc detects the network the host is on and matches it against
+// location rules, so the agent can switch profiles when the host moves.
+package netloc
+
+import (
+	"bufio"
+	"context"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+
+	"github.com/kpblcaoo/sboxagent/internal/config"
+	"github.com/kpblcaoo/sboxagent/internal/process"
+)
+
+// Network describes the network the host is connected to
+type Network struct {
+	SSID       string   `json:"ssid,omitempty"`
+	Gateway    string   `json:"gateway,omitempty"`
+	GatewayMAC string   `json:"gatewayMac,omitempty"`
+	Addrs      []string `json:"addrs,omitempty"`
+}
+
+// Detector gathers the current network. Sources that are unavailable, such
+// as an SSID on a wired host, are left empty.
+type Detector struct {
+	// RoutePath and ARPPath are the kernel route and neighbour tables
+	RoutePath string
+	ARPPath   string
+	// SSIDCommand prints the SSID of the connected wireless network
+	SSIDCommand []string
+	// Addrs lists the host's interface addresses
+	Addrs func() ([]net.Addr, error)
+}
+
+// NewDetector returns a detector reading the Linux /proc tables
+func NewDetector() *Detector {
+	return &Detector{
+		RoutePath:   "/proc/net/route",
+		ARPPath:     "/proc/net/arp",
+		SSIDCommand: []string{"iwgetid", "-r"},
+		Addrs:       net.InterfaceAddrs,
+	}
+}
+
+// ssidTimeout bounds the SSID command
+const ssidTimeout = 5 * time.Second
+
+// Detect returns the current network
+func (d *Detector) Detect(ctx context.Context) (Network, error) {
+	var network Network
+
+	addrs, err := d.Addrs()
+	if err != nil {
+		return network, fmt.Errorf("failed to list interface addresses: %w", err)
+	}
+	for _, addr := range addrs {
+		if ipNet, ok := addr.(*net.IPNet); ok && !ipNet.IP.IsLoopback() {
+			network.Addrs = append(network.Addrs, ipNet.IP.String())
+		}
+	}
+
+	if f, err := os.Open(d.RoutePath); err == nil {
+		network.Gateway = defaultGateway(f)
+		f.Close()
+	}
+	if network.Gateway != "" {
+		if f, err := os.Open(d.ARPPath); err == nil {
+			network.GatewayMAC = neighbourMAC(f, network.Gateway)
+			f.Close()
+		}
+	}
+
+	if len(d.SSIDCommand) > 0 {
+		ctx, cancel := context.WithTimeout(ctx, ssidTimeout)
+		defer cancel()
+		var out strings.Builder
+		cmd := exec.CommandContext(ctx, d.SSIDCommand[0], d.SSIDCommand[1:]...)
+		cmd.Stdout = &out
+		process.Prepare(cmd)
+		if err := process.Start(cmd); err == nil && process.Wait(cmd) == nil {
+			network.SSID = strings.TrimSpace(out.String())
+		}
+	}
+	return network, nil
+}
+
+// defaultGateway returns the gateway of the default route in a
+// /proc/net/route table, or an empty string
+func defaultGateway(r io.Reader) string {
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		// Iface Destination Gateway ...; addresses are little-endian hex
+		if len(fields) < 3 || fields[1] != "00000000" {
+			continue
+		}
+		raw, err := hex.DecodeString(fields[2])
+		if err != nil || len(raw) != 4 {
+			continue
+		}
+		return net.IPv4(raw[3], raw[2], raw[1], raw[0]).String()
+	}
+	return ""
+}
+
+// neighbourMAC returns the hardware address of ip in a /proc/net/arp table,
+// or an empty string
+func neighbourMAC(r io.Reader, ip string) string {
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		// IP HWtype Flags HWaddress Mask Device
+		fields := strings.Fields(scanner.Text())
+		if len(fields) >= 4 && fields[0] == ip {
+			return strings.ToLower(fields[3])
+		}
+	}
+	return ""
+}
+
+// Match returns the profile of the first rule matching the network, or
+// false if none does
+func Match(rules []config.LocationRule, network Network) (string, bool) {
+	for _, rule := range rules {
+		if matches(rule, network) {
+			return rule.Profile, true
+		}
+	}
+	return "", false
+}
+
+// matches reports whether every criterion set on the rule matches
+func matches(rule config.LocationRule, network Network) bool {
+	if len(rule.SSIDs) > 0 && !contains(rule.SSIDs, network.SSID) {
+		return false
+	}
+	if len(rule.GatewayMACs) > 0 && !matchesMAC(rule.GatewayMACs, network.GatewayMAC) {
+		return false
+	}
+	if len(rule.Subnets) > 0 && !inSubnets(rule.Subnets, network.Addrs) {
+		return false
+	}
+	return true
+}
+
+// contains reports whether values holds a non-empty value
+func contains(values []string, value string) bool {
+	if value == "" {
+		return false
+	}
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// matchesMAC compares hardware addresses regardless of notation
+func matchesMAC(macs []string, mac string) bool {
+	hw, err := net.ParseMAC(mac)
+	if err != nil {
+		return false
+	}
+	for _, candidate := range macs {
+		if other, err := net.ParseMAC(candidate); err == nil && other.String() == hw.String() {
+			return true
+		}
+	}
+	return false
+}
+
+// inSubnets reports whether any address lies in any of the subnets
+func inSubnets(subnets []string, addrs []string) bool {
+	for _, subnet := range subnets {
+		_, ipNet, err := net.ParseCIDR(subnet)
+		if err != nil {
+			continue
+		}
+		for _, addr := range addrs {
+			if ip := net.ParseIP(addr); ip != nil && ipNet.Contains(ip) {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,93 @@
+package netloc
+
+import (
+	"context"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/kpblcaoo/sboxagent/internal/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const routeTable = `Iface	Destination	Gateway 	Flags	RefCnt	Use	Metric	Mask		MTU	Window	IRTT
+wlan0	0001A8C0	00000000	0001	0	0	600	00FFFFFF	0	0	0
+wlan0	00000000	0101A8C0	0003	0	0	600	00000000	0	0	0
+`
+
+const arpTable = `IP address       HW type     Flags       HW address            Mask     Device
+192.168.1.1      0x1         0x2         AA:BB:CC:00:11:22     *        wlan0
+`
+
+func TestDetector_Detect(t *testing.T) {
+	dir := t.TempDir()
+	routePath := filepath.Join(dir, "route")
+	arpPath := filepath.Join(dir, "arp")
+	require.NoError(t, os.WriteFile(routePath, []byte(routeTable), 0644))
+	require.NoError(t, os.WriteFile(arpPath, []byte(arpTable), 0644))
+
+	detector := &Detector{
+		RoutePath:   routePath,
+		ARPPath:     arpPath,
+		SSIDCommand: []string{"echo", "HomeWiFi"},
+		Addrs: func() ([]net.Addr, error) {
+			return []net.Addr{
+				&net.IPNet{IP: net.ParseIP("127.0.0.1"), Mask: net.CIDRMask(8, 32)},
+				&net.IPNet{IP: net.ParseIP("192.168.1.23"), Mask: net.CIDRMask(24, 32)},
+			}, nil
+		},
+	}
+
+	network, err := detector.Detect(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, Network{
+		SSID:       "HomeWiFi",
+		Gateway:    "192.168.1.1",
+		GatewayMAC: "aa:bb:cc:00:11:22",
+		Addrs:      []string{"192.168.1.23"},
+	}, network)
+
+	// Missing tables and SSID tools leave fields empty
+	detector.RoutePath = filepath.Join(dir, "missing")
+	detector.SSIDCommand = []string{"false"}
+	network, err = detector.Detect(context.Background())
+	require.NoError(t, err)
+	assert.Empty(t, network.Gateway)
+	assert.Empty(t, network.SSID)
+}
+
+func TestDefaultGateway(t *testing.T) {
+	assert.Equal(t, "192.168.1.1", defaultGateway(strings.NewReader(routeTable)))
+	assert.Equal(t, "", defaultGateway(strings.NewReader("Iface\tDestination\tGateway\n")))
+}
+
+func TestMatch(t *testing.T) {
+	rules := []config.LocationRule{
+		{Profile: "office", SSIDs: []string{"Corp"}, Subnets: []string{"10.0.0.0/8"}},
+		{Profile: "home", GatewayMACs: []string{"aa-bb-cc-00-11-22"}},
+		{Profile: "lan", Subnets: []string{"192.168.0.0/16"}},
+	}
+
+	tests := []struct {
+		name    string
+		network Network
+		profile string
+		matched bool
+	}{
+		{"all criteria", Network{SSID: "Corp", Addrs: []string{"10.1.2.3"}}, "office", true},
+		{"partial criteria", Network{SSID: "Corp", Addrs: []string{"172.16.0.5"}}, "", false},
+		{"mac notation", Network{GatewayMAC: "AA:BB:CC:00:11:22", Addrs: []string{"192.168.1.5"}}, "home", true},
+		{"subnet", Network{Addrs: []string{"192.168.7.5"}}, "lan", true},
+		{"nothing", Network{}, "", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			profile, ok := Match(rules, tt.network)
+			assert.Equal(t, tt.matched, ok)
+			assert.Equal(t, tt.profile, profile)
+		})
+	}
+}
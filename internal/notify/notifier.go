@@ -0,0 +1,213 @@
+// Package notify sends agent events to operators over webhooks, Telegram and
+// email. Notifications are spooled on disk first and retried with backoff, so
+// alerts raised while the network is down are delivered once it returns.
+package notify
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/kpblcaoo/sboxagent/internal/config"
+	"github.com/kpblcaoo/sboxagent/internal/logger"
+)
+
+// sendTimeout bounds a single delivery attempt
+const sendTimeout = 30 * time.Second
+
+// Notifier spools notifications for every enabled channel and delivers them
+type Notifier struct {
+	config  config.NotificationsConfig
+	logger  *logger.Logger
+	spool   *Spool
+	senders map[string]Sender
+	events  map[string]bool
+
+	// kick wakes the delivery loop when a notification is queued
+	kick chan struct{}
+}
+
+// New creates a notifier with a sender for each enabled channel
+func New(cfg config.NotificationsConfig, log *logger.Logger) (*Notifier, error) {
+	spool, err := NewSpool(cfg.SpoolDir)
+	if err != nil {
+		return nil, err
+	}
+
+	client := &http.Client{Timeout: sendTimeout}
+	var senders []Sender
+	if cfg.Webhook.Enabled {
+		senders = append(senders, NewWebhookSender(cfg.Webhook, client))
+	}
+	if cfg.Telegram.Enabled {
+		senders = append(senders, NewTelegramSender(cfg.Telegram, client))
+	}
+	if cfg.Email.Enabled {
+		senders = append(senders, NewEmailSender(cfg.Email))
+	}
+
+	return NewWithSenders(cfg, spool, log, senders...), nil
+}
+
+// NewWithSenders creates a notifier delivering through the given senders
+func NewWithSenders(cfg config.NotificationsConfig, spool *Spool, log *logger.Logger, senders ...Sender) *Notifier {
+	n := &Notifier{
+		config:  cfg,
+		logger:  log,
+		spool:   spool,
+		senders: make(map[string]Sender, len(senders)),
+		events:  make(map[string]bool, len(cfg.Events)),
+		kick:    make(chan struct{}, 1),
+	}
+	for _, sender := range senders {
+		n.senders[sender.Name()] = sender
+	}
+	for _, event := range cfg.Events {
+		n.events[event] = true
+	}
+	return n
+}
+
+// Wants reports whether events of this type are sent
+func (n *Notifier) Wants(event string) bool {
+	return n.events[event]
+}
+
+// Notify spools a notification for every channel and wakes the delivery loop
+func (n *Notifier) Notify(event, message string, data map[string]interface{}) error {
+	now := time.Now()
+	for channel := range n.senders {
+		notification := &Notification{
+			ID:          uuid.New().String(),
+			Channel:     channel,
+			Event:       event,
+			Message:     message,
+			Data:        data,
+			CreatedAt:   now,
+			NextAttempt: now,
+		}
+		if err := n.spool.Put(notification); err != nil {
+			return err
+		}
+	}
+
+	select {
+	case n.kick <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+// Run delivers spooled notifications until ctx is cancelled, including those
+// left over from a previous run
+func (n *Notifier) Run(ctx context.Context) {
+	ticker := time.NewTicker(n.config.RetryInterval)
+	defer ticker.Stop()
+
+	for {
+		n.Deliver(ctx, time.Now())
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		case <-n.kick:
+		}
+	}
+}
+
+// Deliver attempts every due notification once. Delivered and expired
+// notifications leave the spool; failed ones are rescheduled with backoff.
+func (n *Notifier) Deliver(ctx context.Context, now time.Time) {
+	notifications, err := n.spool.List()
+	if err != nil {
+		n.logger.Error("Failed to read notification spool", map[string]interface{}{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	for _, notification := range notifications {
+		if ctx.Err() != nil {
+			return
+		}
+		if now.Sub(notification.CreatedAt) > n.config.Expiry {
+			n.logger.Warn("Dropping expired notification", map[string]interface{}{
+				"id":        notification.ID,
+				"channel":   notification.Channel,
+				"event":     notification.Event,
+				"attempts":  notification.Attempts,
+				"lastError": notification.LastError,
+			})
+			n.spool.Remove(notification.ID)
+			continue
+		}
+		if now.Before(notification.NextAttempt) {
+			continue
+		}
+		n.deliver(ctx, notification, now)
+	}
+}
+
+// deliver sends one notification and updates the spool with the result
+func (n *Notifier) deliver(ctx context.Context, notification *Notification, now time.Time) {
+	sender, ok := n.senders[notification.Channel]
+	if !ok {
+		// The channel was disabled since the notification was queued
+		n.spool.Remove(notification.ID)
+		return
+	}
+
+	sendCtx, cancel := context.WithTimeout(ctx, sendTimeout)
+	err := sender.Send(sendCtx, notification)
+	cancel()
+	if err == nil {
+		n.logger.Debug("Notification delivered", map[string]interface{}{
+			"id":      notification.ID,
+			"channel": notification.Channel,
+			"event":   notification.Event,
+		})
+		n.spool.Remove(notification.ID)
+		return
+	}
+
+	notification.Attempts++
+	notification.LastError = err.Error()
+	notification.NextAttempt = now.Add(n.backoff(notification.Attempts))
+	n.logger.Warn("Notification delivery failed, will retry", map[string]interface{}{
+		"id":          notification.ID,
+		"channel":     notification.Channel,
+		"attempts":    notification.Attempts,
+		"nextAttempt": notification.NextAttempt,
+		"error":       err.Error(),
+	})
+	if err := n.spool.Put(notification); err != nil {
+		n.logger.Error("Failed to update spooled notification", map[string]interface{}{
+			"id":    notification.ID,
+			"error": err.Error(),
+		})
+	}
+}
+
+// backoff doubles the retry interval per failed attempt up to the maximum
+func (n *Notifier) backoff(attempts int) time.Duration {
+	delay := n.config.RetryInterval
+	for i := 1; i < attempts && delay < n.config.MaxRetryInterval; i++ {
+		delay *= 2
+	}
+	if delay > n.config.MaxRetryInterval {
+		delay = n.config.MaxRetryInterval
+	}
+	return delay
+}
+
+// Pending returns the number of spooled notifications
+func (n *Notifier) Pending() (int, error) {
+	notifications, err := n.spool.List()
+	if err != nil {
+		return 0, fmt.Errorf("failed to count notifications: %w", err)
+	}
+	return len(notifications), nil
+}
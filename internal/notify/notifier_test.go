@@ -0,0 +1,140 @@
+package notify
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/kpblcaoo/sboxagent/internal/config"
+	"github.com/kpblcaoo/sboxagent/internal/logger"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeSender fails until up is set
+type fakeSender struct {
+	up   bool
+	sent []*Notification
+}
+
+func (f *fakeSender) Name() string { return "fake" }
+
+func (f *fakeSender) Send(ctx context.Context, n *Notification) error {
+	if !f.up {
+		return errors.New("network is unreachable")
+	}
+	f.sent = append(f.sent, n)
+	return nil
+}
+
+func newTestNotifier(t *testing.T, dir string, sender Sender) *Notifier {
+	log, err := logger.New("error")
+	require.NoError(t, err)
+	spool, err := NewSpool(dir)
+	require.NoError(t, err)
+	return NewWithSenders(config.NotificationsConfig{
+		Events:           []string{"IMPORT_FAILED"},
+		RetryInterval:    time.Minute,
+		MaxRetryInterval: 4 * time.Minute,
+		Expiry:           time.Hour,
+	}, spool, log, sender)
+}
+
+func TestNotifier_RetriesUntilDelivered(t *testing.T) {
+	dir := t.TempDir()
+	sender := &fakeSender{}
+	notifier := newTestNotifier(t, dir, sender)
+	assert.True(t, notifier.Wants("IMPORT_FAILED"))
+	assert.False(t, notifier.Wants("STATE_CHANGED"))
+
+	require.NoError(t, notifier.Notify("IMPORT_FAILED", "gw: IMPORT_FAILED", map[string]interface{}{"error": "timeout"}))
+	now := time.Now()
+	notifier.Deliver(context.Background(), now)
+
+	pending, err := notifier.spool.List()
+	require.NoError(t, err)
+	require.Len(t, pending, 1)
+	assert.Equal(t, 1, pending[0].Attempts)
+	assert.Equal(t, "network is unreachable", pending[0].LastError)
+	assert.WithinDuration(t, now.Add(time.Minute), pending[0].NextAttempt, time.Second)
+
+	// Not due yet
+	notifier.Deliver(context.Background(), now.Add(30*time.Second))
+	pending, _ = notifier.spool.List()
+	assert.Equal(t, 1, pending[0].Attempts)
+
+	// The spool survives a restart and is delivered once the network is back
+	sender.up = true
+	restarted := newTestNotifier(t, dir, sender)
+	restarted.Deliver(context.Background(), now.Add(2*time.Minute))
+	require.Len(t, sender.sent, 1)
+	assert.Equal(t, "timeout", sender.sent[0].Data["error"])
+	count, err := restarted.Pending()
+	require.NoError(t, err)
+	assert.Zero(t, count)
+}
+
+func TestNotifier_DropsExpired(t *testing.T) {
+	sender := &fakeSender{}
+	notifier := newTestNotifier(t, t.TempDir(), sender)
+	require.NoError(t, notifier.Notify("IMPORT_FAILED", "failed", nil))
+
+	sender.up = true
+	notifier.Deliver(context.Background(), time.Now().Add(2*time.Hour))
+	assert.Empty(t, sender.sent)
+	count, err := notifier.Pending()
+	require.NoError(t, err)
+	assert.Zero(t, count)
+}
+
+func TestNotifier_Backoff(t *testing.T) {
+	notifier := newTestNotifier(t, t.TempDir(), &fakeSender{})
+	assert.Equal(t, time.Minute, notifier.backoff(1))
+	assert.Equal(t, 2*time.Minute, notifier.backoff(2))
+	assert.Equal(t, 4*time.Minute, notifier.backoff(3))
+	assert.Equal(t, 4*time.Minute, notifier.backoff(10))
+}
+
+func TestWebhookAndTelegramSenders(t *testing.T) {
+	var paths []string
+	var bodies []map[string]interface{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body map[string]interface{}
+		json.NewDecoder(r.Body).Decode(&body)
+		paths = append(paths, r.URL.Path)
+		bodies = append(bodies, body)
+		if r.URL.Path == "/fail" {
+			w.WriteHeader(http.StatusBadGateway)
+		}
+	}))
+	defer server.Close()
+
+	n := &Notification{ID: "1", Event: "IMPORT_FAILED", Message: "gw: IMPORT_FAILED"}
+
+	webhook := NewWebhookSender(config.WebhookConfig{URL: server.URL + "/hook"}, server.Client())
+	require.NoError(t, webhook.Send(context.Background(), n))
+	assert.Equal(t, "IMPORT_FAILED", bodies[0]["event"])
+
+	telegram := NewTelegramSender(config.TelegramConfig{BotToken: "123:abc", ChatID: "42"}, server.Client())
+	telegram.apiURL = server.URL
+	require.NoError(t, telegram.Send(context.Background(), n))
+	assert.Equal(t, "/bot123:abc/sendMessage", paths[1])
+	assert.Equal(t, "42", bodies[1]["chat_id"])
+	assert.Equal(t, "gw: IMPORT_FAILED", bodies[1]["text"])
+
+	failing := NewWebhookSender(config.WebhookConfig{URL: server.URL + "/fail"}, server.Client())
+	assert.ErrorContains(t, failing.Send(context.Background(), n), "unexpected status 502")
+}
+
+func TestTelegramSender_HidesToken(t *testing.T) {
+	telegram := NewTelegramSender(config.TelegramConfig{BotToken: "123:secret", ChatID: "42"}, http.DefaultClient)
+	telegram.apiURL = "http://127.0.0.1:1"
+
+	err := telegram.Send(context.Background(), &Notification{Message: "test"})
+	require.Error(t, err)
+	assert.NotContains(t, err.Error(), "secret")
+}
@@ -0,0 +1,150 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/smtp"
+	"net/url"
+	"strings"
+
+	"github.com/kpblcaoo/sboxagent/internal/config"
+)
+
+// Sender delivers notifications on one channel
+type Sender interface {
+	Name() string
+	Send(ctx context.Context, n *Notification) error
+}
+
+// WebhookSender posts notifications as JSON
+type WebhookSender struct {
+	url    string
+	client *http.Client
+}
+
+// NewWebhookSender creates a webhook sender
+func NewWebhookSender(cfg config.WebhookConfig, client *http.Client) *WebhookSender {
+	return &WebhookSender{url: cfg.URL, client: client}
+}
+
+// Name returns the channel name
+func (w *WebhookSender) Name() string {
+	return "webhook"
+}
+
+// Send posts the notification
+func (w *WebhookSender) Send(ctx context.Context, n *Notification) error {
+	body, err := json.Marshal(map[string]interface{}{
+		"id":        n.ID,
+		"event":     n.Event,
+		"message":   n.Message,
+		"data":      n.Data,
+		"createdAt": n.CreatedAt,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to encode webhook body: %w", err)
+	}
+	return post(ctx, w.client, w.url, body)
+}
+
+// TelegramSender sends notifications through the Telegram Bot API
+type TelegramSender struct {
+	apiURL string
+	token  string
+	chatID string
+	client *http.Client
+}
+
+// NewTelegramSender creates a Telegram sender
+func NewTelegramSender(cfg config.TelegramConfig, client *http.Client) *TelegramSender {
+	return &TelegramSender{
+		apiURL: "https://api.telegram.org",
+		token:  cfg.BotToken,
+		chatID: cfg.ChatID,
+		client: client,
+	}
+}
+
+// Name returns the channel name
+func (t *TelegramSender) Name() string {
+	return "telegram"
+}
+
+// Send sends the notification as a chat message
+func (t *TelegramSender) Send(ctx context.Context, n *Notification) error {
+	body, err := json.Marshal(map[string]interface{}{
+		"chat_id": t.chatID,
+		"text":    n.Message,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to encode telegram message: %w", err)
+	}
+	return post(ctx, t.client, fmt.Sprintf("%s/bot%s/sendMessage", t.apiURL, t.token), body)
+}
+
+// EmailSender sends notifications by SMTP
+type EmailSender struct {
+	config config.EmailConfig
+}
+
+// NewEmailSender creates an email sender
+func NewEmailSender(cfg config.EmailConfig) *EmailSender {
+	return &EmailSender{config: cfg}
+}
+
+// Name returns the channel name
+func (e *EmailSender) Name() string {
+	return "email"
+}
+
+// Send mails the notification to all recipients
+func (e *EmailSender) Send(ctx context.Context, n *Notification) error {
+	var auth smtp.Auth
+	if e.config.Username != "" {
+		host, _, err := net.SplitHostPort(e.config.SMTPAddr)
+		if err != nil {
+			return fmt.Errorf("invalid smtp address: %w", err)
+		}
+		auth = smtp.PlainAuth("", e.config.Username, e.config.Password, host)
+	}
+
+	var msg strings.Builder
+	fmt.Fprintf(&msg, "From: %s\r\n", e.config.From)
+	fmt.Fprintf(&msg, "To: %s\r\n", strings.Join(e.config.To, ", "))
+	fmt.Fprintf(&msg, "Subject: [sboxagent] %s\r\n", n.Event)
+	fmt.Fprintf(&msg, "Content-Type: text/plain; charset=utf-8\r\n\r\n")
+	fmt.Fprintf(&msg, "%s\r\n", n.Message)
+
+	if err := smtp.SendMail(e.config.SMTPAddr, auth, e.config.From, e.config.To, []byte(msg.String())); err != nil {
+		return fmt.Errorf("failed to send email: %w", err)
+	}
+	return nil
+}
+
+// post sends a JSON body and treats any non-2xx response as a failure
+func post(ctx context.Context, client *http.Client, target string, body []byte) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, target, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := client.Do(req)
+	if err != nil {
+		// The URL may hold a credential such as a bot token; keep it out of
+		// logs and spooled errors
+		if urlErr, ok := err.(*url.Error); ok {
+			return fmt.Errorf("request failed: %w", urlErr.Err)
+		}
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	return nil
+}
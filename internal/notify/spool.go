@@ -0,0 +1,106 @@
+package notify
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// spoolSuffix ends the names of spooled notification files
+const spoolSuffix = ".json"
+
+// SpoolPatterns match the files a spool keeps in its directory, including
+// those left over by an interrupted Put
+var SpoolPatterns = []string{"*" + spoolSuffix, "*" + spoolSuffix + ".tmp"}
+
+// Notification is a message waiting to be delivered on one channel
+type Notification struct {
+	ID          string                 `json:"id"`
+	Channel     string                 `json:"channel"`
+	Event       string                 `json:"event"`
+	Message     string                 `json:"message"`
+	Data        map[string]interface{} `json:"data,omitempty"`
+	CreatedAt   time.Time              `json:"createdAt"`
+	Attempts    int                    `json:"attempts"`
+	NextAttempt time.Time              `json:"nextAttempt"`
+	LastError   string                 `json:"lastError,omitempty"`
+}
+
+// Spool keeps notifications as one file each in a directory, so they
+// survive restarts until delivered
+type Spool struct {
+	dir string
+}
+
+// NewSpool creates a spool in dir, creating the directory if needed
+func NewSpool(dir string) (*Spool, error) {
+	if err := os.MkdirAll(dir, 0750); err != nil {
+		return nil, fmt.Errorf("failed to create spool directory: %w", err)
+	}
+	return &Spool{dir: dir}, nil
+}
+
+// Put stores a notification, replacing an earlier version with the same ID
+func (s *Spool) Put(n *Notification) error {
+	data, err := json.Marshal(n)
+	if err != nil {
+		return fmt.Errorf("failed to encode notification: %w", err)
+	}
+	path := s.path(n.ID)
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0640); err != nil {
+		return fmt.Errorf("failed to spool notification: %w", err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("failed to spool notification: %w", err)
+	}
+	return nil
+}
+
+// Remove deletes a notification from the spool
+func (s *Spool) Remove(id string) error {
+	if err := os.Remove(s.path(id)); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to remove notification: %w", err)
+	}
+	return nil
+}
+
+// List returns the spooled notifications, oldest first. Unreadable files are
+// skipped.
+func (s *Spool) List() ([]*Notification, error) {
+	entries, err := os.ReadDir(s.dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read spool: %w", err)
+	}
+
+	var notifications []*Notification
+	for _, entry := range entries {
+		if entry.IsDir() || !strings.HasSuffix(entry.Name(), spoolSuffix) {
+			continue
+		}
+		data, err := os.ReadFile(filepath.Join(s.dir, entry.Name()))
+		if err != nil {
+			continue
+		}
+		var n Notification
+		if err := json.Unmarshal(data, &n); err != nil || n.ID == "" {
+			continue
+		}
+		notifications = append(notifications, &n)
+	}
+
+	sort.Slice(notifications, func(i, j int) bool {
+		return notifications[i].CreatedAt.Before(notifications[j].CreatedAt)
+	})
+	return notifications, nil
+}
+
+// path returns the file of a notification
+func (s *Spool) path(id string) string {
+	return filepath.Join(s.dir, id+spoolSuffix)
+}
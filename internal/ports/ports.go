@@ -0,0 +1,400 @@
+// Package ports finds the addresses a client config listens on and checks
+// that they are free before the config is applied, so a conflict fails the
+// apply instead of crash-looping the client.
+package ports
+
+import (
+	"bufio"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// Listener is an address a client listens on. An empty Host listens on all
+// addresses.
+type Listener struct {
+	Network string `json:"network"`
+	Host    string `json:"host,omitempty"`
+	Port    int    `json:"port"`
+}
+
+func (l Listener) String() string {
+	return fmt.Sprintf("%s/%s", net.JoinHostPort(l.Host, strconv.Itoa(l.Port)), l.Network)
+}
+
+// InUseError reports a listener whose port is taken by another process. PID
+// is zero when the owner could not be determined.
+type InUseError struct {
+	Listener Listener
+	PID      int
+	Process  string
+}
+
+func (e *InUseError) Error() string {
+	port := strconv.Itoa(e.Listener.Port)
+	if e.Listener.Network != "tcp" {
+		port += "/" + e.Listener.Network
+	}
+	if e.PID == 0 {
+		return fmt.Sprintf("port %s in use", port)
+	}
+	return fmt.Sprintf("port %s in use by PID %d (%s)", port, e.PID, e.Process)
+}
+
+// Listeners returns the inbound addresses of a client config. Client types
+// without known inbounds have none.
+func Listeners(clientType string, data []byte) ([]Listener, error) {
+	var listeners []Listener
+	var err error
+	switch clientType {
+	case "sing-box":
+		listeners, err = singBoxListeners(data)
+	case "xray":
+		listeners, err = xrayListeners(data)
+	case "clash":
+		listeners, err = clashListeners(data)
+	case "hysteria":
+		listeners, err = hysteriaListeners(data)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse %s inbounds: %w", clientType, err)
+	}
+	return listeners, nil
+}
+
+// udpInbounds are the sing-box inbound types listening on UDP only
+var udpInbounds = map[string]bool{"hysteria": true, "hysteria2": true, "tuic": true}
+
+func singBoxListeners(data []byte) ([]Listener, error) {
+	var doc struct {
+		Inbounds []struct {
+			Type       string `json:"type"`
+			Listen     string `json:"listen"`
+			ListenPort int    `json:"listen_port"`
+			Network    string `json:"network"`
+		} `json:"inbounds"`
+	}
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return nil, err
+	}
+
+	var listeners []Listener
+	for _, inbound := range doc.Inbounds {
+		if inbound.ListenPort == 0 {
+			continue
+		}
+		host := unspecified(inbound.Listen)
+		network := "tcp"
+		if udpInbounds[inbound.Type] || inbound.Network == "udp" {
+			network = "udp"
+		}
+		listeners = append(listeners, Listener{Network: network, Host: host, Port: inbound.ListenPort})
+		// These listen on both unless restricted to one network
+		if inbound.Network == "" && (inbound.Type == "direct" || inbound.Type == "shadowsocks") {
+			listeners = append(listeners, Listener{Network: "udp", Host: host, Port: inbound.ListenPort})
+		}
+	}
+	return listeners, nil
+}
+
+func xrayListeners(data []byte) ([]Listener, error) {
+	var doc struct {
+		Inbounds []struct {
+			Listen   string          `json:"listen"`
+			Port     json.RawMessage `json:"port"`
+			Settings struct {
+				Network string `json:"network"`
+			} `json:"settings"`
+		} `json:"inbounds"`
+	}
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return nil, err
+	}
+
+	var listeners []Listener
+	for _, inbound := range doc.Inbounds {
+		// Port ranges and environment references are not checked
+		port, err := strconv.Atoi(strings.Trim(string(inbound.Port), `"`))
+		if err != nil || port == 0 {
+			continue
+		}
+		host := unspecified(inbound.Listen)
+		for _, network := range strings.Split(inbound.Settings.Network, ",") {
+			network = strings.TrimSpace(network)
+			if network == "" {
+				network = "tcp"
+			}
+			listeners = append(listeners, Listener{Network: network, Host: host, Port: port})
+		}
+	}
+	return listeners, nil
+}
+
+// clashPorts are the clash settings holding inbound ports
+var clashPorts = []string{"port", "socks-port", "mixed-port", "redir-port", "tproxy-port"}
+
+func clashListeners(data []byte) ([]Listener, error) {
+	var doc map[string]interface{}
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return nil, err
+	}
+
+	// Clash binds loopback unless LAN access is allowed
+	host := "127.0.0.1"
+	if allowLAN, _ := doc["allow-lan"].(bool); allowLAN {
+		bind, _ := doc["bind-address"].(string)
+		host = unspecified(bind)
+	}
+
+	var listeners []Listener
+	for _, key := range clashPorts {
+		if port, ok := doc[key].(float64); ok && port > 0 {
+			listeners = append(listeners, Listener{Network: "tcp", Host: host, Port: int(port)})
+		}
+	}
+	return listeners, nil
+}
+
+func hysteriaListeners(data []byte) ([]Listener, error) {
+	var doc struct {
+		// Listen is set on servers
+		Listen string `json:"listen"`
+		SOCKS5 struct {
+			Listen string `json:"listen"`
+		} `json:"socks5"`
+		HTTP struct {
+			Listen string `json:"listen"`
+		} `json:"http"`
+	}
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return nil, err
+	}
+
+	var listeners []Listener
+	for _, entry := range []struct{ network, address string }{
+		{"udp", doc.Listen},
+		{"tcp", doc.SOCKS5.Listen},
+		{"tcp", doc.HTTP.Listen},
+	} {
+		if entry.address == "" {
+			continue
+		}
+		host, port, err := net.SplitHostPort(entry.address)
+		if err != nil {
+			return nil, err
+		}
+		number, err := strconv.Atoi(port)
+		if err != nil {
+			return nil, fmt.Errorf("invalid port in %q", entry.address)
+		}
+		listeners = append(listeners, Listener{Network: entry.network, Host: unspecified(host), Port: number})
+	}
+	return listeners, nil
+}
+
+// unspecified normalizes the listen-on-all-addresses forms to an empty host
+func unspecified(host string) string {
+	switch host {
+	case "", "*", "0.0.0.0", "::":
+		return ""
+	}
+	return host
+}
+
+// Checker finds the sockets bound on the host in procfs
+type Checker struct {
+	// ProcPath is the procfs mount point
+	ProcPath string
+}
+
+// NewChecker returns a checker reading /proc
+func NewChecker() *Checker {
+	return &Checker{ProcPath: "/proc"}
+}
+
+// socket is a bound local socket
+type socket struct {
+	ip    net.IP
+	port  int
+	inode string
+}
+
+// Check returns an *InUseError for the first listener whose port is bound by
+// a process other than owner, matched by process name. An empty owner
+// accepts no process.
+func (c *Checker) Check(listeners []Listener, owner string) error {
+	bound := make(map[string][]socket)
+	for _, listener := range listeners {
+		if _, ok := bound[listener.Network]; !ok {
+			sockets, err := c.sockets(listener.Network)
+			if err != nil {
+				return err
+			}
+			bound[listener.Network] = sockets
+		}
+
+		for _, s := range bound[listener.Network] {
+			if s.port != listener.Port || !overlaps(s.ip, listener.Host) {
+				continue
+			}
+			pid, name := c.owner(s.inode)
+			if pid != 0 && owner != "" && name == processName(owner) {
+				continue
+			}
+			return &InUseError{Listener: listener, PID: pid, Process: name}
+		}
+	}
+	return nil
+}
+
+// Bound reports whether a socket matching listener is listening (TCP) or
+// bound (UDP)
+func (c *Checker) Bound(listener Listener) (bool, error) {
+	sockets, err := c.sockets(listener.Network)
+	if err != nil {
+		return false, err
+	}
+	for _, s := range sockets {
+		if s.port == listener.Port && overlaps(s.ip, listener.Host) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// Process returns the PID of a running process of binary, matched by
+// process name, or zero if none runs
+func (c *Checker) Process(binary string) (int, error) {
+	entries, err := os.ReadDir(c.ProcPath)
+	if err != nil {
+		return 0, fmt.Errorf("failed to list processes: %w", err)
+	}
+	name := processName(binary)
+	for _, entry := range entries {
+		pid, err := strconv.Atoi(entry.Name())
+		if err != nil {
+			continue
+		}
+		comm, err := os.ReadFile(filepath.Join(c.ProcPath, entry.Name(), "comm"))
+		if err == nil && strings.TrimSpace(string(comm)) == name {
+			return pid, nil
+		}
+	}
+	return 0, nil
+}
+
+// sockets lists the listening TCP or bound UDP sockets of both families
+func (c *Checker) sockets(network string) ([]socket, error) {
+	var sockets []socket
+	for _, table := range []string{network, network + "6"} {
+		file, err := os.Open(filepath.Join(c.ProcPath, "net", table))
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read socket table: %w", err)
+		}
+
+		scanner := bufio.NewScanner(file)
+		scanner.Scan() // header
+		for scanner.Scan() {
+			fields := strings.Fields(scanner.Text())
+			if len(fields) < 10 {
+				continue
+			}
+			// Only TCP sockets in the LISTEN state accept connections
+			if network == "tcp" && fields[3] != "0A" {
+				continue
+			}
+			ip, port, err := parseAddress(fields[1])
+			if err != nil {
+				continue
+			}
+			sockets = append(sockets, socket{ip: ip, port: port, inode: fields[9]})
+		}
+		err = scanner.Err()
+		file.Close()
+		if err != nil {
+			return nil, fmt.Errorf("failed to read socket table: %w", err)
+		}
+	}
+	return sockets, nil
+}
+
+// parseAddress decodes a procfs socket address such as 0100007F:0822. The
+// address is stored as 32-bit words in host (little-endian) byte order.
+func parseAddress(field string) (net.IP, int, error) {
+	address, portHex, ok := strings.Cut(field, ":")
+	if !ok {
+		return nil, 0, fmt.Errorf("invalid address %q", field)
+	}
+	raw, err := hex.DecodeString(address)
+	if err != nil || (len(raw) != net.IPv4len && len(raw) != net.IPv6len) {
+		return nil, 0, fmt.Errorf("invalid address %q", field)
+	}
+	for i := 0; i < len(raw); i += 4 {
+		raw[i], raw[i+1], raw[i+2], raw[i+3] = raw[i+3], raw[i+2], raw[i+1], raw[i]
+	}
+	port, err := strconv.ParseUint(portHex, 16, 16)
+	if err != nil {
+		return nil, 0, fmt.Errorf("invalid port in %q", field)
+	}
+	return net.IP(raw), int(port), nil
+}
+
+// overlaps reports whether a socket bound to ip conflicts with listening on
+// host. Unresolvable hosts are assumed to conflict.
+func overlaps(ip net.IP, host string) bool {
+	if ip.IsUnspecified() || host == "" {
+		return true
+	}
+	if host == "localhost" {
+		return ip.IsLoopback()
+	}
+	other := net.ParseIP(host)
+	return other == nil || other.IsUnspecified() || other.Equal(ip)
+}
+
+// owner returns the PID and name of the process holding a socket inode, or
+// zero if it is not visible, e.g. without privileges to read other
+// processes' descriptors
+func (c *Checker) owner(inode string) (int, string) {
+	target := "socket:[" + inode + "]"
+	entries, err := os.ReadDir(c.ProcPath)
+	if err != nil {
+		return 0, ""
+	}
+	for _, entry := range entries {
+		pid, err := strconv.Atoi(entry.Name())
+		if err != nil {
+			continue
+		}
+		fdDir := filepath.Join(c.ProcPath, entry.Name(), "fd")
+		fds, err := os.ReadDir(fdDir)
+		if err != nil {
+			continue
+		}
+		for _, fd := range fds {
+			if link, err := os.Readlink(filepath.Join(fdDir, fd.Name())); err == nil && link == target {
+				comm, _ := os.ReadFile(filepath.Join(c.ProcPath, entry.Name(), "comm"))
+				return pid, strings.TrimSpace(string(comm))
+			}
+		}
+	}
+	return 0, ""
+}
+
+// processName returns the name the kernel reports for a binary, which is
+// its base name truncated to 15 characters
+func processName(binary string) string {
+	name := filepath.Base(binary)
+	if len(name) > 15 {
+		name = name[:15]
+	}
+	return name
+}
@@ -0,0 +1,177 @@
+package ports
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestListeners(t *testing.T) {
+	tests := []struct {
+		client string
+		config string
+		want   []Listener
+	}{
+		{
+			client: "sing-box",
+			config: `{"inbounds":[
+				{"type":"mixed","listen":"127.0.0.1","listen_port":2080},
+				{"type":"tun","inet4_address":"172.19.0.1/30"},
+				{"type":"hysteria2","listen":"::","listen_port":443},
+				{"type":"direct","listen":"0.0.0.0","listen_port":53}
+			]}`,
+			want: []Listener{
+				{Network: "tcp", Host: "127.0.0.1", Port: 2080},
+				{Network: "udp", Port: 443},
+				{Network: "tcp", Port: 53},
+				{Network: "udp", Port: 53},
+			},
+		},
+		{
+			client: "xray",
+			config: `{"inbounds":[
+				{"listen":"127.0.0.1","port":1080,"protocol":"socks"},
+				{"port":"5353","protocol":"dokodemo-door","settings":{"network":"tcp,udp"}},
+				{"port":"10000-10010","protocol":"vless"}
+			]}`,
+			want: []Listener{
+				{Network: "tcp", Host: "127.0.0.1", Port: 1080},
+				{Network: "tcp", Port: 5353},
+				{Network: "udp", Port: 5353},
+			},
+		},
+		{
+			client: "clash",
+			config: `{"mixed-port":7890,"socks-port":7891,"allow-lan":true,"bind-address":"*"}`,
+			want: []Listener{
+				{Network: "tcp", Port: 7891},
+				{Network: "tcp", Port: 7890},
+			},
+		},
+		{
+			client: "clash",
+			config: `{"port":7890}`,
+			want:   []Listener{{Network: "tcp", Host: "127.0.0.1", Port: 7890}},
+		},
+		{
+			client: "hysteria",
+			config: `{"server":"example.com:443","socks5":{"listen":"127.0.0.1:1080"}}`,
+			want:   []Listener{{Network: "tcp", Host: "127.0.0.1", Port: 1080}},
+		},
+		{
+			client: "wireguard",
+			config: `{}`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.client, func(t *testing.T) {
+			listeners, err := Listeners(tt.client, []byte(tt.config))
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, listeners)
+		})
+	}
+
+	_, err := Listeners("sing-box", []byte(`{"inbounds":{}}`))
+	assert.ErrorContains(t, err, "failed to parse sing-box inbounds")
+}
+
+// fakeProc builds a procfs tree where pid holds a socket listening on
+// 127.0.0.1:2080
+func fakeProc(t *testing.T, pid int, comm string) string {
+	proc := t.TempDir()
+	require.NoError(t, os.MkdirAll(filepath.Join(proc, "net"), 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(proc, "net", "tcp"), []byte(
+		"  sl  local_address rem_address   st tx_queue rx_queue tr tm->when retrnsmt   uid  timeout inode\n"+
+			"   0: 0100007F:0820 00000000:0000 0A 00000000:00000000 00:00000000 00000000     0        0 4242 1\n"+
+			"   1: 0100007F:1F90 0100007F:A000 01 00000000:00000000 00:00000000 00000000     0        0 4343 1\n",
+	), 0644))
+
+	fdDir := filepath.Join(proc, fmt.Sprint(pid), "fd")
+	require.NoError(t, os.MkdirAll(fdDir, 0755))
+	require.NoError(t, os.Symlink("socket:[4242]", filepath.Join(fdDir, "3")))
+	require.NoError(t, os.WriteFile(filepath.Join(proc, fmt.Sprint(pid), "comm"), []byte(comm+"\n"), 0644))
+	return proc
+}
+
+func TestChecker_Check(t *testing.T) {
+	checker := &Checker{ProcPath: fakeProc(t, 1234, "nginx")}
+
+	err := checker.Check([]Listener{{Network: "tcp", Host: "127.0.0.1", Port: 2080}}, "/usr/local/bin/sing-box")
+	var inUse *InUseError
+	require.True(t, errors.As(err, &inUse))
+	assert.Equal(t, 1234, inUse.PID)
+	assert.EqualError(t, err, "port 2080 in use by PID 1234 (nginx)")
+
+	// Listening on all addresses conflicts as well
+	assert.Error(t, checker.Check([]Listener{{Network: "tcp", Port: 2080}}, ""))
+
+	// Other addresses, ports, networks and non-listening sockets are free
+	assert.NoError(t, checker.Check([]Listener{
+		{Network: "tcp", Host: "10.0.0.1", Port: 2080},
+		{Network: "tcp", Host: "127.0.0.1", Port: 2081},
+		{Network: "udp", Host: "127.0.0.1", Port: 2080},
+		{Network: "tcp", Host: "127.0.0.1", Port: 8080},
+	}, ""))
+
+	// The client being reloaded may hold its own ports
+	checker = &Checker{ProcPath: fakeProc(t, 1234, "sing-box")}
+	assert.NoError(t, checker.Check([]Listener{{Network: "tcp", Host: "127.0.0.1", Port: 2080}}, "/usr/local/bin/sing-box"))
+}
+
+func TestChecker_BoundAndProcess(t *testing.T) {
+	checker := &Checker{ProcPath: fakeProc(t, 1234, "sing-box")}
+
+	bound, err := checker.Bound(Listener{Network: "tcp", Port: 2080})
+	require.NoError(t, err)
+	assert.True(t, bound)
+	// Connected sockets do not listen
+	bound, err = checker.Bound(Listener{Network: "tcp", Host: "127.0.0.1", Port: 8080})
+	require.NoError(t, err)
+	assert.False(t, bound)
+
+	pid, err := checker.Process("/usr/local/bin/sing-box")
+	require.NoError(t, err)
+	assert.Equal(t, 1234, pid)
+	pid, err = checker.Process("xray")
+	require.NoError(t, err)
+	assert.Zero(t, pid)
+}
+
+func TestChecker_CheckHost(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("requires procfs")
+	}
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer listener.Close()
+	port := listener.Addr().(*net.TCPAddr).Port
+
+	err = NewChecker().Check([]Listener{{Network: "tcp", Host: "127.0.0.1", Port: port}}, "")
+	var inUse *InUseError
+	require.True(t, errors.As(err, &inUse))
+	assert.Equal(t, os.Getpid(), inUse.PID)
+}
+
+func TestParseAddress(t *testing.T) {
+	ip, port, err := parseAddress("0100007F:0822")
+	require.NoError(t, err)
+	assert.Equal(t, "127.0.0.1", ip.String())
+	assert.Equal(t, 2082, port)
+
+	ip, port, err = parseAddress("00000000000000000000000001000000:01BB")
+	require.NoError(t, err)
+	assert.Equal(t, "::1", ip.String())
+	assert.Equal(t, 443, port)
+
+	_, _, err = parseAddress("zz:0822")
+	assert.Error(t, err)
+}
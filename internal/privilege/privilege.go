@@ -0,0 +1,96 @@
+// Package privilege drops the Linux capabilities the agent does not need
+// and switches it to an unprivileged user once it has started.
+package privilege
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// ErrUnsupported is returned where privileges cannot be changed for the
+// whole process: on other platforms, and on Linux in binaries built with
+// cgo, whose threads the Go runtime cannot change together
+var ErrUnsupported = errors.New("changing privileges is not supported by this build")
+
+// capabilities are the Linux capability names by number
+var capabilities = []string{
+	"CAP_CHOWN", "CAP_DAC_OVERRIDE", "CAP_DAC_READ_SEARCH", "CAP_FOWNER",
+	"CAP_FSETID", "CAP_KILL", "CAP_SETGID", "CAP_SETUID", "CAP_SETPCAP",
+	"CAP_LINUX_IMMUTABLE", "CAP_NET_BIND_SERVICE", "CAP_NET_BROADCAST",
+	"CAP_NET_ADMIN", "CAP_NET_RAW", "CAP_IPC_LOCK", "CAP_IPC_OWNER",
+	"CAP_SYS_MODULE", "CAP_SYS_RAWIO", "CAP_SYS_CHROOT", "CAP_SYS_PTRACE",
+	"CAP_SYS_PACCT", "CAP_SYS_ADMIN", "CAP_SYS_BOOT", "CAP_SYS_NICE",
+	"CAP_SYS_RESOURCE", "CAP_SYS_TIME", "CAP_SYS_TTY_CONFIG", "CAP_MKNOD",
+	"CAP_LEASE", "CAP_AUDIT_WRITE", "CAP_AUDIT_CONTROL", "CAP_SETFCAP",
+	"CAP_MAC_OVERRIDE", "CAP_MAC_ADMIN", "CAP_SYSLOG", "CAP_WAKE_ALARM",
+	"CAP_BLOCK_SUSPEND", "CAP_AUDIT_READ", "CAP_PERFMON", "CAP_BPF",
+	"CAP_CHECKPOINT_RESTORE",
+}
+
+// DefaultKeep are the capabilities the agent needs to write client configs
+// owned by other users, signal and limit the processes it runs, run them
+// as other users and let clients manage the network
+var DefaultKeep = []string{
+	"CAP_CHOWN", "CAP_DAC_OVERRIDE", "CAP_FOWNER", "CAP_KILL",
+	"CAP_NET_ADMIN", "CAP_NET_BIND_SERVICE", "CAP_NET_RAW",
+	"CAP_SETGID", "CAP_SETUID", "CAP_SYS_RESOURCE",
+}
+
+// Parse returns the mask of capability names, with or without the CAP_
+// prefix and in any case
+func Parse(names []string) (uint64, error) {
+	var mask uint64
+	for _, name := range names {
+		normalized := strings.ToUpper(name)
+		if !strings.HasPrefix(normalized, "CAP_") {
+			normalized = "CAP_" + normalized
+		}
+		found := false
+		for bit, capability := range capabilities {
+			if capability == normalized {
+				mask |= 1 << bit
+				found = true
+				break
+			}
+		}
+		if !found {
+			return 0, fmt.Errorf("unknown capability %q", name)
+		}
+	}
+	return mask, nil
+}
+
+// names returns the capability names of a mask
+func names(mask uint64) []string {
+	result := []string{}
+	for bit, capability := range capabilities {
+		if mask&(1<<bit) != 0 {
+			result = append(result, capability)
+		}
+	}
+	return result
+}
+
+// Options select how privileges are reduced
+type Options struct {
+	// Drop drops every capability but Keep from all capability sets
+	Drop bool
+	Keep []string
+	// SwitchUser changes the user and group to UID and GID. Kept
+	// capabilities are also made ambient, so processes the agent starts
+	// still get them.
+	SwitchUser bool
+	UID        int
+	GID        int
+}
+
+// State is the user and capabilities the process runs with
+type State struct {
+	UID       int      `json:"uid"`
+	GID       int      `json:"gid"`
+	Effective []string `json:"effective"`
+	Permitted []string `json:"permitted"`
+	Bounding  []string `json:"bounding,omitempty"`
+	Ambient   []string `json:"ambient,omitempty"`
+}
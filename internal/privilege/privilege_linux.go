@@ -0,0 +1,188 @@
+package privilege
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"syscall"
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+)
+
+// statusPath is read for the capability sets of the process
+var statusPath = "/proc/self/status"
+
+// Current returns the user and capabilities of the process
+func Current() (State, error) {
+	state := State{UID: os.Geteuid(), GID: os.Getegid()}
+	file, err := os.Open(statusPath)
+	if err != nil {
+		return state, fmt.Errorf("failed to read capabilities: %w", err)
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		key, value, ok := strings.Cut(scanner.Text(), ":")
+		if !ok {
+			continue
+		}
+		var set *[]string
+		switch key {
+		case "CapEff":
+			set = &state.Effective
+		case "CapPrm":
+			set = &state.Permitted
+		case "CapBnd":
+			set = &state.Bounding
+		case "CapAmb":
+			set = &state.Ambient
+		default:
+			continue
+		}
+		mask, err := strconv.ParseUint(strings.TrimSpace(value), 16, 64)
+		if err != nil {
+			return state, fmt.Errorf("invalid %s %q", key, strings.TrimSpace(value))
+		}
+		*set = names(mask)
+	}
+	return state, scanner.Err()
+}
+
+// Apply reduces the privileges of every thread of the process. Without
+// Drop, switching users drops all capabilities as setuid does.
+func Apply(opts Options) error {
+	keep, err := Parse(opts.Keep)
+	if err != nil {
+		return err
+	}
+
+	if opts.Drop {
+		if err := dropBounding(keep); err != nil {
+			return err
+		}
+		if err := prctl(unix.PR_CAP_AMBIENT, unix.PR_CAP_AMBIENT_CLEAR_ALL, 0); err != nil {
+			return fmt.Errorf("failed to clear ambient capabilities: %w", err)
+		}
+	}
+	if opts.SwitchUser {
+		if opts.Drop {
+			// Keep the permitted set across the user switch
+			if err := prctl(unix.PR_SET_KEEPCAPS, 1, 0); err != nil {
+				return fmt.Errorf("failed to keep capabilities: %w", err)
+			}
+		}
+		if err := switchUser(opts.UID, opts.GID); err != nil {
+			return err
+		}
+		if opts.Drop {
+			if err := prctl(unix.PR_SET_KEEPCAPS, 0, 0); err != nil {
+				return fmt.Errorf("failed to reset keep capabilities: %w", err)
+			}
+		}
+	}
+	if !opts.Drop {
+		return nil
+	}
+
+	permitted, err := capget()
+	if err != nil {
+		return err
+	}
+	permitted &= keep
+	if err := capset(permitted); err != nil {
+		return err
+	}
+	if opts.SwitchUser {
+		for bit := range capabilities {
+			if permitted&(1<<bit) == 0 {
+				continue
+			}
+			if err := prctl(unix.PR_CAP_AMBIENT, unix.PR_CAP_AMBIENT_RAISE, uintptr(bit)); err != nil {
+				return fmt.Errorf("failed to make %s ambient: %w", capabilities[bit], err)
+			}
+		}
+	}
+	return nil
+}
+
+// dropBounding removes the capabilities not kept from the bounding set,
+// so neither the agent nor the processes it starts can regain them.
+// Capabilities the kernel does not know are skipped.
+func dropBounding(keep uint64) error {
+	for bit := range capabilities {
+		if keep&(1<<bit) != 0 {
+			continue
+		}
+		err := prctl(unix.PR_CAPBSET_DROP, uintptr(bit), 0)
+		if errors.Is(err, unix.EINVAL) {
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("failed to drop %s: %w", capabilities[bit], err)
+		}
+	}
+	return nil
+}
+
+// switchUser changes the groups, group and user of all threads
+func switchUser(uid, gid int) error {
+	if err := syscall.Setgroups([]int{gid}); err != nil {
+		return fmt.Errorf("failed to set groups: %w", err)
+	}
+	if err := syscall.Setresgid(gid, gid, gid); err != nil {
+		return fmt.Errorf("failed to switch to group %d: %w", gid, err)
+	}
+	if err := syscall.Setresuid(uid, uid, uid); err != nil {
+		return fmt.Errorf("failed to switch to user %d: %w", uid, err)
+	}
+	return nil
+}
+
+// capget returns the permitted capabilities of the calling thread
+func capget() (uint64, error) {
+	header := unix.CapUserHeader{Version: unix.LINUX_CAPABILITY_VERSION_3}
+	var data [2]unix.CapUserData
+	if err := unix.Capget(&header, &data[0]); err != nil {
+		return 0, fmt.Errorf("failed to read capabilities: %w", err)
+	}
+	return uint64(data[0].Permitted) | uint64(data[1].Permitted)<<32, nil
+}
+
+// capset sets the effective, permitted and inheritable capabilities of
+// all threads to mask
+func capset(mask uint64) error {
+	header := unix.CapUserHeader{Version: unix.LINUX_CAPABILITY_VERSION_3}
+	var data [2]unix.CapUserData
+	for i := range data {
+		word := uint32(mask >> (32 * i))
+		data[i] = unix.CapUserData{Effective: word, Permitted: word, Inheritable: word}
+	}
+	_, _, errno := syscall.AllThreadsSyscall(unix.SYS_CAPSET, uintptr(unsafe.Pointer(&header)), uintptr(unsafe.Pointer(&data[0])), 0)
+	if errno != 0 {
+		return fmt.Errorf("failed to set capabilities: %w", threadsError(errno))
+	}
+	return nil
+}
+
+// prctl runs a prctl option on all threads
+func prctl(option int, arg2, arg3 uintptr) error {
+	_, _, errno := syscall.AllThreadsSyscall6(unix.SYS_PRCTL, uintptr(option), arg2, arg3, 0, 0, 0)
+	if errno != 0 {
+		return threadsError(errno)
+	}
+	return nil
+}
+
+// threadsError maps the error of cgo builds, where the runtime cannot run
+// a syscall on all threads, to ErrUnsupported
+func threadsError(errno syscall.Errno) error {
+	if errno == syscall.ENOTSUP {
+		return fmt.Errorf("%w: build the agent with CGO_ENABLED=0", ErrUnsupported)
+	}
+	return errno
+}
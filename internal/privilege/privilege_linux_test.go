@@ -0,0 +1,32 @@
+package privilege
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCurrent(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "status")
+	require.NoError(t, os.WriteFile(path, []byte(`Name:	sboxagent
+CapInh:	0000000000000000
+CapPrm:	0000000000003001
+CapEff:	0000000000001000
+CapBnd:	0000000000003001
+CapAmb:	0000000000000000
+`), 0644))
+	original := statusPath
+	statusPath = path
+	defer func() { statusPath = original }()
+
+	state, err := Current()
+	require.NoError(t, err)
+	assert.Equal(t, os.Geteuid(), state.UID)
+	assert.Equal(t, []string{"CAP_NET_ADMIN"}, state.Effective)
+	assert.Equal(t, []string{"CAP_CHOWN", "CAP_NET_ADMIN", "CAP_NET_RAW"}, state.Permitted)
+	assert.Equal(t, state.Permitted, state.Bounding)
+	assert.Empty(t, state.Ambient)
+}
@@ -0,0 +1,15 @@
+//go:build !linux
+
+package privilege
+
+import "os"
+
+// Current returns the user of the process; capabilities are Linux only
+func Current() (State, error) {
+	return State{UID: os.Geteuid(), GID: os.Getegid()}, nil
+}
+
+// Apply fails, privileges are only reduced on Linux
+func Apply(opts Options) error {
+	return ErrUnsupported
+}
@@ -0,0 +1,21 @@
+package privilege
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParse(t *testing.T) {
+	mask, err := Parse([]string{"CAP_CHOWN", "net_admin", "Cap_Net_Raw"})
+	require.NoError(t, err)
+	assert.Equal(t, uint64(1<<0|1<<12|1<<13), mask)
+	assert.Equal(t, []string{"CAP_CHOWN", "CAP_NET_ADMIN", "CAP_NET_RAW"}, names(mask))
+
+	_, err = Parse([]string{"CAP_TELEPORT"})
+	assert.ErrorContains(t, err, `unknown capability "CAP_TELEPORT"`)
+
+	_, err = Parse(DefaultKeep)
+	assert.NoError(t, err)
+}
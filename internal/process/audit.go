@@ -0,0 +1,56 @@
+package process
+
+import (
+	"os/exec"
+	"sync/atomic"
+	"time"
+)
+
+// Execution describes a command run with Start and Wait
+type Execution struct {
+	// Args has URLs cut to their host
+	Args  []string  `json:"argv"`
+	UID   int       `json:"uid"`
+	GID   int       `json:"gid"`
+	Start time.Time `json:"start"`
+	// Duration is in seconds
+	Duration float64 `json:"duration"`
+	// ExitCode is -1 for commands that did not start or were killed
+	ExitCode int    `json:"exitCode"`
+	Error    string `json:"error,omitempty"`
+}
+
+// auditHook receives every execution, if set
+var auditHook atomic.Pointer[func(Execution)]
+
+// SetAuditHook sets a function called with each command once it has been
+// waited for or has failed to start. It is called synchronously, so it
+// should not block. A nil hook stops auditing.
+func SetAuditHook(hook func(Execution)) {
+	if hook == nil {
+		auditHook.Store(nil)
+		return
+	}
+	auditHook.Store(&hook)
+}
+
+// audit passes a finished command to the audit hook
+func audit(cmd *exec.Cmd, started time.Time, err error) {
+	hook := auditHook.Load()
+	if hook == nil {
+		return
+	}
+	uid, gid := commandCredential(cmd)
+	execution := Execution{
+		Args:     redactCommand(cmd.Args),
+		UID:      uid,
+		GID:      gid,
+		Start:    started,
+		Duration: time.Since(started).Seconds(),
+		ExitCode: ExitCode(err),
+	}
+	if err != nil {
+		execution.Error = err.Error()
+	}
+	(*hook)(execution)
+}
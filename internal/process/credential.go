@@ -0,0 +1,48 @@
+package process
+
+import (
+	"fmt"
+	"os/user"
+	"strconv"
+)
+
+// Credential is the user and group a command runs as
+type Credential struct {
+	UID uint32 `json:"uid"`
+	GID uint32 `json:"gid"`
+}
+
+// LookupCredential resolves a user name or numeric uid, and optionally a
+// group name or numeric gid, to a Credential. Without a group the user's
+// primary group is used.
+func LookupCredential(username, group string) (*Credential, error) {
+	u, err := user.Lookup(username)
+	if err != nil {
+		var idErr error
+		if u, idErr = user.LookupId(username); idErr != nil {
+			return nil, fmt.Errorf("failed to look up user %q: %w", username, err)
+		}
+	}
+	uid, err := strconv.ParseUint(u.Uid, 10, 32)
+	if err != nil {
+		return nil, fmt.Errorf("user %q has non-numeric uid %q", username, u.Uid)
+	}
+	gid, err := strconv.ParseUint(u.Gid, 10, 32)
+	if err != nil {
+		return nil, fmt.Errorf("user %q has non-numeric gid %q", username, u.Gid)
+	}
+
+	if group != "" {
+		g, err := user.LookupGroup(group)
+		if err != nil {
+			var idErr error
+			if g, idErr = user.LookupGroupId(group); idErr != nil {
+				return nil, fmt.Errorf("failed to look up group %q: %w", group, err)
+			}
+		}
+		if gid, err = strconv.ParseUint(g.Gid, 10, 32); err != nil {
+			return nil, fmt.Errorf("group %q has non-numeric gid %q", group, g.Gid)
+		}
+	}
+	return &Credential{UID: uint32(uid), GID: uint32(gid)}, nil
+}
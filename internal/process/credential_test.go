@@ -0,0 +1,52 @@
+//go:build linux
+
+package process
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"os/user"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLookupCredential(t *testing.T) {
+	current, err := user.Current()
+	require.NoError(t, err)
+	uid, _ := strconv.ParseUint(current.Uid, 10, 32)
+	gid, _ := strconv.ParseUint(current.Gid, 10, 32)
+
+	cred, err := LookupCredential(current.Username, "")
+	require.NoError(t, err)
+	assert.Equal(t, &Credential{UID: uint32(uid), GID: uint32(gid)}, cred)
+
+	// Numeric ids are accepted for both
+	cred, err = LookupCredential(current.Uid, current.Gid)
+	require.NoError(t, err)
+	assert.Equal(t, uint32(uid), cred.UID)
+	assert.Equal(t, uint32(gid), cred.GID)
+
+	_, err = LookupCredential("sboxagent-no-such-user", "")
+	assert.ErrorContains(t, err, `failed to look up user "sboxagent-no-such-user"`)
+	_, err = LookupCredential(current.Username, "sboxagent-no-such-group")
+	assert.ErrorContains(t, err, `failed to look up group "sboxagent-no-such-group"`)
+}
+
+func TestSetCredential(t *testing.T) {
+	if os.Geteuid() != 0 {
+		t.Skip("switching users needs root")
+	}
+
+	cmd := exec.CommandContext(context.Background(), "id", "-u")
+	Prepare(cmd)
+	require.NoError(t, SetCredential(cmd, &Credential{UID: 65534, GID: 65534}))
+	output, err := cmd.Output()
+	require.NoError(t, err)
+	assert.Equal(t, "65534", strings.TrimSpace(string(output)))
+	assert.True(t, cmd.SysProcAttr.Setpgid, "the process group must be kept")
+}
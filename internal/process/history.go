@@ -0,0 +1,155 @@
+package process
+
+import (
+	"errors"
+	"net/url"
+	"os/exec"
+	"sync"
+	"time"
+)
+
+// maxRunError bounds the error summary kept per run
+const maxRunError = 256
+
+// Run describes a finished command execution
+type Run struct {
+	// Service is the tool that ran, such as sboxctl or sboxmgr
+	Service string `json:"service"`
+	// Command has URLs cut to their host
+	Command []string  `json:"command"`
+	Start   time.Time `json:"start"`
+	// Duration is in seconds
+	Duration float64 `json:"duration"`
+	// ExitCode is -1 for commands that did not start or were killed
+	ExitCode    int    `json:"exitCode"`
+	OutputBytes int64  `json:"outputBytes"`
+	Error       string `json:"error,omitempty"`
+}
+
+// Succeeded reports whether the command exited without error
+func (r Run) Succeeded() bool {
+	return r.Error == "" && r.ExitCode == 0
+}
+
+// NewRun describes a command that started at start and finished now with
+// err, nil on success
+func NewRun(service string, command []string, start time.Time, output int64, err error) Run {
+	run := Run{
+		Service:     service,
+		Command:     redactCommand(command),
+		Start:       start,
+		Duration:    time.Since(start).Seconds(),
+		OutputBytes: output,
+	}
+	if err != nil {
+		run.ExitCode = ExitCode(err)
+		run.Error = err.Error()
+		if len(run.Error) > maxRunError {
+			run.Error = run.Error[:maxRunError] + "..."
+		}
+	}
+	return run
+}
+
+// redactCommand returns command with URLs cut to their host, as their
+// paths and queries often hold subscription tokens
+func redactCommand(command []string) []string {
+	out := make([]string, len(command))
+	for i, arg := range command {
+		out[i] = arg
+		if u, err := url.Parse(arg); err == nil && u.Scheme != "" && u.Host != "" {
+			out[i] = u.Scheme + "://" + u.Host + "/..."
+		}
+	}
+	return out
+}
+
+// ExitCode returns the exit code of a command that failed with err, or -1
+// if it did not start or was killed by a signal
+func ExitCode(err error) int {
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) && exitErr.Exited() {
+		return exitErr.ExitCode()
+	}
+	if err == nil {
+		return 0
+	}
+	return -1
+}
+
+// History keeps the most recent runs in memory, along with the last
+// successful run of each service however old. A nil History records
+// nothing.
+type History struct {
+	mu          sync.RWMutex
+	size        int
+	runs        []Run
+	lastSuccess map[string]Run
+}
+
+// NewHistory creates a history of the last size runs
+func NewHistory(size int) *History {
+	if size < 1 {
+		size = 1
+	}
+	return &History{size: size, lastSuccess: make(map[string]Run)}
+}
+
+// Add records a finished run, dropping the oldest beyond the size
+func (h *History) Add(run Run) {
+	if h == nil {
+		return
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.runs = append(h.runs, run)
+	if len(h.runs) > h.size {
+		h.runs = h.runs[len(h.runs)-h.size:]
+	}
+	if run.Succeeded() {
+		h.lastSuccess[run.Service] = run
+	}
+}
+
+// Runs returns up to limit runs of service, newest first. An empty service
+// matches all runs and a limit of zero or less returns all of them.
+func (h *History) Runs(service string, limit int) []Run {
+	runs := []Run{}
+	if h == nil {
+		return runs
+	}
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	for i := len(h.runs) - 1; i >= 0; i-- {
+		if service != "" && h.runs[i].Service != service {
+			continue
+		}
+		runs = append(runs, h.runs[i])
+		if limit > 0 && len(runs) == limit {
+			break
+		}
+	}
+	return runs
+}
+
+// LastSuccess returns the newest successful run of service, or of any
+// service if it is empty
+func (h *History) LastSuccess(service string) (Run, bool) {
+	if h == nil {
+		return Run{}, false
+	}
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	if service != "" {
+		run, ok := h.lastSuccess[service]
+		return run, ok
+	}
+	var last Run
+	found := false
+	for _, run := range h.lastSuccess {
+		if !found || run.Start.After(last.Start) {
+			last, found = run, true
+		}
+	}
+	return last, found
+}
@@ -0,0 +1,47 @@
+package process
+
+import (
+	"errors"
+	"os/exec"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHistory(t *testing.T) {
+	history := NewHistory(2)
+	start := time.Now().Add(-time.Minute)
+
+	history.Add(NewRun("sboxmgr", []string{"sboxmgr", "export", "--url", "https://sub.example.com/token?key=1"}, start, 10, nil))
+	history.Add(NewRun("sboxctl", []string{"sboxctl", "update"}, start.Add(time.Second), 0, errors.New("boom")))
+	history.Add(NewRun("sboxctl", []string{"sboxctl", "update"}, start.Add(2*time.Second), 5, nil))
+
+	runs := history.Runs("", 0)
+	require.Len(t, runs, 2)
+	assert.Equal(t, start.Add(2*time.Second), runs[0].Start)
+	assert.Equal(t, "boom", runs[1].Error)
+	assert.Equal(t, -1, runs[1].ExitCode)
+	assert.Len(t, history.Runs("sboxctl", 1), 1)
+	assert.Empty(t, history.Runs("sboxmgr", 0))
+
+	// The last success outlives the runs kept
+	run, ok := history.LastSuccess("sboxmgr")
+	require.True(t, ok)
+	assert.Equal(t, []string{"sboxmgr", "export", "--url", "https://sub.example.com/..."}, run.Command)
+	assert.Equal(t, int64(10), run.OutputBytes)
+	run, ok = history.LastSuccess("")
+	require.True(t, ok)
+	assert.Equal(t, "sboxctl", run.Service)
+
+	var empty *History
+	empty.Add(run)
+	assert.Empty(t, empty.Runs("", 0))
+}
+
+func TestExitCode(t *testing.T) {
+	assert.Equal(t, 0, ExitCode(nil))
+	assert.Equal(t, 3, ExitCode(exec.Command("sh", "-c", "exit 3").Run()))
+	assert.Equal(t, -1, ExitCode(errors.New("not started")))
+}
@@ -0,0 +1,43 @@
+package process
+
+import (
+	"fmt"
+	"os/exec"
+	"time"
+)
+
+// Limits are resource limits applied to a command, so a runaway child
+// cannot exhaust the host. Zero fields leave the inherited limit.
+type Limits struct {
+	// CPUTime is the processor time after which the process is killed,
+	// rounded up to whole seconds
+	CPUTime time.Duration
+	// Memory is the address space size in bytes
+	Memory uint64
+	// OpenFiles is the number of file descriptors
+	OpenFiles uint64
+}
+
+// IsZero reports whether no limit is set
+func (l *Limits) IsZero() bool {
+	return l == nil || *l == Limits{}
+}
+
+// StartLimited starts cmd like Start and applies limits to it. Limits are
+// set on the running process, so children it forks before they apply
+// inherit the agent's limits. If they cannot be applied the command is
+// killed and an error returned.
+func StartLimited(cmd *exec.Cmd, limits *Limits) error {
+	if err := Start(cmd); err != nil {
+		return err
+	}
+	if limits.IsZero() {
+		return nil
+	}
+	if err := setLimits(cmd.Process.Pid, limits); err != nil {
+		KillGroup(cmd)
+		Wait(cmd)
+		return fmt.Errorf("failed to set resource limits: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,34 @@
+package process
+
+import (
+	"fmt"
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+// setLimits sets the soft and hard limits of process pid
+func setLimits(pid int, limits *Limits) error {
+	if limits.CPUTime > 0 {
+		seconds := uint64((limits.CPUTime + time.Second - 1) / time.Second)
+		if err := prlimit(pid, unix.RLIMIT_CPU, seconds); err != nil {
+			return fmt.Errorf("cpu time: %w", err)
+		}
+	}
+	if limits.Memory > 0 {
+		if err := prlimit(pid, unix.RLIMIT_AS, limits.Memory); err != nil {
+			return fmt.Errorf("memory: %w", err)
+		}
+	}
+	if limits.OpenFiles > 0 {
+		if err := prlimit(pid, unix.RLIMIT_NOFILE, limits.OpenFiles); err != nil {
+			return fmt.Errorf("open files: %w", err)
+		}
+	}
+	return nil
+}
+
+// prlimit sets both limits of resource to value
+func prlimit(pid, resource int, value uint64) error {
+	return unix.Prlimit(pid, resource, &unix.Rlimit{Cur: value, Max: value}, nil)
+}
@@ -0,0 +1,10 @@
+//go:build !linux
+
+package process
+
+import "fmt"
+
+// setLimits fails where limits cannot be set on another process
+func setLimits(pid int, limits *Limits) error {
+	return fmt.Errorf("not supported on this platform")
+}
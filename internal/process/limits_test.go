@@ -0,0 +1,48 @@
+//go:build linux
+
+package process
+
+import (
+	"context"
+	"os/exec"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/sys/unix"
+)
+
+func TestStartLimited(t *testing.T) {
+	cmd := exec.CommandContext(context.Background(), "sleep", "5")
+	Prepare(cmd)
+	require.NoError(t, StartLimited(cmd, &Limits{
+		CPUTime:   1500 * time.Millisecond,
+		Memory:    1 << 30,
+		OpenFiles: 64,
+	}))
+	defer func() {
+		KillGroup(cmd)
+		Wait(cmd)
+	}()
+
+	limit := func(resource int) uint64 {
+		var rlimit unix.Rlimit
+		require.NoError(t, unix.Prlimit(cmd.Process.Pid, resource, nil, &rlimit))
+		assert.Equal(t, rlimit.Cur, rlimit.Max)
+		return rlimit.Cur
+	}
+	assert.Equal(t, uint64(2), limit(unix.RLIMIT_CPU), "cpu time is rounded up to seconds")
+	assert.Equal(t, uint64(1<<30), limit(unix.RLIMIT_AS))
+	assert.Equal(t, uint64(64), limit(unix.RLIMIT_NOFILE))
+}
+
+func TestStartLimited_NoLimits(t *testing.T) {
+	assert.True(t, (*Limits)(nil).IsZero())
+	assert.True(t, (&Limits{}).IsZero())
+
+	cmd := exec.CommandContext(context.Background(), "true")
+	Prepare(cmd)
+	require.NoError(t, StartLimited(cmd, &Limits{}))
+	assert.NoError(t, Wait(cmd))
+}
@@ -0,0 +1,100 @@
+package process
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync/atomic"
+	"time"
+)
+
+// ErrQueueTimeout is returned when no command slot frees up in time
+var ErrQueueTimeout = errors.New("timed out waiting for a free command slot")
+
+// Pool bounds how many commands run at once. Callers beyond the limit queue
+// until a slot frees up or the queue timeout passes. A nil Pool does not
+// limit anything.
+type Pool struct {
+	slots        chan struct{}
+	queueTimeout time.Duration
+
+	queued    int64
+	completed int64
+	rejected  int64
+}
+
+// PoolStats describes the slots and queue of a Pool
+type PoolStats struct {
+	Capacity  int   `json:"capacity"`
+	Running   int   `json:"running"`
+	Queued    int64 `json:"queued"`
+	Completed int64 `json:"completed"`
+	// Rejected counts commands that gave up waiting for a slot
+	Rejected int64 `json:"rejected"`
+}
+
+// NewPool creates a pool running up to size commands at once. Queued
+// callers wait at most queueTimeout; zero waits as long as their context.
+func NewPool(size int, queueTimeout time.Duration) *Pool {
+	if size < 1 {
+		size = 1
+	}
+	return &Pool{
+		slots:        make(chan struct{}, size),
+		queueTimeout: queueTimeout,
+	}
+}
+
+// Acquire waits for a free slot and returns the function releasing it
+func (p *Pool) Acquire(ctx context.Context) (func(), error) {
+	if p == nil {
+		return func() {}, nil
+	}
+
+	// Fast path without queueing
+	select {
+	case p.slots <- struct{}{}:
+		return p.release, nil
+	default:
+	}
+
+	atomic.AddInt64(&p.queued, 1)
+	defer atomic.AddInt64(&p.queued, -1)
+
+	var timeout <-chan time.Time
+	if p.queueTimeout > 0 {
+		timer := time.NewTimer(p.queueTimeout)
+		defer timer.Stop()
+		timeout = timer.C
+	}
+	select {
+	case p.slots <- struct{}{}:
+		return p.release, nil
+	case <-timeout:
+		atomic.AddInt64(&p.rejected, 1)
+		return nil, fmt.Errorf("%w after %s", ErrQueueTimeout, p.queueTimeout)
+	case <-ctx.Done():
+		atomic.AddInt64(&p.rejected, 1)
+		return nil, ctx.Err()
+	}
+}
+
+// release frees a slot taken by Acquire
+func (p *Pool) release() {
+	<-p.slots
+	atomic.AddInt64(&p.completed, 1)
+}
+
+// Stats returns the current slot usage and queue
+func (p *Pool) Stats() PoolStats {
+	if p == nil {
+		return PoolStats{}
+	}
+	return PoolStats{
+		Capacity:  cap(p.slots),
+		Running:   len(p.slots),
+		Queued:    atomic.LoadInt64(&p.queued),
+		Completed: atomic.LoadInt64(&p.completed),
+		Rejected:  atomic.LoadInt64(&p.rejected),
+	}
+}
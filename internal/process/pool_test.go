@@ -0,0 +1,68 @@
+package process
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPool_Acquire(t *testing.T) {
+	pool := NewPool(2, 50*time.Millisecond)
+
+	first, err := pool.Acquire(context.Background())
+	require.NoError(t, err)
+	second, err := pool.Acquire(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, PoolStats{Capacity: 2, Running: 2}, pool.Stats())
+
+	// A third command queues and gives up after the queue timeout
+	_, err = pool.Acquire(context.Background())
+	assert.True(t, errors.Is(err, ErrQueueTimeout))
+	assert.Equal(t, int64(1), pool.Stats().Rejected)
+
+	// A queued command runs once a slot is released
+	acquired := make(chan func(), 1)
+	go func() {
+		release, err := pool.Acquire(context.Background())
+		if err == nil {
+			acquired <- release
+		}
+	}()
+	require.Eventually(t, func() bool { return pool.Stats().Queued == 1 }, time.Second, time.Millisecond)
+	first()
+	select {
+	case release := <-acquired:
+		release()
+	case <-time.After(time.Second):
+		t.Fatal("queued command did not get a slot")
+	}
+	second()
+
+	stats := pool.Stats()
+	assert.Equal(t, 0, stats.Running)
+	assert.Equal(t, int64(0), stats.Queued)
+	assert.Equal(t, int64(3), stats.Completed)
+}
+
+func TestPool_AcquireCancelled(t *testing.T) {
+	pool := NewPool(1, 0)
+	release, err := pool.Acquire(context.Background())
+	require.NoError(t, err)
+	defer release()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	_, err = pool.Acquire(ctx)
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+
+	// A nil pool does not limit commands
+	var unlimited *Pool
+	release, err = unlimited.Acquire(context.Background())
+	require.NoError(t, err)
+	release()
+	assert.Equal(t, PoolStats{}, unlimited.Stats())
+}
@@ -0,0 +1,135 @@
+// Package process runs child commands in their own process groups so the
+// whole tree can be killed on timeout or shutdown, and reaps orphans left
+// behind by those groups.
+package process
+
+import (
+	"os/exec"
+	"sync"
+	"time"
+)
+
+// DefaultWaitDelay bounds how long Wait waits for output pipes held open by
+// orphaned grandchildren after the command exits or is cancelled
+const DefaultWaitDelay = 5 * time.Second
+
+// reapTimeout bounds how long Cleanup waits for killed orphans to exit
+const reapTimeout = time.Second
+
+// DefaultKillGrace is how long a cancelled command has to exit after
+// SIGTERM before its group is killed
+const DefaultKillGrace = 3 * time.Second
+
+// killGrace is the grace period of cancelled commands
+var killGrace = DefaultKillGrace
+
+// graceTimers holds the pending group kills of cancelled commands by
+// command, stopped once the command is waited for
+var graceTimers sync.Map
+
+// Prepare configures cmd to run in a new process group. If cmd was created
+// with exec.CommandContext, cancelling the context sends SIGTERM to the
+// whole group instead of only the direct child, and SIGKILL if the command
+// is still running after DefaultKillGrace. A bare executable name is looked
+// up in the PATH of cmd.Env when it sets one. Prepare must be called after
+// setting Env and before Start.
+func Prepare(cmd *exec.Cmd) {
+	resolvePath(cmd)
+	setProcessGroup(cmd)
+	cmd.Cancel = func() error {
+		return TerminateGroup(cmd, killGrace)
+	}
+	if cmd.WaitDelay == 0 {
+		cmd.WaitDelay = DefaultWaitDelay
+	}
+}
+
+// KillGroup kills every process in the command's process group
+func KillGroup(cmd *exec.Cmd) error {
+	if cmd.Process == nil {
+		return nil
+	}
+	return killGroup(cmd.Process.Pid)
+}
+
+// TerminateGroup sends SIGTERM to the command's process group and kills
+// the group if the command has not been waited for within grace. Where
+// process groups are not supported the process is killed at once.
+func TerminateGroup(cmd *exec.Cmd, grace time.Duration) error {
+	if cmd.Process == nil {
+		return nil
+	}
+	pgid := cmd.Process.Pid
+	if err := terminateGroup(pgid); err != nil {
+		return err
+	}
+	graceTimers.Store(cmd, time.AfterFunc(grace, func() {
+		killGroup(pgid)
+	}))
+	return nil
+}
+
+// Cleanup kills processes left in the command's group after Wait returned
+// and reaps those that were reparented to the agent. It is a no-op if the
+// group is already empty.
+func Cleanup(cmd *exec.Cmd) {
+	if cmd.Process == nil {
+		return
+	}
+	pgid := cmd.Process.Pid
+	if killGroup(pgid) != nil {
+		// No processes left in the group
+		return
+	}
+	reapGroup(pgid, reapTimeout)
+}
+
+// tracked holds the PIDs of commands started with Start that have not been
+// waited for yet, with their start times. The orphan reaper never reaps
+// these.
+var tracked = struct {
+	sync.Mutex
+	pids map[int]time.Time
+}{pids: make(map[int]time.Time)}
+
+// Start starts cmd and tracks it so the orphan reaper leaves it to Wait
+func Start(cmd *exec.Cmd) error {
+	tracked.Lock()
+	started := time.Now()
+	err := cmd.Start()
+	if err == nil {
+		tracked.pids[cmd.Process.Pid] = started
+	}
+	tracked.Unlock()
+
+	if err != nil {
+		audit(cmd, started, err)
+	}
+	return err
+}
+
+// Wait waits for a command started with Start, then kills and reaps anything
+// left in its process group
+func Wait(cmd *exec.Cmd) error {
+	err := cmd.Wait()
+
+	tracked.Lock()
+	started := tracked.pids[cmd.Process.Pid]
+	delete(tracked.pids, cmd.Process.Pid)
+	tracked.Unlock()
+	audit(cmd, started, err)
+
+	// The group may be reused once the command is reaped
+	if timer, ok := graceTimers.LoadAndDelete(cmd); ok {
+		timer.(*time.Timer).Stop()
+	}
+	Cleanup(cmd)
+	return err
+}
+
+// isTracked reports whether pid belongs to a command awaiting Wait. Caller
+// must hold tracked.
+func isTracked(pid int) bool {
+	_, ok := tracked.pids[pid]
+	return ok
+}
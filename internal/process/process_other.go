@@ -0,0 +1,62 @@
+//go:build !unix
+
+package process
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"time"
+)
+
+// resolvePath keeps the lookup of exec.Command, which uses the agent's PATH
+func resolvePath(cmd *exec.Cmd) {}
+
+// setProcessGroup is a no-op where process groups are not supported
+func setProcessGroup(cmd *exec.Cmd) {}
+
+// SetCredential fails for any cred where switching users is not supported
+func SetCredential(cmd *exec.Cmd, cred *Credential) error {
+	if cred == nil {
+		return nil
+	}
+	return fmt.Errorf("running commands as another user is not supported on this platform")
+}
+
+// commandCredential returns the agent's user and group, which commands
+// always run as here
+func commandCredential(cmd *exec.Cmd) (int, int) {
+	return os.Getuid(), os.Getgid()
+}
+
+// Alive reports whether a process with pid exists
+func Alive(pid int) bool {
+	if pid <= 0 {
+		return false
+	}
+	p, err := os.FindProcess(pid)
+	if err != nil {
+		return false
+	}
+	p.Release()
+	return true
+}
+
+// terminateGroup kills the process at once where signals other than kill
+// are not supported
+func terminateGroup(pid int) error {
+	return killGroup(pid)
+}
+
+// killGroup kills only the process itself where process groups are not
+// supported
+func killGroup(pid int) error {
+	p, err := os.FindProcess(pid)
+	if err != nil {
+		return err
+	}
+	return p.Kill()
+}
+
+// reapGroup is a no-op where orphans are not reparented to the agent
+func reapGroup(pgid int, timeout time.Duration) {}
@@ -0,0 +1,121 @@
+//go:build linux
+
+package process
+
+import (
+	"bufio"
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// startWithChild starts a shell that backgrounds a long sleep and prints its
+// PID, returning the command and the grandchild PID
+func startWithChild(t *testing.T, ctx context.Context, script string) (*exec.Cmd, int) {
+	cmd := exec.CommandContext(ctx, "sh", "-c", script)
+	Prepare(cmd)
+	stdout, err := cmd.StdoutPipe()
+	require.NoError(t, err)
+	require.NoError(t, Start(cmd))
+
+	line, err := bufio.NewReader(stdout).ReadString('\n')
+	require.NoError(t, err)
+	pid, err := strconv.Atoi(strings.TrimSpace(line))
+	require.NoError(t, err)
+	return cmd, pid
+}
+
+// processGone reports whether pid no longer exists or is a zombie
+func processGone(pid int) bool {
+	if err := syscall.Kill(pid, 0); err != nil {
+		return true
+	}
+	data, err := os.ReadFile("/proc/" + strconv.Itoa(pid) + "/stat")
+	if err != nil {
+		return true
+	}
+	// The state follows the parenthesized command name
+	stat := string(data)
+	fields := strings.Fields(stat[strings.LastIndex(stat, ")")+1:])
+	return len(fields) > 0 && fields[0] == "Z"
+}
+
+func TestPrepare_CancelKillsGroup(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cmd, child := startWithChild(t, ctx, "sleep 30 & echo $!; wait")
+
+	cancel()
+	start := time.Now()
+	assert.Error(t, Wait(cmd))
+	assert.Less(t, time.Since(start), DefaultWaitDelay)
+
+	assert.Eventually(t, func() bool { return processGone(child) }, 2*time.Second, 20*time.Millisecond)
+}
+
+func TestPrepare_CancelKillsGroupAfterGrace(t *testing.T) {
+	killGrace = 300 * time.Millisecond
+	defer func() { killGrace = DefaultKillGrace }()
+
+	// The whole group ignores SIGTERM, so only the kill ends it
+	ctx, cancel := context.WithCancel(context.Background())
+	cmd, child := startWithChild(t, ctx, "trap '' TERM; sleep 30 & echo $!; wait")
+
+	cancel()
+	start := time.Now()
+	assert.Error(t, Wait(cmd))
+	elapsed := time.Since(start)
+	assert.GreaterOrEqual(t, elapsed, killGrace)
+	assert.Less(t, elapsed, DefaultWaitDelay)
+
+	assert.Eventually(t, func() bool { return processGone(child) }, 2*time.Second, 20*time.Millisecond)
+}
+
+func TestWait_KillsLeftoverGroupMembers(t *testing.T) {
+	// The shell exits immediately, leaving the sleep behind in its group
+	cmd, child := startWithChild(t, context.Background(), "sleep 30 & echo $!")
+
+	assert.NoError(t, Wait(cmd))
+	assert.Eventually(t, func() bool { return processGone(child) }, 2*time.Second, 20*time.Millisecond)
+}
+
+func TestReapOrphans(t *testing.T) {
+	require.NoError(t, EnableSubreaper())
+
+	// The backgrounded sleep is orphaned and reparented to the test process
+	require.NoError(t, exec.Command("sh", "-c", "(sleep 0.1 &); echo started").Run())
+
+	var reaped []int
+	assert.Eventually(t, func() bool {
+		ReapOrphans(func(pid int, status syscall.WaitStatus) {
+			reaped = append(reaped, pid)
+		})
+		return len(reaped) > 0
+	}, 3*time.Second, 50*time.Millisecond)
+}
+
+func TestPrepare_ResolvesEnvPath(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "sboxtool"), []byte("#!/bin/sh\necho found\n"), 0755))
+
+	cmd := exec.CommandContext(context.Background(), "sboxtool")
+	cmd.Env = []string{"PATH=/nonexistent", "PATH=" + dir}
+	Prepare(cmd)
+	output, err := cmd.Output()
+	require.NoError(t, err)
+	assert.Equal(t, "found\n", string(output))
+
+	// The PATH of the environment replaces the agent's for the lookup
+	cmd = exec.CommandContext(context.Background(), "sh", "-c", "true")
+	cmd.Env = []string{"PATH=" + dir}
+	Prepare(cmd)
+	assert.ErrorIs(t, cmd.Run(), exec.ErrNotFound)
+}
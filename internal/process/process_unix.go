@@ -0,0 +1,123 @@
+//go:build unix
+
+package process
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// resolvePath looks up a bare executable name in the PATH of cmd.Env, which
+// may differ from the agent's own PATH
+func resolvePath(cmd *exec.Cmd) {
+	if len(cmd.Args) == 0 || strings.Contains(cmd.Args[0], "/") {
+		return
+	}
+	path, ok := envValue(cmd.Env, "PATH")
+	if !ok {
+		return
+	}
+	for _, dir := range filepath.SplitList(path) {
+		if dir == "" {
+			continue
+		}
+		candidate := filepath.Join(dir, cmd.Args[0])
+		info, err := os.Stat(candidate)
+		if err == nil && !info.IsDir() && info.Mode()&0111 != 0 {
+			cmd.Path = candidate
+			cmd.Err = nil
+			return
+		}
+	}
+	cmd.Err = fmt.Errorf("%w: %s in PATH %s", exec.ErrNotFound, cmd.Args[0], path)
+}
+
+// envValue returns the last value of a variable in KEY=value entries, which
+// is the one a process sees
+func envValue(env []string, name string) (string, bool) {
+	for i := len(env) - 1; i >= 0; i-- {
+		if value, ok := strings.CutPrefix(env[i], name+"="); ok {
+			return value, true
+		}
+	}
+	return "", false
+}
+
+// setProcessGroup starts cmd as the leader of a new process group
+func setProcessGroup(cmd *exec.Cmd) {
+	if cmd.SysProcAttr == nil {
+		cmd.SysProcAttr = &syscall.SysProcAttr{}
+	}
+	cmd.SysProcAttr.Setpgid = true
+}
+
+// SetCredential makes cmd run as the user and group of cred, without
+// supplementary groups. A nil cred keeps the agent's user. It must be called
+// after Prepare.
+func SetCredential(cmd *exec.Cmd, cred *Credential) error {
+	if cred == nil {
+		return nil
+	}
+	if cmd.SysProcAttr == nil {
+		cmd.SysProcAttr = &syscall.SysProcAttr{}
+	}
+	cmd.SysProcAttr.Credential = &syscall.Credential{Uid: cred.UID, Gid: cred.GID}
+	return nil
+}
+
+// commandCredential returns the user and group cmd runs as
+func commandCredential(cmd *exec.Cmd) (int, int) {
+	if cmd.SysProcAttr != nil && cmd.SysProcAttr.Credential != nil {
+		return int(cmd.SysProcAttr.Credential.Uid), int(cmd.SysProcAttr.Credential.Gid)
+	}
+	return os.Getuid(), os.Getgid()
+}
+
+// Alive reports whether a process with pid exists, including processes of
+// other users the agent may not signal
+func Alive(pid int) bool {
+	if pid <= 0 {
+		return false
+	}
+	err := syscall.Kill(pid, 0)
+	return err == nil || errors.Is(err, syscall.EPERM)
+}
+
+// terminateGroup sends SIGTERM to the process group pgid
+func terminateGroup(pgid int) error {
+	return syscall.Kill(-pgid, syscall.SIGTERM)
+}
+
+// killGroup sends SIGKILL to the process group pgid
+func killGroup(pgid int) error {
+	return syscall.Kill(-pgid, syscall.SIGKILL)
+}
+
+// reapGroup waits for exited children in group pgid until none are left or
+// timeout elapses. Only processes reparented to the agent are its children.
+func reapGroup(pgid int, timeout time.Duration) {
+	deadline := time.Now().Add(timeout)
+	for {
+		var status syscall.WaitStatus
+		pid, err := syscall.Wait4(-pgid, &status, syscall.WNOHANG, nil)
+		if errors.Is(err, syscall.ECHILD) {
+			return
+		}
+		if err != nil && !errors.Is(err, syscall.EINTR) {
+			return
+		}
+		if pid > 0 {
+			continue
+		}
+		if time.Now().After(deadline) {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
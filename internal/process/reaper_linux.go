@@ -0,0 +1,87 @@
+package process
+
+import (
+	"context"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+// EnableSubreaper marks the agent as a child subreaper, so orphaned
+// descendants are reparented to it instead of init and can be reaped.
+func EnableSubreaper() error {
+	return unix.Prctl(unix.PR_SET_CHILD_SUBREAPER, 1, 0, 0, 0)
+}
+
+// RunReaper reaps exited children that are not tracked by Start, such as
+// orphans reparented to the agent, until ctx is cancelled. onReap, if not
+// nil, is called for each reaped process. While the reaper runs, all child
+// processes must be started with Start so their exit status is left to Wait.
+func RunReaper(ctx context.Context, interval time.Duration, onReap func(pid int, status syscall.WaitStatus)) {
+	sigChan := make(chan os.Signal, 1)
+	signal.Notify(sigChan, syscall.SIGCHLD)
+	defer signal.Stop(sigChan)
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		ReapOrphans(onReap)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-sigChan:
+		case <-ticker.C:
+		}
+	}
+}
+
+// ReapOrphans reaps exited untracked children once and returns how many
+// were reaped
+func ReapOrphans(onReap func(pid int, status syscall.WaitStatus)) int {
+	tracked.Lock()
+	defer tracked.Unlock()
+
+	reaped := 0
+	for _, pid := range childPIDs() {
+		if isTracked(pid) {
+			continue
+		}
+		var status syscall.WaitStatus
+		wpid, err := syscall.Wait4(pid, &status, syscall.WNOHANG, nil)
+		if err != nil || wpid != pid {
+			continue
+		}
+		reaped++
+		if onReap != nil {
+			onReap(pid, status)
+		}
+	}
+	return reaped
+}
+
+// childPIDs lists the agent's direct children from /proc
+func childPIDs() []int {
+	files, _ := filepath.Glob("/proc/self/task/*/children")
+
+	var pids []int
+	for _, file := range files {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			continue
+		}
+		for _, field := range strings.Fields(string(data)) {
+			if pid, err := strconv.Atoi(field); err == nil {
+				pids = append(pids, pid)
+			}
+		}
+	}
+	return pids
+}
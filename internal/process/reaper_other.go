@@ -0,0 +1,25 @@
+//go:build !linux
+
+package process
+
+import (
+	"context"
+	"syscall"
+	"time"
+)
+
+// EnableSubreaper is a no-op on platforms without child subreapers
+func EnableSubreaper() error {
+	return nil
+}
+
+// RunReaper blocks until ctx is cancelled; orphans are reparented to init on
+// platforms without child subreapers
+func RunReaper(ctx context.Context, interval time.Duration, onReap func(pid int, status syscall.WaitStatus)) {
+	<-ctx.Done()
+}
+
+// ReapOrphans is a no-op on platforms without child subreapers
+func ReapOrphans(onReap func(pid int, status syscall.WaitStatus)) int {
+	return 0
+}
@@ -0,0 +1,64 @@
+package schedule
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCron_Next(t *testing.T) {
+	// Wednesday
+	start := time.Date(2025, 6, 25, 10, 17, 30, 0, time.UTC)
+
+	tests := []struct {
+		expr string
+		want time.Time
+	}{
+		{"0 4 * * *", time.Date(2025, 6, 26, 4, 0, 0, 0, time.UTC)},
+		{"@daily", time.Date(2025, 6, 26, 0, 0, 0, 0, time.UTC)},
+		{"@hourly", time.Date(2025, 6, 25, 11, 0, 0, 0, time.UTC)},
+		{"*/15 * * * *", time.Date(2025, 6, 25, 10, 30, 0, 0, time.UTC)},
+		{"20-40/10 10 * * *", time.Date(2025, 6, 25, 10, 20, 0, 0, time.UTC)},
+		{"0 9 * * mon-fri", time.Date(2025, 6, 26, 9, 0, 0, 0, time.UTC)},
+		{"0 0 * * 7", time.Date(2025, 6, 29, 0, 0, 0, 0, time.UTC)},
+		{"30 2 1 jan,jul *", time.Date(2025, 7, 1, 2, 30, 0, 0, time.UTC)},
+		// Either restricted day field fires: the 1st or any Monday
+		{"0 0 1 * mon", time.Date(2025, 6, 30, 0, 0, 0, 0, time.UTC)},
+		{"0 0 29 2 *", time.Date(2028, 2, 29, 0, 0, 0, 0, time.UTC)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.expr, func(t *testing.T) {
+			cron, err := Parse(tt.expr)
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, cron.Next(start))
+			assert.Equal(t, tt.expr, cron.String())
+		})
+	}
+}
+
+func TestCron_NextNever(t *testing.T) {
+	cron, err := Parse("0 0 30 feb *")
+	require.NoError(t, err)
+	assert.True(t, cron.Next(time.Now()).IsZero())
+}
+
+func TestParse_Invalid(t *testing.T) {
+	for _, expr := range []string{
+		"",
+		"* * * *",
+		"60 * * * *",
+		"* 24 * * *",
+		"* * 0 * *",
+		"* * * 13 *",
+		"* * * * 8",
+		"*/0 * * * *",
+		"10-5 * * * *",
+		"* * * foo *",
+		"@fortnightly",
+	} {
+		_, err := Parse(expr)
+		assert.Error(t, err, expr)
+	}
+}
@@ -0,0 +1,136 @@
+// Package security provides access control helpers shared by the agent's
+// network transports.
+package security
+
+import (
+	"fmt"
+	"net"
+	"strings"
+)
+
+// LoopbackNetworks are the networks allowed when the remote API is disabled
+var LoopbackNetworks = []string{"127.0.0.0/8", "::1"}
+
+// Decision is the result of an access check
+type Decision struct {
+	Allowed bool   `json:"allowed"`
+	Reason  string `json:"reason"`
+	IP      string `json:"ip"`
+}
+
+// AccessList is a CIDR-aware allowlist/denylist. Deny entries always win;
+// an empty allowlist allows every address that is not denied.
+type AccessList struct {
+	allow []*net.IPNet
+	deny  []*net.IPNet
+}
+
+// NewAccessList parses allow and deny entries. Entries may be single IP
+// addresses or CIDR ranges.
+func NewAccessList(allowed, denied []string) (*AccessList, error) {
+	allow, err := parseNetworks(allowed)
+	if err != nil {
+		return nil, fmt.Errorf("invalid allowed host: %w", err)
+	}
+	deny, err := parseNetworks(denied)
+	if err != nil {
+		return nil, fmt.Errorf("invalid denied host: %w", err)
+	}
+	return &AccessList{allow: allow, deny: deny}, nil
+}
+
+// Check decides whether ip may access the agent
+func (l *AccessList) Check(ip net.IP) Decision {
+	if ip == nil {
+		return Decision{Allowed: false, Reason: "unparseable address"}
+	}
+
+	decision := Decision{IP: ip.String()}
+
+	for _, network := range l.deny {
+		if network.Contains(ip) {
+			decision.Reason = "denied by " + network.String()
+			return decision
+		}
+	}
+
+	if len(l.allow) == 0 {
+		decision.Allowed = true
+		decision.Reason = "no allowlist configured"
+		return decision
+	}
+
+	for _, network := range l.allow {
+		if network.Contains(ip) {
+			decision.Allowed = true
+			decision.Reason = "allowed by " + network.String()
+			return decision
+		}
+	}
+
+	decision.Reason = "not in allowlist"
+	return decision
+}
+
+// CheckAddr decides whether a network address may access the agent. Unix
+// socket peers are local and always allowed.
+func (l *AccessList) CheckAddr(addr net.Addr) Decision {
+	switch a := addr.(type) {
+	case *net.UnixAddr:
+		return Decision{Allowed: true, Reason: "unix socket"}
+	case *net.TCPAddr:
+		return l.Check(a.IP)
+	case *net.UDPAddr:
+		return l.Check(a.IP)
+	case nil:
+		return Decision{Allowed: false, Reason: "unknown address"}
+	default:
+		return l.CheckRemoteAddr(addr.String())
+	}
+}
+
+// CheckRemoteAddr decides on a "host:port" or bare host string, as found in
+// http.Request.RemoteAddr
+func (l *AccessList) CheckRemoteAddr(remoteAddr string) Decision {
+	host := remoteAddr
+	if h, _, err := net.SplitHostPort(remoteAddr); err == nil {
+		host = h
+	}
+	// Strip IPv6 zone
+	if i := strings.LastIndex(host, "%"); i >= 0 {
+		host = host[:i]
+	}
+	return l.Check(net.ParseIP(host))
+}
+
+// parseNetworks converts IP and CIDR strings to networks
+func parseNetworks(entries []string) ([]*net.IPNet, error) {
+	networks := make([]*net.IPNet, 0, len(entries))
+	for _, entry := range entries {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+
+		if strings.Contains(entry, "/") {
+			_, network, err := net.ParseCIDR(entry)
+			if err != nil {
+				return nil, fmt.Errorf("%q: %w", entry, err)
+			}
+			networks = append(networks, network)
+			continue
+		}
+
+		ip := net.ParseIP(entry)
+		if ip == nil {
+			return nil, fmt.Errorf("%q is not an IP address or CIDR range", entry)
+		}
+		bits := 128
+		if ip.To4() != nil {
+			ip = ip.To4()
+			bits = 32
+		}
+		networks = append(networks, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+	}
+	return networks, nil
+}
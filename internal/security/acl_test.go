@@ -0,0 +1,66 @@
+package security
+
+import (
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewAccessList_Invalid(t *testing.T) {
+	_, err := NewAccessList([]string{"not-an-ip"}, nil)
+	assert.Error(t, err)
+
+	_, err = NewAccessList(nil, []string{"10.0.0.0/99"})
+	assert.Error(t, err)
+}
+
+func TestAccessList_Check(t *testing.T) {
+	acl, err := NewAccessList(
+		[]string{"127.0.0.1", "::1", "192.168.0.0/16"},
+		[]string{"192.168.66.0/24"},
+	)
+	require.NoError(t, err)
+
+	tests := []struct {
+		ip      string
+		allowed bool
+	}{
+		{"127.0.0.1", true},
+		{"::1", true},
+		{"192.168.1.10", true},
+		{"192.168.66.5", false}, // denylist wins
+		{"10.0.0.1", false},
+		{"::ffff:192.168.1.10", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.ip, func(t *testing.T) {
+			decision := acl.Check(net.ParseIP(tt.ip))
+			assert.Equal(t, tt.allowed, decision.Allowed, decision.Reason)
+		})
+	}
+}
+
+func TestAccessList_EmptyAllowlist(t *testing.T) {
+	acl, err := NewAccessList(nil, []string{"203.0.113.7"})
+	require.NoError(t, err)
+
+	assert.True(t, acl.Check(net.ParseIP("198.51.100.1")).Allowed)
+	assert.False(t, acl.Check(net.ParseIP("203.0.113.7")).Allowed)
+}
+
+func TestAccessList_CheckAddr(t *testing.T) {
+	acl, err := NewAccessList([]string{"127.0.0.1"}, nil)
+	require.NoError(t, err)
+
+	assert.True(t, acl.CheckAddr(&net.UnixAddr{Name: "/run/sboxagent.sock", Net: "unix"}).Allowed)
+	assert.True(t, acl.CheckAddr(&net.TCPAddr{IP: net.ParseIP("127.0.0.1"), Port: 5000}).Allowed)
+	assert.False(t, acl.CheckAddr(&net.TCPAddr{IP: net.ParseIP("10.1.1.1"), Port: 5000}).Allowed)
+	assert.False(t, acl.CheckAddr(nil).Allowed)
+
+	assert.True(t, acl.CheckRemoteAddr("127.0.0.1:41234").Allowed)
+	assert.False(t, acl.CheckRemoteAddr("[fe80::1%eth0]:80").Allowed)
+	assert.False(t, acl.CheckRemoteAddr("garbage").Allowed)
+}
@@ -0,0 +1,152 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os/exec"
+	"time"
+
+	"github.com/kpblcaoo/sboxagent/internal/process"
+)
+
+// ErrCircuitOpen is returned by TriggerRun while repeated failures keep the
+// circuit open
+var ErrCircuitOpen = errors.New("sboxctl circuit is open")
+
+// circuit counts consecutive failed runs. At the configured threshold it
+// opens and runs are skipped until the cooldown has passed and the probe
+// command succeeds.
+type circuit struct {
+	failures int
+	open     bool
+	until    time.Time
+}
+
+// SetCircuitHook sets a function called when the circuit opens, with the
+// consecutive failures and the last error, and when it closes again
+func (s *SboxctlService) SetCircuitHook(hook func(open bool, failures int, err error)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.circuitHook = hook
+}
+
+// circuitBlocked reports whether the circuit is open and still cooling down
+func (s *SboxctlService) circuitBlocked(now time.Time) bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.circuit.open && now.Before(s.circuit.until)
+}
+
+// circuitAllows reports whether a run may start. Once the cooldown of an
+// open circuit has passed the probe command runs; the circuit closes if it
+// succeeds and stays open for another cooldown otherwise.
+func (s *SboxctlService) circuitAllows(now time.Time) bool {
+	s.mu.RLock()
+	open, until := s.circuit.open, s.circuit.until
+	s.mu.RUnlock()
+	if !open {
+		return true
+	}
+	if now.Before(until) {
+		s.logger.Debug("Skipping sboxctl run while circuit is open", map[string]interface{}{
+			"until": until,
+		})
+		return false
+	}
+
+	if err := s.probe(); err != nil {
+		s.mu.Lock()
+		s.circuit.until = now.Add(s.config.CircuitBreaker.Cooldown)
+		s.mu.Unlock()
+		s.logger.Warn("Sboxctl probe failed, keeping circuit open", map[string]interface{}{
+			"command": s.config.CircuitBreaker.ProbeCommand,
+			"error":   err.Error(),
+			"until":   now.Add(s.config.CircuitBreaker.Cooldown),
+		})
+		return false
+	}
+
+	// A single failure opens the circuit again
+	s.mu.Lock()
+	s.circuit.open = false
+	s.circuit.failures = s.config.CircuitBreaker.Threshold - 1
+	hook := s.circuitHook
+	s.mu.Unlock()
+	s.logger.Info("Sboxctl circuit closed", map[string]interface{}{})
+	if hook != nil {
+		hook(false, 0, nil)
+	}
+	return true
+}
+
+// recordCircuit counts a run's outcome, opening the circuit when failures
+// reach the threshold
+func (s *SboxctlService) recordCircuit(err error) {
+	threshold := s.config.CircuitBreaker.Threshold
+	if threshold <= 0 {
+		return
+	}
+
+	s.mu.Lock()
+	if err == nil {
+		s.circuit.failures = 0
+		s.mu.Unlock()
+		return
+	}
+	s.circuit.failures++
+	failures := s.circuit.failures
+	if s.circuit.open || failures < threshold {
+		s.mu.Unlock()
+		return
+	}
+	s.circuit.open = true
+	s.circuit.until = time.Now().Add(s.config.CircuitBreaker.Cooldown)
+	hook := s.circuitHook
+	s.mu.Unlock()
+
+	s.logger.Error("Sboxctl circuit opened after repeated failures", map[string]interface{}{
+		"failures": failures,
+		"cooldown": s.config.CircuitBreaker.Cooldown.String(),
+		"error":    err.Error(),
+	})
+	if hook != nil {
+		hook(true, failures, err)
+	}
+}
+
+// probe runs the probe command, which succeeds if no command is configured
+func (s *SboxctlService) probe() error {
+	args := s.config.CircuitBreaker.ProbeCommand
+	if len(args) == 0 {
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(s.ctx, s.config.Timeout)
+	defer cancel()
+
+	cmd := exec.CommandContext(ctx, args[0], args[1:]...)
+	cmd.Env = s.getEnv()
+	cmd.Dir = s.config.WorkDir
+	process.Prepare(cmd)
+	if err := process.SetCredential(cmd, s.getCredential()); err != nil {
+		return err
+	}
+	if err := process.StartLimited(cmd, s.getLimits()); err != nil {
+		return fmt.Errorf("failed to start probe: %w", err)
+	}
+	return process.Wait(cmd)
+}
+
+// circuitStatus describes the circuit; it must be called with s.mu held
+func (s *SboxctlService) circuitStatus() map[string]interface{} {
+	status := map[string]interface{}{
+		"state":    "closed",
+		"failures": s.circuit.failures,
+	}
+	if s.circuit.open {
+		status["state"] = "open"
+		status["until"] = s.circuit.until
+	}
+	return status
+}
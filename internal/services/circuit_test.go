@@ -0,0 +1,88 @@
+package services
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/kpblcaoo/sboxagent/internal/config"
+	"github.com/kpblcaoo/sboxagent/internal/logger"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSboxctlService_CircuitBreaker(t *testing.T) {
+	log, err := logger.New("error")
+	require.NoError(t, err)
+	service, err := NewSboxctlService(config.SboxctlConfig{
+		Command:  []string{"false"},
+		Interval: time.Hour,
+		Timeout:  10 * time.Second,
+		CircuitBreaker: config.CircuitBreakerConfig{
+			Threshold:    2,
+			Cooldown:     time.Hour,
+			ProbeCommand: []string{"false"},
+		},
+	}, log)
+	require.NoError(t, err)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	service.ctx = ctx
+	service.running = true
+
+	var transitions []bool
+	service.SetCircuitHook(func(open bool, failures int, err error) {
+		transitions = append(transitions, open)
+		if open {
+			assert.Equal(t, 2, failures)
+			assert.Error(t, err)
+		}
+	})
+
+	service.runOnce()
+	assert.Empty(t, transitions)
+	service.runOnce()
+	assert.Equal(t, []bool{true}, transitions)
+	assert.Equal(t, "open", service.GetStatus()["circuit"].(map[string]interface{})["state"])
+
+	// Runs are skipped and refused while cooling down
+	lastRun := service.GetStatus()["lastRun"]
+	service.runOnce()
+	assert.Equal(t, lastRun, service.GetStatus()["lastRun"])
+	_, err = service.TriggerRun()
+	assert.ErrorIs(t, err, ErrCircuitOpen)
+
+	// A failed probe keeps the circuit open for another cooldown
+	service.circuit.until = time.Now().Add(-time.Second)
+	service.runOnce()
+	assert.Equal(t, lastRun, service.GetStatus()["lastRun"])
+	assert.True(t, service.circuitBlocked(time.Now()))
+
+	// A passing probe closes it, and the next failure opens it again
+	service.circuit.until = time.Now().Add(-time.Second)
+	service.config.CircuitBreaker.ProbeCommand = []string{"true"}
+	service.runOnce()
+	assert.NotEqual(t, lastRun, service.GetStatus()["lastRun"])
+	assert.Equal(t, []bool{true, false, true}, transitions)
+}
+
+func TestSboxctlService_CircuitBreakerResetsOnSuccess(t *testing.T) {
+	log, err := logger.New("error")
+	require.NoError(t, err)
+	service, err := NewSboxctlService(config.SboxctlConfig{
+		Command:        []string{"false"},
+		Interval:       time.Hour,
+		Timeout:        10 * time.Second,
+		CircuitBreaker: config.CircuitBreakerConfig{Threshold: 2, Cooldown: time.Hour},
+	}, log)
+	require.NoError(t, err)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	service.ctx = ctx
+
+	service.runOnce()
+	service.recordCircuit(nil)
+	service.runOnce()
+	assert.Equal(t, 1, service.circuit.failures)
+	assert.False(t, service.circuit.open)
+}
@@ -0,0 +1,49 @@
+package services
+
+import (
+	"fmt"
+	"strings"
+	"text/template"
+)
+
+// CommandVars are the variables available to command templates such as
+// {{.ConfigPath}} in the sboxctl command
+type CommandVars struct {
+	ConfigPath string
+	Profile    string
+	SocketPath string
+	AgentName  string
+}
+
+// commandTemplate is a command line whose arguments may contain templates
+type commandTemplate []*template.Template
+
+// parseCommand parses each argument of command as a template. Unknown
+// variables are rejected when the command is rendered.
+func parseCommand(command []string) (commandTemplate, error) {
+	if len(command) == 0 {
+		return nil, fmt.Errorf("command is empty")
+	}
+	tmpl := make(commandTemplate, len(command))
+	for i, arg := range command {
+		t, err := template.New(fmt.Sprintf("arg%d", i)).Option("missingkey=error").Parse(arg)
+		if err != nil {
+			return nil, fmt.Errorf("invalid template in argument %q: %w", arg, err)
+		}
+		tmpl[i] = t
+	}
+	return tmpl, nil
+}
+
+// render resolves the command arguments with vars
+func (c commandTemplate) render(vars CommandVars) ([]string, error) {
+	args := make([]string, len(c))
+	for i, t := range c {
+		var b strings.Builder
+		if err := t.Execute(&b, vars); err != nil {
+			return nil, fmt.Errorf("failed to render command: %w", err)
+		}
+		args[i] = b.String()
+	}
+	return args, nil
+}
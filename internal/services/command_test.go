@@ -0,0 +1,30 @@
+package services
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCommandTemplate_Render(t *testing.T) {
+	command, err := parseCommand([]string{"sboxctl", "update", "--profile={{.Profile}}", "--socket", "{{.SocketPath}}"})
+	require.NoError(t, err)
+
+	args, err := command.render(CommandVars{Profile: "home", SocketPath: "/run/sboxagent.sock"})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"sboxctl", "update", "--profile=home", "--socket", "/run/sboxagent.sock"}, args)
+}
+
+func TestCommandTemplate_Invalid(t *testing.T) {
+	_, err := parseCommand(nil)
+	assert.Error(t, err)
+
+	_, err = parseCommand([]string{"sboxctl", "{{.Profile"})
+	assert.ErrorContains(t, err, "invalid template")
+
+	command, err := parseCommand([]string{"sboxctl", "{{.Unknown}}"})
+	require.NoError(t, err)
+	_, err = command.render(CommandVars{})
+	assert.ErrorContains(t, err, "failed to render command")
+}
@@ -0,0 +1,55 @@
+package services
+
+import (
+	"io"
+	"sync/atomic"
+	"time"
+
+	"github.com/kpblcaoo/sboxagent/internal/process"
+)
+
+// SetHistory sets the history sboxctl runs are recorded in
+func (s *SboxctlService) SetHistory(history *process.History) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.history = history
+}
+
+// SetName names the service as a sboxctl instance, so its runs are
+// recorded apart from those of the main service
+func (s *SboxctlService) SetName(name string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.name = name
+}
+
+// recordRun adds a finished sboxctl run to the history
+func (s *SboxctlService) recordRun(args []string, start time.Time, output int64, err error) {
+	s.mu.RLock()
+	history, service := s.history, "sboxctl"
+	if s.name != "" {
+		service += "/" + s.name
+	}
+	s.mu.RUnlock()
+	history.Add(process.NewRun(service, args, start, output, err))
+}
+
+// countingWriter counts the bytes written through it
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	atomic.AddInt64(&c.n, int64(n))
+	return n, err
+}
+
+// count returns the bytes written so far
+func (c *countingWriter) count() int64 {
+	if c == nil {
+		return 0
+	}
+	return atomic.LoadInt64(&c.n)
+}
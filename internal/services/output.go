@@ -0,0 +1,85 @@
+package services
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// DefaultMaxLineBytes is the sboxctl output line length when none is
+// configured
+const DefaultMaxLineBytes = 1 << 20
+
+// outputReadSize is the read buffer of output lines; longer lines are read
+// in pieces
+const outputReadSize = 64 << 10
+
+// errOutputLimit is returned by lineReader once the output limit is reached
+var errOutputLimit = errors.New("output limit reached")
+
+// lineReader reads lines of subprocess output, cutting lines longer than
+// maxLine and stopping once maxTotal bytes were read. Unlike bufio.Scanner
+// it does not fail on long lines, so a huge JSON event cannot stop the
+// output from being read.
+type lineReader struct {
+	r        *bufio.Reader
+	maxLine  int
+	maxTotal int64
+	total    int64
+}
+
+// newLineReader creates a line reader; maxLine zero uses the default and
+// maxTotal zero does not limit the output
+func newLineReader(r io.Reader, maxLine int, maxTotal int64) *lineReader {
+	if maxLine <= 0 {
+		maxLine = DefaultMaxLineBytes
+	}
+	return &lineReader{
+		r:        bufio.NewReaderSize(r, outputReadSize),
+		maxLine:  maxLine,
+		maxTotal: maxTotal,
+	}
+}
+
+// next returns the next line without its newline and the number of bytes
+// cut from it. It returns io.EOF at the end of the output and
+// errOutputLimit once maxTotal bytes were read.
+func (l *lineReader) next() ([]byte, int, error) {
+	if l.maxTotal > 0 && l.total >= l.maxTotal {
+		return nil, 0, errOutputLimit
+	}
+
+	var line []byte
+	cut := 0
+	for {
+		chunk, err := l.r.ReadSlice('\n')
+		l.total += int64(len(chunk))
+		if err == nil {
+			chunk = chunk[:len(chunk)-1]
+		}
+		keep := min(len(chunk), l.maxLine-len(line))
+		line = append(line, chunk[:keep]...)
+		cut += len(chunk) - keep
+
+		if err == bufio.ErrBufferFull {
+			continue
+		}
+		if err != nil && len(line) == 0 && cut == 0 {
+			return nil, 0, err
+		}
+		return line, cut, nil
+	}
+}
+
+// markOutputTruncated records that output of the current run was cut
+func (s *SboxctlService) markOutputTruncated() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.outputTruncated = true
+}
+
+// truncated marks a line cut at the length limit
+func truncated(line string, cut int) string {
+	return fmt.Sprintf("%s...[truncated %d bytes]", line, cut)
+}
@@ -0,0 +1,99 @@
+package services
+
+import (
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/kpblcaoo/sboxagent/internal/config"
+	"github.com/kpblcaoo/sboxagent/internal/logger"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLineReader(t *testing.T) {
+	long := strings.Repeat("x", outputReadSize*2)
+	input := "short\n" + long + "\r\nlast"
+	lines := newLineReader(strings.NewReader(input), 10, 0)
+
+	line, cut, err := lines.next()
+	require.NoError(t, err)
+	assert.Equal(t, "short", string(line))
+	assert.Zero(t, cut)
+
+	// Long lines are cut across read buffers, keeping the newline out
+	line, cut, err = lines.next()
+	require.NoError(t, err)
+	assert.Equal(t, strings.Repeat("x", 10), string(line))
+	assert.Equal(t, len(long)+1-10, cut)
+
+	// An unterminated last line is returned before EOF
+	line, _, err = lines.next()
+	require.NoError(t, err)
+	assert.Equal(t, "last", string(line))
+
+	_, _, err = lines.next()
+	assert.Equal(t, io.EOF, err)
+}
+
+func TestLineReader_OutputLimit(t *testing.T) {
+	lines := newLineReader(strings.NewReader("one\ntwo\nthree\n"), 0, 6)
+
+	line, _, err := lines.next()
+	require.NoError(t, err)
+	assert.Equal(t, "one", string(line))
+	line, _, err = lines.next()
+	require.NoError(t, err)
+	assert.Equal(t, "two", string(line))
+
+	_, _, err = lines.next()
+	assert.ErrorIs(t, err, errOutputLimit)
+}
+
+func TestSboxctlService_TruncatesOutput(t *testing.T) {
+	log, err := logger.New("error")
+	require.NoError(t, err)
+
+	// A huge event line, then more output than the limit allows; the run
+	// must finish rather than block on a full pipe
+	script := filepath.Join(t.TempDir(), "sboxctl")
+	require.NoError(t, os.WriteFile(script, []byte(`#!/bin/sh
+printf '{"type":"LOG","data":{"message":"%0200000d"}}\n' 0
+echo '{"type":"LOG","data":{"message":"fits"}}'
+head -c 1000000 /dev/zero
+`), 0755))
+	service, err := NewSboxctlService(config.SboxctlConfig{
+		Command:        []string{script},
+		Interval:       time.Hour,
+		Timeout:        10 * time.Second,
+		StdoutCapture:  true,
+		MaxLineBytes:   1024,
+		MaxOutputBytes: 300000,
+	}, log)
+	require.NoError(t, err)
+
+	runs := make(chan error, 1)
+	service.SetRunHook(func(err error) { runs <- err })
+	require.NoError(t, service.Start(context.Background()))
+	defer service.Stop()
+
+	select {
+	case err := <-runs:
+		require.NoError(t, err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("sboxctl did not finish")
+	}
+
+	// Only the event that fits is forwarded
+	select {
+	case event := <-service.GetEventChannel():
+		assert.Equal(t, "fits", event.Data["message"])
+	case <-time.After(time.Second):
+		t.Fatal("expected the short event")
+	}
+	assert.Equal(t, true, service.GetStatus()["outputTruncated"])
+}
@@ -0,0 +1,292 @@
+package services
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Output parser names
+const (
+	ParserJSON      = "json"
+	ParserKeyValue  = "key_value"
+	ParserTraceback = "traceback"
+	ParserText      = "text"
+)
+
+// DefaultParsers is the parser chain used when none is configured
+var DefaultParsers = []string{ParserJSON, ParserKeyValue, ParserTraceback, ParserText}
+
+// OutputParser turns lines of sboxctl stdout into events. Parse returns
+// false for lines it does not understand, which go to the next parser in
+// the chain. A parser collecting a multi-line block returns true and a nil
+// event until the block is complete.
+type OutputParser interface {
+	Parse(line string) (*SboxctlEvent, bool)
+}
+
+// outputFlusher is implemented by parsers that hold an incomplete block
+// when the output ends
+type outputFlusher interface {
+	Flush() *SboxctlEvent
+}
+
+var (
+	parsersMu sync.RWMutex
+	parsers   = map[string]func() OutputParser{
+		ParserJSON:      func() OutputParser { return jsonParser{} },
+		ParserKeyValue:  func() OutputParser { return keyValueParser{} },
+		ParserTraceback: func() OutputParser { return &tracebackParser{} },
+		ParserText:      func() OutputParser { return textParser{} },
+	}
+)
+
+// RegisterOutputParser makes a parser available to services.sboxctl.parsers
+// by name. New creates a parser for each run, so parsers may keep state
+// across the lines of one run.
+func RegisterOutputParser(name string, new func() OutputParser) {
+	parsersMu.Lock()
+	defer parsersMu.Unlock()
+	parsers[name] = new
+}
+
+// OutputParsers returns the names of the registered parsers
+func OutputParsers() []string {
+	parsersMu.RLock()
+	defer parsersMu.RUnlock()
+	names := make([]string, 0, len(parsers))
+	for name := range parsers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// parserChain passes each line to its parsers in order. A parser in the
+// middle of a block gets the following lines first.
+type parserChain struct {
+	names   []string
+	parsers []OutputParser
+	// active is the parser collecting a block, or -1
+	active int
+}
+
+// newParserChain creates the parsers of one run; an empty list uses
+// DefaultParsers
+func newParserChain(names []string) (*parserChain, error) {
+	if len(names) == 0 {
+		names = DefaultParsers
+	}
+	parsersMu.RLock()
+	defer parsersMu.RUnlock()
+	chain := &parserChain{names: names, active: -1}
+	for _, name := range names {
+		new, ok := parsers[name]
+		if !ok {
+			return nil, fmt.Errorf("unknown output parser %q", name)
+		}
+		chain.parsers = append(chain.parsers, new())
+	}
+	return chain, nil
+}
+
+// parse returns the event of a line and the name of the parser that took
+// it. The event is nil if no parser took the line or a block is incomplete.
+func (c *parserChain) parse(line string) (*SboxctlEvent, string) {
+	if active := c.active; active >= 0 {
+		c.active = -1
+		if event, ok := c.parsers[active].Parse(line); ok {
+			if event == nil {
+				c.active = active
+			}
+			return event, c.names[active]
+		}
+	}
+	for i, parser := range c.parsers {
+		if event, ok := parser.Parse(line); ok {
+			if event == nil {
+				c.active = i
+			}
+			return event, c.names[i]
+		}
+	}
+	return nil, ""
+}
+
+// flush returns the events of blocks left incomplete at the end of output
+func (c *parserChain) flush() []*SboxctlEvent {
+	var events []*SboxctlEvent
+	for _, parser := range c.parsers {
+		if flusher, ok := parser.(outputFlusher); ok {
+			if event := flusher.Flush(); event != nil {
+				events = append(events, event)
+			}
+		}
+	}
+	return events
+}
+
+// logEvent creates a LOG event from parsed output
+func logEvent(level, message string, data map[string]interface{}) *SboxctlEvent {
+	if data == nil {
+		data = make(map[string]interface{})
+	}
+	data["level"] = level
+	data["message"] = message
+	return &SboxctlEvent{
+		Type:      "LOG",
+		Data:      data,
+		Timestamp: time.Now().UTC().Format(time.RFC3339),
+	}
+}
+
+// jsonParser reads the JSON events of the sboxctl protocol
+type jsonParser struct{}
+
+func (jsonParser) Parse(line string) (*SboxctlEvent, bool) {
+	line = strings.TrimSpace(line)
+	if !strings.HasPrefix(line, "{") {
+		return nil, false
+	}
+	var event SboxctlEvent
+	if err := json.Unmarshal([]byte(line), &event); err != nil || event.Type == "" {
+		return nil, false
+	}
+	return &event, true
+}
+
+// keyValuePattern matches one key=value pair, the value optionally quoted
+var keyValuePattern = regexp.MustCompile(`^([A-Za-z_][\w.-]*)=("(?:[^"\\]|\\.)*"|\S*)`)
+
+// keyValueParser reads logfmt style lines such as
+// level=warn msg="slow subscription" host=example.com
+type keyValueParser struct{}
+
+func (keyValueParser) Parse(line string) (*SboxctlEvent, bool) {
+	rest := strings.TrimSpace(line)
+	data := make(map[string]interface{})
+	for rest != "" {
+		match := keyValuePattern.FindStringSubmatch(rest)
+		if match == nil {
+			return nil, false
+		}
+		value := match[2]
+		if strings.HasPrefix(value, `"`) {
+			if unquoted, err := unquote(value); err == nil {
+				value = unquoted
+			}
+		}
+		data[strings.ToLower(match[1])] = value
+		rest = strings.TrimLeft(rest[len(match[0]):], " \t")
+	}
+	if len(data) == 0 {
+		return nil, false
+	}
+
+	level := "info"
+	for _, key := range []string{"level", "lvl", "severity"} {
+		if value, ok := data[key].(string); ok {
+			level = normalizeLevel(value)
+			delete(data, key)
+			break
+		}
+	}
+	message := strings.TrimSpace(line)
+	for _, key := range []string{"msg", "message"} {
+		if value, ok := data[key].(string); ok {
+			message = value
+			delete(data, key)
+			break
+		}
+	}
+	return logEvent(level, message, data), true
+}
+
+// unquote removes the quotes of a quoted value and its escapes
+func unquote(value string) (string, error) {
+	var unquoted string
+	err := json.Unmarshal([]byte(value), &unquoted)
+	return unquoted, err
+}
+
+// tracebackStart begins a Python traceback
+const tracebackStart = "Traceback (most recent call last):"
+
+// tracebackParser collects a Python traceback into one error event, whose
+// message is the exception line ending it
+type tracebackParser struct {
+	lines []string
+}
+
+func (p *tracebackParser) Parse(line string) (*SboxctlEvent, bool) {
+	if p.lines == nil {
+		if strings.TrimSpace(line) != tracebackStart {
+			return nil, false
+		}
+		p.lines = []string{tracebackStart}
+		return nil, true
+	}
+
+	p.lines = append(p.lines, line)
+	// Frames are indented; the first unindented line is the exception
+	if strings.HasPrefix(line, " ") || strings.HasPrefix(line, "\t") {
+		return nil, true
+	}
+	return p.finish(strings.TrimSpace(line)), true
+}
+
+// Flush returns a traceback cut off by the end of output
+func (p *tracebackParser) Flush() *SboxctlEvent {
+	if p.lines == nil {
+		return nil
+	}
+	return p.finish("incomplete traceback")
+}
+
+// finish returns the collected traceback as an event and resets the parser
+func (p *tracebackParser) finish(message string) *SboxctlEvent {
+	event := logEvent("error", message, map[string]interface{}{
+		"traceback": strings.Join(p.lines, "\n"),
+	})
+	if exception, _, ok := strings.Cut(message, ":"); ok && !strings.Contains(exception, " ") {
+		event.Data["exception"] = exception
+	}
+	p.lines = nil
+	return event
+}
+
+// textParser takes any line as a log message, using a leading level word
+// such as "ERROR:" or "[warn]" when there is one
+type textParser struct{}
+
+func (textParser) Parse(line string) (*SboxctlEvent, bool) {
+	line = strings.TrimSpace(line)
+	if line == "" {
+		return nil, false
+	}
+	level := "info"
+	word := strings.ToLower(strings.Trim(strings.Fields(line)[0], "[]:"))
+	switch normalized := normalizeLevel(word); normalized {
+	case "debug", "warn", "error":
+		level = normalized
+	}
+	return logEvent(level, line, nil), true
+}
+
+// normalizeLevel maps level names to those of LOG events
+func normalizeLevel(level string) string {
+	switch strings.ToLower(level) {
+	case "trace", "debug":
+		return "debug"
+	case "warn", "warning":
+		return "warn"
+	case "error", "err", "fatal", "critical", "panic":
+		return "error"
+	default:
+		return "info"
+	}
+}
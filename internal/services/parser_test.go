@@ -0,0 +1,78 @@
+package services
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParserChain(t *testing.T) {
+	chain, err := newParserChain(nil)
+	require.NoError(t, err)
+
+	event, parser := chain.parse(`{"type":"STATUS","data":{"state":"ok"}}`)
+	assert.Equal(t, ParserJSON, parser)
+	assert.Equal(t, "STATUS", event.Type)
+
+	event, parser = chain.parse(`level=warning msg="slow subscription" host=example.com`)
+	assert.Equal(t, ParserKeyValue, parser)
+	assert.Equal(t, "LOG", event.Type)
+	assert.Equal(t, "warn", event.Data["level"])
+	assert.Equal(t, "slow subscription", event.Data["message"])
+	assert.Equal(t, "example.com", event.Data["host"])
+
+	event, parser = chain.parse("ERROR: subscription unreachable")
+	assert.Equal(t, ParserText, parser)
+	assert.Equal(t, "error", event.Data["level"])
+	assert.Equal(t, "ERROR: subscription unreachable", event.Data["message"])
+
+	event, _ = chain.parse("Fetched 3 servers")
+	assert.Equal(t, "info", event.Data["level"])
+}
+
+func TestParserChain_Traceback(t *testing.T) {
+	chain, err := newParserChain(nil)
+	require.NoError(t, err)
+
+	traceback := []string{
+		"Traceback (most recent call last):",
+		`  File "/usr/lib/sboxmgr/cli.py", line 12, in main`,
+		"    retries=3",
+		"ValueError: invalid subscription",
+	}
+	for _, line := range traceback[:3] {
+		event, parser := chain.parse(line)
+		assert.Nil(t, event)
+		assert.Equal(t, ParserTraceback, parser)
+	}
+	event, _ := chain.parse(traceback[3])
+	require.NotNil(t, event)
+	assert.Equal(t, "error", event.Data["level"])
+	assert.Equal(t, "ValueError: invalid subscription", event.Data["message"])
+	assert.Equal(t, "ValueError", event.Data["exception"])
+	assert.Equal(t, strings.Join(traceback, "\n"), event.Data["traceback"])
+
+	// A traceback cut off by the end of output is flushed
+	chain.parse(traceback[0])
+	events := chain.flush()
+	require.Len(t, events, 1)
+	assert.Equal(t, "incomplete traceback", events[0].Data["message"])
+}
+
+func TestParserChain_Configured(t *testing.T) {
+	chain, err := newParserChain([]string{ParserJSON})
+	require.NoError(t, err)
+	event, parser := chain.parse("plain output")
+	assert.Nil(t, event)
+	assert.Empty(t, parser)
+
+	_, err = newParserChain([]string{"yaml"})
+	assert.EqualError(t, err, `unknown output parser "yaml"`)
+
+	RegisterOutputParser("upper", func() OutputParser { return textParser{} })
+	assert.Contains(t, OutputParsers(), "upper")
+	_, err = newParserChain([]string{"upper"})
+	assert.NoError(t, err)
+}
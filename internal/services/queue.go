@@ -0,0 +1,17 @@
+package services
+
+// QueueStats describes the fill level of a bounded event queue and how many
+// events it dropped because it was full
+type QueueStats struct {
+	Capacity int   `json:"capacity"`
+	Length   int   `json:"length"`
+	Dropped  int64 `json:"dropped"`
+}
+
+// FillRatio returns the fraction of the queue in use
+func (q QueueStats) FillRatio() float64 {
+	if q.Capacity == 0 {
+		return 0
+	}
+	return float64(q.Length) / float64(q.Capacity)
+}
@@ -0,0 +1,106 @@
+package services
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/kpblcaoo/sboxagent/internal/config"
+)
+
+// recordTimeFormat names run files so they sort chronologically
+const recordTimeFormat = "20060102-150405.000000"
+
+// RecordPattern matches the run files an EventRecorder writes
+const RecordPattern = "sboxctl-*.ndjson"
+
+// EventRecorder writes the raw events of each sboxctl run to an NDJSON file
+// in a directory, keeping a bounded number of files
+type EventRecorder struct {
+	config config.EventRecordConfig
+}
+
+// NewEventRecorder creates a recorder for the given configuration
+func NewEventRecorder(cfg config.EventRecordConfig) *EventRecorder {
+	return &EventRecorder{config: cfg}
+}
+
+// RunRecord receives the events of a single run. The file is created with
+// the first event, so runs without events leave nothing behind.
+type RunRecord struct {
+	recorder *EventRecorder
+	path     string
+	file     *os.File
+	// failed stops recording after a write error
+	failed bool
+}
+
+// StartRun returns the record for a run started at start
+func (r *EventRecorder) StartRun(start time.Time) *RunRecord {
+	name := "sboxctl-" + start.UTC().Format(recordTimeFormat) + ".ndjson"
+	return &RunRecord{recorder: r, path: filepath.Join(r.config.Dir, name)}
+}
+
+// Files returns the paths of the recorded run files, oldest first
+func (r *EventRecorder) Files() ([]string, error) {
+	files, err := filepath.Glob(filepath.Join(r.config.Dir, RecordPattern))
+	if err != nil {
+		return nil, fmt.Errorf("failed to list event records: %w", err)
+	}
+	sort.Strings(files)
+	return files, nil
+}
+
+// prune removes the oldest run files beyond MaxFiles
+func (r *EventRecorder) prune() error {
+	if r.config.MaxFiles <= 0 {
+		return nil
+	}
+	files, err := r.Files()
+	if err != nil {
+		return err
+	}
+	for len(files) > r.config.MaxFiles {
+		if err := os.Remove(files[0]); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("failed to remove event record: %w", err)
+		}
+		files = files[1:]
+	}
+	return nil
+}
+
+// Path returns the file the run is recorded to
+func (rr *RunRecord) Path() string {
+	return rr.path
+}
+
+// Write appends a raw event line to the run file
+func (rr *RunRecord) Write(line string) error {
+	if rr.file == nil {
+		if err := os.MkdirAll(rr.recorder.config.Dir, 0750); err != nil {
+			return fmt.Errorf("failed to create event record directory: %w", err)
+		}
+		file, err := os.OpenFile(rr.path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0640)
+		if err != nil {
+			return fmt.Errorf("failed to create event record: %w", err)
+		}
+		rr.file = file
+		if err := rr.recorder.prune(); err != nil {
+			return err
+		}
+	}
+	if _, err := rr.file.WriteString(line + "\n"); err != nil {
+		return fmt.Errorf("failed to write event record: %w", err)
+	}
+	return nil
+}
+
+// Close closes the run file if one was created
+func (rr *RunRecord) Close() error {
+	if rr.file == nil {
+		return nil
+	}
+	return rr.file.Close()
+}
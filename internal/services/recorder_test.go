@@ -0,0 +1,64 @@
+package services
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/kpblcaoo/sboxagent/internal/config"
+	"github.com/kpblcaoo/sboxagent/internal/logger"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEventRecorder_RecordsRunEvents(t *testing.T) {
+	log, err := logger.New("error")
+	require.NoError(t, err)
+
+	dir := filepath.Join(t.TempDir(), "events")
+	service, err := NewSboxctlService(config.SboxctlConfig{
+		Command: []string{"echo"},
+		Record:  config.EventRecordConfig{Enabled: true, Dir: dir},
+	}, log)
+	require.NoError(t, err)
+
+	output := strings.Join([]string{
+		`{"type":"LOG","data":{"message":"one"}}`,
+		"plain output line",
+		`{"type":"STATUS","data":{"ok":true}}`,
+	}, "\n")
+	record := service.recorder.StartRun(time.Now())
+	service.readStdout(strings.NewReader(output), record)
+
+	// Only events are recorded, verbatim
+	data, err := os.ReadFile(record.Path())
+	require.NoError(t, err)
+	assert.Equal(t, "{\"type\":\"LOG\",\"data\":{\"message\":\"one\"}}\n{\"type\":\"STATUS\",\"data\":{\"ok\":true}}\n", string(data))
+
+	// A run without events leaves no file
+	empty := service.recorder.StartRun(time.Now().Add(time.Second))
+	service.readStdout(strings.NewReader("no events here"), empty)
+	_, err = os.Stat(empty.Path())
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestEventRecorder_Prune(t *testing.T) {
+	dir := t.TempDir()
+	recorder := NewEventRecorder(config.EventRecordConfig{Enabled: true, Dir: dir, MaxFiles: 2})
+
+	start := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	var paths []string
+	for i := 0; i < 3; i++ {
+		record := recorder.StartRun(start.Add(time.Duration(i) * time.Minute))
+		require.NoError(t, record.Write(`{"type":"LOG"}`))
+		require.NoError(t, record.Close())
+		paths = append(paths, record.Path())
+	}
+
+	files, err := recorder.Files()
+	require.NoError(t, err)
+	assert.Equal(t, paths[1:], files)
+	assert.Equal(t, "sboxctl-20260102-030505.000000.ndjson", filepath.Base(files[0]))
+}
@@ -1,26 +1,50 @@
 package services
 
 import (
-	"bufio"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
+	"math/rand/v2"
 	"os/exec"
-	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
+	"github.com/google/uuid"
 	"github.com/kpblcaoo/sboxagent/internal/config"
 	"github.com/kpblcaoo/sboxagent/internal/logger"
+	"github.com/kpblcaoo/sboxagent/internal/process"
+	"github.com/kpblcaoo/sboxagent/internal/schedule"
 )
 
+// DefaultEventBuffer is the sboxctl event channel size when none is configured
+const DefaultEventBuffer = 100
+
+// Events the service emits around runs requested with TriggerRun,
+// carrying the run_id and, when finished, the outcome
+const (
+	RunStartedEventType  = "RUN_STARTED"
+	RunFinishedEventType = "RUN_FINISHED"
+)
+
+// ErrRunPending is returned by TriggerRun while a triggered run has not
+// started yet
+var ErrRunPending = errors.New("an sboxctl run is already pending")
+
+// ErrRunsPaused is returned by TriggerRun while runs are paused
+var ErrRunsPaused = errors.New("sboxctl runs are paused")
+
 // SboxctlEvent represents an event from sboxctl
 type SboxctlEvent struct {
 	Type      string                 `json:"type"`
 	Data      map[string]interface{} `json:"data"`
 	Timestamp string                 `json:"timestamp"`
 	Version   string                 `json:"version"`
+	// RunID identifies the run that produced the event
+	RunID string `json:"run_id,omitempty"`
 }
 
 // SboxctlService represents the sboxctl service
@@ -33,22 +57,141 @@ type SboxctlService struct {
 	running  bool
 	lastRun  time.Time
 	lastError error
+	lastDuration time.Duration
 	
 	// Context for graceful shutdown
 	ctx    context.Context
 	cancel context.CancelFunc
+	wg     sync.WaitGroup
+
+	// Currently running command, killed by Kill
+	cmdMu sync.Mutex
+	cmd   *exec.Cmd
+
+	// Environment for sboxctl; nil inherits the agent environment
+	env []string
+
+	// credential is the user sboxctl runs as; nil keeps the agent's
+	credential *process.Credential
+	// limits bound the resources of each run
+	limits *process.Limits
+	// history records each run
+	history *process.History
+	// name is the instance name, empty for the main sboxctl service
+	name string
+	// outputTruncated is set when output of the last run was cut
+	outputTruncated bool
+
+	// runHook is called after each run with its error, or nil on success
+	runHook func(err error)
+
+	// circuit stops runs after repeated failures; circuitHook is told when
+	// it opens and closes
+	circuit     circuit
+	circuitHook func(open bool, failures int, err error)
+
+	// stderrHook receives each stderr line with its class
+	stderrHook func(level, line string)
+
+	// paused skips scheduled runs while set
+	paused bool
+
+	// trigger queues a run requested by TriggerRun by its ID; runID is the
+	// ID of the run in progress
+	trigger chan string
+	runID   string
+
+	// session accepts commands while an interactive run is in progress
+	session *commandSession
+
+	// Command line templates and the variables they are rendered with
+	command commandTemplate
+	vars    CommandVars
+
+	// schedule replaces the interval when set; nextRun is the time of the
+	// next scheduled run, including splay
+	schedule *schedule.Cron
+	nextRun  time.Time
 	
 	// Event handling
 	eventChan chan SboxctlEvent
+	// eventsDropped counts events dropped because eventChan was full
+	eventsDropped int64
+
+	// recorder persists raw events when recording is enabled
+	recorder *EventRecorder
 }
 
 // NewSboxctlService creates a new sboxctl service
 func NewSboxctlService(cfg config.SboxctlConfig, log *logger.Logger) (*SboxctlService, error) {
-	return &SboxctlService{
+	command, err := parseCommand(cfg.Command)
+	if err != nil {
+		return nil, fmt.Errorf("invalid sboxctl command: %w", err)
+	}
+
+	service := &SboxctlService{
 		config:    cfg,
 		logger:    log,
-		eventChan: make(chan SboxctlEvent, 100), // Buffer for events
-	}, nil
+		command:   command,
+		eventChan: make(chan SboxctlEvent, eventBuffer(cfg.EventBuffer)),
+		trigger:   make(chan string, 1),
+	}
+	if cfg.Schedule != "" {
+		if service.schedule, err = schedule.Parse(cfg.Schedule); err != nil {
+			return nil, fmt.Errorf("invalid sboxctl schedule: %w", err)
+		}
+	}
+	if _, err := newParserChain(cfg.Parsers); err != nil {
+		return nil, fmt.Errorf("invalid sboxctl parsers: %w", err)
+	}
+	if cfg.Record.Enabled {
+		service.recorder = NewEventRecorder(cfg.Record)
+	}
+	return service, nil
+}
+
+// SetEnv sets the environment sboxctl runs with, as KEY=value entries
+func (s *SboxctlService) SetEnv(env []string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.env = env
+}
+
+// SetCredential sets the user and group sboxctl runs as
+func (s *SboxctlService) SetCredential(cred *process.Credential) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.credential = cred
+}
+
+// SetLimits sets the resource limits of sboxctl runs
+func (s *SboxctlService) SetLimits(limits *process.Limits) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.limits = limits
+}
+
+// SetRunHook sets a function called after each run with the run's error,
+// or nil if it succeeded
+func (s *SboxctlService) SetRunHook(hook func(err error)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.runHook = hook
+}
+
+// SetStderrHook sets a function called with each line sboxctl writes to
+// stderr, classified as StderrWarning or StderrError
+func (s *SboxctlService) SetStderrHook(hook func(level, line string)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.stderrHook = hook
+}
+
+// SetCommandVars sets the variables the command templates are rendered with
+func (s *SboxctlService) SetCommandVars(vars CommandVars) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.vars = vars
 }
 
 // Start starts the sboxctl service
@@ -70,47 +213,70 @@ func (s *SboxctlService) Start(ctx context.Context) error {
 	})
 
 	// Start the main service loop
+	s.wg.Add(1)
 	go s.run()
 
 	// Start health checker if enabled
 	if s.config.HealthCheck.Enabled {
+		s.wg.Add(1)
 		go s.healthChecker()
 	}
 
 	return nil
 }
 
-// Stop stops the sboxctl service
+// Stop stops the sboxctl service and waits for a running command to exit
 func (s *SboxctlService) Stop() {
 	s.mu.Lock()
-	defer s.mu.Unlock()
-
 	if !s.running {
+		s.mu.Unlock()
 		return
 	}
 
 	s.logger.Info("Sboxctl service stopping", map[string]interface{}{})
 	s.cancel()
 	s.running = false
+	s.mu.Unlock()
+
+	s.wg.Wait()
+}
+
+// Kill forcibly kills the currently running sboxctl process group, if any. It is
+// used when Stop exceeds its shutdown deadline.
+func (s *SboxctlService) Kill() {
+	s.cmdMu.Lock()
+	defer s.cmdMu.Unlock()
+
+	if s.cmd == nil || s.cmd.Process == nil {
+		return
+	}
+	s.logger.Warn("Killing sboxctl process group", map[string]interface{}{
+		"pid": s.cmd.Process.Pid,
+	})
+	process.KillGroup(s.cmd)
 }
 
 // run is the main service loop
 func (s *SboxctlService) run() {
-	// Parse interval
-	interval, err := parseDuration(s.config.Interval)
-	if err != nil {
-		s.logger.Error("Invalid interval format", map[string]interface{}{
-			"interval": s.config.Interval,
-			"error":    err.Error(),
+	defer s.wg.Done()
+
+	if s.schedule != nil {
+		s.runScheduled()
+		return
+	}
+
+	if s.config.Interval <= 0 {
+		s.logger.Error("Invalid interval", map[string]interface{}{
+			"interval": s.config.Interval.String(),
 		})
 		return
 	}
 
-	ticker := time.NewTicker(interval)
+	ticker := time.NewTicker(s.config.Interval)
 	defer ticker.Stop()
 
 	// Run initial execution
-	s.executeSboxctl()
+	s.runOnce()
 
 	// Main loop
 	for {
@@ -119,54 +285,287 @@ func (s *SboxctlService) run() {
 			s.logger.Info("Sboxctl service loop stopped", map[string]interface{}{})
 			return
 		case <-ticker.C:
-			s.executeSboxctl()
+			s.runOnce()
+		case id := <-s.trigger:
+			s.runWithID(id, true)
 		}
 	}
 }
 
+// runScheduled runs sboxctl once at start and then whenever the cron
+// schedule fires
+func (s *SboxctlService) runScheduled() {
+	s.runOnce()
+
+	for {
+		delay, ok := s.nextDelay(time.Now())
+		if !ok {
+			s.logger.Error("Sboxctl schedule never fires", map[string]interface{}{
+				"schedule": s.config.Schedule,
+			})
+			return
+		}
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-s.ctx.Done():
+			timer.Stop()
+			s.logger.Info("Sboxctl service loop stopped", map[string]interface{}{})
+			return
+		case <-timer.C:
+			s.runOnce()
+		case id := <-s.trigger:
+			timer.Stop()
+			s.runWithID(id, true)
+		}
+	}
+}
+
+// nextDelay returns how long after now the next scheduled run starts. A
+// random splay is added so hosts sharing a schedule do not all run at once.
+func (s *SboxctlService) nextDelay(now time.Time) (time.Duration, bool) {
+	next := s.schedule.Next(now)
+	if next.IsZero() {
+		return 0, false
+	}
+	if s.config.Splay > 0 {
+		next = next.Add(time.Duration(rand.Int64N(int64(s.config.Splay))))
+	}
+
+	s.mu.Lock()
+	s.nextRun = next
+	s.mu.Unlock()
+	return next.Sub(now), true
+}
+
+// SetPaused pauses or resumes scheduled runs. A run in progress is not
+// interrupted.
+func (s *SboxctlService) SetPaused(paused bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.paused = paused
+}
+
+// TriggerRun requests a run outside of the schedule and returns its ID.
+// The run starts once a run in progress finishes; its events, including
+// RUN_STARTED and RUN_FINISHED, carry the ID.
+func (s *SboxctlService) TriggerRun() (string, error) {
+	s.mu.RLock()
+	running, paused := s.running, s.paused
+	s.mu.RUnlock()
+	if !running {
+		return "", fmt.Errorf("sboxctl service is not running")
+	}
+	if paused {
+		return "", ErrRunsPaused
+	}
+	if s.circuitBlocked(time.Now()) {
+		return "", ErrCircuitOpen
+	}
+
+	id := uuid.NewString()
+	select {
+	case s.trigger <- id:
+		return id, nil
+	default:
+		return "", ErrRunPending
+	}
+}
+
+// runOnce executes a scheduled sboxctl run
+func (s *SboxctlService) runOnce() {
+	s.runWithID(uuid.NewString(), false)
+}
+
+// runWithID executes sboxctl as run id and reports the outcome to the run
+// hook. Triggered runs also emit their start and finish as events.
+func (s *SboxctlService) runWithID(id string, triggered bool) {
+	s.mu.Lock()
+	paused := s.paused
+	s.runID = id
+	s.mu.Unlock()
+	if paused {
+		s.logger.Debug("Skipping paused sboxctl run", map[string]interface{}{})
+		s.skipRun(triggered, ErrRunsPaused)
+		return
+	}
+	if !s.circuitAllows(time.Now()) {
+		s.skipRun(triggered, ErrCircuitOpen)
+		return
+	}
+	if triggered {
+		s.emitRunEvent(RunStartedEventType, map[string]interface{}{})
+	}
+
+	started := time.Now()
+	s.executeSboxctl()
+
+	s.mu.RLock()
+	hook := s.runHook
+	err := s.lastError
+	s.mu.RUnlock()
+
+	if triggered {
+		finished := map[string]interface{}{
+			"success":  err == nil,
+			"duration": time.Since(started).Seconds(),
+		}
+		if err != nil {
+			finished["error"] = err.Error()
+		}
+		s.emitRunEvent(RunFinishedEventType, finished)
+	}
+
+	s.mu.Lock()
+	s.runID = ""
+	s.mu.Unlock()
+
+	if s.ctx.Err() != nil {
+		return
+	}
+	if hook != nil {
+		hook(err)
+	}
+	s.recordCircuit(err)
+}
+
+// skipRun ends a run that did not happen. A triggered run still reports
+// that it did not happen, since its client waits for RUN_FINISHED.
+func (s *SboxctlService) skipRun(triggered bool, reason error) {
+	if triggered {
+		s.emitRunEvent(RunFinishedEventType, map[string]interface{}{
+			"success": false,
+			"error":   reason.Error(),
+		})
+	}
+	s.mu.Lock()
+	s.runID = ""
+	s.mu.Unlock()
+}
+
+// emitRunEvent queues an event about the current run
+func (s *SboxctlService) emitRunEvent(eventType string, data map[string]interface{}) {
+	data["run_id"] = s.currentRunID()
+	s.handleEvent(&SboxctlEvent{
+		Type:      eventType,
+		Data:      data,
+		Timestamp: time.Now().UTC().Format(time.RFC3339),
+	})
+}
+
+// currentRunID returns the ID of the run in progress
+func (s *SboxctlService) currentRunID() string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.runID
+}
+
 // executeSboxctl executes the sboxctl command and captures output
 func (s *SboxctlService) executeSboxctl() {
 	s.mu.Lock()
 	s.lastRun = time.Now()
+	s.outputTruncated = false
 	s.mu.Unlock()
 
-	s.logger.Debug("Executing sboxctl command", map[string]interface{}{
-		"command": s.config.Command,
-	})
+	s.mu.RLock()
+	vars := s.vars
+	s.mu.RUnlock()
 
-	// Parse timeout
-	timeout, err := parseDuration(s.config.Timeout)
+	args, err := s.command.render(vars)
 	if err != nil {
-		s.logger.Error("Invalid timeout format", map[string]interface{}{
-			"timeout": s.config.Timeout,
+		s.logger.Error("Failed to render sboxctl command", map[string]interface{}{
+			"command": s.config.Command,
 			"error":   err.Error(),
 		})
+		s.setLastError(err)
+		return
+	}
+
+	s.logger.Debug("Executing sboxctl command", map[string]interface{}{
+		"command": args,
+	})
+
+	if s.config.Timeout <= 0 {
+		s.logger.Error("Invalid timeout", map[string]interface{}{
+			"timeout": s.config.Timeout.String(),
+		})
 		return
 	}
 
 	// Create context with timeout
-	ctx, cancel := context.WithTimeout(s.ctx, timeout)
+	ctx, cancel := context.WithTimeout(s.ctx, s.config.Timeout)
 	defer cancel()
 
-	// Create command
-	cmd := exec.CommandContext(ctx, s.config.Command[0], s.config.Command[1:]...)
+	// Create command in its own process group so a timeout kills the whole
+	// process tree
+	cmd := exec.CommandContext(ctx, args[0], args[1:]...)
+	cmd.Env = s.getEnv()
+	cmd.Dir = s.config.WorkDir
+	process.Prepare(cmd)
+	if err := process.SetCredential(cmd, s.getCredential()); err != nil {
+		s.logger.Error("Failed to set sboxctl user", map[string]interface{}{
+			"error": err.Error(),
+		})
+		s.setLastError(err)
+		return
+	}
 
-	// Capture stdout if enabled
+	// Capture stdout if enabled. Output is copied through a pipe so Wait is
+	// bounded by WaitDelay even if an orphan keeps stdout open.
+	var stdout *io.PipeWriter
+	var output *countingWriter
+	readDone := make(chan struct{})
 	if s.config.StdoutCapture {
-		stdout, err := cmd.StdoutPipe()
+		var reader *io.PipeReader
+		reader, stdout = io.Pipe()
+		output = &countingWriter{w: stdout}
+		cmd.Stdout = output
+		var record *RunRecord
+		if s.recorder != nil {
+			record = s.recorder.StartRun(time.Now())
+		}
+		go func() {
+			defer close(readDone)
+			s.readStdout(reader, record)
+		}()
+	} else {
+		close(readDone)
+	}
+
+	// Stderr is always captured so failures can be explained
+	stderrReader, stderr := io.Pipe()
+	cmd.Stderr = stderr
+	stderrDone := make(chan string, 1)
+	go func() {
+		stderrDone <- s.readStderr(stderrReader)
+	}()
+
+	// Keep stdin open for commands in interactive mode
+	var session *commandSession
+	if s.config.Interactive {
+		stdin, err := cmd.StdinPipe()
 		if err != nil {
-			s.logger.Error("Failed to create stdout pipe", map[string]interface{}{
+			if stdout != nil {
+				stdout.Close()
+			}
+			stderr.Close()
+			s.logger.Error("Failed to open sboxctl stdin", map[string]interface{}{
 				"error": err.Error(),
 			})
+			s.setLastError(err)
 			return
 		}
-
-		// Start reading stdout in a goroutine
-		go s.readStdout(stdout)
+		session = newCommandSession(stdin)
 	}
 
 	// Execute command
-	if err := cmd.Start(); err != nil {
+	started := time.Now()
+	if err := process.StartLimited(cmd, s.getLimits()); err != nil {
+		if stdout != nil {
+			stdout.Close()
+		}
+		stderr.Close()
+		s.recordRun(args, started, 0, err)
 		s.logger.Error("Failed to start sboxctl command", map[string]interface{}{
 			"command": s.config.Command,
 			"error":   err.Error(),
@@ -174,9 +573,31 @@ func (s *SboxctlService) executeSboxctl() {
 		s.setLastError(err)
 		return
 	}
+	s.setCmd(cmd)
+	defer s.setCmd(nil)
+	if session != nil {
+		s.setSession(session)
+		defer func() {
+			s.setSession(nil)
+			session.close()
+		}()
+	}
+
+	// Wait for completion, then for all output to be processed
+	err = process.Wait(cmd)
+	if stdout != nil {
+		stdout.Close()
+	}
+	stderr.Close()
+	<-readDone
+	stderrTail := <-stderrDone
+	s.setLastDuration(time.Since(started))
 
-	// Wait for completion
-	if err := cmd.Wait(); err != nil {
+	if err != nil {
+		err = &RunError{Err: err, Stderr: stderrTail}
+	}
+	s.recordRun(args, started, output.count(), err)
+	if err != nil {
 		s.logger.Error("Sboxctl command failed", map[string]interface{}{
 			"command": s.config.Command,
 			"error":   err.Error(),
@@ -191,12 +612,59 @@ func (s *SboxctlService) executeSboxctl() {
 	s.setLastError(nil)
 }
 
-// readStdout reads and processes stdout from sboxctl
-func (s *SboxctlService) readStdout(stdout interface{}) {
-	scanner := bufio.NewScanner(stdout.(interface{ Read(p []byte) (n int, err error) }))
-	
-	for scanner.Scan() {
-		line := strings.TrimSpace(scanner.Text())
+// readStdout reads and processes stdout from sboxctl. Lines are turned
+// into events by the configured parsers; JSON events are also written to
+// record, if not nil. Lines over the line limit are logged cut with a
+// truncation marker; output over the output limit is discarded.
+func (s *SboxctlService) readStdout(stdout io.Reader, record *RunRecord) {
+	lines := newLineReader(stdout, s.config.MaxLineBytes, s.config.MaxOutputBytes)
+	if record != nil {
+		defer record.Close()
+	}
+	chain, err := newParserChain(s.config.Parsers)
+	if err != nil {
+		s.logger.Error("Invalid sboxctl output parsers, using the defaults", map[string]interface{}{
+			"error": err.Error(),
+		})
+		chain, _ = newParserChain(nil)
+	}
+	defer func() {
+		for _, event := range chain.flush() {
+			s.handleEvent(event)
+		}
+	}()
+
+	for {
+		raw, cut, err := lines.next()
+		if errors.Is(err, errOutputLimit) {
+			s.logger.Warn("Sboxctl output truncated", map[string]interface{}{
+				"maxOutputBytes": s.config.MaxOutputBytes,
+			})
+			s.markOutputTruncated()
+			// Keep draining so sboxctl is not blocked writing
+			io.Copy(io.Discard, stdout)
+			return
+		}
+		if err != nil {
+			if err != io.EOF {
+				s.logger.Error("Error reading stdout", map[string]interface{}{
+					"error": err.Error(),
+				})
+				io.Copy(io.Discard, stdout)
+			}
+			return
+		}
+
+		line := strings.TrimSpace(string(raw))
+		if cut > 0 {
+			// A cut line cannot be parsed as an event
+			s.logger.Warn("Sboxctl output line truncated", map[string]interface{}{
+				"output":       truncated(line, cut),
+				"maxLineBytes": lines.maxLine,
+			})
+			s.markOutputTruncated()
+			continue
+		}
 		if line == "" {
 			continue
 		}
@@ -205,19 +673,63 @@ func (s *SboxctlService) readStdout(stdout interface{}) {
 			"line": line,
 		})
 
-		// Try to parse as JSON event
-		if event, err := s.parseEvent(line); err == nil {
+		// Indentation is kept for parsers of multi-line blocks
+		event, parser := chain.parse(strings.TrimRight(string(raw), "\r"))
+		switch {
+		case parser == ParserJSON:
+			s.recordEvent(record, line)
+			if !s.deliverResponse(event) {
+				s.handleEvent(event)
+			}
+		case event != nil:
 			s.handleEvent(event)
-		} else {
-			// Treat as plain log line
+		case parser == "":
 			s.logger.Info("Sboxctl output", map[string]interface{}{
 				"output": line,
 			})
 		}
 	}
+}
+
+// SendCommand writes a command to the stdin of the running interactive
+// sboxctl and waits for the RESPONSE event carrying its request_id. It fails
+// with ErrNoSession when no interactive run is in progress.
+func (s *SboxctlService) SendCommand(ctx context.Context, command string, params map[string]interface{}) (*SboxctlEvent, error) {
+	s.mu.RLock()
+	session := s.session
+	s.mu.RUnlock()
+	if session == nil {
+		return nil, ErrNoSession
+	}
+	return session.send(ctx, command, params)
+}
+
+// setSession sets the command session of the current run
+func (s *SboxctlService) setSession(session *commandSession) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.session = session
+}
+
+// deliverResponse passes a response event to the command waiting for it and
+// reports whether there was one; other events are processed as usual
+func (s *SboxctlService) deliverResponse(event *SboxctlEvent) bool {
+	s.mu.RLock()
+	session := s.session
+	s.mu.RUnlock()
+	return session != nil && session.deliver(event)
+}
 
-	if err := scanner.Err(); err != nil {
-		s.logger.Error("Error reading stdout", map[string]interface{}{
+// recordEvent writes a raw event line to the run record. Failures are
+// logged once per run and recording stops for the rest of it.
+func (s *SboxctlService) recordEvent(record *RunRecord, line string) {
+	if record == nil || record.failed {
+		return
+	}
+	if err := record.Write(line); err != nil {
+		record.failed = true
+		s.logger.Error("Failed to record sboxctl event", map[string]interface{}{
+			"path":  record.Path(),
 			"error": err.Error(),
 		})
 	}
@@ -246,30 +758,37 @@ func (s *SboxctlService) handleEvent(event *SboxctlEvent) {
 		"version":   event.Version,
 	})
 
+	if event.RunID == "" {
+		event.RunID = s.currentRunID()
+	}
+
 	// Send event to channel for further processing
 	select {
 	case s.eventChan <- *event:
 		// Event sent successfully
 	default:
 		// Channel is full, log warning
+		dropped := atomic.AddInt64(&s.eventsDropped, 1)
 		s.logger.Warn("Event channel is full, dropping event", map[string]interface{}{
-			"type": event.Type,
+			"type":     event.Type,
+			"capacity": cap(s.eventChan),
+			"dropped":  dropped,
 		})
 	}
 }
 
 // healthChecker runs periodic health checks
 func (s *SboxctlService) healthChecker() {
-	interval, err := parseDuration(s.config.HealthCheck.Interval)
-	if err != nil {
+	defer s.wg.Done()
+
+	if s.config.HealthCheck.Interval <= 0 {
 		s.logger.Error("Invalid health check interval", map[string]interface{}{
-			"interval": s.config.HealthCheck.Interval,
-			"error":    err.Error(),
+			"interval": s.config.HealthCheck.Interval.String(),
 		})
 		return
 	}
 
-	ticker := time.NewTicker(interval)
+	ticker := time.NewTicker(s.config.HealthCheck.Interval)
 	defer ticker.Stop()
 
 	for {
@@ -302,6 +821,34 @@ func (s *SboxctlService) performHealthCheck() {
 	}
 }
 
+// getEnv returns the configured sboxctl environment
+func (s *SboxctlService) getEnv() []string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.env
+}
+
+// getCredential returns the user sboxctl runs as
+func (s *SboxctlService) getCredential() *process.Credential {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.credential
+}
+
+// getLimits returns the resource limits of sboxctl runs
+func (s *SboxctlService) getLimits() *process.Limits {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.limits
+}
+
+// setCmd records the currently running command
+func (s *SboxctlService) setCmd(cmd *exec.Cmd) {
+	s.cmdMu.Lock()
+	defer s.cmdMu.Unlock()
+	s.cmd = cmd
+}
+
 // setLastError sets the last error
 func (s *SboxctlService) setLastError(err error) {
 	s.mu.Lock()
@@ -309,6 +856,21 @@ func (s *SboxctlService) setLastError(err error) {
 	s.lastError = err
 }
 
+// setLastDuration records how long the last command ran
+func (s *SboxctlService) setLastDuration(d time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.lastDuration = d
+}
+
+// LastRunDuration returns how long the last completed command ran, or zero
+// if none has completed yet
+func (s *SboxctlService) LastRunDuration() time.Duration {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.lastDuration
+}
+
 // GetStatus returns the current service status
 func (s *SboxctlService) GetStatus() map[string]interface{} {
 	s.mu.RLock()
@@ -318,12 +880,29 @@ func (s *SboxctlService) GetStatus() map[string]interface{} {
 		"running":   s.running,
 		"lastRun":   s.lastRun,
 		"command":   s.config.Command,
-		"interval":  s.config.Interval,
-		"timeout":   s.config.Timeout,
+		"interval":  s.config.Interval.String(),
+		"timeout":   s.config.Timeout.String(),
+	}
+
+	if s.schedule != nil {
+		status["schedule"] = s.config.Schedule
+		status["nextRun"] = s.nextRun
+	}
+
+	if s.circuit.open || s.circuit.failures > 0 {
+		status["circuit"] = s.circuitStatus()
+	}
+
+	if s.outputTruncated {
+		status["outputTruncated"] = true
 	}
 
 	if s.lastError != nil {
 		status["lastError"] = s.lastError.Error()
+		var runErr *RunError
+		if errors.As(s.lastError, &runErr) && runErr.Stderr != "" {
+			status["lastStderr"] = runErr.Stderr
+		}
 	}
 
 	return status
@@ -334,32 +913,19 @@ func (s *SboxctlService) GetEventChannel() <-chan SboxctlEvent {
 	return s.eventChan
 }
 
-// parseDuration parses a duration string (e.g., "30m", "5m", "10s", "1m30s")
-func parseDuration(duration string) (time.Duration, error) {
-	if d, err := time.ParseDuration(duration); err == nil {
-		return d, nil
+// EventQueueStats returns the fill level and overflow count of the event channel
+func (s *SboxctlService) EventQueueStats() QueueStats {
+	return QueueStats{
+		Capacity: cap(s.eventChan),
+		Length:   len(s.eventChan),
+		Dropped:  atomic.LoadInt64(&s.eventsDropped),
 	}
-	// Fallback: handle only pure integer + unit (legacy)
-	switch {
-	case strings.HasSuffix(duration, "s"):
-		val, err := strconv.Atoi(strings.TrimSuffix(duration, "s"))
-		if err != nil {
-			return 0, err
-		}
-		return time.Duration(val) * time.Second, nil
-	case strings.HasSuffix(duration, "m"):
-		val, err := strconv.Atoi(strings.TrimSuffix(duration, "m"))
-		if err != nil {
-			return 0, err
-		}
-		return time.Duration(val) * time.Minute, nil
-	case strings.HasSuffix(duration, "h"):
-		val, err := strconv.Atoi(strings.TrimSuffix(duration, "h"))
-		if err != nil {
-			return 0, err
-		}
-		return time.Duration(val) * time.Hour, nil
-	default:
-		return 0, fmt.Errorf("invalid duration: %s", duration)
+}
+
+// eventBuffer returns the configured event channel size, or the default
+func eventBuffer(size int) int {
+	if size <= 0 {
+		return DefaultEventBuffer
 	}
-} 
\ No newline at end of file
+	return size
+}
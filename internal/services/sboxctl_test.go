@@ -18,13 +18,13 @@ func TestNewSboxctlService(t *testing.T) {
 	cfg := config.SboxctlConfig{
 		Enabled:       true,
 		Command:       []string{"echo", "test"},
-		Interval:      "1m",
-		Timeout:       "30s",
+		Interval:      time.Minute,
+		Timeout:       30 * time.Second,
 		StdoutCapture: true,
 		HealthCheck: config.HealthCheckConfig{
 			Enabled:  true,
-			Interval: "30s",
-			Timeout:  "5s",
+			Interval: 30 * time.Second,
+			Timeout:  5 * time.Second,
 		},
 	}
 
@@ -34,33 +34,6 @@ func TestNewSboxctlService(t *testing.T) {
 	assert.Equal(t, cfg, service.config)
 }
 
-func TestParseDuration(t *testing.T) {
-	tests := []struct {
-		input    string
-		expected time.Duration
-		hasError bool
-	}{
-		{"30s", 30 * time.Second, false},
-		{"5m", 5 * time.Minute, false},
-		{"2h", 2 * time.Hour, false},
-		{"1m30s", 90 * time.Second, false},
-		{"invalid", 0, true},
-		{"", 0, true},
-	}
-
-	for _, tt := range tests {
-		t.Run(tt.input, func(t *testing.T) {
-			duration, err := parseDuration(tt.input)
-			if tt.hasError {
-				assert.Error(t, err)
-			} else {
-				assert.NoError(t, err)
-				assert.Equal(t, tt.expected, duration)
-			}
-		})
-	}
-}
-
 func TestSboxctlService_ParseEvent(t *testing.T) {
 	logger, err := logger.New("info")
 	require.NoError(t, err)
@@ -68,8 +41,8 @@ func TestSboxctlService_ParseEvent(t *testing.T) {
 	cfg := config.SboxctlConfig{
 		Enabled:       true,
 		Command:       []string{"echo", "test"},
-		Interval:      "1m",
-		Timeout:       "30s",
+		Interval:      time.Minute,
+		Timeout:       30 * time.Second,
 		StdoutCapture: true,
 	}
 
@@ -104,8 +77,8 @@ func TestSboxctlService_GetStatus(t *testing.T) {
 	cfg := config.SboxctlConfig{
 		Enabled:       true,
 		Command:       []string{"echo", "test"},
-		Interval:      "1m",
-		Timeout:       "30s",
+		Interval:      time.Minute,
+		Timeout:       30 * time.Second,
 		StdoutCapture: true,
 	}
 
@@ -116,7 +89,7 @@ func TestSboxctlService_GetStatus(t *testing.T) {
 	status := service.GetStatus()
 	assert.False(t, status["running"].(bool))
 	assert.Equal(t, []string{"echo", "test"}, status["command"])
-	assert.Equal(t, "1m", status["interval"])
+	assert.Equal(t, "1m0s", status["interval"])
 	assert.Equal(t, "30s", status["timeout"])
 
 	// Start service
@@ -147,8 +120,8 @@ func TestSboxctlService_StartStop(t *testing.T) {
 	cfg := config.SboxctlConfig{
 		Enabled:       true,
 		Command:       []string{"echo", "test"},
-		Interval:      "1m",
-		Timeout:       "30s",
+		Interval:      time.Minute,
+		Timeout:       30 * time.Second,
 		StdoutCapture: true,
 	}
 
@@ -182,8 +155,8 @@ func TestSboxctlService_DoubleStart(t *testing.T) {
 	cfg := config.SboxctlConfig{
 		Enabled:       true,
 		Command:       []string{"echo", "test"},
-		Interval:      "1m",
-		Timeout:       "30s",
+		Interval:      time.Minute,
+		Timeout:       30 * time.Second,
 		StdoutCapture: true,
 	}
 
@@ -210,8 +183,8 @@ func TestSboxctlService_GetEventChannel(t *testing.T) {
 	cfg := config.SboxctlConfig{
 		Enabled:       true,
 		Command:       []string{"echo", "test"},
-		Interval:      "1m",
-		Timeout:       "30s",
+		Interval:      time.Minute,
+		Timeout:       30 * time.Second,
 		StdoutCapture: true,
 	}
 
@@ -225,4 +198,159 @@ func TestSboxctlService_GetEventChannel(t *testing.T) {
 	// Channel should be buffered - we can't test sending to receive-only channel
 	// but we can verify it's not nil and has the right type
 	assert.IsType(t, (<-chan SboxctlEvent)(nil), eventChan)
-} 
\ No newline at end of file
+} 
+func TestSboxctlService_EventQueueStats(t *testing.T) {
+	logger, err := logger.New("error")
+	require.NoError(t, err)
+
+	service, err := NewSboxctlService(config.SboxctlConfig{
+		Command:     []string{"echo"},
+		EventBuffer: 1,
+	}, logger)
+	require.NoError(t, err)
+
+	service.handleEvent(&SboxctlEvent{Type: "LOG"})
+	service.handleEvent(&SboxctlEvent{Type: "LOG"})
+
+	assert.Equal(t, QueueStats{Capacity: 1, Length: 1, Dropped: 1}, service.EventQueueStats())
+
+	// Without a configured size the default is used
+	service, err = NewSboxctlService(config.SboxctlConfig{Command: []string{"echo"}}, logger)
+	require.NoError(t, err)
+	assert.Equal(t, DefaultEventBuffer, service.EventQueueStats().Capacity)
+}
+
+func TestSboxctlService_SetPaused(t *testing.T) {
+	logger, err := logger.New("error")
+	require.NoError(t, err)
+
+	service, err := NewSboxctlService(config.SboxctlConfig{Command: []string{"echo"}, Timeout: time.Second}, logger)
+	require.NoError(t, err)
+
+	called := false
+	service.SetRunHook(func(err error) { called = true })
+	service.SetPaused(true)
+	service.runOnce()
+	assert.False(t, called)
+	assert.True(t, service.lastRun.IsZero())
+}
+
+func TestSboxctlService_Schedule(t *testing.T) {
+	log, err := logger.New("error")
+	require.NoError(t, err)
+
+	_, err = NewSboxctlService(config.SboxctlConfig{
+		Command:  []string{"true"},
+		Schedule: "0 25 * * *",
+	}, log)
+	assert.ErrorContains(t, err, "invalid sboxctl schedule")
+
+	service, err := NewSboxctlService(config.SboxctlConfig{
+		Command:  []string{"true"},
+		Schedule: "0 4 * * *",
+		Splay:    10 * time.Minute,
+	}, log)
+	require.NoError(t, err)
+
+	now := time.Date(2025, 6, 25, 10, 0, 0, 0, time.UTC)
+	for i := 0; i < 20; i++ {
+		delay, ok := service.nextDelay(now)
+		require.True(t, ok)
+		assert.GreaterOrEqual(t, delay, 18*time.Hour)
+		assert.Less(t, delay, 18*time.Hour+10*time.Minute)
+	}
+
+	status := service.GetStatus()
+	assert.Equal(t, "0 4 * * *", status["schedule"])
+	assert.False(t, status["nextRun"].(time.Time).IsZero())
+}
+
+func TestSboxctlService_TriggerRun(t *testing.T) {
+	log, err := logger.New("error")
+	require.NoError(t, err)
+
+	service, err := NewSboxctlService(config.SboxctlConfig{
+		Command:       []string{"echo", `{"type":"LOG","data":{"message":"updated"}}`},
+		Interval:      time.Hour,
+		Timeout:       10 * time.Second,
+		StdoutCapture: true,
+	}, log)
+	require.NoError(t, err)
+
+	_, err = service.TriggerRun()
+	assert.ErrorContains(t, err, "not running")
+
+	require.NoError(t, service.Start(context.Background()))
+	defer service.Stop()
+
+	// The run at start has no start and finish events
+	next := func() SboxctlEvent {
+		select {
+		case event := <-service.GetEventChannel():
+			return event
+		case <-time.After(5 * time.Second):
+			t.Fatal("no sboxctl event")
+			return SboxctlEvent{}
+		}
+	}
+	scheduled := next()
+	assert.Equal(t, "LOG", scheduled.Type)
+	assert.NotEmpty(t, scheduled.RunID)
+
+	id, err := service.TriggerRun()
+	require.NoError(t, err)
+	assert.NotEqual(t, scheduled.RunID, id)
+
+	for _, eventType := range []string{RunStartedEventType, "LOG", RunFinishedEventType} {
+		event := next()
+		assert.Equal(t, eventType, event.Type)
+		assert.Equal(t, id, event.RunID)
+		if eventType == RunFinishedEventType {
+			assert.Equal(t, true, event.Data["success"])
+			assert.Equal(t, id, event.Data["run_id"])
+		}
+	}
+}
+
+func TestSboxctlService_TriggerRunPending(t *testing.T) {
+	log, err := logger.New("error")
+	require.NoError(t, err)
+	service, err := NewSboxctlService(config.SboxctlConfig{Command: []string{"true"}}, log)
+	require.NoError(t, err)
+
+	// Without a run loop the first request stays queued
+	service.running = true
+	_, err = service.TriggerRun()
+	require.NoError(t, err)
+	_, err = service.TriggerRun()
+	assert.ErrorIs(t, err, ErrRunPending)
+
+	service.SetPaused(true)
+	_, err = service.TriggerRun()
+	assert.ErrorIs(t, err, ErrRunsPaused)
+}
+
+func TestSboxctlService_TriggeredRunPausedBeforeStart(t *testing.T) {
+	log, err := logger.New("error")
+	require.NoError(t, err)
+	service, err := NewSboxctlService(config.SboxctlConfig{Command: []string{"true"}}, log)
+	require.NoError(t, err)
+
+	// Runs are paused between the trigger and the run loop picking it up
+	service.running = true
+	id, err := service.TriggerRun()
+	require.NoError(t, err)
+	service.SetPaused(true)
+	service.runWithID(<-service.trigger, true)
+
+	select {
+	case event := <-service.GetEventChannel():
+		assert.Equal(t, RunFinishedEventType, event.Type)
+		assert.Equal(t, id, event.RunID)
+		assert.Equal(t, false, event.Data["success"])
+		assert.Equal(t, ErrRunsPaused.Error(), event.Data["error"])
+	default:
+		t.Fatal("no RUN_FINISHED event")
+	}
+	assert.True(t, service.lastRun.IsZero())
+}
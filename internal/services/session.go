@@ -0,0 +1,121 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+
+	"github.com/google/uuid"
+)
+
+// ResponseEventType is the type of events sboxctl emits in reply to a
+// command sent on its stdin. The data carries the command's request_id.
+const ResponseEventType = "RESPONSE"
+
+// ErrNoSession is returned when a command is sent while no interactive
+// sboxctl run is in progress
+var ErrNoSession = errors.New("no interactive sboxctl session is running")
+
+// SboxctlCommand is a command written to sboxctl's stdin as one JSON line
+type SboxctlCommand struct {
+	ID      string                 `json:"id"`
+	Command string                 `json:"command"`
+	Params  map[string]interface{} `json:"params,omitempty"`
+}
+
+// commandSession is the stdin of an interactive sboxctl run and the
+// commands waiting for their responses
+type commandSession struct {
+	// writeMu serializes commands; it is not held while waiting so a full
+	// stdin pipe cannot block the delivery of responses
+	writeMu sync.Mutex
+	stdin   io.Writer
+
+	mu      sync.Mutex
+	pending map[string]chan SboxctlEvent
+	closed  bool
+}
+
+// newCommandSession creates a session writing commands to stdin
+func newCommandSession(stdin io.Writer) *commandSession {
+	return &commandSession{
+		stdin:   stdin,
+		pending: make(map[string]chan SboxctlEvent),
+	}
+}
+
+// send writes a command and waits for the response event with its ID
+func (c *commandSession) send(ctx context.Context, command string, params map[string]interface{}) (*SboxctlEvent, error) {
+	cmd := SboxctlCommand{ID: uuid.NewString(), Command: command, Params: params}
+	line, err := json.Marshal(cmd)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode sboxctl command: %w", err)
+	}
+
+	reply := make(chan SboxctlEvent, 1)
+	c.mu.Lock()
+	if c.closed {
+		c.mu.Unlock()
+		return nil, ErrNoSession
+	}
+	c.pending[cmd.ID] = reply
+	c.mu.Unlock()
+	defer c.forget(cmd.ID)
+
+	c.writeMu.Lock()
+	_, err = c.stdin.Write(append(line, '\n'))
+	c.writeMu.Unlock()
+	if err != nil {
+		return nil, fmt.Errorf("failed to send sboxctl command: %w", err)
+	}
+
+	select {
+	case <-ctx.Done():
+		return nil, fmt.Errorf("no response to sboxctl command %s: %w", command, ctx.Err())
+	case event, ok := <-reply:
+		if !ok {
+			return nil, fmt.Errorf("sboxctl exited before responding to %s", command)
+		}
+		return &event, nil
+	}
+}
+
+// deliver hands a response event to the command waiting for it and reports
+// whether one was
+func (c *commandSession) deliver(event *SboxctlEvent) bool {
+	if event.Type != ResponseEventType {
+		return false
+	}
+	id, _ := event.Data["request_id"].(string)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	reply, ok := c.pending[id]
+	if !ok {
+		return false
+	}
+	delete(c.pending, id)
+	reply <- *event
+	return true
+}
+
+// forget drops a command that is no longer waited for
+func (c *commandSession) forget(id string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.pending, id)
+}
+
+// close fails the waiting commands and rejects new ones
+func (c *commandSession) close() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.closed = true
+	for id, reply := range c.pending {
+		close(reply)
+		delete(c.pending, id)
+	}
+}
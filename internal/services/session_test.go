@@ -0,0 +1,103 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/kpblcaoo/sboxagent/internal/config"
+	"github.com/kpblcaoo/sboxagent/internal/logger"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// interactiveSboxctl answers every command line with a RESPONSE event and
+// exits after "quit"
+const interactiveSboxctl = `#!/bin/sh
+echo '{"type":"READY","data":{}}'
+while read -r line; do
+  id=$(echo "$line" | sed 's/.*"id":"\([^"]*\)".*/\1/')
+  echo "{\"type\":\"RESPONSE\",\"data\":{\"request_id\":\"$id\",\"status\":\"ok\"}}"
+  case "$line" in *'"quit"'*) exit 0;; esac
+done
+`
+
+func TestSboxctlService_SendCommand(t *testing.T) {
+	log, err := logger.New("error")
+	require.NoError(t, err)
+
+	script := filepath.Join(t.TempDir(), "sboxctl")
+	require.NoError(t, os.WriteFile(script, []byte(interactiveSboxctl), 0755))
+	service, err := NewSboxctlService(config.SboxctlConfig{
+		Command:       []string{script},
+		Interval:      time.Hour,
+		Timeout:       10 * time.Second,
+		StdoutCapture: true,
+		Interactive:   true,
+	}, log)
+	require.NoError(t, err)
+
+	_, err = service.SendCommand(context.Background(), "refresh", nil)
+	assert.ErrorIs(t, err, ErrNoSession)
+
+	require.NoError(t, service.Start(context.Background()))
+	defer service.Stop()
+
+	// Regular events are still forwarded
+	select {
+	case event := <-service.GetEventChannel():
+		assert.Equal(t, "READY", event.Type)
+	case <-time.After(5 * time.Second):
+		t.Fatal("no READY event")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	response, err := service.SendCommand(ctx, "set_exclusions", map[string]interface{}{"servers": []string{"ru-1"}})
+	require.NoError(t, err)
+	assert.Equal(t, ResponseEventType, response.Type)
+	assert.Equal(t, "ok", response.Data["status"])
+
+	_, err = service.SendCommand(ctx, "quit", nil)
+	require.NoError(t, err)
+	assert.Eventually(t, func() bool {
+		_, err := service.SendCommand(ctx, "refresh", nil)
+		return errors.Is(err, ErrNoSession)
+	}, 5*time.Second, 10*time.Millisecond)
+	assert.Empty(t, service.GetEventChannel())
+}
+
+func TestCommandSession_Close(t *testing.T) {
+	var stdin bytes.Buffer
+	session := newCommandSession(&stdin)
+
+	done := make(chan error, 1)
+	go func() {
+		_, err := session.send(context.Background(), "refresh", nil)
+		done <- err
+	}()
+
+	// The command is written as one JSON line before anyone answers
+	require.Eventually(t, func() bool {
+		session.writeMu.Lock()
+		defer session.writeMu.Unlock()
+		return stdin.Len() > 0
+	}, time.Second, time.Millisecond)
+	var cmd SboxctlCommand
+	require.NoError(t, json.Unmarshal(stdin.Bytes(), &cmd))
+	assert.Equal(t, "refresh", cmd.Command)
+	assert.NotEmpty(t, cmd.ID)
+
+	// Responses for unknown requests are not consumed
+	assert.False(t, session.deliver(&SboxctlEvent{Type: ResponseEventType, Data: map[string]interface{}{"request_id": "other"}}))
+
+	session.close()
+	assert.ErrorContains(t, <-done, "sboxctl exited before responding to refresh")
+	_, err := session.send(context.Background(), "refresh", nil)
+	assert.ErrorIs(t, err, ErrNoSession)
+}
@@ -0,0 +1,103 @@
+package services
+
+import (
+	"io"
+	"strings"
+)
+
+// stderrTailLines is the number of stderr lines kept for the run error
+const stderrTailLines = 20
+
+// Stderr line classes
+const (
+	StderrWarning = "warn"
+	StderrError   = "error"
+)
+
+// stderrErrorMarkers mark a stderr line as an error rather than a warning
+var stderrErrorMarkers = []string{"error", "fatal", "panic", "failed", "traceback"}
+
+// RunError is the error of a failed sboxctl run with the tail of its stderr
+type RunError struct {
+	Err    error
+	Stderr string
+}
+
+func (e *RunError) Error() string {
+	if e.Stderr == "" {
+		return e.Err.Error()
+	}
+	return e.Err.Error() + ": " + lastStderrLine(e.Stderr)
+}
+
+func (e *RunError) Unwrap() error {
+	return e.Err
+}
+
+// ClassifyStderr returns StderrError for lines reporting errors and
+// StderrWarning for anything else written to stderr
+func ClassifyStderr(line string) string {
+	lower := strings.ToLower(line)
+	for _, marker := range stderrErrorMarkers {
+		if strings.Contains(lower, marker) {
+			return StderrError
+		}
+	}
+	return StderrWarning
+}
+
+// readStderr passes each stderr line of a run to the stderr hook and
+// returns the last stderrTailLines lines
+func (s *SboxctlService) readStderr(stderr io.Reader) string {
+	s.mu.RLock()
+	hook := s.stderrHook
+	s.mu.RUnlock()
+
+	var tail []string
+	lines := newLineReader(stderr, s.config.MaxLineBytes, 0)
+	for {
+		raw, cut, err := lines.next()
+		if err != nil {
+			if err != io.EOF {
+				s.logger.Error("Error reading stderr", map[string]interface{}{
+					"error": err.Error(),
+				})
+				io.Copy(io.Discard, stderr)
+			}
+			break
+		}
+		line := strings.TrimSpace(string(raw))
+		if line == "" {
+			continue
+		}
+		if cut > 0 {
+			line = truncated(line, cut)
+		}
+		level := ClassifyStderr(line)
+		s.logger.Debug("Received stderr line", map[string]interface{}{
+			"line":  line,
+			"level": level,
+		})
+		if hook != nil {
+			hook(level, line)
+		}
+
+		tail = append(tail, line)
+		if len(tail) > stderrTailLines {
+			tail = tail[1:]
+		}
+	}
+	return strings.Join(tail, "\n")
+}
+
+// lastStderrLine returns the last error line of a stderr tail, or its last
+// line if none is classified as an error
+func lastStderrLine(tail string) string {
+	lines := strings.Split(tail, "\n")
+	for i := len(lines) - 1; i >= 0; i-- {
+		if ClassifyStderr(lines[i]) == StderrError {
+			return lines[i]
+		}
+	}
+	return lines[len(lines)-1]
+}
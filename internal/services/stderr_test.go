@@ -0,0 +1,80 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/kpblcaoo/sboxagent/internal/config"
+	"github.com/kpblcaoo/sboxagent/internal/logger"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestClassifyStderr(t *testing.T) {
+	assert.Equal(t, StderrError, ClassifyStderr("ERROR: subscription unreachable"))
+	assert.Equal(t, StderrError, ClassifyStderr("panic: runtime error"))
+	assert.Equal(t, StderrError, ClassifyStderr("request failed, retrying"))
+	assert.Equal(t, StderrWarning, ClassifyStderr("WARNING: deprecated option"))
+	assert.Equal(t, StderrWarning, ClassifyStderr("fetching subscription"))
+}
+
+func TestSboxctlService_CapturesStderr(t *testing.T) {
+	log, err := logger.New("error")
+	require.NoError(t, err)
+
+	script := filepath.Join(t.TempDir(), "sboxctl")
+	require.NoError(t, os.WriteFile(script, []byte(`#!/bin/sh
+echo "warning: deprecated option" >&2
+echo "error: subscription unreachable" >&2
+echo "cleaning up" >&2
+exit 3
+`), 0755))
+	service, err := NewSboxctlService(config.SboxctlConfig{
+		Command:  []string{script},
+		Interval: time.Hour,
+		Timeout:  10 * time.Second,
+	}, log)
+	require.NoError(t, err)
+
+	var mu sync.Mutex
+	var lines [][2]string
+	service.SetStderrHook(func(level, line string) {
+		mu.Lock()
+		defer mu.Unlock()
+		lines = append(lines, [2]string{level, line})
+	})
+
+	runs := make(chan error, 1)
+	service.SetRunHook(func(err error) { runs <- err })
+	require.NoError(t, service.Start(context.Background()))
+	defer service.Stop()
+
+	var runErr error
+	select {
+	case runErr = <-runs:
+	case <-time.After(5 * time.Second):
+		t.Fatal("sboxctl did not run")
+	}
+
+	var stderrErr *RunError
+	require.True(t, errors.As(runErr, &stderrErr))
+	assert.EqualError(t, runErr, "exit status 3: error: subscription unreachable")
+	assert.Equal(t, "warning: deprecated option\nerror: subscription unreachable\ncleaning up", stderrErr.Stderr)
+
+	mu.Lock()
+	assert.Equal(t, [][2]string{
+		{StderrWarning, "warning: deprecated option"},
+		{StderrError, "error: subscription unreachable"},
+		{StderrWarning, "cleaning up"},
+	}, lines)
+	mu.Unlock()
+
+	status := service.GetStatus()
+	assert.Equal(t, "exit status 3: error: subscription unreachable", status["lastError"])
+	assert.Equal(t, stderrErr.Stderr, status["lastStderr"])
+}
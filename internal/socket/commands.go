@@ -0,0 +1,73 @@
+// internal/socket/commands.go
+// sboxagent: command dispatch for socket clients
+
+package socket
+
+import (
+	"fmt"
+	"net"
+)
+
+// CommandHandler handles a command and returns the response data.
+type CommandHandler func(params map[string]interface{}) (map[string]interface{}, error)
+
+// CommandError is returned by handlers to reply with a specific error code.
+type CommandError struct {
+	Code    string
+	Message string
+}
+
+// Error implements the error interface.
+func (e *CommandError) Error() string {
+	return fmt.Sprintf("%s: %s", e.Code, e.Message)
+}
+
+// RegisterCommand registers a handler for a command name, replacing any
+// previous handler.
+func (s *Server) RegisterCommand(name string, handler CommandHandler) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.commands[name] = handler
+}
+
+// handleCommand dispatches a command from peer to its registered handler.
+// It returns false if the message is not a registered command.
+func (s *Server) handleCommand(peer string, msg *Message) (*Message, bool) {
+	if msg.Type != string(MessageTypeCommand) || msg.Command == nil {
+		return nil, false
+	}
+
+	s.mu.Lock()
+	handler, ok := s.commands[msg.Command.Command]
+	s.mu.Unlock()
+	if !ok {
+		return nil, false
+	}
+
+	params := msg.Command.Params
+	if params == nil {
+		params = map[string]interface{}{}
+	}
+
+	data, err := handler(params)
+	if s.CommandHook != nil {
+		s.CommandHook(peer, msg.Command.Command, params, err)
+	}
+	if err != nil {
+		errMsg := &ErrorMessage{Code: "COMMAND_FAILED", Message: err.Error()}
+		if cmdErr, ok := err.(*CommandError); ok {
+			errMsg = &ErrorMessage{Code: cmdErr.Code, Message: cmdErr.Message}
+		}
+		return NewResponseMessage(msg.ID, "error", nil, errMsg), true
+	}
+	return NewResponseMessage(msg.ID, "success", data, nil), true
+}
+
+// peerName returns the address of a connected client; unix socket clients
+// usually have none
+func peerName(conn net.Conn) string {
+	if addr := conn.RemoteAddr(); addr != nil && addr.String() != "" {
+		return addr.String()
+	}
+	return "unix"
+}
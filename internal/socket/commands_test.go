@@ -0,0 +1,69 @@
+package socket
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestServer_RegisteredCommands(t *testing.T) {
+	dir := t.TempDir()
+	socketPath := filepath.Join(dir, "test.sock")
+	server := NewServer(socketPath, log.New(os.Stdout, "[test-server] ", log.LstdFlags))
+
+	server.RegisterCommand("hello", func(params map[string]interface{}) (map[string]interface{}, error) {
+		return map[string]interface{}{"greeting": "hello " + params["name"].(string)}, nil
+	})
+	server.RegisterCommand("fail", func(params map[string]interface{}) (map[string]interface{}, error) {
+		return nil, errors.New("boom")
+	})
+	server.RegisterCommand("forbidden", func(params map[string]interface{}) (map[string]interface{}, error) {
+		return nil, &CommandError{Code: "FORBIDDEN", Message: "not allowed"}
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go server.Start(ctx)
+	time.Sleep(100 * time.Millisecond)
+
+	conn, err := net.Dial("unix", socketPath)
+	require.NoError(t, err)
+	defer conn.Close()
+
+	request := func(command string, params map[string]interface{}) *ResponseMessage {
+		msg := NewCommandMessage(command, params)
+		require.NoError(t, WriteMessage(conn, msg))
+		reply, err := ReadMessage(conn)
+		require.NoError(t, err)
+		require.NotNil(t, reply.Response)
+		assert.Equal(t, msg.ID, reply.Response.RequestID)
+		return reply.Response
+	}
+
+	resp := request("hello", map[string]interface{}{"name": "agent"})
+	assert.Equal(t, "success", resp.Status)
+	assert.Equal(t, "hello agent", resp.Data["greeting"])
+
+	resp = request("fail", nil)
+	assert.Equal(t, "error", resp.Status)
+	assert.Equal(t, "COMMAND_FAILED", resp.Error.Code)
+	assert.Equal(t, "boom", resp.Error.Message)
+
+	resp = request("forbidden", nil)
+	assert.Equal(t, "FORBIDDEN", resp.Error.Code)
+
+	// Unregistered commands are still echoed
+	msg := NewCommandMessage("unknown", nil)
+	require.NoError(t, WriteMessage(conn, msg))
+	echo, err := ReadMessage(conn)
+	require.NoError(t, err)
+	assert.Equal(t, msg.ID, echo.ID)
+}
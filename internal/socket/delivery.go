@@ -0,0 +1,192 @@
+// internal/socket/delivery.go
+// sboxagent: acknowledged delivery of important events
+
+package socket
+
+import (
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// DefaultDeliveryTTL is how long an unacknowledged message is retained.
+	DefaultDeliveryTTL = 15 * time.Minute
+
+	// DefaultMaxPending is the maximum number of retained messages.
+	DefaultMaxPending = 1000
+
+	// CommandAck is the command a client sends to acknowledge a message.
+	CommandAck = "ack"
+)
+
+// pendingMessage is a message waiting for acknowledgement.
+type pendingMessage struct {
+	msg       *Message
+	expiresAt time.Time
+}
+
+// DeliveryQueue retains messages that require acknowledgement until a client
+// acks them or their TTL expires.
+type DeliveryQueue struct {
+	mu         sync.Mutex
+	ttl        time.Duration
+	maxPending int
+	pending    map[string]*pendingMessage
+	order      []string
+
+	// Statistics
+	acked   int64
+	expired int64
+	dropped int64
+}
+
+// DeliveryStats holds delivery queue statistics.
+type DeliveryStats struct {
+	Pending int   `json:"pending"`
+	Acked   int64 `json:"acked"`
+	Expired int64 `json:"expired"`
+	Dropped int64 `json:"dropped"`
+}
+
+// NewDeliveryQueue creates a new delivery queue.
+func NewDeliveryQueue(ttl time.Duration, maxPending int) *DeliveryQueue {
+	if ttl <= 0 {
+		ttl = DefaultDeliveryTTL
+	}
+	if maxPending <= 0 {
+		maxPending = DefaultMaxPending
+	}
+	return &DeliveryQueue{
+		ttl:        ttl,
+		maxPending: maxPending,
+		pending:    make(map[string]*pendingMessage),
+	}
+}
+
+// AckRequired reports whether a message must be acknowledged by the client.
+// Error and critical events are delivered with acknowledgement, whether the
+// event or its data carries the level.
+func AckRequired(msg *Message) bool {
+	if msg == nil || msg.Type != string(MessageTypeEvent) || msg.Event == nil {
+		return false
+	}
+	if failureLevel(msg.Event.Event) {
+		return true
+	}
+	data, _ := msg.Event.Event["data"].(map[string]interface{})
+	return failureLevel(data)
+}
+
+// failureLevel reports whether the type, level or severity of fields is
+// error or critical, in any case
+func failureLevel(fields map[string]interface{}) bool {
+	for _, key := range []string{"type", "level", "severity"} {
+		value, _ := fields[key].(string)
+		switch strings.ToLower(value) {
+		case "error", "critical":
+			return true
+		}
+	}
+	return false
+}
+
+// Add retains a message until it is acknowledged or expires.
+func (q *DeliveryQueue) Add(msg *Message) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	q.pruneLocked(time.Now())
+
+	if _, exists := q.pending[msg.ID]; exists {
+		return
+	}
+
+	// Drop the oldest message if the queue is full
+	if len(q.order) >= q.maxPending {
+		oldest := q.order[0]
+		q.order = q.order[1:]
+		delete(q.pending, oldest)
+		q.dropped++
+	}
+
+	q.pending[msg.ID] = &pendingMessage{
+		msg:       msg,
+		expiresAt: time.Now().Add(q.ttl),
+	}
+	q.order = append(q.order, msg.ID)
+}
+
+// Ack removes a message from the queue. It returns false if the message is
+// unknown or has already expired.
+func (q *DeliveryQueue) Ack(id string) bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	q.pruneLocked(time.Now())
+
+	if _, ok := q.pending[id]; !ok {
+		return false
+	}
+
+	delete(q.pending, id)
+	for i, pendingID := range q.order {
+		if pendingID == id {
+			q.order = append(q.order[:i], q.order[i+1:]...)
+			break
+		}
+	}
+	q.acked++
+	return true
+}
+
+// Pending returns unexpired messages in the order they were added.
+func (q *DeliveryQueue) Pending() []*Message {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	q.pruneLocked(time.Now())
+
+	messages := make([]*Message, 0, len(q.order))
+	for _, id := range q.order {
+		messages = append(messages, q.pending[id].msg)
+	}
+	return messages
+}
+
+// Len returns the number of unexpired pending messages.
+func (q *DeliveryQueue) Len() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	q.pruneLocked(time.Now())
+	return len(q.order)
+}
+
+// GetStats returns delivery queue statistics.
+func (q *DeliveryQueue) GetStats() DeliveryStats {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	q.pruneLocked(time.Now())
+	return DeliveryStats{
+		Pending: len(q.order),
+		Acked:   q.acked,
+		Expired: q.expired,
+		Dropped: q.dropped,
+	}
+}
+
+// pruneLocked removes expired messages. Caller must hold q.mu.
+func (q *DeliveryQueue) pruneLocked(now time.Time) {
+	kept := q.order[:0]
+	for _, id := range q.order {
+		if now.After(q.pending[id].expiresAt) {
+			delete(q.pending, id)
+			q.expired++
+			continue
+		}
+		kept = append(kept, id)
+	}
+	q.order = kept
+}
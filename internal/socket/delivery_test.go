@@ -0,0 +1,67 @@
+package socket
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAckRequired(t *testing.T) {
+	assert.True(t, AckRequired(NewEventMessage(map[string]interface{}{"type": "error"})))
+	assert.True(t, AckRequired(NewEventMessage(map[string]interface{}{"type": "apply", "level": "critical"})))
+	assert.False(t, AckRequired(NewEventMessage(map[string]interface{}{"type": "log", "level": "info"})))
+	assert.True(t, AckRequired(NewEventMessage(map[string]interface{}{
+		"type": "LOG", "data": map[string]interface{}{"level": "ERROR"},
+	})))
+	assert.True(t, AckRequired(NewEventMessage(map[string]interface{}{
+		"type": "CLIENT_FALLBACK_FAILED", "data": map[string]interface{}{"severity": "critical"},
+	})))
+	assert.False(t, AckRequired(NewEventMessage(map[string]interface{}{
+		"type": "LOG", "data": map[string]interface{}{"level": "warning"},
+	})))
+	assert.False(t, AckRequired(NewCommandMessage("error", nil)))
+	assert.False(t, AckRequired(nil))
+}
+
+func TestDeliveryQueue_AddAck(t *testing.T) {
+	q := NewDeliveryQueue(time.Minute, 10)
+
+	msg := NewEventMessage(map[string]interface{}{"type": "error"})
+	q.Add(msg)
+	q.Add(msg) // duplicate is ignored
+
+	assert.Equal(t, 1, q.Len())
+	assert.Equal(t, []*Message{msg}, q.Pending())
+
+	assert.True(t, q.Ack(msg.ID))
+	assert.False(t, q.Ack(msg.ID))
+	assert.Equal(t, 0, q.Len())
+	assert.Equal(t, int64(1), q.GetStats().Acked)
+}
+
+func TestDeliveryQueue_Expiry(t *testing.T) {
+	q := NewDeliveryQueue(10*time.Millisecond, 10)
+
+	msg := NewEventMessage(map[string]interface{}{"type": "error"})
+	q.Add(msg)
+	time.Sleep(20 * time.Millisecond)
+
+	assert.Empty(t, q.Pending())
+	assert.False(t, q.Ack(msg.ID))
+	assert.Equal(t, int64(1), q.GetStats().Expired)
+}
+
+func TestDeliveryQueue_DropsOldestWhenFull(t *testing.T) {
+	q := NewDeliveryQueue(time.Minute, 2)
+
+	first := NewEventMessage(map[string]interface{}{"type": "error"})
+	second := NewEventMessage(map[string]interface{}{"type": "error"})
+	third := NewEventMessage(map[string]interface{}{"type": "error"})
+	q.Add(first)
+	q.Add(second)
+	q.Add(third)
+
+	assert.Equal(t, []*Message{second, third}, q.Pending())
+	assert.Equal(t, int64(1), q.GetStats().Dropped)
+}
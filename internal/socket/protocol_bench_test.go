@@ -0,0 +1,46 @@
+package socket
+
+import (
+	"bytes"
+	"testing"
+)
+
+// benchmarkEvent is an event message of typical size
+func benchmarkEvent() *Message {
+	return NewEventMessage(map[string]interface{}{
+		"type":   "config_updated",
+		"source": "sboxagent",
+		"data": map[string]interface{}{
+			"client":   "sing-box",
+			"checksum": "sha256:9f86d081884c7d659a2feaa0c55ad015a3bf4f1b2b0b822cd15d6c15b0f00a08",
+			"servers":  42,
+		},
+	})
+}
+
+func BenchmarkEncodeMessage(b *testing.B) {
+	msg := benchmarkEvent()
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		if _, err := EncodeMessage(msg); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkDecodeMessage(b *testing.B) {
+	encoded, err := EncodeMessage(benchmarkEvent())
+	if err != nil {
+		b.Fatal(err)
+	}
+	reader := bytes.NewReader(encoded)
+	b.SetBytes(int64(len(encoded)))
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		reader.Reset(encoded)
+		if _, err := DecodeMessage(reader); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
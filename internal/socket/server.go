@@ -13,13 +13,39 @@ import (
 	"log"
 	"net"
 	"os"
+	"sync"
+	"time"
+
+	"github.com/kpblcaoo/sboxagent/internal/security"
 )
 
+// staleSocketTimeout bounds the probe for a live instance on an existing socket
+const staleSocketTimeout = time.Second
+
 // Server represents a Unix socket server for framed JSON protocol.
 type Server struct {
 	SocketPath string
 	listener   net.Listener
 	Logger     *log.Logger
+
+	// Network is the listener network: "unix" (default) or "tcp", in which
+	// case SocketPath is a host:port address
+	Network string
+
+	// AccessList filters remote peers; unix socket peers are always allowed
+	AccessList *security.AccessList
+
+	// Delivery retains error and critical events until a client acks them.
+	Delivery *DeliveryQueue
+
+	// CommandHook, if set, is called after each registered command is
+	// handled with the peer address, the command and its error, for auditing
+	CommandHook func(peer, command string, params map[string]interface{}, err error)
+
+	// Listener, connected clients with their write locks and command handlers
+	mu       sync.Mutex
+	clients  map[net.Conn]*sync.Mutex
+	commands map[string]CommandHandler
 }
 
 // NewServer creates a new Server instance.
@@ -27,27 +53,51 @@ func NewServer(socketPath string, logger *log.Logger) *Server {
 	return &Server{
 		SocketPath: socketPath,
 		Logger:     logger,
+		Delivery:   NewDeliveryQueue(DefaultDeliveryTTL, DefaultMaxPending),
+		clients:    make(map[net.Conn]*sync.Mutex),
+		commands:   make(map[string]CommandHandler),
 	}
 }
 
-// Start launches the Unix socket server and accepts connections.
-// Each connection is handled in a separate goroutine.
-func (s *Server) Start(ctx context.Context) error {
+// Listen opens the listener without accepting connections yet, so callers
+// can report a socket that is in use before starting anything else. Start
+// calls it if needed.
+func (s *Server) Listen() error {
 	if s.Logger == nil {
 		s.Logger = log.New(os.Stdout, "[socket-server] ", log.LstdFlags)
 	}
 
-	// Remove old socket if exists
-	if err := os.RemoveAll(s.SocketPath); err != nil {
-		return fmt.Errorf("failed to remove old socket: %w", err)
+	network := s.Network
+	if network == "" {
+		network = "unix"
 	}
 
-	ln, err := net.Listen("unix", s.SocketPath)
+	// Remove a socket left behind by an agent that did not shut down cleanly
+	if network == "unix" {
+		if err := removeStaleSocket(s.SocketPath); err != nil {
+			return err
+		}
+	}
+
+	ln, err := net.Listen(network, s.SocketPath)
 	if err != nil {
-		return fmt.Errorf("failed to listen on unix socket: %w", err)
+		return fmt.Errorf("failed to listen on %s socket: %w", network, err)
 	}
+	s.mu.Lock()
 	s.listener = ln
-	s.Logger.Printf("Listening on unix socket: %s", s.SocketPath)
+	s.mu.Unlock()
+	s.Logger.Printf("Listening on %s socket: %s", network, ln.Addr())
+	return nil
+}
+
+// Start launches the Unix socket server and accepts connections.
+// Each connection is handled in a separate goroutine.
+func (s *Server) Start(ctx context.Context) error {
+	if s.Addr() == nil {
+		if err := s.Listen(); err != nil {
+			return err
+		}
+	}
 
 	go func() {
 		<-ctx.Done()
@@ -66,15 +116,73 @@ func (s *Server) Start(ctx context.Context) error {
 				return err
 			}
 		}
+		if !s.allowConnection(conn) {
+			conn.Close()
+			continue
+		}
 		go s.handleConnection(conn)
 	}
 }
 
+// removeStaleSocket removes the socket at path unless another process is
+// still accepting connections on it. Paths that are not sockets are left
+// alone.
+func removeStaleSocket(path string) error {
+	info, err := os.Lstat(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to inspect socket %s: %w", path, err)
+	}
+	if info.Mode()&os.ModeSocket == 0 {
+		return fmt.Errorf("refusing to replace %s: not a socket", path)
+	}
+
+	conn, err := net.DialTimeout("unix", path, staleSocketTimeout)
+	if err == nil {
+		conn.Close()
+		return fmt.Errorf("socket %s is in use by another running instance", path)
+	}
+
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to remove stale socket: %w", err)
+	}
+	return nil
+}
+
+// allowConnection checks the peer address against the access list and logs
+// the decision
+func (s *Server) allowConnection(conn net.Conn) bool {
+	if s.AccessList == nil {
+		return true
+	}
+
+	decision := s.AccessList.CheckAddr(conn.RemoteAddr())
+	if !decision.Allowed {
+		s.Logger.Printf("Connection from %v denied: %s", conn.RemoteAddr(), decision.Reason)
+		return false
+	}
+	s.Logger.Printf("Connection from %v allowed: %s", conn.RemoteAddr(), decision.Reason)
+	return true
+}
+
 // handleConnection processes a single client connection.
 func (s *Server) handleConnection(conn net.Conn) {
 	defer conn.Close()
 	s.Logger.Printf("Accepted connection from %v", conn.RemoteAddr())
 
+	writeMu := s.addClient(conn)
+	defer s.removeClient(conn)
+
+	// Redeliver messages the previous clients did not acknowledge
+	for _, pending := range s.Delivery.Pending() {
+		if err := s.writeTo(conn, writeMu, pending); err != nil {
+			s.Logger.Printf("Redelivery error: %v", err)
+			return
+		}
+	}
+
 	for {
 		msg, err := ReadMessage(conn)
 		if err != nil {
@@ -86,8 +194,17 @@ func (s *Server) handleConnection(conn net.Conn) {
 
 		s.Logger.Printf("Received message: type=%s id=%s", msg.Type, msg.ID)
 
+		if reply, handled := s.handleAck(msg); handled {
+			if reply == nil {
+				continue
+			}
+			msg = reply
+		} else if reply, handled := s.handleCommand(peerName(conn), msg); handled {
+			msg = reply
+		}
+
 		// Echo back the same message (for test/demo)
-		err = WriteMessage(conn, msg)
+		err = s.writeTo(conn, writeMu, msg)
 		if err != nil {
 			s.Logger.Printf("Write error: %v", err)
 			break
@@ -97,6 +214,107 @@ func (s *Server) handleConnection(conn net.Conn) {
 	s.Logger.Printf("Connection closed: %v", conn.RemoteAddr())
 }
 
+// handleAck processes acknowledgements of retained messages. A client acks
+// either with an "ack" command carrying message_id, or with a response whose
+// request_id is the acknowledged message ID. It returns the reply to send
+// (nil for none) and whether the message was an acknowledgement.
+func (s *Server) handleAck(msg *Message) (*Message, bool) {
+	switch {
+	case msg.Type == string(MessageTypeCommand) && msg.Command != nil && msg.Command.Command == CommandAck:
+		id, _ := msg.Command.Params["message_id"].(string)
+		if id == "" {
+			return NewResponseMessage(msg.ID, "error", nil, &ErrorMessage{
+				Code:    "INVALID_REQUEST",
+				Message: "message_id is required",
+			}), true
+		}
+		acked := s.Delivery.Ack(id)
+		return NewResponseMessage(msg.ID, "success", map[string]interface{}{
+			"message_id": id,
+			"acked":      acked,
+		}, nil), true
+	case msg.Type == string(MessageTypeResponse) && msg.Response != nil:
+		if s.Delivery.Ack(msg.Response.RequestID) {
+			return nil, true
+		}
+	}
+	return nil, false
+}
+
+// Publish sends a message to all connected clients. Messages that require
+// acknowledgement are retained and redelivered on reconnect until acked or
+// expired, so a momentary disconnect does not lose them.
+func (s *Server) Publish(msg *Message) error {
+	if msg == nil {
+		return fmt.Errorf("message cannot be nil")
+	}
+
+	if AckRequired(msg) {
+		if msg.Metadata == nil {
+			msg.Metadata = make(map[string]interface{})
+		}
+		msg.Metadata["ack_required"] = true
+		s.Delivery.Add(msg)
+	}
+
+	s.mu.Lock()
+	clients := make(map[net.Conn]*sync.Mutex, len(s.clients))
+	for conn, writeMu := range s.clients {
+		clients[conn] = writeMu
+	}
+	s.mu.Unlock()
+
+	for conn, writeMu := range clients {
+		if err := s.writeTo(conn, writeMu, msg); err != nil && s.Logger != nil {
+			s.Logger.Printf("Publish error to %v: %v", conn.RemoteAddr(), err)
+		}
+	}
+
+	return nil
+}
+
+// ClientCount returns the number of connected clients.
+func (s *Server) ClientCount() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.clients)
+}
+
+// addClient registers a connection and returns its write lock.
+func (s *Server) addClient(conn net.Conn) *sync.Mutex {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	writeMu := &sync.Mutex{}
+	s.clients[conn] = writeMu
+	return writeMu
+}
+
+// removeClient unregisters a connection.
+func (s *Server) removeClient(conn net.Conn) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.clients, conn)
+}
+
+// writeTo writes a message to a connection holding its write lock.
+func (s *Server) writeTo(conn net.Conn, writeMu *sync.Mutex, msg *Message) error {
+	writeMu.Lock()
+	defer writeMu.Unlock()
+	return WriteMessage(conn, msg)
+}
+
+// Addr returns the listener address, or nil if the server is not listening.
+func (s *Server) Addr() net.Addr {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.listener == nil {
+		return nil
+	}
+	return s.listener.Addr()
+}
+
 // Stop stops the server and closes the listener.
 func (s *Server) Stop() error {
 	if s.listener != nil {
@@ -9,6 +9,7 @@ import (
 	"testing"
 	"time"
 
+	"github.com/kpblcaoo/sboxagent/internal/security"
 	"github.com/stretchr/testify/require"
 )
 
@@ -53,3 +54,129 @@ func TestServer_Echo(t *testing.T) {
 	cancel()
 	_ = server.Stop()
 }
+
+func TestServer_RedeliversUnackedErrors(t *testing.T) {
+	dir := t.TempDir()
+	socketPath := filepath.Join(dir, "test.sock")
+	logger := log.New(os.Stdout, "[test-server] ", log.LstdFlags)
+	server := NewServer(socketPath, logger)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	go func() {
+		_ = server.Start(ctx)
+	}()
+	time.Sleep(100 * time.Millisecond)
+
+	// Publish while no client is connected
+	errEvent := NewEventMessage(map[string]interface{}{
+		"type":    "error",
+		"message": "apply failed",
+	})
+	require.NoError(t, server.Publish(errEvent))
+	require.NoError(t, server.Publish(NewEventMessage(map[string]interface{}{"type": "log"})))
+
+	// First connection receives the retained error only
+	conn, err := net.Dial("unix", socketPath)
+	require.NoError(t, err)
+	received, err := ReadMessage(conn)
+	require.NoError(t, err)
+	require.Equal(t, errEvent.ID, received.ID)
+	require.Equal(t, true, received.Metadata["ack_required"])
+	conn.Close()
+
+	// Not acked yet: delivered again on reconnect
+	conn, err = net.Dial("unix", socketPath)
+	require.NoError(t, err)
+	defer conn.Close()
+	received, err = ReadMessage(conn)
+	require.NoError(t, err)
+	require.Equal(t, errEvent.ID, received.ID)
+
+	// Acknowledge it
+	ack := NewCommandMessage(CommandAck, map[string]interface{}{"message_id": errEvent.ID})
+	require.NoError(t, WriteMessage(conn, ack))
+	reply, err := ReadMessage(conn)
+	require.NoError(t, err)
+	require.Equal(t, "success", reply.Response.Status)
+	require.Equal(t, true, reply.Response.Data["acked"])
+	require.Equal(t, 0, server.Delivery.Len())
+}
+
+func TestServer_TCPAccessList(t *testing.T) {
+	logger := log.New(os.Stdout, "[test-server] ", log.LstdFlags)
+	server := NewServer("127.0.0.1:0", logger)
+	server.Network = "tcp"
+
+	acl, err := security.NewAccessList(nil, []string{"127.0.0.0/8"})
+	require.NoError(t, err)
+	server.AccessList = acl
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	go func() {
+		_ = server.Start(ctx)
+	}()
+	time.Sleep(100 * time.Millisecond)
+	require.NotNil(t, server.Addr())
+
+	// The denied peer is disconnected immediately
+	conn, err := net.Dial("tcp", server.Addr().String())
+	require.NoError(t, err)
+	defer conn.Close()
+
+	require.NoError(t, conn.SetReadDeadline(time.Now().Add(time.Second)))
+	_, err = ReadMessage(conn)
+	require.Error(t, err)
+}
+
+func TestServer_RemovesStaleSocket(t *testing.T) {
+	socketPath := filepath.Join(t.TempDir(), "test.sock")
+
+	// A socket file nobody listens on, as left by a crashed agent
+	ln, err := net.Listen("unix", socketPath)
+	require.NoError(t, err)
+	ln.(*net.UnixListener).SetUnlinkOnClose(false)
+	require.NoError(t, ln.Close())
+	require.FileExists(t, socketPath)
+
+	server := NewServer(socketPath, log.New(os.Stdout, "[test-server] ", log.LstdFlags))
+	require.NoError(t, server.Listen())
+	defer server.Stop()
+
+	conn, err := net.Dial("unix", socketPath)
+	require.NoError(t, err)
+	conn.Close()
+}
+
+func TestServer_RefusesLiveSocket(t *testing.T) {
+	socketPath := filepath.Join(t.TempDir(), "test.sock")
+	logger := log.New(os.Stdout, "[test-server] ", log.LstdFlags)
+
+	first := NewServer(socketPath, logger)
+	require.NoError(t, first.Listen())
+	defer first.Stop()
+
+	second := NewServer(socketPath, logger)
+	err := second.Listen()
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "in use by another running instance")
+
+	// The running instance keeps its socket
+	conn, err := net.Dial("unix", socketPath)
+	require.NoError(t, err)
+	conn.Close()
+}
+
+func TestServer_RefusesNonSocketPath(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "agent.sock")
+	require.NoError(t, os.WriteFile(path, []byte("data"), 0644))
+
+	server := NewServer(path, log.New(os.Stdout, "[test-server] ", log.LstdFlags))
+	err := server.Listen()
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "not a socket")
+	require.FileExists(t, path)
+}
@@ -0,0 +1,203 @@
+// Package standby pairs agents as active and passive through a lease kept in
+// a file on storage both agents share. The agent holding the lease is active;
+// it renews the lease while running, and a passive agent takes it over once
+// the renewals stop.
+package standby
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/kpblcaoo/sboxagent/internal/config"
+	"github.com/kpblcaoo/sboxagent/internal/logger"
+)
+
+// Lease records which agent is active and until when
+type Lease struct {
+	Holder    string    `json:"holder"`
+	RenewedAt time.Time `json:"renewedAt"`
+	ExpiresAt time.Time `json:"expiresAt"`
+}
+
+// Expired reports whether the lease has lapsed at now
+func (l *Lease) Expired(now time.Time) bool {
+	return !now.Before(l.ExpiresAt)
+}
+
+// Elector acquires and renews the lease for one agent
+type Elector struct {
+	config config.StandbyConfig
+	id     string
+	logger *logger.Logger
+
+	mu     sync.RWMutex
+	active bool
+	lease  *Lease
+}
+
+// NewElector creates an elector for the agent identified by id
+func NewElector(cfg config.StandbyConfig, id string, log *logger.Logger) *Elector {
+	return &Elector{
+		config: cfg,
+		id:     id,
+		logger: log,
+	}
+}
+
+// ID returns the identity the elector holds the lease under
+func (e *Elector) ID() string {
+	return e.id
+}
+
+// IsActive reports whether this agent held the lease at the last check
+func (e *Elector) IsActive() bool {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	return e.active
+}
+
+// Lease returns the lease seen at the last check, or nil before the first
+func (e *Elector) Lease() *Lease {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	if e.lease == nil {
+		return nil
+	}
+	lease := *e.lease
+	return &lease
+}
+
+// Check acquires or renews the lease if it is free, expired or already ours,
+// and reports whether this agent is active
+func (e *Elector) Check(now time.Time) (bool, error) {
+	var lease *Lease
+	err := withLock(e.config.LeaseFile+".lock", func() error {
+		current, err := readLease(e.config.LeaseFile)
+		if err != nil {
+			return err
+		}
+		if current != nil && current.Holder != e.id && !current.Expired(now) {
+			lease = current
+			return nil
+		}
+
+		lease = &Lease{Holder: e.id, RenewedAt: now, ExpiresAt: now.Add(e.config.LeaseTTL)}
+		return writeLease(e.config.LeaseFile, lease)
+	})
+	if err != nil {
+		// Without a readable lease we cannot tell whether the peer is alive;
+		// stay passive rather than risk two active agents
+		e.set(false, nil)
+		return false, err
+	}
+
+	active := lease.Holder == e.id
+	e.set(active, lease)
+	return active, nil
+}
+
+// Run checks the lease every renew interval until ctx is cancelled and calls
+// onChange when this agent becomes active or passive. The lease is released
+// on return so the peer can take over without waiting for it to expire.
+func (e *Elector) Run(ctx context.Context, onChange func(active bool)) {
+	ticker := time.NewTicker(e.config.RenewInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			if err := e.Release(); err != nil {
+				e.logger.Warn("Failed to release standby lease", map[string]interface{}{
+					"error": err.Error(),
+				})
+			}
+			return
+		case <-ticker.C:
+		}
+
+		wasActive := e.IsActive()
+		active, err := e.Check(time.Now())
+		if err != nil {
+			e.logger.Error("Failed to check standby lease", map[string]interface{}{
+				"path":  e.config.LeaseFile,
+				"error": err.Error(),
+			})
+		}
+		if active != wasActive {
+			onChange(active)
+		}
+	}
+}
+
+// Release gives up the lease if this agent holds it
+func (e *Elector) Release() error {
+	if !e.IsActive() {
+		return nil
+	}
+	err := withLock(e.config.LeaseFile+".lock", func() error {
+		current, err := readLease(e.config.LeaseFile)
+		if err != nil || current == nil || current.Holder != e.id {
+			return err
+		}
+		if err := os.Remove(e.config.LeaseFile); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("failed to remove lease: %w", err)
+		}
+		return nil
+	})
+	e.set(false, nil)
+	return err
+}
+
+// set records the result of a check
+func (e *Elector) set(active bool, lease *Lease) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.active = active
+	e.lease = lease
+}
+
+// readLease reads the lease file, returning nil if there is none
+func readLease(path string) (*Lease, error) {
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read lease: %w", err)
+	}
+	var lease Lease
+	if err := json.Unmarshal(data, &lease); err != nil {
+		return nil, fmt.Errorf("failed to parse lease: %w", err)
+	}
+	return &lease, nil
+}
+
+// writeLease atomically replaces the lease file
+func writeLease(path string, lease *Lease) error {
+	data, err := json.Marshal(lease)
+	if err != nil {
+		return fmt.Errorf("failed to encode lease: %w", err)
+	}
+	tmp := fmt.Sprintf("%s.%d.tmp", path, os.Getpid())
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return fmt.Errorf("failed to write lease: %w", err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("failed to write lease: %w", err)
+	}
+	return nil
+}
+
+// ensureDir creates the directory holding path
+func ensureDir(path string) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("failed to create lease directory: %w", err)
+	}
+	return nil
+}
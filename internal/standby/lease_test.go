@@ -0,0 +1,93 @@
+package standby
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/kpblcaoo/sboxagent/internal/config"
+	"github.com/kpblcaoo/sboxagent/internal/logger"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestElectors(t *testing.T, cfg config.StandbyConfig) (*Elector, *Elector) {
+	log, err := logger.New("error")
+	require.NoError(t, err)
+	cfg.LeaseFile = filepath.Join(t.TempDir(), "shared", "lease.json")
+	return NewElector(cfg, "gw-a", log), NewElector(cfg, "gw-b", log)
+}
+
+func TestElector_Check(t *testing.T) {
+	a, b := newTestElectors(t, config.StandbyConfig{LeaseTTL: 30 * time.Second, RenewInterval: 10 * time.Second})
+	now := time.Now()
+
+	active, err := a.Check(now)
+	require.NoError(t, err)
+	assert.True(t, active)
+
+	active, err = b.Check(now.Add(time.Second))
+	require.NoError(t, err)
+	assert.False(t, active)
+	assert.Equal(t, "gw-a", b.Lease().Holder)
+
+	// The holder renews before the lease lapses
+	active, err = a.Check(now.Add(20 * time.Second))
+	require.NoError(t, err)
+	assert.True(t, active)
+	active, err = b.Check(now.Add(40 * time.Second))
+	require.NoError(t, err)
+	assert.False(t, active)
+
+	// Once renewals stop the passive agent takes over
+	active, err = b.Check(now.Add(51 * time.Second))
+	require.NoError(t, err)
+	assert.True(t, active)
+	active, err = a.Check(now.Add(52 * time.Second))
+	require.NoError(t, err)
+	assert.False(t, active)
+}
+
+func TestElector_Release(t *testing.T) {
+	a, b := newTestElectors(t, config.StandbyConfig{LeaseTTL: time.Hour, RenewInterval: time.Minute})
+	now := time.Now()
+
+	_, err := a.Check(now)
+	require.NoError(t, err)
+	require.NoError(t, a.Release())
+	assert.False(t, a.IsActive())
+
+	active, err := b.Check(now)
+	require.NoError(t, err)
+	assert.True(t, active)
+}
+
+func TestElector_Run(t *testing.T) {
+	a, b := newTestElectors(t, config.StandbyConfig{LeaseTTL: 200 * time.Millisecond, RenewInterval: 20 * time.Millisecond})
+
+	_, err := a.Check(time.Now())
+	require.NoError(t, err)
+	_, err = b.Check(time.Now())
+	require.NoError(t, err)
+
+	changes := make(chan bool, 10)
+	done := make(chan struct{})
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		defer close(done)
+		b.Run(ctx, func(active bool) { changes <- active })
+	}()
+	defer func() {
+		cancel()
+		<-done
+	}()
+
+	// a stops renewing without releasing, as if it crashed
+	select {
+	case active := <-changes:
+		assert.True(t, active)
+	case <-time.After(2 * time.Second):
+		t.Fatal("passive elector did not take over")
+	}
+}
@@ -0,0 +1,11 @@
+//go:build !unix
+
+package standby
+
+// withLock runs fn without locking where file locks are not supported
+func withLock(path string, fn func() error) error {
+	if err := ensureDir(path); err != nil {
+		return err
+	}
+	return fn()
+}
@@ -0,0 +1,29 @@
+//go:build unix
+
+package standby
+
+import (
+	"fmt"
+	"os"
+	"syscall"
+)
+
+// withLock runs fn holding an exclusive lock on the lock file, so two agents
+// cannot both take an expired lease
+func withLock(path string, fn func() error) error {
+	if err := ensureDir(path); err != nil {
+		return err
+	}
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_RDWR, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to open lease lock: %w", err)
+	}
+	defer file.Close()
+
+	if err := syscall.Flock(int(file.Fd()), syscall.LOCK_EX); err != nil {
+		return fmt.Errorf("failed to lock lease: %w", err)
+	}
+	defer syscall.Flock(int(file.Fd()), syscall.LOCK_UN)
+
+	return fn()
+}
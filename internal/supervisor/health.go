@@ -0,0 +1,91 @@
+package supervisor
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os/exec"
+	"time"
+
+	"github.com/kpblcaoo/sboxagent/internal/process"
+)
+
+// errUnhealthy is the exit error of programs killed for failing their
+// health checks
+var errUnhealthy = errors.New("client failed its health checks")
+
+// supervise waits for a started program to exit, running its health check
+// meanwhile. A program failing HealthThreshold checks in a row is stopped
+// and errUnhealthy returned. healthy reports whether a check passed.
+func (s *Supervisor) supervise(p *program, cmd *exec.Cmd) (healthy bool, err error) {
+	exited := make(chan error, 1)
+	go func() {
+		exited <- process.Wait(cmd)
+	}()
+	if len(p.HealthCheck) == 0 || s.opts.HealthInterval <= 0 {
+		return false, <-exited
+	}
+
+	ticker := time.NewTicker(s.opts.HealthInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case err := <-exited:
+			return healthy, err
+		case <-ticker.C:
+		}
+
+		checkErr := s.checkHealth(p)
+		s.mu.Lock()
+		if checkErr == nil {
+			p.healthFailures = 0
+			s.mu.Unlock()
+			healthy = true
+			continue
+		}
+		p.healthFailures++
+		failures := p.healthFailures
+		s.mu.Unlock()
+
+		fields := map[string]interface{}{
+			"service":  p.Name,
+			"failures": failures,
+			"error":    checkErr.Error(),
+		}
+		if failures < max(s.opts.HealthThreshold, 1) {
+			s.logger.Warn("Client health check failed", fields)
+			continue
+		}
+		s.logger.Error("Client is unhealthy, restarting", fields)
+		process.TerminateGroup(cmd, s.opts.StopTimeout)
+		<-exited
+		return healthy, errUnhealthy
+	}
+}
+
+// checkHealth runs the program's health check within HealthTimeout
+func (s *Supervisor) checkHealth(p *program) error {
+	ctx := context.Background()
+	if s.opts.HealthTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, s.opts.HealthTimeout)
+		defer cancel()
+	}
+
+	s.mu.Lock()
+	env := append(append([]string{}, s.env...), p.Env...)
+	s.mu.Unlock()
+	cmd := exec.CommandContext(ctx, p.HealthCheck[0], p.HealthCheck[1:]...)
+	cmd.Env = env
+	process.Prepare(cmd)
+	if err := process.Start(cmd); err != nil {
+		return err
+	}
+	if err := process.Wait(cmd); err != nil {
+		if ctx.Err() != nil {
+			return fmt.Errorf("health check timed out: %w", ctx.Err())
+		}
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,11 @@
+//go:build !unix
+
+package supervisor
+
+import "os"
+
+// Clients cannot be signalled beyond being killed
+var (
+	reloadSignal     os.Signal
+	forwardedSignals []os.Signal
+)
@@ -0,0 +1,14 @@
+//go:build unix
+
+package supervisor
+
+import (
+	"os"
+	"syscall"
+)
+
+// reloadSignal makes clients reload their config
+var reloadSignal os.Signal = syscall.SIGHUP
+
+// forwardedSignals are passed on to the clients
+var forwardedSignals = []os.Signal{syscall.SIGHUP, syscall.SIGUSR1, syscall.SIGUSR2}
@@ -0,0 +1,617 @@
+// Package supervisor runs the clients as children of the agent where no
+// service manager runs them, such as in containers. It restarts them by
+// their restart policy and forwards signals to them; exited descendants are
+// left to the agent's orphan reaper.
+package supervisor
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"os/signal"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/kpblcaoo/sboxagent/internal/config"
+	"github.com/kpblcaoo/sboxagent/internal/initsys"
+	"github.com/kpblcaoo/sboxagent/internal/logger"
+	"github.com/kpblcaoo/sboxagent/internal/process"
+)
+
+// System and Backend name the supervisor as an init system
+const (
+	System  = "supervisor"
+	Backend = "exec"
+)
+
+// ErrReloadUnsupported is returned by Reload where clients cannot be sent
+// SIGHUP
+var ErrReloadUnsupported = errors.New("reload is not supported on this platform")
+
+// Program is a client run by the supervisor
+type Program struct {
+	// Name is the service name the program is controlled by
+	Name string
+	// Command is the client's command line
+	Command []string
+	// Env holds variables added to the supervisor's environment
+	Env []string
+	// Restart is the restart policy: never, on-failure or always
+	Restart string
+	// HealthCheck is a command checking the running program, exiting
+	// non-zero when it is unhealthy. Programs failing HealthThreshold
+	// checks in a row are restarted.
+	HealthCheck []string
+}
+
+// Options configure the supervisor
+type Options struct {
+	// RestartDelay is the first delay before a restart, doubled after each
+	// restart up to MaxRestartDelay. The delay is reset once a program runs
+	// longer than MaxRestartDelay.
+	RestartDelay    time.Duration
+	MaxRestartDelay time.Duration
+	// MaxRestarts is how many automatic restarts are allowed within
+	// RestartWindow before a program is left failed; zero allows any number
+	MaxRestarts   int
+	RestartWindow time.Duration
+	// StopTimeout is how long a program has to exit after SIGTERM before
+	// its process group is killed
+	StopTimeout time.Duration
+	// HealthInterval is how often the health checks of running programs
+	// run, each within HealthTimeout; zero disables health checks
+	HealthInterval  time.Duration
+	HealthTimeout   time.Duration
+	HealthThreshold int
+	// Stdout and Stderr receive the programs' output, the agent's own by
+	// default
+	Stdout io.Writer
+	Stderr io.Writer
+}
+
+// program is the running state of a Program
+type program struct {
+	Program
+	// autostart is whether StartAll starts the program
+	autostart bool
+	state     initsys.UnitState
+	cmd       *exec.Cmd
+	pid       int
+	// restarts counts automatic restarts; restartTimes are those within
+	// the restart window
+	restarts     int
+	restartTimes []time.Time
+	lastExitCode int
+	lastExitAt   time.Time
+	// healthFailures counts failed health checks in a row
+	healthFailures int
+	// stop is closed to stop the run loop, which closes done on exit; both
+	// are nil while the program is not running
+	stop chan struct{}
+	done chan struct{}
+}
+
+// Supervisor runs programs as children of the agent. It implements
+// initsys.Manager so clients are controlled the same way as under an init
+// system.
+type Supervisor struct {
+	opts   Options
+	logger *logger.Logger
+
+	mu          sync.Mutex
+	env         []string
+	programs    map[string]*program
+	subscribers map[chan initsys.UnitState]struct{}
+}
+
+// New creates a supervisor of programs, all started by StartAll
+func New(programs []Program, opts Options, log *logger.Logger) *Supervisor {
+	if opts.Stdout == nil {
+		opts.Stdout = os.Stdout
+	}
+	if opts.Stderr == nil {
+		opts.Stderr = os.Stderr
+	}
+	s := &Supervisor{
+		opts:        opts,
+		logger:      log,
+		env:         os.Environ(),
+		programs:    make(map[string]*program, len(programs)),
+		subscribers: make(map[chan initsys.UnitState]struct{}),
+	}
+	for _, p := range programs {
+		s.programs[p.Name] = &program{
+			Program:   p,
+			autostart: true,
+			state:     initsys.UnitState{Unit: p.Name, ActiveState: "inactive", SubState: "dead"},
+		}
+	}
+	return s
+}
+
+// SetEnv sets the environment programs start with
+func (s *Supervisor) SetEnv(env []string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.env = env
+}
+
+func (s *Supervisor) System() string {
+	return System
+}
+
+func (s *Supervisor) Backend() string {
+	return Backend
+}
+
+func (s *Supervisor) Name(service string) string {
+	return service
+}
+
+// lookup returns a program by name
+func (s *Supervisor) lookup(op, service string) (*program, error) {
+	p, ok := s.programs[service]
+	if !ok {
+		return nil, &initsys.Error{Unit: service, Op: op, Err: initsys.ErrNoSuchUnit}
+	}
+	return p, nil
+}
+
+// Start starts a program unless it is running
+func (s *Supervisor) Start(ctx context.Context, service string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	p, err := s.lookup("start", service)
+	if err != nil {
+		return err
+	}
+	if p.done != nil {
+		return nil
+	}
+
+	p.stop = make(chan struct{})
+	p.done = make(chan struct{})
+	p.restartTimes = nil
+	s.setState(p, "activating", "start")
+	if err := s.spawn(p); err != nil {
+		close(p.done)
+		p.stop, p.done = nil, nil
+		s.setState(p, "failed", "failed")
+		return &initsys.Error{Unit: service, Op: "start", Err: err}
+	}
+	go s.run(p, p.stop, p.done)
+	return nil
+}
+
+// spawn starts the program's command. Caller must hold s.mu.
+func (s *Supervisor) spawn(p *program) error {
+	// Programs outlive the calls starting them and are stopped by Stop
+	cmd := exec.CommandContext(context.Background(), p.Command[0], p.Command[1:]...)
+	cmd.Env = append(append([]string{}, s.env...), p.Env...)
+	cmd.Stdout = s.opts.Stdout
+	cmd.Stderr = s.opts.Stderr
+	process.Prepare(cmd)
+	if err := process.Start(cmd); err != nil {
+		return err
+	}
+	p.cmd = cmd
+	p.pid = cmd.Process.Pid
+	p.healthFailures = 0
+	s.setState(p, "active", "running")
+	s.logger.Info("Started client", map[string]interface{}{
+		"service": p.Name,
+		"pid":     cmd.Process.Pid,
+	})
+	return nil
+}
+
+// run waits for the program and restarts it by its policy until it is
+// stopped or restarted more than MaxRestarts times within RestartWindow
+func (s *Supervisor) run(p *program, stop, done chan struct{}) {
+	defer close(done)
+
+	delay := s.opts.RestartDelay
+	for {
+		s.mu.Lock()
+		cmd := p.cmd
+		s.mu.Unlock()
+
+		started := time.Now()
+		healthy, err := s.supervise(p, cmd)
+		ran := time.Since(started)
+
+		// The process group may be reused once the program was waited for
+		s.mu.Lock()
+		p.cmd = nil
+		p.pid = 0
+		p.lastExitCode = process.ExitCode(err)
+		p.lastExitAt = time.Now()
+		s.mu.Unlock()
+
+		select {
+		case <-stop:
+			s.finish(p, done, "inactive", "dead")
+			return
+		default:
+		}
+
+		fields := map[string]interface{}{
+			"service":  p.Name,
+			"exitCode": process.ExitCode(err),
+			"ran":      ran.String(),
+		}
+		if !shouldRestart(p.Restart, err) {
+			if err != nil {
+				fields["error"] = err.Error()
+				s.logger.Error("Client failed", fields)
+				s.finish(p, done, "failed", "failed")
+			} else {
+				s.logger.Info("Client exited", fields)
+				s.finish(p, done, "inactive", "dead")
+			}
+			return
+		}
+		if !s.allowRestart(p) {
+			fields["maxRestarts"] = s.opts.MaxRestarts
+			fields["restartWindow"] = s.opts.RestartWindow.String()
+			s.logger.Error("Client restarted too often, giving up", fields)
+			s.finish(p, done, "failed", "start-limit-hit")
+			return
+		}
+
+		// A client that passed a health check or ran for long is restarted
+		// without the backoff built up by earlier failures
+		if healthy || ran > s.opts.MaxRestartDelay {
+			delay = s.opts.RestartDelay
+		}
+		fields["delay"] = delay.String()
+		s.logger.Warn("Client exited, restarting", fields)
+		s.mu.Lock()
+		s.setState(p, "activating", "auto-restart")
+		s.mu.Unlock()
+
+		select {
+		case <-stop:
+			s.finish(p, done, "inactive", "dead")
+			return
+		case <-time.After(delay):
+		}
+		delay = min(delay*2, s.opts.MaxRestartDelay)
+
+		s.mu.Lock()
+		select {
+		case <-stop:
+			s.mu.Unlock()
+			s.finish(p, done, "inactive", "dead")
+			return
+		default:
+		}
+		err = s.spawn(p)
+		s.mu.Unlock()
+		if err != nil {
+			// A client that cannot be started will not start on retry
+			s.logger.Error("Failed to restart client", map[string]interface{}{
+				"service": p.Name,
+				"error":   err.Error(),
+			})
+			s.finish(p, done, "failed", "failed")
+			return
+		}
+	}
+}
+
+// allowRestart records a restart of the program, reporting false once it
+// was restarted more than MaxRestarts times within RestartWindow
+func (s *Supervisor) allowRestart(p *program) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now()
+	if s.opts.MaxRestarts <= 0 {
+		p.restarts++
+		return true
+	}
+	recent := p.restartTimes[:0]
+	for _, at := range p.restartTimes {
+		if now.Sub(at) < s.opts.RestartWindow {
+			recent = append(recent, at)
+		}
+	}
+	if len(recent) >= s.opts.MaxRestarts {
+		p.restartTimes = recent
+		return false
+	}
+	p.restartTimes = append(recent, now)
+	p.restarts++
+	return true
+}
+
+// finish records that the run loop ended with done
+func (s *Supervisor) finish(p *program, done chan struct{}, activeState, subState string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if p.done == done {
+		p.stop, p.done, p.cmd = nil, nil, nil
+	}
+	s.setState(p, activeState, subState)
+}
+
+// shouldRestart reports whether a program that exited with err, or was
+// killed for failing its health checks, is restarted under policy
+func shouldRestart(policy string, err error) bool {
+	switch policy {
+	case config.RestartAlways:
+		return true
+	case config.RestartNever:
+		return false
+	default:
+		return err != nil
+	}
+}
+
+// Stop stops a program, killing its process group if it does not exit
+// within the stop timeout
+func (s *Supervisor) Stop(ctx context.Context, service string) error {
+	s.mu.Lock()
+	p, err := s.lookup("stop", service)
+	if err != nil {
+		s.mu.Unlock()
+		return err
+	}
+	done := p.done
+	if done == nil {
+		s.mu.Unlock()
+		return nil
+	}
+	select {
+	case <-p.stop:
+	default:
+		close(p.stop)
+	}
+	if p.cmd != nil {
+		s.setState(p, "deactivating", "stop-sigterm")
+		process.TerminateGroup(p.cmd, s.opts.StopTimeout)
+	}
+	s.mu.Unlock()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return &initsys.Error{Unit: service, Op: "stop", Err: ctx.Err()}
+	}
+}
+
+// Restart stops a program and starts it again
+func (s *Supervisor) Restart(ctx context.Context, service string) error {
+	if err := s.Stop(ctx, service); err != nil {
+		return err
+	}
+	return s.Start(ctx, service)
+}
+
+// Reload sends a running program SIGHUP
+func (s *Supervisor) Reload(ctx context.Context, service string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	p, err := s.lookup("reload", service)
+	if err != nil {
+		return err
+	}
+	if p.cmd == nil {
+		return &initsys.Error{Unit: service, Op: "reload", Err: fmt.Errorf("client is not running")}
+	}
+	if reloadSignal == nil {
+		return &initsys.Error{Unit: service, Op: "reload", Err: ErrReloadUnsupported}
+	}
+	if err := p.cmd.Process.Signal(reloadSignal); err != nil {
+		return &initsys.Error{Unit: service, Op: "reload", Err: err}
+	}
+	return nil
+}
+
+// Enable makes StartAll start a program
+func (s *Supervisor) Enable(ctx context.Context, service string) error {
+	return s.setAutostart("enable", service, true)
+}
+
+// Disable keeps StartAll from starting a program
+func (s *Supervisor) Disable(ctx context.Context, service string) error {
+	return s.setAutostart("disable", service, false)
+}
+
+func (s *Supervisor) setAutostart(op, service string, autostart bool) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	p, err := s.lookup(op, service)
+	if err != nil {
+		return err
+	}
+	p.autostart = autostart
+	return nil
+}
+
+// State returns the state of a program in systemd terms
+func (s *Supervisor) State(ctx context.Context, service string) (initsys.UnitState, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	p, err := s.lookup("status", service)
+	if err != nil {
+		return initsys.UnitState{}, err
+	}
+	return p.state, nil
+}
+
+// setState records a program's state and reports changes to watchers.
+// Caller must hold s.mu.
+func (s *Supervisor) setState(p *program, activeState, subState string) {
+	state := initsys.UnitState{Unit: p.Name, ActiveState: activeState, SubState: subState}
+	if state == p.state {
+		return
+	}
+	p.state = state
+	for subscriber := range s.subscribers {
+		select {
+		case subscriber <- state:
+		default:
+			// The watcher reads the state again when it catches up
+		}
+	}
+}
+
+// Watch calls changed whenever the state of one of services changes, until
+// ctx is done
+func (s *Supervisor) Watch(ctx context.Context, services []string, changed func(initsys.UnitState)) error {
+	watched := make(map[string]bool, len(services))
+	for _, service := range services {
+		watched[service] = true
+	}
+	updates := make(chan initsys.UnitState, 64)
+	s.mu.Lock()
+	s.subscribers[updates] = struct{}{}
+	s.mu.Unlock()
+	defer func() {
+		s.mu.Lock()
+		delete(s.subscribers, updates)
+		s.mu.Unlock()
+	}()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case state := <-updates:
+			if watched[state.Unit] {
+				changed(state)
+			}
+		}
+	}
+}
+
+// Close stops every program
+func (s *Supervisor) Close() {
+	s.StopAll()
+}
+
+// ProgramStatus reports how a program has been running
+type ProgramStatus struct {
+	Service     string `json:"service"`
+	ActiveState string `json:"activeState"`
+	SubState    string `json:"subState"`
+	PID         int    `json:"pid,omitempty"`
+	// Restarts counts automatic restarts since the agent started
+	Restarts int `json:"restarts"`
+	// LastExitCode is the exit code of the last exit, -1 when killed by a
+	// signal or for failing health checks; LastExitAt is nil until the program exited once
+	LastExitCode   int        `json:"lastExitCode"`
+	LastExitAt     *time.Time `json:"lastExitAt,omitempty"`
+	HealthFailures int        `json:"healthFailures,omitempty"`
+}
+
+// Status returns the status of every program by service name
+func (s *Supervisor) Status() map[string]ProgramStatus {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	status := make(map[string]ProgramStatus, len(s.programs))
+	for name, p := range s.programs {
+		programStatus := ProgramStatus{
+			Service:        name,
+			ActiveState:    p.state.ActiveState,
+			SubState:       p.state.SubState,
+			PID:            p.pid,
+			Restarts:       p.restarts,
+			LastExitCode:   p.lastExitCode,
+			HealthFailures: p.healthFailures,
+		}
+		if !p.lastExitAt.IsZero() {
+			lastExitAt := p.lastExitAt
+			programStatus.LastExitAt = &lastExitAt
+		}
+		status[name] = programStatus
+	}
+	return status
+}
+
+// names returns the names of the programs in order
+func (s *Supervisor) names() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	names := make([]string, 0, len(s.programs))
+	for name := range s.programs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// StartAll starts the enabled programs, returning the errors of those that
+// failed to start
+func (s *Supervisor) StartAll(ctx context.Context) error {
+	var errs []error
+	for _, name := range s.names() {
+		s.mu.Lock()
+		autostart := s.programs[name].autostart
+		s.mu.Unlock()
+		if !autostart {
+			continue
+		}
+		if err := s.Start(ctx, name); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// StopAll stops every program, waiting for them to exit. Programs that
+// ignore SIGTERM are killed after the stop timeout.
+func (s *Supervisor) StopAll() {
+	var wg sync.WaitGroup
+	for _, name := range s.names() {
+		wg.Add(1)
+		go func(name string) {
+			defer wg.Done()
+			s.Stop(context.Background(), name)
+		}(name)
+	}
+	wg.Wait()
+}
+
+// Kill kills the process groups of every running program
+func (s *Supervisor) Kill() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, p := range s.programs {
+		if p.cmd != nil {
+			process.KillGroup(p.cmd)
+		}
+	}
+}
+
+// ForwardSignals passes the signals the agent does not handle itself, such
+// as SIGHUP and SIGUSR1, on to the running programs until ctx is done
+func (s *Supervisor) ForwardSignals(ctx context.Context) {
+	if len(forwardedSignals) == 0 {
+		return
+	}
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, forwardedSignals...)
+	defer signal.Stop(signals)
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case sig := <-signals:
+			s.mu.Lock()
+			for _, p := range s.programs {
+				if p.cmd != nil {
+					p.cmd.Process.Signal(sig)
+				}
+			}
+			s.mu.Unlock()
+		}
+	}
+}
@@ -0,0 +1,246 @@
+//go:build unix
+
+package supervisor
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/kpblcaoo/sboxagent/internal/config"
+	"github.com/kpblcaoo/sboxagent/internal/initsys"
+	"github.com/kpblcaoo/sboxagent/internal/logger"
+)
+
+// syncBuffer collects program output written from several goroutines
+type syncBuffer struct {
+	mu sync.Mutex
+	b  bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.b.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.b.String()
+}
+
+func newSupervisor(t *testing.T, output *syncBuffer, programs ...Program) *Supervisor {
+	t.Helper()
+	log, err := logger.New("error")
+	require.NoError(t, err)
+	s := New(programs, Options{
+		RestartDelay:    10 * time.Millisecond,
+		MaxRestartDelay: 40 * time.Millisecond,
+		StopTimeout:     time.Second,
+		Stdout:          output,
+		Stderr:          output,
+	}, log)
+	t.Cleanup(s.StopAll)
+	return s
+}
+
+func waitState(t *testing.T, s *Supervisor, service, activeState string) {
+	t.Helper()
+	require.Eventually(t, func() bool {
+		state, err := s.State(context.Background(), service)
+		return err == nil && state.ActiveState == activeState
+	}, 5*time.Second, 10*time.Millisecond)
+}
+
+func TestSupervisor_StartStop(t *testing.T) {
+	output := &syncBuffer{}
+	s := newSupervisor(t, output, Program{
+		Name:    "sing-box",
+		Command: []string{"sh", "-c", `trap 'echo reloaded' HUP; echo "started $CLIENT"; while :; do sleep 0.1; done`},
+		Env:     []string{"CLIENT=sing-box"},
+	})
+	assert.Equal(t, System, s.System())
+	assert.Equal(t, Backend, s.Backend())
+	assert.Equal(t, "sing-box", s.Name("sing-box"))
+
+	ctx := context.Background()
+	require.NoError(t, s.StartAll(ctx))
+	state, err := s.State(ctx, "sing-box")
+	require.NoError(t, err)
+	assert.Equal(t, initsys.UnitState{Unit: "sing-box", ActiveState: "active", SubState: "running"}, state)
+	require.Eventually(t, func() bool {
+		return output.String() == "started sing-box\n"
+	}, 5*time.Second, 10*time.Millisecond)
+
+	require.NoError(t, s.Reload(ctx, "sing-box"))
+	require.Eventually(t, func() bool {
+		return output.String() == "started sing-box\nreloaded\n"
+	}, 5*time.Second, 10*time.Millisecond)
+
+	require.NoError(t, s.Stop(ctx, "sing-box"))
+	state, err = s.State(ctx, "sing-box")
+	require.NoError(t, err)
+	assert.Equal(t, "inactive", state.ActiveState)
+	assert.Equal(t, "dead", state.SubState)
+
+	_, err = s.State(ctx, "xray")
+	assert.True(t, errors.Is(err, initsys.ErrNoSuchUnit))
+}
+
+func TestSupervisor_RestartPolicy(t *testing.T) {
+	dir := t.TempDir()
+	runs := filepath.Join(dir, "runs")
+	s := newSupervisor(t, &syncBuffer{},
+		Program{Name: "failing", Command: []string{"sh", "-c", `echo x >> "$RUNS"; [ $(wc -l < "$RUNS") -ge 3 ] && exec sleep 30; exit 1`}, Env: []string{"RUNS=" + runs}},
+		Program{Name: "never", Command: []string{"sh", "-c", "exit 2"}, Restart: config.RestartNever},
+		Program{Name: "clean", Command: []string{"true"}},
+	)
+
+	require.NoError(t, s.StartAll(context.Background()))
+	waitState(t, s, "never", "failed")
+	waitState(t, s, "clean", "inactive")
+	require.Eventually(t, func() bool {
+		data, _ := os.ReadFile(runs)
+		state, _ := s.State(context.Background(), "failing")
+		return string(data) == "x\nx\nx\n" && state.ActiveState == "active"
+	}, 5*time.Second, 10*time.Millisecond)
+}
+
+func TestSupervisor_StartFailure(t *testing.T) {
+	s := newSupervisor(t, &syncBuffer{},
+		Program{Name: "missing", Command: []string{filepath.Join(t.TempDir(), "missing")}},
+		Program{Name: "disabled", Command: []string{"sleep", "30"}},
+	)
+	ctx := context.Background()
+	require.NoError(t, s.Disable(ctx, "disabled"))
+
+	err := s.StartAll(ctx)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "start missing")
+	state, err := s.State(ctx, "missing")
+	require.NoError(t, err)
+	assert.Equal(t, "failed", state.ActiveState)
+	state, err = s.State(ctx, "disabled")
+	require.NoError(t, err)
+	assert.Equal(t, "inactive", state.ActiveState)
+}
+
+func TestSupervisor_StopKillsIgnoringProgram(t *testing.T) {
+	log, err := logger.New("error")
+	require.NoError(t, err)
+	s := New([]Program{{
+		Name:    "stubborn",
+		Command: []string{"sh", "-c", `trap "" TERM; echo ready; while :; do sleep 1; done`},
+	}}, Options{RestartDelay: time.Millisecond, MaxRestartDelay: time.Millisecond, StopTimeout: 100 * time.Millisecond, Stdout: &syncBuffer{}}, log)
+
+	ctx := context.Background()
+	require.NoError(t, s.Start(ctx, "stubborn"))
+	time.Sleep(100 * time.Millisecond)
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+	require.NoError(t, s.Stop(ctx, "stubborn"))
+	waitState(t, s, "stubborn", "inactive")
+}
+
+func TestSupervisor_Watch(t *testing.T) {
+	s := newSupervisor(t, &syncBuffer{}, Program{Name: "sing-box", Command: []string{"sleep", "30"}})
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var mu sync.Mutex
+	var states []string
+	go func() {
+		s.Watch(ctx, []string{"sing-box"}, func(state initsys.UnitState) {
+			mu.Lock()
+			states = append(states, state.ActiveState)
+			mu.Unlock()
+		})
+	}()
+	require.Eventually(t, func() bool {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		return len(s.subscribers) == 1
+	}, 5*time.Second, 10*time.Millisecond)
+
+	require.NoError(t, s.Start(context.Background(), "sing-box"))
+	require.NoError(t, s.Stop(context.Background(), "sing-box"))
+	require.Eventually(t, func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return len(states) == 4
+	}, 5*time.Second, 10*time.Millisecond)
+	assert.Equal(t, []string{"activating", "active", "deactivating", "inactive"}, states)
+}
+
+func TestSupervisor_StartLimit(t *testing.T) {
+	log, err := logger.New("error")
+	require.NoError(t, err)
+	s := New([]Program{{Name: "crashing", Command: []string{"sh", "-c", "exit 3"}}}, Options{
+		RestartDelay:    time.Millisecond,
+		MaxRestartDelay: time.Millisecond,
+		MaxRestarts:     2,
+		RestartWindow:   time.Minute,
+		StopTimeout:     time.Second,
+	}, log)
+	t.Cleanup(s.StopAll)
+
+	require.NoError(t, s.Start(context.Background(), "crashing"))
+	require.Eventually(t, func() bool {
+		state, _ := s.State(context.Background(), "crashing")
+		return state.SubState == "start-limit-hit"
+	}, 5*time.Second, 10*time.Millisecond)
+
+	status := s.Status()["crashing"]
+	assert.Equal(t, "failed", status.ActiveState)
+	assert.Equal(t, 2, status.Restarts)
+	assert.Equal(t, 3, status.LastExitCode)
+	assert.NotNil(t, status.LastExitAt)
+	assert.Zero(t, status.PID)
+}
+
+func TestSupervisor_HealthCheck(t *testing.T) {
+	// The program is healthy while the marker file exists
+	marker := filepath.Join(t.TempDir(), "healthy")
+	require.NoError(t, os.WriteFile(marker, nil, 0644))
+	log, err := logger.New("error")
+	require.NoError(t, err)
+	s := New([]Program{{
+		Name:        "sing-box",
+		Command:     []string{"sleep", "30"},
+		HealthCheck: []string{"test", "-e", marker},
+	}}, Options{
+		RestartDelay:    time.Millisecond,
+		MaxRestartDelay: time.Millisecond,
+		StopTimeout:     time.Second,
+		HealthInterval:  20 * time.Millisecond,
+		HealthTimeout:   time.Second,
+		HealthThreshold: 2,
+	}, log)
+	t.Cleanup(s.StopAll)
+
+	require.NoError(t, s.Start(context.Background(), "sing-box"))
+	time.Sleep(100 * time.Millisecond)
+	assert.Zero(t, s.Status()["sing-box"].Restarts)
+	pid := s.Status()["sing-box"].PID
+	assert.NotZero(t, pid)
+
+	require.NoError(t, os.Remove(marker))
+	require.Eventually(t, func() bool {
+		return s.Status()["sing-box"].Restarts > 0
+	}, 5*time.Second, 10*time.Millisecond)
+	require.NoError(t, os.WriteFile(marker, nil, 0644))
+	waitState(t, s, "sing-box", "active")
+
+	status := s.Status()["sing-box"]
+	assert.Equal(t, -1, status.LastExitCode)
+	assert.NotEqual(t, pid, status.PID)
+}
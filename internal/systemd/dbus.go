@@ -0,0 +1,197 @@
+package systemd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	sddbus "github.com/coreos/go-systemd/v22/dbus"
+	"github.com/godbus/dbus/v5"
+)
+
+// noSuchUnit is the D-Bus error systemd returns for unknown units
+const noSuchUnit = "org.freedesktop.systemd1.NoSuchUnit"
+
+// dbusUnits manages units over a D-Bus connection to systemd
+type dbusUnits struct {
+	conn *sddbus.Conn
+}
+
+// openDBus connects to the system or user manager
+func openDBus(ctx context.Context, userMode bool) (*dbusUnits, error) {
+	var conn *sddbus.Conn
+	var err error
+	if userMode {
+		conn, err = sddbus.NewUserConnectionContext(ctx)
+	} else {
+		conn, err = sddbus.NewWithContext(ctx)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to systemd: %w", err)
+	}
+	return &dbusUnits{conn: conn}, nil
+}
+
+func (d *dbusUnits) Backend() string {
+	return BackendDBus
+}
+
+func (d *dbusUnits) Start(ctx context.Context, unit string) error {
+	return d.job(ctx, "start", unit, d.conn.StartUnitContext)
+}
+
+func (d *dbusUnits) Stop(ctx context.Context, unit string) error {
+	return d.job(ctx, "stop", unit, d.conn.StopUnitContext)
+}
+
+func (d *dbusUnits) Restart(ctx context.Context, unit string) error {
+	return d.job(ctx, "restart", unit, d.conn.RestartUnitContext)
+}
+
+func (d *dbusUnits) Reload(ctx context.Context, unit string) error {
+	return d.job(ctx, "reload", unit, d.conn.ReloadUnitContext)
+}
+
+// job queues a unit job and waits for its result
+func (d *dbusUnits) job(ctx context.Context, op, unit string, queue func(context.Context, string, string, chan<- string) (int, error)) error {
+	name := UnitName(unit)
+	results := make(chan string, 1)
+	if _, err := queue(ctx, name, "replace", results); err != nil {
+		return unitError(op, name, err)
+	}
+	select {
+	case result := <-results:
+		// A job is skipped when it does not apply to the unit's state
+		if result != "done" && result != "skipped" {
+			return &Error{Unit: name, Op: op, Result: result}
+		}
+		return nil
+	case <-ctx.Done():
+		return &Error{Unit: name, Op: op, Err: ctx.Err()}
+	}
+}
+
+func (d *dbusUnits) Enable(ctx context.Context, unit string) error {
+	name := UnitName(unit)
+	if _, _, err := d.conn.EnableUnitFilesContext(ctx, []string{name}, false, false); err != nil {
+		return unitError("enable", name, err)
+	}
+	if err := d.conn.ReloadContext(ctx); err != nil {
+		return unitError("enable", name, err)
+	}
+	return nil
+}
+
+func (d *dbusUnits) Disable(ctx context.Context, unit string) error {
+	name := UnitName(unit)
+	if _, err := d.conn.DisableUnitFilesContext(ctx, []string{name}, false); err != nil {
+		return unitError("disable", name, err)
+	}
+	if err := d.conn.ReloadContext(ctx); err != nil {
+		return unitError("disable", name, err)
+	}
+	return nil
+}
+
+func (d *dbusUnits) Properties(ctx context.Context, unit string, names ...string) (map[string]interface{}, error) {
+	name := UnitName(unit)
+	if len(names) == 0 {
+		properties, err := d.conn.GetUnitPropertiesContext(ctx, name)
+		if err != nil {
+			return nil, unitError("show", name, err)
+		}
+		return properties, nil
+	}
+
+	properties := make(map[string]interface{}, len(names))
+	for _, property := range names {
+		value, err := d.conn.GetUnitPropertyContext(ctx, name, property)
+		if err != nil {
+			return nil, unitError("show", name, err)
+		}
+		properties[property] = value.Value.Value()
+	}
+	return properties, nil
+}
+
+func (d *dbusUnits) ActiveState(ctx context.Context, unit string) (string, error) {
+	state, err := d.State(ctx, unit)
+	return state.ActiveState, err
+}
+
+func (d *dbusUnits) State(ctx context.Context, unit string) (UnitState, error) {
+	properties, err := d.Properties(ctx, unit, "ActiveState", "SubState")
+	if err != nil {
+		return UnitState{}, err
+	}
+	state := UnitState{Unit: UnitName(unit)}
+	state.ActiveState, _ = properties["ActiveState"].(string)
+	state.SubState, _ = properties["SubState"].(string)
+	return state, nil
+}
+
+// Watch subscribes to the PropertiesChanged signals of the manager. Changes
+// missed because updates queued up are caught by reading the states again.
+func (d *dbusUnits) Watch(ctx context.Context, units []string, changed func(UnitState)) error {
+	last := make(map[string]UnitState, len(units))
+	for _, unit := range units {
+		state, err := d.State(ctx, unit)
+		if err != nil {
+			return err
+		}
+		last[state.Unit] = state
+	}
+	if err := d.conn.Subscribe(); err != nil {
+		return fmt.Errorf("failed to subscribe to systemd: %w", err)
+	}
+	defer d.conn.Unsubscribe()
+
+	updates := make(chan *sddbus.PropertiesUpdate, 64)
+	overflows := make(chan error, 1)
+	d.conn.SetPropertiesSubscriber(updates, overflows)
+	defer d.conn.SetPropertiesSubscriber(nil, nil)
+
+	report := func(state UnitState) {
+		if state != last[state.Unit] {
+			last[state.Unit] = state
+			changed(state)
+		}
+	}
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case update := <-updates:
+			state, ok := last[update.UnitName]
+			if !ok {
+				continue
+			}
+			if value, ok := update.Changed["ActiveState"]; ok {
+				state.ActiveState, _ = value.Value().(string)
+			}
+			if value, ok := update.Changed["SubState"]; ok {
+				state.SubState, _ = value.Value().(string)
+			}
+			report(state)
+		case <-overflows:
+			for unit := range last {
+				if state, err := d.State(ctx, unit); err == nil {
+					report(state)
+				}
+			}
+		}
+	}
+}
+
+func (d *dbusUnits) Close() {
+	d.conn.Close()
+}
+
+// unitError wraps a D-Bus error, mapping unknown units to ErrNoSuchUnit
+func unitError(op, unit string, err error) error {
+	var dbusErr dbus.Error
+	if errors.As(err, &dbusErr) && dbusErr.Name == noSuchUnit {
+		err = fmt.Errorf("%w: %v", ErrNoSuchUnit, err)
+	}
+	return &Error{Unit: unit, Op: op, Err: err}
+}
@@ -0,0 +1,125 @@
+package systemd
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"strings"
+
+	"github.com/kpblcaoo/sboxagent/internal/process"
+)
+
+// Runner runs a command and returns its stdout
+type Runner func(ctx context.Context, command []string) ([]byte, error)
+
+// exitNoSuchUnit is the exit status of systemctl for units not found
+const exitNoSuchUnit = 5
+
+// systemctlUnits manages units by running systemctl
+type systemctlUnits struct {
+	userMode bool
+	run      Runner
+}
+
+func newSystemctl(userMode bool, run Runner) *systemctlUnits {
+	return &systemctlUnits{userMode: userMode, run: run}
+}
+
+func (s *systemctlUnits) Backend() string {
+	return BackendSystemctl
+}
+
+// systemctl runs systemctl with args
+func (s *systemctlUnits) systemctl(ctx context.Context, op, unit string, args ...string) ([]byte, error) {
+	command := []string{"systemctl"}
+	if s.userMode {
+		command = append(command, "--user")
+	}
+	output, err := s.run(ctx, append(command, args...))
+	if err != nil {
+		if process.ExitCode(err) == exitNoSuchUnit {
+			err = errors.Join(ErrNoSuchUnit, err)
+		}
+		return nil, &Error{Unit: unit, Op: op, Err: err}
+	}
+	return output, nil
+}
+
+func (s *systemctlUnits) Start(ctx context.Context, unit string) error {
+	_, err := s.systemctl(ctx, "start", unit, "start", unit)
+	return err
+}
+
+func (s *systemctlUnits) Stop(ctx context.Context, unit string) error {
+	_, err := s.systemctl(ctx, "stop", unit, "stop", unit)
+	return err
+}
+
+func (s *systemctlUnits) Restart(ctx context.Context, unit string) error {
+	_, err := s.systemctl(ctx, "restart", unit, "restart", unit)
+	return err
+}
+
+func (s *systemctlUnits) Reload(ctx context.Context, unit string) error {
+	_, err := s.systemctl(ctx, "reload", unit, "reload", unit)
+	return err
+}
+
+func (s *systemctlUnits) Enable(ctx context.Context, unit string) error {
+	_, err := s.systemctl(ctx, "enable", unit, "enable", unit)
+	return err
+}
+
+func (s *systemctlUnits) Disable(ctx context.Context, unit string) error {
+	_, err := s.systemctl(ctx, "disable", unit, "disable", unit)
+	return err
+}
+
+// Properties parses the Name=value lines of systemctl show; values are
+// strings
+func (s *systemctlUnits) Properties(ctx context.Context, unit string, names ...string) (map[string]interface{}, error) {
+	args := []string{"show"}
+	if len(names) > 0 {
+		args = append(args, "--property="+strings.Join(names, ","))
+	}
+	output, err := s.systemctl(ctx, "show", unit, append(args, unit)...)
+	if err != nil {
+		return nil, err
+	}
+
+	properties := make(map[string]interface{})
+	scanner := bufio.NewScanner(bytes.NewReader(output))
+	for scanner.Scan() {
+		if name, value, ok := strings.Cut(scanner.Text(), "="); ok {
+			properties[name] = value
+		}
+	}
+	return properties, nil
+}
+
+func (s *systemctlUnits) ActiveState(ctx context.Context, unit string) (string, error) {
+	properties, err := s.Properties(ctx, unit, "ActiveState")
+	if err != nil {
+		return "", err
+	}
+	state, _ := properties["ActiveState"].(string)
+	return state, nil
+}
+
+func (s *systemctlUnits) State(ctx context.Context, unit string) (UnitState, error) {
+	properties, err := s.Properties(ctx, unit, "ActiveState", "SubState")
+	if err != nil {
+		return UnitState{}, err
+	}
+	state := UnitState{Unit: UnitName(unit)}
+	state.ActiveState, _ = properties["ActiveState"].(string)
+	state.SubState, _ = properties["SubState"].(string)
+	return state, nil
+}
+
+func (s *systemctlUnits) Watch(ctx context.Context, units []string, changed func(UnitState)) error {
+	return ErrWatchUnsupported
+}
+
+func (s *systemctlUnits) Close() {}
@@ -0,0 +1,112 @@
+// Package systemd manages systemd units over D-Bus, falling back to the
+// systemctl command where no bus is reachable.
+package systemd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Backend names of services.systemd.backend
+const (
+	BackendAuto      = "auto"
+	BackendDBus      = "dbus"
+	BackendSystemctl = "systemctl"
+)
+
+var (
+	// ErrNoSuchUnit is returned for units systemd does not know
+	ErrNoSuchUnit = errors.New("no such unit")
+	// ErrWatchUnsupported is returned by backends that cannot report unit
+	// state changes
+	ErrWatchUnsupported = errors.New("watching units requires the dbus backend")
+)
+
+// Units starts, stops and inspects the units of the system or user manager
+type Units interface {
+	// Backend returns the name of the backend, dbus or systemctl
+	Backend() string
+	Start(ctx context.Context, unit string) error
+	Stop(ctx context.Context, unit string) error
+	Restart(ctx context.Context, unit string) error
+	Reload(ctx context.Context, unit string) error
+	// Enable and Disable change whether the unit starts at boot and reload
+	// the manager
+	Enable(ctx context.Context, unit string) error
+	Disable(ctx context.Context, unit string) error
+	// Properties returns the named properties of a unit, all of them if
+	// none are named
+	Properties(ctx context.Context, unit string, names ...string) (map[string]interface{}, error)
+	// ActiveState returns the unit's state such as active, failed or
+	// inactive
+	ActiveState(ctx context.Context, unit string) (string, error)
+	// State returns the active and sub state of a unit
+	State(ctx context.Context, unit string) (UnitState, error)
+	// Watch calls changed whenever the state of one of the units changes,
+	// until ctx is done
+	Watch(ctx context.Context, units []string, changed func(UnitState)) error
+	Close()
+}
+
+// UnitState is the state of a unit at a change
+type UnitState struct {
+	Unit        string `json:"unit"`
+	ActiveState string `json:"activeState"`
+	SubState    string `json:"subState,omitempty"`
+}
+
+// Error is a failed unit operation. Result is the systemd job result, such
+// as failed, timeout or dependency, when the job was queued but did not
+// complete.
+type Error struct {
+	Unit   string
+	Op     string
+	Result string
+	Err    error
+}
+
+func (e *Error) Error() string {
+	if e.Result != "" {
+		return fmt.Sprintf("%s %s: job %s", e.Op, e.Unit, e.Result)
+	}
+	return fmt.Sprintf("%s %s: %v", e.Op, e.Unit, e.Err)
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// UnitName returns the full name of a unit, adding .service to names
+// without a unit type the way systemctl does
+func UnitName(name string) string {
+	if i := strings.LastIndex(name, "."); i > 0 {
+		switch name[i+1:] {
+		case "service", "socket", "target", "timer", "path", "mount",
+			"automount", "swap", "slice", "scope", "device":
+			return name
+		}
+	}
+	return name + ".service"
+}
+
+// Open returns the units of the system manager, or of the user manager in
+// userMode, using the named backend. The auto backend uses D-Bus when the
+// bus is reachable and systemctl, run by run, otherwise.
+func Open(ctx context.Context, backend string, userMode bool, run Runner) (Units, error) {
+	switch backend {
+	case "", BackendAuto:
+		units, err := openDBus(ctx, userMode)
+		if err != nil {
+			return newSystemctl(userMode, run), nil
+		}
+		return units, nil
+	case BackendDBus:
+		return openDBus(ctx, userMode)
+	case BackendSystemctl:
+		return newSystemctl(userMode, run), nil
+	default:
+		return nil, fmt.Errorf("unknown systemd backend %q", backend)
+	}
+}
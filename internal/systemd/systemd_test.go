@@ -0,0 +1,76 @@
+package systemd
+
+import (
+	"context"
+	"errors"
+	"os/exec"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestUnitName(t *testing.T) {
+	assert.Equal(t, "sing-box.service", UnitName("sing-box"))
+	assert.Equal(t, "sing-box.service", UnitName("sing-box.service"))
+	assert.Equal(t, "sing-box@eu.service", UnitName("sing-box@eu"))
+	assert.Equal(t, "vpn.target", UnitName("vpn.target"))
+	assert.Equal(t, "wg0.conf.service", UnitName("wg0.conf"))
+}
+
+func TestSystemctlUnits(t *testing.T) {
+	var commands [][]string
+	units, err := Open(context.Background(), BackendSystemctl, true, func(ctx context.Context, command []string) ([]byte, error) {
+		commands = append(commands, command)
+		return []byte("ActiveState=failed\nSubState=failed\n"), nil
+	})
+	require.NoError(t, err)
+	assert.Equal(t, BackendSystemctl, units.Backend())
+
+	ctx := context.Background()
+	require.NoError(t, units.Stop(ctx, "sing-box"))
+	state, err := units.ActiveState(ctx, "sing-box")
+	require.NoError(t, err)
+	assert.Equal(t, "failed", state)
+	properties, err := units.Properties(ctx, "sing-box")
+	require.NoError(t, err)
+	assert.Equal(t, map[string]interface{}{"ActiveState": "failed", "SubState": "failed"}, properties)
+
+	assert.Equal(t, [][]string{
+		{"systemctl", "--user", "stop", "sing-box"},
+		{"systemctl", "--user", "show", "--property=ActiveState", "sing-box"},
+		{"systemctl", "--user", "show", "sing-box"},
+	}, commands)
+
+	err = units.Watch(ctx, []string{"sing-box"}, func(UnitState) {})
+	assert.ErrorIs(t, err, ErrWatchUnsupported)
+}
+
+func TestSystemctlUnits_Errors(t *testing.T) {
+	units, err := Open(context.Background(), BackendSystemctl, false, func(ctx context.Context, command []string) ([]byte, error) {
+		// systemctl exits with 5 for units it cannot find
+		return nil, exec.CommandContext(ctx, "sh", "-c", "exit 5").Run()
+	})
+	require.NoError(t, err)
+
+	err = units.Start(context.Background(), "missing")
+	var unitErr *Error
+	require.True(t, errors.As(err, &unitErr))
+	assert.Equal(t, "start", unitErr.Op)
+	assert.Equal(t, "missing", unitErr.Unit)
+	assert.ErrorIs(t, err, ErrNoSuchUnit)
+}
+
+func TestError(t *testing.T) {
+	err := &Error{Unit: "sing-box.service", Op: "start", Result: "dependency"}
+	assert.EqualError(t, err, "start sing-box.service: job dependency")
+
+	err = &Error{Unit: "sing-box.service", Op: "stop", Err: context.DeadlineExceeded}
+	assert.EqualError(t, err, "stop sing-box.service: context deadline exceeded")
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+}
+
+func TestOpen_UnknownBackend(t *testing.T) {
+	_, err := Open(context.Background(), "upstart", false, nil)
+	assert.EqualError(t, err, `unknown systemd backend "upstart"`)
+}
@@ -0,0 +1,248 @@
+package systemd
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"sort"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/kpblcaoo/sboxagent/internal/config"
+)
+
+// UnitChange describes a setting that differs between two unit files. Key
+// is Section.Name; settings given more than once are compared as a whole.
+type UnitChange struct {
+	Key string `json:"key"`
+	Old string `json:"old,omitempty"`
+	New string `json:"new,omitempty"`
+}
+
+var unitTemplate = template.Must(template.New("unit").Parse(`[Unit]
+Description={{.Description}}
+Documentation=https://github.com/kpblcaoo/sboxagent
+After=network.target
+
+[Service]
+Type=notify
+{{- with .User}}
+User={{.}}{{end}}
+{{- with .Group}}
+Group={{.}}{{end}}
+ExecStart={{.ExecStart}}
+{{- with .Restart}}
+Restart={{.}}{{end}}
+{{- with .RestartSec}}
+RestartSec={{.}}{{end}}
+{{- with .WatchdogSec}}
+WatchdogSec={{.}}{{end}}
+{{- with .RuntimeDirectory}}
+RuntimeDirectory={{.}}
+RuntimeDirectoryMode=0750{{end}}
+StandardOutput=journal
+StandardError=journal
+SyslogIdentifier=sboxagent
+
+# Security settings
+NoNewPrivileges={{.NoNewPrivileges}}
+PrivateTmp={{.PrivateTmp}}
+{{- with .ProtectSystem}}
+ProtectSystem={{.}}{{end}}
+ProtectHome={{.ProtectHome}}
+{{- with .CapabilityBoundingSet}}
+CapabilityBoundingSet={{.}}{{end}}
+{{- with .AmbientCapabilities}}
+AmbientCapabilities={{.}}{{end}}
+{{- range .ReadWritePaths}}
+ReadWritePaths={{.}}{{end}}
+{{- if or .LimitNOFILE .LimitNPROC}}
+
+# Resource limits{{end}}
+{{- with .LimitNOFILE}}
+LimitNOFILE={{.}}{{end}}
+{{- with .LimitNPROC}}
+LimitNPROC={{.}}{{end}}
+{{- with .Extra}}
+
+# Extra settings{{range .}}
+{{.}}{{end}}{{end}}
+
+[Install]
+WantedBy=multi-user.target
+`))
+
+var clientUnitTemplate = template.Must(template.New("client-unit").Parse(`[Unit]
+Description={{.Client}} proxy client managed by sboxagent
+After=network-online.target
+Wants=network-online.target
+
+[Service]
+ExecStart={{.ExecStart}}
+{{- range .Env}}
+Environment={{.}}{{end}}
+Restart={{.Restart}}
+RestartSec=5s
+StandardOutput=journal
+StandardError=journal
+SyslogIdentifier={{.Client}}
+
+[Install]
+WantedBy=multi-user.target
+`))
+
+// clientRestart maps client restart policies to systemd Restart= values
+var clientRestart = map[string]string{
+	"":                      "on-failure",
+	config.RestartNever:     "no",
+	config.RestartOnFailure: "on-failure",
+	config.RestartAlways:    "always",
+}
+
+// RenderClientUnit generates the systemd unit running a client by its
+// config key, with binary as the absolute path of its executable
+func RenderClientUnit(clients config.ClientsConfig, name, binary string) ([]byte, error) {
+	args, ok := clients.Command(name)
+	if !ok {
+		return nil, fmt.Errorf("unknown client %q", name)
+	}
+	args[0] = binary
+	for i, arg := range args {
+		args[i] = quoteArg(arg)
+	}
+	overrides, _ := clients.Overrides(name)
+	env := make([]string, len(overrides.Env))
+	for i, entry := range overrides.Env {
+		env[i] = quoteArg(entry)
+	}
+
+	data := struct {
+		Client    string
+		ExecStart string
+		Env       []string
+		Restart   string
+	}{
+		Client:    name,
+		ExecStart: strings.Join(args, " "),
+		Env:       env,
+		Restart:   clientRestart[overrides.RestartPolicy],
+	}
+	var b bytes.Buffer
+	if err := clientUnitTemplate.Execute(&b, data); err != nil {
+		return nil, fmt.Errorf("failed to render client unit: %w", err)
+	}
+	return b.Bytes(), nil
+}
+
+// RenderUnit generates the systemd unit of the agent from cfg, resolving the
+// ExecStart arguments with vars
+func RenderUnit(cfg config.UnitConfig, vars config.UnitVars) ([]byte, error) {
+	args, err := cfg.Command(vars)
+	if err != nil {
+		return nil, err
+	}
+	for i, arg := range args {
+		args[i] = quoteArg(arg)
+	}
+
+	data := struct {
+		config.UnitConfig
+		ExecStart             string
+		RestartSec            string
+		WatchdogSec           string
+		CapabilityBoundingSet string
+		AmbientCapabilities   string
+	}{
+		UnitConfig:            cfg,
+		ExecStart:             strings.Join(args, " "),
+		RestartSec:            unitSeconds(cfg.RestartSec),
+		WatchdogSec:           unitSeconds(cfg.WatchdogSec),
+		CapabilityBoundingSet: strings.Join(cfg.CapabilityBoundingSet, " "),
+		AmbientCapabilities:   strings.Join(cfg.AmbientCapabilities, " "),
+	}
+	var b bytes.Buffer
+	if err := unitTemplate.Execute(&b, data); err != nil {
+		return nil, fmt.Errorf("failed to render unit: %w", err)
+	}
+	return b.Bytes(), nil
+}
+
+// unitSeconds formats a duration as systemd time span, or "" for zero
+func unitSeconds(d time.Duration) string {
+	if d <= 0 {
+		return ""
+	}
+	if d%time.Second == 0 {
+		return fmt.Sprintf("%ds", d/time.Second)
+	}
+	return fmt.Sprintf("%dms", d/time.Millisecond)
+}
+
+// quoteArg quotes a command line argument for systemd and escapes its
+// specifiers
+func quoteArg(arg string) string {
+	arg = strings.ReplaceAll(arg, "%", "%%")
+	if arg != "" && !strings.ContainsAny(arg, " \t\"'\\;$") {
+		return arg
+	}
+	arg = strings.ReplaceAll(arg, `\`, `\\`)
+	arg = strings.ReplaceAll(arg, `"`, `\"`)
+	arg = strings.ReplaceAll(arg, "$", "$$")
+	return `"` + arg + `"`
+}
+
+// DiffUnit compares the settings of two unit files, ignoring comments,
+// blank lines and the order of sections and settings
+func DiffUnit(old, new []byte) []UnitChange {
+	oldValues := parseUnit(old)
+	newValues := parseUnit(new)
+
+	keys := make(map[string]struct{}, len(oldValues))
+	for key := range oldValues {
+		keys[key] = struct{}{}
+	}
+	for key := range newValues {
+		keys[key] = struct{}{}
+	}
+
+	changes := []UnitChange{}
+	for key := range keys {
+		if oldValues[key] != newValues[key] {
+			changes = append(changes, UnitChange{Key: key, Old: oldValues[key], New: newValues[key]})
+		}
+	}
+	sort.Slice(changes, func(i, j int) bool {
+		return changes[i].Key < changes[j].Key
+	})
+	return changes
+}
+
+// parseUnit returns the settings of a unit file as Section.Name keys.
+// Values of settings given more than once are joined by newlines.
+func parseUnit(data []byte) map[string]string {
+	values := make(map[string]string)
+	section := ""
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") || strings.HasPrefix(line, ";") {
+			continue
+		}
+		if strings.HasPrefix(line, "[") && strings.HasSuffix(line, "]") {
+			section = strings.Trim(line, "[]")
+			continue
+		}
+		name, value, ok := strings.Cut(line, "=")
+		if !ok {
+			continue
+		}
+		key := section + "." + strings.TrimSpace(name)
+		value = strings.TrimSpace(value)
+		if current, ok := values[key]; ok {
+			value = current + "\n" + value
+		}
+		values[key] = value
+	}
+	return values
+}
@@ -0,0 +1,99 @@
+package systemd
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/kpblcaoo/sboxagent/internal/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRenderUnit(t *testing.T) {
+	cfg := config.UnitConfig{
+		Description:           "SboxAgent",
+		User:                  "sboxagent",
+		ExecStart:             []string{"{{.Binary}}", "-config", "{{.ConfigPath}}", "-socket", "{{.SocketPath}}"},
+		RestartSec:            5 * time.Second,
+		WatchdogSec:           1500 * time.Millisecond,
+		RuntimeDirectory:      "sboxagent",
+		ProtectSystem:         "strict",
+		NoNewPrivileges:       true,
+		CapabilityBoundingSet: []string{"CAP_NET_ADMIN", "CAP_NET_BIND_SERVICE"},
+		ReadWritePaths:        []string{"/etc/sboxagent", "/var/lib/sboxagent"},
+		Extra:                 []string{"MemoryMax=256M"},
+	}
+	unit, err := RenderUnit(cfg, config.UnitVars{
+		Binary:     "/usr/local/bin/sboxagent",
+		ConfigPath: "/etc/sbox agent/agent.yaml",
+		SocketPath: "/run/sboxagent/sboxagent.sock",
+	})
+	require.NoError(t, err)
+
+	text := string(unit)
+	assert.Contains(t, text, `ExecStart=/usr/local/bin/sboxagent -config "/etc/sbox agent/agent.yaml" -socket /run/sboxagent/sboxagent.sock`+"\n")
+	assert.Contains(t, text, "User=sboxagent\n")
+	assert.NotContains(t, text, "Group=")
+	assert.Contains(t, text, "RestartSec=5s\n")
+	assert.Contains(t, text, "WatchdogSec=1500ms\n")
+	assert.Contains(t, text, "RuntimeDirectory=sboxagent\n")
+	assert.Contains(t, text, "NoNewPrivileges=true\nPrivateTmp=false\nProtectSystem=strict\n")
+	assert.Contains(t, text, "CapabilityBoundingSet=CAP_NET_ADMIN CAP_NET_BIND_SERVICE\n")
+	assert.Contains(t, text, "ReadWritePaths=/etc/sboxagent\nReadWritePaths=/var/lib/sboxagent\n")
+	assert.NotContains(t, text, "Resource limits")
+	assert.Contains(t, text, "MemoryMax=256M\n")
+	assert.True(t, strings.HasSuffix(text, "[Install]\nWantedBy=multi-user.target\n"))
+}
+
+func TestRenderUnit_Errors(t *testing.T) {
+	_, err := RenderUnit(config.UnitConfig{}, config.UnitVars{})
+	assert.EqualError(t, err, "unit exec_start is empty")
+
+	_, err = RenderUnit(config.UnitConfig{ExecStart: []string{"{{.Missing}}"}}, config.UnitVars{})
+	assert.Error(t, err)
+}
+
+func TestRenderClientUnit(t *testing.T) {
+	clients := config.ClientsConfig{
+		SingBox: config.SingBoxConfig{
+			Enabled:    true,
+			ConfigPath: "/etc/sing-box/config.json",
+			ClientOverrides: config.ClientOverrides{
+				ExtraArgs:     []string{"-D", "/var/lib/sing-box"},
+				Env:           []string{"ENABLE_DEPRECATED_TUN=true"},
+				RestartPolicy: config.RestartAlways,
+			},
+		},
+	}
+	unit, err := RenderClientUnit(clients, "sing-box", "/usr/local/bin/sing-box")
+	require.NoError(t, err)
+
+	text := string(unit)
+	assert.Contains(t, text, "Description=sing-box proxy client managed by sboxagent\n")
+	assert.Contains(t, text, "ExecStart=/usr/local/bin/sing-box run -c /etc/sing-box/config.json -D /var/lib/sing-box\n")
+	assert.Contains(t, text, "Environment=ENABLE_DEPRECATED_TUN=true\nRestart=always\n")
+	assert.Empty(t, DiffUnit(unit, unit))
+
+	_, err = RenderClientUnit(clients, "v2ray", "/usr/bin/v2ray")
+	assert.EqualError(t, err, `unknown client "v2ray"`)
+}
+
+func TestQuoteArg(t *testing.T) {
+	assert.Equal(t, "/usr/bin/sboxagent", quoteArg("/usr/bin/sboxagent"))
+	assert.Equal(t, `""`, quoteArg(""))
+	assert.Equal(t, "100%%", quoteArg("100%"))
+	assert.Equal(t, `"a \"b\" $$HOME"`, quoteArg(`a "b" $HOME`))
+}
+
+func TestDiffUnit(t *testing.T) {
+	old := []byte("[Service]\n# comment\nUser=root\nRestartSec=5\nReadWritePaths=/etc/sboxagent\nLimitNPROC=4096\n")
+	new := []byte("[Service]\nRestartSec=5\nUser=sboxagent\nReadWritePaths=/etc/sboxagent\nReadWritePaths=/var/lib/sboxagent\n")
+
+	assert.Equal(t, []UnitChange{
+		{Key: "Service.LimitNPROC", Old: "4096"},
+		{Key: "Service.ReadWritePaths", Old: "/etc/sboxagent", New: "/etc/sboxagent\n/var/lib/sboxagent"},
+		{Key: "Service.User", Old: "root", New: "sboxagent"},
+	}, DiffUnit(old, new))
+	assert.Empty(t, DiffUnit(new, new))
+}
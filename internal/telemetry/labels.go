@@ -0,0 +1,74 @@
+// Package telemetry defines the labels shared by the agent's metrics, logs
+// and events, so deployments running several agents or profiles can tell
+// their telemetry apart.
+package telemetry
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Label names applied to agent telemetry
+const (
+	LabelAgentID = "agent_id"
+	LabelProfile = "profile"
+	LabelClient  = "client"
+	LabelService = "service"
+)
+
+// Labels is a set of telemetry labels by name
+type Labels map[string]string
+
+// New returns the labels identifying an agent. Empty values are left out.
+func New(agentID, profile, client string) Labels {
+	return Labels{}.
+		With(LabelAgentID, agentID).
+		With(LabelProfile, profile).
+		With(LabelClient, client)
+}
+
+// With returns a copy of the labels with name set to value, or without name
+// if value is empty
+func (l Labels) With(name, value string) Labels {
+	result := make(Labels, len(l)+1)
+	for k, v := range l {
+		result[k] = v
+	}
+	if value == "" {
+		delete(result, name)
+	} else {
+		result[name] = value
+	}
+	return result
+}
+
+// Fields returns the labels as log or event fields
+func (l Labels) Fields() map[string]interface{} {
+	fields := make(map[string]interface{}, len(l))
+	for k, v := range l {
+		fields[k] = v
+	}
+	return fields
+}
+
+// Prefix formats the labels as the leading part of a Prometheus label set,
+// sorted by name and followed by a comma, so callers can append their own
+// labels: fmt.Sprintf("metric{%squeue=%q}", labels.Prefix(), name). It
+// returns an empty string for no labels.
+func (l Labels) Prefix() string {
+	if len(l) == 0 {
+		return ""
+	}
+	names := make([]string, 0, len(l))
+	for name := range l {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var b strings.Builder
+	for _, name := range names {
+		fmt.Fprintf(&b, "%s=%q,", name, l[name])
+	}
+	return b.String()
+}
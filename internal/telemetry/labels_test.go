@@ -0,0 +1,21 @@
+package telemetry
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLabels(t *testing.T) {
+	labels := New("edge-1", "", "sing-box")
+	assert.Equal(t, Labels{LabelAgentID: "edge-1", LabelClient: "sing-box"}, labels)
+
+	withService := labels.With(LabelService, "api")
+	assert.Equal(t, "api", withService[LabelService])
+	assert.NotContains(t, labels, LabelService)
+	assert.NotContains(t, withService.With(LabelService, ""), LabelService)
+
+	assert.Equal(t, `agent_id="edge-1",client="sing-box",service="api",`, withService.Prefix())
+	assert.Equal(t, "", Labels{}.Prefix())
+	assert.Equal(t, map[string]interface{}{"agent_id": "edge-1", "client": "sing-box"}, labels.Fields())
+}
@@ -0,0 +1,16 @@
+package tunnel
+
+import "context"
+
+type tunnelKey struct{}
+
+// WithTunnel marks a request context as arriving through the management tunnel
+func WithTunnel(ctx context.Context) context.Context {
+	return context.WithValue(ctx, tunnelKey{}, true)
+}
+
+// FromTunnel reports whether a request context arrived through the tunnel
+func FromTunnel(ctx context.Context) bool {
+	v, _ := ctx.Value(tunnelKey{}).(bool)
+	return v
+}
@@ -0,0 +1,357 @@
+// Package tunnel maintains an outbound, authenticated WebSocket connection to
+// a management host and serves the agent's HTTP API over it, so agents behind
+// NAT can be managed without port forwarding.
+package tunnel
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/kpblcaoo/sboxagent/internal/config"
+	"github.com/kpblcaoo/sboxagent/internal/logger"
+)
+
+// maxBodySize limits request and response bodies carried over the tunnel
+const maxBodySize = 4 * 1024 * 1024
+
+// Request is an API request forwarded by the management host
+type Request struct {
+	ID      string            `json:"id"`
+	Method  string            `json:"method"`
+	Path    string            `json:"path"`
+	Headers map[string]string `json:"headers,omitempty"`
+	Body    []byte            `json:"body,omitempty"`
+}
+
+// Response is the agent's answer to a forwarded request
+type Response struct {
+	ID      string            `json:"id"`
+	Status  int               `json:"status"`
+	Headers map[string]string `json:"headers,omitempty"`
+	Body    []byte            `json:"body,omitempty"`
+}
+
+// Client maintains the reverse tunnel
+type Client struct {
+	config  config.TunnelConfig
+	handler http.Handler
+	logger  *logger.Logger
+	dialer  *websocket.Dialer
+
+	minBackoff time.Duration
+	maxBackoff time.Duration
+
+	// State
+	mu            sync.RWMutex
+	running       bool
+	connected     bool
+	connectedAt   time.Time
+	lastError     error
+	reconnects    int64
+	requestsTotal int64
+
+	// Context for graceful shutdown
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+// NewClient creates a tunnel client that serves requests with handler
+func NewClient(cfg config.TunnelConfig, handler http.Handler, log *logger.Logger) (*Client, error) {
+	u, err := url.Parse(cfg.URL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid tunnel url: %w", err)
+	}
+	if u.Scheme != "wss" {
+		return nil, fmt.Errorf("tunnel url must use wss://, got %q", u.Scheme)
+	}
+	if cfg.Token == "" {
+		return nil, fmt.Errorf("tunnel token is required")
+	}
+
+	if cfg.ReconnectInterval <= 0 || cfg.MaxReconnectInterval < cfg.ReconnectInterval {
+		return nil, fmt.Errorf("invalid tunnel reconnect interval: %s (max %s)", cfg.ReconnectInterval, cfg.MaxReconnectInterval)
+	}
+
+	tlsConfig := &tls.Config{MinVersion: tls.VersionTLS12}
+	if cfg.CAFile != "" {
+		pem, err := os.ReadFile(cfg.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read tunnel ca file: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in tunnel ca file")
+		}
+		tlsConfig.RootCAs = pool
+	}
+
+	return &Client{
+		config:     cfg,
+		handler:    handler,
+		logger:     log,
+		minBackoff: cfg.ReconnectInterval,
+		maxBackoff: cfg.MaxReconnectInterval,
+		dialer: &websocket.Dialer{
+			TLSClientConfig:  tlsConfig,
+			HandshakeTimeout: 15 * time.Second,
+		},
+	}, nil
+}
+
+// Start starts maintaining the tunnel in the background
+func (c *Client) Start(ctx context.Context) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.running {
+		return fmt.Errorf("tunnel is already running")
+	}
+
+	c.ctx, c.cancel = context.WithCancel(ctx)
+	c.running = true
+
+	c.logger.Info("Management tunnel starting", map[string]interface{}{
+		"url":     c.config.URL,
+		"agentId": c.config.AgentID,
+	})
+
+	c.wg.Add(1)
+	go c.run()
+
+	return nil
+}
+
+// Stop closes the tunnel and waits for the connection loop to exit
+func (c *Client) Stop() {
+	c.mu.Lock()
+	if !c.running {
+		c.mu.Unlock()
+		return
+	}
+	c.cancel()
+	c.mu.Unlock()
+
+	c.wg.Wait()
+
+	c.mu.Lock()
+	c.running = false
+	c.mu.Unlock()
+
+	c.logger.Info("Management tunnel stopped", map[string]interface{}{})
+}
+
+// run connects and reconnects with exponential backoff until stopped
+func (c *Client) run() {
+	defer c.wg.Done()
+
+	backoff := c.minBackoff
+	for {
+		start := time.Now()
+		err := c.connectAndServe()
+
+		c.mu.Lock()
+		c.connected = false
+		c.lastError = err
+		c.mu.Unlock()
+
+		if c.ctx.Err() != nil {
+			return
+		}
+
+		// Reset backoff after a connection that stayed up for a while
+		if time.Since(start) > c.maxBackoff {
+			backoff = c.minBackoff
+		}
+
+		c.logger.Warn("Management tunnel disconnected", map[string]interface{}{
+			"error":   fmt.Sprint(err),
+			"retryIn": backoff.String(),
+		})
+
+		select {
+		case <-c.ctx.Done():
+			return
+		case <-time.After(backoff):
+		}
+
+		c.mu.Lock()
+		c.reconnects++
+		c.mu.Unlock()
+
+		backoff *= 2
+		if backoff > c.maxBackoff {
+			backoff = c.maxBackoff
+		}
+	}
+}
+
+// connectAndServe dials the management host and serves requests until the
+// connection fails or the context is cancelled
+func (c *Client) connectAndServe() error {
+	header := http.Header{}
+	header.Set("Authorization", "Bearer "+c.config.Token)
+	header.Set("X-Agent-ID", c.config.AgentID)
+
+	conn, resp, err := c.dialer.DialContext(c.ctx, c.config.URL, header)
+	if err != nil {
+		if resp != nil {
+			return fmt.Errorf("tunnel handshake failed with status %d: %w", resp.StatusCode, err)
+		}
+		return fmt.Errorf("tunnel dial failed: %w", err)
+	}
+	defer conn.Close()
+	conn.SetReadLimit(maxBodySize * 2)
+
+	c.mu.Lock()
+	c.connected = true
+	c.connectedAt = time.Now()
+	c.lastError = nil
+	c.mu.Unlock()
+
+	c.logger.Info("Management tunnel connected", map[string]interface{}{
+		"url": c.config.URL,
+	})
+
+	// Close the connection when stopping to unblock ReadJSON
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-c.ctx.Done():
+			conn.WriteControl(websocket.CloseMessage,
+				websocket.FormatCloseMessage(websocket.CloseNormalClosure, "agent stopping"),
+				time.Now().Add(time.Second))
+			conn.Close()
+		case <-done:
+		}
+	}()
+
+	var writeMu sync.Mutex
+	for {
+		var req Request
+		if err := conn.ReadJSON(&req); err != nil {
+			return err
+		}
+
+		c.mu.Lock()
+		c.requestsTotal++
+		c.mu.Unlock()
+
+		go func(req Request) {
+			resp := c.serve(req)
+			writeMu.Lock()
+			defer writeMu.Unlock()
+			if err := conn.WriteJSON(resp); err != nil {
+				c.logger.Warn("Failed to write tunnel response", map[string]interface{}{
+					"id":    req.ID,
+					"error": err.Error(),
+				})
+			}
+		}(req)
+	}
+}
+
+// serve runs a forwarded request through the API handler
+func (c *Client) serve(req Request) Response {
+	if len(req.Body) > maxBodySize {
+		return Response{ID: req.ID, Status: http.StatusRequestEntityTooLarge}
+	}
+
+	httpReq, err := http.NewRequestWithContext(WithTunnel(c.ctx), req.Method, req.Path, bytes.NewReader(req.Body))
+	if err != nil {
+		return Response{ID: req.ID, Status: http.StatusBadRequest, Body: []byte(err.Error())}
+	}
+	for key, value := range req.Headers {
+		httpReq.Header.Set(key, value)
+	}
+	httpReq.RemoteAddr = "tunnel"
+
+	writer := newResponseBuffer()
+	c.handler.ServeHTTP(writer, httpReq)
+
+	headers := make(map[string]string, len(writer.header))
+	for key := range writer.header {
+		headers[key] = writer.header.Get(key)
+	}
+
+	return Response{
+		ID:      req.ID,
+		Status:  writer.status,
+		Headers: headers,
+		Body:    writer.body.Bytes(),
+	}
+}
+
+// GetStatus returns the current tunnel status
+func (c *Client) GetStatus() map[string]interface{} {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	status := map[string]interface{}{
+		"running":       c.running,
+		"connected":     c.connected,
+		"url":           c.config.URL,
+		"reconnects":    c.reconnects,
+		"requestsTotal": c.requestsTotal,
+	}
+	if c.connected {
+		status["connectedAt"] = c.connectedAt
+	}
+	if c.lastError != nil {
+		status["lastError"] = c.lastError.Error()
+	}
+	return status
+}
+
+// IsConnected reports whether the tunnel is currently connected
+func (c *Client) IsConnected() bool {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.connected
+}
+
+// responseBuffer is an in-memory http.ResponseWriter
+type responseBuffer struct {
+	header      http.Header
+	body        bytes.Buffer
+	status      int
+	wroteHeader bool
+}
+
+func newResponseBuffer() *responseBuffer {
+	return &responseBuffer{header: make(http.Header), status: http.StatusOK}
+}
+
+// Header returns the response headers
+func (b *responseBuffer) Header() http.Header {
+	return b.header
+}
+
+// Write buffers the response body up to maxBodySize
+func (b *responseBuffer) Write(p []byte) (int, error) {
+	b.wroteHeader = true
+	if b.body.Len()+len(p) > maxBodySize {
+		return 0, io.ErrShortWrite
+	}
+	return b.body.Write(p)
+}
+
+// WriteHeader records the status code
+func (b *responseBuffer) WriteHeader(status int) {
+	if b.wroteHeader {
+		return
+	}
+	b.wroteHeader = true
+	b.status = status
+}
@@ -0,0 +1,150 @@
+package tunnel
+
+import (
+	"context"
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/kpblcaoo/sboxagent/internal/config"
+	"github.com/kpblcaoo/sboxagent/internal/logger"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func testConfig(url string) config.TunnelConfig {
+	return config.TunnelConfig{
+		Enabled:              true,
+		URL:                  url,
+		Token:                "tunnel-secret",
+		AgentID:              "test-agent",
+		ReconnectInterval:    50 * time.Millisecond,
+		MaxReconnectInterval: 200 * time.Millisecond,
+	}
+}
+
+func TestNewClient_Validation(t *testing.T) {
+	log, err := logger.New("error")
+	require.NoError(t, err)
+
+	cfg := testConfig("ws://manager.example.com/connect")
+	_, err = NewClient(cfg, http.NotFoundHandler(), log)
+	assert.ErrorContains(t, err, "wss://")
+
+	cfg = testConfig("wss://manager.example.com/connect")
+	cfg.Token = ""
+	_, err = NewClient(cfg, http.NotFoundHandler(), log)
+	assert.ErrorContains(t, err, "token is required")
+
+	cfg = testConfig("wss://manager.example.com/connect")
+	cfg.ReconnectInterval = 0
+	_, err = NewClient(cfg, http.NotFoundHandler(), log)
+	assert.ErrorContains(t, err, "reconnect interval")
+
+	_, err = NewClient(testConfig("wss://manager.example.com/connect"), http.NotFoundHandler(), log)
+	assert.NoError(t, err)
+}
+
+func TestClient_ServesRequestsOverTunnel(t *testing.T) {
+	log, err := logger.New("error")
+	require.NoError(t, err)
+
+	responses := make(chan Response, 1)
+	upgrader := websocket.Upgrader{}
+	manager := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer tunnel-secret" || r.Header.Get("X-Agent-ID") != "test-agent" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+
+		require.NoError(t, conn.WriteJSON(Request{
+			ID:      "req-1",
+			Method:  http.MethodGet,
+			Path:    "/status",
+			Headers: map[string]string{"Authorization": "Bearer api-token"},
+		}))
+
+		var resp Response
+		if err := conn.ReadJSON(&resp); err == nil {
+			responses <- resp
+		}
+		// Keep the connection open until the client goes away
+		conn.ReadMessage()
+	}))
+	defer manager.Close()
+
+	// Trust the test server certificate
+	caFile := filepath.Join(t.TempDir(), "ca.pem")
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: manager.Certificate().Raw})
+	require.NoError(t, os.WriteFile(caFile, certPEM, 0644))
+
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.True(t, FromTunnel(r.Context()))
+		assert.Equal(t, "Bearer api-token", r.Header.Get("Authorization"))
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusAccepted)
+		w.Write([]byte(`{"path":"` + r.URL.Path + `"}`))
+	})
+
+	cfg := testConfig("wss" + strings.TrimPrefix(manager.URL, "https"))
+	cfg.CAFile = caFile
+	client, err := NewClient(cfg, handler, log)
+	require.NoError(t, err)
+
+	require.NoError(t, client.Start(context.Background()))
+	defer client.Stop()
+
+	select {
+	case resp := <-responses:
+		assert.Equal(t, "req-1", resp.ID)
+		assert.Equal(t, http.StatusAccepted, resp.Status)
+		assert.Equal(t, "application/json", resp.Headers["Content-Type"])
+		assert.JSONEq(t, `{"path":"/status"}`, string(resp.Body))
+	case <-time.After(5 * time.Second):
+		t.Fatal("no response received over tunnel")
+	}
+
+	assert.True(t, client.IsConnected())
+	status := client.GetStatus()
+	assert.Equal(t, int64(1), status["requestsTotal"])
+}
+
+func TestClient_RejectedHandshakeReconnects(t *testing.T) {
+	log, err := logger.New("error")
+	require.NoError(t, err)
+
+	manager := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusUnauthorized)
+	}))
+	defer manager.Close()
+
+	caFile := filepath.Join(t.TempDir(), "ca.pem")
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: manager.Certificate().Raw})
+	require.NoError(t, os.WriteFile(caFile, certPEM, 0644))
+
+	cfg := testConfig("wss" + strings.TrimPrefix(manager.URL, "https"))
+	cfg.CAFile = caFile
+	client, err := NewClient(cfg, http.NotFoundHandler(), log)
+	require.NoError(t, err)
+
+	require.NoError(t, client.Start(context.Background()))
+	assert.Eventually(t, func() bool {
+		return client.GetStatus()["reconnects"].(int64) >= 2
+	}, 5*time.Second, 20*time.Millisecond)
+	client.Stop()
+
+	status := client.GetStatus()
+	assert.False(t, status["connected"].(bool))
+	assert.Contains(t, status["lastError"], "401")
+}
@@ -0,0 +1,142 @@
+package upgrade
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// Install downloads a release archive, verifies it and replaces the binary
+// at binaryPath with the client binary from the archive. The new binary is
+// written next to the old one and renamed over it, so the client never
+// sees a partly written file.
+func (u *Upgrader) Install(ctx context.Context, release *Release, binaryPath string) error {
+	archive, err := u.get(ctx, release.URL, maxArchiveSize)
+	if err != nil {
+		return fmt.Errorf("failed to download %s: %w", release.Asset, err)
+	}
+	if err := verifyChecksum(archive, release.Checksum); err != nil {
+		return fmt.Errorf("refusing %s: %w", release.Asset, err)
+	}
+	if err := u.verifySignature(ctx, release, archive); err != nil {
+		return fmt.Errorf("refusing %s: %w", release.Asset, err)
+	}
+
+	name := binaryName(release.Client, u.opts.GOOS)
+	binary, err := extract(release.Asset, archive, name)
+	if err != nil {
+		return fmt.Errorf("failed to extract %s from %s: %w", name, release.Asset, err)
+	}
+	if err := replaceFile(binaryPath, binary); err != nil {
+		return fmt.Errorf("failed to install %s: %w", binaryPath, err)
+	}
+	return nil
+}
+
+// verifyChecksum compares the archive with a "sha256:<hex>" checksum; an
+// empty checksum is not checked
+func verifyChecksum(archive []byte, checksum string) error {
+	if checksum == "" {
+		return nil
+	}
+	expected, ok := strings.CutPrefix(checksum, "sha256:")
+	if !ok {
+		return fmt.Errorf("unsupported checksum %q", checksum)
+	}
+	sum := sha256.Sum256(archive)
+	if actual := hex.EncodeToString(sum[:]); actual != strings.ToLower(expected) {
+		return fmt.Errorf("checksum mismatch: expected %s, got sha256:%s", checksum, actual)
+	}
+	return nil
+}
+
+// binaryName is the file name of a client binary in its release archives
+func binaryName(client, goos string) string {
+	if goos == "windows" {
+		return client + ".exe"
+	}
+	return client
+}
+
+// extract returns the file named name from a .tar.gz or .zip archive, in
+// any directory of it
+func extract(asset string, archive []byte, name string) ([]byte, error) {
+	if strings.HasSuffix(asset, ".zip") {
+		reader, err := zip.NewReader(bytes.NewReader(archive), int64(len(archive)))
+		if err != nil {
+			return nil, err
+		}
+		for _, file := range reader.File {
+			if path.Base(file.Name) != name || file.FileInfo().IsDir() {
+				continue
+			}
+			rc, err := file.Open()
+			if err != nil {
+				return nil, err
+			}
+			defer rc.Close()
+			return io.ReadAll(io.LimitReader(rc, maxArchiveSize))
+		}
+		return nil, fmt.Errorf("%s not found in archive", name)
+	}
+
+	gz, err := gzip.NewReader(bytes.NewReader(archive))
+	if err != nil {
+		return nil, err
+	}
+	defer gz.Close()
+	reader := tar.NewReader(gz)
+	for {
+		header, err := reader.Next()
+		if errors.Is(err, io.EOF) {
+			return nil, fmt.Errorf("%s not found in archive", name)
+		}
+		if err != nil {
+			return nil, err
+		}
+		if header.Typeflag == tar.TypeReg && path.Base(header.Name) == name {
+			return io.ReadAll(io.LimitReader(reader, maxArchiveSize))
+		}
+	}
+}
+
+// replaceFile writes data to an executable temporary file next to target
+// and renames it over target
+func replaceFile(target string, data []byte) error {
+	dir := filepath.Dir(target)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(dir, "."+filepath.Base(target)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmp.Name(), 0755); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), target)
+}
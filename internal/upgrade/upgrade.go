@@ -0,0 +1,253 @@
+// Package upgrade downloads official client releases, verifies their
+// checksums and signatures and installs the client binaries atomically.
+package upgrade
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/ed25519"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"runtime"
+	"strings"
+)
+
+// DefaultAPIURL is the GitHub API the releases are looked up in
+const DefaultAPIURL = "https://api.github.com"
+
+// Size limits of downloads
+const (
+	maxMetadataSize = 4 * 1024 * 1024
+	maxArchiveSize  = 256 * 1024 * 1024
+)
+
+// ErrUnsupportedClient is returned for clients without official release
+// archives the upgrader knows
+var ErrUnsupportedClient = errors.New("client has no supported releases")
+
+// repos are the GitHub repositories of the clients' official releases
+var repos = map[string]string{
+	"sing-box": "SagerNet/sing-box",
+	"xray":     "XTLS/Xray-core",
+}
+
+// Clients returns the clients the upgrader can install
+func Clients() []string {
+	return []string{"sing-box", "xray"}
+}
+
+// Release is a client release archive for this platform
+type Release struct {
+	Client  string `json:"client"`
+	Version string `json:"version"`
+	Asset   string `json:"asset"`
+	URL     string `json:"url"`
+	// Checksum is "sha256:<hex>" of the archive, from the release metadata
+	// or the checksum file published with it; empty when neither has one
+	Checksum string `json:"checksum,omitempty"`
+	// SignatureURL is the detached signature of the archive, if published
+	SignatureURL string `json:"-"`
+}
+
+// Options configure the upgrader
+type Options struct {
+	// APIURL is the GitHub API base URL, DefaultAPIURL when empty
+	APIURL string
+	// HTTPClient downloads releases, http.DefaultClient when nil
+	HTTPClient *http.Client
+	// PublicKey, when set, requires a <asset>.sig ed25519 signature of
+	// the archive, raw or base64
+	PublicKey ed25519.PublicKey
+	// RequireChecksum refuses releases without a published checksum
+	RequireChecksum bool
+	// GOOS and GOARCH select the archive, the agent's platform when empty
+	GOOS   string
+	GOARCH string
+}
+
+// Upgrader finds and installs client releases
+type Upgrader struct {
+	opts Options
+}
+
+// New creates an upgrader
+func New(opts Options) *Upgrader {
+	if opts.APIURL == "" {
+		opts.APIURL = DefaultAPIURL
+	}
+	if opts.HTTPClient == nil {
+		opts.HTTPClient = http.DefaultClient
+	}
+	if opts.GOOS == "" {
+		opts.GOOS = runtime.GOOS
+	}
+	if opts.GOARCH == "" {
+		opts.GOARCH = runtime.GOARCH
+	}
+	return &Upgrader{opts: opts}
+}
+
+// githubRelease is the part of a GitHub release the upgrader reads
+type githubRelease struct {
+	TagName string `json:"tag_name"`
+	Assets  []struct {
+		Name   string `json:"name"`
+		URL    string `json:"browser_download_url"`
+		Digest string `json:"digest"`
+	} `json:"assets"`
+}
+
+// Resolve finds the release archive of a client for this platform. An
+// empty version or "latest" selects the latest release.
+func (u *Upgrader) Resolve(ctx context.Context, client, version string) (*Release, error) {
+	repo, ok := repos[client]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrUnsupportedClient, client)
+	}
+	endpoint := u.opts.APIURL + "/repos/" + repo + "/releases/latest"
+	if version != "" && version != "latest" {
+		endpoint = u.opts.APIURL + "/repos/" + repo + "/releases/tags/v" + url.PathEscape(strings.TrimPrefix(version, "v"))
+	}
+	data, err := u.get(ctx, endpoint, maxMetadataSize)
+	if err != nil {
+		return nil, fmt.Errorf("failed to look up %s release: %w", client, err)
+	}
+	var gh githubRelease
+	if err := json.Unmarshal(data, &gh); err != nil {
+		return nil, fmt.Errorf("failed to parse %s release: %w", client, err)
+	}
+
+	release := &Release{Client: client, Version: strings.TrimPrefix(gh.TagName, "v")}
+	name, err := assetName(client, release.Version, u.opts.GOOS, u.opts.GOARCH)
+	if err != nil {
+		return nil, err
+	}
+	assets := make(map[string]string, len(gh.Assets))
+	for _, asset := range gh.Assets {
+		assets[asset.Name] = asset.URL
+		if asset.Name == name {
+			release.Asset = name
+			release.URL = asset.URL
+			release.Checksum = asset.Digest
+		}
+	}
+	if release.URL == "" {
+		return nil, fmt.Errorf("%s %s has no %s archive", client, release.Version, name)
+	}
+	release.SignatureURL = assets[name+".sig"]
+
+	if release.Checksum == "" {
+		for _, suffix := range []string{".dgst", ".sha256", ".sha256sum"} {
+			if checksumURL, ok := assets[name+suffix]; ok {
+				data, err := u.get(ctx, checksumURL, maxMetadataSize)
+				if err != nil {
+					return nil, fmt.Errorf("failed to download %s checksum: %w", name, err)
+				}
+				if release.Checksum, err = parseChecksum(data); err != nil {
+					return nil, fmt.Errorf("failed to parse %s checksum: %w", name, err)
+				}
+				break
+			}
+		}
+	}
+	if release.Checksum == "" && u.opts.RequireChecksum {
+		return nil, fmt.Errorf("%s %s publishes no checksum for %s", client, release.Version, name)
+	}
+	return release, nil
+}
+
+// assetName returns the name of a client's release archive for a platform
+func assetName(client, version, goos, goarch string) (string, error) {
+	switch client {
+	case "sing-box":
+		arch := goarch
+		if goarch == "arm" {
+			arch = "armv7"
+		}
+		ext := ".tar.gz"
+		if goos == "windows" {
+			ext = ".zip"
+		}
+		return fmt.Sprintf("sing-box-%s-%s-%s%s", version, goos, arch, ext), nil
+	case "xray":
+		osName := map[string]string{"linux": "linux", "darwin": "macos", "windows": "windows", "freebsd": "freebsd"}[goos]
+		arch := map[string]string{"amd64": "64", "386": "32", "arm64": "arm64-v8a", "arm": "arm32-v7a"}[goarch]
+		if osName == "" || arch == "" {
+			return "", fmt.Errorf("xray publishes no release for %s/%s", goos, goarch)
+		}
+		return fmt.Sprintf("Xray-%s-%s.zip", osName, arch), nil
+	default:
+		return "", fmt.Errorf("%w: %s", ErrUnsupportedClient, client)
+	}
+}
+
+// parseChecksum reads the SHA-256 of a checksum file: a "SHA2-256= <hex>"
+// line as in Xray's .dgst files, or "<hex>  <name>" as written by sha256sum
+func parseChecksum(data []byte) (string, error) {
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if value, ok := strings.CutPrefix(line, "SHA2-256="); ok {
+			return "sha256:" + strings.ToLower(strings.TrimSpace(value)), nil
+		}
+		if fields := strings.Fields(line); len(fields) > 0 && len(fields[0]) == 64 {
+			return "sha256:" + strings.ToLower(fields[0]), nil
+		}
+	}
+	return "", fmt.Errorf("no sha256 checksum found")
+}
+
+// get downloads a URL, failing on non-200 responses and bodies over limit
+func (u *Upgrader) get(ctx context.Context, rawURL string, limit int64) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, rawURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := u.opts.HTTPClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%s returned status %d", rawURL, resp.StatusCode)
+	}
+	data, err := io.ReadAll(io.LimitReader(resp.Body, limit+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(data)) > limit {
+		return nil, fmt.Errorf("%s exceeds %d bytes", rawURL, limit)
+	}
+	return data, nil
+}
+
+// verifySignature checks the detached signature of an archive
+func (u *Upgrader) verifySignature(ctx context.Context, release *Release, archive []byte) error {
+	if u.opts.PublicKey == nil {
+		return nil
+	}
+	if release.SignatureURL == "" {
+		return fmt.Errorf("%s publishes no signature", release.Asset)
+	}
+	signature, err := u.get(ctx, release.SignatureURL, maxMetadataSize)
+	if err != nil {
+		return fmt.Errorf("failed to download signature: %w", err)
+	}
+	if len(signature) != ed25519.SignatureSize {
+		decoded, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(signature)))
+		if err != nil {
+			return fmt.Errorf("invalid signature encoding: %w", err)
+		}
+		signature = decoded
+	}
+	if !ed25519.Verify(u.opts.PublicKey, archive, signature) {
+		return fmt.Errorf("signature of %s does not match", release.Asset)
+	}
+	return nil
+}
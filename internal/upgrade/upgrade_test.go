@@ -0,0 +1,178 @@
+package upgrade
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// releaseServer serves GitHub releases with the given assets by file name
+type releaseServer struct {
+	*httptest.Server
+	tag    string
+	files  map[string][]byte
+	digest map[string]string
+}
+
+func newReleaseServer(t *testing.T, tag string) *releaseServer {
+	s := &releaseServer{tag: tag, files: make(map[string][]byte), digest: make(map[string]string)}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/repos/SagerNet/sing-box/releases/latest", "/repos/XTLS/Xray-core/releases/tags/" + tag:
+			type asset struct {
+				Name   string `json:"name"`
+				URL    string `json:"browser_download_url"`
+				Digest string `json:"digest,omitempty"`
+			}
+			release := struct {
+				TagName string  `json:"tag_name"`
+				Assets  []asset `json:"assets"`
+			}{TagName: tag}
+			for name := range s.files {
+				release.Assets = append(release.Assets, asset{Name: name, URL: s.URL + "/download/" + name, Digest: s.digest[name]})
+			}
+			json.NewEncoder(w).Encode(release)
+		default:
+			data, ok := s.files[filepath.Base(r.URL.Path)]
+			if !ok {
+				http.NotFound(w, r)
+				return
+			}
+			w.Write(data)
+		}
+	}))
+	t.Cleanup(s.Close)
+	return s
+}
+
+func tarGz(t *testing.T, name string, data []byte) []byte {
+	var b bytes.Buffer
+	gz := gzip.NewWriter(&b)
+	tw := tar.NewWriter(gz)
+	require.NoError(t, tw.WriteHeader(&tar.Header{Name: name, Mode: 0755, Size: int64(len(data)), Typeflag: tar.TypeReg}))
+	_, err := tw.Write(data)
+	require.NoError(t, err)
+	require.NoError(t, tw.Close())
+	require.NoError(t, gz.Close())
+	return b.Bytes()
+}
+
+func zipped(t *testing.T, name string, data []byte) []byte {
+	var b bytes.Buffer
+	zw := zip.NewWriter(&b)
+	w, err := zw.Create(name)
+	require.NoError(t, err)
+	_, err = w.Write(data)
+	require.NoError(t, err)
+	require.NoError(t, zw.Close())
+	return b.Bytes()
+}
+
+func sha256Hex(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+func TestUpgrader_SingBox(t *testing.T) {
+	server := newReleaseServer(t, "v1.12.0")
+	archive := tarGz(t, "sing-box-1.12.0-linux-amd64/sing-box", []byte("new sing-box"))
+	server.files["sing-box-1.12.0-linux-amd64.tar.gz"] = archive
+	server.digest["sing-box-1.12.0-linux-amd64.tar.gz"] = "sha256:" + sha256Hex(archive)
+	server.files["sing-box-1.12.0-linux-arm64.tar.gz"] = []byte("other platform")
+
+	u := New(Options{APIURL: server.URL, RequireChecksum: true, GOOS: "linux", GOARCH: "amd64"})
+	release, err := u.Resolve(context.Background(), "sing-box", "latest")
+	require.NoError(t, err)
+	assert.Equal(t, "1.12.0", release.Version)
+	assert.Equal(t, "sing-box-1.12.0-linux-amd64.tar.gz", release.Asset)
+	assert.Equal(t, "sha256:"+sha256Hex(archive), release.Checksum)
+
+	binary := filepath.Join(t.TempDir(), "bin", "sing-box")
+	require.NoError(t, os.MkdirAll(filepath.Dir(binary), 0755))
+	require.NoError(t, os.WriteFile(binary, []byte("old sing-box"), 0755))
+	require.NoError(t, u.Install(context.Background(), release, binary))
+
+	data, err := os.ReadFile(binary)
+	require.NoError(t, err)
+	assert.Equal(t, "new sing-box", string(data))
+	info, err := os.Stat(binary)
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0755), info.Mode().Perm())
+	entries, err := os.ReadDir(filepath.Dir(binary))
+	require.NoError(t, err)
+	assert.Len(t, entries, 1, "no temporary files are left behind")
+
+	// A tampered archive is refused and the binary kept
+	release.Checksum = "sha256:" + sha256Hex([]byte("something else"))
+	err = u.Install(context.Background(), release, binary)
+	assert.ErrorContains(t, err, "checksum mismatch")
+	data, err = os.ReadFile(binary)
+	require.NoError(t, err)
+	assert.Equal(t, "new sing-box", string(data))
+}
+
+func TestUpgrader_XrayChecksumFile(t *testing.T) {
+	server := newReleaseServer(t, "v25.1.1")
+	archive := zipped(t, "xray", []byte("new xray"))
+	server.files["Xray-linux-arm64-v8a.zip"] = archive
+	server.files["Xray-linux-arm64-v8a.zip.dgst"] = []byte("MD5= 00\nSHA2-256= " + sha256Hex(archive) + "\n")
+
+	u := New(Options{APIURL: server.URL, RequireChecksum: true, GOOS: "linux", GOARCH: "arm64"})
+	release, err := u.Resolve(context.Background(), "xray", "25.1.1")
+	require.NoError(t, err)
+	assert.Equal(t, "sha256:"+sha256Hex(archive), release.Checksum)
+
+	binary := filepath.Join(t.TempDir(), "xray")
+	require.NoError(t, u.Install(context.Background(), release, binary))
+	data, err := os.ReadFile(binary)
+	require.NoError(t, err)
+	assert.Equal(t, "new xray", string(data))
+}
+
+func TestUpgrader_Refusals(t *testing.T) {
+	server := newReleaseServer(t, "v1.12.0")
+	archive := tarGz(t, "sing-box", []byte("new sing-box"))
+	server.files["sing-box-1.12.0-linux-amd64.tar.gz"] = archive
+
+	_, err := New(Options{APIURL: server.URL, RequireChecksum: true, GOOS: "linux", GOARCH: "amd64"}).Resolve(context.Background(), "sing-box", "")
+	assert.EqualError(t, err, "sing-box 1.12.0 publishes no checksum for sing-box-1.12.0-linux-amd64.tar.gz")
+
+	_, err = New(Options{APIURL: server.URL, GOOS: "linux", GOARCH: "mips"}).Resolve(context.Background(), "sing-box", "")
+	assert.EqualError(t, err, "sing-box 1.12.0 has no sing-box-1.12.0-linux-mips.tar.gz archive")
+
+	_, err = New(Options{APIURL: server.URL}).Resolve(context.Background(), "clash", "")
+	assert.ErrorIs(t, err, ErrUnsupportedClient)
+
+	// Signatures are required once a public key is configured
+	public, private, err := ed25519.GenerateKey(nil)
+	require.NoError(t, err)
+	u := New(Options{APIURL: server.URL, PublicKey: public, GOOS: "linux", GOARCH: "amd64"})
+	release, err := u.Resolve(context.Background(), "sing-box", "")
+	require.NoError(t, err)
+	binary := filepath.Join(t.TempDir(), "sing-box")
+	assert.ErrorContains(t, u.Install(context.Background(), release, binary), "publishes no signature")
+
+	server.files["sing-box-1.12.0-linux-amd64.tar.gz.sig"] = ed25519.Sign(private, []byte("other"))
+	release, err = u.Resolve(context.Background(), "sing-box", "")
+	require.NoError(t, err)
+	assert.ErrorContains(t, u.Install(context.Background(), release, binary), "signature of sing-box-1.12.0-linux-amd64.tar.gz does not match")
+
+	server.files["sing-box-1.12.0-linux-amd64.tar.gz.sig"] = ed25519.Sign(private, archive)
+	require.NoError(t, u.Install(context.Background(), release, binary))
+	_, err = os.Stat(binary)
+	assert.NoError(t, err)
+}
@@ -0,0 +1,76 @@
+#!/bin/bash
+
+# SboxAgent benchmark comparison
+#
+# Runs the hot path benchmarks and compares them with the stored baseline.
+#   bench-compare.sh          compare with bench/baseline.txt
+#   bench-compare.sh --save   store the current run as the new baseline
+#
+# BENCH_COUNT sets the runs per benchmark (default 5) and BENCH_THRESHOLD the
+# allowed slowdown in percent (default 20). Exits 1 on a regression.
+
+set -e
+
+PACKAGES="./internal/socket ./internal/dispatcher ./internal/aggregator ./internal/logger"
+BASELINE="bench/baseline.txt"
+CURRENT="bench_output.txt"
+COUNT="${BENCH_COUNT:-5}"
+THRESHOLD="${BENCH_THRESHOLD:-20}"
+
+echo "Running benchmarks (count=$COUNT)..."
+go test -run '^$' -bench . -benchmem -count "$COUNT" $PACKAGES > "$CURRENT"
+
+if [[ "$1" == "--save" ]]; then
+    mkdir -p "$(dirname "$BASELINE")"
+    cp "$CURRENT" "$BASELINE"
+    echo "Baseline saved: $BASELINE"
+    exit 0
+fi
+
+if [[ ! -f "$BASELINE" ]]; then
+    echo "No baseline at $BASELINE, run 'make bench-baseline' first"
+    exit 1
+fi
+
+if command -v benchstat >/dev/null 2>&1; then
+    benchstat "$BASELINE" "$CURRENT"
+fi
+
+# Compare mean ns/op per benchmark, ignoring the GOMAXPROCS suffix
+awk -v threshold="$THRESHOLD" '
+    /^Benchmark/ {
+        name = $1
+        sub(/-[0-9]+$/, "", name)
+        for (i = 3; i < NF; i++) {
+            if ($(i + 1) == "ns/op") {
+                sum[FILENAME, name] += $i
+                runs[FILENAME, name]++
+            }
+        }
+        if (FILENAME == ARGV[1]) {
+            names[name] = 1
+        }
+    }
+    END {
+        failed = 0
+        for (name in names) {
+            if (!runs[ARGV[2], name]) {
+                continue
+            }
+            base = sum[ARGV[1], name] / runs[ARGV[1], name]
+            cur = sum[ARGV[2], name] / runs[ARGV[2], name]
+            change = base > 0 ? (cur - base) / base * 100 : 0
+            status = "ok"
+            if (change > threshold) {
+                status = "REGRESSION"
+                failed = 1
+            }
+            printf "%-45s %12.1f -> %12.1f ns/op %+7.1f%% %s\n", name, base, cur, change, status
+        }
+        exit failed
+    }
+' "$BASELINE" "$CURRENT" || {
+    echo "Benchmarks regressed by more than ${THRESHOLD}%"
+    exit 1
+}
+echo "No benchmark regressed by more than ${THRESHOLD}%"
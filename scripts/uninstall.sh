@@ -24,6 +24,16 @@ if [[ $EUID -ne 0 ]]; then
    exit 1
 fi
 
+# Let the agent remove its unit, socket and state
+if [ -x $INSTALL_DIR/$BINARY_NAME ]; then
+    echo -e "${YELLOW}Removing agent unit and state...${NC}"
+    if [ -f $CONFIG_DIR/agent.yaml ]; then
+        $INSTALL_DIR/$BINARY_NAME -config $CONFIG_DIR/agent.yaml -uninstall || true
+    else
+        $INSTALL_DIR/$BINARY_NAME -uninstall || true
+    fi
+fi
+
 # Stop and disable service
 if systemctl is-active --quiet sboxagent.service; then
     echo -e "${YELLOW}Stopping service...${NC}"
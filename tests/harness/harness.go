@@ -0,0 +1,332 @@
+// Package harness boots a complete agent in-process against temporary
+// directories and drives it over its socket, for integration tests that do
+// not depend on a prebuilt binary or real client executables.
+package harness
+
+import (
+	"context"
+	"io"
+	"log"
+	"net"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/kpblcaoo/sboxagent/internal/agent"
+	"github.com/kpblcaoo/sboxagent/internal/config"
+	"github.com/kpblcaoo/sboxagent/internal/socket"
+)
+
+// DefaultTimeout bounds waits for requests, events and state changes
+const DefaultTimeout = 5 * time.Second
+
+// volatileStatusKeys are removed from status snapshots because they change
+// between runs
+var volatileStatusKeys = map[string]bool{
+	"startTime":   true,
+	"uptime":      true,
+	"lastRun":     true,
+	"connectedAt": true,
+	"metrics":     true,
+}
+
+// Harness runs one agent instance for a test
+type Harness struct {
+	t          testing.TB
+	Dir        string
+	BinDir     string
+	ConfigPath string
+	SocketPath string
+
+	Config *config.Config
+	Agent  *agent.Agent
+	Server *socket.Server
+
+	cancel    context.CancelFunc
+	agentDone chan error
+
+	conn      net.Conn
+	mu        sync.Mutex
+	responses map[string]chan *socket.Message
+	events    chan *socket.Message
+}
+
+// New prepares a harness in a temp dir. Write the config with WriteConfig and
+// add fake binaries with FakeBinary before calling Start.
+func New(t testing.TB) *Harness {
+	t.Helper()
+
+	dir := t.TempDir()
+	h := &Harness{
+		t:          t,
+		Dir:        dir,
+		BinDir:     filepath.Join(dir, "bin"),
+		ConfigPath: filepath.Join(dir, "agent.yaml"),
+		SocketPath: filepath.Join(dir, "agent.sock"),
+		responses:  make(map[string]chan *socket.Message),
+		events:     make(chan *socket.Message, 100),
+	}
+
+	if err := os.MkdirAll(h.BinDir, 0755); err != nil {
+		t.Fatalf("failed to create bin dir: %v", err)
+	}
+
+	// Tests may run in containers, where the agent would supervise the
+	// clients itself
+	t.Setenv("SBOXAGENT_SUPERVISOR_MODE", "off")
+
+	return h
+}
+
+// WriteConfig writes agent.yaml
+func (h *Harness) WriteConfig(configYAML string) {
+	h.t.Helper()
+
+	if err := os.WriteFile(h.ConfigPath, []byte(configYAML), 0644); err != nil {
+		h.t.Fatalf("failed to write config: %v", err)
+	}
+}
+
+// FakeBinary writes an executable shell script to the harness bin dir and
+// returns its path
+func (h *Harness) FakeBinary(name, script string) string {
+	h.t.Helper()
+
+	path := filepath.Join(h.BinDir, name)
+	content := "#!/bin/sh\n" + script + "\n"
+	if err := os.WriteFile(path, []byte(content), 0755); err != nil {
+		h.t.Fatalf("failed to write fake binary %s: %v", name, err)
+	}
+	return path
+}
+
+// Path returns a path inside the harness directory
+func (h *Harness) Path(elem ...string) string {
+	return filepath.Join(append([]string{h.Dir}, elem...)...)
+}
+
+// Start loads the config, boots the socket server, connects a client and then
+// starts the agent, so no early events are missed. The agent is stopped
+// automatically when the test ends.
+func (h *Harness) Start() {
+	h.t.Helper()
+
+	cfg, err := config.Load(h.ConfigPath)
+	if err != nil {
+		h.t.Fatalf("failed to load configuration: %v", err)
+	}
+	h.Config = cfg
+
+	a, err := agent.New(cfg)
+	if err != nil {
+		h.t.Fatalf("failed to create agent: %v", err)
+	}
+	h.Agent = a
+
+	h.Server = socket.NewServer(h.SocketPath, log.New(io.Discard, "", 0))
+	a.AttachSocket(h.Server)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	h.cancel = cancel
+	h.agentDone = make(chan error, 1)
+
+	go h.Server.Start(ctx)
+	h.t.Cleanup(h.Stop)
+	h.connect()
+	h.WaitFor("client registered", func() bool { return h.Server.ClientCount() > 0 })
+
+	go func() { h.agentDone <- a.Start(ctx) }()
+	h.WaitFor("agent running", a.IsRunning)
+}
+
+// Stop shuts down the agent and waits for it to exit
+func (h *Harness) Stop() {
+	if h.cancel == nil {
+		return
+	}
+	h.cancel()
+	h.cancel = nil
+
+	if h.conn != nil {
+		h.conn.Close()
+	}
+	h.Server.Stop()
+
+	if h.agentDone == nil {
+		return
+	}
+	select {
+	case err := <-h.agentDone:
+		if err != nil {
+			h.t.Errorf("agent exited with error: %v", err)
+		}
+	case <-time.After(DefaultTimeout):
+		h.t.Errorf("agent did not stop within %s", DefaultTimeout)
+	}
+}
+
+// connect dials the socket, retrying until the server is listening
+func (h *Harness) connect() {
+	h.t.Helper()
+
+	deadline := time.Now().Add(DefaultTimeout)
+	for {
+		conn, err := net.Dial("unix", h.SocketPath)
+		if err == nil {
+			h.conn = conn
+			go h.readLoop(conn)
+			return
+		}
+		if time.Now().After(deadline) {
+			h.t.Fatalf("failed to connect to agent socket: %v", err)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// readLoop routes responses to waiting requests and everything else to the
+// event queue
+func (h *Harness) readLoop(conn net.Conn) {
+	for {
+		msg, err := socket.ReadMessage(conn)
+		if err != nil {
+			return
+		}
+
+		if msg.Response != nil {
+			h.mu.Lock()
+			ch, ok := h.responses[msg.Response.RequestID]
+			delete(h.responses, msg.Response.RequestID)
+			h.mu.Unlock()
+			if ok {
+				ch <- msg
+				continue
+			}
+		}
+
+		select {
+		case h.events <- msg:
+		default:
+		}
+	}
+}
+
+// Request sends a command and waits for its response
+func (h *Harness) Request(command string, params map[string]interface{}) *socket.ResponseMessage {
+	h.t.Helper()
+
+	msg := socket.NewCommandMessage(command, params)
+	ch := make(chan *socket.Message, 1)
+
+	h.mu.Lock()
+	h.responses[msg.ID] = ch
+	h.mu.Unlock()
+
+	if err := socket.WriteMessage(h.conn, msg); err != nil {
+		h.t.Fatalf("failed to send %s: %v", command, err)
+	}
+
+	select {
+	case reply := <-ch:
+		return reply.Response
+	case <-time.After(DefaultTimeout):
+		h.t.Fatalf("no response to %s within %s", command, DefaultTimeout)
+		return nil
+	}
+}
+
+// WaitForEvent returns the first event matching match, discarding others
+func (h *Harness) WaitForEvent(match func(event map[string]interface{}) bool) map[string]interface{} {
+	h.t.Helper()
+
+	timeout := time.After(DefaultTimeout)
+	for {
+		select {
+		case msg := <-h.events:
+			if msg.Event != nil && match(msg.Event.Event) {
+				return msg.Event.Event
+			}
+		case <-timeout:
+			h.t.Fatalf("no matching event within %s", DefaultTimeout)
+			return nil
+		}
+	}
+}
+
+// WaitForHeartbeat returns the next heartbeat message, discarding events
+func (h *Harness) WaitForHeartbeat() *socket.Message {
+	h.t.Helper()
+
+	timeout := time.After(DefaultTimeout)
+	for {
+		select {
+		case msg := <-h.events:
+			if msg.Heartbeat != nil {
+				return msg
+			}
+		case <-timeout:
+			h.t.Fatalf("no heartbeat within %s", DefaultTimeout)
+			return nil
+		}
+	}
+}
+
+// ExpectNoEvent fails if any event arrives within d
+func (h *Harness) ExpectNoEvent(d time.Duration) {
+	h.t.Helper()
+
+	select {
+	case msg := <-h.events:
+		h.t.Fatalf("unexpected message: %+v", msg)
+	case <-time.After(d):
+	}
+}
+
+// WaitFor polls cond until it is true
+func (h *Harness) WaitFor(what string, cond func() bool) {
+	h.t.Helper()
+
+	deadline := time.Now().Add(DefaultTimeout)
+	for !cond() {
+		if time.Now().After(deadline) {
+			h.t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// Status requests the agent status over the socket
+func (h *Harness) Status() map[string]interface{} {
+	h.t.Helper()
+
+	resp := h.Request("status", nil)
+	if resp.Status != "success" {
+		h.t.Fatalf("status request failed: %+v", resp.Error)
+	}
+	return resp.Data
+}
+
+// StatusSnapshot returns the agent status with volatile fields removed, so it
+// can be compared with an expected snapshot
+func (h *Harness) StatusSnapshot() map[string]interface{} {
+	h.t.Helper()
+	return stripVolatile(h.Status()).(map[string]interface{})
+}
+
+// stripVolatile removes time-dependent keys from nested status maps
+func stripVolatile(value interface{}) interface{} {
+	m, ok := value.(map[string]interface{})
+	if !ok {
+		return value
+	}
+	out := make(map[string]interface{}, len(m))
+	for key, v := range m {
+		if volatileStatusKeys[key] {
+			continue
+		}
+		out[key] = stripVolatile(v)
+	}
+	return out
+}
@@ -1,45 +1,22 @@
 package integration
 
 import (
-	"os/exec"
 	"os"
+	"strings"
 	"testing"
 	"time"
-	"io/ioutil"
-	"path/filepath"
 
-	"github.com/stretchr/testify/require"
+	"github.com/kpblcaoo/sboxagent/internal/config"
+	"github.com/kpblcaoo/sboxagent/tests/harness"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
-func TestAgent_Integration_MockSboxctl(t *testing.T) {
-	tempDir, err := ioutil.TempDir("", "agent_integration_test")
-	require.NoError(t, err)
-	defer os.RemoveAll(tempDir)
-
-	configPath := filepath.Join(tempDir, "agent.yaml")
-	logPath := filepath.Join(tempDir, "agent.log")
-
-	configContent := `
+const baseConfig = `
 agent:
   name: "integration-test"
   version: "0.1.0"
-  log_level: "debug"
-server:
-  port: 8080
-  host: "127.0.0.1"
-  timeout: "30s"
-services:
-  sboxctl:
-    enabled: true
-    command:
-      - echo
-      - '{"type":"LOG","data":{"level":"info","message":"IntegrationTest"},"timestamp":"2025-06-27T16:30:00Z","version":"1.0"}'
-    interval: "1m"
-    timeout: "10s"
-    stdout_capture: true
-    health_check:
-      enabled: false
+  log_level: "error"
 logging:
   stdout_capture: true
   aggregation: true
@@ -49,59 +26,45 @@ security:
   allow_remote_api: false
   api_token: "test-token"
   allowed_hosts: ["127.0.0.1"]
-  tls_enabled: false
 `
 
-	require.NoError(t, os.WriteFile(configPath, []byte(configContent), 0644))
-
-	sboxagentPath := "./sboxagent"
-	if _, err := os.Stat(sboxagentPath); os.IsNotExist(err) {
-		// Автоматически собираем бинарник если его нет
-		buildCmd := exec.Command("go", "build", "-o", sboxagentPath, "../../cmd/sboxagent")
-		buildCmd.Dir = "."
-		if err := buildCmd.Run(); err != nil {
-			t.Skipf("Failed to build sboxagent binary: %v", err)
-		}
-	}
-
-	cmd := exec.Command(sboxagentPath, "-config", configPath, "-debug")
-	logFile, err := os.Create(logPath)
-	require.NoError(t, err)
-	defer logFile.Close()
-	cmd.Stdout = logFile
-	cmd.Stderr = logFile
-
-	// Запускаем агент (он выполнит echo и завершится по таймауту)
-	err = cmd.Start()
-	require.NoError(t, err)
-
-	// Ждём немного, чтобы агент успел обработать событие
-	time.Sleep(2 * time.Second)
-
-	// Завершаем процесс
-	_ = cmd.Process.Kill()
-	cmd.Wait()
-
-	// Читаем логи
-	logData, err := os.ReadFile(logPath)
-	require.NoError(t, err)
-	logStr := string(logData)
-
-	// Проверяем, что в логах есть событие
-	assert.Contains(t, logStr, "Processing sboxctl event")
-	assert.Contains(t, logStr, "IntegrationTest")
+func TestAgent_Integration_MockSboxctl(t *testing.T) {
+	h := harness.New(t)
+	sboxctl := h.FakeBinary("sboxctl",
+		`echo '{"type":"LOG","data":{"level":"info","message":"IntegrationTest"},"timestamp":"2025-06-27T16:30:00Z","version":"1.0"}'`)
+	h.WriteConfig(baseConfig + `
+services:
+  sboxctl:
+    enabled: true
+    command: ["` + sboxctl + `"]
+    interval: "1m"
+    timeout: "10s"
+    stdout_capture: true
+    health_check:
+      enabled: false
+`)
+	h.Start()
+
+	event := h.WaitForEvent(func(event map[string]interface{}) bool {
+		return event["source"] == "sboxctl"
+	})
+	assert.Equal(t, "LOG", event["type"])
+	assert.Equal(t, "IntegrationTest", event["data"].(map[string]interface{})["message"])
+
+	snapshot := h.StatusSnapshot()
+	assert.Equal(t, true, snapshot["running"])
+	assert.Equal(t, map[string]interface{}{
+		"running":  true,
+		"command":  []interface{}{sboxctl},
+		"interval": "1m0s",
+		"timeout":  "10s",
+	}, snapshot["sboxctl"])
 }
 
 func TestAgent_InvalidConfig(t *testing.T) {
-	tempDir, err := ioutil.TempDir("", "agent_invalid_config_test")
-	require.NoError(t, err)
-	defer os.RemoveAll(tempDir)
-
-	configPath := filepath.Join(tempDir, "invalid_agent.yaml")
-	logPath := filepath.Join(tempDir, "invalid_agent.log")
-
-	// Некорректный YAML (отсутствует обязательный блок agent и синтаксическая ошибка)
-	invalidConfig := `
+	// Invalid YAML (unterminated quote)
+	h := harness.New(t)
+	h.WriteConfig(`
 services:
   sboxctl:
     enabled: true
@@ -109,123 +72,132 @@ services:
       - echo
       - 'test
     interval: "1m"
-    timeout: "10s"
-    stdout_capture: true
-`
-	require.NoError(t, os.WriteFile(configPath, []byte(invalidConfig), 0644))
-
-	sboxagentPath := "./sboxagent"
-	if _, err := os.Stat(sboxagentPath); os.IsNotExist(err) {
-		// Автоматически собираем бинарник если его нет
-		buildCmd := exec.Command("go", "build", "-o", sboxagentPath, "../../cmd/sboxagent")
-		buildCmd.Dir = "."
-		if err := buildCmd.Run(); err != nil {
-			t.Skipf("Failed to build sboxagent binary: %v", err)
-		}
-	}
-
-	cmd := exec.Command(sboxagentPath, "-config", configPath)
-	logFile, err := os.Create(logPath)
-	require.NoError(t, err)
-	defer logFile.Close()
-	cmd.Stdout = logFile
-	cmd.Stderr = logFile
-
-	err = cmd.Start()
-	require.NoError(t, err)
-
-	// Ждём завершения процесса (он должен быстро завершиться с ошибкой)
-	done := make(chan error, 1)
-	go func() { done <- cmd.Wait() }()
-
-	select {
-	case err := <-done:
-		// Агент должен завершиться с ошибкой
-		assert.Error(t, err)
-	case <-time.After(3 * time.Second):
-		t.Error("Agent did not exit in time with invalid config")
-		_ = cmd.Process.Kill()
-	}
-
-	logData, err := os.ReadFile(logPath)
-	if err == nil {
-		logStr := string(logData)
-		assert.Contains(t, logStr, "Failed to load configuration")
-	}
+`)
+
+	_, err := config.Load(h.ConfigPath)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "failed to read config file")
 }
 
 func TestAgent_SboxctlDisabled(t *testing.T) {
-	tempDir, err := ioutil.TempDir("", "agent_sboxctl_disabled_test")
-	require.NoError(t, err)
-	defer os.RemoveAll(tempDir)
+	h := harness.New(t)
+	h.WriteConfig(baseConfig + `
+services:
+  sboxctl:
+    enabled: false
+    command: ["echo", "should not run"]
+`)
+	h.Start()
+
+	// The only events are the lifecycle transitions
+	h.WaitForEvent(func(event map[string]interface{}) bool {
+		data, _ := event["data"].(map[string]interface{})
+		return event["type"] == "STATE_CHANGED" && data["to"] == "ready"
+	})
+	snapshot := h.StatusSnapshot()
+	// The health checks run without the systemd watchdog or the API
+	health, ok := snapshot["health"].(map[string]interface{})
+	require.True(t, ok, "expected health status")
+	assert.Equal(t, true, health["running"])
+	assert.Equal(t, float64(30*time.Second), health["checkInterval"])
+	delete(snapshot, "health")
+	assert.Equal(t, map[string]interface{}{
+		"running": true,
+		"state":   "ready",
+		"commands": map[string]interface{}{
+			"capacity": float64(4), "running": float64(0), "queued": float64(0), "completed": float64(0), "rejected": float64(0),
+		},
+	}, snapshot)
+	h.ExpectNoEvent(200 * time.Millisecond)
+
+	h.Stop()
+	assert.False(t, h.Agent.IsRunning())
+}
 
-	configPath := filepath.Join(tempDir, "agent_disabled.yaml")
-	logPath := filepath.Join(tempDir, "agent_disabled.log")
+func TestAgent_SboxctlEnvironmentAndTemplates(t *testing.T) {
+	t.Setenv("SBOX_TEST_SECRET", "leaked")
 
-	configContent := `
+	h := harness.New(t)
+	envFile := h.Path("env.txt")
+	sboxctl := h.FakeBinary("sboxctl", `env > "`+envFile+`"; echo "$1" >> "`+envFile+`"`)
+	h.WriteConfig(baseConfig + `
+services:
+  environment:
+    allow: ["PATH"]
+    set: ["SBOX_PROFILE=test"]
+  sboxctl:
+    enabled: true
+    command: ["` + sboxctl + `", "--socket={{.SocketPath}}"]
+    interval: "1m"
+    timeout: "10s"
+    stdout_capture: false
+    health_check:
+      enabled: false
+`)
+	h.Start()
+
+	var env string
+	h.WaitFor("sboxctl run", func() bool {
+		data, err := os.ReadFile(envFile)
+		env = string(data)
+		return err == nil && strings.Contains(env, "--socket=")
+	})
+	assert.Contains(t, env, "SBOX_AGENT_SOCKET="+h.SocketPath+"\n")
+	assert.Contains(t, env, "SBOX_AGENT_NAME=integration-test\n")
+	assert.Contains(t, env, "SBOX_PROFILE=test\n")
+	assert.NotContains(t, env, "SBOX_TEST_SECRET")
+	// The command line is rendered from templates
+	assert.Contains(t, env, "--socket="+h.SocketPath+"\n")
+}
+
+func TestAgent_HeartbeatMetrics(t *testing.T) {
+	h := harness.New(t)
+	h.WriteConfig(`
 agent:
-  name: "integration-test-disabled"
-  version: "0.1.0"
-  log_level: "debug"
-server:
-  port: 8080
-  host: "127.0.0.1"
-  timeout: "30s"
+  name: "integration-test"
+  log_level: "error"
+  heartbeat_interval: "50ms"
 services:
   sboxctl:
     enabled: false
-    command: ["echo", "should not run"]
+`)
+	h.Start()
+
+	msg := h.WaitForHeartbeat()
+	assert.Equal(t, "integration-test", msg.Heartbeat.AgentID)
+	assert.Equal(t, "ready", msg.Heartbeat.Status)
+	metrics := msg.Metadata["metrics"].(map[string]interface{})
+	assert.Equal(t, "healthy", metrics["health"])
+	assert.NotZero(t, metrics["memory_bytes"])
+
+	status := h.Status()
+	assert.Contains(t, status, "metrics")
+}
+
+func TestAgent_StateTransitions(t *testing.T) {
+	h := harness.New(t)
+	sboxctl := h.FakeBinary("sboxctl", "exit 1")
+	h.WriteConfig(baseConfig + `
+services:
+  sboxctl:
+    enabled: true
+    command: ["` + sboxctl + `"]
     interval: "1m"
     timeout: "10s"
-    stdout_capture: true
     health_check:
       enabled: false
-logging:
-  stdout_capture: true
-  aggregation: true
-  retention_days: 1
-  max_entries: 100
-security:
-  allow_remote_api: false
-  api_token: "test-token"
-  allowed_hosts: ["127.0.0.1"]
-  tls_enabled: false
-`
-	require.NoError(t, os.WriteFile(configPath, []byte(configContent), 0644))
-
-	sboxagentPath := "./sboxagent"
-	if _, err := os.Stat(sboxagentPath); os.IsNotExist(err) {
-		// Автоматически собираем бинарник если его нет
-		buildCmd := exec.Command("go", "build", "-o", sboxagentPath, "../../cmd/sboxagent")
-		buildCmd.Dir = "."
-		if err := buildCmd.Run(); err != nil {
-			t.Skipf("Failed to build sboxagent binary: %v", err)
+`)
+	h.Start()
+
+	var states []interface{}
+	h.WaitForEvent(func(event map[string]interface{}) bool {
+		if event["type"] != "STATE_CHANGED" {
+			return false
 		}
-	}
-
-	cmd := exec.Command(sboxagentPath, "-config", configPath, "-debug")
-	logFile, err := os.Create(logPath)
-	require.NoError(t, err)
-	defer logFile.Close()
-	cmd.Stdout = logFile
-	cmd.Stderr = logFile
-
-	err = cmd.Start()
-	require.NoError(t, err)
-
-	// Ждём немного, чтобы агент успел стартовать
-	time.Sleep(2 * time.Second)
-
-	// Завершаем процесс
-	_ = cmd.Process.Kill()
-	cmd.Wait()
-
-	logData, err := os.ReadFile(logPath)
-	require.NoError(t, err)
-	logStr := string(logData)
-
-	// Проверяем, что сервис sboxctl не стартовал и не было событий
-	assert.Contains(t, logStr, "Agent starting")
-	assert.NotContains(t, logStr, "Sboxctl service starting")
-	assert.NotContains(t, logStr, "Processing sboxctl event")
-} 
\ No newline at end of file
+		to := event["data"].(map[string]interface{})["to"]
+		states = append(states, to)
+		return to == "degraded"
+	})
+	assert.Equal(t, []interface{}{"initializing", "syncing", "degraded"}, states)
+	assert.Equal(t, "degraded", h.Status()["state"])
+}